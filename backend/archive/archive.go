@@ -27,6 +27,7 @@ import (
 
 	// Import all the required archivers here
 	_ "github.com/rclone/rclone/backend/archive/squashfs"
+	_ "github.com/rclone/rclone/backend/archive/tar"
 	_ "github.com/rclone/rclone/backend/archive/zip"
 
 	"github.com/rclone/rclone/backend/archive/archiver"
@@ -219,3 +219,41 @@ func TestArchiveSquashfs(t *testing.T) {
 		run(t, "mksquashfs", input, output)
 	})
 }
+
+// Test creating and reading back some archives
+//
+// Note that this uses rclone and tar as external binaries.
+func TestArchiveTar(t *testing.T) {
+	fstest.Initialise()
+	skipIfNoExe(t, "tar")
+	skipIfNoExe(t, "rclone")
+	testArchive(t, "test.tar", func(t *testing.T, output, input string) {
+		run(t, "tar", "-C", input, "-cf", output, ".")
+	})
+}
+
+// Test creating and reading back some archives
+//
+// Note that this uses rclone, tar and gzip as external binaries.
+func TestArchiveTarGz(t *testing.T) {
+	fstest.Initialise()
+	skipIfNoExe(t, "tar")
+	skipIfNoExe(t, "gzip")
+	skipIfNoExe(t, "rclone")
+	testArchive(t, "test.tar.gz", func(t *testing.T, output, input string) {
+		run(t, "tar", "-C", input, "-czf", output, ".")
+	})
+}
+
+// Test creating and reading back some archives
+//
+// Note that this uses rclone, tar and zstd as external binaries.
+func TestArchiveTarZst(t *testing.T) {
+	fstest.Initialise()
+	skipIfNoExe(t, "tar")
+	skipIfNoExe(t, "zstd")
+	skipIfNoExe(t, "rclone")
+	testArchive(t, "test.tar.zst", func(t *testing.T, output, input string) {
+		run(t, "tar", "-C", input, "-I", "zstd", "-cf", output, ".")
+	})
+}
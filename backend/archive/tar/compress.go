@@ -0,0 +1,355 @@
+package tar
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression types
+const (
+	compressNone = iota
+	compressGzip
+	compressZstd
+)
+
+// newDecompressor returns a reader decompressing in
+func newDecompressor(compression int, in io.Reader) (io.ReadCloser, error) {
+	switch compression {
+	case compressNone:
+		return io.NopCloser(in), nil
+	case compressGzip:
+		return gzip.NewReader(in)
+	case compressZstd:
+		d, err := zstd.NewReader(in, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unknown compression %d", compression)
+}
+
+// newIndexingDecompressor returns a reader decompressing in which
+// records checkpoints where decompression can be restarted.
+//
+// The checkpoints are only complete once all of in has been read.
+func newIndexingDecompressor(compression int, in io.Reader) (indexingReader, error) {
+	switch compression {
+	case compressGzip:
+		return newGzipIndexer(in)
+	case compressZstd:
+		return newZstdIndexer(in)
+	}
+	return nil, fmt.Errorf("unknown compression %d", compression)
+}
+
+// indexingReader is a decompressor which records checkpoints
+type indexingReader interface {
+	io.ReadCloser
+	checkpoints() []checkpoint
+}
+
+// byteCounter counts the bytes read from a buffered reader.
+//
+// It implements io.ByteReader so that compress/gzip doesn't add a
+// buffer of its own, which means the count is exactly the number of
+// bytes gzip has consumed.
+type byteCounter struct {
+	in *bufio.Reader
+	n  int64
+}
+
+// Read bytes counting them
+func (c *byteCounter) Read(p []byte) (n int, err error) {
+	n, err = c.in.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ReadByte reads a single byte counting it
+func (c *byteCounter) ReadByte() (byte, error) {
+	b, err := c.in.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// gzipIndexer decompresses a gzip stream recording the start of
+// each gzip member as a checkpoint.
+//
+// Archives made by tools such as bgzip or pigz --independent have
+// many members so members can be decompressed on their own. Those
+// made by plain gzip have only one so can only be read sequentially.
+type gzipIndexer struct {
+	src  *byteCounter
+	gz   *gzip.Reader
+	uoff int64 // uncompressed bytes read so far
+	cps  []checkpoint
+}
+
+func newGzipIndexer(in io.Reader) (*gzipIndexer, error) {
+	g := &gzipIndexer{
+		src: &byteCounter{in: bufio.NewReaderSize(in, 1024*1024)},
+		cps: []checkpoint{{}},
+	}
+	var err error
+	g.gz, err = gzip.NewReader(g.src)
+	if err != nil {
+		return nil, err
+	}
+	g.gz.Multistream(false)
+	return g, nil
+}
+
+// Read decompressed bytes
+func (g *gzipIndexer) Read(p []byte) (n int, err error) {
+	for {
+		n, err = g.gz.Read(p)
+		g.uoff += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+		// End of a member - see if there is another one
+		start := g.src.n
+		err = g.gz.Reset(g.src)
+		if err == io.EOF {
+			return n, io.EOF
+		}
+		if err != nil {
+			return n, err
+		}
+		g.gz.Multistream(false)
+		g.cps = append(g.cps, checkpoint{Compressed: start, Uncompressed: g.uoff})
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close the decompressor
+func (g *gzipIndexer) Close() error {
+	return g.gz.Close()
+}
+
+// checkpoints returns the start of each member
+func (g *gzipIndexer) checkpoints() []checkpoint {
+	return g.cps
+}
+
+// zstd frame magic numbers
+const (
+	zstdMagic          = 0xFD2FB528
+	zstdSkippableMagic = 0x184D2A50 // low 4 bits are ignored
+)
+
+// zstd scanner states
+const (
+	zstdFrameStart = iota
+	zstdBlockStart
+	zstdFrameEnd
+)
+
+// zstdIndexer decompresses a zstd stream recording the start of each
+// frame as a checkpoint.
+//
+// It parses the frame structure of the compressed data as it passes
+// through to the decoder. The uncompressed offset of a frame is only
+// known if all the frames before it recorded their content size,
+// which zstd does when it knows the size of its input, so
+// checkpoints stop at the first frame without one.
+//
+// Archives made by tools such as pzstd or zstd -T0 --rsyncable have
+// many frames so can be read from the middle.
+type zstdIndexer struct {
+	src      io.Reader
+	pos      int64  // compressed bytes read so far
+	pending  []byte // header bytes read but not passed on yet
+	skip     int64  // bytes to pass on before the next header
+	state    int    // what to expect at the next header
+	checksum bool   // current frame has a checksum
+	known    bool   // uncompressed offsets are still known
+	uoff     int64  // uncompressed offset of the current frame
+	next     int64  // uncompressed offset of the next frame
+	cps      []checkpoint
+	d        *zstd.Decoder
+	buf      [18]byte
+	passthru bool // stopped parsing, pass everything through
+}
+
+func newZstdIndexer(in io.Reader) (*zstdIndexer, error) {
+	z := &zstdIndexer{
+		src:   in,
+		known: true,
+	}
+	d, err := zstd.NewReader(&zstdScanner{z}, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	z.d = d
+	return z, nil
+}
+
+// Read decompressed bytes
+func (z *zstdIndexer) Read(p []byte) (n int, err error) {
+	return z.d.Read(p)
+}
+
+// Close the decompressor
+func (z *zstdIndexer) Close() error {
+	z.d.Close()
+	return nil
+}
+
+// checkpoints returns the start of each frame with a known offset
+func (z *zstdIndexer) checkpoints() []checkpoint {
+	return z.cps
+}
+
+// zstdScanner is the io.Reader the decoder reads the compressed
+// data from
+type zstdScanner struct {
+	z *zstdIndexer
+}
+
+// Read compressed bytes, parsing the frame structure on the way
+func (s *zstdScanner) Read(p []byte) (n int, err error) {
+	z := s.z
+	for {
+		if len(z.pending) > 0 {
+			n = copy(p, z.pending)
+			z.pending = z.pending[n:]
+			return n, nil
+		}
+		if z.skip > 0 || z.passthru {
+			if !z.passthru && int64(len(p)) > z.skip {
+				p = p[:z.skip]
+			}
+			n, err = z.src.Read(p)
+			z.pos += int64(n)
+			z.skip -= int64(n)
+			if err == io.EOF && z.skip > 0 && !z.passthru {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		if err = z.parse(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readHeader reads n header bytes into z.buf[start:]
+func (z *zstdIndexer) readHeader(start, n int) error {
+	m, err := io.ReadFull(z.src, z.buf[start:start+n])
+	z.pos += int64(m)
+	z.pending = z.buf[:start+m]
+	if err == io.EOF && start > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// parse the next header in the stream
+func (z *zstdIndexer) parse() error {
+	switch z.state {
+	case zstdFrameStart:
+		start := z.pos
+		if err := z.readHeader(0, 4); err != nil {
+			return err
+		}
+		magic := binary.LittleEndian.Uint32(z.buf[:4])
+		switch {
+		case magic == zstdMagic:
+			return z.parseFrameHeader(start)
+		case magic&^0xF == zstdSkippableMagic:
+			if err := z.readHeader(4, 4); err != nil {
+				return err
+			}
+			z.skip = int64(binary.LittleEndian.Uint32(z.buf[4:8]))
+		default:
+			// Not something we understand so leave it to the decoder
+			z.known = false
+			z.passthru = true
+		}
+	case zstdBlockStart:
+		if err := z.readHeader(0, 3); err != nil {
+			return unexpected(err)
+		}
+		hdr := uint32(z.buf[0]) | uint32(z.buf[1])<<8 | uint32(z.buf[2])<<16
+		last := hdr&1 != 0
+		blockType := (hdr >> 1) & 3
+		z.skip = int64(hdr >> 3)
+		if blockType == 1 {
+			// RLE block has a single byte of content
+			z.skip = 1
+		}
+		if last {
+			z.state = zstdFrameEnd
+		}
+	case zstdFrameEnd:
+		if z.checksum {
+			z.skip = 4
+		}
+		z.uoff = z.next
+		z.state = zstdFrameStart
+	}
+	return nil
+}
+
+// parseFrameHeader parses the rest of a frame header starting at start
+func (z *zstdIndexer) parseFrameHeader(start int64) error {
+	if err := z.readHeader(4, 1); err != nil {
+		return err
+	}
+	fhd := z.buf[4]
+	singleSegment := fhd&0x20 != 0
+	z.checksum = fhd&0x04 != 0
+	dictIDSize := [4]int{0, 1, 2, 4}[fhd&3]
+	fcsSize := [4]int{0, 2, 4, 8}[fhd>>6]
+	if fcsSize == 0 && singleSegment {
+		fcsSize = 1
+	}
+	windowSize := 1
+	if singleSegment {
+		windowSize = 0
+	}
+	if err := z.readHeader(5, windowSize+dictIDSize+fcsSize); err != nil {
+		return err
+	}
+	fcs := z.buf[5+windowSize+dictIDSize : 5+windowSize+dictIDSize+fcsSize]
+	var size int64 = -1
+	switch fcsSize {
+	case 1:
+		size = int64(fcs[0])
+	case 2:
+		size = int64(binary.LittleEndian.Uint16(fcs)) + 256
+	case 4:
+		size = int64(binary.LittleEndian.Uint32(fcs))
+	case 8:
+		size = int64(binary.LittleEndian.Uint64(fcs))
+	}
+	if z.known {
+		z.cps = append(z.cps, checkpoint{Compressed: start, Uncompressed: z.uoff})
+		if size < 0 {
+			z.known = false
+		}
+		z.next = z.uoff + size
+	}
+	z.state = zstdBlockStart
+	return nil
+}
+
+// unexpected converts io.EOF into io.ErrUnexpectedEOF
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,273 @@
+package tar
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/lib/file"
+)
+
+// indexVersion should be increased whenever the index format or the
+// way it is built changes so old cached indexes are discarded
+const indexVersion = 1
+
+// entry describes a member of the archive
+type entry struct {
+	Name    string    `json:"name"`
+	Dir     bool      `json:"dir,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Offset  int64     `json:"off"` // offset of the data in the uncompressed stream
+}
+
+// checkpoint is a place in a compressed archive where decompression
+// can be started from.
+type checkpoint struct {
+	Compressed   int64 `json:"c"` // offset in the compressed archive
+	Uncompressed int64 `json:"u"` // corresponding offset in the uncompressed stream
+}
+
+// index describes the contents of an archive
+type index struct {
+	Version     int          `json:"ver"`
+	Fingerprint string       `json:"fingerprint"` // fingerprint of the archive this index is for
+	Entries     []entry      `json:"entries"`
+	Checkpoints []checkpoint `json:"checkpoints,omitempty"`
+}
+
+// checkpoint returns the last checkpoint at or before the
+// uncompressed offset off
+func (idx *index) checkpoint(off int64) checkpoint {
+	var cp checkpoint
+	for _, c := range idx.Checkpoints {
+		if c.Uncompressed > off {
+			break
+		}
+		cp = c
+	}
+	return cp
+}
+
+// indexCachePath returns the file the index for the archive is cached in
+func indexCachePath(name string) string {
+	sum := md5.Sum([]byte(name))
+	return filepath.Join(config.GetCacheDir(), "archive", "tar", hex.EncodeToString(sum[:])+".json")
+}
+
+// loadIndex loads the cached index for name if it is still valid
+func loadIndex(name, fingerprint string) (*index, error) {
+	data, err := os.ReadFile(indexCachePath(name))
+	if err != nil {
+		return nil, err
+	}
+	var idx index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, err
+	}
+	if idx.Version != indexVersion {
+		return nil, fmt.Errorf("index version %d is out of date", idx.Version)
+	}
+	if idx.Fingerprint != fingerprint {
+		return nil, errors.New("archive has changed")
+	}
+	return &idx, nil
+}
+
+// saveIndex writes idx to the index cache for name
+func saveIndex(name string, idx *index) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	cachePath := indexCachePath(name)
+	if err := file.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		return err
+	}
+	tmp := cachePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cachePath)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	in io.Reader
+	n  int64
+}
+
+// Read bytes counting them
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.in.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// Seek passes seeks through to the underlying reader if it can seek
+//
+// archive/tar uses this to skip over the data of members.
+func (r *countingReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := r.in.(io.Seeker)
+	if !ok || whence != io.SeekCurrent {
+		return 0, errors.New("can't seek")
+	}
+	pos, err := seeker.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	r.n += offset
+	return pos, nil
+}
+
+// buildIndex reads the uncompressed tar stream in and returns the
+// entries in it.
+func buildIndex(in io.Reader) ([]entry, error) {
+	cr := &countingReader{in: in}
+	tr := tar.NewReader(cr)
+	var entries []entry
+	byName := map[string]int{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := strings.Trim(path.Clean(hdr.Name), "/")
+		if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			continue
+		}
+		e := entry{
+			Name:    name,
+			ModTime: hdr.ModTime,
+			Offset:  cr.n,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.Dir = true
+		case tar.TypeReg:
+			if isSparse(hdr) {
+				fs.Logf(nil, "Tar: skipping sparse file %q", hdr.Name)
+				continue
+			}
+			e.Size = hdr.Size
+		case tar.TypeLink:
+			// A hard link to a file earlier in the archive
+			target := strings.Trim(path.Clean(hdr.Linkname), "/")
+			i, ok := byName[target]
+			if !ok || entries[i].Dir {
+				fs.Debugf(nil, "Tar: skipping hard link %q to unknown file %q", hdr.Name, hdr.Linkname)
+				continue
+			}
+			e.Size = entries[i].Size
+			e.Offset = entries[i].Offset
+		case tar.TypeGNUSparse:
+			fs.Logf(nil, "Tar: skipping sparse file %q", hdr.Name)
+			continue
+		default:
+			fs.Debugf(nil, "Tar: skipping %q of unsupported type %q", hdr.Name, hdr.Typeflag)
+			continue
+		}
+		if i, ok := byName[name]; ok {
+			// Later entries replace earlier ones with the same name
+			entries[i] = e
+		} else {
+			byName[name] = len(entries)
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// isSparse returns true if hdr describes a PAX sparse file whose
+// data isn't stored contiguously
+func isSparse(hdr *tar.Header) bool {
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// objectSeeker reads an fs.Object sequentially and implements Seek
+// relative to the current position by reopening the object at the
+// new offset when that is cheaper than reading the data.
+type objectSeeker struct {
+	ctx context.Context
+	o   fs.Object
+	in  io.ReadCloser
+	pos int64
+}
+
+// skipThreshold is the largest gap which is read and discarded
+// rather than reopening the object
+const skipThreshold = 1024 * 1024
+
+// Read from the object, opening it if necessary
+func (s *objectSeeker) Read(p []byte) (n int, err error) {
+	if s.in == nil {
+		var options []fs.OpenOption
+		if s.pos > 0 {
+			options = append(options, &fs.SeekOption{Offset: s.pos})
+		}
+		s.in, err = s.o.Open(s.ctx, options...)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err = s.in.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+// Seek relative to the current position
+func (s *objectSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekCurrent || offset < 0 {
+		return 0, errors.New("can only seek forwards")
+	}
+	if offset == 0 {
+		return s.pos, nil
+	}
+	if offset <= skipThreshold && s.in != nil {
+		n, err := io.CopyN(io.Discard, s, offset)
+		return s.pos, nonEOF(n, offset, err)
+	}
+	if err := s.Close(); err != nil {
+		return 0, err
+	}
+	s.pos += offset
+	return s.pos, nil
+}
+
+// nonEOF converts a short skip into an error
+func nonEOF(n, want int64, err error) error {
+	if err == io.EOF && n < want {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Close the object if open
+func (s *objectSeeker) Close() error {
+	if s.in == nil {
+		return nil
+	}
+	err := s.in.Close()
+	s.in = nil
+	return err
+}
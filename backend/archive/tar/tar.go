@@ -0,0 +1,450 @@
+// Package tar implements a tar archiver for the archive backend
+package tar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/backend/archive/archiver"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/dirtree"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/log"
+	"github.com/rclone/rclone/lib/readers"
+	"github.com/rclone/rclone/vfs"
+)
+
+func init() {
+	archiver.Register(archiver.Archiver{
+		New:       newFn(compressNone),
+		Extension: ".tar",
+	}, archiver.Archiver{
+		New:       newFn(compressGzip),
+		Extension: ".tar.gz",
+	}, archiver.Archiver{
+		New:       newFn(compressGzip),
+		Extension: ".tgz",
+	}, archiver.Archiver{
+		New:       newFn(compressZstd),
+		Extension: ".tar.zst",
+	}, archiver.Archiver{
+		New:       newFn(compressZstd),
+		Extension: ".tzst",
+	})
+}
+
+// Fs represents a wrapped fs.Fs
+type Fs struct {
+	f           fs.Fs
+	wrapper     fs.Fs
+	name        string
+	features    *fs.Features // optional features
+	o           fs.Object    // tar file object
+	compression int          // compression of the tar file
+	idx         *index       // index of the tar file
+	remote      string       // remote of the tar file object
+	prefix      string       // position for objects
+	prefixSlash string       // position for objects with a slash on
+	root        string       // position to read from within the archive
+	dt          dirtree.DirTree
+}
+
+// newFn returns a constructor for tar files with the compression given
+func newFn(compression int) func(ctx context.Context, wrappedFs fs.Fs, remote, prefix, root string) (fs.Fs, error) {
+	return func(ctx context.Context, wrappedFs fs.Fs, remote, prefix, root string) (fs.Fs, error) {
+		return New(ctx, wrappedFs, remote, prefix, root, compression)
+	}
+}
+
+// New constructs an Fs from the (wrappedFs, remote) with the objects
+// prefix with prefix and rooted at root
+func New(ctx context.Context, wrappedFs fs.Fs, remote, prefix, root string, compression int) (fs.Fs, error) {
+	fs.Debugf(nil, "Tar: New: remote=%q, prefix=%q, root=%q", remote, prefix, root)
+	o, err := wrappedFs.NewObject(ctx, remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %q archive: %w", remote, err)
+	}
+
+	f := &Fs{
+		f:           wrappedFs,
+		name:        path.Join(fs.ConfigString(wrappedFs), remote),
+		o:           o,
+		compression: compression,
+		remote:      remote,
+		root:        root,
+		prefix:      prefix,
+		prefixSlash: prefix + "/",
+	}
+
+	// Read the contents of the tar file
+	singleObject, err := f.readTar(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tar file: %w", err)
+	}
+
+	// the features here are ones we could support, and they are
+	// ANDed with the ones from wrappedFs
+	f.features = (&fs.Features{
+		CaseInsensitive:         false,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             false,
+		CanHaveEmptyDirectories: true,
+	}).Fill(ctx, f).Mask(ctx, wrappedFs).WrapsFs(f, wrappedFs)
+
+	if singleObject {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Tar %q", f.name)
+}
+
+// loadOrBuildIndex reads the index of the tar file from the cache,
+// or builds it by reading the tar file if it isn't cached.
+//
+// Building the index reads the whole of a compressed tar file, but
+// only the headers of an uncompressed one.
+func (f *Fs) loadOrBuildIndex(ctx context.Context) (idx *index, err error) {
+	fingerprint := fs.Fingerprint(ctx, f.o, true)
+	idx, err = loadIndex(f.name, fingerprint)
+	if err == nil {
+		fs.Debugf(f, "Loaded cached index with %d entries", len(idx.Entries))
+		return idx, nil
+	}
+	fs.Debugf(f, "Building index: %v", err)
+	idx = &index{
+		Version:     indexVersion,
+		Fingerprint: fingerprint,
+	}
+	in := &objectSeeker{ctx: ctx, o: f.o}
+	defer fs.CheckClose(in, &err)
+	if f.compression == compressNone {
+		idx.Entries, err = buildIndex(in)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		ir, err := newIndexingDecompressor(f.compression, in)
+		if err != nil {
+			return nil, err
+		}
+		defer fs.CheckClose(ir, &err)
+		idx.Entries, err = buildIndex(ir)
+		if err != nil {
+			return nil, err
+		}
+		// Read to the end to find all the checkpoints
+		if _, err = io.Copy(io.Discard, ir); err != nil {
+			return nil, err
+		}
+		idx.Checkpoints = ir.checkpoints()
+		fs.Debugf(f, "Found %d checkpoints", len(idx.Checkpoints))
+	}
+	if err := saveIndex(f.name, idx); err != nil {
+		fs.Logf(f, "Failed to cache index: %v", err)
+	}
+	return idx, nil
+}
+
+// readTar reads the index of the tar file into f
+//
+// Returns singleObject=true if f.root points to a file
+func (f *Fs) readTar(ctx context.Context) (singleObject bool, err error) {
+	idx, err := f.loadOrBuildIndex(ctx)
+	if err != nil {
+		return singleObject, err
+	}
+	f.idx = idx
+	dt := dirtree.New()
+	for i := range idx.Entries {
+		e := &idx.Entries[i]
+		remote := path.Join(f.prefix, e.Name)
+		if f.root != "" {
+			// Ignore all files outside the root
+			if !strings.HasPrefix(remote, f.root) {
+				continue
+			}
+			if remote == f.root {
+				remote = ""
+			} else {
+				remote = strings.TrimPrefix(remote, f.root+"/")
+			}
+		}
+		if e.Dir {
+			dt.AddDir(fs.NewDir(remote, e.ModTime))
+		} else {
+			if remote == "" {
+				remote = path.Base(f.root)
+				singleObject = true
+				dt = dirtree.New()
+			}
+			dt.Add(&Object{
+				f:      f,
+				remote: remote,
+				e:      e,
+			})
+			if singleObject {
+				break
+			}
+		}
+	}
+	dt.CheckParents("")
+	dt.Sort()
+	f.dt = dt
+	return singleObject, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	defer log.Trace(f, "dir=%q", dir)("entries=%v, err=%v", &entries, &err)
+	entries, ok := f.dt[dir]
+	if !ok {
+		return nil, fs.ErrorDirNotFound
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.
+func (f *Fs) NewObject(ctx context.Context, remote string) (o fs.Object, err error) {
+	defer log.Trace(f, "remote=%q", remote)("obj=%v, err=%v", &o, &err)
+	if f.dt == nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	_, entry := f.dt.Find(remote)
+	if entry == nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	o, ok := entry.(*Object)
+	if !ok {
+		return nil, fs.ErrorNotAFile
+	}
+	return o, nil
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return time.Second
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return vfs.EROFS
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return vfs.EROFS
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (o fs.Object, err error) {
+	return nil, vfs.EROFS
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set {
+	return hash.Set(hash.None)
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.f
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+// Object describes an object to be read from the tar file
+type Object struct {
+	f      *Fs
+	remote string
+	e      *entry
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Remote()
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.e.Size
+}
+
+// ModTime returns the modification time of the object
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.e.ModTime
+}
+
+// SetModTime sets the modification time of the local fs object
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	return vfs.EROFS
+}
+
+// Storable raturns a boolean indicating if this object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	return "", hash.ErrUnsupported
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+//
+// Members of uncompressed tar files are read with a range request.
+// Members of compressed tar files are decompressed from the last
+// checkpoint before them, which is the start of the file if the
+// archive was compressed as a single stream.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.ReadCloser, err error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.Size())
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if offset < 0 {
+		return nil, errors.New("invalid offset")
+	}
+	offset = min(offset, o.e.Size)
+	if limit < 0 || offset+limit > o.e.Size {
+		limit = o.e.Size - offset
+	}
+	if limit == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	start := o.e.Offset + offset
+
+	if o.f.compression == compressNone {
+		return o.f.o.Open(ctx, &fs.RangeOption{Start: start, End: start + limit - 1})
+	}
+
+	cp := o.f.idx.checkpoint(start)
+	var openOptions []fs.OpenOption
+	if cp.Compressed > 0 {
+		openOptions = append(openOptions, &fs.SeekOption{Offset: cp.Compressed})
+	}
+	in, err := o.f.o.Open(ctx, openOptions...)
+	if err != nil {
+		return nil, err
+	}
+	d, err := newDecompressor(o.f.compression, in)
+	if err != nil {
+		_ = in.Close()
+		return nil, err
+	}
+	rc = &decompressedReader{ReadCloser: d, in: in}
+	// discard data from the checkpoint to the start
+	if skip := start - cp.Uncompressed; skip > 0 {
+		if _, err = io.CopyN(io.Discard, rc, skip); err != nil {
+			_ = rc.Close()
+			return nil, err
+		}
+	}
+	return readers.NewLimitedReadCloser(rc, limit), nil
+}
+
+// decompressedReader reads from a decompressor, closing its input
+// when closed
+type decompressedReader struct {
+	io.ReadCloser
+	in io.Closer
+}
+
+// Close the decompressor and its input returning the first error
+func (d *decompressedReader) Close() error {
+	err := d.ReadCloser.Close()
+	if err2 := d.in.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return vfs.EROFS
+}
+
+// Remove an object
+func (o *Object) Remove(ctx context.Context) error {
+	return vfs.EROFS
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs        = (*Fs)(nil)
+	_ fs.UnWrapper = (*Fs)(nil)
+	_ fs.Wrapper   = (*Fs)(nil)
+	_ fs.Object    = (*Object)(nil)
+)
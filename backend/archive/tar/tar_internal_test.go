@@ -0,0 +1,254 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTime = time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+
+// testFile is a file in the test archive
+type testFile struct {
+	name string
+	data []byte
+}
+
+// makeTestFiles makes some files of random data big enough to span
+// several members of a compressed archive
+func makeTestFiles() []testFile {
+	r := rand.New(rand.NewSource(1))
+	var files []testFile
+	for i, size := range []int{0, 1, 1000, 100 * 1024, 300 * 1024, 5000} {
+		data := make([]byte, size)
+		r.Read(data)
+		files = append(files, testFile{name: fmt.Sprintf("dir/file%d.bin", i), data: data})
+	}
+	return files
+}
+
+// makeTar makes an uncompressed tar stream of files with a directory,
+// a hard link and a file which is replaced by a later one of the same
+// name.
+func makeTar(t *testing.T, files []testFile) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "dir/", ModTime: testTime, Mode: 0755}))
+	write := func(name string, data []byte) {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: int64(len(data)), ModTime: testTime, Mode: 0644}))
+		_, err := tw.Write(data)
+		require.NoError(t, err)
+	}
+	write("replaced.txt", []byte("old contents"))
+	for _, file := range files {
+		write(file.name, file.data)
+	}
+	write("replaced.txt", []byte("new contents"))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeLink, Name: "link.bin", Linkname: files[2].name, ModTime: testTime}))
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+// split data into pieces of size
+func split(data []byte, size int) (pieces [][]byte) {
+	for len(data) > size {
+		pieces = append(pieces, data[:size])
+		data = data[size:]
+	}
+	return append(pieces, data)
+}
+
+// gzipMembers compresses each piece as a separate gzip member like
+// bgzip does
+func gzipMembers(t *testing.T, pieces [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, piece := range pieces {
+		gw := gzip.NewWriter(&buf)
+		_, err := gw.Write(piece)
+		require.NoError(t, err)
+		require.NoError(t, gw.Close())
+	}
+	return buf.Bytes()
+}
+
+// zstdFrames compresses each piece as a separate zstd frame like
+// pzstd does
+func zstdFrames(t *testing.T, pieces [][]byte) []byte {
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, enc.Close()) }()
+	var out []byte
+	for _, piece := range pieces {
+		out = enc.EncodeAll(piece, out)
+	}
+	return out
+}
+
+// newTestFs writes the archive into a local remote and opens it
+func newTestFs(t *testing.T, name string, data []byte, compression int) *Fs {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0666))
+	wrapped, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	f, err := New(ctx, wrapped, name, name, "", compression)
+	require.NoError(t, err)
+	return f.(*Fs)
+}
+
+// readObject reads the file name in the archive with the options given
+func readObject(t *testing.T, f *Fs, name string, options ...fs.OpenOption) []byte {
+	ctx := context.Background()
+	o, err := f.NewObject(ctx, path.Join(f.prefix, name))
+	require.NoError(t, err)
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return data
+}
+
+func TestBuildIndex(t *testing.T) {
+	files := makeTestFiles()
+	data := makeTar(t, files)
+	entries, err := buildIndex(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	byName := map[string]entry{}
+	var names []string
+	for _, e := range entries {
+		byName[e.Name] = e
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"dir", "replaced.txt", "dir/file0.bin", "dir/file1.bin", "dir/file2.bin", "dir/file3.bin", "dir/file4.bin", "dir/file5.bin", "link.bin"}, names)
+	assert.True(t, byName["dir"].Dir)
+
+	// The offsets point at the data in the tar stream
+	for _, file := range files {
+		e := byName[file.name]
+		assert.Equal(t, int64(len(file.data)), e.Size, file.name)
+		assert.Equal(t, file.data, data[e.Offset:e.Offset+e.Size], file.name)
+		assert.True(t, testTime.Equal(e.ModTime), file.name)
+	}
+
+	// Later members replace earlier ones and hard links share data
+	e := byName["replaced.txt"]
+	assert.Equal(t, "new contents", string(data[e.Offset:e.Offset+e.Size]))
+	assert.Equal(t, byName["dir/file2.bin"].Offset, byName["link.bin"].Offset)
+	assert.Equal(t, byName["dir/file2.bin"].Size, byName["link.bin"].Size)
+}
+
+func TestIndexCheckpoint(t *testing.T) {
+	idx := index{Checkpoints: []checkpoint{{0, 0}, {100, 1000}, {200, 2000}}}
+	assert.Equal(t, checkpoint{0, 0}, idx.checkpoint(0))
+	assert.Equal(t, checkpoint{0, 0}, idx.checkpoint(999))
+	assert.Equal(t, checkpoint{100, 1000}, idx.checkpoint(1000))
+	assert.Equal(t, checkpoint{200, 2000}, idx.checkpoint(1e9))
+}
+
+func TestIndexingDecompressor(t *testing.T) {
+	data := makeTar(t, makeTestFiles())
+	pieces := split(data, 64*1024)
+	for _, test := range []struct {
+		name        string
+		compression int
+		compressed  []byte
+		want        int // number of checkpoints
+	}{
+		{"GzipSingle", compressGzip, gzipMembers(t, [][]byte{data}), 1},
+		{"GzipMembers", compressGzip, gzipMembers(t, pieces), len(pieces)},
+		{"ZstdFrames", compressZstd, zstdFrames(t, pieces), len(pieces)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ir, err := newIndexingDecompressor(test.compression, bytes.NewReader(test.compressed))
+			require.NoError(t, err)
+			got, err := io.ReadAll(ir)
+			require.NoError(t, err)
+			require.NoError(t, ir.Close())
+			assert.Equal(t, data, got)
+
+			// Each checkpoint can be decompressed from on its own
+			cps := ir.checkpoints()
+			require.Len(t, cps, test.want)
+			for _, cp := range cps {
+				d, err := newDecompressor(test.compression, bytes.NewReader(test.compressed[cp.Compressed:]))
+				require.NoError(t, err)
+				got, err := io.ReadAll(d)
+				require.NoError(t, err)
+				require.NoError(t, d.Close())
+				assert.Equal(t, data[cp.Uncompressed:], got)
+			}
+		})
+	}
+}
+
+func TestRandomAccess(t *testing.T) {
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	defer func() { require.NoError(t, config.SetCacheDir(oldCacheDir)) }()
+
+	files := makeTestFiles()
+	data := makeTar(t, files)
+	pieces := split(data, 64*1024)
+	for _, test := range []struct {
+		name        string
+		compression int
+		compressed  []byte
+	}{
+		{"test.tar", compressNone, data},
+		{"test.tar.gz", compressGzip, gzipMembers(t, [][]byte{data})},
+		{"test.tgz", compressGzip, gzipMembers(t, pieces)},
+		{"test.tzst", compressZstd, zstdFrames(t, pieces)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := newTestFs(t, test.name, test.compressed, test.compression)
+			if test.compression != compressNone {
+				assert.NotEmpty(t, f.idx.Checkpoints)
+			}
+
+			check := func(f *Fs) {
+				for _, file := range files {
+					assert.Equal(t, file.data, readObject(t, f, file.name), file.name)
+				}
+				assert.Equal(t, "new contents", string(readObject(t, f, "replaced.txt")))
+				assert.Equal(t, files[2].data, readObject(t, f, "link.bin"))
+
+				// Read parts of a file spanning several members
+				want := files[4].data
+				for _, r := range [][2]int64{{0, 10}, {70000, 200000}, {250000, int64(len(want)) - 1}} {
+					got := readObject(t, f, files[4].name, &fs.RangeOption{Start: r[0], End: r[1]})
+					assert.Equal(t, want[r[0]:r[1]+1], got, "range %v", r)
+				}
+				got := readObject(t, f, files[4].name, &fs.SeekOption{Offset: 123456})
+				assert.Equal(t, want[123456:], got)
+			}
+			check(f)
+
+			// Opening again uses the cached index
+			idx, err := loadIndex(f.name, fs.Fingerprint(context.Background(), f.o, true))
+			require.NoError(t, err)
+			assert.Equal(t, f.idx.Checkpoints, idx.Checkpoints)
+			assert.Equal(t, len(f.idx.Entries), len(idx.Entries))
+			f2, err := New(context.Background(), f.f, f.remote, f.remote, "", test.compression)
+			require.NoError(t, err)
+			check(f2.(*Fs))
+		})
+	}
+}
@@ -316,6 +316,21 @@ type UploadPartResponse struct {
 	SHA1       string `json:"contentSha1"`   // The SHA1 of the bytes stored in the file.
 }
 
+// ListPartsRequest is passed to b2_list_parts
+//
+// The response is a ListPartsResponse
+type ListPartsRequest struct {
+	ID              string `json:"fileId"`                    // The unique identifier of the file being uploaded.
+	StartPartNumber int64  `json:"startPartNumber,omitempty"` // The first part to return. If there is a part with this number, it will be returned as the first in the list.
+	MaxPartCount    int    `json:"maxPartCount,omitempty"`    // The maximum number of parts to return from this call. The default value is 100, and the maximum allowed is 1000.
+}
+
+// ListPartsResponse is the response to b2_list_parts
+type ListPartsResponse struct {
+	Parts          []UploadPartResponse `json:"parts"`          // The parts uploaded so far.
+	NextPartNumber *int64               `json:"nextPartNumber"` // What to pass in to startPartNumber for the next search to continue where this one left off, or null if there are no more.
+}
+
 // FinishLargeFileRequest is passed to b2_finish_large_file
 //
 // The response is a FileInfo object (with extra AccountID and BucketID fields which we ignore).
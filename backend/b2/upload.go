@@ -87,6 +87,7 @@ type largeUpload struct {
 	chunkSize int64                           // chunk size to use
 	src       *Object                         // if copying, object we are reading from
 	info      *api.FileInfo                   // final response with info about the object
+	resumed   []int                           // chunks already uploaded if resuming
 }
 
 // newLargeUpload starts an upload of object o from in with metadata in src
@@ -153,25 +154,11 @@ func (f *Fs) newLargeUpload(ctx context.Context, o *Object, in io.Reader, src fs
 			CustomerKeyMd5: o.fs.opt.SSECustomerKeyMD5,
 		}
 	}
-	opts := rest.Opts{
-		Method:  "POST",
-		Path:    "/b2_start_large_file",
-		Options: optionsToSend,
-	}
-	var response api.StartLargeFileResponse
-	err = f.pacer.Call(func() (bool, error) {
-		resp, err := f.srv.CallJSON(ctx, &opts, &request, &response)
-		return f.shouldRetry(ctx, resp, err)
-	})
-	if err != nil {
-		return nil, err
-	}
 	up = &largeUpload{
 		f:         f,
 		o:         o,
 		doCopy:    doCopy,
 		what:      "upload",
-		id:        response.ID,
 		size:      size,
 		parts:     parts,
 		sha1s:     make([]string, 0, 16),
@@ -185,9 +172,101 @@ func (f *Fs) newLargeUpload(ctx context.Context, o *Object, in io.Reader, src fs
 	} else {
 		up.in, up.wrap = accounting.UnWrap(in)
 	}
+	// Carry on with a previous large file upload if requested
+	if !doCopy {
+		for _, option := range options {
+			if x, ok := option.(*fs.ChunkWriterResumeOption); ok && x.Token != "" {
+				err = up.resume(ctx, x.Token)
+				if err == nil {
+					fs.Debugf(o, "Resumed large file upload %q with %d parts", x.Token, len(up.resumed))
+					return up, nil
+				}
+				fs.Debugf(o, "Failed to resume large file upload %q - starting a new one: %v", x.Token, err)
+			}
+		}
+	}
+	opts := rest.Opts{
+		Method:  "POST",
+		Path:    "/b2_start_large_file",
+		Options: optionsToSend,
+	}
+	var response api.StartLargeFileResponse
+	err = f.pacer.Call(func() (bool, error) {
+		resp, err := f.srv.CallJSON(ctx, &opts, &request, &response)
+		return f.shouldRetry(ctx, resp, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	up.id = response.ID
 	return up, nil
 }
 
+// resume carries on with the large file upload id reading the parts
+// which have already been uploaded from the server.
+//
+// Only parts which are the expected size are kept.
+func (up *largeUpload) resume(ctx context.Context, id string) error {
+	opts := rest.Opts{
+		Method: "POST",
+		Path:   "/b2_list_parts",
+	}
+	var request = api.ListPartsRequest{
+		ID:           id,
+		MaxPartCount: 1000,
+	}
+	var sha1s []string
+	var resumed []int
+	for {
+		var response api.ListPartsResponse
+		err := up.f.pacer.Call(func() (bool, error) {
+			resp, err := up.f.srv.CallJSON(ctx, &opts, &request, &response)
+			return up.f.shouldRetry(ctx, resp, err)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list parts of large file: %w", err)
+		}
+		for _, part := range response.Parts {
+			chunkNumber := int(part.PartNumber - 1)
+			wantSize := up.chunkSize
+			if up.size >= 0 && up.size-int64(chunkNumber)*up.chunkSize < wantSize {
+				wantSize = up.size - int64(chunkNumber)*up.chunkSize
+			}
+			if chunkNumber < 0 || part.Size != wantSize {
+				fs.Debugf(up.o, "Ignoring part %d with size %d, expecting %d", part.PartNumber, part.Size, wantSize)
+				continue
+			}
+			if len(sha1s) < chunkNumber+1 {
+				sha1s = append(sha1s, make([]string, chunkNumber+1-len(sha1s))...)
+			}
+			sha1s[chunkNumber] = part.SHA1
+			resumed = append(resumed, chunkNumber)
+		}
+		if response.NextPartNumber == nil {
+			break
+		}
+		request.StartPartNumber = *response.NextPartNumber
+	}
+	up.id = id
+	up.sha1smu.Lock()
+	up.sha1s = sha1s
+	up.sha1smu.Unlock()
+	up.resumed = resumed
+	return nil
+}
+
+// ResumeToken returns the ID of the large file which can be used to
+// resume the upload
+func (up *largeUpload) ResumeToken() string {
+	return up.id
+}
+
+// ResumedChunks returns the chunks which were already uploaded if
+// this carried on with a previous large file upload
+func (up *largeUpload) ResumedChunks() []int {
+	return up.resumed
+}
+
 // getUploadURL returns the upload info with the UploadURL and the AuthorizationToken
 //
 // This should be returned with returnUploadURL when finished
@@ -47,6 +47,7 @@ func TestIntegration(t *testing.T) {
 			"UserInfo",
 			"Disconnect",
 			"ListP",
+			"HardLink",
 		},
 	}
 	if *fstest.RemoteName == "" {
@@ -0,0 +1,119 @@
+package chunkstore
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// gear is the table of random values used by the rolling hash.
+//
+// It is generated from a fixed seed so chunk boundaries are stable
+// across releases - changing it would stop new uploads deduplicating
+// against data already in the store.
+var gear = func() (table [256]uint64) {
+	// splitmix64
+	var state uint64
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// cdcSplitter splits a stream into content-defined chunks.
+//
+// A boundary is placed after a byte when the top bits of a gear
+// rolling hash of the preceding bytes are all zero. Since the hash
+// only depends on the last 64 bytes, an insertion or deletion only
+// moves the boundaries near the edit and the rest of the chunks stay
+// the same.
+type cdcSplitter struct {
+	in    io.Reader
+	min   int    // minimum chunk size
+	max   int    // maximum chunk size
+	shift uint   // hash>>shift == 0 marks a boundary
+	buf   []byte // buffered input
+	start int    // start of unconsumed data in buf
+	end   int    // end of valid data in buf
+	eof   bool   // set when in is exhausted
+}
+
+// newCDCSplitter makes a splitter reading from in with chunks
+// averaging avg bytes. avg must be a power of two.
+//
+// Chunks are between avg/4 and avg*4 bytes long except for the last
+// one which may be shorter.
+func newCDCSplitter(in io.Reader, avg int) *cdcSplitter {
+	return &cdcSplitter{
+		in:    in,
+		min:   avg / 4,
+		max:   avg * 4,
+		shift: uint(64 - bits.Len(uint(avg)-1)),
+		buf:   make([]byte, avg*4),
+	}
+}
+
+// cut returns the length of the first chunk in p
+func (s *cdcSplitter) cut(p []byte) int {
+	if len(p) <= s.min {
+		return len(p)
+	}
+	if len(p) > s.max {
+		p = p[:s.max]
+	}
+	var h uint64
+	// Prime the hash with the bytes just before the minimum so the
+	// first candidate boundary depends on a full window.
+	i := max(s.min-64, 0)
+	for ; i < s.min; i++ {
+		h = h<<1 + gear[p[i]]
+	}
+	for ; i < len(p); i++ {
+		h = h<<1 + gear[p[i]]
+		if h>>s.shift == 0 {
+			return i + 1
+		}
+	}
+	return len(p)
+}
+
+// fill reads from the input until the buffer holds a maximum sized
+// chunk or the input is exhausted.
+func (s *cdcSplitter) fill() error {
+	if s.start > 0 {
+		s.end = copy(s.buf, s.buf[s.start:s.end])
+		s.start = 0
+	}
+	for s.end < len(s.buf) && !s.eof {
+		n, err := s.in.Read(s.buf[s.end:])
+		s.end += n
+		if errors.Is(err, io.EOF) {
+			s.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Next returns the next chunk or io.EOF when there are no more.
+//
+// The returned slice is only valid until the next call.
+func (s *cdcSplitter) Next() ([]byte, error) {
+	if s.end-s.start < s.max && !s.eof {
+		if err := s.fill(); err != nil {
+			return nil, err
+		}
+	}
+	if s.start == s.end {
+		return nil, io.EOF
+	}
+	p := s.buf[s.start:s.end]
+	n := s.cut(p)
+	s.start += n
+	return p[:n], nil
+}
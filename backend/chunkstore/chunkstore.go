@@ -0,0 +1,1067 @@
+// Package chunkstore provides wrappers for Fs and Object which store
+// files as deduplicated content-defined chunks
+package chunkstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	gohash "hash"
+	"io"
+	"path"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"golang.org/x/sync/errgroup"
+)
+
+// The wrapped remote is laid out like this
+//
+//	files/path/to/file.txt.<size>.cdc    - manifest for path/to/file.txt
+//	chunks/<xx>/<sha256>                 - chunk with hash <sha256>
+//
+// The manifest is a small JSON file listing the chunks which make up
+// the file in order. The size of the file is stored in the manifest
+// name so that listings don't need to read the manifests.
+//
+// Chunks are named after the SHA-256 of their contents so a chunk
+// shared by several files (or several versions of a file) is only
+// stored once. Removing a file only removes its manifest - chunks
+// which are no longer referenced are removed by `rclone cleanup`.
+const (
+	filesDir        = "files"
+	chunksDir       = "chunks"
+	manifestExt     = ".cdc"
+	manifestVersion = 1
+	maxManifestSize = 256 * 1024 * 1024 // refuse to read manifests bigger than this
+)
+
+var manifestNameRegexp = regexp.MustCompile(`^(.+)\.(\d+)` + regexp.QuoteMeta(manifestExt) + `$`)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "chunkstore",
+		Description: "Deduplicate files into a content-defined chunk store",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name:     "remote",
+			Required: true,
+			Help: `Remote to store the chunks and manifests in.
+
+Normally should contain a ':' and a path, e.g. "myremote:path/to/dir",
+"myremote:bucket" or maybe "myremote:" (not recommended).`,
+		}, {
+			Name:    "chunk_size",
+			Default: fs.SizeSuffix(1024 * 1024),
+			Help: `Average size of the chunks files are split into.
+
+Chunk boundaries are chosen by the content of the file so chunks vary
+between a quarter and four times this size. This must be a power of 2.
+
+Smaller chunks find more duplicate data but need more objects and
+bigger manifests. Changing this on an existing store is safe but new
+uploads won't deduplicate against data uploaded with a different
+chunk size.`,
+		}, {
+			Name:     "upload_concurrency",
+			Default:  4,
+			Advanced: true,
+			Help: `Number of chunks of a file to upload concurrently.
+
+Each chunk in flight is held in memory, so this uses up to
+upload_concurrency * chunk_size * 4 bytes of memory per transfer.`,
+		}, {
+			Name:     "cleanup_min_age",
+			Default:  fs.Duration(time.Hour),
+			Advanced: true,
+			Help: `Minimum age of unreferenced chunks removed by cleanup.
+
+Chunks uploaded or reused more recently than this are not removed by
+cleanup even if no manifest refers to them, so that cleanup doesn't
+remove chunks belonging to uploads which are still in progress.
+
+Uploads refresh the modification time of the chunks they reuse, so
+this should be longer than the longest upload.`,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote            string        `config:"remote"`
+	ChunkSize         fs.SizeSuffix `config:"chunk_size"`
+	UploadConcurrency int           `config:"upload_concurrency"`
+	CleanupMinAge     fs.Duration   `config:"cleanup_min_age"`
+}
+
+// Fs represents a wrapped fs.Fs
+type Fs struct {
+	name     string
+	root     string
+	base     fs.Fs        // remote holding the manifests
+	chunks   fs.Fs        // remote holding the chunks
+	files    string       // remote path of the top of the manifests
+	wrapper  fs.Fs        // wrapper is used by SetWrapper
+	opt      Options      // copy of Options
+	features *fs.Features // optional features
+	known    sync.Map     // hashes of chunks known to be in the store to when they were checked
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if opt.ChunkSize < 4096 || opt.ChunkSize&(opt.ChunkSize-1) != 0 {
+		return nil, fmt.Errorf("chunk_size must be a power of 2 and at least 4 KiB, got %v", opt.ChunkSize)
+	}
+	if opt.UploadConcurrency < 1 {
+		opt.UploadConcurrency = 1
+	}
+
+	remote := opt.Remote
+	if strings.HasPrefix(remote, name+":") {
+		return nil, errors.New("can't point remote at itself - check the value of the remote setting")
+	}
+
+	baseName, basePath, err := fspath.SplitFs(remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse remote %q to wrap: %w", remote, err)
+	}
+	rpath = strings.Trim(rpath, "/")
+	files := baseName + fspath.JoinRootPath(basePath, filesDir)
+	baseFs, err := cache.Get(ctx, baseName+fspath.JoinRootPath(basePath, path.Join(filesDir, rpath)))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q to wrap: %w", remote, err)
+	}
+	chunksFs, err := cache.Get(ctx, baseName+fspath.JoinRootPath(basePath, chunksDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make remote %q to store chunks: %w", remote, err)
+	}
+
+	f := &Fs{
+		base:   baseFs,
+		chunks: chunksFs,
+		files:  files,
+		name:   name,
+		root:   rpath,
+		opt:    *opt,
+	}
+
+	// If the root is a file then its manifest is in the parent
+	// directory with a name we don't know, so look for it there.
+	var isFile bool
+	if rpath != "" {
+		parent := path.Dir(rpath)
+		if parent == "." {
+			parent = ""
+		}
+		parentFs, err := cache.Get(ctx, baseName+fspath.JoinRootPath(basePath, path.Join(filesDir, parent)))
+		if err == nil {
+			pf := &Fs{base: parentFs, chunks: chunksFs}
+			if _, err := pf.NewObject(ctx, path.Base(rpath)); err == nil {
+				f.base = parentFs
+				f.root = parent
+				isFile = true
+			}
+		}
+	}
+	cache.Pin(f.base)
+	cache.Pin(f.chunks)
+	runtime.SetFinalizer(f, func(f *Fs) {
+		cache.Unpin(f.base)
+		cache.Unpin(f.chunks)
+	})
+
+	// Note 1: the features here are ones we could support, and they are
+	// ANDed with the ones from wrappedFs.
+	// Note 2: PutStream and CleanUp don't need support from the wrapped
+	// remote so they are set after the mask.
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(ctx, f).Mask(ctx, f.base).WrapsFs(f, f.base)
+	f.features.PutStream = f.PutStream
+	f.features.CleanUp = f.CleanUp
+
+	if isFile {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// manifest describes the chunks a file is made of
+type manifest struct {
+	Version int             `json:"ver"`
+	Size    int64           `json:"size"`
+	MD5     string          `json:"md5,omitempty"`
+	SHA1    string          `json:"sha1,omitempty"`
+	Chunks  []manifestChunk `json:"chunks"`
+}
+
+// manifestChunk is a single chunk in a manifest
+type manifestChunk struct {
+	Hash string `json:"h"` // hex SHA-256 of the chunk
+	Size int64  `json:"s"` // size of the chunk
+}
+
+// makeManifestName returns the name of the manifest for remote
+func makeManifestName(remote string, size int64) string {
+	return remote + "." + strconv.FormatInt(size, 10) + manifestExt
+}
+
+// parseManifestName returns the remote and size encoded in the name
+// of a manifest. ok is false if the name isn't a manifest name.
+func parseManifestName(name string) (remote string, size int64, ok bool) {
+	match := manifestNameRegexp.FindStringSubmatch(name)
+	if match == nil {
+		return "", 0, false
+	}
+	size, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return match[1], size, true
+}
+
+// chunkName returns the name of the chunk with the given hash
+func chunkName(h string) string {
+	return h[:2] + "/" + h
+}
+
+// readManifest reads and decodes the manifest in mo
+func readManifest(ctx context.Context, mo fs.Object) (*manifest, error) {
+	if mo.Size() > maxManifestSize {
+		return nil, fmt.Errorf("manifest too big (%d bytes)", mo.Size())
+	}
+	in, err := mo.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	data, err := io.ReadAll(in)
+	_ = in.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var mf manifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if mf.Version < 1 || mf.Version > manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", mf.Version)
+	}
+	var total int64
+	for _, c := range mf.Chunks {
+		if len(c.Hash) != 2*sha256.Size || c.Size <= 0 {
+			return nil, fmt.Errorf("invalid chunk %q in manifest", c.Hash)
+		}
+		total += c.Size
+	}
+	if total != mf.Size {
+		return nil, fmt.Errorf("manifest chunks total %d bytes but file is %d bytes", total, mf.Size)
+	}
+	return &mf, nil
+}
+
+// processEntries converts manifests into Objects
+func (f *Fs) processEntries(entries fs.DirEntries) (fs.DirEntries, error) {
+	newEntries := entries[:0] // in place filter
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			remote, size, ok := parseManifestName(x.Remote())
+			if !ok {
+				fs.Debugf(x, "Ignoring file which isn't a manifest")
+				continue
+			}
+			newEntries = append(newEntries, f.newObject(remote, size, x, nil))
+		case fs.Directory:
+			newEntries = append(newEntries, x)
+		default:
+			return nil, fmt.Errorf("unknown object type %T", entry)
+		}
+	}
+	return newEntries, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	entries, err = f.base.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	return f.processEntries(entries)
+}
+
+// ListR lists the objects and directories of the Fs starting
+// from dir recursively into out.
+//
+// dir should be "" to start from the root, and should not
+// have trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// It should call callback for each tranche of entries read.
+// These need not be returned in any particular order.  If
+// callback returns an error then the listing will stop
+// immediately.
+func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	do := f.base.Features().ListR
+	return do(ctx, dir, func(entries fs.DirEntries) error {
+		newEntries, err := f.processEntries(entries)
+		if err != nil {
+			return err
+		}
+		return callback(newEntries)
+	})
+}
+
+// NewObject finds the Object at remote.
+//
+// As the manifest name contains the size this needs to list the
+// parent directory.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	entries, err := f.base.List(ctx, dir)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var found *Object
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			name, size, ok := parseManifestName(x.Remote())
+			if !ok || name != remote {
+				continue
+			}
+			if found != nil {
+				fs.Logf(found, "Found duplicate manifest %q - ignoring", x.Remote())
+				continue
+			}
+			found = f.newObject(remote, size, x, nil)
+		case fs.Directory:
+			if x.Remote() == remote && found == nil {
+				err = fs.ErrorIsDir
+			}
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// isKnown returns true if the chunk with hash h was found in or
+// uploaded to the store recently enough that it doesn't need checking
+// again.
+//
+// Checking a chunk refreshes its age so cleanup leaves it alone for
+// cleanup_min_age. Only half of that is used here so that the upload
+// has time to write its manifest before the chunk may be removed.
+func (f *Fs) isKnown(h string) bool {
+	checked, ok := f.known.Load(h)
+	return ok && time.Since(checked.(time.Time)) < time.Duration(f.opt.CleanupMinAge)/2
+}
+
+// putChunk uploads the chunk data with hash h unless it is already
+// in the store
+//
+// If the chunk is already in the store its modification time is
+// refreshed so cleanup doesn't remove it before the manifest which
+// refers to it is written.
+func (f *Fs) putChunk(ctx context.Context, h string, data []byte) error {
+	name := chunkName(h)
+	checked := time.Now()
+	o, err := f.chunks.NewObject(ctx, name)
+	if err == nil {
+		err = o.SetModTime(ctx, checked)
+		if err == nil {
+			f.known.Store(h, checked)
+			return nil
+		}
+		if !errors.Is(err, fs.ErrorCantSetModTime) && !errors.Is(err, fs.ErrorCantSetModTimeWithoutDelete) {
+			return fmt.Errorf("failed to refresh chunk %s: %w", h, err)
+		}
+		// Upload the chunk again to refresh it instead
+	} else if !errors.Is(err, fs.ErrorObjectNotFound) {
+		return fmt.Errorf("failed to check chunk %s: %w", h, err)
+	}
+	src := object.NewStaticObjectInfo(name, checked, int64(len(data)), true, nil, f.chunks)
+	_, err = f.chunks.Put(ctx, bytes.NewReader(data), src)
+	if err != nil {
+		return fmt.Errorf("failed to upload chunk %s: %w", h, err)
+	}
+	f.known.Store(h, checked)
+	return nil
+}
+
+// storeChunks splits in into chunks, uploads any the store doesn't
+// already have and returns the manifest describing them.
+func (f *Fs) storeChunks(ctx context.Context, in io.Reader) (*manifest, error) {
+	hasher, err := hash.NewMultiHasherTypes(hash.NewHashSet(hash.MD5, hash.SHA1))
+	if err != nil {
+		return nil, err
+	}
+	mf := &manifest{Version: manifestVersion}
+	splitter := newCDCSplitter(io.TeeReader(in, hasher), int(f.opt.ChunkSize))
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(f.opt.UploadConcurrency)
+	for gCtx.Err() == nil {
+		p, err := splitter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = g.Wait()
+			return nil, err
+		}
+		sum := sha256.Sum256(p)
+		h := hex.EncodeToString(sum[:])
+		mf.Chunks = append(mf.Chunks, manifestChunk{Hash: h, Size: int64(len(p))})
+		mf.Size += int64(len(p))
+		if f.isKnown(h) {
+			continue
+		}
+		data := bytes.Clone(p)
+		g.Go(func() error {
+			return f.putChunk(gCtx, h, data)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sums := hasher.Sums()
+	mf.MD5 = sums[hash.MD5]
+	mf.SHA1 = sums[hash.SHA1]
+	return mf, nil
+}
+
+// encodeManifest checks mf against src and encodes it
+func encodeManifest(mf *manifest, src fs.ObjectInfo) ([]byte, error) {
+	if size := src.Size(); size >= 0 && size != mf.Size {
+		return nil, fmt.Errorf("upload was %d bytes but expected %d bytes", mf.Size, size)
+	}
+	return json.Marshal(mf)
+}
+
+// put uploads in as a new file
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	mf, err := f.storeChunks(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	data, err := encodeManifest(mf, src)
+	if err != nil {
+		return nil, err
+	}
+	remote := src.Remote()
+	mo, err := f.base.Put(ctx, bytes.NewReader(data), f.wrapInfo(src, makeManifestName(remote, mf.Size), int64(len(data))), options...)
+	if err != nil {
+		return nil, err
+	}
+	return f.newObject(remote, mf.Size, mo, mf), nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.NewObject(ctx, src.Remote())
+	switch err {
+	case nil:
+		return o, o.Update(ctx, in, src, options...)
+	case fs.ErrorObjectNotFound:
+		return f.put(ctx, in, src, options...)
+	default:
+		return nil, err
+	}
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+//
+// The size isn't needed until the whole file has been chunked so
+// this doesn't need any support from the wrapped remote.
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.Put(ctx, in, src, options...)
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set {
+	return hash.NewHashSet(hash.MD5, hash.SHA1)
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return f.base.Mkdir(ctx, dir)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return f.base.Rmdir(ctx, dir)
+}
+
+// Purge all files in the directory
+//
+// This only removes the manifests - use cleanup to remove the chunks
+// which are no longer referenced.
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	do := f.base.Features().Purge
+	if do == nil {
+		return fs.ErrorCantPurge
+	}
+	return do(ctx, dir)
+}
+
+// sameStore returns true if src stores its chunks in the same place as f
+func (f *Fs) sameStore(src *Fs) bool {
+	return fs.ConfigString(f.chunks) == fs.ConfigString(src.chunks)
+}
+
+type copyMoveFn func(context.Context, fs.Object, string) (fs.Object, error)
+
+// copyOrMove copies or moves the manifest of src to remote. As the
+// chunks are shared nothing else needs to be done.
+func (f *Fs) copyOrMove(ctx context.Context, src fs.Object, remote string, do copyMoveFn, opName string, cantErr error) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || do == nil {
+		fs.Debugf(src, "Can't %s - not same remote type", opName)
+		return nil, cantErr
+	}
+	if !f.sameStore(srcObj.f) {
+		fs.Debugf(src, "Can't %s - different chunk store", opName)
+		return nil, cantErr
+	}
+	// Find any existing manifest so it can be removed if it has a
+	// different name to the new one
+	var dstObj *Object
+	if o, err := f.NewObject(ctx, remote); err == nil {
+		dstObj = o.(*Object)
+	}
+	mo, err := do(ctx, srcObj.mo, makeManifestName(remote, srcObj.size))
+	if err != nil {
+		return nil, err
+	}
+	if dstObj != nil && dstObj.mo.Remote() != mo.Remote() {
+		if err := dstObj.mo.Remove(ctx); err != nil {
+			return nil, fmt.Errorf("failed to remove old manifest: %w", err)
+		}
+	}
+	return f.newObject(remote, srcObj.size, mo, srcObj.mf), nil
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	return f.copyOrMove(ctx, src, remote, f.base.Features().Copy, "copy", fs.ErrorCantCopy)
+}
+
+// Move src to this remote using server-side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	return f.copyOrMove(ctx, src, remote, f.base.Features().Move, "move", fs.ErrorCantMove)
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.base.Features().DirMove
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok || !f.sameStore(srcFs) {
+		fs.Debugf(srcFs, "Can't move directory - not same chunk store")
+		return fs.ErrorCantDirMove
+	}
+	return do(ctx, srcFs.base, srcRemote, dstRemote)
+}
+
+// About gets quota information from the Fs
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.base.Features().About
+	if do == nil {
+		return nil, errors.New("not supported by underlying remote")
+	}
+	return do(ctx)
+}
+
+// UnWrap returns the Fs that this Fs is wrapping
+func (f *Fs) UnWrap() fs.Fs {
+	return f.base
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	do := f.base.Features().Shutdown
+	if do == nil {
+		return nil
+	}
+	return do(ctx)
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Chunk store '%s:%s'", f.name, f.root)
+}
+
+// Precision returns the precision of this Fs
+func (f *Fs) Precision() time.Duration {
+	return f.base.Precision()
+}
+
+// Object represents a file stored as a manifest and its chunks
+type Object struct {
+	f      *Fs
+	remote string
+	size   int64
+	mo     fs.Object // the manifest object
+	mu     sync.Mutex
+	mf     *manifest // manifest, nil if not read yet
+}
+
+// newObject makes an Object from a manifest object
+func (f *Fs) newObject(remote string, size int64, mo fs.Object, mf *manifest) *Object {
+	return &Object{
+		f:      f,
+		remote: remote,
+		size:   size,
+		mo:     mo,
+		mf:     mf,
+	}
+}
+
+// manifest returns the manifest, reading it if necessary
+func (o *Object) manifest(ctx context.Context) (*manifest, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.mf != nil {
+		return o.mf, nil
+	}
+	mf, err := readManifest(ctx, o.mo)
+	if err != nil {
+		return nil, err
+	}
+	if mf.Size != o.size {
+		return nil, fmt.Errorf("manifest is for %d bytes but name says %d bytes", mf.Size, o.size)
+	}
+	o.mf = mf
+	return mf, nil
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// String returns a description of the Object
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.mo.ModTime(ctx)
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	return o.mo.SetModTime(ctx, modTime)
+}
+
+// Storable returns whether object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	switch ht {
+	case hash.MD5, hash.SHA1:
+	default:
+		return "", hash.ErrUnsupported
+	}
+	mf, err := o.manifest(ctx)
+	if err != nil {
+		return "", err
+	}
+	if ht == hash.MD5 {
+		return mf.MD5, nil
+	}
+	return mf.SHA1, nil
+}
+
+// ID returns the ID of the Object if known, or "" if not
+func (o *Object) ID() string {
+	if doer, ok := o.mo.(fs.IDer); ok {
+		return doer.ID()
+	}
+	return ""
+}
+
+// UnWrap returns the wrapped manifest Object
+func (o *Object) UnWrap() fs.Object {
+	return o.mo
+}
+
+// Remove an object
+//
+// This only removes the manifest - use cleanup to remove the chunks
+// which are no longer referenced.
+func (o *Object) Remove(ctx context.Context) error {
+	return o.mo.Remove(ctx)
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	mf, err := o.f.storeChunks(ctx, in)
+	if err != nil {
+		return err
+	}
+	data, err := encodeManifest(mf, src)
+	if err != nil {
+		return err
+	}
+	name := makeManifestName(o.remote, mf.Size)
+	info := o.f.wrapInfo(src, name, int64(len(data)))
+	if name == o.mo.Remote() {
+		err = o.mo.Update(ctx, bytes.NewReader(data), info, options...)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Upload the new manifest before removing the old one so
+		// the file is never missing
+		mo, err := o.f.base.Put(ctx, bytes.NewReader(data), info, options...)
+		if err != nil {
+			return err
+		}
+		if err := o.mo.Remove(ctx); err != nil {
+			return fmt.Errorf("failed to remove old manifest: %w", err)
+		}
+		o.mo = mo
+	}
+	o.mu.Lock()
+	o.size = mf.Size
+	o.mf = mf
+	o.mu.Unlock()
+	return nil
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	mf, err := o.manifest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't open: %w", err)
+	}
+	var openOptions []fs.OpenOption
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch opt := option.(type) {
+		case *fs.SeekOption:
+			offset = opt.Offset
+		case *fs.RangeOption:
+			offset, limit = opt.Decode(mf.Size)
+		default:
+			// pass Options on to the chunk open, if appropriate
+			openOptions = append(openOptions, option)
+		}
+	}
+	if offset < 0 {
+		return nil, errors.New("invalid offset")
+	}
+	if limit < 0 || offset+limit > mf.Size {
+		limit = max(mf.Size-offset, 0)
+	}
+	r := &chunkReader{
+		ctx:     ctx,
+		f:       o.f,
+		options: openOptions,
+		chunks:  mf.Chunks,
+		offset:  offset,
+		limit:   limit,
+	}
+	// skip to the chunk containing offset
+	for len(r.chunks) > 0 && r.offset >= r.chunks[0].Size {
+		r.offset -= r.chunks[0].Size
+		r.chunks = r.chunks[1:]
+	}
+	return r, nil
+}
+
+// chunkReader reads the chunks of a file sequentially
+type chunkReader struct {
+	ctx     context.Context
+	f       *Fs
+	options []fs.OpenOption
+	chunks  []manifestChunk // chunks still to read
+	offset  int64           // offset into the first chunk
+	limit   int64           // bytes left to read
+	in      io.ReadCloser   // current chunk, nil if none
+	left    int64           // bytes left in the current chunk
+	hash    string          // hash of the current chunk
+	hasher  gohash.Hash     // hasher for the current chunk if reading all of it
+	err     error           // sticky error
+}
+
+// next opens the next chunk
+func (r *chunkReader) next() error {
+	if len(r.chunks) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	c := r.chunks[0]
+	r.chunks = r.chunks[1:]
+	start := r.offset
+	r.offset = 0
+	count := min(c.Size-start, r.limit)
+	chunk, err := r.f.chunks.NewObject(r.ctx, chunkName(c.Hash))
+	if err != nil {
+		return fmt.Errorf("failed to find chunk %s: %w", c.Hash, err)
+	}
+	options := r.options
+	r.hasher = nil
+	if start > 0 || count < c.Size {
+		options = append(slices.Clip(options), &fs.RangeOption{Start: start, End: start + count - 1})
+	} else {
+		r.hasher = sha256.New()
+	}
+	in, err := chunk.Open(r.ctx, options...)
+	if err != nil {
+		return fmt.Errorf("failed to open chunk %s: %w", c.Hash, err)
+	}
+	r.in = in
+	r.left = count
+	r.hash = c.Hash
+	return nil
+}
+
+// finish checks and closes the current chunk
+func (r *chunkReader) finish() error {
+	err := r.in.Close()
+	r.in = nil
+	if r.left != 0 {
+		return fmt.Errorf("chunk %s is truncated: %w", r.hash, io.ErrUnexpectedEOF)
+	}
+	if r.hasher != nil && hex.EncodeToString(r.hasher.Sum(nil)) != r.hash {
+		return fmt.Errorf("chunk %s is corrupted: hash mismatch", r.hash)
+	}
+	return err
+}
+
+// Read bytes from the chunks
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	for r.err == nil {
+		if r.in == nil {
+			if r.limit <= 0 {
+				r.err = io.EOF
+				break
+			}
+			if r.err = r.next(); r.err != nil {
+				break
+			}
+		}
+		if int64(len(p)) > r.left {
+			p = p[:r.left]
+		}
+		n, err = r.in.Read(p)
+		r.left -= int64(n)
+		r.limit -= int64(n)
+		if r.hasher != nil {
+			_, _ = r.hasher.Write(p[:n])
+		}
+		if err == io.EOF || r.left == 0 {
+			err = r.finish()
+		}
+		if err != nil {
+			r.err = err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+	return 0, r.err
+}
+
+// Close the reader
+func (r *chunkReader) Close() error {
+	if r.in != nil {
+		err := r.in.Close()
+		r.in = nil
+		return err
+	}
+	return nil
+}
+
+// ObjectInfo describes a wrapped fs.ObjectInfo for being the source
+// of a manifest upload
+type ObjectInfo struct {
+	fs.ObjectInfo
+	f      *Fs
+	remote string
+	size   int64
+}
+
+// wrapInfo wraps src so it describes the manifest newRemote of size
+func (f *Fs) wrapInfo(src fs.ObjectInfo, newRemote string, size int64) *ObjectInfo {
+	return &ObjectInfo{
+		ObjectInfo: src,
+		f:          f,
+		remote:     newRemote,
+		size:       size,
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (oi *ObjectInfo) Fs() fs.Info {
+	return oi.f
+}
+
+// Remote returns the remote path
+func (oi *ObjectInfo) Remote() string {
+	return oi.remote
+}
+
+// Size returns the size of the manifest
+func (oi *ObjectInfo) Size() int64 {
+	return oi.size
+}
+
+// Hash returns the selected checksum of the manifest
+//
+// The hashes of the source are for the file, not the manifest, so
+// don't return any.
+func (oi *ObjectInfo) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	return "", nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.CleanUpper      = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
+	_ fs.UnWrapper       = (*Fs)(nil)
+	_ fs.ListRer         = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.ObjectInfo      = (*ObjectInfo)(nil)
+	_ fs.Object          = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+	_ fs.IDer            = (*Object)(nil)
+)
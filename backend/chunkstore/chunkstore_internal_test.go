@@ -0,0 +1,249 @@
+package chunkstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomData(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+func splitAll(t *testing.T, data []byte, avg int) (chunks [][sha256.Size]byte) {
+	s := newCDCSplitter(bytes.NewReader(data), avg)
+	var joined []byte
+	for {
+		p, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		joined = append(joined, p...)
+		chunks = append(chunks, sha256.Sum256(p))
+	}
+	assert.Equal(t, data, joined)
+	return chunks
+}
+
+func TestCDCSplitter(t *testing.T) {
+	const avg = 4096
+	data := randomData(1024 * 1024)
+
+	// Check the chunk sizes are in bounds
+	s := newCDCSplitter(bytes.NewReader(data), avg)
+	var sizes []int
+	for {
+		p, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		sizes = append(sizes, len(p))
+	}
+	for i, size := range sizes {
+		assert.LessOrEqual(t, size, avg*4)
+		if i != len(sizes)-1 {
+			assert.GreaterOrEqual(t, size, avg/4)
+		}
+	}
+	mean := len(data) / len(sizes)
+	assert.True(t, mean > avg/2 && mean < avg*2, "mean chunk size %d", mean)
+
+	// Check an insertion only changes the chunks around it
+	before := splitAll(t, data, avg)
+	edited := append(append(append([]byte(nil), data[:100000]...), "inserted"...), data[100000:]...)
+	after := splitAll(t, edited, avg)
+	seen := make(map[[sha256.Size]byte]bool, len(before))
+	for _, h := range before {
+		seen[h] = true
+	}
+	changed := 0
+	for _, h := range after {
+		if !seen[h] {
+			changed++
+		}
+	}
+	assert.LessOrEqual(t, changed, 3)
+
+	// Check empty input
+	assert.Empty(t, splitAll(t, nil, avg))
+}
+
+func TestManifestName(t *testing.T) {
+	for _, test := range []struct {
+		in     string
+		remote string
+		size   int64
+		ok     bool
+	}{
+		{"file.txt.123.cdc", "file.txt", 123, true},
+		{"dir/file.0.cdc", "dir/file", 0, true},
+		{"a.1.cdc.2.cdc", "a.1.cdc", 2, true},
+		{"file.txt", "", 0, false},
+		{".1.cdc", "", 0, false},
+		{"file.x.cdc", "", 0, false},
+	} {
+		remote, size, ok := parseManifestName(test.in)
+		assert.Equal(t, test.ok, ok, test.in)
+		assert.Equal(t, test.remote, remote, test.in)
+		assert.Equal(t, test.size, size, test.in)
+		if ok {
+			assert.Equal(t, test.in, makeManifestName(remote, size))
+		}
+	}
+}
+
+func countChunks(ctx context.Context, t *testing.T, f *Fs) (n int) {
+	err := walk.ListR(ctx, f.chunks, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		n += len(entries)
+		return nil
+	})
+	require.NoError(t, err)
+	return n
+}
+
+func put(ctx context.Context, t *testing.T, f *Fs, remote string, data []byte) fs.Object {
+	src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06.499999999Z"), int64(len(data)), true, nil, nil)
+	o, err := f.Put(ctx, bytes.NewReader(data), src)
+	require.NoError(t, err)
+	return o
+}
+
+func readAll(ctx context.Context, t *testing.T, f *Fs, remote string) []byte {
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return data
+}
+
+func TestDeduplication(t *testing.T) {
+	ctx := context.Background()
+	fsys, err := NewFs(ctx, "TestChunkstoreInternal", "", configmap.Simple{
+		"remote":     t.TempDir(),
+		"chunk_size": "4k",
+	})
+	require.NoError(t, err)
+	f := fsys.(*Fs)
+
+	data := randomData(256 * 1024)
+	edited := append(append(append([]byte(nil), data[:100000]...), "inserted"...), data[100000:]...)
+
+	put(ctx, t, f, "a", data)
+	n := countChunks(ctx, t, f)
+	assert.Greater(t, n, 16)
+
+	// A copy of the same data shouldn't need any new chunks
+	put(ctx, t, f, "dir/b", data)
+	assert.Equal(t, n, countChunks(ctx, t, f))
+
+	// An edited version should only need a few new chunks
+	put(ctx, t, f, "c", edited)
+	added := countChunks(ctx, t, f) - n
+	assert.Greater(t, added, 0)
+	assert.LessOrEqual(t, added, 3)
+
+	assert.Equal(t, data, readAll(ctx, t, f, "a"))
+	assert.Equal(t, data, readAll(ctx, t, f, "dir/b"))
+	assert.Equal(t, edited, readAll(ctx, t, f, "c"))
+
+	// Read a range spanning several chunks
+	o, err := f.NewObject(ctx, "c")
+	require.NoError(t, err)
+	in, err := o.Open(ctx, &fs.RangeOption{Start: 5000, End: 150000})
+	require.NoError(t, err)
+	got, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, edited[5000:150001], got)
+
+	out, err := f.Command(ctx, "stats", nil, nil)
+	require.NoError(t, err)
+	stats := out.(map[string]any)
+	assert.Equal(t, int64(3), stats["files"])
+	assert.Equal(t, int64(3*len(data)+len("inserted")), stats["size"])
+	assert.Greater(t, stats["ratio"].(float64), 2.5)
+
+	// Cleanup shouldn't remove anything while everything is referenced
+	f.opt.CleanupMinAge = 0
+	require.NoError(t, f.CleanUp(ctx))
+	assert.Equal(t, n+added, countChunks(ctx, t, f))
+
+	// Removing the edited file should let cleanup remove its chunks
+	require.NoError(t, o.Remove(ctx))
+	f.opt.CleanupMinAge = fs.Duration(time.Hour)
+	require.NoError(t, f.CleanUp(ctx))
+	assert.Equal(t, n+added, countChunks(ctx, t, f), "chunks too new to remove")
+	f.opt.CleanupMinAge = 0
+	require.NoError(t, f.CleanUp(ctx))
+	assert.Equal(t, n, countChunks(ctx, t, f))
+
+	// Removing one of the duplicates shouldn't remove any chunks
+	o, err = f.NewObject(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, o.Remove(ctx))
+	require.NoError(t, f.CleanUp(ctx))
+	assert.Equal(t, n, countChunks(ctx, t, f))
+	assert.Equal(t, data, readAll(ctx, t, f, "dir/b"))
+}
+
+func TestReusedChunksRefreshed(t *testing.T) {
+	ctx := context.Background()
+	fsys, err := NewFs(ctx, "TestChunkstoreInternal", "", configmap.Simple{
+		"remote":     t.TempDir(),
+		"chunk_size": "4k",
+	})
+	require.NoError(t, err)
+	f := fsys.(*Fs)
+	f.opt.CleanupMinAge = fs.Duration(time.Hour)
+
+	// Make the chunks of a file look old
+	data := randomData(64 * 1024)
+	a := put(ctx, t, f, "a", data)
+	old := time.Now().Add(-2 * time.Hour)
+	err = walk.ListR(ctx, f.chunks, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			require.NoError(t, entry.(fs.Object).SetModTime(ctx, old))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	n := countChunks(ctx, t, f)
+
+	// The chunks are known so aren't checked again
+	assert.True(t, f.isKnown(a.(*Object).mf.Chunks[0].Hash))
+
+	// Reusing the chunks from another process refreshes them so a
+	// cleanup which doesn't see the new manifest leaves them alone
+	f.known.Clear()
+	b := put(ctx, t, f, "b", data)
+	require.NoError(t, a.Remove(ctx))
+	require.NoError(t, b.Remove(ctx))
+	require.NoError(t, f.CleanUp(ctx))
+	assert.Equal(t, n, countChunks(ctx, t, f))
+
+	// Known chunks expire
+	f.opt.CleanupMinAge = 0
+	assert.False(t, f.isKnown(a.(*Object).mf.Chunks[0].Hash))
+	require.NoError(t, f.CleanUp(ctx))
+	assert.Equal(t, 0, countChunks(ctx, t, f))
+}
@@ -0,0 +1,57 @@
+// Test the Chunkstore filesystem interface
+package chunkstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/all" // for integration tests
+	"github.com/rclone/rclone/backend/chunkstore"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+// TestIntegration runs integration tests against a concrete remote
+// set by the -remote flag. If the flag is not set, it creates a
+// dynamic chunkstore overlay wrapping a local temporary directory.
+func TestIntegration(t *testing.T) {
+	opt := fstests.Opt{
+		RemoteName: *fstest.RemoteName,
+		NilObject:  (*chunkstore.Object)(nil),
+		UnimplementableObjectMethods: []string{
+			"MimeType",
+			"GetTier",
+			"SetTier",
+			"Metadata",
+			"SetMetadata",
+		},
+		UnimplementableFsMethods: []string{
+			"PublicLink",
+			"OpenWriterAt",
+			"OpenChunkWriter",
+			"MergeDirs",
+			"DirCacheFlush",
+			"UserInfo",
+			"Disconnect",
+			"ListP",
+			"HardLink",
+			"PutUnchecked",
+			"ChangeNotify",
+			"DirSetModTime",
+			"MkdirMetadata",
+		},
+	}
+	if *fstest.RemoteName == "" {
+		name := "TestChunkstore"
+		opt.RemoteName = name + ":"
+		tempDir := filepath.Join(os.TempDir(), "rclone-chunkstore-test")
+		opt.ExtraConfig = []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "chunkstore"},
+			{Name: name, Key: "remote", Value: tempDir},
+			{Name: name, Key: "chunk_size", Value: "4k"},
+		}
+		opt.QuickTestOK = true
+	}
+	fstests.Run(t, &opt)
+}
@@ -0,0 +1,216 @@
+package chunkstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "stats",
+	Short: "Show deduplication statistics for the chunk store.",
+	Long: `This reads all the manifests in the chunk store and shows how much
+data they refer to and how much space the chunks take up.
+
+Usage example:
+
+` + "```console" + `
+rclone backend stats chunkstore:
+` + "```" + `
+
+Note that this covers the whole chunk store, not just the path given.`,
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out any, err error) {
+	switch name {
+	case "stats":
+		return f.stats(ctx)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// references holds the chunks referred to by the manifests
+type references struct {
+	mu     sync.Mutex
+	files  int64            // number of manifests
+	size   int64            // total size of the files
+	chunks map[string]int64 // size of each chunk referenced
+}
+
+// references reads all the manifests in the chunk store
+func (f *Fs) references(ctx context.Context) (*references, error) {
+	top, err := cache.Get(ctx, f.files)
+	if errors.Is(err, fs.ErrorIsFile) {
+		return nil, fmt.Errorf("%q is a file", f.files)
+	}
+	if err != nil {
+		return nil, err
+	}
+	refs := &references{
+		chunks: make(map[string]int64),
+	}
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	err = walk.ListR(ctx, top, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			mo, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			if _, _, ok := parseManifestName(mo.Remote()); !ok {
+				continue
+			}
+			g.Go(func() error {
+				mf, err := readManifest(gCtx, mo)
+				if err != nil {
+					return fmt.Errorf("%v: %w", mo, err)
+				}
+				refs.mu.Lock()
+				defer refs.mu.Unlock()
+				refs.files++
+				refs.size += mf.Size
+				for _, c := range mf.Chunks {
+					refs.chunks[c.Hash] = c.Size
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if gErr := g.Wait(); err == nil {
+		err = gErr
+	}
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// stats returns the deduplication statistics of the store
+func (f *Fs) stats(ctx context.Context) (out map[string]any, err error) {
+	refs, err := f.references(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var stored int64
+	for _, size := range refs.chunks {
+		stored += size
+	}
+	ratio := 1.0
+	if stored > 0 {
+		ratio = float64(refs.size) / float64(stored)
+	}
+	return map[string]any{
+		"files":  refs.files,
+		"size":   refs.size,
+		"chunks": len(refs.chunks),
+		"stored": stored,
+		"ratio":  ratio,
+	}, nil
+}
+
+// CleanUp removes chunks which aren't referenced by any manifest
+//
+// Chunks newer than cleanup_min_age are left alone as they may
+// belong to an upload in progress. Uploads refresh the age of the
+// chunks they reuse, so the age of each chunk is read again just
+// before it is removed.
+func (f *Fs) CleanUp(ctx context.Context) error {
+	refs, err := f.references(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read manifests: %w", err)
+	}
+
+	// Find the chunks which aren't referenced
+	var unreferenced []string
+	err = walk.ListR(ctx, f.chunks, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			if _, ok := refs.chunks[path.Base(o.Remote())]; !ok {
+				unreferenced = append(unreferenced, o.Remote())
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Read the manifests again in case uploads which finished
+	// while the chunks were being listed refer to any of them
+	if len(unreferenced) > 0 {
+		refs, err = f.references(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read manifests: %w", err)
+		}
+	}
+
+	cutoff := time.Now().Add(-time.Duration(f.opt.CleanupMinAge))
+	var (
+		mu      sync.Mutex
+		removed int64
+		freed   int64
+	)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	for _, remote := range unreferenced {
+		h := path.Base(remote)
+		if _, ok := refs.chunks[h]; ok {
+			continue
+		}
+		g.Go(func() error {
+			o, err := f.chunks.NewObject(gCtx, remote)
+			if errors.Is(err, fs.ErrorObjectNotFound) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if o.ModTime(gCtx).After(cutoff) {
+				fs.Debugf(o, "Not removing unreferenced chunk as it is too new")
+				return nil
+			}
+			f.known.Delete(h)
+			if err := operations.DeleteFile(gCtx, o); err != nil {
+				return err
+			}
+			mu.Lock()
+			removed++
+			freed += o.Size()
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	fs.Infof(f, "Removed %d unreferenced chunks freeing %v", removed, fs.SizeSuffix(freed))
+	return nil
+}
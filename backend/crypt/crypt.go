@@ -3,6 +3,8 @@ package crypt
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -16,6 +18,7 @@ import (
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/fspath"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/list"
@@ -172,6 +175,33 @@ Setting suffix to "none" will result in an empty suffix. This may be useful
 when the path length is critical.`,
 			Default:  ".bin",
 			Advanced: true,
+		}, {
+			Name: "listing_index",
+			Help: `Keep an encrypted index of the file names on the remote.
+
+If this is set, crypt stores an encrypted index of all the decrypted
+file names, sizes, modification times and MD5 hashes in the root of
+the wrapped remote and keeps it up to date as files are changed.
+Listings are then answered from the index rather than listing and
+decrypting the names on the wrapped remote.
+
+The index is only used while it is fresh. See the docs for the
+details, and don't use this if the remote is modified other than
+through a crypt remote with this set.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "listing_index_max_age",
+			Help: `Maximum age of the listing index before it is no longer used.
+
+The index is rebuilt by a full listing of the remote with --fast-list
+or the index-rebuild backend command. Changes made to the remote other
+than through crypt with listing_index set won't be seen until the
+index is rebuilt.
+
+Set to 0 to use the index however old it is.`,
+			Default:  fs.Duration(24 * time.Hour),
+			Advanced: true,
 		}},
 	})
 }
@@ -264,6 +294,13 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 		cipher: cipher,
 	}
 	cache.PinUntilFinalized(f.Fs, f)
+	if opt.ListingIndex {
+		index, indexErr := getIndex(ctx, f)
+		if indexErr != nil {
+			return nil, indexErr
+		}
+		f.index = index
+	}
 	// Correct root if definitely pointing to a file
 	if err == fs.ErrorIsFile {
 		f.root = path.Dir(f.root)
@@ -297,23 +334,32 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	// Enable ListP always
 	f.features.ListP = f.ListP
 
+	// Enable ListR if using the listing index and make sure it
+	// gets saved on shutdown
+	if f.index != nil {
+		f.features.ListR = f.ListR
+		f.features.Shutdown = f.Shutdown
+	}
+
 	return f, err
 }
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote                  string `config:"remote"`
-	FilenameEncryption      string `config:"filename_encryption"`
-	DirectoryNameEncryption bool   `config:"directory_name_encryption"`
-	NoDataEncryption        bool   `config:"no_data_encryption"`
-	Password                string `config:"password"`
-	Password2               string `config:"password2"`
-	ServerSideAcrossConfigs bool   `config:"server_side_across_configs"`
-	ShowMapping             bool   `config:"show_mapping"`
-	PassBadBlocks           bool   `config:"pass_bad_blocks"`
-	FilenameEncoding        string `config:"filename_encoding"`
-	Suffix                  string `config:"suffix"`
-	StrictNames             bool   `config:"strict_names"`
+	Remote                  string      `config:"remote"`
+	FilenameEncryption      string      `config:"filename_encryption"`
+	DirectoryNameEncryption bool        `config:"directory_name_encryption"`
+	NoDataEncryption        bool        `config:"no_data_encryption"`
+	Password                string      `config:"password"`
+	Password2               string      `config:"password2"`
+	ServerSideAcrossConfigs bool        `config:"server_side_across_configs"`
+	ShowMapping             bool        `config:"show_mapping"`
+	PassBadBlocks           bool        `config:"pass_bad_blocks"`
+	FilenameEncoding        string      `config:"filename_encoding"`
+	Suffix                  string      `config:"suffix"`
+	StrictNames             bool        `config:"strict_names"`
+	ListingIndex            bool        `config:"listing_index"`
+	ListingIndexMaxAge      fs.Duration `config:"listing_index_max_age"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -325,6 +371,7 @@ type Fs struct {
 	opt      Options
 	features *fs.Features // optional features
 	cipher   *Cipher
+	index    *listingIndex // listing index or nil if not in use
 }
 
 // Name of the remote (as passed into NewFs)
@@ -350,6 +397,9 @@ func (f *Fs) String() string {
 // Encrypt an object file name to entries.
 func (f *Fs) add(entries *fs.DirEntries, obj fs.Object) error {
 	remote := obj.Remote()
+	if remote == indexName && f.root == "" {
+		return nil
+	}
 	decryptedRemote, err := f.cipher.DecryptFileName(remote)
 	if err != nil {
 		if f.opt.StrictNames {
@@ -437,6 +487,18 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 // callback returns an error then the listing will stop
 // immediately.
 func (f *Fs) ListP(ctx context.Context, dir string, callback fs.ListRCallback) error {
+	entries, err := f.index.list(ctx, f, dir)
+	if err != errNoIndex {
+		if err != nil {
+			return err
+		}
+		return callback(entries)
+	}
+	return f.listP(ctx, dir, callback)
+}
+
+// listP lists the wrapped remote
+func (f *Fs) listP(ctx context.Context, dir string, callback fs.ListRCallback) error {
 	wrappedCallback := func(entries fs.DirEntries) error {
 		entries, err := f.encryptEntries(ctx, entries)
 		if err != nil {
@@ -473,7 +535,37 @@ func (f *Fs) ListP(ctx context.Context, dir string, callback fs.ListRCallback) e
 // Don't implement this unless you have a more efficient way
 // of listing recursively that doing a directory traversal.
 func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
-	return f.Fs.Features().ListR(ctx, f.cipher.EncryptDirName(dir), func(entries fs.DirEntries) error {
+	err = f.index.listR(ctx, f, dir, callback)
+	if err != errNoIndex {
+		return err
+	}
+	// Build the listing index if listing everything
+	if f.index == nil || dir != "" || f.root != "" || filter.GetUseFilter(ctx) {
+		return f.listRUnderlying(ctx, dir, callback)
+	}
+	b := newIndexBuilder(f.index)
+	err = f.listRUnderlying(ctx, dir, func(entries fs.DirEntries) error {
+		b.add(ctx, entries)
+		return callback(entries)
+	})
+	if err != nil {
+		return err
+	}
+	fs.Infof(f, "Built listing index")
+	if err = f.index.install(ctx, b.data); err != nil {
+		fs.Errorf(f, "%v", err)
+	}
+	return nil
+}
+
+// listRUnderlying lists the wrapped remote recursively
+func (f *Fs) listRUnderlying(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	listR := f.Fs.Features().ListR
+	if listR == nil {
+		// Only happens when using the listing index
+		return f.walk(ctx, dir, callback)
+	}
+	return listR(ctx, f.cipher.EncryptDirName(dir), func(entries fs.DirEntries) error {
 		newEntries, err := f.encryptEntries(ctx, entries)
 		if err != nil {
 			return err
@@ -482,9 +574,38 @@ func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (
 	})
 }
 
+// walk lists the wrapped remote recursively one directory at a time
+func (f *Fs) walk(ctx context.Context, dir string, callback fs.ListRCallback) error {
+	dirs := []string{dir}
+	for len(dirs) > 0 {
+		dir, dirs = dirs[len(dirs)-1], dirs[:len(dirs)-1]
+		err := f.listP(ctx, dir, func(entries fs.DirEntries) error {
+			for _, entry := range entries {
+				if d, ok := entry.(fs.Directory); ok {
+					dirs = append(dirs, d.Remote())
+				}
+			}
+			return callback(entries)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexPath returns the path of remote in the listing index
+func (f *Fs) indexPath(remote string) string {
+	return path.Join(f.root, remote)
+}
+
 // NewObject finds the Object at remote.
 func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
-	o, err := f.Fs.NewObject(ctx, f.cipher.EncryptFileName(remote))
+	o, err := f.index.newObject(ctx, f, remote)
+	if err != errNoIndex {
+		return o, err
+	}
+	o, err = f.Fs.NewObject(ctx, f.cipher.EncryptFileName(remote))
 	if err != nil {
 		return nil, err
 	}
@@ -493,8 +614,47 @@ func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 
 type putFn func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error)
 
-// put implements Put or PutStream
+// put implements Put or PutStream keeping the listing index up to date
 func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options []fs.OpenOption, put putFn) (fs.Object, error) {
+	if f.index == nil {
+		return f.putData(ctx, in, src, options, put)
+	}
+	if err := f.index.beginUpdate(ctx); err != nil {
+		return nil, err
+	}
+	in, sum := f.indexHasher(in)
+	o, err := f.putData(ctx, in, src, options, put)
+	if err != nil {
+		return o, err
+	}
+	f.indexPut(ctx, o, sum())
+	return o, nil
+}
+
+// indexHasher returns a reader which calculates the MD5 of in for
+// the listing index and a function to return it.
+func (f *Fs) indexHasher(in io.Reader) (io.Reader, func() string) {
+	hasher := md5.New()
+	// unwrap the accounting
+	in, wrap := accounting.UnWrap(in)
+	// add the hasher and wrap the accounting back on
+	in = wrap(io.TeeReader(in, hasher))
+	return in, func() string {
+		return hex.EncodeToString(hasher.Sum(nil))
+	}
+}
+
+// indexPut adds o to the listing index with the MD5 given
+func (f *Fs) indexPut(ctx context.Context, o fs.Object, md5sum string) {
+	f.index.putFile(f.indexPath(o.Remote()), &indexEntry{
+		Size:    o.Size(),
+		ModTime: o.ModTime(ctx),
+		MD5:     md5sum,
+	})
+}
+
+// putData encrypts the data and uploads it
+func (f *Fs) putData(ctx context.Context, in io.Reader, src fs.ObjectInfo, options []fs.OpenOption, put putFn) (fs.Object, error) {
 	ci := fs.GetConfig(ctx)
 
 	if f.opt.NoDataEncryption {
@@ -578,6 +738,9 @@ func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, opt
 
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() hash.Set {
+	if f.index != nil {
+		return hash.Set(hash.MD5)
+	}
 	return hash.Set(hash.None)
 }
 
@@ -585,7 +748,15 @@ func (f *Fs) Hashes() hash.Set {
 //
 // Shouldn't return an error if it already exists
 func (f *Fs) Mkdir(ctx context.Context, dir string) error {
-	return f.Fs.Mkdir(ctx, f.cipher.EncryptDirName(dir))
+	if err := f.index.beginUpdate(ctx); err != nil {
+		return err
+	}
+	err := f.Fs.Mkdir(ctx, f.cipher.EncryptDirName(dir))
+	if err == nil {
+		// The modification time is read from the remote when needed
+		f.index.mkdir(f.indexPath(dir), time.Time{})
+	}
+	return err
 }
 
 // MkdirMetadata makes the root directory of the Fs object
@@ -594,10 +765,18 @@ func (f *Fs) MkdirMetadata(ctx context.Context, dir string, metadata fs.Metadata
 	if do == nil {
 		return nil, fs.ErrorNotImplemented
 	}
+	if err := f.index.beginUpdate(ctx); err != nil {
+		return nil, err
+	}
 	newDir, err := do(ctx, f.cipher.EncryptDirName(dir), metadata)
 	if err != nil {
 		return nil, err
 	}
+	if f.index != nil {
+		modTime := newDir.ModTime(ctx)
+		f.index.mkdir(f.indexPath(dir), modTime)
+		return f.newIndexedDir(dir, modTime, newDir), nil
+	}
 	var entries = make(fs.DirEntries, 0, 1)
 	err = f.addDir(ctx, &entries, newDir)
 	if err != nil {
@@ -616,14 +795,28 @@ func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) e
 	if do == nil {
 		return fs.ErrorNotImplemented
 	}
-	return do(ctx, f.cipher.EncryptDirName(dir), modTime)
+	if err := f.index.beginUpdate(ctx); err != nil {
+		return err
+	}
+	err := do(ctx, f.cipher.EncryptDirName(dir), modTime)
+	if err == nil {
+		f.index.setDirModTime(f.indexPath(dir), modTime)
+	}
+	return err
 }
 
 // Rmdir removes the directory (container, bucket) if empty
 //
 // Return an error if it doesn't exist or isn't empty
 func (f *Fs) Rmdir(ctx context.Context, dir string) error {
-	return f.Fs.Rmdir(ctx, f.cipher.EncryptDirName(dir))
+	if err := f.index.beginUpdate(ctx); err != nil {
+		return err
+	}
+	err := f.Fs.Rmdir(ctx, f.cipher.EncryptDirName(dir))
+	if err == nil {
+		f.index.rmdir(f.indexPath(dir))
+	}
+	return err
 }
 
 // Purge all files in the directory specified
@@ -637,7 +830,14 @@ func (f *Fs) Purge(ctx context.Context, dir string) error {
 	if do == nil {
 		return fs.ErrorCantPurge
 	}
-	return do(ctx, f.cipher.EncryptDirName(dir))
+	if err := f.index.beginUpdate(ctx); err != nil {
+		return err
+	}
+	err := do(ctx, f.cipher.EncryptDirName(dir))
+	if err == nil {
+		f.index.rmdir(f.indexPath(dir))
+	}
+	return err
 }
 
 // Copy src to this remote using server-side copy operations.
@@ -658,11 +858,23 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantCopy
 	}
-	oResult, err := do(ctx, o.Object, f.cipher.EncryptFileName(remote))
+	wrapped, err := resolveObject(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.index.beginUpdate(ctx); err != nil {
+		return nil, err
+	}
+	oResult, err := do(ctx, wrapped, f.cipher.EncryptFileName(remote))
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(oResult), nil
+	newO := f.newObject(oResult)
+	if f.index != nil {
+		md5sum, _ := o.Hash(ctx, hash.MD5)
+		f.indexPut(ctx, newO, md5sum)
+	}
+	return newO, nil
 }
 
 // Move src to this remote using server-side move operations.
@@ -683,11 +895,30 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if !ok {
 		return nil, fs.ErrorCantMove
 	}
-	oResult, err := do(ctx, o.Object, f.cipher.EncryptFileName(remote))
+	wrapped, err := resolveObject(ctx, o)
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(oResult), nil
+	if err := f.index.beginUpdate(ctx); err != nil {
+		return nil, err
+	}
+	if err := o.f.index.beginUpdate(ctx); err != nil {
+		return nil, err
+	}
+	var md5sum string
+	if f.index != nil {
+		md5sum, _ = o.Hash(ctx, hash.MD5)
+	}
+	oResult, err := do(ctx, wrapped, f.cipher.EncryptFileName(remote))
+	if err != nil {
+		return nil, err
+	}
+	o.f.index.removeFile(o.f.indexPath(o.Remote()))
+	newO := f.newObject(oResult)
+	if f.index != nil {
+		f.indexPut(ctx, newO, md5sum)
+	}
+	return newO, nil
 }
 
 // DirMove moves src, srcRemote to this remote at dstRemote
@@ -708,7 +939,23 @@ func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string
 		fs.Debugf(srcFs, "Can't move directory - not same remote type")
 		return fs.ErrorCantDirMove
 	}
-	return do(ctx, srcFs.Fs, f.cipher.EncryptDirName(srcRemote), f.cipher.EncryptDirName(dstRemote))
+	if err := f.index.beginUpdate(ctx); err != nil {
+		return err
+	}
+	if err := srcFs.index.beginUpdate(ctx); err != nil {
+		return err
+	}
+	err := do(ctx, srcFs.Fs, f.cipher.EncryptDirName(srcRemote), f.cipher.EncryptDirName(dstRemote))
+	if err != nil {
+		return err
+	}
+	if srcFs.index == f.index {
+		f.index.moveDir(srcFs.indexPath(srcRemote), f.indexPath(dstRemote))
+	} else {
+		srcFs.index.rmdir(srcFs.indexPath(srcRemote))
+		f.index.invalidate(ctx, "directory moved in from another remote")
+	}
+	return nil
 }
 
 // PutUnchecked uploads the object
@@ -720,6 +967,13 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 	if do == nil {
 		return nil, errors.New("can't PutUnchecked")
 	}
+	if err := f.index.beginUpdate(ctx); err != nil {
+		return nil, err
+	}
+	var sum func() string
+	if f.index != nil {
+		in, sum = f.indexHasher(in)
+	}
 	wrappedIn, encrypter, err := f.cipher.encryptData(in)
 	if err != nil {
 		return nil, err
@@ -728,7 +982,11 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(o), nil
+	newO := f.newObject(o)
+	if f.index != nil {
+		f.indexPut(ctx, newO, sum())
+	}
+	return newO, nil
 }
 
 // CleanUp the trash in the Fs
@@ -948,6 +1206,56 @@ rclone backend decode crypt: encryptedfile1 [encryptedfile2...]
 rclone rc backend/command command=decode fs=crypt: encryptedfile1 [encryptedfile2...]
 ` + "```",
 	},
+	{
+		Name:  "index-rebuild",
+		Short: "Rebuild the listing index.",
+		Long: `This lists the whole of the remote and rebuilds the listing index from
+it. The listing_index option must be set.
+
+Use this after the remote has been changed other than through a crypt
+remote with listing_index set, or if the index is too old to be used.
+
+Usage example:
+
+` + "```console" + `
+rclone backend index-rebuild crypt:
+` + "```",
+	},
+	{
+		Name:  "index-info",
+		Short: "Show the state of the listing index.",
+		Long: `This shows whether the listing index is fresh enough to be used, when
+it was built, and how many directories, files and bytes it contains.
+The listing_index option must be set.
+
+Usage example:
+
+` + "```console" + `
+rclone backend index-info crypt:
+` + "```",
+	},
+	{
+		Name:  "index-search",
+		Short: "Search the listing index for files by decrypted name.",
+		Long: `This returns the files whose decrypted paths match any of the glob
+patterns given as arguments, with their sizes, modification times and
+MD5 sums if known. The listing_index option must be set and the index
+must be fresh, so the remote isn't listed to do this.
+
+The patterns are the same as those used by the filters, so
+` + "`*.jpg`" + ` matches files in any directory whereas ` + "`/photos/*.jpg`" + `
+only matches files in the photos directory.
+
+Usage examples:
+
+` + "```console" + `
+rclone backend index-search crypt: "*.jpg" "*.png"
+rclone backend index-search crypt:path/to/dir -o ignore-case "/report-*"
+` + "```",
+		Opts: map[string]string{
+			"ignore-case": "Ignore case when matching the patterns",
+		},
+	},
 }
 
 // Command the backend to run a named command
@@ -978,6 +1286,32 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			out = append(out, encryptedFileName)
 		}
 		return out, nil
+	case "index-rebuild":
+		if f.index == nil {
+			return nil, errors.New("listing_index is not set")
+		}
+		if err := f.rebuildIndex(ctx); err != nil {
+			return nil, err
+		}
+		return f.index.info(ctx), nil
+	case "index-info":
+		if f.index == nil {
+			return nil, errors.New("listing_index is not set")
+		}
+		return f.index.info(ctx), nil
+	case "index-search":
+		if f.index == nil {
+			return nil, errors.New("listing_index is not set")
+		}
+		if len(arg) == 0 {
+			return nil, errors.New("need at least one pattern to search for")
+		}
+		_, ignoreCase := opt["ignore-case"]
+		results, err := f.index.search(ctx, f, arg, ignoreCase)
+		if err == errNoIndex {
+			return nil, errors.New("listing index is not fresh - run the index-rebuild command first")
+		}
+		return results, err
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -988,7 +1322,8 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 // This decrypts the remote name and decrypts the data
 type Object struct {
 	fs.Object
-	f *Fs
+	f      *Fs
+	remote string // decrypted remote if known
 }
 
 func (f *Fs) newObject(o fs.Object) *Object {
@@ -1013,6 +1348,9 @@ func (o *Object) String() string {
 
 // Remote returns the remote path
 func (o *Object) Remote() string {
+	if o.remote != "" {
+		return o.remote
+	}
 	remote := o.Object.Remote()
 	decryptedName, err := o.f.cipher.DecryptFileName(remote)
 	if err != nil {
@@ -1037,8 +1375,49 @@ func (o *Object) Size() int64 {
 
 // Hash returns the selected checksum of the file
 // If no checksum is available it returns ""
+//
+// MD5 hashes are only available from the listing index.
 func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
-	return "", hash.ErrUnsupported
+	if o.f.index == nil || ht != hash.MD5 {
+		return "", hash.ErrUnsupported
+	}
+	md5sum := o.f.index.md5(o.f.indexPath(o.Remote()), o.Size(), o.ModTime(ctx), o.f.Precision())
+	if x, ok := o.Object.(*indexedObject); ok && md5sum == "" {
+		md5sum = x.entry.MD5
+	}
+	return md5sum, nil
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	if err := o.f.index.beginUpdate(ctx); err != nil {
+		return err
+	}
+	var md5sum string
+	if o.f.index != nil {
+		md5sum, _ = o.Hash(ctx, hash.MD5)
+	}
+	err := o.Object.SetModTime(ctx, modTime)
+	if err == nil && o.f.index != nil {
+		o.f.index.putFile(o.f.indexPath(o.Remote()), &indexEntry{
+			Size:    o.Size(),
+			ModTime: modTime,
+			MD5:     md5sum,
+		})
+	}
+	return err
+}
+
+// Remove an object
+func (o *Object) Remove(ctx context.Context) error {
+	if err := o.f.index.beginUpdate(ctx); err != nil {
+		return err
+	}
+	err := o.Object.Remove(ctx)
+	if err == nil {
+		o.f.index.removeFile(o.f.indexPath(o.Remote()))
+	}
+	return err
 }
 
 // UnWrap returns the wrapped Object
@@ -1130,6 +1509,9 @@ func (f *Fs) Disconnect(ctx context.Context) error {
 // Shutdown the backend, closing any background tasks and any
 // cached connections.
 func (f *Fs) Shutdown(ctx context.Context) error {
+	if err := f.index.shutdown(ctx); err != nil {
+		fs.Errorf(f, "%v", err)
+	}
 	do := f.Fs.Features().Shutdown
 	if do == nil {
 		return nil
@@ -1291,7 +1673,22 @@ func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
 	if !ok {
 		return fs.ErrorNotImplemented
 	}
-	return do.SetMetadata(ctx, metadata)
+	if o.f.index == nil {
+		return do.SetMetadata(ctx, metadata)
+	}
+	if err := o.f.index.beginUpdate(ctx); err != nil {
+		return err
+	}
+	md5sum, _ := o.Hash(ctx, hash.MD5)
+	err := do.SetMetadata(ctx, metadata)
+	if err == nil {
+		o.f.index.putFile(o.f.indexPath(o.Remote()), &indexEntry{
+			Size:    o.Size(),
+			ModTime: o.ModTime(ctx),
+			MD5:     md5sum,
+		})
+	}
+	return err
 }
 
 // MimeType returns the content type of the Object if
@@ -6,6 +6,8 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"path"
+	"sort"
 	"testing"
 	"time"
 
@@ -119,9 +121,132 @@ func testComputeHash(t *testing.T, f *Fs) {
 	assert.Equal(t, remoteObjHash, computedHash)
 }
 
+func testListingIndex(t *testing.T, f *Fs) {
+	if f.index == nil {
+		t.Skip("listing index not enabled")
+	}
+	ctx := context.Background()
+	_ = uploadFile(t, f, "index/dir/file2", "file2 contents")
+	require.NoError(t, f.rebuildIndex(ctx))
+	assert.True(t, f.index.info(ctx).Fresh)
+
+	// Files uploaded while the index is in use have their MD5 recorded.
+	// Not using uploadFile as this is moved and removed below.
+	contents := "file1 contents"
+	obj, err := f.Put(ctx, bytes.NewBufferString(contents), object.NewStaticObjectInfo("index/file1", time.Now(), int64(len(contents)), true, nil, nil))
+	require.NoError(t, err)
+	paths := f.index.sortedIndexPaths()
+	assert.Contains(t, paths, path.Join(f.root, "index/file1"))
+	assert.Contains(t, paths, path.Join(f.root, "index/dir/file2"))
+
+	// Listings and objects should come from the index
+	entries, err := f.List(ctx, "index")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	sort.Sort(entries)
+	assert.Equal(t, "index/dir", entries[0].Remote())
+	assert.Equal(t, "index/file1", entries[1].Remote())
+	o, err := f.NewObject(ctx, "index/file1")
+	require.NoError(t, err)
+	_, isIndexed := o.(*Object).Object.(*indexedObject)
+	assert.True(t, isIndexed)
+	assert.Equal(t, obj.Size(), o.Size())
+	sum, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", md5.Sum([]byte(contents))), sum)
+
+	// Reading the object looks it up on the wrapped remote
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, contents, string(data))
+
+	// Files can be searched for by decrypted name
+	out, err := f.Command(ctx, "index-search", []string{"file1", "/index/dir/*"}, nil)
+	require.NoError(t, err)
+	results := out.([]indexSearchResult)
+	require.Len(t, results, 2)
+	assert.Equal(t, "index/dir/file2", results[0].Path)
+	assert.Equal(t, "index/file1", results[1].Path)
+	assert.Equal(t, int64(len(contents)), results[1].Size)
+	assert.Equal(t, sum, results[1].MD5)
+	out, err = f.Command(ctx, "index-search", []string{"FILE2"}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	out, err = f.Command(ctx, "index-search", []string{"FILE2"}, map[string]string{"ignore-case": ""})
+	require.NoError(t, err)
+	assert.Len(t, out, 1)
+
+	// Changes should update the index
+	dst, err := f.Move(ctx, o, "index/file3")
+	require.NoError(t, err)
+	paths = f.index.sortedIndexPaths()
+	assert.NotContains(t, paths, path.Join(f.root, "index/file1"))
+	assert.Contains(t, paths, path.Join(f.root, "index/file3"))
+	require.NoError(t, dst.Remove(ctx))
+	assert.NotContains(t, f.index.sortedIndexPaths(), path.Join(f.root, "index/file3"))
+	_, err = f.NewObject(ctx, "index/file3")
+	assert.Equal(t, fs.ErrorObjectNotFound, err)
+	assert.True(t, f.index.info(ctx).Fresh)
+}
+
+// Test the listing index when another process is using it too
+func testListingIndexProcesses(t *testing.T, f *Fs) {
+	if f.index == nil {
+		t.Skip("listing index not enabled")
+	}
+	ctx := context.Background()
+	require.NoError(t, f.rebuildIndex(ctx))
+
+	// another returns the index as seen by another process
+	another := func() *listingIndex {
+		x := &listingIndex{
+			base:      f.index.base,
+			cipher:    f.index.cipher,
+			emptyDirs: f.index.emptyDirs,
+		}
+		assert.True(t, x.info(ctx).Fresh)
+		return x
+	}
+	other := another()
+
+	// A change saved by us is picked up by the other process when it
+	// changes the remote rather than being overwritten
+	_ = uploadFile(t, f, "processes/file1", "file1 contents")
+	require.NoError(t, f.index.shutdown(ctx))
+	require.NoError(t, other.beginUpdate(ctx))
+	other.putFile(path.Join(f.root, "processes/file2"), &indexEntry{Size: 1})
+	require.NoError(t, other.shutdown(ctx))
+	assert.Contains(t, other.sortedIndexPaths(), path.Join(f.root, "processes/file1"))
+
+	// And the other way round
+	_ = uploadFile(t, f, "processes/file3", "file3 contents")
+	paths := f.index.sortedIndexPaths()
+	assert.Contains(t, paths, path.Join(f.root, "processes/file2"))
+	assert.Contains(t, paths, path.Join(f.root, "processes/file3"))
+	require.NoError(t, f.index.shutdown(ctx))
+
+	// If both change the remote at once the index is discarded
+	// rather than one process losing the changes of the other
+	other = another()
+	_ = uploadFile(t, f, "processes/file4", "file4 contents")
+	require.NoError(t, other.beginUpdate(ctx))
+	assert.False(t, other.info(ctx).Fresh)
+	require.NoError(t, f.index.shutdown(ctx))
+	assert.False(t, f.index.info(ctx).Fresh)
+	_, err := f.index.read(ctx)
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+
+	require.NoError(t, f.rebuildIndex(ctx))
+}
+
 // InternalTest is called by fstests.Run to extra tests
 func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("ObjectInfo", func(t *testing.T) { testObjectInfo(t, f, false) })
 	t.Run("ObjectInfoWrap", func(t *testing.T) { testObjectInfo(t, f, true) })
 	t.Run("ComputeHash", func(t *testing.T) { testComputeHash(t, f) })
+	t.Run("ListingIndex", func(t *testing.T) { testListingIndex(t, f) })
+	t.Run("ListingIndexProcesses", func(t *testing.T) { testListingIndexProcesses(t, f) })
 }
@@ -0,0 +1,1239 @@
+package crypt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+)
+
+// The listing index is stored in the root of the wrapped remote with
+// this name. It can't clash with an encrypted file name as it
+// contains characters the name encodings don't use.
+const indexName = ".rclone-crypt-index"
+
+// indexVersion should be increased if the index format changes
+const indexVersion = 1
+
+// indexEntry describes a file in the listing index
+type indexEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	MD5     string    `json:"md5,omitempty"` // MD5 of the plaintext if known
+}
+
+// indexDir describes a directory in the listing index
+type indexDir struct {
+	ModTime time.Time              `json:"mtime"`
+	Files   map[string]*indexEntry `json:"files,omitempty"`
+	Dirs    map[string]bool        `json:"dirs,omitempty"`
+}
+
+// indexData is the contents of the listing index
+//
+// Paths are the decrypted paths relative to the root of the crypt
+// remote with "" being the root.
+type indexData struct {
+	Version    int                  `json:"version"`
+	Built      time.Time            `json:"built"`      // when the index was built from a full listing
+	Dirty      bool                 `json:"dirty"`      // set while the remote is being modified
+	Generation int64                `json:"generation"` // increased each time the index is saved
+	Dirs       map[string]*indexDir `json:"dirs"`
+}
+
+// newIndexData makes a new empty index built at the time given
+func newIndexData(built time.Time) *indexData {
+	return &indexData{
+		Version: indexVersion,
+		Built:   built,
+		Dirs:    map[string]*indexDir{"": {}},
+	}
+}
+
+// listingIndex is an encrypted index of the whole tree of a crypt
+// remote which is used to answer listings without listing the
+// wrapped remote.
+//
+// It is shared between all the Fs using the same config.
+type listingIndex struct {
+	base      fs.Fs   // root of the wrapped remote the index is stored in
+	cipher    *Cipher // cipher to encrypt the index with
+	maxAge    time.Duration
+	emptyDirs bool // set if the wrapped remote can have empty directories
+
+	mu      sync.Mutex
+	loaded  bool       // set once we've tried to load the index
+	data    *indexData // current index or nil if there isn't a usable one
+	marked  bool       // set if the copy on the remote is marked dirty
+	changed bool       // set if data has changed since it was saved
+}
+
+var (
+	indexesMu sync.Mutex
+	indexes   = map[string]*listingIndex{}
+)
+
+// getIndex returns the listing index for the config of f
+func getIndex(ctx context.Context, f *Fs) (*listingIndex, error) {
+	key := f.name + ":" + f.opt.Remote
+	indexesMu.Lock()
+	defer indexesMu.Unlock()
+	if x, ok := indexes[key]; ok {
+		return x, nil
+	}
+	base, err := cache.Get(ctx, f.opt.Remote)
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, fmt.Errorf("failed to make remote %q for listing index: %w", f.opt.Remote, err)
+	}
+	cache.Pin(base)
+	x := &listingIndex{
+		base:      base,
+		cipher:    f.cipher,
+		maxAge:    time.Duration(f.opt.ListingIndexMaxAge),
+		emptyDirs: base.Features().CanHaveEmptyDirectories,
+	}
+	indexes[key] = x
+	return x, nil
+}
+
+// load the index from the remote if we haven't tried already
+//
+// Call with mu held
+func (x *listingIndex) load(ctx context.Context) {
+	if x.loaded {
+		return
+	}
+	x.loaded = true
+	data, err := x.read(ctx)
+	if err != nil {
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			fs.Debugf(x.base, "No listing index found")
+		} else {
+			fs.Logf(x.base, "Ignoring listing index: %v", err)
+		}
+		return
+	}
+	if data.Dirty {
+		fs.Logf(x.base, "Ignoring listing index as it is in use or wasn't saved cleanly - use the index-rebuild command to rebuild it")
+		return
+	}
+	fs.Debugf(x.base, "Loaded listing index with %d directories built at %v", len(data.Dirs), data.Built)
+	x.data = data
+}
+
+// read the index from the remote
+func (x *listingIndex) read(ctx context.Context) (data *indexData, err error) {
+	o, err := x.base.NewObject(ctx, indexName)
+	if err != nil {
+		return nil, err
+	}
+	in, err := o.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := x.cipher.DecryptData(in)
+	if err != nil {
+		_ = in.Close()
+		return nil, err
+	}
+	defer fs.CheckClose(rc, &err)
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		return nil, err
+	}
+	data = new(indexData)
+	if err = json.NewDecoder(gz).Decode(data); err != nil {
+		return nil, fmt.Errorf("failed to decode: %w", err)
+	}
+	if data.Version != indexVersion {
+		return nil, fmt.Errorf("unsupported version %d", data.Version)
+	}
+	if data.Dirs[""] == nil {
+		return nil, errors.New("root directory missing")
+	}
+	return data, nil
+}
+
+// storedChanged checks whether the copy of the index on the remote
+// has been saved by another process since we loaded or saved it.
+//
+// It returns the reason if so, and the copy on the remote if it could
+// be read.
+//
+// Call with mu held
+func (x *listingIndex) storedChanged(ctx context.Context) (reason string, stored *indexData) {
+	stored, err := x.read(ctx)
+	switch {
+	case errors.Is(err, fs.ErrorObjectNotFound):
+		return "it was removed by another process", nil
+	case err != nil:
+		return fmt.Sprintf("failed to read it back: %v", err), nil
+	case stored.Generation != x.data.Generation:
+		return "it was changed by another process", stored
+	}
+	return "", nil
+}
+
+// save the index to the remote marking it dirty if set
+//
+// If another process has saved the index since we loaded it then
+// saving ours would lose its changes, so the index is discarded
+// instead.
+//
+// Call with mu held
+func (x *listingIndex) save(ctx context.Context, dirty bool) error {
+	if reason, _ := x.storedChanged(ctx); reason != "" {
+		x._invalidate(ctx, reason)
+		return nil
+	}
+	return x.write(ctx, dirty)
+}
+
+// write the index to the remote marking it dirty if set
+//
+// Call with mu held
+func (x *listingIndex) write(ctx context.Context, dirty bool) (err error) {
+	x.data.Dirty = dirty
+	x.data.Generation++
+	defer func() {
+		if err != nil {
+			x.data.Generation--
+		}
+	}()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(x.data); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	size := int64(buf.Len())
+	in, err := x.cipher.EncryptData(&buf)
+	if err != nil {
+		return err
+	}
+	src := object.NewStaticObjectInfo(indexName, time.Now(), x.cipher.EncryptedSize(size), true, nil, x.base)
+	o, err := x.base.NewObject(ctx, indexName)
+	if err == nil {
+		err = o.Update(ctx, in, src)
+	} else if errors.Is(err, fs.ErrorObjectNotFound) {
+		_, err = x.base.Put(ctx, in, src)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save listing index: %w", err)
+	}
+	x.changed = false
+	x.marked = dirty
+	return nil
+}
+
+// fresh returns true if the index can be used to answer listings
+//
+// Call with mu held
+func (x *listingIndex) fresh(ctx context.Context) bool {
+	x.load(ctx)
+	if x.data == nil {
+		return false
+	}
+	if x.maxAge > 0 && time.Since(x.data.Built) > x.maxAge {
+		fs.Infof(x.base, "Listing index built at %v is older than max age %v so not using it", x.data.Built, fs.Duration(x.maxAge))
+		x.data = nil
+		return false
+	}
+	return true
+}
+
+// beginUpdate should be called before modifying the remote.
+//
+// If the index is in use it marks the copy on the remote dirty so
+// that if we don't shut down cleanly it won't be trusted.
+//
+// If another process has saved the index cleanly since we loaded it
+// and we have no unsaved changes then we carry on with its copy.
+func (x *listingIndex) beginUpdate(ctx context.Context) error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.fresh(ctx) || x.marked {
+		return nil
+	}
+	reason, stored := x.storedChanged(ctx)
+	if reason != "" {
+		if stored == nil || stored.Dirty || x.changed {
+			x._invalidate(ctx, reason)
+			return nil
+		}
+		fs.Debugf(x.base, "Reloaded listing index as %s", reason)
+		x.data = stored
+		if !x.fresh(ctx) {
+			return nil
+		}
+	}
+	return x.write(ctx, true)
+}
+
+// invalidate discards the index as it is known to be wrong
+func (x *listingIndex) invalidate(ctx context.Context, reason string) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x._invalidate(ctx, reason)
+}
+
+// _invalidate discards the index as it is known to be wrong
+//
+// Call with mu held
+func (x *listingIndex) _invalidate(ctx context.Context, reason string) {
+	if x.data == nil {
+		return
+	}
+	fs.Logf(x.base, "Discarding listing index: %s", reason)
+	x.data = nil
+	o, err := x.base.NewObject(ctx, indexName)
+	if err == nil {
+		err = o.Remove(ctx)
+	}
+	if err != nil && !errors.Is(err, fs.ErrorObjectNotFound) {
+		fs.Errorf(x.base, "Failed to remove listing index: %v", err)
+	}
+	x.marked = false
+	x.changed = false
+}
+
+// install replaces the index with data and saves it
+//
+// This replaces any copy on the remote, even if another process has
+// changed it, as data comes from a full listing.
+func (x *listingIndex) install(ctx context.Context, data *indexData) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.loaded = true
+	if stored, err := x.read(ctx); err == nil {
+		// Carry on from the stored generation so other processes
+		// using the stored copy see it has changed
+		data.Generation = stored.Generation
+	}
+	x.data = data
+	x.changed = true
+	return x.write(ctx, false)
+}
+
+// shutdown saves the index if it has been changed
+func (x *listingIndex) shutdown(ctx context.Context) error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.data == nil || (!x.changed && !x.marked) {
+		return nil
+	}
+	return x.save(ctx, false)
+}
+
+// update calls fn with the index data if the index is in use
+func (x *listingIndex) update(fn func(d *indexData)) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.data == nil {
+		return
+	}
+	fn(x.data)
+	x.changed = true
+}
+
+// splitPath splits p into the parent directory and leaf
+func splitPath(p string) (dir, leaf string) {
+	dir, leaf = path.Split(p)
+	return strings.TrimSuffix(dir, "/"), leaf
+}
+
+// mkdir makes the directory p and its parents returning it
+func (d *indexData) mkdir(p string) *indexDir {
+	if dir, ok := d.Dirs[p]; ok {
+		return dir
+	}
+	dir := &indexDir{}
+	d.Dirs[p] = dir
+	parent, leaf := splitPath(p)
+	pdir := d.mkdir(parent)
+	if pdir.Dirs == nil {
+		pdir.Dirs = map[string]bool{}
+	}
+	pdir.Dirs[leaf] = true
+	return dir
+}
+
+// rmdir removes the directory p and everything in it
+func (d *indexData) rmdir(p string) {
+	if p == "" {
+		d.Dirs = map[string]*indexDir{"": {}}
+		return
+	}
+	prefix := p + "/"
+	for dir := range d.Dirs {
+		if dir == p || strings.HasPrefix(dir, prefix) {
+			delete(d.Dirs, dir)
+		}
+	}
+	parent, leaf := splitPath(p)
+	if pdir, ok := d.Dirs[parent]; ok {
+		delete(pdir.Dirs, leaf)
+	}
+}
+
+// prune removes p and its parents if they are empty
+func (d *indexData) prune(p string) {
+	for p != "" {
+		dir, ok := d.Dirs[p]
+		if !ok || len(dir.Files) > 0 || len(dir.Dirs) > 0 {
+			return
+		}
+		d.rmdir(p)
+		p, _ = splitPath(p)
+	}
+}
+
+// putFile adds or replaces the file at p
+func (d *indexData) putFile(p string, e *indexEntry) {
+	parent, leaf := splitPath(p)
+	dir := d.mkdir(parent)
+	if dir.Files == nil {
+		dir.Files = map[string]*indexEntry{}
+	}
+	dir.Files[leaf] = e
+}
+
+// lookup finds the file at p
+func (d *indexData) lookup(p string) (e *indexEntry, ok bool) {
+	parent, leaf := splitPath(p)
+	dir, ok := d.Dirs[parent]
+	if !ok {
+		return nil, false
+	}
+	e, ok = dir.Files[leaf]
+	return e, ok
+}
+
+// removeFile removes the file at p
+func (x *listingIndex) removeFile(p string) {
+	x.update(func(d *indexData) {
+		parent, leaf := splitPath(p)
+		if dir, ok := d.Dirs[parent]; ok {
+			delete(dir.Files, leaf)
+		}
+		if !x.emptyDirs {
+			d.prune(parent)
+		}
+	})
+}
+
+// putFile adds or replaces the file at p
+func (x *listingIndex) putFile(p string, e *indexEntry) {
+	x.update(func(d *indexData) {
+		d.putFile(p, e)
+	})
+}
+
+// mkdir adds the directory p
+func (x *listingIndex) mkdir(p string, modTime time.Time) {
+	if x == nil || !x.emptyDirs {
+		return
+	}
+	x.update(func(d *indexData) {
+		if _, ok := d.Dirs[p]; !ok {
+			d.mkdir(p).ModTime = modTime
+		}
+	})
+}
+
+// setDirModTime sets the modification time of the directory p
+func (x *listingIndex) setDirModTime(p string, modTime time.Time) {
+	x.update(func(d *indexData) {
+		if dir, ok := d.Dirs[p]; ok {
+			dir.ModTime = modTime
+		}
+	})
+}
+
+// rmdir removes the directory p and everything in it
+func (x *listingIndex) rmdir(p string) {
+	x.update(func(d *indexData) {
+		d.rmdir(p)
+		if !x.emptyDirs {
+			parent, _ := splitPath(p)
+			d.prune(parent)
+		}
+	})
+}
+
+// moveDir moves the directory src to dst
+func (x *listingIndex) moveDir(src, dst string) {
+	x.update(func(d *indexData) {
+		prefix := src + "/"
+		moved := map[string]*indexDir{}
+		for p, dir := range d.Dirs {
+			if p == src {
+				moved[dst] = dir
+			} else if strings.HasPrefix(p, prefix) {
+				moved[path.Join(dst, p[len(prefix):])] = dir
+			}
+		}
+		d.rmdir(src)
+		if !x.emptyDirs {
+			parent, _ := splitPath(src)
+			d.prune(parent)
+		}
+		parent, _ := splitPath(dst)
+		d.mkdir(parent)
+		for p, dir := range moved {
+			d.Dirs[p] = dir
+		}
+		parent, leaf := splitPath(dst)
+		pdir := d.Dirs[parent]
+		if pdir.Dirs == nil {
+			pdir.Dirs = map[string]bool{}
+		}
+		pdir.Dirs[leaf] = true
+	})
+}
+
+// lookup finds the file at p returning a copy of its entry
+func (x *listingIndex) lookup(p string) (e indexEntry, ok bool) {
+	if x == nil {
+		return e, false
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.data == nil {
+		return e, false
+	}
+	pe, ok := x.data.lookup(p)
+	if !ok {
+		return e, false
+	}
+	return *pe, true
+}
+
+// dirEntries returns the entries in the index for the directory p
+// which has the path dir in f.
+//
+// It returns ok == false if the directory isn't found.
+//
+// Call with mu held
+func (x *listingIndex) dirEntries(f *Fs, p, dir string) (entries fs.DirEntries, ok bool) {
+	d, ok := x.data.Dirs[p]
+	if !ok {
+		return nil, false
+	}
+	entries = make(fs.DirEntries, 0, len(d.Files)+len(d.Dirs))
+	for leaf, e := range d.Files {
+		entries = append(entries, f.newIndexedObject(path.Join(dir, leaf), *e))
+	}
+	for leaf := range d.Dirs {
+		sub := x.data.Dirs[path.Join(p, leaf)]
+		var modTime time.Time
+		if sub != nil {
+			modTime = sub.ModTime
+		}
+		entries = append(entries, f.newIndexedDir(path.Join(dir, leaf), modTime, nil))
+	}
+	return entries, true
+}
+
+// errNoIndex is returned if the listing index can't be used
+var errNoIndex = errors.New("listing index not in use")
+
+// list the directory dir of f from the index
+//
+// It returns errNoIndex if the index can't be used.
+func (x *listingIndex) list(ctx context.Context, f *Fs, dir string) (entries fs.DirEntries, err error) {
+	if x == nil {
+		return nil, errNoIndex
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.fresh(ctx) {
+		return nil, errNoIndex
+	}
+	entries, ok := x.dirEntries(f, f.indexPath(dir), dir)
+	if !ok {
+		return nil, fs.ErrorDirNotFound
+	}
+	return entries, nil
+}
+
+// listR lists the directory dir of f and everything below it from
+// the index
+//
+// It returns errNoIndex if the index can't be used.
+func (x *listingIndex) listR(ctx context.Context, f *Fs, dir string, callback fs.ListRCallback) error {
+	if x == nil {
+		return errNoIndex
+	}
+	x.mu.Lock()
+	if !x.fresh(ctx) {
+		x.mu.Unlock()
+		return errNoIndex
+	}
+	p := f.indexPath(dir)
+	if _, ok := x.data.Dirs[p]; !ok {
+		x.mu.Unlock()
+		return fs.ErrorDirNotFound
+	}
+	// Return parents before their children as the listing
+	// would be from the wrapped remote
+	var dirPaths []string
+	prefix := p + "/"
+	for dirPath := range x.data.Dirs {
+		if dirPath == p || p == "" || strings.HasPrefix(dirPath, prefix) {
+			dirPaths = append(dirPaths, dirPath)
+		}
+	}
+	sort.Strings(dirPaths)
+	var all fs.DirEntries
+	for _, dirPath := range dirPaths {
+		rel := dirPath
+		if f.root != "" {
+			rel = strings.TrimPrefix(strings.TrimPrefix(dirPath, f.root), "/")
+		}
+		entries, _ := x.dirEntries(f, dirPath, rel)
+		all = append(all, entries...)
+	}
+	x.mu.Unlock()
+	return callback(all)
+}
+
+// newObject returns an object from the index for remote in f
+//
+// It returns errNoIndex if the index can't be used.
+func (x *listingIndex) newObject(ctx context.Context, f *Fs, remote string) (fs.Object, error) {
+	if x == nil {
+		return nil, errNoIndex
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.fresh(ctx) {
+		return nil, errNoIndex
+	}
+	e, ok := x.data.lookup(f.indexPath(remote))
+	if !ok {
+		return nil, fs.ErrorObjectNotFound
+	}
+	return f.newIndexedObject(remote, *e), nil
+}
+
+// md5 returns the MD5 of the file at p if it is in the index with the
+// size and modification time given
+func (x *listingIndex) md5(p string, size int64, modTime time.Time, precision time.Duration) string {
+	e, ok := x.lookup(p)
+	if !ok || e.Size != size {
+		return ""
+	}
+	if dt := e.ModTime.Sub(modTime); dt > precision || dt < -precision {
+		return ""
+	}
+	return e.MD5
+}
+
+// indexBuilder builds an index from a listing of the root of a crypt
+// remote
+type indexBuilder struct {
+	mu   sync.Mutex
+	data *indexData
+	old  *listingIndex // to copy hashes from
+}
+
+// newIndexBuilder makes a new index builder
+func newIndexBuilder(old *listingIndex) *indexBuilder {
+	return &indexBuilder{
+		data: newIndexData(time.Now()),
+		old:  old,
+	}
+}
+
+// add entries from the listing of the root crypt remote
+func (b *indexBuilder) add(ctx context.Context, entries fs.DirEntries) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, entry := range entries {
+		switch x := entry.(type) {
+		case fs.Object:
+			e := &indexEntry{
+				Size:    x.Size(),
+				ModTime: x.ModTime(ctx),
+			}
+			if old, ok := b.old.lookup(x.Remote()); ok && old.Size == e.Size && old.ModTime.Equal(e.ModTime) {
+				e.MD5 = old.MD5
+			}
+			b.data.putFile(x.Remote(), e)
+		case fs.Directory:
+			b.data.mkdir(x.Remote()).ModTime = x.ModTime(ctx)
+		}
+	}
+}
+
+// rootFs returns a crypt Fs for the root of the crypt remote f is in
+func (f *Fs) rootFs() *Fs {
+	if f.root == "" {
+		return f
+	}
+	return &Fs{
+		Fs:       f.index.base,
+		name:     f.name,
+		opt:      f.opt,
+		features: f.features,
+		cipher:   f.cipher,
+		index:    f.index,
+	}
+}
+
+// rebuildIndex rebuilds the listing index from a full listing of the
+// wrapped remote
+func (f *Fs) rebuildIndex(ctx context.Context) error {
+	rf := f.rootFs()
+	b := newIndexBuilder(f.index)
+	err := rf.listRUnderlying(ctx, "", func(entries fs.DirEntries) error {
+		b.add(ctx, entries)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list remote to build index: %w", err)
+	}
+	return f.index.install(ctx, b.data)
+}
+
+// indexInfo describes the state of the listing index
+type indexInfo struct {
+	Fresh bool      `json:"fresh"`
+	Built time.Time `json:"built,omitempty"`
+	Dirs  int       `json:"dirs"`
+	Files int       `json:"files"`
+	Bytes int64     `json:"bytes"`
+}
+
+// info returns the state of the index
+func (x *listingIndex) info(ctx context.Context) (info indexInfo) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	info.Fresh = x.fresh(ctx)
+	if !info.Fresh {
+		return info
+	}
+	info.Built = x.data.Built
+	info.Dirs = len(x.data.Dirs)
+	for _, d := range x.data.Dirs {
+		info.Files += len(d.Files)
+		for _, e := range d.Files {
+			info.Bytes += e.Size
+		}
+	}
+	return info
+}
+
+// indexSearchResult is a file found by searching the index
+type indexSearchResult struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	MD5     string    `json:"md5,omitempty"`
+}
+
+// search returns the files in f whose decrypted paths match any of
+// the glob patterns sorted by path.
+//
+// The patterns are matched against the path relative to the root of
+// f in the same way as filter rules are.
+//
+// It returns errNoIndex if the index can't be used.
+func (x *listingIndex) search(ctx context.Context, f *Fs, patterns []string, ignoreCase bool) (results []indexSearchResult, err error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := filter.GlobPathToRegexp(pattern, ignoreCase)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		res = append(res, re)
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.fresh(ctx) {
+		return nil, errNoIndex
+	}
+	results = []indexSearchResult{}
+	prefix := ""
+	if f.root != "" {
+		prefix = f.root + "/"
+	}
+	for dirPath, d := range x.data.Dirs {
+		if dirPath != f.root && !strings.HasPrefix(dirPath, prefix) {
+			continue
+		}
+		for leaf, e := range d.Files {
+			remote := strings.TrimPrefix(path.Join(dirPath, leaf), prefix)
+			for _, re := range res {
+				if re.MatchString(remote) {
+					results = append(results, indexSearchResult{
+						Path:    remote,
+						Size:    e.Size,
+						ModTime: e.ModTime,
+						MD5:     e.MD5,
+					})
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+	return results, nil
+}
+
+// indexedObject stands in for an object on the wrapped remote which
+// was found in the listing index.
+//
+// It is wrapped in an Object like the objects on the wrapped remote.
+// The object on the wrapped remote is only looked up when it is
+// needed.
+type indexedObject struct {
+	f      *Fs    // crypt Fs this is for
+	remote string // decrypted remote relative to f
+	entry  indexEntry
+	mu     sync.Mutex
+	o      fs.Object // object on the wrapped remote or nil if not looked up yet
+}
+
+// newIndexedObject makes a crypt Object for remote in f from e
+func (f *Fs) newIndexedObject(remote string, e indexEntry) *Object {
+	o := f.newObject(&indexedObject{
+		f:      f,
+		remote: remote,
+		entry:  e,
+	})
+	o.remote = remote
+	return o
+}
+
+// resolve finds the object on the wrapped remote
+func (o *indexedObject) resolve(ctx context.Context) (fs.Object, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.o != nil {
+		return o.o, nil
+	}
+	wrapped, err := o.f.Fs.NewObject(ctx, o.f.cipher.EncryptFileName(o.remote))
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		o.f.index.invalidate(ctx, fmt.Sprintf("%q not found on remote", o.remote))
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.o = wrapped
+	return o.o, nil
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *indexedObject) Fs() fs.Info {
+	return o.f.Fs
+}
+
+// Return a string version
+func (o *indexedObject) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.Remote()
+}
+
+// Remote returns the encrypted remote path
+func (o *indexedObject) Remote() string {
+	return o.f.cipher.EncryptFileName(o.remote)
+}
+
+// Size returns the size of the file on the wrapped remote
+func (o *indexedObject) Size() int64 {
+	if o.f.opt.NoDataEncryption {
+		return o.entry.Size
+	}
+	return o.f.cipher.EncryptedSize(o.entry.Size)
+}
+
+// ModTime returns the modification time of the file
+func (o *indexedObject) ModTime(ctx context.Context) time.Time {
+	return o.entry.ModTime
+}
+
+// Hash returns the selected checksum of the file on the wrapped remote
+func (o *indexedObject) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+	return obj.Hash(ctx, ht)
+}
+
+// Storable returns whether this object is storable
+func (o *indexedObject) Storable() bool {
+	return true
+}
+
+// SetModTime sets the modification time of the file
+func (o *indexedObject) SetModTime(ctx context.Context, modTime time.Time) error {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	err = obj.SetModTime(ctx, modTime)
+	if err == nil {
+		o.entry.ModTime = modTime
+	}
+	return err
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+func (o *indexedObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Open(ctx, options...)
+}
+
+// Update in to the object with the modTime given of the given size
+func (o *indexedObject) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	err = obj.Update(ctx, in, src, options...)
+	if err != nil {
+		return err
+	}
+	o.entry.ModTime = obj.ModTime(ctx)
+	o.entry.Size = obj.Size()
+	o.entry.MD5 = ""
+	if !o.f.opt.NoDataEncryption {
+		o.entry.Size, err = o.f.cipher.DecryptedSize(o.entry.Size)
+	}
+	return err
+}
+
+// Remove an object
+func (o *indexedObject) Remove(ctx context.Context) error {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return obj.Remove(ctx)
+}
+
+// UnWrap returns the object on the wrapped remote
+func (o *indexedObject) UnWrap() fs.Object {
+	obj, err := o.resolve(context.Background())
+	if err != nil {
+		fs.Errorf(o, "Failed to find object: %v", err)
+		return nil
+	}
+	return obj
+}
+
+// ID returns the ID of the Object if known, or "" if not
+func (o *indexedObject) ID() string {
+	obj, err := o.resolve(context.Background())
+	if err != nil {
+		return ""
+	}
+	do, ok := obj.(fs.IDer)
+	if !ok {
+		return ""
+	}
+	return do.ID()
+}
+
+// GetTier returns storage tier or class of the Object
+func (o *indexedObject) GetTier() string {
+	obj, err := o.resolve(context.Background())
+	if err != nil {
+		return ""
+	}
+	do, ok := obj.(fs.GetTierer)
+	if !ok {
+		return ""
+	}
+	return do.GetTier()
+}
+
+// SetTier performs changing storage tier of the Object if
+// multiple storage classes supported
+func (o *indexedObject) SetTier(tier string) error {
+	obj, err := o.resolve(context.Background())
+	if err != nil {
+		return err
+	}
+	do, ok := obj.(fs.SetTierer)
+	if !ok {
+		return errors.New("crypt: underlying remote does not support SetTier")
+	}
+	return do.SetTier(tier)
+}
+
+// Metadata returns metadata for an object
+func (o *indexedObject) Metadata(ctx context.Context) (fs.Metadata, error) {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	do, ok := obj.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// SetMetadata sets metadata for an Object
+func (o *indexedObject) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	obj, err := o.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	do, ok := obj.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	err = do.SetMetadata(ctx, metadata)
+	if err == nil {
+		o.entry.ModTime = obj.ModTime(ctx)
+	}
+	return err
+}
+
+// indexedDir stands in for a directory on the wrapped remote which
+// was found in the listing index or made while the index is in use.
+//
+// It is wrapped in a DirWrapper like the directories on the wrapped
+// remote. The directory on the wrapped remote is only looked up when
+// it is needed.
+type indexedDir struct {
+	f       *Fs    // crypt Fs this is for
+	remote  string // decrypted remote relative to f
+	modTime time.Time
+	mu      sync.Mutex
+	d       fs.Directory // directory on the wrapped remote or nil if not looked up yet
+}
+
+// newIndexedDir makes a crypt directory for remote in f
+//
+// d is the directory on the wrapped remote if known
+func (f *Fs) newIndexedDir(remote string, modTime time.Time, d fs.Directory) fs.Directory {
+	return fs.NewDirWrapper(remote, &indexedDir{
+		f:       f,
+		remote:  remote,
+		modTime: modTime,
+		d:       d,
+	})
+}
+
+// resolve finds the directory on the wrapped remote by listing its
+// parent
+func (d *indexedDir) resolve(ctx context.Context) (fs.Directory, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.d != nil {
+		return d.d, nil
+	}
+	remote := d.Remote()
+	parent, _ := splitPath(remote)
+	entries, err := d.f.Fs.List(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if dir, ok := entry.(fs.Directory); ok && dir.Remote() == remote {
+			d.d = dir
+			return d.d, nil
+		}
+	}
+	d.f.index.invalidate(ctx, fmt.Sprintf("directory %q not found on remote", d.remote))
+	return nil, fs.ErrorDirNotFound
+}
+
+// Fs returns read only access to the Fs that this directory is part of
+func (d *indexedDir) Fs() fs.Info {
+	return d.f.Fs
+}
+
+// Return a string version
+func (d *indexedDir) String() string {
+	return d.Remote()
+}
+
+// Remote returns the encrypted remote path
+func (d *indexedDir) Remote() string {
+	return d.f.cipher.EncryptDirName(d.remote)
+}
+
+// ModTime returns the modification time of the directory
+//
+// If it isn't in the index it is read from the wrapped remote.
+func (d *indexedDir) ModTime(ctx context.Context) time.Time {
+	d.mu.Lock()
+	modTime := d.modTime
+	d.mu.Unlock()
+	if !modTime.IsZero() {
+		return modTime
+	}
+	dir, err := d.resolve(ctx)
+	if err != nil {
+		fs.Debugf(d, "Failed to read modification time: %v", err)
+		return time.Now()
+	}
+	modTime = dir.ModTime(ctx)
+	d.mu.Lock()
+	d.modTime = modTime
+	d.mu.Unlock()
+	return modTime
+}
+
+// Size returns the size of the directory which is always 0
+func (d *indexedDir) Size() int64 {
+	return 0
+}
+
+// Items returns the count of items in this directory or -1 if unknown
+func (d *indexedDir) Items() int64 {
+	return -1
+}
+
+// ID returns the internal ID of this directory if known, or "" otherwise
+func (d *indexedDir) ID() string {
+	return ""
+}
+
+// changed records the new modification time of the directory in the
+// index after dir has been changed
+func (d *indexedDir) changed(ctx context.Context, dir fs.Directory) {
+	modTime := dir.ModTime(ctx)
+	d.mu.Lock()
+	d.modTime = modTime
+	d.mu.Unlock()
+	d.f.index.setDirModTime(d.f.indexPath(d.remote), modTime)
+}
+
+// Metadata returns metadata for the directory
+func (d *indexedDir) Metadata(ctx context.Context) (fs.Metadata, error) {
+	dir, err := d.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	do, ok := dir.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// SetMetadata sets metadata for the directory
+func (d *indexedDir) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	dir, err := d.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	do, ok := dir.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	if err = d.f.index.beginUpdate(ctx); err != nil {
+		return err
+	}
+	err = do.SetMetadata(ctx, metadata)
+	if err == nil {
+		d.changed(ctx, dir)
+	}
+	return err
+}
+
+// SetModTime sets the modification time of the directory
+func (d *indexedDir) SetModTime(ctx context.Context, modTime time.Time) error {
+	dir, err := d.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	do, ok := dir.(fs.SetModTimer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	if err = d.f.index.beginUpdate(ctx); err != nil {
+		return err
+	}
+	err = do.SetModTime(ctx, modTime)
+	if err == nil {
+		d.changed(ctx, dir)
+	}
+	return err
+}
+
+// resolveObject returns the object on the wrapped remote for o,
+// looking it up if o came from the listing index
+func resolveObject(ctx context.Context, o *Object) (fs.Object, error) {
+	if io, ok := o.Object.(*indexedObject); ok {
+		return io.resolve(ctx)
+	}
+	return o.Object, nil
+}
+
+// sortedIndexPaths returns the paths of the files in the index in order
+//
+// This is used in tests.
+func (x *listingIndex) sortedIndexPaths() (paths []string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.data == nil {
+		return nil
+	}
+	for dirPath, d := range x.data.Dirs {
+		for leaf := range d.Files {
+			paths = append(paths, path.Join(dirPath, leaf))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object          = (*indexedObject)(nil)
+	_ fs.ObjectUnWrapper = (*indexedObject)(nil)
+	_ fs.IDer            = (*indexedObject)(nil)
+	_ fs.GetTierer       = (*indexedObject)(nil)
+	_ fs.SetTierer       = (*indexedObject)(nil)
+	_ fs.Metadataer      = (*indexedObject)(nil)
+	_ fs.SetMetadataer   = (*indexedObject)(nil)
+	_ fs.Directory       = (*indexedDir)(nil)
+	_ fs.Metadataer      = (*indexedDir)(nil)
+	_ fs.SetMetadataer   = (*indexedDir)(nil)
+	_ fs.SetModTimer     = (*indexedDir)(nil)
+)
@@ -0,0 +1,417 @@
+package erasure
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/klauspost/reedsolomon"
+	"github.com/rclone/rclone/fs"
+)
+
+// encode reads l.size bytes from in and writes shard i to outs[i]
+// returning the MD5 of the data read.
+func encode(in io.Reader, l layout, generation uint64, outs []io.Writer) (sum [md5.Size]byte, err error) {
+	enc, err := reedsolomon.New(l.dataShards, l.parityShards)
+	if err != nil {
+		return sum, err
+	}
+	n := l.shards()
+	hasher := md5.New()
+	in = io.TeeReader(in, hasher)
+
+	// write buffers to all the outputs in parallel
+	write := func(bufs [][]byte) error {
+		var wg sync.WaitGroup
+		errs := make([]error, n)
+		for i := range n {
+			wg.Go(func() {
+				_, errs[i] = outs[i].Write(bufs[i])
+			})
+		}
+		wg.Wait()
+		return errors.Join(errs...)
+	}
+
+	bufs := make([][]byte, n)
+	for i := range n {
+		h := header{
+			dataShards:   l.dataShards,
+			parityShards: l.parityShards,
+			index:        i,
+			blockSize:    l.blockSize,
+			size:         l.size,
+			generation:   generation,
+		}
+		bufs[i] = h.marshal()
+	}
+	if err = write(bufs); err != nil {
+		return sum, err
+	}
+
+	data := make([]byte, l.stripeSize())
+	blocks := make([][]byte, n)
+	for i := range n {
+		bufs[i] = make([]byte, l.blockSize+crcSize)
+	}
+	for stripe := range l.stripes() {
+		stripeLen := l.stripeLen(stripe)
+		blockLen := l.blockLen(stripe)
+		if _, err = io.ReadFull(in, data[:stripeLen]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return sum, fmt.Errorf("failed to read source: %w", err)
+		}
+		for i := range n {
+			blocks[i] = bufs[i][:blockLen]
+			if i < l.dataShards {
+				start := min(int64(i)*blockLen, stripeLen)
+				end := min(start+blockLen, stripeLen)
+				clear(blocks[i][copy(blocks[i], data[start:end]):])
+			}
+		}
+		if err = enc.Encode(blocks); err != nil {
+			return sum, fmt.Errorf("failed to encode: %w", err)
+		}
+		for i := range n {
+			blocks[i] = appendCRC(blocks[i])
+		}
+		if err = write(blocks); err != nil {
+			return sum, err
+		}
+	}
+
+	// Check there isn't any more data
+	var one [1]byte
+	if n, _ := io.ReadFull(in, one[:]); n != 0 {
+		return sum, fmt.Errorf("source is longer than the expected %d bytes", l.size)
+	}
+
+	copy(sum[:], hasher.Sum(nil))
+	t := trailer{md5: sum, generation: generation}
+	for i := range n {
+		bufs[i] = t.marshal()
+	}
+	return sum, write(bufs)
+}
+
+// shardStream is an open shard positioned at the start of a block
+type shardStream struct {
+	in  io.ReadCloser
+	buf []byte // buffer for a block and its CRC
+}
+
+// decoder reads a range of a file from its shards
+type decoder struct {
+	ctx               context.Context
+	o                 *Object
+	l                 layout
+	enc               reedsolomon.Encoder
+	options           []fs.OpenOption
+	generation        uint64         // generation of the shards, 0 if not known yet
+	checkedGeneration bool           // set if pickGeneration has been called
+	streams           []*shardStream // open shards, nil if not open
+	failed            []bool         // shards which have failed
+	stripe            int64          // next stripe to read
+	endStripe         int64          // stripe to stop reading at
+	skip              int64          // bytes to skip at the start of the next stripe
+	limit             int64          // bytes left to return
+	out               []byte         // decoded data waiting to be returned
+	err               error          // sticky error
+}
+
+// newDecoder makes a decoder to read limit bytes from offset of o
+func newDecoder(ctx context.Context, o *Object, offset, limit int64, options []fs.OpenOption) (*decoder, error) {
+	l := o.f.layout(o.size)
+	enc, err := reedsolomon.New(l.dataShards, l.parityShards)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{
+		ctx:     ctx,
+		o:       o,
+		l:       l,
+		enc:     enc,
+		options: options,
+		streams: make([]*shardStream, l.shards()),
+		failed:  make([]bool, l.shards()),
+		limit:   limit,
+	}
+	if limit > 0 {
+		stripeSize := l.stripeSize()
+		d.stripe = offset / stripeSize
+		d.skip = offset % stripeSize
+		d.endStripe = min((offset+limit+stripeSize-1)/stripeSize, l.stripes())
+	}
+	for i, shard := range o.shards {
+		if shard == nil {
+			d.failed[i] = true
+		}
+	}
+	return d, nil
+}
+
+// readHeader reads the header of shard i of l from in and checks it
+func readHeader(in io.Reader, l *layout, i int) (h header, err error) {
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(in, buf); err != nil {
+		return h, fmt.Errorf("failed to read header: %w", err)
+	}
+	if err := h.unmarshal(buf); err != nil {
+		return h, err
+	}
+	return h, h.check(l, i)
+}
+
+// readShardHeader opens shard i of l and reads its header
+func readShardHeader(ctx context.Context, shard fs.Object, l *layout, i int, options ...fs.OpenOption) (h header, err error) {
+	in, err := shard.Open(ctx, append(slices.Clip(options), &fs.RangeOption{Start: 0, End: int64(headerSize) - 1})...)
+	if err != nil {
+		return h, err
+	}
+	defer fs.CheckClose(in, &err)
+	return readHeader(in, l, i)
+}
+
+// errWrongGeneration is returned if a shard is from a different
+// upload to the others
+var errWrongGeneration = fmt.Errorf("%w: shard is from a different upload", errBadShard)
+
+// readHeader reads and checks the header of shard i from in
+func (d *decoder) readHeader(in io.Reader, i int) error {
+	h, err := readHeader(in, &d.l, i)
+	if err != nil {
+		return err
+	}
+	if d.generation == 0 {
+		d.generation = h.generation
+	} else if h.generation != d.generation {
+		return errWrongGeneration
+	}
+	return nil
+}
+
+// pickGeneration reads the headers of all the shards and uses the
+// generation most of them have.
+//
+// This is used if the shards read so far disagree, which can happen if
+// an upload failed part of the way through.
+func (d *decoder) pickGeneration() {
+	d.checkedGeneration = true
+	n := d.l.shards()
+	generations := make([]uint64, n)
+	var wg sync.WaitGroup
+	for i, shard := range d.o.shards {
+		if shard == nil {
+			continue
+		}
+		wg.Go(func() {
+			h, err := readShardHeader(d.ctx, shard, &d.l, i, d.options...)
+			if err == nil {
+				generations[i] = h.generation
+			}
+		})
+	}
+	wg.Wait()
+	counts := map[uint64]int{}
+	best := uint64(0)
+	for _, generation := range generations {
+		if generation == 0 {
+			continue
+		}
+		counts[generation]++
+		if counts[generation] > counts[best] {
+			best = generation
+		}
+	}
+	fs.Debugf(d.o, "Using generation %016x found on %d shards", best, counts[best])
+	d.generation = best
+	for i, generation := range generations {
+		if generation == best {
+			d.failed[i] = d.o.shards[i] == nil
+		} else if !d.failed[i] {
+			d.fail(i, errWrongGeneration)
+		}
+	}
+}
+
+// open shard i at the current stripe
+func (d *decoder) open(i int) (err error) {
+	shard := d.o.shards[i]
+	end := &fs.RangeOption{Start: -1, End: d.l.blockOffset(d.endStripe) - 1}
+	var in io.ReadCloser
+	if d.stripe == 0 {
+		// read the header then the blocks
+		end.Start = 0
+		in, err = shard.Open(d.ctx, append(slices.Clip(d.options), end)...)
+		if err != nil {
+			return err
+		}
+		if err = d.readHeader(in, i); err != nil {
+			_ = in.Close()
+			return err
+		}
+	} else {
+		// read the header separately
+		in, err = shard.Open(d.ctx, append(slices.Clip(d.options), &fs.RangeOption{Start: 0, End: int64(headerSize) - 1})...)
+		if err != nil {
+			return err
+		}
+		err = d.readHeader(in, i)
+		_ = in.Close()
+		if err != nil {
+			return err
+		}
+		end.Start = d.l.blockOffset(d.stripe)
+		in, err = shard.Open(d.ctx, append(slices.Clip(d.options), end)...)
+		if err != nil {
+			return err
+		}
+	}
+	d.streams[i] = &shardStream{
+		in:  in,
+		buf: make([]byte, d.l.blockSize+crcSize),
+	}
+	return nil
+}
+
+// fail marks shard i as failed with err
+func (d *decoder) fail(i int, err error) {
+	fs.Errorf(d.o, "Shard %d on %v failed - use the heal backend command to repair: %v", i, d.o.f.upstreams[i], err)
+	d.failed[i] = true
+	if s := d.streams[i]; s != nil {
+		_ = s.in.Close()
+		d.streams[i] = nil
+	}
+}
+
+// decode the next stripe into d.out
+func (d *decoder) decode() error {
+	n := d.l.shards()
+	blockLen := d.l.blockLen(d.stripe)
+	blocks := make([][]byte, n)
+	for {
+		// Use the open shards, opening more if needed
+		var active []int
+		for i := range n {
+			if d.streams[i] != nil {
+				active = append(active, i)
+			}
+		}
+		for i := 0; i < n && len(active) < d.l.dataShards; i++ {
+			if d.failed[i] || d.streams[i] != nil {
+				continue
+			}
+			if err := d.open(i); err != nil {
+				if errors.Is(err, errWrongGeneration) && !d.checkedGeneration {
+					d.pickGeneration()
+					i = -1 // start again
+					active = active[:0]
+					for j := range n {
+						if d.streams[j] != nil {
+							active = append(active, j)
+						}
+					}
+					continue
+				}
+				d.fail(i, err)
+				continue
+			}
+			active = append(active, i)
+		}
+		if len(active) < d.l.dataShards {
+			return fmt.Errorf("can't read %q: not enough shards: need %d but only %d available", d.o.remote, d.l.dataShards, len(active))
+		}
+
+		// Read the blocks in parallel
+		var wg sync.WaitGroup
+		errs := make([]error, n)
+		for _, i := range active {
+			wg.Go(func() {
+				blocks[i], errs[i] = readBlock(d.streams[i].in, d.streams[i].buf, blockLen)
+			})
+		}
+		wg.Wait()
+		ok := true
+		for _, i := range active {
+			if errs[i] != nil {
+				d.fail(i, errs[i])
+				blocks[i] = nil
+				ok = false
+			}
+		}
+		if ok {
+			break
+		}
+		// The streams which read a block are now one stripe on,
+		// so start again with all the shards at this stripe.
+		for _, i := range active {
+			if d.streams[i] != nil {
+				_ = d.streams[i].in.Close()
+				d.streams[i] = nil
+			}
+		}
+		clear(blocks)
+	}
+
+	// Reconstruct the data if any data shards are missing
+	for i := range d.l.dataShards {
+		if blocks[i] == nil {
+			if err := d.enc.ReconstructData(blocks); err != nil {
+				return fmt.Errorf("failed to reconstruct data: %w", err)
+			}
+			break
+		}
+	}
+
+	stripeLen := d.l.stripeLen(d.stripe)
+	out := make([]byte, 0, stripeLen)
+	for i := range d.l.dataShards {
+		out = append(out, blocks[i]...)
+	}
+	out = out[d.skip:stripeLen]
+	d.skip = 0
+	if int64(len(out)) > d.limit {
+		out = out[:d.limit]
+	}
+	d.out = out
+	d.stripe++
+	return nil
+}
+
+// Read decoded data into p
+func (d *decoder) Read(p []byte) (n int, err error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if len(d.out) == 0 {
+		if d.limit <= 0 || d.stripe >= d.endStripe {
+			d.err = io.EOF
+			return 0, d.err
+		}
+		if d.err = d.decode(); d.err != nil {
+			return 0, d.err
+		}
+	}
+	n = copy(p, d.out)
+	d.out = d.out[n:]
+	d.limit -= int64(n)
+	return n, nil
+}
+
+// Close the decoder
+func (d *decoder) Close() error {
+	var errs []error
+	for i, s := range d.streams {
+		if s != nil {
+			errs = append(errs, s.in.Close())
+			d.streams[i] = nil
+		}
+	}
+	return errors.Join(errs...)
+}
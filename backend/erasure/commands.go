@@ -0,0 +1,271 @@
+package erasure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "heal",
+	Short: "Rebuild missing and damaged shards.",
+	Long: `This checks the shards of every file under the path given and
+rebuilds any which are missing, have the wrong size or are from a
+different upload to the others. Shards are rebuilt from the other
+shards, so this needs at least as many good shards as there are data
+shards. All the upstreams must be available.
+
+Shards of older uploads of a file which were left behind are removed.
+
+Usage examples:
+
+` + "```console" + `
+rclone backend heal erasure:
+rclone backend heal erasure:path/to/dir -o verify
+` + "```" + `
+
+Normally only the headers of the shards are read. With the verify
+option all of every shard is read and the checksum of each block is
+checked, which finds corrupted shards too but reads all the data.
+
+Use the --dry-run flag to see what would be healed without changing
+anything.
+
+This prints a summary of the number of files checked, healthy, healed,
+failed and unrecoverable.`,
+	Opts: map[string]string{
+		"verify": "Read all the shards to check the checksums of every block",
+	},
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out any, err error) {
+	switch name {
+	case "heal":
+		_, verify := opt["verify"]
+		return f.heal(ctx, verify)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// healStats counts the results of healing files
+type healStats struct {
+	mu            sync.Mutex
+	Checked       int64 `json:"checked"`
+	Healthy       int64 `json:"healthy"`
+	Healed        int64 `json:"healed"`
+	Failed        int64 `json:"failed"`
+	Unrecoverable int64 `json:"unrecoverable"`
+}
+
+// healResult is the outcome of healing a single file
+type healResult int
+
+const (
+	healHealthy healResult = iota
+	healHealed
+	healFailed
+	healUnrecoverable
+)
+
+// add the result of healing a file
+func (s *healStats) add(result healResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Checked++
+	switch result {
+	case healHealthy:
+		s.Healthy++
+	case healHealed:
+		s.Healed++
+	case healFailed:
+		s.Failed++
+	case healUnrecoverable:
+		s.Unrecoverable++
+	}
+}
+
+// heal checks and rebuilds the shards of every file in f
+func (f *Fs) heal(ctx context.Context, verify bool) (*healStats, error) {
+	stats := new(healStats)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	err := walk.ListR(ctx, f, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(*Object)
+			if !ok {
+				continue
+			}
+			g.Go(func() error {
+				stats.add(o.heal(gCtx, verify))
+				return nil
+			})
+		}
+		return nil
+	})
+	if gErr := g.Wait(); err == nil {
+		err = gErr
+	}
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fs.Infof(f, "Checked %d files: %d healthy, %d healed, %d failed, %d unrecoverable",
+		stats.Checked, stats.Healthy, stats.Healed, stats.Failed, stats.Unrecoverable)
+	return stats, nil
+}
+
+// verifyShard reads all of shard i checking the checksums and returns
+// its generation
+func verifyShard(ctx context.Context, shard fs.Object, l *layout, i int) (generation uint64, err error) {
+	in, err := shard.Open(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer fs.CheckClose(in, &err)
+	h, err := readHeader(in, l, i)
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, l.blockSize+crcSize)
+	for stripe := range l.stripes() {
+		if _, err = readBlock(in, buf, l.blockLen(stripe)); err != nil {
+			return 0, fmt.Errorf("stripe %d: %w", stripe, err)
+		}
+	}
+	buf = make([]byte, trailerSize)
+	if _, err = io.ReadFull(in, buf); err != nil {
+		return 0, fmt.Errorf("failed to read trailer: %w", err)
+	}
+	var t trailer
+	if err = t.unmarshal(buf); err != nil {
+		return 0, err
+	}
+	if t.generation != h.generation {
+		return 0, fmt.Errorf("%w: header and trailer are from different uploads", errBadShard)
+	}
+	return h.generation, nil
+}
+
+// heal checks the shards of o and rebuilds any which are bad
+func (o *Object) heal(ctx context.Context, verify bool) healResult {
+	l := o.f.layout(o.size)
+	n := l.shards()
+
+	// Read the generation of each shard
+	generations := make([]uint64, n)
+	errs := o.f.forEach(func(i int, u fs.Fs) (err error) {
+		shard := o.shards[i]
+		if shard == nil {
+			return errors.New("shard is missing")
+		}
+		if verify {
+			generations[i], err = verifyShard(ctx, shard, &l, i)
+		} else {
+			var h header
+			h, err = readShardHeader(ctx, shard, &l, i)
+			generations[i] = h.generation
+		}
+		return err
+	})
+	counts := map[uint64]int{}
+	generation := uint64(0)
+	for i, g := range generations {
+		if errs[i] == nil {
+			counts[g]++
+			if counts[g] > counts[generation] {
+				generation = g
+			}
+		}
+	}
+
+	// Work out which shards need rebuilding
+	good := make([]fs.Object, n)
+	bad := make([]bool, n)
+	nBad := 0
+	for i := range n {
+		switch {
+		case errs[i] != nil:
+			fs.Infof(o, "Shard %d on %v is bad: %v", i, o.f.upstreams[i], errs[i])
+		case generations[i] != generation:
+			fs.Infof(o, "Shard %d on %v is from a different upload", i, o.f.upstreams[i])
+		default:
+			good[i] = o.shards[i]
+			continue
+		}
+		bad[i] = true
+		nBad++
+	}
+	if nBad == 0 && len(o.stale) == 0 {
+		fs.Debugf(o, "All %d shards are healthy", n)
+		return healHealthy
+	}
+	if n-nBad < l.dataShards {
+		fs.Errorf(o, "Can't heal: only %d good shards but need %d", n-nBad, l.dataShards)
+		return healUnrecoverable
+	}
+	if operations.SkipDestructive(ctx, o, fmt.Sprintf("heal %d shards", nBad)) {
+		return healHealed
+	}
+
+	if nBad > 0 {
+		// Rebuild the bad shards from the good ones keeping the
+		// same generation so they match the good shards. Bad
+		// shards with the right name which weren't used because
+		// they are the wrong size are overwritten.
+		name := makeShardName(o.remote, o.size, generation)
+		for i := range n {
+			if bad[i] && o.shards[i] == nil {
+				if shard, err := o.f.upstreams[i].NewObject(ctx, name); err == nil {
+					o.shards[i] = shard
+				}
+			}
+		}
+		src := &Object{
+			f:      o.f,
+			remote: o.remote,
+			size:   o.size,
+			shards: good,
+		}
+		in, err := newDecoder(ctx, src, 0, o.size, nil)
+		if err != nil {
+			fs.Errorf(o, "Failed to heal: %v", err)
+			return healFailed
+		}
+		in.generation = generation
+		in.checkedGeneration = true
+		shards, _, err := o.putShards(ctx, in, o, o.size, generation, bad)
+		_ = in.Close()
+		if err != nil {
+			fs.Errorf(o, "Failed to heal: %v", err)
+			return healFailed
+		}
+		for i := range n {
+			if bad[i] {
+				o.shards[i] = shards[i]
+			}
+		}
+	}
+	o.generation = generation
+	o.removeOld(ctx, o.shardName())
+	fs.Infof(o, "Healed %d shards", nBad)
+	return healHealed
+}
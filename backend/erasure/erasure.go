@@ -0,0 +1,1017 @@
+// Package erasure provides an Fs which stores files as Reed-Solomon
+// erasure coded shards spread over several upstreams
+package erasure
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Limits on the options
+const (
+	maxShards    = 256
+	minBlockSize = 1024
+	maxBlockSize = 1024 * 1024 * 1024
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "erasure",
+		Description: "Erasure code files across several remotes so they survive losing some of them",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name:     "upstreams",
+			Required: true,
+			Help: `List of space separated upstreams to store the shards in.
+
+Each file is stored as one shard on each upstream, so these should be
+on different remotes, e.g. 'gdrive:ec s3:bucket/ec "local:/mnt/disk 1/ec"'.
+
+The order of the upstreams matters - don't change it once files have
+been uploaded.`,
+		}, {
+			Name:    "parity_shards",
+			Default: 1,
+			Help: `Number of parity shards each file is stored with.
+
+Files can still be read if up to this many upstreams are unavailable
+or have lost their shards. The rest of the upstreams store the data
+shards, so with 5 upstreams and 2 parity shards files take up 5/3 of
+their size and survive the loss of any 2 upstreams.
+
+Don't change this once files have been uploaded.`,
+		}, {
+			Name:     "block_size",
+			Default:  fs.SizeSuffix(1024 * 1024),
+			Advanced: true,
+			Help: `Size of the blocks files are split into on each shard.
+
+Each block is stored with a checksum so corrupted blocks are detected
+and reconstructed from the other shards. Reading or writing a file
+uses a buffer of this size for each upstream.
+
+Don't change this once files have been uploaded.`,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Upstreams    fs.SpaceSepList `config:"upstreams"`
+	ParityShards int             `config:"parity_shards"`
+	BlockSize    fs.SizeSuffix   `config:"block_size"`
+}
+
+// Fs represents an erasure coded set of upstreams
+type Fs struct {
+	name       string
+	root       string
+	upstreams  []fs.Fs      // shard i of each file is stored on upstreams[i]
+	dataShards int          // number of data shards
+	opt        Options      // copy of Options
+	features   *fs.Features // optional features
+	wrapper    fs.Fs        // wrapper is used by SetWrapper
+}
+
+// makeUpstreams makes the Fs for each upstream at rpath
+func makeUpstreams(ctx context.Context, upstreams []string, rpath string) ([]fs.Fs, error) {
+	fses := make([]fs.Fs, len(upstreams))
+	for i, u := range upstreams {
+		baseName, basePath, err := fspath.SplitFs(u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse upstream %q: %w", u, err)
+		}
+		fses[i], err = cache.Get(ctx, baseName+fspath.JoinRootPath(basePath, rpath))
+		if err != nil && err != fs.ErrorIsFile {
+			return nil, fmt.Errorf("failed to make upstream %q: %w", u, err)
+		}
+	}
+	return fses, nil
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	n := len(opt.Upstreams)
+	if n < 2 {
+		return nil, errors.New("erasure needs at least 2 upstreams - check the value of the upstreams setting")
+	}
+	if n > maxShards {
+		return nil, fmt.Errorf("erasure can't have more than %d upstreams", maxShards)
+	}
+	if opt.ParityShards < 1 || opt.ParityShards >= n {
+		return nil, fmt.Errorf("parity_shards must be at least 1 and less than the number of upstreams (%d), got %d", n, opt.ParityShards)
+	}
+	if opt.BlockSize < minBlockSize || opt.BlockSize > maxBlockSize {
+		return nil, fmt.Errorf("block_size must be between %v and %v, got %v", fs.SizeSuffix(minBlockSize), fs.SizeSuffix(maxBlockSize), opt.BlockSize)
+	}
+	for _, u := range opt.Upstreams {
+		if strings.HasPrefix(u, name+":") {
+			return nil, errors.New("can't point erasure remote at itself - check the value of the upstreams setting")
+		}
+	}
+
+	rpath = strings.Trim(rpath, "/")
+	upstreams, err := makeUpstreams(ctx, opt.Upstreams, rpath)
+	if err != nil {
+		return nil, err
+	}
+	f := &Fs{
+		name:       name,
+		root:       rpath,
+		upstreams:  upstreams,
+		dataShards: n - opt.ParityShards,
+		opt:        *opt,
+	}
+
+	// If the root is a file then its shards are in the parent
+	// directory with a name we don't know, so look for them there.
+	var isFile bool
+	if rpath != "" {
+		parent := path.Dir(rpath)
+		if parent == "." {
+			parent = ""
+		}
+		parents, err := makeUpstreams(ctx, opt.Upstreams, parent)
+		if err == nil {
+			pf := *f
+			pf.upstreams = parents
+			if _, err := pf.NewObject(ctx, path.Base(rpath)); err == nil {
+				f.upstreams = parents
+				f.root = parent
+				isFile = true
+			}
+		}
+	}
+	for _, u := range f.upstreams {
+		cache.Pin(u)
+	}
+	runtime.SetFinalizer(f, func(f *Fs) {
+		for _, u := range f.upstreams {
+			cache.Unpin(u)
+		}
+	})
+
+	// Note: the features here are ones we could support, and they are
+	// ANDed with the ones from all the upstreams.
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            false,
+		WriteMimeType:           false,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(ctx, f)
+	for _, u := range f.upstreams {
+		f.features = f.features.Mask(ctx, u)
+	}
+	f.features.Overlay = true
+	f.features.SlowHash = true
+
+	if isFile {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// layout returns the layout of a file of size bytes
+func (f *Fs) layout(size int64) layout {
+	return newLayout(f.dataShards, f.opt.ParityShards, int64(f.opt.BlockSize), size)
+}
+
+// forEach calls fn for each upstream concurrently and returns the
+// errors it returns
+func (f *Fs) forEach(fn func(i int, u fs.Fs) error) []error {
+	errs := make([]error, len(f.upstreams))
+	var wg sync.WaitGroup
+	for i, u := range f.upstreams {
+		wg.Go(func() {
+			errs[i] = fn(i, u)
+		})
+	}
+	wg.Wait()
+	return errs
+}
+
+// shardSet is the shards of one upload of a file
+type shardSet struct {
+	name       string
+	size       int64
+	generation uint64
+	shards     []fs.Object // shard i or nil if missing
+}
+
+// count returns the number of shards present
+func (s *shardSet) count() (n int) {
+	for _, shard := range s.shards {
+		if shard != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// listShards lists dir on all the upstreams and merges the results
+// into directories and the shard sets for each file.
+//
+// Upstreams which can't be listed are treated as empty as long as no
+// more than parity_shards of them fail.
+func (f *Fs) listShards(ctx context.Context, dir string) (dirs map[string]fs.Directory, files map[string][]*shardSet, err error) {
+	listings := make([]fs.DirEntries, len(f.upstreams))
+	errs := f.forEach(func(i int, u fs.Fs) (err error) {
+		listings[i], err = u.List(ctx, dir)
+		return err
+	})
+	var failed, notFound int
+	for i, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, fs.ErrorDirNotFound):
+			notFound++
+		default:
+			fs.Errorf(f, "Failed to list %q on upstream %v: %v", dir, f.upstreams[i], err)
+			failed++
+		}
+	}
+	if failed > f.opt.ParityShards {
+		return nil, nil, fmt.Errorf("failed to list %q on %d upstreams: %w", dir, failed, errors.Join(errs...))
+	}
+	if notFound+failed == len(f.upstreams) {
+		return nil, nil, fs.ErrorDirNotFound
+	}
+	dirs = make(map[string]fs.Directory)
+	files = make(map[string][]*shardSet)
+	n := len(f.upstreams)
+	for i, entries := range listings {
+		for _, entry := range entries {
+			switch x := entry.(type) {
+			case fs.Object:
+				remote, size, generation, ok := parseShardName(x.Remote())
+				if !ok {
+					fs.Debugf(x, "Ignoring file which isn't a shard")
+					continue
+				}
+				if l := f.layout(size); x.Size() >= 0 && x.Size() != l.shardSize() {
+					fs.Errorf(x, "Ignoring shard %d on %v with size %d, expecting %d - use the heal backend command to repair", i, f.upstreams[i], x.Size(), l.shardSize())
+					continue
+				}
+				var set *shardSet
+				for _, s := range files[remote] {
+					if s.name == x.Remote() {
+						set = s
+						break
+					}
+				}
+				if set == nil {
+					set = &shardSet{name: x.Remote(), size: size, generation: generation, shards: make([]fs.Object, n)}
+					files[remote] = append(files[remote], set)
+				}
+				set.shards[i] = x
+			case fs.Directory:
+				if _, found := dirs[x.Remote()]; !found {
+					dirs[x.Remote()] = fs.NewDir(x.Remote(), x.ModTime(ctx))
+				}
+			default:
+				return nil, nil, fmt.Errorf("unknown object type %T", entry)
+			}
+		}
+	}
+	return dirs, files, nil
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	dirs, files, err := f.listShards(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		entries = append(entries, d)
+	}
+	for remote, sets := range files {
+		if _, found := dirs[remote]; found {
+			fs.Logf(f, "Ignoring file %q which has the same name as a directory", remote)
+			continue
+		}
+		entries = append(entries, f.newObject(ctx, remote, sets))
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.
+//
+// As the shard names contain the size this needs to list the parent
+// directory.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	dirs, files, err := f.listShards(ctx, dir)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sets, found := files[remote]; found {
+		return f.newObject(ctx, remote, sets), nil
+	}
+	if _, found := dirs[remote]; found {
+		return nil, fs.ErrorIsDir
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// newObject makes an Object from the shard sets found for remote.
+//
+// The set with the most shards (or the latest upload if there is a
+// tie) is used and the others are kept so they can be removed.
+func (f *Fs) newObject(ctx context.Context, remote string, sets []*shardSet) *Object {
+	best := 0
+	for i := 1; i < len(sets); i++ {
+		countI, countBest := sets[i].count(), sets[best].count()
+		if countI > countBest || (countI == countBest && sets[i].generation > sets[best].generation) {
+			best = i
+		}
+	}
+	o := &Object{
+		f:          f,
+		remote:     remote,
+		size:       sets[best].size,
+		generation: sets[best].generation,
+		shards:     sets[best].shards,
+	}
+	for i, set := range sets {
+		if i != best {
+			fs.Debugf(o, "Found shards of an older upload %q", set.name)
+			o.stale = append(o.stale, set)
+		}
+	}
+	if count := sets[best].count(); count < f.dataShards {
+		fs.Errorf(o, "Only %d of the %d shards needed to read this file are present", count, f.dataShards)
+	}
+	return o
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.NewObject(ctx, src.Remote())
+	switch err {
+	case nil:
+		return o, o.Update(ctx, in, src, options...)
+	case fs.ErrorObjectNotFound:
+		o := &Object{
+			f:      f,
+			remote: src.Remote(),
+			shards: make([]fs.Object, len(f.upstreams)),
+		}
+		if err := o.Update(ctx, in, src, options...); err != nil {
+			return nil, err
+		}
+		return o, nil
+	default:
+		return nil, err
+	}
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set {
+	return hash.Set(hash.MD5)
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return errors.Join(f.forEach(func(i int, u fs.Fs) error {
+		return u.Mkdir(ctx, dir)
+	})...)
+}
+
+// doDirs calls fn on each upstream, returning ErrorDirNotFound only
+// if the directory wasn't found on any of them
+func (f *Fs) doDirs(fn func(i int, u fs.Fs) error) error {
+	errs := f.forEach(fn)
+	notFound := 0
+	for i, err := range errs {
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			notFound++
+			errs[i] = nil
+		}
+	}
+	if notFound == len(f.upstreams) {
+		return fs.ErrorDirNotFound
+	}
+	return errors.Join(errs...)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return f.doDirs(func(i int, u fs.Fs) error {
+		return u.Rmdir(ctx, dir)
+	})
+}
+
+// Purge all files in the directory
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	return f.doDirs(func(i int, u fs.Fs) error {
+		return u.Features().Purge(ctx, dir)
+	})
+}
+
+type copyMoveFn func(context.Context, fs.Object, string) (fs.Object, error)
+
+// copyOrMove copies or moves all the shards of src to remote using
+// the server-side operation returned by do on each upstream.
+//
+// If this fails part of the way through then the shards already
+// copied are removed or the shards already moved are moved back.
+func (f *Fs) copyOrMove(ctx context.Context, src fs.Object, remote string, do func(u fs.Fs) copyMoveFn, opName string, cantErr error) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't %s - not same remote type", opName)
+		return nil, cantErr
+	}
+	if srcObj.f.name != f.name || len(srcObj.shards) != len(f.upstreams) {
+		fs.Debugf(src, "Can't %s - not same erasure remote", opName)
+		return nil, cantErr
+	}
+	for _, shard := range srcObj.shards {
+		if shard == nil {
+			fs.Debugf(src, "Can't %s - shards are missing", opName)
+			return nil, cantErr
+		}
+	}
+	// Find any existing shards so they can be removed if they have
+	// a different name to the new ones
+	var dstObj *Object
+	if o, err := f.NewObject(ctx, remote); err == nil {
+		dstObj = o.(*Object)
+	}
+	name := makeShardName(remote, srcObj.size, srcObj.generation)
+	shards := make([]fs.Object, len(f.upstreams))
+	errs := f.forEach(func(i int, u fs.Fs) (err error) {
+		shards[i], err = do(u)(ctx, srcObj.shards[i], name)
+		return err
+	})
+	if err := errors.Join(errs...); err != nil {
+		// Undo the shards which succeeded
+		for i, shard := range shards {
+			if shard == nil {
+				continue
+			}
+			var undoErr error
+			if opName == "move" {
+				_, undoErr = do(srcObj.f.upstreams[i])(ctx, shard, srcObj.shards[i].Remote())
+			} else {
+				undoErr = shard.Remove(ctx)
+			}
+			if undoErr != nil {
+				fs.Errorf(shard, "Failed to undo %s of shard %d: %v", opName, i, undoErr)
+			}
+		}
+		return nil, err
+	}
+	o := &Object{
+		f:          f,
+		remote:     remote,
+		size:       srcObj.size,
+		generation: srcObj.generation,
+		shards:     shards,
+		md5:        srcObj.md5,
+	}
+	if dstObj != nil {
+		dstObj.removeOld(ctx, name)
+	}
+	return o, nil
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	return f.copyOrMove(ctx, src, remote, func(u fs.Fs) copyMoveFn {
+		return u.Features().Copy
+	}, "copy", fs.ErrorCantCopy)
+}
+
+// Move src to this remote using server-side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	return f.copyOrMove(ctx, src, remote, func(u fs.Fs) copyMoveFn {
+		return u.Features().Move
+	}, "move", fs.ErrorCantMove)
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok || srcFs.name != f.name || len(srcFs.upstreams) != len(f.upstreams) {
+		fs.Debugf(srcFs, "Can't move directory - not same erasure remote")
+		return fs.ErrorCantDirMove
+	}
+	// Move the directory on each upstream in turn so it can be moved
+	// back if one of them fails.
+	//
+	// Upstreams without the directory are skipped as they are
+	// missing the shards in it, so it is only an error if it isn't
+	// found on any of them.
+	var moved []int
+	for i, u := range f.upstreams {
+		err := u.Features().DirMove(ctx, srcFs.upstreams[i], srcRemote, dstRemote)
+		if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+			// Not all backends return ErrorDirNotFound so check
+			if _, listErr := srcFs.upstreams[i].List(ctx, srcRemote); errors.Is(listErr, fs.ErrorDirNotFound) {
+				err = listErr
+			}
+		}
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			fs.Debugf(u, "Directory %q not found so not moving it", srcRemote)
+			continue
+		}
+		if err != nil {
+			for _, j := range moved {
+				undoErr := srcFs.upstreams[j].Features().DirMove(ctx, f.upstreams[j], dstRemote, srcRemote)
+				if undoErr != nil {
+					fs.Errorf(f.upstreams[j], "Failed to move directory %q back: %v", dstRemote, undoErr)
+				}
+			}
+			return err
+		}
+		moved = append(moved, i)
+	}
+	if len(moved) == 0 {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	return errors.Join(f.forEach(func(i int, u fs.Fs) error {
+		if do := u.Features().Shutdown; do != nil {
+			return do(ctx)
+		}
+		return nil
+	})...)
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Erasure '%s:%s'", f.name, f.root)
+}
+
+// Precision returns the precision of this Fs
+//
+// This is the coarsest precision of the upstreams.
+func (f *Fs) Precision() time.Duration {
+	precision := time.Duration(0)
+	for _, u := range f.upstreams {
+		precision = max(precision, u.Precision())
+	}
+	return precision
+}
+
+// Object represents a file stored as shards on the upstreams
+type Object struct {
+	f          *Fs
+	remote     string
+	size       int64
+	generation uint64      // generation of the upload the shards are from
+	shards     []fs.Object // shard i on upstream i, nil if missing
+	stale      []*shardSet // shards of other uploads of this file
+	mu         sync.Mutex  // protects md5
+	md5        string      // MD5 of the file, "" if not read yet
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// String returns a description of the Object
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// firstShard returns the first shard present or nil
+func (o *Object) firstShard() fs.Object {
+	for _, shard := range o.shards {
+		if shard != nil {
+			return shard
+		}
+	}
+	return nil
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	if shard := o.firstShard(); shard != nil {
+		return shard.ModTime(ctx)
+	}
+	return time.Now()
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	var errs []error
+	for _, shard := range o.shards {
+		if shard != nil {
+			errs = append(errs, shard.SetModTime(ctx, modTime))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Storable returns whether object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// readTrailers reads the trailers of all the shards present and
+// returns the one most of them agree on.
+func (o *Object) readTrailers(ctx context.Context) (t trailer, err error) {
+	l := o.f.layout(o.size)
+	trailers := make([]trailer, len(o.shards))
+	errs := o.f.forEach(func(i int, u fs.Fs) (err error) {
+		shard := o.shards[i]
+		if shard == nil {
+			return nil
+		}
+		start := l.shardSize() - trailerSize
+		in, err := shard.Open(ctx, &fs.RangeOption{Start: start, End: start + trailerSize - 1})
+		if err != nil {
+			return err
+		}
+		defer fs.CheckClose(in, &err)
+		buf := make([]byte, trailerSize)
+		if _, err = io.ReadFull(in, buf); err != nil {
+			return err
+		}
+		return trailers[i].unmarshal(buf)
+	})
+	counts := map[uint64]int{}
+	best := -1
+	for i := range trailers {
+		if o.shards[i] == nil {
+			continue
+		}
+		if errs[i] != nil {
+			fs.Errorf(o, "Failed to read trailer of shard %d - use the heal backend command to repair: %v", i, errs[i])
+			continue
+		}
+		generation := trailers[i].generation
+		counts[generation]++
+		if best < 0 || counts[generation] > counts[trailers[best].generation] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return t, fmt.Errorf("failed to read the trailer of any shards: %w", errors.Join(errs...))
+	}
+	return trailers[best], nil
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if ht != hash.MD5 {
+		return "", hash.ErrUnsupported
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.md5 != "" {
+		return o.md5, nil
+	}
+	t, err := o.readTrailers(ctx)
+	if err != nil {
+		return "", err
+	}
+	o.md5 = hex.EncodeToString(t.md5[:])
+	return o.md5, nil
+}
+
+// Remove an object
+func (o *Object) Remove(ctx context.Context) error {
+	var errs []error
+	for _, set := range append([]*shardSet{{shards: o.shards}}, o.stale...) {
+		for _, shard := range set.shards {
+			if shard == nil {
+				continue
+			}
+			if err := shard.Remove(ctx); err != nil && !errors.Is(err, fs.ErrorObjectNotFound) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// removeOld removes the shards of o which aren't called name and the
+// stale shards
+func (o *Object) removeOld(ctx context.Context, name string) {
+	for _, set := range append([]*shardSet{{shards: o.shards}}, o.stale...) {
+		for _, shard := range set.shards {
+			if shard == nil || shard.Remote() == name {
+				continue
+			}
+			if err := shard.Remove(ctx); err != nil && !errors.Is(err, fs.ErrorObjectNotFound) {
+				fs.Errorf(shard, "Failed to remove old shard: %v", err)
+			}
+		}
+	}
+	o.stale = nil
+}
+
+// newGeneration returns a generation number for an upload.
+//
+// This is the time in microseconds with some random bits added so
+// that later uploads have larger generations and two uploads at the
+// same time don't get the same one.
+func newGeneration() uint64 {
+	return uint64(time.Now().UnixMicro())<<12 | rand.Uint64N(1<<12)
+}
+
+// shardName returns the name of the shards of o
+func (o *Object) shardName() string {
+	return makeShardName(o.remote, o.size, o.generation)
+}
+
+// putShards encodes size bytes from in and uploads the shards of
+// generation for which upload[i] is true, returning the new shards.
+//
+// Shards of o which are already called name are updated in place and
+// the others are uploaded as new objects. Uploads of a new generation
+// always have a new name so they never overwrite the shards of the
+// previous upload.
+func (o *Object) putShards(ctx context.Context, in io.Reader, src fs.ObjectInfo, size int64, generation uint64, upload []bool, options ...fs.OpenOption) (shards []fs.Object, sum [16]byte, err error) {
+	l := o.f.layout(size)
+	n := l.shards()
+	name := makeShardName(o.remote, size, generation)
+	info := o.f.wrapInfo(src, name, l.shardSize())
+	shards = make([]fs.Object, n)
+	created := make([]bool, n)
+	outs := make([]io.Writer, n)
+	pipes := make([]*io.PipeWriter, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i, u := range o.f.upstreams {
+		if !upload[i] {
+			outs[i] = io.Discard
+			continue
+		}
+		pr, pw := io.Pipe()
+		outs[i], pipes[i] = pw, pw
+		existing := o.shards[i]
+		wg.Go(func() {
+			if existing != nil && existing.Remote() == name {
+				shards[i], errs[i] = existing, existing.Update(ctx, pr, info, options...)
+			} else {
+				shards[i], errs[i] = u.Put(ctx, pr, info, options...)
+				created[i] = shards[i] != nil
+			}
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("failed to upload shard %d to %v: %w", i, u, errs[i])
+			}
+			// stop the encoder if the upload finished early
+			_ = pr.CloseWithError(errs[i])
+		})
+	}
+	sum, err = encode(in, l, generation, outs)
+	for _, pw := range pipes {
+		if pw != nil {
+			_ = pw.CloseWithError(err)
+		}
+	}
+	wg.Wait()
+	if uploadErr := errors.Join(errs...); uploadErr != nil {
+		err = uploadErr
+	}
+	if err != nil {
+		// Remove new shards of a failed upload
+		for i, shard := range shards {
+			if created[i] {
+				if removeErr := shard.Remove(ctx); removeErr != nil {
+					fs.Errorf(shard, "Failed to remove shard of failed upload: %v", removeErr)
+				}
+			}
+		}
+		return nil, sum, err
+	}
+	return shards, sum, nil
+}
+
+// Update in to the object with the modTime given of the given size
+//
+// All the upstreams must be available to upload. The new shards are
+// uploaded alongside the old ones which are only removed once all the
+// new shards have been uploaded, so if the upload fails the old
+// contents of the file can still be read.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	size := src.Size()
+	if size < 0 {
+		return errors.New("can't upload files of unknown size to erasure remote")
+	}
+	upload := make([]bool, len(o.f.upstreams))
+	for i := range upload {
+		upload[i] = true
+	}
+	generation := newGeneration()
+	shards, sum, err := o.putShards(ctx, in, src, size, generation, upload, options...)
+	if err != nil {
+		return err
+	}
+	o.removeOld(ctx, makeShardName(o.remote, size, generation))
+	o.shards = shards
+	o.size = size
+	o.generation = generation
+	o.mu.Lock()
+	o.md5 = hex.EncodeToString(sum[:])
+	o.mu.Unlock()
+	return nil
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+//
+// The file can be read as long as parity_shards or fewer of its
+// shards are missing or corrupted.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	var openOptions []fs.OpenOption
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch opt := option.(type) {
+		case *fs.SeekOption:
+			offset = opt.Offset
+		case *fs.RangeOption:
+			offset, limit = opt.Decode(o.size)
+		default:
+			// pass Options on to the shard open, if appropriate
+			openOptions = append(openOptions, option)
+		}
+	}
+	if offset < 0 {
+		return nil, errors.New("invalid offset")
+	}
+	if limit < 0 || offset+limit > o.size {
+		limit = max(o.size-offset, 0)
+	}
+	return newDecoder(ctx, o, offset, limit, openOptions)
+}
+
+// ObjectInfo describes a wrapped fs.ObjectInfo for being the source
+// of a shard upload
+type ObjectInfo struct {
+	fs.ObjectInfo
+	f      *Fs
+	remote string
+	size   int64
+}
+
+// wrapInfo wraps src so it describes the shard newRemote of size
+func (f *Fs) wrapInfo(src fs.ObjectInfo, newRemote string, size int64) *ObjectInfo {
+	return &ObjectInfo{
+		ObjectInfo: src,
+		f:          f,
+		remote:     newRemote,
+		size:       size,
+	}
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (oi *ObjectInfo) Fs() fs.Info {
+	return oi.f
+}
+
+// Remote returns the remote path
+func (oi *ObjectInfo) Remote() string {
+	return oi.remote
+}
+
+// Size returns the size of the shard
+func (oi *ObjectInfo) Size() int64 {
+	return oi.size
+}
+
+// Hash returns the selected checksum of the shard
+//
+// The hashes of the source are for the file, not the shard, so
+// don't return any.
+func (oi *ObjectInfo) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	return "", nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs         = (*Fs)(nil)
+	_ fs.Purger     = (*Fs)(nil)
+	_ fs.Copier     = (*Fs)(nil)
+	_ fs.Mover      = (*Fs)(nil)
+	_ fs.DirMover   = (*Fs)(nil)
+	_ fs.Commander  = (*Fs)(nil)
+	_ fs.Wrapper    = (*Fs)(nil)
+	_ fs.Shutdowner = (*Fs)(nil)
+	_ fs.ObjectInfo = (*ObjectInfo)(nil)
+	_ fs.Object     = (*Object)(nil)
+)
@@ -0,0 +1,332 @@
+package erasure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomData(size int, seed int64) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestShardName(t *testing.T) {
+	for _, test := range []struct {
+		in         string
+		remote     string
+		size       int64
+		generation uint64
+		ok         bool
+	}{
+		{"file.txt.123.0000000000000001.ec", "file.txt", 123, 1, true},
+		{"dir/file.0.ffffffffffffffff.ec", "dir/file", 0, 0xffffffffffffffff, true},
+		{"a.1.0000000000000002.ec.2.0654a3b1c2d3e4f5.ec", "a.1.0000000000000002.ec", 2, 0x0654a3b1c2d3e4f5, true},
+		{"file.txt", "", 0, 0, false},
+		{"file.txt.123.ec", "", 0, 0, false},
+		{".1.0000000000000001.ec", "", 0, 0, false},
+		{"file.x.0000000000000001.ec", "", 0, 0, false},
+		{"file.1.000000000000001.ec", "", 0, 0, false},
+		{"file.1.000000000000000G.ec", "", 0, 0, false},
+	} {
+		remote, size, generation, ok := parseShardName(test.in)
+		assert.Equal(t, test.ok, ok, test.in)
+		assert.Equal(t, test.remote, remote, test.in)
+		assert.Equal(t, test.size, size, test.in)
+		assert.Equal(t, test.generation, generation, test.in)
+		if ok {
+			assert.Equal(t, test.in, makeShardName(remote, size, generation))
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	for _, test := range []struct {
+		size      int64
+		stripes   int64
+		lastBlock int64
+	}{
+		{0, 0, 0},
+		{1, 1, 1},
+		{3000, 1, 1000},
+		{3072, 1, 1024},
+		{3073, 2, 1},
+		{10000, 4, 262},
+	} {
+		l := newLayout(3, 2, 1024, test.size)
+		assert.Equal(t, test.stripes, l.stripes(), test.size)
+		if test.stripes > 0 {
+			assert.Equal(t, test.lastBlock, l.blockLen(test.stripes-1), test.size)
+		}
+		var total, shardSize int64
+		for stripe := range l.stripes() {
+			total += l.stripeLen(stripe)
+			assert.LessOrEqual(t, l.stripeLen(stripe), 3*l.blockLen(stripe))
+			shardSize += l.blockLen(stripe) + crcSize
+		}
+		assert.Equal(t, test.size, total, test.size)
+		assert.Equal(t, int64(headerSize+trailerSize)+shardSize, l.shardSize(), test.size)
+	}
+}
+
+// newTestFs makes an Fs with 3 data shards and 2 parity shards on
+// local directories, returning it and the directories
+func newTestFs(ctx context.Context, t *testing.T) (*Fs, []string) {
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()}
+	var upstreams fs.SpaceSepList
+	upstreams = append(upstreams, dirs...)
+	fsys, err := NewFs(ctx, "TestErasureInternal", "", configmap.Simple{
+		"upstreams":     upstreams.String(),
+		"parity_shards": "2",
+		"block_size":    "1k",
+	})
+	require.NoError(t, err)
+	return fsys.(*Fs), dirs
+}
+
+func put(ctx context.Context, t *testing.T, f *Fs, remote string, data []byte) fs.Object {
+	src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06.499999999Z"), int64(len(data)), true, nil, nil)
+	o, err := f.Put(ctx, bytes.NewReader(data), src)
+	require.NoError(t, err)
+	return o
+}
+
+func read(ctx context.Context, t *testing.T, f *Fs, remote string, options ...fs.OpenOption) ([]byte, error) {
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, in.Close())
+	return data, err
+}
+
+// shardPaths returns the paths of the shards of remote on each
+// upstream in dirs
+func shardPaths(t *testing.T, dirs []string, remote string) (paths []string) {
+	for _, dir := range dirs {
+		matches, err := filepath.Glob(filepath.Join(dir, remote) + ".*" + shardExt)
+		require.NoError(t, err)
+		paths = append(paths, matches...)
+	}
+	return paths
+}
+
+func heal(ctx context.Context, t *testing.T, f *Fs, verify bool) *healStats {
+	opt := map[string]string{}
+	if verify {
+		opt["verify"] = "true"
+	}
+	out, err := f.Command(ctx, "heal", nil, opt)
+	require.NoError(t, err)
+	return out.(*healStats)
+}
+
+func TestReadWrite(t *testing.T) {
+	ctx := context.Background()
+	f, _ := newTestFs(ctx, t)
+	for _, size := range []int{0, 1, 1000, 3072, 10000} {
+		data := randomData(size, int64(size))
+		o := put(ctx, t, f, "file", data)
+		assert.Equal(t, int64(size), o.Size())
+
+		got, err := read(ctx, t, f, "file")
+		require.NoError(t, err)
+		assert.Equal(t, data, got, size)
+
+		if size > 100 {
+			got, err = read(ctx, t, f, "file", &fs.RangeOption{Start: 50, End: int64(size) - 20})
+			require.NoError(t, err)
+			assert.Equal(t, data[50:size-19], got, size)
+			got, err = read(ctx, t, f, "file", &fs.SeekOption{Offset: int64(size) - 10})
+			require.NoError(t, err)
+			assert.Equal(t, data[size-10:], got, size)
+		}
+
+		md5, err := o.Hash(ctx, hash.MD5)
+		require.NoError(t, err)
+		o, err = f.NewObject(ctx, "file")
+		require.NoError(t, err)
+		md5Read, err := o.Hash(ctx, hash.MD5)
+		require.NoError(t, err)
+		assert.Equal(t, md5, md5Read)
+	}
+}
+
+func TestDegradedAndHeal(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(ctx, t)
+	data := randomData(20000, 1)
+	o := put(ctx, t, f, "dir/file", data)
+	shardPath := func(i int) string {
+		return filepath.Join(dirs[i], o.(*Object).shardName())
+	}
+
+	// Lose a data shard and corrupt another
+	require.NoError(t, os.Remove(shardPath(0)))
+	shard, err := os.ReadFile(shardPath(1))
+	require.NoError(t, err)
+	shard[headerSize+100] ^= 0xFF
+	require.NoError(t, os.WriteFile(shardPath(1), shard, 0666))
+
+	got, err := read(ctx, t, f, "dir/file")
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	got, err = read(ctx, t, f, "dir/file", &fs.RangeOption{Start: 5000, End: 15000})
+	require.NoError(t, err)
+	assert.Equal(t, data[5000:15001], got)
+
+	// Heal without verify only finds the missing shard
+	stats := heal(ctx, t, f, false)
+	assert.Equal(t, int64(1), stats.Checked)
+	assert.Equal(t, int64(1), stats.Healed)
+	assert.FileExists(t, shardPath(0))
+
+	// Heal with verify finds the corrupted shard
+	stats = heal(ctx, t, f, true)
+	assert.Equal(t, int64(1), stats.Healed)
+	healed, err := os.ReadFile(shardPath(1))
+	require.NoError(t, err)
+	shard[headerSize+100] ^= 0xFF
+	assert.Equal(t, shard, healed)
+
+	stats = heal(ctx, t, f, true)
+	assert.Equal(t, int64(1), stats.Healthy)
+
+	// Losing more shards than there are parity shards is unrecoverable
+	for i := range 3 {
+		require.NoError(t, os.Remove(shardPath(i)))
+	}
+	_, err = read(ctx, t, f, "dir/file")
+	assert.Error(t, err)
+	stats = heal(ctx, t, f, false)
+	assert.Equal(t, int64(1), stats.Unrecoverable)
+}
+
+func TestDirMoveMissing(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(ctx, t)
+	data := randomData(5000, 2)
+	put(ctx, t, f, "dir/file", data)
+
+	// Lose the directory on the first upstream
+	require.NoError(t, os.RemoveAll(filepath.Join(dirs[0], "dir")))
+
+	require.NoError(t, f.DirMove(ctx, f, "dir", "moved"))
+	got, err := read(ctx, t, f, "moved/file")
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.Len(t, shardPaths(t, dirs, "moved/file"), 4)
+	assert.Len(t, shardPaths(t, dirs, "dir/file"), 0)
+
+	// It is an error if the directory isn't on any upstream
+	assert.ErrorIs(t, f.DirMove(ctx, f, "dir", "moved2"), fs.ErrorDirNotFound)
+}
+
+func TestStaleShards(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(ctx, t)
+	data1 := randomData(5000, 1)
+	data2 := randomData(5000, 2)
+	shardPath := func(o fs.Object, i int) string {
+		return filepath.Join(dirs[i], o.(*Object).shardName())
+	}
+
+	// Keep a shard of the first upload and put it back in place of
+	// the shard of the second upload as if the second upload had
+	// failed to write it
+	o1 := put(ctx, t, f, "file", data1)
+	old, err := os.ReadFile(shardPath(o1, 0))
+	require.NoError(t, err)
+	o2 := put(ctx, t, f, "file", data2)
+	assert.Len(t, shardPaths(t, dirs, "file"), 5)
+	require.NoError(t, os.WriteFile(shardPath(o2, 0), old, 0666))
+
+	got, err := read(ctx, t, f, "file")
+	require.NoError(t, err)
+	assert.Equal(t, data2, got)
+
+	stats := heal(ctx, t, f, false)
+	assert.Equal(t, int64(1), stats.Healed)
+	stats = heal(ctx, t, f, true)
+	assert.Equal(t, int64(1), stats.Healthy)
+
+	// Shards of an earlier upload are removed
+	o3 := put(ctx, t, f, "file", data1[:100])
+	require.NoError(t, os.WriteFile(shardPath(o1, 0), old, 0666))
+	got, err = read(ctx, t, f, "file")
+	require.NoError(t, err)
+	assert.Equal(t, data1[:100], got)
+	stats = heal(ctx, t, f, false)
+	assert.Equal(t, int64(1), stats.Healed)
+	assert.NoFileExists(t, shardPath(o1, 0))
+	assert.Equal(t, []string{shardPath(o3, 0), shardPath(o3, 1), shardPath(o3, 2), shardPath(o3, 3), shardPath(o3, 4)}, shardPaths(t, dirs, "file"))
+}
+
+// errorReader returns err after reading n bytes of data
+type errorReader struct {
+	data []byte
+	n    int
+	err  error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, r.err
+	}
+	p = p[:min(len(p), r.n, len(r.data))]
+	n := copy(p, r.data)
+	r.data, r.n = r.data[n:], r.n-n
+	return n, nil
+}
+
+func TestFailedUpdate(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(ctx, t)
+	data1 := randomData(20000, 1)
+	data2 := randomData(20000, 2)
+	o := put(ctx, t, f, "file", data1)
+	paths := shardPaths(t, dirs, "file")
+	require.Len(t, paths, 5)
+
+	// An upload of the same size which fails part of the way
+	// through leaves the previous upload intact
+	readErr := errors.New("read failed")
+	src := object.NewStaticObjectInfo("file", time.Now(), int64(len(data2)), true, nil, nil)
+	err := o.Update(ctx, &errorReader{data: data2, n: 10000, err: readErr}, src)
+	require.ErrorIs(t, err, readErr)
+	assert.Equal(t, paths, shardPaths(t, dirs, "file"))
+	got, err := read(ctx, t, f, "file")
+	require.NoError(t, err)
+	assert.Equal(t, data1, got)
+	stats := heal(ctx, t, f, true)
+	assert.Equal(t, int64(1), stats.Healthy)
+
+	// A successful upload replaces the shards
+	o2 := put(ctx, t, f, "file", data2)
+	assert.NotEqual(t, o.(*Object).generation, o2.(*Object).generation)
+	newPaths := shardPaths(t, dirs, "file")
+	require.Len(t, newPaths, 5)
+	for _, p := range paths {
+		assert.NotContains(t, newPaths, p)
+	}
+	got, err = read(ctx, t, f, "file")
+	require.NoError(t, err)
+	assert.Equal(t, data2, got)
+}
@@ -0,0 +1,69 @@
+// Test the Erasure filesystem interface
+package erasure_test
+
+import (
+	"strings"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/all" // for integration tests
+	"github.com/rclone/rclone/backend/erasure"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+// TestIntegration runs integration tests against a concrete remote
+// set by the -remote flag. If the flag is not set, it creates a
+// dynamic erasure overlay over three local temporary directories.
+func TestIntegration(t *testing.T) {
+	opt := fstests.Opt{
+		RemoteName: *fstest.RemoteName,
+		NilObject:  (*erasure.Object)(nil),
+		UnimplementableObjectMethods: []string{
+			"MimeType",
+			"GetTier",
+			"SetTier",
+			"Metadata",
+			"SetMetadata",
+			"UnWrap",
+			"ID",
+		},
+		UnimplementableFsMethods: []string{
+			"PublicLink",
+			"OpenWriterAt",
+			"OpenChunkWriter",
+			"MergeDirs",
+			"DirCacheFlush",
+			"UserInfo",
+			"Disconnect",
+			"ListP",
+			"ListR",
+			"HardLink",
+			"PutUnchecked",
+			"PutStream",
+			"ChangeNotify",
+			"DirSetModTime",
+			"MkdirMetadata",
+			"About",
+			"CleanUp",
+			"UnWrap",
+		},
+		UnimplementableDirectoryMethods: []string{
+			"Metadata",
+			"SetMetadata",
+			"SetModTime",
+		},
+	}
+	if *fstest.RemoteName == "" {
+		name := "TestErasure"
+		opt.RemoteName = name + ":"
+		upstreams := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+		opt.ExtraConfig = []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "erasure"},
+			{Name: name, Key: "upstreams", Value: strings.Join(upstreams, " ")},
+			{Name: name, Key: "parity_shards", Value: "1"},
+			{Name: name, Key: "block_size", Value: "4k"},
+		}
+		opt.QuickTestOK = true
+	}
+	fstests.Run(t, &opt)
+}
@@ -0,0 +1,256 @@
+package erasure
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// Each file is stored as one shard on each upstream with the same
+// name, which is the name of the file with its size, the generation
+// of the upload in hex and shardExt appended, e.g.
+// "path/to/file.txt.1234.0654a3b1c2d3e4f5.ec". Storing the size in
+// the name means that listings don't need to read the shards, and
+// storing the generation means each upload is written to new objects
+// rather than overwriting the shards of the previous one.
+//
+// Each shard looks like this
+//
+//	header            - headerSize bytes
+//	block 0, crc 0    - blockSize bytes then the CRC-32C of the block
+//	block 1, crc 1
+//	...
+//	block n-1, crc n-1 - the last block may be shorter than blockSize
+//	trailer           - trailerSize bytes
+//
+// The file is split into stripes of dataShards*blockSize bytes. Each
+// stripe is split into dataShards blocks which are stored on the data
+// shards, and parityShards parity blocks are calculated from them
+// with Reed-Solomon coding and stored on the parity shards. The last
+// stripe is split into blocks of ceil(size/dataShards) bytes padded
+// with zeros.
+//
+// The header and trailer contain the generation number too so shards
+// from different uploads of the same file are never combined.
+const (
+	shardExt    = ".ec"
+	magic       = "RCLONEEC"
+	version     = 1
+	headerSize  = len(magic) + 4 + 4 + 8 + 8 + 4 // magic, version/shards/index, block size, size, generation, crc
+	trailerSize = md5.Size + 8 + 4               // md5, generation, crc
+	crcSize     = 4
+)
+
+var (
+	shardNameRegexp = regexp.MustCompile(`^(.+)\.(\d+)\.([0-9a-f]{16})` + regexp.QuoteMeta(shardExt) + `$`)
+	crcTable        = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// makeShardName returns the name of the shards of the upload of
+// remote with generation
+func makeShardName(remote string, size int64, generation uint64) string {
+	return fmt.Sprintf("%s.%d.%016x%s", remote, size, generation, shardExt)
+}
+
+// parseShardName returns the remote, size and generation encoded in
+// the name of a shard. ok is false if the name isn't a shard name.
+func parseShardName(name string) (remote string, size int64, generation uint64, ok bool) {
+	match := shardNameRegexp.FindStringSubmatch(name)
+	if match == nil {
+		return "", 0, 0, false
+	}
+	size, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil {
+		return "", 0, 0, false
+	}
+	generation, err = strconv.ParseUint(match[3], 16, 64)
+	if err != nil {
+		return "", 0, 0, false
+	}
+	return match[1], size, generation, true
+}
+
+// layout describes how a file of a given size is split into shards
+type layout struct {
+	dataShards   int
+	parityShards int
+	blockSize    int64
+	size         int64 // size of the file
+	fullStripes  int64 // number of stripes of blockSize blocks
+	lastBlock    int64 // size of the blocks in the last stripe if it is short or 0
+}
+
+// newLayout returns the layout for a file of size bytes
+func newLayout(dataShards, parityShards int, blockSize, size int64) layout {
+	stripeSize := int64(dataShards) * blockSize
+	rem := size % stripeSize
+	return layout{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		blockSize:    blockSize,
+		size:         size,
+		fullStripes:  size / stripeSize,
+		lastBlock:    (rem + int64(dataShards) - 1) / int64(dataShards),
+	}
+}
+
+// shards returns the total number of shards
+func (l *layout) shards() int {
+	return l.dataShards + l.parityShards
+}
+
+// stripes returns the number of stripes in the file
+func (l *layout) stripes() int64 {
+	if l.lastBlock > 0 {
+		return l.fullStripes + 1
+	}
+	return l.fullStripes
+}
+
+// stripeSize returns the number of bytes of the file in each full stripe
+func (l *layout) stripeSize() int64 {
+	return int64(l.dataShards) * l.blockSize
+}
+
+// blockLen returns the size of the blocks in stripe
+func (l *layout) blockLen(stripe int64) int64 {
+	if stripe < l.fullStripes {
+		return l.blockSize
+	}
+	return l.lastBlock
+}
+
+// stripeLen returns the number of bytes of the file in stripe
+func (l *layout) stripeLen(stripe int64) int64 {
+	return min(l.stripeSize(), l.size-stripe*l.stripeSize())
+}
+
+// blockOffset returns the offset of the block for stripe in a shard
+func (l *layout) blockOffset(stripe int64) int64 {
+	return int64(headerSize) + stripe*(l.blockSize+crcSize)
+}
+
+// shardSize returns the size of each shard
+func (l *layout) shardSize() int64 {
+	size := l.blockOffset(l.fullStripes)
+	if l.lastBlock > 0 {
+		size += l.lastBlock + crcSize
+	}
+	return size + trailerSize
+}
+
+// header is the start of each shard
+type header struct {
+	dataShards   int
+	parityShards int
+	index        int // which shard this is
+	blockSize    int64
+	size         int64
+	generation   uint64
+}
+
+// marshal the header into bytes
+func (h *header) marshal() []byte {
+	buf := make([]byte, 0, headerSize)
+	buf = append(buf, magic...)
+	buf = append(buf, version, byte(h.dataShards), byte(h.parityShards), byte(h.index))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(h.blockSize))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.size))
+	buf = binary.BigEndian.AppendUint64(buf, h.generation)
+	return binary.BigEndian.AppendUint32(buf, crc32.Checksum(buf, crcTable))
+}
+
+// errBadShard is returned when a shard is corrupted
+var errBadShard = errors.New("corrupted shard")
+
+// unmarshal the header from buf
+func (h *header) unmarshal(buf []byte) error {
+	if len(buf) != headerSize || string(buf[:len(magic)]) != magic {
+		return fmt.Errorf("%w: bad header", errBadShard)
+	}
+	crc := binary.BigEndian.Uint32(buf[headerSize-crcSize:])
+	if crc32.Checksum(buf[:headerSize-crcSize], crcTable) != crc {
+		return fmt.Errorf("%w: bad header checksum", errBadShard)
+	}
+	p := buf[len(magic):]
+	if p[0] != version {
+		return fmt.Errorf("unsupported shard version %d", p[0])
+	}
+	h.dataShards = int(p[1])
+	h.parityShards = int(p[2])
+	h.index = int(p[3])
+	h.blockSize = int64(binary.BigEndian.Uint32(p[4:]))
+	h.size = int64(binary.BigEndian.Uint64(p[8:]))
+	h.generation = binary.BigEndian.Uint64(p[16:])
+	return nil
+}
+
+// check the header is for shard index of layout l
+func (h *header) check(l *layout, index int) error {
+	if h.dataShards != l.dataShards || h.parityShards != l.parityShards || h.blockSize != l.blockSize {
+		return fmt.Errorf("shard was written with %d data shards, %d parity shards and block size %d but config has %d, %d and %d",
+			h.dataShards, h.parityShards, h.blockSize, l.dataShards, l.parityShards, l.blockSize)
+	}
+	if h.index != index {
+		return fmt.Errorf("%w: expecting shard %d but found shard %d", errBadShard, index, h.index)
+	}
+	if h.size != l.size {
+		return fmt.Errorf("%w: expecting size %d but found %d", errBadShard, l.size, h.size)
+	}
+	return nil
+}
+
+// trailer is the end of each shard
+type trailer struct {
+	md5        [md5.Size]byte
+	generation uint64
+}
+
+// marshal the trailer into bytes
+func (t *trailer) marshal() []byte {
+	buf := make([]byte, 0, trailerSize)
+	buf = append(buf, t.md5[:]...)
+	buf = binary.BigEndian.AppendUint64(buf, t.generation)
+	return binary.BigEndian.AppendUint32(buf, crc32.Checksum(buf, crcTable))
+}
+
+// unmarshal the trailer from buf
+func (t *trailer) unmarshal(buf []byte) error {
+	if len(buf) != trailerSize {
+		return fmt.Errorf("%w: bad trailer", errBadShard)
+	}
+	crc := binary.BigEndian.Uint32(buf[trailerSize-crcSize:])
+	if crc32.Checksum(buf[:trailerSize-crcSize], crcTable) != crc {
+		return fmt.Errorf("%w: bad trailer checksum", errBadShard)
+	}
+	copy(t.md5[:], buf)
+	t.generation = binary.BigEndian.Uint64(buf[md5.Size:])
+	return nil
+}
+
+// readBlock reads a block of n bytes and its CRC from in into buf
+// which must have capacity for n+crcSize bytes, returning the block.
+func readBlock(in io.Reader, buf []byte, n int64) ([]byte, error) {
+	buf = buf[:n+crcSize]
+	if _, err := io.ReadFull(in, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	block := buf[:n]
+	if crc32.Checksum(block, crcTable) != binary.BigEndian.Uint32(buf[n:]) {
+		return nil, fmt.Errorf("%w: bad block checksum", errBadShard)
+	}
+	return block, nil
+}
+
+// appendCRC appends the CRC of block to it
+func appendCRC(block []byte) []byte {
+	return binary.BigEndian.AppendUint32(block, crc32.Checksum(block, crcTable))
+}
@@ -259,12 +259,33 @@ Use this flag to disable preallocation.`,
 			},
 			{
 				Name: "no_sparse",
-				Help: `Disable sparse files for multi-thread downloads.
+				Help: `Disable sparse files.
 
 On Windows platforms rclone will make sparse files when doing
 multi-thread downloads. This avoids long pauses on large files where
 the OS zeros the file. However sparse files may be undesirable as they
-cause disk fragmentation and can be slow to work with.`,
+cause disk fragmentation and can be slow to work with.
+
+On Linux, macOS and FreeBSD rclone finds the holes in sparse files
+being read and skips them when copying to the local backend, making
+holes in the copy too. It doesn't read the holes when doing multi-thread
+copies.
+
+Use this flag to disable all of these.`,
+				Default:  false,
+				Advanced: true,
+			},
+			{
+				Name: "punch_holes",
+				Help: `Make holes in files written for blocks of zeros.
+
+Normally rclone writes out all the data it downloads. If this flag is
+set then rclone checks each block for zeros and leaves a hole in the
+file instead of writing them, making a sparse file. This saves disk
+space for files such as virtual machine disk images and databases
+which contain long runs of zeros.
+
+Holes are made for holes in local sources without this flag.`,
 				Default:  false,
 				Advanced: true,
 			},
@@ -359,6 +380,7 @@ type Options struct {
 	CaseInsensitive   bool                 `config:"case_insensitive"`
 	NoPreAllocate     bool                 `config:"no_preallocate"`
 	NoSparse          bool                 `config:"no_sparse"`
+	PunchHoles        bool                 `config:"punch_holes"`
 	NoSetModTime      bool                 `config:"no_set_modtime"`
 	FatalIfNoSpace    bool                 `config:"fatal_if_no_space"`
 	TimeType          timeType             `config:"time_type"`
@@ -1014,6 +1036,106 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	return dstObj, nil
 }
 
+// HardLink src to this remote so that both names share the same
+// underlying data.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantHardLink
+func (f *Fs) HardLink(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't hard link - not same remote type")
+		return nil, fs.ErrorCantHardLink
+	}
+	if f.opt.TranslateSymlinks && srcObj.translatedLink { // in --links mode, only hard link regular files
+		return nil, fs.ErrorCantHardLink
+	}
+
+	// Temporary Object under construction
+	dstObj := f.newObject(remote)
+
+	// Check it is a file if it exists
+	err := dstObj.lstat()
+	dstExists := true
+	if os.IsNotExist(err) {
+		dstExists = false
+	} else if err != nil {
+		return nil, err
+	} else {
+		dstObj.fs.objectMetaMu.RLock()
+		dstObjMode := dstObj.mode
+		dstObj.fs.objectMetaMu.RUnlock()
+		if !dstObj.fs.isRegular(dstObjMode) {
+			// It isn't a file
+			return nil, errors.New("can't hard link onto non-file")
+		}
+	}
+
+	// Create destination
+	err = dstObj.mkdirAll()
+	if err != nil {
+		return nil, err
+	}
+
+	srcPath := srcObj.path
+	if f.opt.FollowSymlinks { // in --copy-links mode, link the real file being pointed to
+		srcPath, err = filepath.EvalSymlinks(srcPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// If the destination is already a link to the source there is
+	// nothing to do. Renaming a link over another link to the same
+	// file does nothing so would leave the temporary behind.
+	if dstExists {
+		srcInfo, srcErr := os.Stat(srcPath)
+		dstInfo, dstErr := os.Lstat(dstObj.path)
+		if srcErr == nil && dstErr == nil && os.SameFile(srcInfo, dstInfo) {
+			return dstObj, nil
+		}
+	}
+
+	// If the destination exists link to a temporary name and
+	// rename over it so the replacement is atomic
+	linkPath := dstObj.path
+	if dstExists {
+		linkPath = dstObj.path + ".rclone-link"
+		_ = os.Remove(linkPath)
+	}
+	err = os.Link(srcPath, linkPath)
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		return nil, err
+	} else if err != nil {
+		// probably trying to link across file system boundaries
+		// or on a file system without hard links
+		fs.Debugf(src, "Can't hard link: %v", err)
+		return nil, fs.ErrorCantHardLink
+	}
+	if dstExists {
+		err = os.Rename(linkPath, dstObj.path)
+		// If the destination became a link to the source in the
+		// meantime the rename leaves linkPath behind
+		_ = os.Remove(linkPath)
+		if err != nil {
+			return nil, fmt.Errorf("hard link: failed to replace destination: %w", err)
+		}
+	}
+
+	// Update the info
+	err = dstObj.lstat()
+	if err != nil {
+		return nil, err
+	}
+
+	return dstObj, nil
+}
+
 // DirMove moves src, srcRemote to this remote at dstRemote
 // using server-side move operations.
 //
@@ -1477,18 +1599,27 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 				return err
 			}
 		}
-		if !o.fs.opt.NoPreAllocate {
-			// Pre-allocate the file for performance reasons
-			err = file.PreAllocate(src.Size(), f)
-			if err != nil {
-				fs.Debugf(o, "Failed to pre-allocate: %v", err)
-				if err == file.ErrDiskFull {
-					_ = f.Close()
-					return err
+		var sparse *sparseWriter
+		if !o.fs.opt.NoSparse {
+			sparse = newSparseWriter(ctx, f, src, o.fs.opt.PunchHoles)
+		}
+		if sparse != nil {
+			// Don't pre-allocate as it would fill in the holes
+			out = sparse
+		} else {
+			if !o.fs.opt.NoPreAllocate {
+				// Pre-allocate the file for performance reasons
+				err = file.PreAllocate(src.Size(), f)
+				if err != nil {
+					fs.Debugf(o, "Failed to pre-allocate: %v", err)
+					if err == file.ErrDiskFull {
+						_ = f.Close()
+						return err
+					}
 				}
 			}
+			out = f
 		}
-		out = f
 	} else {
 		out = nopWriterCloser{&symlinkData}
 	}
@@ -1599,10 +1730,85 @@ func (f *Fs) OpenWriterAt(ctx context.Context, remote string, size int64) (fs.Wr
 			fs.Errorf(o, "Failed to set sparse: %v", err)
 		}
 	}
+	if !f.opt.NoSparse {
+		// Set the size now so holes can be punched in the
+		// pre-allocated space before the end is written
+		if size > 0 {
+			err = out.Truncate(size)
+			if err != nil {
+				_ = out.Close()
+				return nil, fmt.Errorf("failed to set size: %w", err)
+			}
+		}
+		return &sparseWriterAt{File: out, zeros: f.opt.PunchHoles}, nil
+	}
 
 	return out, nil
 }
 
+// localPatch is a file being changed in place by Patch
+type localPatch struct {
+	*os.File
+	size int64 // size to set the file to on Close
+}
+
+// Close the file setting it to its final size
+func (p *localPatch) Close() error {
+	err := p.File.Truncate(p.size)
+	closeErr := p.File.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Patch opens the object for changing in place with WriteAt.
+//
+// The returned writer can also ReadAt so blocks can be moved within
+// the file.
+func (o *Object) Patch(ctx context.Context, size int64) (fs.WriterAtCloser, error) {
+	if o.translatedLink {
+		return nil, errors.New("can't patch a symlink")
+	}
+	out, err := file.OpenFile(o.path, os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	// Wipe hashes before update
+	o.clearHashCache()
+	return &localPatch{File: out, size: size}, nil
+}
+
+// PatchCopy copies the object to remote so the copy can be changed
+// with Patch. The data is copied on the local disk.
+func (o *Object) PatchCopy(ctx context.Context, remote string) (fs.Object, error) {
+	if o.translatedLink {
+		return nil, fs.ErrorCantCopy
+	}
+	in, err := file.Open(o.path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	outPath := o.fs.localPath(remote)
+	out, err := file.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(out, in)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(outPath)
+		return nil, fmt.Errorf("PatchCopy: %w", err)
+	}
+	return o.fs.NewObject(ctx, remote)
+}
+
 // setMetadata sets the file info from the os.FileInfo passed in
 func (o *Object) setMetadata(info os.FileInfo) {
 	// if not checking updated then don't update the stat
@@ -1774,6 +1980,7 @@ var (
 	_ fs.Fs              = &Fs{}
 	_ fs.PutStreamer     = &Fs{}
 	_ fs.Mover           = &Fs{}
+	_ fs.HardLinker      = &Fs{}
 	_ fs.DirMover        = &Fs{}
 	_ fs.Commander       = &Fs{}
 	_ fs.OpenWriterAter  = &Fs{}
@@ -1782,6 +1989,8 @@ var (
 	_ fs.Object          = &Object{}
 	_ fs.Metadataer      = &Object{}
 	_ fs.SetMetadataer   = &Object{}
+	_ fs.Patcher         = &Object{}
+	_ fs.PatchCopier     = &Object{}
 	_ fs.Directory       = &Directory{}
 	_ fs.SetModTimer     = &Directory{}
 	_ fs.SetMetadataer   = &Directory{}
@@ -677,3 +677,43 @@ func TestCopySymlink(t *testing.T) {
 	want = fstest.NewItem("dst2/file.txt", "hello world", when)
 	fstest.CompareItems(t, []fs.DirEntry{dst}, []fstest.Item{want}, nil, f.precision, "")
 }
+
+func TestHardLink(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	when := time.Now()
+	f := r.Flocal.(*Fs)
+
+	file1 := r.WriteFile("src/file.txt", "hello world", when)
+	src, err := f.NewObject(ctx, "src/file.txt")
+	require.NoError(t, err)
+
+	// Hard link to a new file
+	dst, err := f.HardLink(ctx, src, "dst/file.txt")
+	require.NoError(t, err)
+	want := fstest.NewItem("dst/file.txt", "hello world", when)
+	fstest.CompareItems(t, []fs.DirEntry{dst}, []fstest.Item{want}, nil, f.precision, "")
+
+	srcInfo, err := os.Stat(filepath.Join(r.LocalName, "src", "file.txt"))
+	require.NoError(t, err)
+	dstInfo, err := os.Stat(filepath.Join(r.LocalName, "dst", "file.txt"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(srcInfo, dstInfo))
+
+	// Hard link over an existing file
+	r.WriteFile("dst/other.txt", "something else", when)
+	_, err = f.HardLink(ctx, src, "dst/other.txt")
+	require.NoError(t, err)
+	otherInfo, err := os.Stat(filepath.Join(r.LocalName, "dst", "other.txt"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(srcInfo, otherInfo))
+
+	// Hard link over an existing link to the same file
+	_, err = f.HardLink(ctx, src, "dst/other.txt")
+	require.NoError(t, err)
+	_, err = os.Lstat(filepath.Join(r.LocalName, "dst", "other.txt.rclone-link"))
+	assert.True(t, os.IsNotExist(err))
+
+	want2 := fstest.NewItem("dst/other.txt", "hello world", when)
+	r.CheckLocalItems(t, file1, want, want2)
+}
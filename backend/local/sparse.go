@@ -0,0 +1,162 @@
+package local
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/lib/ranges"
+)
+
+// sparseBlockSize is the size of the blocks checked for zeros when
+// making holes in files
+const sparseBlockSize = 64 * 1024
+
+// isZero returns true if p is all zeros
+func isZero(p []byte) bool {
+	for len(p) >= 8 {
+		if p[0]|p[1]|p[2]|p[3]|p[4]|p[5]|p[6]|p[7] != 0 {
+			return false
+		}
+		p = p[8:]
+	}
+	for _, c := range p {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// DataRanges returns the parts of the object which contain data in
+// order. The rest of the object is holes which read as zeros.
+func (o *Object) DataRanges(ctx context.Context) (rs ranges.Ranges, err error) {
+	size := o.Size()
+	if o.translatedLink || o.fs.opt.NoSparse || !file.DataRangesImplemented {
+		return ranges.Ranges{{Pos: 0, Size: size}}, nil
+	}
+	in, err := file.Open(o.path)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	return file.DataRanges(in, size)
+}
+
+// Check the interfaces are satisfied
+var _ fs.DataRanger = (*Object)(nil)
+
+// sparseWriter writes a file sequentially leaving holes instead of
+// writing zeros where it can
+type sparseWriter struct {
+	out   *os.File
+	data  ranges.Ranges // parts of the source with data if known
+	known bool          // set if data is valid
+	zeros bool          // set to make holes for blocks of zeros too
+	pos   int64         // position in the output
+	seek  bool          // set if out needs seeking to pos before writing
+}
+
+// newSparseWriter makes a sparseWriter writing to out if src has
+// holes or zeros is set, otherwise it returns nil
+func newSparseWriter(ctx context.Context, out *os.File, src fs.ObjectInfo, zeros bool) *sparseWriter {
+	w := &sparseWriter{
+		out:   out,
+		zeros: zeros,
+	}
+	if do, ok := src.(fs.DataRanger); ok {
+		data, err := do.DataRanges(ctx)
+		if err != nil {
+			fs.Debugf(src, "Failed to find holes in source: %v", err)
+		} else if data.Size() < src.Size() {
+			w.data, w.known = data, true
+		}
+	}
+	if !w.known && !w.zeros {
+		return nil
+	}
+	return w
+}
+
+// isHole returns true if p which will be written at pos can be left as
+// a hole
+func (w *sparseWriter) isHole(pos int64, p []byte) bool {
+	if w.known && len(w.data.Intersection(ranges.Range{Pos: pos, Size: int64(len(p))})) == 0 {
+		return true
+	}
+	return w.zeros && isZero(p)
+}
+
+// Write p to the output skipping holes
+func (w *sparseWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		// Work in blocks aligned to sparseBlockSize
+		chunk := min(len(p), int(sparseBlockSize-w.pos%sparseBlockSize))
+		block := p[:chunk]
+		if w.isHole(w.pos, block) {
+			w.seek = true
+		} else {
+			if w.seek {
+				_, err = w.out.Seek(w.pos, io.SeekStart)
+				if err != nil {
+					return n, err
+				}
+				w.seek = false
+			}
+			written, err := w.out.Write(block)
+			if err != nil {
+				return n + written, err
+			}
+		}
+		n += chunk
+		w.pos += int64(chunk)
+		p = p[chunk:]
+	}
+	return n, nil
+}
+
+// Close the output making sure it is the right size if it ended in a
+// hole
+func (w *sparseWriter) Close() (err error) {
+	if w.seek {
+		err = w.out.Truncate(w.pos)
+	}
+	closeErr := w.out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// sparseWriterAt writes a file at random leaving holes instead of
+// writing zeros where it can
+type sparseWriterAt struct {
+	*os.File
+	zeros bool // set to make holes for blocks of zeros too
+}
+
+// WriteAt writes p at off making a hole if it is all zeros and zeros
+// is set
+func (w *sparseWriterAt) WriteAt(p []byte, off int64) (n int, err error) {
+	if w.zeros && len(p) >= sparseBlockSize && isZero(p) {
+		return len(p), w.WriteHole(off, int64(len(p)))
+	}
+	return w.File.WriteAt(p, off)
+}
+
+// WriteHole records that size bytes at off are a hole which reads as
+// zeros instead of writing them.
+//
+// The file was created with its final size so this only needs to free
+// any space pre-allocated for it.
+func (w *sparseWriterAt) WriteHole(off, size int64) error {
+	return file.PunchHole(w.File, off, size)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.WriterAtCloser = (*sparseWriterAt)(nil)
+	_ fs.HoleWriterAt   = (*sparseWriterAt)(nil)
+)
@@ -0,0 +1,187 @@
+//go:build linux || darwin || freebsd
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/ranges"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sparseTestSize = 4 << 20
+
+// sparseTestData makes the contents of a test file with data at the
+// start and at 3 MiB and zeros everywhere else
+func sparseTestData() []byte {
+	data := make([]byte, sparseTestSize)
+	copy(data, "start")
+	copy(data[3<<20:], "middle")
+	return data
+}
+
+// allocatedSize returns how much disk space the file at path uses
+//
+// This is used rather than looking for holes as some filesystems
+// report holes which have been read as data.
+func allocatedSize(t *testing.T, path string) int64 {
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	return fi.Sys().(*syscall.Stat_t).Blocks * 512
+}
+
+func TestIsZero(t *testing.T) {
+	assert.True(t, isZero(nil))
+	assert.True(t, isZero(make([]byte, 17)))
+	for i := range 17 {
+		p := make([]byte, 17)
+		p[i] = 1
+		assert.False(t, isZero(p), i)
+	}
+}
+
+// sparseObjectInfo is an ObjectInfo with known holes
+type sparseObjectInfo struct {
+	fs.ObjectInfo
+	data ranges.Ranges
+}
+
+// DataRanges returns the parts of the object which contain data
+func (o sparseObjectInfo) DataRanges(ctx context.Context) (ranges.Ranges, error) {
+	return o.data, nil
+}
+
+func TestSparseWriter(t *testing.T) {
+	ctx := context.Background()
+	data := sparseTestData()
+	for _, test := range []struct {
+		name  string
+		src   fs.ObjectInfo
+		zeros bool
+		want  bool // whether we want a sparseWriter
+	}{
+		{
+			name: "plain",
+			src:  object.NewStaticObjectInfo("file", time.Now(), sparseTestSize, true, nil, nil),
+		}, {
+			name:  "zeros",
+			src:   object.NewStaticObjectInfo("file", time.Now(), sparseTestSize, true, nil, nil),
+			zeros: true,
+			want:  true,
+		}, {
+			name: "holes",
+			src: sparseObjectInfo{
+				ObjectInfo: object.NewStaticObjectInfo("file", time.Now(), sparseTestSize, true, nil, nil),
+				data:       ranges.Ranges{{Pos: 0, Size: 5}, {Pos: 3 << 20, Size: 6}},
+			},
+			want: true,
+		}, {
+			name: "no holes",
+			src: sparseObjectInfo{
+				ObjectInfo: object.NewStaticObjectInfo("file", time.Now(), sparseTestSize, true, nil, nil),
+				data:       ranges.Ranges{{Pos: 0, Size: sparseTestSize}},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			out, err := os.Create(path)
+			require.NoError(t, err)
+			w := newSparseWriter(ctx, out, test.src, test.zeros)
+			if !test.want {
+				assert.Nil(t, w)
+				require.NoError(t, out.Close())
+				return
+			}
+			require.NotNil(t, w)
+
+			// Write in odd sized pieces to check the blocks are aligned
+			in := bytes.NewReader(data)
+			buf := make([]byte, 12345)
+			for {
+				n, _ := in.Read(buf)
+				if n == 0 {
+					break
+				}
+				written, err := w.Write(buf[:n])
+				require.NoError(t, err)
+				assert.Equal(t, n, written)
+			}
+			require.NoError(t, w.Close())
+
+			got, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(data, got))
+			assert.Less(t, allocatedSize(t, path), int64(sparseTestSize))
+		})
+	}
+}
+
+// makeSparseSource makes a sparse file in r.LocalName returning its
+// object
+func makeSparseSource(t *testing.T, r *fstest.Run) fs.Object {
+	require.NoError(t, os.MkdirAll(r.LocalName, 0777))
+	path := filepath.Join(r.LocalName, "sparse")
+	out, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, out.Truncate(sparseTestSize))
+	data := sparseTestData()
+	_, err = out.WriteAt(data[:5], 0)
+	require.NoError(t, err)
+	_, err = out.WriteAt(data[3<<20:3<<20+6], 3<<20)
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+	if allocatedSize(t, path) == sparseTestSize {
+		t.Skip("filesystem doesn't support sparse files")
+	}
+	src, err := r.Flocal.NewObject(context.Background(), "sparse")
+	require.NoError(t, err)
+	return src
+}
+
+func testCopySparse(t *testing.T, multiThread bool) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+	if _, ok := r.Fremote.(*Fs); !ok {
+		t.Skip("remote isn't local")
+	}
+	if multiThread {
+		ci.MultiThreadCutoff = 0
+		ci.MultiThreadStreams = 2
+		ci.MultiThreadChunkSize = 1 << 20
+		ci.MultiThreadSet = true
+	} else {
+		ci.MultiThreadStreams = 0
+	}
+	src := makeSparseSource(t, r)
+
+	dst, err := operations.Copy(ctx, r.Fremote, nil, "sparse", src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(sparseTestSize), dst.Size())
+
+	path := filepath.Join(r.Fremote.Root(), "sparse")
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(sparseTestData(), got))
+	assert.Less(t, allocatedSize(t, path), int64(sparseTestSize))
+}
+
+func TestCopySparse(t *testing.T) {
+	testCopySparse(t, false)
+}
+
+func TestCopySparseMultiThread(t *testing.T) {
+	testCopySparse(t, true)
+}
@@ -0,0 +1,326 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"golang.org/x/sync/errgroup"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "check",
+	Short: "Compare the replicas and report any differences.",
+	Long: `This compares the files on each upstream with the files on the first
+upstream in the same way as ` + "`rclone check`" + ` does, comparing sizes and
+hashes, and reports the files which are missing, extra or different on
+each upstream.
+
+Usage examples:
+
+` + "```console" + `
+rclone backend check mirror:
+rclone backend check mirror:path/to/dir -o download
+` + "```" + `
+
+With the download option the contents of the files are compared
+instead of their hashes, which is useful if the upstreams don't have a
+hash in common.`,
+	Opts: map[string]string{
+		"download": "Compare the contents of the files instead of their hashes",
+	},
+}, {
+	Name:  "repair",
+	Short: "Make the replicas the same again.",
+	Long: `This finds the files which differ between the upstreams as the check
+command does, then copies the newest version of each of them to the
+upstreams which are missing it or have a different version.
+
+Usage examples:
+
+` + "```console" + `
+rclone backend repair mirror:
+rclone backend repair mirror:path/to/dir -o download
+` + "```" + `
+
+Repair never deletes files - a file which is only on some of the
+upstreams, e.g. because deleting it failed on the others, is copied
+to the rest. Delete it through the mirror remote afterwards if it
+isn't wanted.
+
+Use the --dry-run flag to see what would be copied without changing
+anything.`,
+	Opts: map[string]string{
+		"download": "Compare the contents of the files instead of their hashes",
+	},
+}, {
+	Name:  "status",
+	Short: "Show the read health of each upstream.",
+	Long: `This shows whether each upstream is being used for reads, the
+average time it has taken to open files and the last error reading
+from it, if any.
+
+Usage example:
+
+` + "```console" + `
+rclone backend status mirror:
+` + "```",
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out any, err error) {
+	_, download := opt["download"]
+	switch name {
+	case "check":
+		return f.check(ctx, download)
+	case "repair":
+		return f.repair(ctx, download)
+	case "status":
+		return f.status(), nil
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// replicaReport lists the differences between an upstream and the
+// reference upstream
+type replicaReport struct {
+	Upstream string   `json:"upstream"`
+	Missing  []string `json:"missing"` // files on the reference but not on this upstream
+	Extra    []string `json:"extra"`   // files on this upstream but not on the reference
+	Differ   []string `json:"differ"`  // files which are different
+	Errors   []string `json:"errors"`  // files which couldn't be compared
+}
+
+// checkReport is the result of the check command
+type checkReport struct {
+	Reference string           `json:"reference"`
+	Divergent int              `json:"divergent"` // number of files which differ on any upstream
+	Replicas  []*replicaReport `json:"replicas"`
+}
+
+// lines splits the output of a check into file names
+func lines(buf *bytes.Buffer) (names []string) {
+	for line := range strings.Lines(buf.String()) {
+		names = append(names, strings.TrimSuffix(line, "\n"))
+	}
+	return names
+}
+
+// check compares each upstream with the first one using
+// operations.Check and returns the differences.
+//
+// The differences aren't counted as errors in the global stats.
+func (f *Fs) check(ctx context.Context, download bool) (*checkReport, error) {
+	ctx = accounting.WithStatsGroup(ctx, "mirror-check")
+	report := &checkReport{
+		Reference: fs.ConfigString(f.upstreams[0]),
+	}
+	divergent := map[string]struct{}{}
+	for _, u := range f.upstreams[1:] {
+		var missing, extra, differ, errs bytes.Buffer
+		opt := &operations.CheckOpt{
+			Fsrc:         f.upstreams[0],
+			Fdst:         u,
+			MissingOnDst: &missing,
+			MissingOnSrc: &extra,
+			Differ:       &differ,
+			Error:        &errs,
+		}
+		var err error
+		if download {
+			err = operations.CheckDownload(ctx, opt)
+		} else {
+			err = operations.Check(ctx, opt)
+		}
+		r := &replicaReport{
+			Upstream: fs.ConfigString(u),
+			Missing:  lines(&missing),
+			Extra:    lines(&extra),
+			Differ:   lines(&differ),
+			Errors:   lines(&errs),
+		}
+		n := 0
+		for _, names := range [][]string{r.Missing, r.Extra, r.Differ, r.Errors} {
+			for _, name := range names {
+				divergent[name] = struct{}{}
+				n++
+			}
+		}
+		// Check returns an error if there are differences so only
+		// fail if it didn't find any
+		if err != nil && n == 0 {
+			return nil, fmt.Errorf("failed to check %v: %w", u, err)
+		}
+		report.Replicas = append(report.Replicas, r)
+	}
+	report.Divergent = len(divergent)
+	fs.Infof(f, "Found %d files which differ between the upstreams", report.Divergent)
+	return report, nil
+}
+
+// repairReport is the result of the repair command
+type repairReport struct {
+	Divergent int      `json:"divergent"` // number of files which differed
+	Repaired  []string `json:"repaired"`  // files which were copied to some upstreams
+	Failed    []string `json:"failed"`    // files which couldn't be repaired
+}
+
+// repair copies the newest version of each file which differs between
+// the upstreams to the upstreams which don't have it
+func (f *Fs) repair(ctx context.Context, download bool) (*repairReport, error) {
+	check, err := f.check(ctx, download)
+	if err != nil {
+		return nil, err
+	}
+	var remotes []string
+	for _, r := range check.Replicas {
+		remotes = append(remotes, r.Missing...)
+		remotes = append(remotes, r.Extra...)
+		remotes = append(remotes, r.Differ...)
+		remotes = append(remotes, r.Errors...)
+	}
+	slices.Sort(remotes)
+	remotes = slices.Compact(remotes)
+
+	report := &repairReport{
+		Divergent: len(remotes),
+		Repaired:  []string{},
+		Failed:    []string{},
+	}
+	var mu sync.Mutex
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	for _, remote := range remotes {
+		g.Go(func() error {
+			err := f.repairFile(gCtx, remote, download)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fs.Errorf(remote, "Failed to repair: %v", err)
+				report.Failed = append(report.Failed, remote)
+			} else {
+				report.Repaired = append(report.Repaired, remote)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	slices.Sort(report.Repaired)
+	slices.Sort(report.Failed)
+	if len(report.Failed) > 0 {
+		return report, fmt.Errorf("failed to repair %d files", len(report.Failed))
+	}
+	return report, nil
+}
+
+// sameReplica returns true if replica has the same contents as src
+func sameReplica(ctx context.Context, src, replica fs.Object, download bool) (bool, error) {
+	if src.Size() != replica.Size() {
+		return false, nil
+	}
+	if download {
+		return operations.CheckIdenticalDownload(ctx, src, replica)
+	}
+	same, ht, err := operations.CheckHashes(ctx, src, replica)
+	if ht == hash.None {
+		return true, err
+	}
+	return same, err
+}
+
+// repairFile copies the newest replica of remote to the upstreams
+// which are missing it or have a different version
+func (f *Fs) repairFile(ctx context.Context, remote string, download bool) error {
+	replicas := make([]fs.Object, len(f.upstreams))
+	errs := f.forEach(func(i int, u fs.Fs) (err error) {
+		replicas[i], err = u.NewObject(ctx, remote)
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			err = nil
+		}
+		return err
+	})
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	var newest fs.Object
+	var newestTime time.Time
+	for _, replica := range replicas {
+		if replica == nil {
+			continue
+		}
+		if modTime := replica.ModTime(ctx); newest == nil || modTime.After(newestTime) {
+			newest, newestTime = replica, modTime
+		}
+	}
+	if newest == nil {
+		return fs.ErrorObjectNotFound
+	}
+	errs = f.forEach(func(i int, u fs.Fs) error {
+		replica := replicas[i]
+		if replica == newest {
+			return nil
+		}
+		if replica != nil {
+			same, err := sameReplica(ctx, newest, replica, download)
+			if err != nil {
+				return err
+			}
+			if same {
+				return nil
+			}
+		}
+		fs.Infof(remote, "Copying newest version to %v", u)
+		_, err := operations.Copy(ctx, u, replica, remote, newest)
+		return err
+	})
+	return errors.Join(errs...)
+}
+
+// upstreamStatus is the read health of an upstream
+type upstreamStatus struct {
+	Upstream  string  `json:"upstream"`
+	Healthy   bool    `json:"healthy"`
+	Latency   float64 `json:"latency"` // average time to open files in seconds
+	Opens     int64   `json:"opens"`
+	LastError string  `json:"lastError,omitempty"`
+}
+
+// status returns the read health of each upstream
+func (f *Fs) status() []upstreamStatus {
+	backoff := time.Duration(f.opt.FailureBackoff)
+	out := make([]upstreamStatus, len(f.upstreams))
+	for i, u := range f.upstreams {
+		h := f.health[i]
+		healthy, latency := h.state(backoff)
+		h.mu.Lock()
+		out[i] = upstreamStatus{
+			Upstream: fs.ConfigString(u),
+			Healthy:  healthy,
+			Latency:  latency.Seconds(),
+			Opens:    h.opens,
+		}
+		if h.lastErr != nil {
+			out[i].LastError = h.lastErr.Error()
+		}
+		h.mu.Unlock()
+	}
+	return out
+}
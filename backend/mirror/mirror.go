@@ -0,0 +1,990 @@
+// Package mirror provides an Fs which stores a replica of every file
+// on each of several upstreams
+package mirror
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "mirror",
+		Description: "Mirror files to several remotes and read from the fastest healthy one",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name:     "upstreams",
+			Required: true,
+			Help: `List of space separated upstreams to mirror files to.
+
+Every file is written to all of these, e.g.
+'gdrive:backup s3:bucket/backup "local:/mnt/disk 1/backup"'.`,
+		}, {
+			Name:     "failure_backoff",
+			Default:  fs.Duration(time.Minute),
+			Advanced: true,
+			Help: `How long to avoid reading from an upstream after it fails.
+
+Reads go to the healthy upstream which has been quickest to open
+files. If reading from an upstream fails it isn't used for reads again
+for this long unless all the other upstreams have failed too.`,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Upstreams      fs.SpaceSepList `config:"upstreams"`
+	FailureBackoff fs.Duration     `config:"failure_backoff"`
+}
+
+// Fs represents a set of mirrored upstreams
+type Fs struct {
+	name      string
+	root      string
+	upstreams []fs.Fs      // replica i of each file is on upstreams[i]
+	health    []*health    // read health of each upstream
+	opt       Options      // copy of Options
+	features  *fs.Features // optional features
+	hashes    hash.Set     // hashes supported by all the upstreams
+	wrapper   fs.Fs        // wrapper is used by SetWrapper
+}
+
+// health tracks how well reads from an upstream are working
+type health struct {
+	mu      sync.Mutex
+	latency time.Duration // moving average of the time taken to open files
+	opens   int64         // number of successful opens
+	failed  time.Time     // time of the last failure or zero
+	lastErr error         // the last error
+}
+
+// success records a successful open which took latency
+func (h *health) success(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.opens == 0 {
+		h.latency = latency
+	} else {
+		h.latency = (4*h.latency + latency) / 5
+	}
+	h.opens++
+	h.failed = time.Time{}
+}
+
+// failure records a failed read
+func (h *health) failure(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failed = time.Now()
+	h.lastErr = err
+}
+
+// state returns whether the upstream is healthy and its latency
+func (h *health) state(backoff time.Duration) (healthy bool, latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failed.IsZero() || time.Since(h.failed) > backoff, h.latency
+}
+
+// makeUpstreams makes the Fs for each upstream at rpath returning
+// fs.ErrorIsFile if rpath is a file on any of them
+func makeUpstreams(ctx context.Context, upstreams []string, rpath string) (fses []fs.Fs, err error) {
+	fses = make([]fs.Fs, len(upstreams))
+	isFile := false
+	for i, u := range upstreams {
+		baseName, basePath, err := fspath.SplitFs(u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse upstream %q: %w", u, err)
+		}
+		fses[i], err = cache.Get(ctx, baseName+fspath.JoinRootPath(basePath, rpath))
+		if err == fs.ErrorIsFile {
+			isFile = true
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to make upstream %q: %w", u, err)
+		}
+	}
+	if isFile {
+		return fses, fs.ErrorIsFile
+	}
+	return fses, nil
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(opt.Upstreams) < 2 {
+		return nil, errors.New("mirror needs at least 2 upstreams - check the value of the upstreams setting")
+	}
+	for _, u := range opt.Upstreams {
+		if strings.HasPrefix(u, name+":") {
+			return nil, errors.New("can't point mirror remote at itself - check the value of the upstreams setting")
+		}
+	}
+
+	rpath = strings.Trim(rpath, "/")
+	upstreams, err := makeUpstreams(ctx, opt.Upstreams, rpath)
+	isFile := err == fs.ErrorIsFile
+	if isFile {
+		// Point all the upstreams at the parent directory
+		rpath = path.Dir(rpath)
+		if rpath == "." {
+			rpath = ""
+		}
+		upstreams, err = makeUpstreams(ctx, opt.Upstreams, rpath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := &Fs{
+		name:      name,
+		root:      rpath,
+		upstreams: upstreams,
+		health:    make([]*health, len(upstreams)),
+		opt:       *opt,
+		hashes:    hash.Supported(),
+	}
+	for i, u := range f.upstreams {
+		f.health[i] = new(health)
+		f.hashes = f.hashes.Overlap(u.Hashes())
+		cache.Pin(u)
+	}
+	runtime.SetFinalizer(f, func(f *Fs) {
+		for _, u := range f.upstreams {
+			cache.Unpin(u)
+		}
+	})
+
+	// Note: the features here are ones we could support, and they are
+	// ANDed with the ones from all the upstreams.
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            true,
+		WriteMimeType:           true,
+		BucketBased:             true,
+		CanHaveEmptyDirectories: true,
+		SlowHash:                true,
+	}).Fill(ctx, f)
+	for _, u := range f.upstreams {
+		f.features = f.features.Mask(ctx, u)
+	}
+	f.features.Overlay = true
+
+	if isFile {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// forEach calls fn for each upstream concurrently and returns the
+// errors it returns
+func (f *Fs) forEach(fn func(i int, u fs.Fs) error) []error {
+	errs := make([]error, len(f.upstreams))
+	var wg sync.WaitGroup
+	for i, u := range f.upstreams {
+		wg.Go(func() {
+			errs[i] = fn(i, u)
+		})
+	}
+	wg.Wait()
+	return errs
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// Upstreams which fail to list are skipped as long as at least one
+// of them can be listed.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	listings := make([]fs.DirEntries, len(f.upstreams))
+	errs := f.forEach(func(i int, u fs.Fs) (err error) {
+		listings[i], err = u.List(ctx, dir)
+		return err
+	})
+	var failed, notFound int
+	for i, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, fs.ErrorDirNotFound):
+			notFound++
+		default:
+			fs.Errorf(f, "Failed to list %q on upstream %v: %v", dir, f.upstreams[i], err)
+			f.health[i].failure(err)
+			failed++
+		}
+	}
+	if failed == len(f.upstreams) {
+		return nil, fmt.Errorf("failed to list %q on all upstreams: %w", dir, errors.Join(errs...))
+	}
+	if notFound+failed == len(f.upstreams) {
+		if failed > 0 {
+			return nil, errors.Join(errs...)
+		}
+		return nil, fs.ErrorDirNotFound
+	}
+	objects := make(map[string]*Object)
+	dirs := make(map[string]bool)
+	for i, listing := range listings {
+		for _, entry := range listing {
+			switch x := entry.(type) {
+			case fs.Object:
+				o := objects[x.Remote()]
+				if o == nil {
+					o = f.newObject(x.Remote())
+					objects[x.Remote()] = o
+					entries = append(entries, o)
+				}
+				o.replicas[i] = x
+			case fs.Directory:
+				if !dirs[x.Remote()] {
+					dirs[x.Remote()] = true
+					entries = append(entries, fs.NewDir(x.Remote(), x.ModTime(ctx)))
+				}
+			default:
+				return nil, fmt.Errorf("unknown object type %T", entry)
+			}
+		}
+	}
+	for remote := range objects {
+		if dirs[remote] {
+			fs.Logf(f, "%q is a file on some upstreams and a directory on others", remote)
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	o := f.newObject(remote)
+	errs := f.forEach(func(i int, u fs.Fs) (err error) {
+		o.replicas[i], err = u.NewObject(ctx, remote)
+		return err
+	})
+	found := false
+	var firstErr error
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			found = true
+		case errors.Is(err, fs.ErrorObjectNotFound):
+		default:
+			if !errors.Is(err, fs.ErrorIsDir) {
+				fs.Errorf(remote, "Failed to find file on upstream %v: %v", f.upstreams[i], err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if found {
+		return o, nil
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// newObject makes an Object for remote with no replicas
+func (f *Fs) newObject(remote string) *Object {
+	return &Object{
+		f:        f,
+		remote:   remote,
+		replicas: make([]fs.Object, len(f.upstreams)),
+	}
+}
+
+// multiReader returns n readers which each read all of in
+//
+// The readers must be read concurrently and each must be read to the
+// end or closed, otherwise reading stops for all of them. The error
+// from reading in is returned on the channel when it is finished.
+func multiReader(n int, in io.Reader) ([]*io.PipeReader, <-chan error) {
+	readers := make([]*io.PipeReader, n)
+	pipeWriters := make([]*io.PipeWriter, n)
+	writers := make([]io.Writer, n)
+	errChan := make(chan error, 1)
+	for i := range writers {
+		r, w := io.Pipe()
+		readers[i], pipeWriters[i], writers[i] = r, w, bufio.NewWriter(w)
+	}
+	go func() {
+		_, err := io.Copy(io.MultiWriter(writers...), in)
+		for _, bw := range writers {
+			if flushErr := bw.(*bufio.Writer).Flush(); err == nil {
+				err = flushErr
+			}
+		}
+		for _, pw := range pipeWriters {
+			_ = pw.CloseWithError(err)
+		}
+		errChan <- err
+	}()
+	return readers, errChan
+}
+
+// upload writes in to every upstream, updating the existing replicas
+// of o and creating the missing ones.
+//
+// The replicas which were written are stored in o even if others fail.
+func (o *Object) upload(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bool, options ...fs.OpenOption) error {
+	f := o.f
+	readers, errChan := multiReader(len(f.upstreams), in)
+	errs := f.forEach(func(i int, u fs.Fs) (err error) {
+		replica := o.replicas[i]
+		if replica != nil {
+			err = replica.Update(ctx, readers[i], src, options...)
+		} else if stream {
+			replica, err = u.Features().PutStream(ctx, readers[i], src, options...)
+		} else {
+			replica, err = u.Put(ctx, readers[i], src, options...)
+		}
+		// Drain the input to allow the other uploads to continue
+		// whether or not this one read all of it
+		unread, _ := io.Copy(io.Discard, readers[i])
+		_ = readers[i].Close()
+		if err != nil {
+			return fmt.Errorf("failed to write to %v: %w", u, err)
+		}
+		o.replicas[i] = replica
+		if unread > 0 {
+			return fmt.Errorf("failed to write to %v: upload finished with %d bytes unread", u, unread)
+		}
+		return nil
+	})
+	if err := <-errChan; err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// put uploads in to all the upstreams
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bool, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.NewObject(ctx, src.Remote())
+	switch {
+	case err == nil:
+		return o, o.(*Object).upload(ctx, in, src, stream, options...)
+	case errors.Is(err, fs.ErrorObjectNotFound):
+		o := f.newObject(src.Remote())
+		if err := o.upload(ctx, in, src, stream, options...); err != nil {
+			if o.main() != nil {
+				return o, err
+			}
+			return nil, err
+		}
+		return o, nil
+	default:
+		return nil, err
+	}
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// The file is written to all the upstreams and an error is returned
+// if any of them fail.
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, false, options...)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, true, options...)
+}
+
+// Hashes returns the hashes supported by all the upstreams
+func (f *Fs) Hashes() hash.Set {
+	return f.hashes
+}
+
+// Mkdir makes the directory (container, bucket)
+//
+// Shouldn't return an error if it already exists
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return errors.Join(f.forEach(func(i int, u fs.Fs) error {
+		return u.Mkdir(ctx, dir)
+	})...)
+}
+
+// doDirs calls fn on each upstream, returning ErrorDirNotFound only
+// if the directory wasn't found on any of them
+func (f *Fs) doDirs(fn func(i int, u fs.Fs) error) error {
+	errs := f.forEach(fn)
+	notFound := 0
+	for i, err := range errs {
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			notFound++
+			errs[i] = nil
+		}
+	}
+	if notFound == len(f.upstreams) {
+		return fs.ErrorDirNotFound
+	}
+	return errors.Join(errs...)
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return f.doDirs(func(i int, u fs.Fs) error {
+		return u.Rmdir(ctx, dir)
+	})
+}
+
+// Purge all files in the directory
+//
+// Implement this if you have a way of deleting all the files
+// quicker than just running Remove() on the result of List()
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	return f.doDirs(func(i int, u fs.Fs) error {
+		return u.Features().Purge(ctx, dir)
+	})
+}
+
+type copyMoveFn func(context.Context, fs.Object, string) (fs.Object, error)
+
+// copyOrMove copies or moves all the replicas of src to remote using
+// the server-side operation returned by do on each upstream.
+//
+// If this fails part of the way through then the replicas already
+// copied are removed or the replicas already moved are moved back.
+func (f *Fs) copyOrMove(ctx context.Context, src fs.Object, remote string, do func(u fs.Fs) copyMoveFn, opName string, cantErr error) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't %s - not same remote type", opName)
+		return nil, cantErr
+	}
+	if srcObj.f.name != f.name || len(srcObj.replicas) != len(f.upstreams) {
+		fs.Debugf(src, "Can't %s - not same mirror remote", opName)
+		return nil, cantErr
+	}
+	if slices.Contains(srcObj.replicas, nil) {
+		fs.Debugf(src, "Can't %s - replicas are missing", opName)
+		return nil, cantErr
+	}
+	o := f.newObject(remote)
+	errs := f.forEach(func(i int, u fs.Fs) (err error) {
+		o.replicas[i], err = do(u)(ctx, srcObj.replicas[i], remote)
+		return err
+	})
+	if err := errors.Join(errs...); err != nil {
+		// Undo the replicas which succeeded
+		for i, replica := range o.replicas {
+			if replica == nil {
+				continue
+			}
+			var undoErr error
+			if opName == "move" {
+				_, undoErr = do(srcObj.f.upstreams[i])(ctx, replica, srcObj.replicas[i].Remote())
+			} else {
+				undoErr = replica.Remove(ctx)
+			}
+			if undoErr != nil {
+				fs.Errorf(replica, "Failed to undo %s on %v: %v", opName, f.upstreams[i], undoErr)
+			}
+		}
+		return nil, err
+	}
+	return o, nil
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	return f.copyOrMove(ctx, src, remote, func(u fs.Fs) copyMoveFn {
+		return u.Features().Copy
+	}, "copy", fs.ErrorCantCopy)
+}
+
+// Move src to this remote using server-side move operations.
+//
+// This is stored with the remote path given.
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	return f.copyOrMove(ctx, src, remote, func(u fs.Fs) copyMoveFn {
+		return u.Features().Move
+	}, "move", fs.ErrorCantMove)
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok || srcFs.name != f.name || len(srcFs.upstreams) != len(f.upstreams) {
+		fs.Debugf(srcFs, "Can't move directory - not same mirror remote")
+		return fs.ErrorCantDirMove
+	}
+	// Move the directory on each upstream in turn so it can be moved
+	// back if one of them fails.
+	for i, u := range f.upstreams {
+		err := u.Features().DirMove(ctx, srcFs.upstreams[i], srcRemote, dstRemote)
+		if errors.Is(err, fs.ErrorDirNotFound) && i > 0 {
+			// the directory may only exist on some upstreams
+			continue
+		}
+		if err != nil {
+			for j := range i {
+				undoErr := srcFs.upstreams[j].Features().DirMove(ctx, f.upstreams[j], dstRemote, srcRemote)
+				if undoErr != nil && !errors.Is(undoErr, fs.ErrorDirNotFound) {
+					fs.Errorf(f.upstreams[j], "Failed to move directory %q back: %v", dstRemote, undoErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// About gets quota information from the Fs
+//
+// As every file is stored on all the upstreams this returns the
+// smallest total and free space of the upstreams.
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	usages := make([]*fs.Usage, len(f.upstreams))
+	errs := f.forEach(func(i int, u fs.Fs) (err error) {
+		usages[i], err = u.Features().About(ctx)
+		return err
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	usage := &fs.Usage{}
+	for _, u := range usages {
+		usage.Total = minUsage(usage.Total, u.Total)
+		usage.Free = minUsage(usage.Free, u.Free)
+		usage.Used = maxUsage(usage.Used, u.Used)
+		usage.Objects = maxUsage(usage.Objects, u.Objects)
+	}
+	return usage, nil
+}
+
+// minUsage returns the smaller of two optional usage values
+func minUsage(a, b *int64) *int64 {
+	if a == nil || (b != nil && *b < *a) {
+		return b
+	}
+	return a
+}
+
+// maxUsage returns the larger of two optional usage values
+func maxUsage(a, b *int64) *int64 {
+	if a == nil || (b != nil && *b > *a) {
+		return b
+	}
+	return a
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	return errors.Join(f.forEach(func(i int, u fs.Fs) error {
+		if do := u.Features().Shutdown; do != nil {
+			return do(ctx)
+		}
+		return nil
+	})...)
+}
+
+// WrapFs returns the Fs that is wrapping this Fs
+func (f *Fs) WrapFs() fs.Fs {
+	return f.wrapper
+}
+
+// SetWrapper sets the Fs that is wrapping this Fs
+func (f *Fs) SetWrapper(wrapper fs.Fs) {
+	f.wrapper = wrapper
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("Mirror '%s:%s'", f.name, f.root)
+}
+
+// Precision returns the precision of this Fs
+//
+// This is the coarsest precision of the upstreams.
+func (f *Fs) Precision() time.Duration {
+	precision := time.Duration(0)
+	for _, u := range f.upstreams {
+		precision = max(precision, u.Precision())
+	}
+	return precision
+}
+
+// Object represents a file with a replica on each upstream
+type Object struct {
+	f        *Fs
+	remote   string
+	replicas []fs.Object // replica i on upstream i, nil if missing
+}
+
+// main returns the replica which describes the object - this is the
+// first replica present
+func (o *Object) main() fs.Object {
+	for _, replica := range o.replicas {
+		if replica != nil {
+			return replica
+		}
+	}
+	return nil
+}
+
+// readOrder returns the indexes of the replicas to read from in the
+// order to try them.
+//
+// Only replicas the same size as the main replica are used. Healthy
+// upstreams come first, quickest first, then the ones which have
+// failed recently in case they have recovered.
+func (o *Object) readOrder() []int {
+	type candidate struct {
+		i       int
+		healthy bool
+		latency time.Duration
+	}
+	main := o.main()
+	if main == nil {
+		return nil
+	}
+	backoff := time.Duration(o.f.opt.FailureBackoff)
+	var candidates []candidate
+	for i, replica := range o.replicas {
+		if replica == nil || replica.Size() != main.Size() {
+			continue
+		}
+		healthy, latency := o.f.health[i].state(backoff)
+		candidates = append(candidates, candidate{i: i, healthy: healthy, latency: latency})
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		if a.healthy != b.healthy {
+			if a.healthy {
+				return -1
+			}
+			return 1
+		}
+		return int(a.latency - b.latency)
+	})
+	order := make([]int, len(candidates))
+	for i, c := range candidates {
+		order[i] = c.i
+	}
+	return order
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// String returns a description of the Object
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	if main := o.main(); main != nil {
+		return main.Size()
+	}
+	return -1
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	if main := o.main(); main != nil {
+		return main.ModTime(ctx)
+	}
+	return time.Now()
+}
+
+// SetModTime sets the modification time of all the replicas
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	var errs []error
+	for _, replica := range o.replicas {
+		if replica != nil {
+			errs = append(errs, replica.SetModTime(ctx, modTime))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Storable returns whether object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Hash returns the selected checksum of the file
+// If no checksum is available it returns ""
+//
+// This is read from the replicas in read order until one succeeds.
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (sum string, err error) {
+	if !o.f.hashes.Contains(ht) {
+		return "", hash.ErrUnsupported
+	}
+	for _, i := range o.readOrder() {
+		sum, err = o.replicas[i].Hash(ctx, ht)
+		if err == nil {
+			return sum, nil
+		}
+		o.f.health[i].failure(err)
+	}
+	return "", err
+}
+
+// MimeType returns the content type of the main replica
+func (o *Object) MimeType(ctx context.Context) string {
+	if do, ok := o.main().(fs.MimeTyper); ok {
+		return do.MimeType(ctx)
+	}
+	return ""
+}
+
+// UnWrap returns the main replica
+func (o *Object) UnWrap() fs.Object {
+	return o.main()
+}
+
+// Remove all the replicas
+func (o *Object) Remove(ctx context.Context) error {
+	var errs []error
+	for _, replica := range o.replicas {
+		if replica == nil {
+			continue
+		}
+		if err := replica.Remove(ctx); err != nil && !errors.Is(err, fs.ErrorObjectNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Update in to the object with the modTime given of the given size
+//
+// The file is written to all the upstreams and an error is returned
+// if any of them fail.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return o.upload(ctx, in, src, src.Size() < 0, options...)
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+//
+// This reads from the healthy replica which is quickest to open and
+// fails over to the others if it can't be opened or read.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	size := o.Size()
+	var openOptions []fs.OpenOption
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch opt := option.(type) {
+		case *fs.SeekOption:
+			offset = opt.Offset
+		case *fs.RangeOption:
+			offset, limit = opt.Decode(size)
+		default:
+			// pass Options on to the replica open, if appropriate
+			openOptions = append(openOptions, option)
+		}
+	}
+	if offset < 0 {
+		return nil, errors.New("invalid offset")
+	}
+	if limit < 0 || offset+limit > size {
+		limit = max(size-offset, 0)
+	}
+	r := &failoverReader{
+		ctx:     ctx,
+		o:       o,
+		options: openOptions,
+		order:   o.readOrder(),
+		size:    size,
+		offset:  offset,
+		limit:   limit,
+	}
+	if limit > 0 {
+		if err := r.open(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// failoverReader reads a range of a file from its replicas, moving
+// on to the next replica if one fails
+type failoverReader struct {
+	ctx     context.Context
+	o       *Object
+	options []fs.OpenOption
+	order   []int         // replicas still to try
+	in      io.ReadCloser // current replica, nil if none
+	current int           // index of the current replica
+	size    int64         // size of the file
+	offset  int64         // offset of the next byte to read
+	limit   int64         // bytes left to read
+}
+
+// open the next replica which works at the current offset
+func (r *failoverReader) open() (err error) {
+	err = errors.New("no replicas to read from")
+	for len(r.order) > 0 {
+		i := r.order[0]
+		r.order = r.order[1:]
+		options := r.options
+		if r.offset > 0 || r.limit < r.size {
+			options = append(slices.Clip(options), &fs.RangeOption{Start: r.offset, End: r.offset + r.limit - 1})
+		}
+		start := time.Now()
+		var in io.ReadCloser
+		in, err = r.o.replicas[i].Open(r.ctx, options...)
+		if err != nil {
+			fs.Errorf(r.o, "Failed to open replica on %v: %v", r.o.f.upstreams[i], err)
+			r.o.f.health[i].failure(err)
+			continue
+		}
+		r.o.f.health[i].success(time.Since(start))
+		r.in, r.current = in, i
+		return nil
+	}
+	return err
+}
+
+// Read bytes from the current replica failing over if necessary
+func (r *failoverReader) Read(p []byte) (n int, err error) {
+	for {
+		if r.limit <= 0 {
+			return 0, io.EOF
+		}
+		if r.in == nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if int64(len(p)) > r.limit {
+			p = p[:r.limit]
+		}
+		n, err = r.in.Read(p)
+		r.offset += int64(n)
+		r.limit -= int64(n)
+		if err == io.EOF && r.limit > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if r.ctx.Err() != nil {
+			return n, err
+		}
+		fs.Errorf(r.o, "Failed to read replica on %v - failing over: %v", r.o.f.upstreams[r.current], err)
+		r.o.f.health[r.current].failure(err)
+		_ = r.in.Close()
+		r.in = nil
+		if openErr := r.open(); openErr != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close the reader
+func (r *failoverReader) Close() error {
+	if r.in != nil {
+		err := r.in.Close()
+		r.in = nil
+		return err
+	}
+	return nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.Wrapper         = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.Object          = (*Object)(nil)
+	_ fs.MimeTyper       = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
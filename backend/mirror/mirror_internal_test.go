@@ -0,0 +1,223 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFs makes an Fs mirroring 3 local directories, returning it
+// and the directories
+func newTestFs(ctx context.Context, t *testing.T) (*Fs, []string) {
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	var upstreams fs.SpaceSepList
+	upstreams = append(upstreams, dirs...)
+	fsys, err := NewFs(ctx, "TestMirrorInternal", "", configmap.Simple{
+		"upstreams":       upstreams.String(),
+		"failure_backoff": "1m",
+	})
+	require.NoError(t, err)
+	return fsys.(*Fs), dirs
+}
+
+func put(ctx context.Context, t *testing.T, f *Fs, remote string, data string) fs.Object {
+	src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06.499999999Z"), int64(len(data)), true, nil, nil)
+	o, err := f.Put(ctx, bytes.NewBufferString(data), src)
+	require.NoError(t, err)
+	return o
+}
+
+func read(ctx context.Context, t *testing.T, f *Fs, remote string, options ...fs.OpenOption) string {
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func TestReadOrder(t *testing.T) {
+	ctx := context.Background()
+	f, _ := newTestFs(ctx, t)
+	o := put(ctx, t, f, "file", "hello").(*Object)
+	assert.Equal(t, []int{0, 1, 2}, o.readOrder())
+
+	// Quickest first
+	f.health[0].success(30 * time.Millisecond)
+	f.health[1].success(20 * time.Millisecond)
+	f.health[2].success(10 * time.Millisecond)
+	assert.Equal(t, []int{2, 1, 0}, o.readOrder())
+
+	// Failed upstreams last until the backoff is over
+	f.health[2].failure(errors.New("boom"))
+	assert.Equal(t, []int{1, 0, 2}, o.readOrder())
+	f.opt.FailureBackoff = 0
+	assert.Equal(t, []int{2, 1, 0}, o.readOrder())
+
+	// Replicas of a different size aren't used
+	o.replicas[1] = object.NewMemoryObject("file", time.Now(), []byte("x"))
+	assert.Equal(t, []int{2, 0}, o.readOrder())
+}
+
+// errorReader is a ReadCloser which fails after n bytes
+type errorReader struct {
+	in io.ReadCloser
+	n  int
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errors.New("read failed")
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.in.Read(p)
+	r.n -= n
+	return n, err
+}
+
+func (r *errorReader) Close() error {
+	return r.in.Close()
+}
+
+// failingObject is an fs.Object whose reads fail after n bytes
+type failingObject struct {
+	fs.Object
+	n int
+}
+
+func (o *failingObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	in, err := o.Object.Open(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &errorReader{in: in, n: o.n}, nil
+}
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(ctx, t)
+	data := "0123456789abcdefghijklmnopqrstuvwxyz"
+	put(ctx, t, f, "file", data)
+
+	// Missing from the first upstream
+	require.NoError(t, os.Remove(filepath.Join(dirs[0], "file")))
+	assert.Equal(t, data, read(ctx, t, f, "file"))
+	assert.Equal(t, data[10:20], read(ctx, t, f, "file", &fs.RangeOption{Start: 10, End: 19}))
+
+	// Failing part of the way through
+	oi, err := f.NewObject(ctx, "file")
+	require.NoError(t, err)
+	o := oi.(*Object)
+	for i, replica := range o.replicas {
+		if replica != nil {
+			o.replicas[i] = &failingObject{Object: replica, n: 5}
+		}
+	}
+	o.replicas[2].(*failingObject).n = 100
+	// Make replica 1 the first choice
+	f.health[1].success(time.Millisecond)
+	f.health[2].success(time.Second)
+	in, err := o.Open(ctx, &fs.SeekOption{Offset: 3})
+	require.NoError(t, err)
+	got, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, data[3:], string(got))
+	healthy, _ := f.health[1].state(time.Minute)
+	assert.False(t, healthy)
+	healthy, _ = f.health[2].state(time.Minute)
+	assert.True(t, healthy)
+}
+
+// shortPutFs is an Fs whose Put returns successfully after reading
+// only the first few bytes of the input
+type shortPutFs struct {
+	fs.Fs
+}
+
+func (f *shortPutFs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	buf := make([]byte, 10)
+	n, err := io.ReadFull(in, buf)
+	if err != nil {
+		return nil, err
+	}
+	return object.NewMemoryObject(src.Remote(), src.ModTime(ctx), buf[:n]), nil
+}
+
+func TestUploadShortRead(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(ctx, t)
+	f.upstreams[1] = &shortPutFs{Fs: f.upstreams[1]}
+
+	// The upload must be bigger than the buffers so it would block
+	// if the short upload wasn't drained
+	data := bytes.Repeat([]byte("potato"), 1024*1024)
+	src := object.NewStaticObjectInfo("file", time.Now(), int64(len(data)), true, nil, nil)
+	_, err := f.Put(ctx, bytes.NewReader(data), src)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bytes unread")
+
+	for _, i := range []int{0, 2} {
+		got, err := os.ReadFile(filepath.Join(dirs[i], "file"))
+		require.NoError(t, err)
+		assert.Equal(t, data, got)
+	}
+}
+
+func TestCheckAndRepair(t *testing.T) {
+	ctx := context.Background()
+	f, dirs := newTestFs(ctx, t)
+	put(ctx, t, f, "same", "same")
+	put(ctx, t, f, "dir/changed", "original")
+	put(ctx, t, f, "missing", "missing")
+
+	// Make the replicas diverge
+	require.NoError(t, os.WriteFile(filepath.Join(dirs[1], "dir", "changed"), []byte("changed!"), 0666))
+	newer := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dirs[1], "dir", "changed"), newer, newer))
+	require.NoError(t, os.Remove(filepath.Join(dirs[0], "missing")))
+	require.NoError(t, os.WriteFile(filepath.Join(dirs[2], "extra"), []byte("extra"), 0666))
+
+	out, err := f.Command(ctx, "check", nil, nil)
+	require.NoError(t, err)
+	report := out.(*checkReport)
+	assert.Equal(t, 3, report.Divergent)
+	require.Len(t, report.Replicas, 2)
+	assert.Equal(t, []string{"dir/changed"}, report.Replicas[0].Differ)
+	assert.Equal(t, []string{"missing"}, report.Replicas[0].Extra)
+	assert.Equal(t, []string{"extra", "missing"}, report.Replicas[1].Extra)
+
+	out, err = f.Command(ctx, "repair", nil, nil)
+	require.NoError(t, err)
+	repaired := out.(*repairReport)
+	assert.Equal(t, []string{"dir/changed", "extra", "missing"}, repaired.Repaired)
+
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, "dir", "changed"))
+		require.NoError(t, err)
+		assert.Equal(t, "changed!", string(data))
+		assert.FileExists(t, filepath.Join(dir, "missing"))
+		assert.FileExists(t, filepath.Join(dir, "extra"))
+	}
+
+	out, err = f.Command(ctx, "check", nil, map[string]string{"download": "true"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, out.(*checkReport).Divergent)
+}
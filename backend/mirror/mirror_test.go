@@ -0,0 +1,63 @@
+// Test the Mirror filesystem interface
+package mirror_test
+
+import (
+	"strings"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/all" // for integration tests
+	"github.com/rclone/rclone/backend/mirror"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/fstest/fstests"
+)
+
+// TestIntegration runs integration tests against a concrete remote
+// set by the -remote flag. If the flag is not set, it creates a
+// dynamic mirror overlay over two local temporary directories.
+func TestIntegration(t *testing.T) {
+	opt := fstests.Opt{
+		RemoteName: *fstest.RemoteName,
+		NilObject:  (*mirror.Object)(nil),
+		UnimplementableObjectMethods: []string{
+			"GetTier",
+			"SetTier",
+			"Metadata",
+			"SetMetadata",
+			"ID",
+		},
+		UnimplementableFsMethods: []string{
+			"PublicLink",
+			"OpenWriterAt",
+			"OpenChunkWriter",
+			"MergeDirs",
+			"DirCacheFlush",
+			"UserInfo",
+			"Disconnect",
+			"ListP",
+			"ListR",
+			"HardLink",
+			"PutUnchecked",
+			"ChangeNotify",
+			"DirSetModTime",
+			"MkdirMetadata",
+			"CleanUp",
+			"UnWrap",
+		},
+		UnimplementableDirectoryMethods: []string{
+			"Metadata",
+			"SetMetadata",
+			"SetModTime",
+		},
+	}
+	if *fstest.RemoteName == "" {
+		name := "TestMirror"
+		opt.RemoteName = name + ":"
+		upstreams := []string{t.TempDir(), t.TempDir()}
+		opt.ExtraConfig = []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "mirror"},
+			{Name: name, Key: "upstreams", Value: strings.Join(upstreams, " ")},
+		}
+		opt.QuickTestOK = true
+	}
+	fstests.Run(t, &opt)
+}
@@ -4418,6 +4418,7 @@ type s3ChunkWriter struct {
 	md5s                 []byte
 	ui                   uploadInfo
 	o                    *Object
+	resumedChunks        []int // chunks already uploaded if resuming
 }
 
 // OpenChunkWriter returns the chunk size and a ChunkWriter
@@ -4462,29 +4463,12 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 		chunkSize = chunksize.Calculator(src, size, uploadParts, chunkSize)
 	}
 
-	var mOut *s3.CreateMultipartUploadOutput
-	err = f.pacer.Call(func() (bool, error) {
-		mOut, err = f.c.CreateMultipartUpload(ctx, &mReq)
-		if err == nil {
-			if mOut == nil {
-				err = fserrors.RetryErrorf("internal error: no info from multipart upload")
-			} else if mOut.UploadId == nil {
-				err = fserrors.RetryErrorf("internal error: no UploadId in multipart upload: %#v", *mOut)
-			}
-		}
-		return f.shouldRetry(ctx, err)
-	})
-	if err != nil {
-		return info, nil, fmt.Errorf("create multipart upload failed: %w", err)
-	}
-
 	chunkWriter := &s3ChunkWriter{
 		chunkSize:            int64(chunkSize),
 		size:                 size,
 		f:                    f,
 		bucket:               ui.req.Bucket,
 		key:                  ui.req.Key,
-		uploadID:             mOut.UploadId,
 		multiPartUploadInput: &mReq,
 		completedParts:       make([]types.CompletedPart, 0),
 		ui:                   ui,
@@ -4495,10 +4479,116 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 		Concurrency:       o.fs.opt.UploadConcurrency,
 		LeavePartsOnError: o.fs.opt.LeavePartsOnError,
 	}
+
+	// Carry on with a previous multipart upload if requested
+	for _, option := range options {
+		if x, ok := option.(*fs.ChunkWriterResumeOption); ok && x.Token != "" {
+			err = chunkWriter.resume(ctx, x.Token)
+			if err == nil {
+				fs.Debugf(o, "open chunk writer: resumed multipart upload: %v with %d parts", x.Token, len(chunkWriter.resumedChunks))
+				return info, chunkWriter, nil
+			}
+			fs.Debugf(o, "open chunk writer: failed to resume multipart upload %v - starting a new one: %v", x.Token, err)
+		}
+	}
+
+	var mOut *s3.CreateMultipartUploadOutput
+	err = f.pacer.Call(func() (bool, error) {
+		mOut, err = f.c.CreateMultipartUpload(ctx, &mReq)
+		if err == nil {
+			if mOut == nil {
+				err = fserrors.RetryErrorf("internal error: no info from multipart upload")
+			} else if mOut.UploadId == nil {
+				err = fserrors.RetryErrorf("internal error: no UploadId in multipart upload: %#v", *mOut)
+			}
+		}
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		return info, nil, fmt.Errorf("create multipart upload failed: %w", err)
+	}
+	chunkWriter.uploadID = mOut.UploadId
+
 	fs.Debugf(o, "open chunk writer: started multipart upload: %v", *mOut.UploadId)
 	return info, chunkWriter, err
 }
 
+// resume carries on with the multipart upload uploadID reading the
+// parts which have already been uploaded from the server.
+//
+// Only parts which are the expected size are kept.
+func (w *s3ChunkWriter) resume(ctx context.Context, uploadID string) (err error) {
+	defer func() {
+		if err != nil {
+			w.md5s = nil
+		}
+	}()
+	req := s3.ListPartsInput{
+		Bucket:               w.bucket,
+		Key:                  w.key,
+		UploadId:             &uploadID,
+		RequestPayer:         w.multiPartUploadInput.RequestPayer,
+		SSECustomerAlgorithm: w.multiPartUploadInput.SSECustomerAlgorithm,
+		SSECustomerKey:       w.multiPartUploadInput.SSECustomerKey,
+		SSECustomerKeyMD5:    w.multiPartUploadInput.SSECustomerKeyMD5,
+	}
+	var completedParts []types.CompletedPart
+	var resumedChunks []int
+	for {
+		var resp *s3.ListPartsOutput
+		err = w.f.pacer.Call(func() (bool, error) {
+			resp, err = w.f.c.ListParts(ctx, &req)
+			return w.f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list parts of multipart upload: %w", err)
+		}
+		for _, part := range resp.Parts {
+			if part.PartNumber == nil || part.ETag == nil || part.Size == nil {
+				continue
+			}
+			chunkNumber := int(*part.PartNumber) - 1
+			wantSize := w.chunkSize
+			if w.size >= 0 && w.size-int64(chunkNumber)*w.chunkSize < wantSize {
+				wantSize = w.size - int64(chunkNumber)*w.chunkSize
+			}
+			if *part.Size != wantSize {
+				fs.Debugf(w.o, "multipart upload ignoring part %d with size %d, expecting %d", chunkNumber+1, *part.Size, wantSize)
+				continue
+			}
+			// The ETag is the MD5 of the part unless encryption is in use
+			if md5binary, err := hex.DecodeString(strings.Trim(*part.ETag, `"`)); err == nil && len(md5binary) == md5.Size {
+				w.addMd5(&md5binary, int64(chunkNumber))
+			}
+			completedParts = append(completedParts, types.CompletedPart{
+				PartNumber: part.PartNumber,
+				ETag:       part.ETag,
+			})
+			resumedChunks = append(resumedChunks, chunkNumber)
+		}
+		if !deref(resp.IsTruncated) || resp.NextPartNumberMarker == nil {
+			break
+		}
+		req.PartNumberMarker = resp.NextPartNumberMarker
+	}
+	w.uploadID = &uploadID
+	w.completedParts = completedParts
+	w.resumedChunks = resumedChunks
+	return nil
+}
+
+// ResumeToken returns the ID of the multipart upload which can be
+// used to resume it
+func (w *s3ChunkWriter) ResumeToken() string {
+	return deref(w.uploadID)
+}
+
+// ResumedChunks returns the chunks which were already uploaded if
+// this carried on with a previous multipart upload
+func (w *s3ChunkWriter) ResumedChunks() []int {
+	return w.resumedChunks
+}
+
 // add a part number and etag to the completed parts
 func (w *s3ChunkWriter) addCompletedPart(partNum *int32, eTag *string) {
 	w.completedPartsMu.Lock()
@@ -5336,18 +5426,19 @@ func (o *Object) Metadata(ctx context.Context) (metadata fs.Metadata, err error)
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs              = &Fs{}
-	_ fs.Purger          = &Fs{}
-	_ fs.Copier          = &Fs{}
-	_ fs.PutStreamer     = &Fs{}
-	_ fs.ListRer         = &Fs{}
-	_ fs.ListPer         = &Fs{}
-	_ fs.Commander       = &Fs{}
-	_ fs.CleanUpper      = &Fs{}
-	_ fs.OpenChunkWriter = &Fs{}
-	_ fs.Object          = &Object{}
-	_ fs.MimeTyper       = &Object{}
-	_ fs.GetTierer       = &Object{}
-	_ fs.SetTierer       = &Object{}
-	_ fs.Metadataer      = &Object{}
+	_ fs.Fs                 = &Fs{}
+	_ fs.Purger             = &Fs{}
+	_ fs.Copier             = &Fs{}
+	_ fs.PutStreamer        = &Fs{}
+	_ fs.ListRer            = &Fs{}
+	_ fs.ListPer            = &Fs{}
+	_ fs.Commander          = &Fs{}
+	_ fs.CleanUpper         = &Fs{}
+	_ fs.OpenChunkWriter    = &Fs{}
+	_ fs.ChunkWriterResumer = &s3ChunkWriter{}
+	_ fs.Object             = &Object{}
+	_ fs.MimeTyper          = &Object{}
+	_ fs.GetTierer          = &Object{}
+	_ fs.SetTierer          = &Object{}
+	_ fs.Metadataer         = &Object{}
 )
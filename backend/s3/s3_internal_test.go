@@ -298,6 +298,9 @@ func TestRemoveAWSChunked(t *testing.T) {
 
 func (f *Fs) InternalTestVersions(t *testing.T) {
 	ctx := context.Background()
+	if f.opt.Provider == "Rclone" {
+		t.Skip("rclone serve s3 uses the modification time for LastModified so the version times don't match the upload times")
+	}
 
 	// Enable versioning for this bucket during this test
 	_, err := f.setGetVersioning(ctx, "Enabled")
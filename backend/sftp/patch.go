@@ -0,0 +1,159 @@
+//go:build !plan9
+
+package sftp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/pkg/sftp"
+	"github.com/rclone/rclone/fs"
+)
+
+// objectPatch is a file being changed in place by Patch
+type objectPatch struct {
+	o    *Object
+	c    *conn
+	file *sftp.File
+	size int64 // size to set the file to on Close
+}
+
+// WriteAt writes b at off in the file
+func (p *objectPatch) WriteAt(b []byte, off int64) (n int, err error) {
+	return p.file.WriteAt(b, off)
+}
+
+// ReadAt reads len(b) bytes from the file at off
+func (p *objectPatch) ReadAt(b []byte, off int64) (n int, err error) {
+	return p.file.ReadAt(b, off)
+}
+
+// Close the file setting it to its final size
+func (p *objectPatch) Close() error {
+	err := p.file.Truncate(p.size)
+	closeErr := p.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	// Release connection only when the patch has finished so it isn't used for anything else
+	p.o.fs.putSftpConnection(&p.c, err)
+	p.o.fs.removeSession()
+	return err
+}
+
+// Patch opens the object for changing in place with WriteAt.
+func (o *Object) Patch(ctx context.Context, size int64) (fs.WriterAtCloser, error) {
+	o.fs.addSession() // Show session in use
+	// Clear the hash cache since we are about to update the object
+	o.md5sum = nil
+	o.sha1sum = nil
+	o.crc32sum = nil
+	o.sha256sum = nil
+	o.blake3sum = nil
+	o.xxh3sum = nil
+	o.xxh128sum = nil
+	c, err := o.fs.getSftpConnection(ctx)
+	if err != nil {
+		o.fs.removeSession()
+		return nil, fmt.Errorf("Patch: %w", err)
+	}
+	// Open for reading too so blocks which have moved can be read
+	file, err := c.sftpClient.OpenFile(o.path(), os.O_RDWR)
+	if err != nil {
+		o.fs.putSftpConnection(&c, err)
+		o.fs.removeSession()
+		return nil, fmt.Errorf("Patch Open failed: %w", err)
+	}
+	return &objectPatch{
+		o:    o,
+		c:    c,
+		file: file,
+		size: size,
+	}, nil
+}
+
+// PatchCopy copies the object to remote so the copy can be changed
+// with Patch.
+//
+// The data is copied on the server with cp so this needs a unix shell.
+func (o *Object) PatchCopy(ctx context.Context, remote string) (fs.Object, error) {
+	if o.fs.shellType != "unix" {
+		return nil, fs.ErrorCantCopy
+	}
+	srcArg, err := o.fs.quoteOrEscapeShellPath(o.shellPath())
+	if err != nil {
+		return nil, fmt.Errorf("PatchCopy: %w", err)
+	}
+	dstArg, err := o.fs.quoteOrEscapeShellPath(o.fs.remoteShellPath(remote))
+	if err != nil {
+		return nil, fmt.Errorf("PatchCopy: %w", err)
+	}
+	_, err = o.fs.run(ctx, "cp -- "+srcArg+" "+dstArg)
+	if err != nil {
+		return nil, fmt.Errorf("PatchCopy: %w", err)
+	}
+	return o.fs.NewObject(ctx, remote)
+}
+
+// BlockHashes returns the MD5 hash of each blockSize block of the
+// object calculated on the remote.
+//
+// This needs a unix shell with GNU split and a working md5sum command.
+func (o *Object) BlockHashes(ctx context.Context, blockSize int64) ([][md5.Size]byte, error) {
+	_ = o.fs.Hashes()
+	hashCmd := o.fs.opt.Md5sumCommand
+	if o.fs.shellType != "unix" || hashCmd == "" || hashCmd == hashCommandNotSupported {
+		return nil, fs.ErrorNotImplemented
+	}
+	shellPathArg, err := o.fs.quoteOrEscapeShellPath(o.shellPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate block hashes: %w", err)
+	}
+	filterArg, err := o.fs.quoteOrEscapeShellPath("--filter=" + hashCmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate block hashes: %w", err)
+	}
+	outBytes, err := o.fs.run(ctx, "split -b "+strconv.FormatInt(blockSize, 10)+" "+filterArg+" -- "+shellPathArg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate block hashes: %w", err)
+	}
+	return parseBlockHashes(outBytes)
+}
+
+// parseBlockHashes parses the output of running md5sum on each block
+// of a file, one hash per line.
+func parseBlockHashes(outBytes []byte) (hashes [][md5.Size]byte, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(outBytes))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var hash [md5.Size]byte
+		hashString := parseHash(line)
+		if len(hashString) != 2*md5.Size {
+			return nil, fmt.Errorf("failed to parse block hash %q", hashString)
+		}
+		_, err := hex.Decode(hash[:], []byte(hashString))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse block hash %q: %w", hashString, err)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, scanner.Err()
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Patcher     = &Object{}
+	_ fs.BlockHasher = &Object{}
+	_ fs.PatchCopier = &Object{}
+	_ io.ReaderAt    = &objectPatch{}
+)
@@ -3,11 +3,13 @@
 package sftp
 
 import (
+	"encoding/hex"
 	"fmt"
 	"testing"
 
 	"github.com/rclone/rclone/lib/encoder"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestShellEscapeUnix(t *testing.T) {
@@ -112,6 +114,23 @@ func TestParseHash(t *testing.T) {
 	}
 }
 
+func TestParseBlockHashes(t *testing.T) {
+	hashes, err := parseBlockHashes([]byte("d41d8cd98f00b204e9800998ecf8427e  -\nD41D8CD98F00B204E9800998ECF8427F  -\n\n"))
+	require.NoError(t, err)
+	require.Len(t, hashes, 2)
+	assert.Equal(t, "d41d8cd98f00b204e9800998ecf8427e", hex.EncodeToString(hashes[0][:]))
+	assert.Equal(t, "d41d8cd98f00b204e9800998ecf8427f", hex.EncodeToString(hashes[1][:]))
+
+	hashes, err = parseBlockHashes(nil)
+	require.NoError(t, err)
+	assert.Len(t, hashes, 0)
+
+	_, err = parseBlockHashes([]byte("8dbc7733dbd10d2efc5c0a0d8dad90f958581821  -\n"))
+	assert.Error(t, err)
+	_, err = parseBlockHashes([]byte("split: unrecognized option '--filter=md5sum'\n"))
+	assert.Error(t, err)
+}
+
 func TestParseUsage(t *testing.T) {
 	for i, test := range []struct {
 		sshOutput string
@@ -27,6 +27,7 @@ type filePool struct {
 	fs    FsInterface
 	share string
 	path  string
+	flag  int // flag to open the files with
 
 	mu   sync.Mutex
 	pool []*file
@@ -38,6 +39,7 @@ func newFilePool(ctx context.Context, fs FsInterface, share, path string) *fileP
 		fs:    fs,
 		share: share,
 		path:  path,
+		flag:  os.O_WRONLY,
 	}
 }
 
@@ -56,7 +58,7 @@ func (p *filePool) get() (*file, error) {
 		return nil, err
 	}
 
-	fl, err := c.smbShare.OpenFile(p.path, os.O_WRONLY, 0o644)
+	fl, err := c.smbShare.OpenFile(p.path, p.flag, 0o644)
 	if err != nil {
 		p.fs.putConnection(&c, err)
 		return nil, fmt.Errorf("failed to open: %w", err)
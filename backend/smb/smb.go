@@ -626,6 +626,61 @@ func (f *Fs) OpenWriterAt(ctx context.Context, remote string, size int64) (fs.Wr
 	}, nil
 }
 
+// smbPatch is a file being changed in place by Patch
+type smbPatch struct {
+	*smbWriterAt
+	size int64 // size to set the file to on Close
+}
+
+// ReadAt reads len(b) bytes from the file at off
+func (p *smbPatch) ReadAt(b []byte, off int64) (n int, err error) {
+	f, err := p.pool.get()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file from pool: %w", err)
+	}
+	n, err = f.ReadAt(b, off)
+	if err == io.EOF && n == len(b) {
+		err = nil
+	}
+	p.pool.put(f, nil)
+	return n, err
+}
+
+// Close the file setting it to its final size
+func (p *smbPatch) Close() error {
+	f, err := p.pool.get()
+	if err == nil {
+		err = f.Truncate(p.size)
+		p.pool.put(f, err)
+	}
+	closeErr := p.smbWriterAt.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Patch opens the object for changing in place with WriteAt.
+func (o *Object) Patch(ctx context.Context, size int64) (fs.WriterAtCloser, error) {
+	share, filename := o.split()
+	if share == "" || filename == "" {
+		return nil, fs.ErrorIsDir
+	}
+
+	// Add a new session
+	o.fs.addSession()
+
+	// Open for reading too so blocks which have moved can be read
+	pool := newFilePool(ctx, o.fs, share, o.fs.toSambaPath(filename))
+	pool.flag = os.O_RDWR
+	return &smbPatch{
+		smbWriterAt: &smbWriterAt{
+			pool: pool,
+		},
+		size: size,
+	}, nil
+}
+
 // Shutdown the backend, closing any background tasks and any
 // cached connections.
 func (f *Fs) Shutdown(ctx context.Context) error {
@@ -963,5 +1018,7 @@ var (
 	_ fs.Abouter     = &Fs{}
 	_ fs.Shutdowner  = &Fs{}
 	_ fs.Object      = &Object{}
+	_ fs.Patcher     = &Object{}
 	_ io.ReadCloser  = &boundReadCloser{}
+	_ io.ReaderAt    = &smbPatch{}
 )
@@ -38,9 +38,11 @@ docs = [
     "box.md",
     "cache.md",
     "chunker.md",
+    "chunkstore.md",
     "cloudinary.md",
     "sharefile.md",
     "crypt.md",
+    "erasure.md",
     "compress.md",
     "combine.md",
     "doi.md",
@@ -70,6 +72,7 @@ docs = [
     "mailru.md",
     "mega.md",
     "memory.md",
+    "mirror.md",
     "netstorage.md",
     "azureblob.md",
     "azurefiles.md",
@@ -0,0 +1,126 @@
+// Package backup provides the backup command.
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/spf13/cobra"
+)
+
+var (
+	createEmptySrcDirs = false
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	commandDefinition.AddCommand(listCommand, pruneCommand)
+	cmdFlags := commandDefinition.Flags()
+	flags.BoolVarP(cmdFlags, &createEmptySrcDirs, "create-empty-src-dirs", "", createEmptySrcDirs, "Create empty source dirs in the snapshot", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "backup source:path dest:path",
+	Short: `Make a point in time snapshot of source in dest.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Copy the source into a new snapshot directory in the destination.
+
+Each snapshot is stored in a directory named after the time it was
+started in UTC, and when it is complete a manifest describing it is
+written alongside it. The destination looks like this
+
+|||
+dest:path/snapshots/2026-10-18T120000Z/...
+dest:path/manifests/2026-10-18T120000Z.json
+|||
+
+Unchanged files are taken from the most recent complete snapshot
+rather than the source. If the destination supports hard links (like
+the local backend) they are hard linked, otherwise they are server-side
+copied if possible, so each snapshot only uploads the files which
+changed. This works like [--link-dest](/docs/#link-dest-stringarray)
+and [--copy-dest](/docs/#copy-dest-stringarray), which can't be used
+with this command.
+
+A snapshot without a manifest is incomplete. If the copy fails, the
+retries (see |--retries|) carry on with the same snapshot. If it still
+fails the snapshot is left incomplete and the next backup starts a new
+one. Incomplete snapshots are removed by |rclone backup prune| once a
+later snapshot has completed.
+
+Use |rclone backup list| to see the snapshots and |rclone backup prune|
+to delete the ones which are no longer needed.
+
+Since snapshots are plain directories, restoring a file or a snapshot
+is a normal copy, for example
+
+|||
+rclone copy dest:path/snapshots/2026-10-18T120000Z /path/to/restore
+|||
+`, "|", "`"),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.75",
+		"groups":            "Copy,Filter,Listing,Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc, fdst := cmd.NewFsSrcDst(args)
+		now := time.Now()
+		cmd.Run(true, true, command, func() error {
+			_, err := createSnapshot(context.Background(), fdst, fsrc, now)
+			return err
+		})
+	},
+}
+
+var listCommand = &cobra.Command{
+	Use:   "list dest:path",
+	Short: `List the snapshots made by rclone backup.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`List the snapshots in a destination made by |rclone backup|.
+
+This shows one line per snapshot with its name, whether it is
+complete, and for complete snapshots the number of files, their total
+size and the source they were made from, for example
+
+|||
+2026-10-17T120000Z  complete    1234 files  5.678 GiB  /home/user
+2026-10-18T120000Z  incomplete
+|||
+
+This reads the manifest of every snapshot so may take a while if there
+are a lot of them.
+`, "|", "`"),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.75",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		fdst := cmd.NewFsDir(args)
+		cmd.Run(false, false, command, func() error {
+			ctx := context.Background()
+			snapshots, err := listSnapshots(ctx, fdst)
+			if err != nil {
+				return err
+			}
+			for _, s := range snapshots {
+				if !s.complete() {
+					fmt.Fprintf(os.Stdout, "%s  incomplete\n", s.ID)
+					continue
+				}
+				m, err := readManifest(ctx, s.manifest)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stdout, "%s  complete  %8d files  %9v  %s\n", s.ID, m.Files, fs.SizeSuffix(m.Bytes).ByteUnit(), m.Source)
+			}
+			return nil
+		})
+	},
+}
@@ -0,0 +1,183 @@
+package backup
+
+import (
+	"context"
+	"path"
+	"sort"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	_ "github.com/rclone/rclone/backend/memory"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = fstest.Time("2017-02-03T04:05:06.499999999Z")
+	t2 = fstest.Time("2018-05-06T07:08:09.499999999Z")
+)
+
+// TestMain drives the tests
+func TestMain(m *testing.M) {
+	fstest.TestMain(m)
+}
+
+// make snapshots at the times given
+func makeSnapshots(times ...time.Time) []*snapshot {
+	var snapshots []*snapshot
+	for _, t := range times {
+		snapshots = append(snapshots, &snapshot{ID: t.UTC().Format(idFormat), Time: t})
+	}
+	// newest first
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.After(snapshots[j].Time)
+	})
+	return snapshots
+}
+
+// return the IDs of the snapshots kept sorted newest first
+func keptIDs(snapshots []*snapshot, keep map[*snapshot][]string) (ids []string) {
+	for _, s := range snapshots {
+		if _, ok := keep[s]; ok {
+			ids = append(ids, s.Time.Format("2006-01-02 15:04"))
+		}
+	}
+	return ids
+}
+
+func TestPolicyKeep(t *testing.T) {
+	// A snapshot at 01:00 and 13:00 every day for 100 days
+	start := time.Date(2026, 1, 1, 1, 0, 0, 0, time.Local)
+	var times []time.Time
+	for day := range 100 {
+		times = append(times, start.AddDate(0, 0, day), start.AddDate(0, 0, day).Add(12*time.Hour))
+	}
+	snapshots := makeSnapshots(times...)
+
+	for _, test := range []struct {
+		name string
+		p    policy
+		want []string
+	}{{
+		name: "Empty",
+		p:    policy{},
+		want: []string{"2026-04-10 13:00"},
+	}, {
+		name: "Last",
+		p:    policy{Last: 3},
+		want: []string{"2026-04-10 13:00", "2026-04-10 01:00", "2026-04-09 13:00"},
+	}, {
+		name: "Daily",
+		p:    policy{Daily: 3},
+		want: []string{"2026-04-10 13:00", "2026-04-09 13:00", "2026-04-08 13:00"},
+	}, {
+		name: "Weekly",
+		p:    policy{Weekly: 3},
+		// 2026-04-10 is a Friday so weeks end on Sundays 04-05 and 03-29
+		want: []string{"2026-04-10 13:00", "2026-04-05 13:00", "2026-03-29 13:00"},
+	}, {
+		name: "Monthly",
+		p:    policy{Monthly: 12},
+		want: []string{"2026-04-10 13:00", "2026-03-31 13:00", "2026-02-28 13:00", "2026-01-31 13:00"},
+	}, {
+		name: "Combined",
+		p:    policy{Daily: 2, Monthly: 2},
+		want: []string{"2026-04-10 13:00", "2026-04-09 13:00", "2026-03-31 13:00"},
+	}, {
+		name: "Within",
+		p:    policy{Within: fs.Duration(24 * time.Hour)},
+		want: []string{"2026-04-10 13:00", "2026-04-10 01:00", "2026-04-09 13:00"},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			keep := test.p.keep(snapshots)
+			assert.Equal(t, test.want, keptIDs(snapshots, keep))
+		})
+	}
+}
+
+func TestBackupAndPrune(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	file2 := r.WriteFile("dir/file2", "file2 contents", t1)
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	m1, err := createSnapshot(ctx, r.Fremote, r.Flocal, now)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10-17T120000Z", m1.ID)
+	assert.Equal(t, "", m1.Parent)
+	assert.Equal(t, int64(2), m1.Files)
+	assert.Equal(t, file1.Size+file2.Size, m1.Bytes)
+	require.Len(t, m1.Entries, 2)
+	assert.Equal(t, "dir/file2", m1.Entries[0].Path)
+	assert.Equal(t, "file1", m1.Entries[1].Path)
+
+	// Can't make the same snapshot again
+	_, err = createSnapshot(ctx, r.Fremote, r.Flocal, now)
+	require.Error(t, err)
+
+	// Change a file and make another snapshot
+	file1 = r.WriteFile("file1", "file1 new contents", t2)
+	now2 := now.Add(24 * time.Hour)
+	m2, err := createSnapshot(ctx, r.Fremote, r.Flocal, now2)
+	require.NoError(t, err)
+	assert.Equal(t, m1.ID, m2.Parent)
+	assert.Equal(t, int64(2), m2.Files)
+
+	snapshotItem := func(id string, item fstest.Item) fstest.Item {
+		item.Path = path.Join(snapshotsDir, id, item.Path)
+		return item
+	}
+	oldFile1 := fstest.NewItem("file1", "file1 contents", t1)
+	fstest.CheckListingWithRoot(t, r.Fremote, snapshotsDir, []fstest.Item{
+		snapshotItem(m1.ID, oldFile1),
+		snapshotItem(m1.ID, file2),
+		snapshotItem(m2.ID, file1),
+		snapshotItem(m2.ID, file2),
+	}, nil, fs.GetModifyWindow(ctx, r.Fremote))
+
+	// Make an incomplete snapshot before and after the latest one
+	require.NoError(t, operations.Mkdir(ctx, r.Fremote, path.Join(snapshotsDir, now2.Add(-time.Hour).Format(idFormat))))
+	require.NoError(t, operations.Mkdir(ctx, r.Fremote, path.Join(snapshotsDir, now2.Add(time.Hour).Format(idFormat))))
+
+	snapshots, err := listSnapshots(ctx, r.Fremote)
+	require.NoError(t, err)
+	if r.Fremote.Features().CanHaveEmptyDirectories {
+		require.Len(t, snapshots, 4)
+	}
+
+	// Prune needs a policy
+	pruneNow := now2.Add(3 * time.Hour)
+	require.Error(t, prune(ctx, r.Fremote, &policy{}, pruneNow))
+
+	listIDs := func() (ids []string) {
+		snapshots, err = listSnapshots(ctx, r.Fremote)
+		require.NoError(t, err)
+		for _, s := range snapshots {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	// Prune all but the last snapshot keeping the incomplete
+	// snapshot which might still be running
+	require.NoError(t, prune(ctx, r.Fremote, &policy{Last: 1, IncompleteMinAge: fs.Duration(24 * time.Hour)}, pruneNow))
+	want := []string{m2.ID}
+	if r.Fremote.Features().CanHaveEmptyDirectories {
+		want = []string{now2.Add(-time.Hour).Format(idFormat), m2.ID, now2.Add(time.Hour).Format(idFormat)}
+	}
+	assert.Equal(t, want, listIDs())
+
+	// Once it is old enough it is removed
+	require.NoError(t, prune(ctx, r.Fremote, &policy{Last: 1, IncompleteMinAge: fs.Duration(time.Hour)}, pruneNow))
+	want = []string{m2.ID}
+	if r.Fremote.Features().CanHaveEmptyDirectories {
+		want = append(want, now2.Add(time.Hour).Format(idFormat))
+	}
+	assert.Equal(t, want, listIDs())
+	assert.True(t, snapshots[0].complete())
+}
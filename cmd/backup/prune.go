@@ -0,0 +1,233 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+// policy describes which snapshots to keep
+type policy struct {
+	Last    int
+	Hourly  int
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+	Within  fs.Duration
+
+	// Incomplete snapshots started more recently than this are kept
+	IncompleteMinAge fs.Duration
+}
+
+var pruneOpt = policy{
+	IncompleteMinAge: fs.Duration(24 * time.Hour),
+}
+
+func init() {
+	cmdFlags := pruneCommand.Flags()
+	flags.IntVarP(cmdFlags, &pruneOpt.Last, "keep-last", "", 0, "Keep the last N snapshots", "")
+	flags.IntVarP(cmdFlags, &pruneOpt.Hourly, "keep-hourly", "", 0, "Keep the last snapshot of each of the last N hours", "")
+	flags.IntVarP(cmdFlags, &pruneOpt.Daily, "keep-daily", "", 0, "Keep the last snapshot of each of the last N days", "")
+	flags.IntVarP(cmdFlags, &pruneOpt.Weekly, "keep-weekly", "", 0, "Keep the last snapshot of each of the last N weeks", "")
+	flags.IntVarP(cmdFlags, &pruneOpt.Monthly, "keep-monthly", "", 0, "Keep the last snapshot of each of the last N months", "")
+	flags.IntVarP(cmdFlags, &pruneOpt.Yearly, "keep-yearly", "", 0, "Keep the last snapshot of each of the last N years", "")
+	flags.FVarP(cmdFlags, &pruneOpt.Within, "keep-within", "", "Keep all snapshots made within this duration of the latest one", "")
+	flags.FVarP(cmdFlags, &pruneOpt.IncompleteMinAge, "incomplete-min-age", "", "Only remove incomplete snapshots started longer ago than this", "")
+}
+
+var pruneCommand = &cobra.Command{
+	Use:   "prune dest:path",
+	Short: `Delete snapshots made by rclone backup which are no longer needed.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Delete the snapshots made by |rclone backup| which aren't kept by
+any of the retention rules given.
+
+The rules are
+
+- |--keep-last N| keeps the N most recent snapshots.
+- |--keep-hourly N|, |--keep-daily N|, |--keep-weekly N|,
+  |--keep-monthly N| and |--keep-yearly N| keep the most recent
+  snapshot in each of the N most recent hours, days, weeks, months or
+  years which have a snapshot.
+- |--keep-within DURATION| keeps all the snapshots made within
+  DURATION of the most recent snapshot, e.g. |--keep-within 2w|.
+
+A snapshot is kept if any of the rules keep it. Days, weeks (starting
+on Monday), months and years are in the local time zone. For example
+to keep a snapshot for each of the last 7 days, 4 weeks and 12 months
+
+|||
+rclone backup prune dest:path --keep-daily 7 --keep-weekly 4 --keep-monthly 12
+|||
+
+Only complete snapshots count towards the rules. Incomplete snapshots
+are deleted if they are older than the most recent complete snapshot
+and were started longer ago than |--incomplete-min-age| (default 24h).
+Other incomplete snapshots are left alone as they may belong to a
+backup which is still running, possibly in another process, so set
+|--incomplete-min-age| to longer than the longest backup takes.
+
+The most recent complete snapshot is always kept, and at least one
+rule must be given, so prune can never delete all the snapshots.
+
+The manifest of a snapshot is deleted before its files, so if prune
+is interrupted the remains of the snapshot become an incomplete
+snapshot which the next prune removes.
+
+**Important**: Since this can cause data loss, test first with the
+|--dry-run| or the |--interactive|/|-i| flag.
+`, "|", "`"),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.75",
+		"groups":            "Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		fdst := cmd.NewFsDir(args)
+		cmd.Run(true, false, command, func() error {
+			return prune(context.Background(), fdst, &pruneOpt, time.Now())
+		})
+	},
+}
+
+// isEmpty returns true if no rules are set
+func (p *policy) isEmpty() bool {
+	return p.Last <= 0 && p.Hourly <= 0 && p.Daily <= 0 && p.Weekly <= 0 && p.Monthly <= 0 && p.Yearly <= 0 && p.Within <= 0
+}
+
+// keepBuckets keeps the newest snapshot in each of the n newest
+// buckets, adding reason to keep for each snapshot kept.
+//
+// snapshots must be sorted newest first.
+func keepBuckets(snapshots []*snapshot, keep map[*snapshot][]string, n int, reason string, bucket func(t time.Time) string) {
+	last := ""
+	for _, s := range snapshots {
+		if n <= 0 {
+			return
+		}
+		b := bucket(s.Time.Local())
+		if b == last {
+			continue
+		}
+		last = b
+		keep[s] = append(keep[s], reason)
+		n--
+	}
+}
+
+// keep returns the snapshots the policy keeps with the reasons why
+//
+// snapshots must be complete and sorted newest first.
+func (p *policy) keep(snapshots []*snapshot) map[*snapshot][]string {
+	keep := map[*snapshot][]string{}
+	if len(snapshots) == 0 {
+		return keep
+	}
+	keep[snapshots[0]] = append(keep[snapshots[0]], "latest")
+	keepBuckets(snapshots, keep, p.Last, "last", func(t time.Time) string {
+		return t.Format(time.RFC3339Nano)
+	})
+	keepBuckets(snapshots, keep, p.Hourly, "hourly", func(t time.Time) string {
+		return t.Format("2006-01-02 15")
+	})
+	keepBuckets(snapshots, keep, p.Daily, "daily", func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	keepBuckets(snapshots, keep, p.Weekly, "weekly", func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	})
+	keepBuckets(snapshots, keep, p.Monthly, "monthly", func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+	keepBuckets(snapshots, keep, p.Yearly, "yearly", func(t time.Time) string {
+		return t.Format("2006")
+	})
+	if p.Within > 0 {
+		cutoff := snapshots[0].Time.Add(-time.Duration(p.Within))
+		for _, s := range snapshots {
+			if s.Time.Before(cutoff) {
+				break
+			}
+			keep[s] = append(keep[s], "within")
+		}
+	}
+	return keep
+}
+
+// removeSnapshot deletes the manifest then the files of s
+func removeSnapshot(ctx context.Context, f fs.Fs, s *snapshot) error {
+	if s.manifest != nil {
+		if err := operations.DeleteFile(ctx, s.manifest); err != nil {
+			return fmt.Errorf("failed to delete manifest of snapshot %q: %w", s.ID, err)
+		}
+	}
+	if s.hasDir {
+		if err := operations.Purge(ctx, f, path.Join(snapshotsDir, s.ID)); err != nil {
+			return fmt.Errorf("failed to delete snapshot %q: %w", s.ID, err)
+		}
+	}
+	return nil
+}
+
+// prune deletes the snapshots in f which p doesn't keep
+//
+// now is used to work out the age of incomplete snapshots.
+func prune(ctx context.Context, f fs.Fs, p *policy, now time.Time) error {
+	if p.isEmpty() {
+		return errors.New("no retention rules given - use one or more of the --keep-* flags")
+	}
+	snapshots, err := listSnapshots(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	// Find the complete snapshots newest first
+	var complete []*snapshot
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if snapshots[i].complete() {
+			complete = append(complete, snapshots[i])
+		}
+	}
+	if len(complete) == 0 {
+		fs.Logf(f, "No complete snapshots found so not pruning")
+		return nil
+	}
+	latest := complete[0]
+	keep := p.keep(complete)
+
+	var errCount int
+	for _, s := range snapshots {
+		if reasons, ok := keep[s]; ok {
+			fs.Infof(f, "Keeping snapshot %q (%s)", s.ID, strings.Join(reasons, ", "))
+			continue
+		}
+		if !s.complete() {
+			if !s.Time.Before(latest.Time) || now.Sub(s.Time) < time.Duration(p.IncompleteMinAge) {
+				fs.Infof(f, "Keeping incomplete snapshot %q as it may still be running", s.ID)
+				continue
+			}
+			fs.Infof(f, "Removing incomplete snapshot %q", s.ID)
+		} else {
+			fs.Infof(f, "Removing snapshot %q", s.ID)
+		}
+		if err = removeSnapshot(ctx, f, s); err != nil {
+			fs.Errorf(f, "%v", err)
+			errCount++
+		}
+	}
+	if errCount > 0 {
+		return fmt.Errorf("failed to remove %d snapshots", errCount)
+	}
+	return nil
+}
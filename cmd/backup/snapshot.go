@@ -0,0 +1,260 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	fssync "github.com/rclone/rclone/fs/sync"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+const (
+	snapshotsDir    = "snapshots"          // directory in dest the snapshots are stored in
+	manifestsDir    = "manifests"          // directory in dest the manifests are stored in
+	manifestExt     = ".json"              // extension of manifests
+	idFormat        = "2006-01-02T150405Z" // snapshots are named with this time format in UTC
+	manifestVersion = 1                    // version of the manifest format
+)
+
+// manifest describes a complete snapshot
+type manifest struct {
+	Version   int             `json:"version"`
+	ID        string          `json:"id"`
+	Source    string          `json:"source"`
+	Parent    string          `json:"parent,omitempty"` // snapshot unchanged files were taken from
+	Started   time.Time       `json:"started"`
+	Completed time.Time       `json:"completed"`
+	Files     int64           `json:"files"`
+	Bytes     int64           `json:"bytes"`
+	HashType  string          `json:"hash_type,omitempty"`
+	Entries   []manifestEntry `json:"entries"`
+}
+
+// manifestEntry describes a file in a snapshot
+type manifestEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"hash,omitempty"`
+}
+
+// snapshot describes a snapshot found in dest
+type snapshot struct {
+	ID       string
+	Time     time.Time
+	hasDir   bool      // set if the snapshot directory exists
+	manifest fs.Object // manifest of the snapshot or nil if incomplete
+}
+
+// complete returns true if the snapshot has a manifest
+func (s *snapshot) complete() bool {
+	return s.manifest != nil
+}
+
+// listSnapshots returns the snapshots in f sorted oldest first
+func listSnapshots(ctx context.Context, f fs.Fs) ([]*snapshot, error) {
+	byID := map[string]*snapshot{}
+	find := func(id string) *snapshot {
+		if s, ok := byID[id]; ok {
+			return s
+		}
+		t, err := time.Parse(idFormat, id)
+		if err != nil {
+			fs.Debugf(f, "Ignoring %q which isn't a snapshot", id)
+			return nil
+		}
+		s := &snapshot{ID: id, Time: t}
+		byID[id] = s
+		return s
+	}
+	entries, err := f.List(ctx, snapshotsDir)
+	if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	for _, entry := range entries {
+		if _, ok := entry.(fs.Directory); !ok {
+			continue
+		}
+		if s := find(path.Base(entry.Remote())); s != nil {
+			s.hasDir = true
+		}
+	}
+	entries, err = f.List(ctx, manifestsDir)
+	if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, fmt.Errorf("failed to list manifests: %w", err)
+	}
+	for _, entry := range entries {
+		o, ok := entry.(fs.Object)
+		if !ok || !strings.HasSuffix(o.Remote(), manifestExt) {
+			continue
+		}
+		if s := find(strings.TrimSuffix(path.Base(o.Remote()), manifestExt)); s != nil {
+			s.manifest = o
+		}
+	}
+	snapshots := make([]*snapshot, 0, len(byID))
+	for _, s := range byID {
+		snapshots = append(snapshots, s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// readManifest reads and decodes the manifest in o
+func readManifest(ctx context.Context, o fs.Object) (m *manifest, err error) {
+	in, err := operations.Open(ctx, o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	m = new(manifest)
+	if err = json.NewDecoder(in).Decode(m); err != nil {
+		return nil, fmt.Errorf("failed to read manifest %q: %w", o.Remote(), err)
+	}
+	return m, nil
+}
+
+// writeManifest writes m to f
+func writeManifest(ctx context.Context, f fs.Fs, m *manifest) error {
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	remote := path.Join(manifestsDir, m.ID+manifestExt)
+	_, err = operations.RcatSize(ctx, f, remote, io.NopCloser(bytes.NewReader(data)), int64(len(data)), m.Completed, nil)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// createSnapshot copies fsrc into a new snapshot in fdst named after
+// the time now and writes its manifest.
+//
+// If an incomplete snapshot of the same name exists it is continued.
+func createSnapshot(ctx context.Context, fdst, fsrc fs.Fs, now time.Time) (*manifest, error) {
+	ci := fs.GetConfig(ctx)
+	if len(ci.CompareDest) > 0 || len(ci.CopyDest) > 0 || len(ci.LinkDest) > 0 {
+		return nil, errors.New("can't use --compare-dest, --copy-dest or --link-dest with backup")
+	}
+	id := now.UTC().Format(idFormat)
+	snapshots, err := listSnapshots(ctx, fdst)
+	if err != nil {
+		return nil, err
+	}
+	var parent *snapshot
+	for _, s := range snapshots {
+		if s.ID == id {
+			if s.complete() {
+				return nil, fmt.Errorf("snapshot %q already exists", id)
+			}
+			fs.Infof(fdst, "Continuing incomplete snapshot %q", id)
+		} else if s.complete() && s.Time.Before(now) {
+			parent = s
+		}
+	}
+
+	root := fs.ConfigString(fdst)
+	snapshotFs, err := cache.Get(ctx, fspath.JoinRootPath(root, path.Join(snapshotsDir, id)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make snapshot directory: %w", err)
+	}
+
+	// Take unchanged files from the previous snapshot
+	m := &manifest{
+		Version: manifestVersion,
+		ID:      id,
+		Source:  fs.ConfigString(fsrc),
+		Started: now,
+	}
+	if parent != nil {
+		m.Parent = parent.ID
+		parentPath := fspath.JoinRootPath(root, path.Join(snapshotsDir, parent.ID))
+		var newCi *fs.ConfigInfo
+		ctx, newCi = fs.AddConfig(ctx)
+		features := fdst.Features()
+		switch {
+		case features.HardLink != nil:
+			fs.Debugf(fdst, "Hard linking unchanged files from snapshot %q", parent.ID)
+			newCi.LinkDest = []string{parentPath}
+		case features.Copy != nil:
+			fs.Debugf(fdst, "Copying unchanged files from snapshot %q", parent.ID)
+			newCi.CopyDest = []string{parentPath}
+		default:
+			fs.Logf(fdst, "Can't hard link or server-side copy so uploading all files")
+		}
+	}
+
+	fs.Infof(fdst, "Creating snapshot %q", id)
+	err = fssync.CopyDir(ctx, snapshotFs, fsrc, createEmptySrcDirs)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %q is incomplete: %w", id, err)
+	}
+	if ci.DryRun {
+		return m, nil
+	}
+
+	// Record the contents of the snapshot in the manifest
+	ht := hash.None
+	if !snapshotFs.Features().SlowHash {
+		ht = snapshotFs.Hashes().GetOne()
+	}
+	if ht != hash.None {
+		m.HashType = ht.String()
+	}
+	var mu sync.Mutex
+	err = walk.ListR(ctx, snapshotFs, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			e := manifestEntry{
+				Path:    o.Remote(),
+				Size:    o.Size(),
+				ModTime: o.ModTime(ctx),
+			}
+			if ht != hash.None {
+				sum, err := o.Hash(ctx, ht)
+				if err != nil {
+					fs.Debugf(o, "Failed to read %v hash: %v", ht, err)
+				}
+				e.Hash = sum
+			}
+			mu.Lock()
+			m.Entries = append(m.Entries, e)
+			m.Files++
+			m.Bytes += e.Size
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot %q: %w", id, err)
+	}
+	sort.Slice(m.Entries, func(i, j int) bool {
+		return m.Entries[i].Path < m.Entries[j].Path
+	})
+	m.Completed = time.Now()
+	if err = writeManifest(ctx, fdst, m); err != nil {
+		return nil, err
+	}
+	fs.Logf(fdst, "Created snapshot %q with %d files (%v)", id, m.Files, fs.SizeSuffix(m.Bytes).ByteUnit())
+	return m, nil
+}
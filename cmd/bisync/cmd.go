@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -61,12 +62,20 @@ type Options struct {
 	ConflictSuffixFlag    string
 	ConflictSuffix1       string
 	ConflictSuffix2       string
+	Watch                 bool
+	WatchDelay            fs.Duration
+	WatchPollInterval     fs.Duration
+	WatchFullInterval     fs.Duration
+	MergeInclude          []string
+	MergeMaxSize          fs.SizeSuffix
+	changed               []string // if set, only re-read these paths when listing (for --watch)
 }
 
 // Default values
 const (
-	DefaultMaxDelete     int    = 50
-	DefaultCheckFilename string = "RCLONE_TEST"
+	DefaultMaxDelete     int           = 50
+	DefaultCheckFilename string        = "RCLONE_TEST"
+	DefaultMergeMaxSize  fs.SizeSuffix = fs.Mebi
 )
 
 // DefaultWorkdir is default working directory
@@ -120,6 +129,10 @@ var Opt Options
 
 func init() {
 	Opt.MaxLock = 0
+	Opt.WatchDelay = fs.Duration(5 * time.Second)
+	Opt.WatchPollInterval = fs.Duration(time.Minute)
+	Opt.WatchFullInterval = fs.Duration(time.Hour)
+	Opt.MergeMaxSize = DefaultMergeMaxSize
 	cmd.Root.AddCommand(commandDefinition)
 	cmdFlags := commandDefinition.Flags()
 	// when adding new flags, remember to also update the rc params:
@@ -151,6 +164,12 @@ func init() {
 	flags.FVarP(cmdFlags, &Opt.ConflictResolve, "conflict-resolve", "", "Automatically resolve conflicts by preferring the version that is: "+ConflictResolveList+" (default: none)", "")
 	flags.FVarP(cmdFlags, &Opt.ConflictLoser, "conflict-loser", "", "Action to take on the loser of a sync conflict (when there is a winner) or on both files (when there is no winner): "+ConflictLoserList+" (default: num)", "")
 	flags.StringVarP(cmdFlags, &Opt.ConflictSuffixFlag, "conflict-suffix", "", Opt.ConflictSuffixFlag, "Suffix to use when renaming a --conflict-loser. Can be either one string or two comma-separated strings to assign different suffixes to Path1/Path2. (default: 'conflict')", "")
+	flags.BoolVarP(cmdFlags, &Opt.Watch, "watch", "", Opt.Watch, "Keep running, syncing the paths which change as change notifications arrive.", "")
+	flags.FVarP(cmdFlags, &Opt.WatchDelay, "watch-delay", "", "With --watch, wait for changes to settle for this long before syncing them.", "")
+	flags.FVarP(cmdFlags, &Opt.WatchPollInterval, "watch-poll-interval", "", "With --watch, how often to poll remotes for changes, if they need polling.", "")
+	flags.FVarP(cmdFlags, &Opt.WatchFullInterval, "watch-full-interval", "", "With --watch, do a full bisync run this often to catch missed changes (0 to disable).", "")
+	flags.StringArrayVarP(cmdFlags, &Opt.MergeInclude, "merge-include", "", Opt.MergeInclude, "Try a three-way merge of changes to text files matching this pattern before renaming conflicts (can be repeated)", "")
+	flags.FVarP(cmdFlags, &Opt.MergeMaxSize, "merge-max-size", "", "Don't merge files larger than this", "")
 	_ = cmdFlags.MarkHidden("debugname")
 	_ = cmdFlags.MarkHidden("localtime")
 	addRC()
@@ -158,7 +177,7 @@ func init() {
 
 // bisync command definition
 var commandDefinition = &cobra.Command{
-	Use:   "bisync remote1:path1 remote2:path2",
+	Use:   "bisync remote1:path1 remote2:path2 [remote3:path3 ...]",
 	Short: shortHelp,
 	Long:  longHelp,
 	Annotations: map[string]string{
@@ -168,10 +187,22 @@ var commandDefinition = &cobra.Command{
 	RunE: func(command *cobra.Command, args []string) error {
 		// NOTE: avoid putting too much handling here, as it won't apply to the rc.
 		// Generally it's best to put init-type stuff in Bisync() (operations.go)
-		cmd.CheckArgs(2, 2, command, args)
-		fs1, file1, fs2, file2 := cmd.NewFsSrcDstFiles(args)
-		if file1 != "" || file2 != "" {
-			return errors.New("paths must be existing directories")
+		cmd.CheckArgs(2, math.MaxInt, command, args)
+		var fss []fs.Fs
+		if len(args) == 2 {
+			fs1, file1, fs2, file2 := cmd.NewFsSrcDstFiles(args)
+			if file1 != "" || file2 != "" {
+				return errors.New("paths must be existing directories")
+			}
+			fss = []fs.Fs{fs1, fs2}
+		} else {
+			for _, arg := range args {
+				f, file := cmd.NewFsFile(arg)
+				if file != "" {
+					return errors.New("paths must be existing directories")
+				}
+				fss = append(fss, f)
+			}
 		}
 
 		ctx := context.Background()
@@ -181,10 +212,13 @@ var commandDefinition = &cobra.Command{
 			TZ = time.Local
 		}
 
-		commonHashes := fs1.Hashes().Overlap(fs2.Hashes())
-		isDropbox1 := strings.HasPrefix(fs1.String(), "Dropbox")
-		isDropbox2 := strings.HasPrefix(fs2.String(), "Dropbox")
-		if commonHashes == hash.Set(0) && (isDropbox1 || isDropbox2) {
+		commonHashes := fss[0].Hashes()
+		isDropbox := false
+		for _, f := range fss {
+			commonHashes = commonHashes.Overlap(f.Hashes())
+			isDropbox = isDropbox || strings.HasPrefix(f.String(), "Dropbox")
+		}
+		if commonHashes == hash.Set(0) && isDropbox {
 			ci := fs.GetConfig(ctx)
 			if !ci.DryRun && !ci.RefreshTimes {
 				fs.Debugf(nil, "Using flag --refresh-times is recommended")
@@ -192,7 +226,15 @@ var commandDefinition = &cobra.Command{
 		}
 
 		cmd.Run(false, true, command, func() error {
-			err := Bisync(ctx, fs1, fs2, &opt)
+			var err error
+			if opt.Watch {
+				if len(fss) != 2 {
+					return errors.New("--watch can only be used with 2 paths")
+				}
+				err = Watch(ctx, fss[0], fss[1], &opt)
+			} else {
+				err = BisyncMulti(ctx, fss, &opt)
+			}
 			if err == ErrBisyncAborted {
 				return fserrors.FatalError(err)
 			}
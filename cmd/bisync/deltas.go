@@ -427,9 +427,14 @@ func (b *bisyncRun) applyDeltas(ctx context.Context, ds1, ds2 *deltaSet) (result
 						}
 					} else {
 						fs.Debugf(nil, "Files are NOT equal: %s", file)
-						err = b.resolve(ctxMove, path1, path2, file, alias, &renameSkipped, &copy1to2, &copy2to1, ds1, ds2)
-						if err != nil {
-							return
+						if b.mergeFile(ctxMove, file, alias) {
+							b.indent("Path1", p2, "Queue copy to Path2")
+							copy1to2.Add(file)
+						} else {
+							err = b.resolve(ctxMove, path1, path2, file, alias, &renameSkipped, &copy1to2, &copy2to1, ds1, ds2)
+							if err != nil {
+								return
+							}
 						}
 					}
 				}
@@ -40,6 +40,8 @@ func RcHelp() string {
 
 - path1 (required) - (string) a remote directory string e.g. ||drive:path1||
 - path2 (required) - (string) a remote directory string e.g. ||drive:path2||
+- path3, path4, ... - (string) more remote directories to sync with
+  path1 and path2 - see [N-way sync](https://rclone.org/bisync/#n-way)
 - dryRun - (bool) dry-run mode
 `+GenerateParams()+`
 See [bisync command help](https://rclone.org/commands/rclone_bisync/)
@@ -66,7 +68,8 @@ func toCamel(s string) string {
 func GenerateParams() string {
 	builder := strings.Builder{}
 	fn := func(flag *pflag.Flag) {
-		if flag.Hidden {
+		// --watch and friends are only for the command line
+		if flag.Hidden || strings.HasPrefix(flag.Name, "watch") {
 			return
 		}
 		builder.WriteString(fmt.Sprintf("- %s - (%s) %s  \n", toCamel(flag.Name), flag.Value.Type(), flag.Usage))
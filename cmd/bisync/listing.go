@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"regexp"
 	"slices"
 	"sort"
@@ -125,6 +126,28 @@ func (ls *fileList) remove(file string) {
 	}
 }
 
+// removeTrees removes each of files and, for directories, everything in them
+func (ls *fileList) removeTrees(files []string) {
+	remove := map[string]struct{}{}
+	for _, file := range files {
+		if file == "" {
+			ls.list = ls.list[:0]
+			clear(ls.info)
+			return
+		}
+		remove[file] = struct{}{}
+	}
+	ls.list = slices.DeleteFunc(ls.list, func(file string) bool {
+		for dir := file; dir != "."; dir = path.Dir(dir) {
+			if _, found := remove[dir]; found {
+				delete(ls.info, file)
+				return true
+			}
+		}
+		return false
+	})
+}
+
 func (ls *fileList) put(file string, size int64, modtime time.Time, hash, id string, flags string) {
 	fi := ls.get(file)
 	if fi != nil {
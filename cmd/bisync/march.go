@@ -2,6 +2,9 @@ package bisync
 
 import (
 	"context"
+	"errors"
+	"path"
+	"slices"
 	"sync"
 	"time"
 
@@ -9,6 +12,7 @@ import (
 	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/list"
 	"github.com/rclone/rclone/fs/march"
 )
 
@@ -68,6 +72,110 @@ func (b *bisyncRun) makeMarchListing(ctx context.Context) (*fileList, *fileList,
 	return b.march.ls1, b.march.ls2, b.march.err
 }
 
+// makeChangedListing makes the current listings by starting from the
+// prior listings and reading only the changed paths, which may be
+// files or directories, rather than listing everything.
+func (b *bisyncRun) makeChangedListing(ctx context.Context, changed []string) (*fileList, *fileList, error) {
+	b.march.marchCtx = ctx
+	b.setupListing()
+	for _, isPath1 := range []bool{true, false} {
+		f, listing, newListing := b.fs1, b.listing1, b.newListing1
+		if !isPath1 {
+			f, listing, newListing = b.fs2, b.listing2, b.newListing2
+		}
+		prior, err := b.loadListing(listing)
+		if err != nil {
+			b.handleErr(listing, "error loading prior listing", err, true, true)
+			b.abort = true
+			return b.march.ls1, b.march.ls2, err
+		}
+		ls := b.whichLs(isPath1)
+		if b.opt.Compare.DownloadHash && ls.hash == hash.None {
+			ls.hash = hash.MD5
+		}
+		prior.getPutAll(ls)
+		ls.removeTrees(changed)
+		for _, remote := range changed {
+			if err = b.relist(ctx, f, remote, isPath1); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = b.march.firstErr
+		}
+		if err != nil {
+			b.handleErr(f, "error reading changed paths", err, true, true)
+			b.abort = true
+			return b.march.ls1, b.march.ls2, err
+		}
+		err = ls.save(newListing)
+		b.handleErr(ls, "error saving listing of changed paths", err, true, true)
+		if err != nil {
+			return b.march.ls1, b.march.ls2, err
+		}
+	}
+	return b.march.ls1, b.march.ls2, nil
+}
+
+// relist adds whatever is now at remote, which may be a file, a
+// directory or nothing, to the current listing
+func (b *bisyncRun) relist(ctx context.Context, f fs.Fs, remote string, isPath1 bool) error {
+	if remote != "" {
+		o, err := f.NewObject(ctx, remote)
+		if err == nil {
+			if filter.GetConfig(ctx).IncludeObject(ctx, o) {
+				b.ForObject(o, isPath1)
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrorObjectNotFound) && !errors.Is(err, fs.ErrorIsDir) && !errors.Is(err, fs.ErrorNotAFile) {
+			return err
+		}
+	}
+	// Not a file, so read it as a directory
+	if err := b.relistDir(ctx, f, remote, isPath1); err != nil || remote == "" || !b.opt.CreateEmptySrcDirs {
+		return err
+	}
+	// Find the directory itself in its parent
+	parent := path.Dir(remote)
+	if parent == "." {
+		parent = ""
+	}
+	entries, err := list.DirSorted(ctx, f, false, parent)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(entries, func(entry fs.DirEntry) bool { return entry.Remote() == remote })
+	if i >= 0 {
+		b.parse(entries[i], isPath1)
+	}
+	return nil
+}
+
+// relistDir adds everything in dir to the current listing
+//
+// Directories which don't exist are ignored as they have been deleted
+// since the change was notified.
+func (b *bisyncRun) relistDir(ctx context.Context, f fs.Fs, dir string, isPath1 bool) error {
+	entries, err := list.DirSorted(ctx, f, false, dir)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		b.parse(entry, isPath1)
+		if _, ok := entry.(fs.Directory); ok {
+			if err := b.relistDir(ctx, f, entry.Remote(), isPath1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // SrcOnly have an object which is on path1 only
 func (b *bisyncRun) SrcOnly(o fs.DirEntry) (recurse bool) {
 	fs.Debugf(o, "path1 only")
@@ -0,0 +1,253 @@
+package bisync
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/rclone/rclone/cmd/bisync/bilib"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/terminal"
+)
+
+// mergeOpt keeps the state for --merge-include
+type mergeOpt struct {
+	filter   *filter.Filter // files to merge, nil if not merging
+	dir      string         // directory holding the ancestor store
+	listing  string         // listing of the files in the ancestor store
+	maxBytes int64          // largest file to merge
+}
+
+// setMergeDefaults sets up the ancestor store if --merge-include is set
+func (b *bisyncRun) setMergeDefaults() (err error) {
+	if len(b.opt.MergeInclude) == 0 {
+		return nil
+	}
+	opt := filter.Options{
+		MinAge:  fs.DurationOff,
+		MaxAge:  fs.DurationOff,
+		MinSize: fs.SizeSuffix(-1),
+		MaxSize: fs.SizeSuffix(-1),
+	}
+	opt.IncludeRule = b.opt.MergeInclude
+	b.mergeOpt.filter, err = filter.NewFilter(&opt)
+	if err != nil {
+		return fmt.Errorf("invalid --merge-include: %w", err)
+	}
+	b.mergeOpt.dir = b.basePath + ".ancestors"
+	b.mergeOpt.listing = b.basePath + ".ancestors.lst"
+	b.mergeOpt.maxBytes = int64(b.opt.MergeMaxSize)
+	if b.mergeOpt.maxBytes <= 0 {
+		b.mergeOpt.maxBytes = int64(DefaultMergeMaxSize)
+	}
+	return nil
+}
+
+// mergeable returns true if file should be merged when in conflict
+func (b *bisyncRun) mergeable(file string, size int64) bool {
+	return b.mergeOpt.filter != nil && size >= 0 && size <= b.mergeOpt.maxBytes && b.mergeOpt.filter.IncludeRemote(file)
+}
+
+// ancestorPath returns the path in the ancestor store for file
+func (b *bisyncRun) ancestorPath(file string) string {
+	sum := md5.Sum([]byte(file))
+	return filepath.Join(b.mergeOpt.dir, hex.EncodeToString(sum[:]))
+}
+
+// mergeFile attempts a three-way merge of file, which has changed on
+// both paths, with its ancestor from the last sync.
+//
+// If the merge succeeds the merged file is written to Path1 and true is
+// returned, so it should be queued for copying to Path2. Otherwise the
+// conflict should be resolved in the normal way.
+func (b *bisyncRun) mergeFile(ctx context.Context, file, alias string) bool {
+	if file != alias || !b.mergeable(file, b.march.ls1.getSize(file)) || !b.mergeable(file, b.march.ls2.getSize(file)) {
+		return false
+	}
+	base, err := os.ReadFile(b.ancestorPath(file))
+	if err != nil {
+		fs.Infof(file, "Not merging as the common ancestor wasn't found: %v", err)
+		return false
+	}
+	read := func(f fs.Fs) []byte {
+		if err != nil {
+			return nil
+		}
+		var o fs.Object
+		var data []byte
+		o, err = f.NewObject(ctx, file)
+		if err == nil {
+			data, err = operations.ReadFile(ctx, o)
+		}
+		return data
+	}
+	data1 := read(b.fs1)
+	data2 := read(b.fs2)
+	if err != nil {
+		fs.Errorf(file, "Not merging as failed to read file: %v", err)
+		return false
+	}
+	if isBinary(base) || isBinary(data1) || isBinary(data2) {
+		fs.Infof(file, "Not merging as it isn't a text file")
+		return false
+	}
+	merged, ok := merge3(base, data1, data2)
+	if !ok {
+		fs.Infoc(file, Color(terminal.YellowFg, "Not merging as the changes on Path1 and Path2 overlap"))
+		return false
+	}
+	if operations.SkipDestructive(ctx, file, "merge") {
+		return true
+	}
+	b.indent("!Path1", file, "Merging changes from Path1 and Path2")
+	_, err = operations.Rcat(ctx, b.fs1, file, io.NopCloser(bytes.NewReader(merged)), time.Now(), nil)
+	if err != nil {
+		fs.Errorf(file, "Failed to write merged file: %v", err)
+		return false
+	}
+	return true
+}
+
+// updateAncestors saves the synced version of the files to merge in
+// the ancestor store, removing any which are no longer needed
+func (b *bisyncRun) updateAncestors(ctx context.Context) error {
+	if b.mergeOpt.filter == nil || b.opt.DryRun {
+		return nil
+	}
+	synced, err := b.loadListing(b.listing1)
+	if err != nil {
+		return err
+	}
+	stored := newFileList()
+	if bilib.FileExists(b.mergeOpt.listing) {
+		stored, err = b.loadListing(b.mergeOpt.listing)
+		if err != nil {
+			return err
+		}
+	}
+	if err = os.MkdirAll(b.mergeOpt.dir, bilib.PermSecure); err != nil {
+		return err
+	}
+	ancestors := newFileList()
+	ancestors.hash = synced.hash
+	for _, file := range synced.list {
+		info := synced.get(file)
+		if synced.isDir(file) || !b.mergeable(file, info.size) {
+			continue
+		}
+		if old := stored.get(file); old != nil && old.size == info.size && old.time.Equal(info.time) && old.hash == info.hash {
+			ancestors.put(file, info.size, info.time, info.hash, info.id, info.flags)
+			continue
+		}
+		o, err := b.fs1.NewObject(ctx, file)
+		var data []byte
+		if err == nil {
+			data, err = operations.ReadFile(ctx, o)
+		}
+		if err == nil {
+			err = os.WriteFile(b.ancestorPath(file), data, bilib.PermSecure)
+		}
+		if err != nil {
+			fs.Errorf(file, "Failed to save common ancestor for merging: %v", err)
+			continue
+		}
+		ancestors.put(file, info.size, info.time, info.hash, info.id, info.flags)
+	}
+	for _, file := range stored.list {
+		if !ancestors.has(file) {
+			_ = os.Remove(b.ancestorPath(file))
+		}
+	}
+	return ancestors.save(b.mergeOpt.listing)
+}
+
+// isBinary returns true if data doesn't look like text
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// splitLines splits data into lines keeping the line endings
+func splitLines(data []byte) (lines []string) {
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, string(data[:i]))
+		data = data[i:]
+	}
+	return lines
+}
+
+// matches returns, for each line of base, the index of the matching
+// line in other or -1 if it has no match
+func matches(base, other []string) []int {
+	m := make([]int, len(base)+1)
+	for i := range m {
+		m[i] = -1
+	}
+	matcher := difflib.NewMatcherWithJunk(base, other, false, nil)
+	for _, block := range matcher.GetMatchingBlocks() {
+		for i := range block.Size {
+			m[block.A+i] = block.B + i
+		}
+	}
+	// the end of base matches the end of other
+	m[len(base)] = len(other)
+	return m
+}
+
+// merge3 does a line based three-way merge of the changes from base to
+// a and from base to b.
+//
+// It returns false if a and b change the same lines in different ways.
+func merge3(base, a, b []byte) (merged []byte, ok bool) {
+	o, x, y := splitLines(base), splitLines(a), splitLines(b)
+	mx, my := matches(o, x), matches(o, y)
+	var out bytes.Buffer
+	write := func(lines []string) {
+		for _, line := range lines {
+			out.WriteString(line)
+		}
+	}
+	po, px, py := 0, 0, 0
+	for po < len(o) || px < len(x) || py < len(y) {
+		// copy the lines which are unchanged in both
+		n := 0
+		for po+n < len(o) && mx[po+n] == px+n && my[po+n] == py+n {
+			n++
+		}
+		if n > 0 {
+			write(o[po : po+n])
+			po, px, py = po+n, px+n, py+n
+			continue
+		}
+		// find the next line of base which is in both
+		jo := po
+		for mx[jo] < 0 || my[jo] < 0 {
+			jo++
+		}
+		jx, jy := mx[jo], my[jo]
+		co, cx, cy := o[po:jo], x[px:jx], y[py:jy]
+		switch {
+		case slices.Equal(co, cx):
+			write(cy)
+		case slices.Equal(co, cy), slices.Equal(cx, cy):
+			write(cx)
+		default:
+			return nil, false
+		}
+		po, px, py = jo, jx, jy
+	}
+	return out.Bytes(), true
+}
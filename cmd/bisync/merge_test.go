@@ -0,0 +1,125 @@
+package bisync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge3(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		base    string
+		a       string
+		b       string
+		want    string
+		wantErr bool
+	}{
+		{name: "unchanged", base: "1\n2\n3\n", a: "1\n2\n3\n", b: "1\n2\n3\n", want: "1\n2\n3\n"},
+		{name: "only a", base: "1\n2\n3\n", a: "1\nA\n3\n", b: "1\n2\n3\n", want: "1\nA\n3\n"},
+		{name: "only b", base: "1\n2\n3\n", a: "1\n2\n3\n", b: "1\n2\nB\n", want: "1\n2\nB\n"},
+		{name: "both", base: "1\n2\n3\n4\n5\n", a: "A\n2\n3\n4\n5\n", b: "1\n2\n3\n4\nB\n", want: "A\n2\n3\n4\nB\n"},
+		{name: "same change", base: "1\n2\n3\n", a: "1\nX\n3\n", b: "1\nX\n3\n", want: "1\nX\n3\n"},
+		{name: "insert and delete", base: "1\n2\n3\n4\n5\n", a: "0\n1\n2\n3\n4\n5\n", b: "1\n2\n3\n5\n", want: "0\n1\n2\n3\n5\n"},
+		{name: "append both", base: "1\n2\n3\n", a: "1\n2\n3\nA\n", b: "0\n1\n2\n3\n", want: "0\n1\n2\n3\nA\n"},
+		{name: "no final newline", base: "1\n2\n3", a: "A\n2\n3", b: "1\n2\nB", want: "A\n2\nB"},
+		{name: "from empty", base: "", a: "A\n", b: "", want: "A\n"},
+		{name: "overlap", base: "1\n2\n3\n", a: "1\nA\n3\n", b: "1\nB\n3\n", wantErr: true},
+		{name: "adjacent", base: "1\n2\n3\n4\n", a: "1\nA\n3\n4\n", b: "1\n2\nB\n4\n", wantErr: true},
+		{name: "both append", base: "1\n", a: "1\nA\n", b: "1\nB\n", wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := merge3([]byte(test.base), []byte(test.a), []byte(test.b))
+			if test.wantErr {
+				assert.False(t, ok)
+			} else {
+				assert.True(t, ok)
+				assert.Equal(t, test.want, string(got))
+			}
+		})
+	}
+}
+
+func TestBisyncMerge(t *testing.T) {
+	ctx, _ := fs.AddConfig(context.Background())
+	base := t.TempDir()
+	dirs := []string{filepath.Join(base, "path1"), filepath.Join(base, "path2")}
+	for _, dir := range dirs {
+		require.NoError(t, os.MkdirAll(dir, 0o777))
+	}
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	write := func(i int, name, contents string) {
+		path := filepath.Join(dirs[i], name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o777))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o666))
+		modTime = modTime.Add(time.Minute)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	read := func(i int, name string) string {
+		data, err := os.ReadFile(filepath.Join(dirs[i], name))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+	run := func(resync bool) {
+		t.Helper()
+		fs1, err := cache.Get(ctx, dirs[0])
+		require.NoError(t, err)
+		fs2, err := cache.Get(ctx, dirs[1])
+		require.NoError(t, err)
+		opt := &Options{
+			Workdir:      filepath.Join(base, "workdir"),
+			Resync:       resync,
+			MaxDelete:    DefaultMaxDelete,
+			CheckSync:    CheckSyncTrue,
+			Force:        true,
+			MergeInclude: []string{"*.txt"},
+		}
+		require.NoError(t, Bisync(ctx, fs1, fs2, opt))
+	}
+
+	write(0, "notes.txt", "one\ntwo\nthree\nfour\nfive\n")
+	write(0, "data.bin", "one\n")
+	run(true)
+	assert.Equal(t, "one\ntwo\nthree\nfour\nfive\n", read(1, "notes.txt"))
+
+	// Changes to different lines are merged
+	write(0, "notes.txt", "ONE\ntwo\nthree\nfour\nfive\n")
+	write(1, "notes.txt", "one\ntwo\nthree\nfour\nFIVE\n")
+	write(0, "data.bin", "path1\n")
+	write(1, "data.bin", "path2\n")
+	run(false)
+	for i := range dirs {
+		assert.Equal(t, "ONE\ntwo\nthree\nfour\nFIVE\n", read(i, "notes.txt"))
+		assert.Equal(t, "<missing>", read(i, "notes.txt.conflict1"))
+		// files not matching --merge-include are renamed as usual
+		assert.Equal(t, "path1\n", read(i, "data.bin.conflict1"))
+		assert.Equal(t, "path2\n", read(i, "data.bin.conflict2"))
+	}
+
+	// The merged file is the new ancestor
+	write(0, "notes.txt", "ONE\nTWO\nthree\nfour\nFIVE\n")
+	write(1, "notes.txt", "ONE\ntwo\nthree\nFOUR\nFIVE\n")
+	run(false)
+	for i := range dirs {
+		assert.Equal(t, "ONE\nTWO\nthree\nFOUR\nFIVE\n", read(i, "notes.txt"))
+	}
+
+	// Overlapping changes are renamed as usual
+	write(0, "notes.txt", "ONE\nTWO\n3\nFOUR\nFIVE\n")
+	write(1, "notes.txt", "ONE\nTWO\nIII\nFOUR\nFIVE\n")
+	run(false)
+	for i := range dirs {
+		assert.Equal(t, "<missing>", read(i, "notes.txt"))
+		assert.Equal(t, "ONE\nTWO\n3\nFOUR\nFIVE\n", read(i, "notes.txt.conflict1"))
+		assert.Equal(t, "ONE\nTWO\nIII\nFOUR\nFIVE\n", read(i, "notes.txt.conflict2"))
+	}
+}
@@ -0,0 +1,950 @@
+package bisync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/rclone/rclone/cmd/bisync/bilib"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/log"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/terminal"
+	"github.com/rclone/rclone/lib/transform"
+	"golang.org/x/sync/errgroup"
+)
+
+// multiRun keeps the runtime state of a bisync run between more than
+// two paths
+//
+// Unlike the two path bisync, every path is compared with its own
+// prior listing, then each file is resolved once across all the paths
+// and the result copied to every path which doesn't have it.
+type multiRun struct {
+	*bisyncRun
+	fss      []fs.Fs
+	listings []string  // prior listing of each path
+	suffixes []string  // conflict suffix of each path
+	ht       hash.Type // hash stored in the listings or hash.None
+
+	now   []*fileList // current listing of each path
+	prior []*fileList // listing of each path at the end of the last run
+
+	mu     gosync.Mutex        // protects the below
+	next   []*fileList         // listing of each path after this run
+	failed map[string]struct{} // files which couldn't be synced
+}
+
+// version is one version of a file, held by one or more paths
+type version struct {
+	paths []int     // paths which have this version, in order
+	info  *fileInfo // info of the version on paths[0]
+}
+
+// BisyncMulti performs a bisync run between all of fss.
+//
+// With two paths this is the same as Bisync. With more, each path
+// keeps its own prior listing and changes made on any path are
+// propagated to all the others, with conflicts between the paths
+// resolved in a single pass.
+func BisyncMulti(ctx context.Context, fss []fs.Fs, optArg *Options) (err error) {
+	if len(fss) < 2 {
+		return errors.New("bisync needs at least 2 paths")
+	}
+	if len(fss) == 2 {
+		return Bisync(ctx, fss[0], fss[1], optArg)
+	}
+	opt := *optArg // ensure that input is never changed
+	m := &multiRun{
+		bisyncRun: &bisyncRun{
+			fs1:       fss[0],
+			fs2:       fss[1],
+			opt:       &opt,
+			DebugName: opt.DebugName,
+		},
+		fss:    fss,
+		failed: map[string]struct{}{},
+	}
+
+	if opt.CheckFilename == "" {
+		opt.CheckFilename = DefaultCheckFilename
+	}
+	if opt.Workdir == "" {
+		opt.Workdir = DefaultWorkdir
+	}
+	ci := fs.GetConfig(ctx)
+	if err = checkMultiOptions(ci, &opt); err != nil {
+		return err
+	}
+
+	if ci.TerminalColorMode == fs.TerminalColorModeAlways || (ci.TerminalColorMode == fs.TerminalColorModeAuto && !log.Redirected()) {
+		ColorsLock.Lock()
+		Colors = true
+		ColorsLock.Unlock()
+	}
+
+	if err = m.setCompareDefaults(ctx); err != nil {
+		return err
+	}
+	m.setResyncDefaults()
+	if err = m.setResolveDefaults(); err != nil {
+		return err
+	}
+
+	if m.workDir, err = filepath.Abs(opt.Workdir); err != nil {
+		return fmt.Errorf("failed to make workdir absolute: %w", err)
+	}
+	if err = os.MkdirAll(m.workDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create workdir: %w", err)
+	}
+	m.basePath = filepath.Join(m.workDir, MultiSessionName(fss))
+	for i := range fss {
+		m.listings = append(m.listings, fmt.Sprintf("%s.path%d.lst", m.basePath, i+1))
+	}
+
+	for _, f := range fss {
+		if strings.Count(bilib.FsPath(f), `"`)%2 != 0 {
+			return fmt.Errorf(Color(terminal.RedFg, "detected an odd number of quotes in path %v. This is usually a mistake indicating incorrect escaping"), bilib.FsPath(f))
+		}
+	}
+
+	if err = m.setLockFile(); err != nil {
+		return err
+	}
+	fnHandle := atexit.Register(func() {
+		_ = m.removeLockFile()
+	})
+	defer atexit.Unregister(fnHandle)
+
+	err = m.run(ctx)
+
+	removeLockErr := m.removeLockFile()
+	if err == nil {
+		err = removeLockErr
+	}
+
+	if m.critical {
+		for _, listing := range m.listings {
+			markFailed(listing)
+		}
+		fs.Errorf(nil, Color(terminal.RedFg, "Bisync critical error: %v"), err)
+		fs.Error(nil, Color(terminal.RedFg, "Bisync aborted. Must run --resync to recover."))
+		return ErrBisyncAborted
+	}
+	if err == nil {
+		fs.Infoc(nil, Color(terminal.GreenFg, "Bisync successful"))
+	}
+	return err
+}
+
+// MultiSessionName makes a session name from the paths of fss
+func MultiSessionName(fss []fs.Fs) string {
+	names := make([]string, len(fss))
+	for i, f := range fss {
+		names[i] = bilib.StripHexString(bilib.CanonicalPath(bilib.FsPath(f)))
+	}
+	return strings.Join(names, "..")
+}
+
+// pathName returns the name of path i for the logs
+func pathName(i int) string {
+	return fmt.Sprintf("Path%d", i+1)
+}
+
+// checkMultiOptions returns an error if any of the options which
+// can't be used with more than 2 paths are set
+func checkMultiOptions(ci *fs.ConfigInfo, opt *Options) error {
+	for _, unsupported := range []struct {
+		set  bool
+		flag string
+	}{
+		{ci.BackupDir != "", "--backup-dir"},
+		{opt.BackupDir1 != "", "--backup-dir1"},
+		{opt.BackupDir2 != "", "--backup-dir2"},
+		{opt.Compare.DownloadHash, "--download-hash"},
+		{opt.Compare.SlowHashSyncOnly, "--slow-hash-sync-only"},
+		{len(opt.MergeInclude) > 0, "--merge-include"},
+		{opt.Resilient, "--resilient"},
+		{opt.Recover, "--recover"},
+		{opt.NoCleanup, "--no-cleanup"},
+		{opt.Watch, "--watch"},
+	} {
+		if unsupported.set {
+			return fmt.Errorf("%s can't be used with more than 2 paths", unsupported.flag)
+		}
+	}
+	return nil
+}
+
+// setCompareDefaults works out what to compare from the flags
+func (m *multiRun) setCompareDefaults(ctx context.Context) error {
+	ci := fs.GetConfig(ctx)
+	m.opt.Compare.Size = !ci.IgnoreSize
+	m.opt.Compare.Modtime = !ci.SizeOnly && !ci.CheckSum
+	m.opt.Compare.Checksum = ci.CheckSum && !ci.SizeOnly
+	if err := m.setFromCompareFlag(ctx); err != nil {
+		return err
+	}
+	if m.opt.Compare.Checksum && !m.opt.IgnoreListingChecksum {
+		common := m.fss[0].Hashes()
+		slow := false
+		for _, f := range m.fss {
+			common = common.Overlap(f.Hashes())
+			slow = slow || f.Features().SlowHash
+		}
+		switch {
+		case slow && m.opt.Compare.NoSlowHash:
+			fs.Infof(nil, "Not using checksums in listings as at least one slow hash detected.")
+		case common.Count() == 0:
+			fs.Log(nil, Color(terminal.YellowFg, "--checksum is in use but the paths have no hashes in common; falling back to --compare modtime,size"))
+			m.opt.Compare.Checksum = false
+			m.opt.Compare.Modtime = true
+			m.opt.Compare.Size = true
+			ci.CheckSum = false
+		default:
+			m.ht = common.GetOne()
+		}
+	}
+	if m.opt.Compare.Modtime && !m.modTimesSupported() {
+		fs.Log(nil, Color(terminal.YellowFg, "WARNING: Modtime compare was requested but at least one remote does not support it. It is recommended to use --checksum or --size-only instead."))
+	}
+	if !m.opt.Compare.Size && !m.opt.Compare.Modtime && !m.opt.Compare.Checksum {
+		return errors.New(Color(terminal.RedFg, "must set a Compare method. (size, modtime, and checksum can't all be false.)"))
+	}
+	m.opt.Compare.HashType1 = m.ht
+	m.opt.Compare.HashType2 = m.ht
+	prettyprint(m.opt.Compare, "Bisyncing with Comparison Settings", fs.LogLevelInfo)
+	return nil
+}
+
+// modTimesSupported returns true if all the paths support modtimes
+func (m *multiRun) modTimesSupported() bool {
+	return !slices.ContainsFunc(m.fss, func(f fs.Fs) bool { return f.Precision() == fs.ModTimeNotSupported })
+}
+
+// setResyncDefaults checks --resync-mode
+func (m *multiRun) setResyncDefaults() {
+	if m.opt.Resync && m.opt.ResyncMode == PreferNone {
+		m.opt.ResyncMode = PreferPath1
+	}
+	if m.opt.ResyncMode != PreferNone {
+		m.opt.Resync = true
+	}
+	if m.preferUnsupported(m.opt.ResyncMode, "--resync-mode") {
+		m.opt.ResyncMode = PreferPath1
+	}
+}
+
+// setResolveDefaults checks --conflict-resolve, --conflict-loser and
+// --conflict-suffix which may have one suffix or one for each path
+func (m *multiRun) setResolveDefaults() error {
+	// ConflictLoserSkip is the zero value which means the flag
+	// wasn't set, so use the default as Bisync does
+	if m.opt.ConflictLoser == ConflictLoserSkip {
+		m.opt.ConflictLoser = ConflictLoserNumber
+	}
+	if m.opt.ConflictSuffixFlag == "" {
+		m.opt.ConflictSuffixFlag = "conflict"
+	}
+	suffixes := strings.Split(m.opt.ConflictSuffixFlag, ",")
+	switch len(suffixes) {
+	case 1:
+		for range m.fss {
+			m.suffixes = append(m.suffixes, suffixes[0])
+		}
+	case len(m.fss):
+		m.suffixes = suffixes
+	default:
+		return fmt.Errorf("--conflict-suffix must have 1 or %d comma-separated values. Received %v: %v", len(m.fss), len(suffixes), suffixes)
+	}
+	t := time.Now() // same time for all files throughout this run
+	for i := range m.suffixes {
+		m.suffixes[i] = "." + transform.AppyTimeGlobs(m.suffixes[i], t)
+	}
+	if m.preferUnsupported(m.opt.ConflictResolve, "--conflict-resolve") {
+		m.opt.ConflictResolve = PreferNone
+	}
+	return nil
+}
+
+// preferUnsupported returns true, with a warning, if prefer can't be
+// used with the current compare settings
+func (m *multiRun) preferUnsupported(prefer Prefer, flag string) bool {
+	switch prefer {
+	case PreferNewer, PreferOlder:
+		if !m.modTimesSupported() || !m.opt.Compare.Modtime {
+			fs.Logf(nil, Color(terminal.YellowFg, "WARNING: ignoring %s %s as modtimes are not being compared."), flag, prefer)
+			return true
+		}
+	case PreferLarger, PreferSmaller:
+		if !m.opt.Compare.Size {
+			fs.Logf(nil, Color(terminal.YellowFg, "WARNING: ignoring %s %s as --compare does not include size."), flag, prefer)
+			return true
+		}
+	}
+	return false
+}
+
+// run performs the sync with the lock file held
+func (m *multiRun) run(octx context.Context) (err error) {
+	m.octx = octx
+	m.fctx = octx
+	if m.opt.CheckSync == CheckSyncOnly {
+		fs.Infof(nil, "Validating listings of %d paths", len(m.fss))
+		m.next = make([]*fileList, len(m.fss))
+		for i, listing := range m.listings {
+			if m.next[i], err = m.loadListing(listing); err != nil {
+				return fmt.Errorf("cannot read prior listing of %s: %w", pathName(i), err)
+			}
+		}
+		if err = m.checkSync(); err != nil {
+			m.critical = true
+		}
+		return err
+	}
+
+	paths := make([]string, len(m.fss))
+	for i, f := range m.fss {
+		paths[i] = quotePath(bilib.FsPath(f))
+	}
+	fs.Infof(nil, "Synching %s", strings.Join(paths, ", "))
+
+	fctx, err := m.opt.applyFilters(octx)
+	if err != nil {
+		return err
+	}
+	m.fctx = fctx
+	for i := range m.fss {
+		for j := i + 1; j < len(m.fss); j++ {
+			if err = m.overlappingPathsCheck(fctx, m.fss[i], m.fss[j]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !m.opt.Resync {
+		m.prior = make([]*fileList, len(m.fss))
+		for i, listing := range m.listings {
+			if !bilib.FileExists(listing) {
+				return fmt.Errorf("cannot find prior listing of %s %s, likely due to critical error on prior run or a new path - must run --resync", pathName(i), listing)
+			}
+			if m.prior[i], err = m.loadListing(listing); err != nil {
+				return fmt.Errorf("cannot read prior listing of %s: %w", pathName(i), err)
+			}
+		}
+	}
+
+	fs.Infof(nil, "Building listings of %d paths", len(m.fss))
+	m.now = make([]*fileList, len(m.fss))
+	g, gCtx := errgroup.WithContext(fctx)
+	for i := range m.fss {
+		g.Go(func() (err error) {
+			m.now[i], err = m.list(gCtx, i)
+			if err != nil {
+				return fmt.Errorf("error listing %s: %w", pathName(i), err)
+			}
+			return nil
+		})
+	}
+	if err = g.Wait(); err != nil {
+		fs.Error(nil, Color(terminal.RedFg, "There were errors while building listings. Aborting as it is too dangerous to continue."))
+		return err
+	}
+	m.next = make([]*fileList, len(m.fss))
+	for i, ls := range m.now {
+		m.next[i] = newFileList()
+		m.next[i].hash = m.ht
+		ls.getPutAll(m.next[i])
+	}
+
+	if m.opt.CheckAccess {
+		if err = m.checkAccess(); err != nil {
+			return err
+		}
+	}
+
+	var sync func(ctx context.Context, name string) error
+	if m.opt.Resync {
+		fs.Infof(nil, "Resyncing all paths preferring the %s version", m.opt.ResyncMode)
+		sync = m.resyncFile
+	} else {
+		if err = m.checkDeletes(); err != nil {
+			return err
+		}
+		sync = m.syncFile
+	}
+
+	// Sync the files, then the directories
+	ctx := fctx
+	ci := fs.GetConfig(ctx)
+	g = &errgroup.Group{}
+	g.SetLimit(max(ci.Transfers, 1))
+	for _, name := range m.names(false) {
+		g.Go(func() error {
+			if err := sync(ctx, name); err != nil {
+				err = fs.CountError(ctx, err)
+				m.indentf("ERROR", name, "Failed to sync: %v", err)
+				m.mu.Lock()
+				m.failed[name] = struct{}{}
+				m.mu.Unlock()
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	if m.opt.CreateEmptySrcDirs {
+		m.syncDirs(ctx)
+	}
+
+	if !m.opt.DryRun {
+		m.revertFailed()
+		for i, ls := range m.next {
+			if err = ls.save(m.listings[i]); err != nil {
+				m.critical = true
+				return fmt.Errorf("error saving listing of %s: %w", pathName(i), err)
+			}
+		}
+	}
+	if len(m.failed) > 0 {
+		return fmt.Errorf("failed to sync %d files - they will be retried on the next run", len(m.failed))
+	}
+	if m.opt.CheckSync == CheckSyncTrue && !m.opt.DryRun {
+		fs.Infof(nil, "Validating listings of %d paths", len(m.fss))
+		if err = m.checkSync(); err != nil {
+			m.critical = true
+			return err
+		}
+	}
+	if m.opt.RemoveEmptyDirs {
+		for i, f := range m.fss {
+			fs.Infof(nil, "Removing empty directories on %s", pathName(i))
+			if err = operations.Rmdirs(ctx, f, "", true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// list makes the current listing of path i
+func (m *multiRun) list(ctx context.Context, i int) (*fileList, error) {
+	ls := newFileList()
+	ls.hash = m.ht
+	err := walk.ListR(ctx, m.fss[i], "", false, -1, walk.ListAll, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			switch x := entry.(type) {
+			case fs.Object:
+				var hashVal string
+				if m.ht != hash.None {
+					var err error
+					hashVal, err = x.Hash(ctx, m.ht)
+					if err != nil {
+						return fmt.Errorf("failed to hash %q: %w", x.Remote(), err)
+					}
+				}
+				var modtime time.Time
+				if m.opt.Compare.Modtime {
+					modtime = x.ModTime(ctx).In(TZ)
+				}
+				ls.put(x.Remote(), x.Size(), modtime, hashVal, "", "-")
+			case fs.Directory:
+				if m.opt.CreateEmptySrcDirs {
+					ls.put(x.Remote(), -1, x.ModTime(ctx).In(TZ), "", "", "d")
+				}
+			}
+		}
+		return nil
+	})
+	return ls, err
+}
+
+// names returns the sorted names of all the files (or directories
+// if dirs is set) in the current and prior listings
+func (m *multiRun) names(dirs bool) []string {
+	seen := map[string]struct{}{}
+	for _, ls := range slices.Concat(m.now, m.prior) {
+		for name, fi := range ls.info {
+			if (fi.flags == "d") == dirs {
+				seen[name] = struct{}{}
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// get returns the info of name in ls if it is a file
+func getFile(ls *fileList, name string) *fileInfo {
+	fi := ls.get(name)
+	if fi == nil || fi.flags == "d" {
+		return nil
+	}
+	return fi
+}
+
+// equal returns true if a on path i and b on path j are the same file
+func (m *multiRun) equal(i int, a *fileInfo, j int, b *fileInfo) bool {
+	if m.opt.Compare.Size && sizeDiffers(a.size, b.size) {
+		return false
+	}
+	if m.opt.Compare.Modtime && timeDiffers(m.fctx, a.time, b.time, m.fss[i], m.fss[j]) {
+		return false
+	}
+	if m.ht != hash.None && a.hash != "" && b.hash != "" && a.hash != b.hash {
+		return false
+	}
+	return true
+}
+
+// versions groups the file name on paths into its distinct versions
+func (m *multiRun) versions(name string, paths []int) (vs []*version) {
+	for _, p := range paths {
+		fi := getFile(m.now[p], name)
+		i := slices.IndexFunc(vs, func(v *version) bool { return m.equal(v.paths[0], v.info, p, fi) })
+		if i >= 0 {
+			vs[i].paths = append(vs[i].paths, p)
+		} else {
+			vs = append(vs, &version{paths: []int{p}, info: fi})
+		}
+	}
+	return vs
+}
+
+// pick chooses a version according to prefer, returning nil if there
+// isn't a clear choice
+func pick(prefer Prefer, vs []*version) *version {
+	var best *version
+	tie := false
+	for _, v := range vs {
+		var better bool
+		switch prefer {
+		case PreferPath1:
+			if slices.Contains(v.paths, 0) {
+				return v
+			}
+			continue
+		case PreferPath2:
+			if slices.Contains(v.paths, 1) {
+				return v
+			}
+			continue
+		case PreferNewer, PreferOlder:
+			if best != nil && v.info.time.Equal(best.info.time) {
+				tie = true
+				continue
+			}
+			better = best == nil || v.info.time.After(best.info.time) == (prefer == PreferNewer)
+		case PreferLarger, PreferSmaller:
+			if best != nil && v.info.size == best.info.size {
+				tie = true
+				continue
+			}
+			better = best == nil || (v.info.size > best.info.size) == (prefer == PreferLarger)
+		default:
+			return nil
+		}
+		if better {
+			best, tie = v, false
+		}
+	}
+	if tie {
+		return nil
+	}
+	return best
+}
+
+// syncFile propagates the changes to name on any path to all the
+// others, resolving conflicts if it changed on more than one path
+func (m *multiRun) syncFile(ctx context.Context, name string) error {
+	var holders, changed, live []int
+	for i := range m.fss {
+		cur, old := getFile(m.now[i], name), getFile(m.prior[i], name)
+		if cur != nil {
+			holders = append(holders, i)
+		}
+		switch {
+		case cur != nil && old == nil:
+			m.indent(pathName(i), name, "File is new")
+		case cur != nil && !m.equal(i, cur, i, old):
+			m.indent(pathName(i), name, "File changed")
+		case cur == nil && old != nil:
+			m.indent(pathName(i), name, "File was deleted")
+		default:
+			continue
+		}
+		changed = append(changed, i)
+		if cur != nil {
+			live = append(live, i)
+		}
+	}
+
+	var winner *version
+	switch {
+	case len(changed) == 0:
+		// Unchanged, but make sure every path has it, which
+		// they might not if the path was resynced
+		if len(holders) == 0 || len(holders) == len(m.fss) {
+			return nil
+		}
+		winner = m.versions(name, holders)[0]
+	case len(live) == 0:
+		// Only deletions so delete it everywhere
+		for _, p := range holders {
+			if err := m.deleteFile(ctx, p, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		// A new version beats a deletion, but different new
+		// versions are a conflict
+		vs := m.versions(name, live)
+		if len(vs) == 1 {
+			winner = vs[0]
+		} else {
+			var err error
+			winner, err = m.resolve(ctx, name, vs, holders)
+			if err != nil || winner == nil {
+				return err
+			}
+		}
+	}
+	return m.distribute(ctx, name, winner)
+}
+
+// resyncFile makes every path have the preferred version of name
+func (m *multiRun) resyncFile(ctx context.Context, name string) error {
+	var holders []int
+	for i := range m.fss {
+		if getFile(m.now[i], name) != nil {
+			holders = append(holders, i)
+		}
+	}
+	vs := m.versions(name, holders)
+	winner := pick(m.opt.ResyncMode, vs)
+	if winner == nil {
+		winner = vs[0]
+	}
+	return m.distribute(ctx, name, winner)
+}
+
+// resolve handles a conflict between the versions vs of name, which
+// holders have, returning the winner or nil if there isn't one.
+//
+// The losers are renamed on the paths which have them and copied to
+// all the others so each version is kept once on every path.
+func (m *multiRun) resolve(ctx context.Context, name string, vs []*version, holders []int) (winner *version, err error) {
+	m.indentf("!Conflict", name, "%d different versions found", len(vs))
+	if m.opt.ConflictResolve != PreferNone {
+		winner = pick(m.opt.ConflictResolve, vs)
+		if winner != nil {
+			m.indentf("INFO", name, "The winner is the version on %s", pathName(winner.paths[0]))
+		} else {
+			m.indent("INFO", name, "A winner could not be determined.")
+		}
+	}
+	if winner != nil && m.opt.ConflictLoser == ConflictLoserDelete {
+		// The losers will be overwritten by the winner
+		return winner, nil
+	}
+	var used []string
+	for _, v := range vs {
+		if v == winner {
+			continue
+		}
+		newName := m.conflictName(ctx, name, v, &used)
+		for _, p := range v.paths {
+			if err = m.moveFile(ctx, p, name, newName); err != nil {
+				return nil, err
+			}
+		}
+		for p := range m.fss {
+			if !slices.Contains(v.paths, p) {
+				if err = m.copyFile(ctx, v.paths[0], newName, p, newName, v.info); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if winner == nil {
+		// Remove the old version from the paths it didn't change on
+		for _, p := range holders {
+			if !slices.ContainsFunc(vs, func(v *version) bool { return slices.Contains(v.paths, p) }) {
+				if err = m.deleteFile(ctx, p, name); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return winner, nil
+}
+
+// conflictName chooses a new name for the losing version v of name,
+// not using any of the names in used which it adds to
+func (m *multiRun) conflictName(ctx context.Context, name string, v *version, used *[]string) string {
+	p := v.paths[0]
+	suffix := m.suffixes[p]
+	if m.opt.ConflictLoser == ConflictLoserPathname {
+		if !slices.ContainsFunc(m.suffixes, func(s string) bool { return s != suffix }) {
+			// numerate by path unless the paths have their own suffixes
+			suffix += fmt.Sprint(p + 1)
+		}
+		newName := SuffixName(ctx, name, suffix)
+		*used = append(*used, newName)
+		return newName
+	}
+	for i := 1; i < math.MaxInt; i++ {
+		newName := SuffixName(ctx, name, suffix+fmt.Sprint(i))
+		if slices.Contains(*used, newName) || slices.ContainsFunc(m.now, func(ls *fileList) bool { return ls.has(newName) }) {
+			continue
+		}
+		*used = append(*used, newName)
+		return newName
+	}
+	return name // not really possible
+}
+
+// distribute copies the winning version of name to all the paths
+// which don't have it
+func (m *multiRun) distribute(ctx context.Context, name string, winner *version) error {
+	for p := range m.fss {
+		if slices.Contains(winner.paths, p) {
+			continue
+		}
+		if cur := getFile(m.now[p], name); cur != nil && m.equal(winner.paths[0], winner.info, p, cur) {
+			continue
+		}
+		if err := m.copyFile(ctx, winner.paths[0], name, p, name, winner.info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies srcName on path from to dstName on path to. info is
+// the listing of the source.
+func (m *multiRun) copyFile(ctx context.Context, from int, srcName string, to int, dstName string, info *fileInfo) error {
+	m.indentf(pathName(from), srcName, "Queue copy to %s", pathName(to))
+	src, err := m.fss[from].NewObject(ctx, srcName)
+	if err != nil && m.opt.DryRun {
+		return nil // the source may not have been renamed in --dry-run mode
+	} else if err != nil {
+		return fmt.Errorf("failed to find %s on %s: %w", srcName, pathName(from), err)
+	}
+	dst, err := m.fss[to].NewObject(ctx, dstName)
+	if err != nil {
+		dst = nil
+	}
+	newDst, err := operations.Copy(ctx, m.fss[to], dst, dstName, src)
+	if err != nil {
+		return err
+	}
+	if newDst == nil {
+		return nil
+	}
+	var modtime time.Time
+	if m.opt.Compare.Modtime {
+		modtime = newDst.ModTime(ctx).In(TZ)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next[to].put(dstName, newDst.Size(), modtime, info.hash, "", "-")
+	if m.opt.CreateEmptySrcDirs {
+		for dir := path.Dir(dstName); dir != "." && !m.next[to].has(dir); dir = path.Dir(dir) {
+			m.next[to].put(dir, -1, time.Now().In(TZ), "", "", "d")
+		}
+	}
+	return nil
+}
+
+// moveFile renames name to newName on path p
+func (m *multiRun) moveFile(ctx context.Context, p int, name, newName string) error {
+	m.indentf(pathName(p), name, "Renaming to %s", newName)
+	o, err := m.fss[p].NewObject(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to find %s on %s: %w", name, pathName(p), err)
+	}
+	if _, err = operations.Move(ctx, m.fss[p], nil, newName, o); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if fi := m.next[p].get(name); fi != nil {
+		m.next[p].put(newName, fi.size, fi.time, fi.hash, "", "-")
+		m.next[p].remove(name)
+	}
+	return nil
+}
+
+// deleteFile deletes name on path p
+func (m *multiRun) deleteFile(ctx context.Context, p int, name string) error {
+	m.indentf(pathName(p), name, "Queue delete")
+	o, err := m.fss[p].NewObject(ctx, name)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err = operations.DeleteFile(ctx, o); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next[p].remove(name)
+	return nil
+}
+
+// syncDirs creates and removes directories on all the paths
+func (m *multiRun) syncDirs(ctx context.Context) {
+	var remove []string
+	for _, name := range m.names(true) {
+		created, deleted := false, false
+		for i := range m.fss {
+			cur, old := m.now[i].isDir(name), m.prior != nil && m.prior[i].isDir(name)
+			created = created || (cur && !old)
+			deleted = deleted || (!cur && old)
+		}
+		switch {
+		case created || (m.opt.Resync && !deleted):
+			for p := range m.fss {
+				if m.next[p].has(name) {
+					continue
+				}
+				m.indentf("INFO", name, "Making directory on %s", pathName(p))
+				if err := operations.Mkdir(ctx, m.fss[p], name); err != nil {
+					m.indentf("ERROR", name, "Failed to make directory: %v", fs.CountError(ctx, err))
+					continue
+				}
+				m.next[p].put(name, -1, time.Now().In(TZ), "", "", "d")
+			}
+		case deleted:
+			remove = append(remove, name)
+		}
+	}
+	// Remove the deepest directories first
+	slices.Reverse(remove)
+	for _, name := range remove {
+		for p := range m.fss {
+			if !m.next[p].isDir(name) {
+				continue
+			}
+			m.indentf("INFO", name, "Removing directory on %s", pathName(p))
+			if err := operations.TryRmdir(ctx, m.fss[p], name); err != nil {
+				fs.Infof(name, "Not removing directory on %s: %v", pathName(p), err)
+				continue
+			}
+			m.next[p].remove(name)
+		}
+	}
+}
+
+// checkDeletes checks that the number of deletions on each path is
+// within --max-delete
+func (m *multiRun) checkDeletes() error {
+	if m.opt.Force {
+		return nil
+	}
+	for i := range m.fss {
+		total, deleted := 0, 0
+		for name, fi := range m.prior[i].info {
+			if fi.flags == "d" {
+				continue
+			}
+			total++
+			if getFile(m.now[i], name) == nil {
+				deleted++
+			}
+		}
+		if total > 0 && deleted*100/total > m.opt.MaxDelete {
+			fs.Errorf(nil, "Excessive deletes on %s: %d of %d files deleted, more than the --max-delete limit of %d%%", pathName(i), deleted, total, m.opt.MaxDelete)
+			return errors.New("too many deletes - use --force to sync anyway")
+		}
+	}
+	return nil
+}
+
+// checkAccess checks the --check-filename files are the same on all
+// the paths
+func (m *multiRun) checkAccess() error {
+	var first []string
+	for i, ls := range m.now {
+		var found []string
+		for _, name := range ls.list {
+			if path.Base(name) == m.opt.CheckFilename && !ls.isDir(name) {
+				found = append(found, name)
+			}
+		}
+		slices.Sort(found)
+		if len(found) == 0 {
+			fs.Errorf(nil, "Access test failed: no %s files found on %s", m.opt.CheckFilename, pathName(i))
+			return errors.New("check file check failed")
+		}
+		if i == 0 {
+			first = found
+		} else if !slices.Equal(first, found) {
+			fs.Errorf(nil, "Access test failed: %s files on %s differ from those on Path1", m.opt.CheckFilename, pathName(i))
+			return errors.New("check file check failed")
+		}
+	}
+	fs.Infof(nil, "Found %d matching %q files on all paths", len(first), m.opt.CheckFilename)
+	return nil
+}
+
+// revertFailed puts the prior listing entries back for files which
+// couldn't be synced so their changes are found again on the next run
+func (m *multiRun) revertFailed() {
+	for name := range m.failed {
+		for i, ls := range m.next {
+			ls.remove(name)
+			if m.prior != nil {
+				if fi := getFile(m.prior[i], name); fi != nil {
+					ls.put(name, fi.size, fi.time, fi.hash, fi.id, fi.flags)
+				}
+			}
+		}
+	}
+}
+
+// checkSync checks that the listings of all the paths match
+func (m *multiRun) checkSync() error {
+	ok := true
+	for i := 1; i < len(m.next); i++ {
+		for _, name := range m.next[0].list {
+			if !m.next[i].has(name) {
+				m.indentf("ERROR", name, "Path1 file not found in %s", pathName(i))
+				ok = false
+				continue
+			}
+			a, b := m.next[0].get(name), m.next[i].get(name)
+			if a.flags != "d" && b.flags != "d" && !m.equal(0, a, i, b) {
+				m.indentf("ERROR", name, "Path1 file differs from %s", pathName(i))
+				ok = false
+			}
+		}
+		for _, name := range m.next[i].list {
+			if !m.next[0].has(name) {
+				m.indentf("ERROR", name, "%s file not found in Path1", pathName(i))
+				ok = false
+			}
+		}
+	}
+	if !ok {
+		return errors.New("paths are out of sync, run --resync to recover")
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package bisync_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/cmd/bisync"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBisyncMulti checks changes propagate between 3 local paths
+func TestBisyncMulti(t *testing.T) {
+	ctx, _ := fs.AddConfig(context.Background())
+	base := t.TempDir()
+	dirs := make([]string, 3)
+	fss := make([]fs.Fs, 3)
+	for i := range dirs {
+		dirs[i] = filepath.Join(base, "path"+string(rune('1'+i)))
+		require.NoError(t, os.MkdirAll(dirs[i], 0o777))
+	}
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	write := func(i int, name, contents string) {
+		path := filepath.Join(dirs[i], name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o777))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o666))
+		modTime = modTime.Add(time.Minute)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	read := func(i int, name string) string {
+		data, err := os.ReadFile(filepath.Join(dirs[i], name))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+	checkAll := func(name, want string) {
+		t.Helper()
+		for i := range dirs {
+			assert.Equal(t, want, read(i, name), "%s on path%d", name, i+1)
+		}
+	}
+	run := func(resync bool) {
+		t.Helper()
+		for i := range dirs {
+			var err error
+			fss[i], err = cache.Get(ctx, dirs[i])
+			require.NoError(t, err)
+		}
+		opt := &bisync.Options{
+			Workdir:       filepath.Join(base, "workdir"),
+			Resync:        resync,
+			MaxDelete:     bisync.DefaultMaxDelete,
+			CheckFilename: bisync.DefaultCheckFilename,
+			CheckSync:     bisync.CheckSyncTrue,
+		}
+		require.NoError(t, bisync.BisyncMulti(ctx, fss, opt))
+	}
+
+	write(0, "one.txt", "one")
+	write(1, "two.txt", "two")
+	write(2, "sub/three.txt", "three")
+	write(0, "same.txt", "same")
+	write(2, "same.txt", "same")
+	for i := range dirs {
+		write(i, "keep.txt", "keep")
+	}
+	run(true)
+	checkAll("one.txt", "one")
+	checkAll("two.txt", "two")
+	checkAll("sub/three.txt", "three")
+	checkAll("same.txt", "same")
+	for i := range dirs {
+		assert.FileExists(t, filepath.Join(base, "workdir", bisync.MultiSessionName(fss)+".path"+string(rune('1'+i))+".lst"))
+	}
+
+	// A new file, a changed file and a deleted file
+	write(1, "new.txt", "new")
+	write(2, "one.txt", "one changed")
+	require.NoError(t, os.Remove(filepath.Join(dirs[0], "two.txt")))
+	run(false)
+	checkAll("new.txt", "new")
+	checkAll("one.txt", "one changed")
+	checkAll("two.txt", "<missing>")
+
+	// A change beats a delete
+	require.NoError(t, os.Remove(filepath.Join(dirs[0], "sub", "three.txt")))
+	write(1, "sub/three.txt", "three changed")
+	run(false)
+	checkAll("sub/three.txt", "three changed")
+
+	// Equal changes don't conflict
+	write(0, "same.txt", "same changed")
+	write(1, "same.txt", "same changed")
+	require.NoError(t, os.Chtimes(filepath.Join(dirs[0], "same.txt"), modTime, modTime))
+	run(false)
+	checkAll("same.txt", "same changed")
+	checkAll("same.txt.conflict1", "<missing>")
+
+	// Different changes on every path conflict once per version
+	write(0, "keep.txt", "keep 1")
+	write(1, "keep.txt", "keep 2")
+	write(2, "keep.txt", "keep 2")
+	require.NoError(t, os.Chtimes(filepath.Join(dirs[1], "keep.txt"), modTime, modTime))
+	run(false)
+	checkAll("keep.txt", "<missing>")
+	got := []string{read(0, "keep.txt.conflict1"), read(0, "keep.txt.conflict2")}
+	assert.ElementsMatch(t, []string{"keep 1", "keep 2"}, got)
+	checkAll("keep.txt.conflict1", got[0])
+	checkAll("keep.txt.conflict2", got[1])
+	checkAll("keep.txt.conflict3", "<missing>")
+}
+
+// TestBisyncMultiUnsupported checks the flags which can't be used
+// with more than 2 paths are refused rather than ignored
+func TestBisyncMultiUnsupported(t *testing.T) {
+	ctx := context.Background()
+	fss := make([]fs.Fs, 3)
+	for i := range fss {
+		var err error
+		fss[i], err = cache.Get(ctx, t.TempDir())
+		require.NoError(t, err)
+	}
+	for _, test := range []struct {
+		flag string
+		set  func(opt *bisync.Options)
+	}{
+		{"--backup-dir1", func(opt *bisync.Options) { opt.BackupDir1 = "backup" }},
+		{"--download-hash", func(opt *bisync.Options) { opt.Compare.DownloadHash = true }},
+		{"--slow-hash-sync-only", func(opt *bisync.Options) { opt.Compare.SlowHashSyncOnly = true }},
+		{"--merge-include", func(opt *bisync.Options) { opt.MergeInclude = []string{"*.txt"} }},
+		{"--resilient", func(opt *bisync.Options) { opt.Resilient = true }},
+		{"--recover", func(opt *bisync.Options) { opt.Recover = true }},
+		{"--no-cleanup", func(opt *bisync.Options) { opt.NoCleanup = true }},
+		{"--watch", func(opt *bisync.Options) { opt.Watch = true }},
+	} {
+		opt := &bisync.Options{Workdir: t.TempDir()}
+		test.set(opt)
+		err := bisync.BisyncMulti(ctx, fss, opt)
+		assert.ErrorContains(t, err, test.flag+" can't be used with more than 2 paths")
+	}
+}
@@ -56,6 +56,7 @@ type bisyncRun struct {
 	queueOpt           bisyncQueueOpt
 	downloadHashOpt    downloadHashOpt
 	lockFileOpt        lockFileOpt
+	mergeOpt           mergeOpt
 }
 
 type queues struct {
@@ -119,6 +120,11 @@ func Bisync(ctx context.Context, fs1, fs2 fs.Fs, optArg *Options) (err error) {
 	b.newListing2 = b.listing2 + "-new"
 	b.aliases = bilib.AliasMap{}
 
+	err = b.setMergeDefaults()
+	if err != nil {
+		return err
+	}
+
 	err = b.checkSyntax()
 	if err != nil {
 		return err
@@ -178,6 +184,11 @@ func Bisync(ctx context.Context, fs1, fs2 fs.Fs, optArg *Options) (err error) {
 
 	// run bisync
 	err = b.runLocked(ctx)
+	if err == nil && !b.critical && b.opt.CheckSync != CheckSyncOnly {
+		if err := b.updateAncestors(ctx); err != nil {
+			fs.Errorf(nil, "Failed to update common ancestors for --merge-include: %v", err)
+		}
+	}
 
 	removeLockErr := b.removeLockFile()
 	if err == nil {
@@ -307,8 +318,13 @@ func (b *bisyncRun) runLocked(octx context.Context) (err error) {
 		}
 	}
 
-	fs.Infof(nil, "Building Path1 and Path2 listings")
-	b.march.ls1, b.march.ls2, err = b.makeMarchListing(fctx)
+	if opt.changed != nil {
+		fs.Infof(nil, "Updating Path1 and Path2 listings for %d changed paths", len(opt.changed))
+		b.march.ls1, b.march.ls2, err = b.makeChangedListing(fctx, opt.changed)
+	} else {
+		fs.Infof(nil, "Building Path1 and Path2 listings")
+		b.march.ls1, b.march.ls2, err = b.makeMarchListing(fctx)
+	}
 	if err != nil || accounting.Stats(fctx).Errored() {
 		fs.Error(nil, Color(terminal.RedFg, "There were errors while building listings. Aborting as it is too dangerous to continue."))
 		b.critical = true
@@ -5,6 +5,7 @@ import (
 	"context"
 	_ "embed"
 	"errors"
+	"fmt"
 	"log"
 	"path/filepath"
 	"strconv"
@@ -163,6 +164,17 @@ func rcBisync(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 		fs.Debugf("maxLock", "optional parameter is missing. using default value: %v", opt.MaxLock)
 	}
 
+	if err = in.GetStructMissingOK("mergeInclude", &opt.MergeInclude); err != nil {
+		return nil, err
+	}
+	if mergeMaxSize, err := in.GetString("mergeMaxSize"); err == nil {
+		if err = opt.MergeMaxSize.Set(mergeMaxSize); err != nil {
+			return nil, rc.NewErrParamInvalid(err)
+		}
+	} else if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+
 	fs1, err := rc.GetFsNamed(octx, in, "path1")
 	if err != nil {
 		return nil, err
@@ -173,26 +185,47 @@ func rcBisync(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 		return nil, err
 	}
 
+	// Any more paths are path3, path4, etc
+	fss := []fs.Fs{fs1, fs2}
+	for i := 3; ; i++ {
+		name := fmt.Sprintf("path%d", i)
+		if _, ok := in[name]; !ok {
+			break
+		}
+		f, err := rc.GetFsNamed(octx, in, name)
+		if err != nil {
+			return nil, err
+		}
+		fss = append(fss, f)
+	}
+
 	output := bilib.CaptureOutput(func() {
-		err = Bisync(octx, fs1, fs2, opt)
+		err = BisyncMulti(octx, fss, opt)
 	})
 
 	workDir, _ := filepath.Abs(DefaultWorkdir)
 	if opt.Workdir != "" {
 		workDir, _ = filepath.Abs(opt.Workdir)
 	}
+	session := bilib.SessionName(fs1, fs2)
 	basePath := bilib.BasePath(ctx, workDir, fs1, fs2)
+	if len(fss) > 2 {
+		session = MultiSessionName(fss)
+		basePath = filepath.Join(workDir, session)
+	}
 
 	_, _ = log.Writer().Write(output)
-	return rc.Params{
+	out = rc.Params{
 		"output":   string(output),
-		"session":  bilib.SessionName(fs1, fs2),
+		"session":  session,
 		"workDir":  workDir,
 		"basePath": basePath,
-		"listing1": basePath + ".path1.lst",
-		"listing2": basePath + ".path2.lst",
 		"logFile":  fslog.Opt.File,
-	}, err
+	}
+	for i := range fss {
+		out[fmt.Sprintf("listing%d", i+1)] = fmt.Sprintf("%s.path%d.lst", basePath, i+1)
+	}
+	return out, err
 }
 
 func setEnum(in rc.Params, name string, defaultVal string, set func(s string) error) error {
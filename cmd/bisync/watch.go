@@ -0,0 +1,251 @@
+package bisync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/terminal"
+)
+
+// watcher collects the paths which have changed since the last run
+type watcher struct {
+	mu      sync.Mutex
+	changed map[string]struct{} // paths changed relative to the roots
+	full    bool                // set if a full run is needed
+	notify  chan struct{}       // signalled when something changes
+}
+
+// Watch runs bisync between fs1 and fs2 then keeps running until ctx
+// is cancelled.
+//
+// Changes are found with the ChangeNotify feature of remotes and
+// filesystem notifications on local paths. Once they have settled
+// for --watch-delay, bisync is run again reading only the changed
+// paths. A full run is done every --watch-full-interval to catch
+// anything the notifications missed.
+func Watch(ctx context.Context, fs1, fs2 fs.Fs, optArg *Options) error {
+	opt := *optArg
+	w := &watcher{
+		changed: map[string]struct{}{},
+		notify:  make(chan struct{}, 1),
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for i, f := range []fs.Fs{fs1, fs2} {
+		if err := w.watch(ctx, f, i+1, time.Duration(opt.WatchPollInterval)); err != nil {
+			return err
+		}
+	}
+
+	full := true
+	var nextFull time.Time
+	for {
+		runOpt := opt
+		paths, needFull := w.take()
+		if full || needFull {
+			fs.Infoc(nil, Color(terminal.CyanFg, "Watch: starting full bisync run"))
+			nextFull = time.Now().Add(time.Duration(opt.WatchFullInterval))
+		} else {
+			fs.Infoc(nil, Color(terminal.CyanFg, "Watch: starting bisync run for changed paths"))
+			runOpt.changed = paths
+		}
+		err := Bisync(ctx, fs1, fs2, &runOpt)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, ErrBisyncAborted) {
+			return err
+		}
+		// Only the first run may be a resync
+		opt.Resync = false
+		opt.ResyncMode = PreferNone
+		full = err != nil
+		if err != nil {
+			fs.Errorf(nil, "Watch: bisync run failed - the next run will be a full run: %v", err)
+		}
+		if err = w.wait(ctx, nextFull, time.Duration(opt.WatchDelay), opt.WatchFullInterval > 0); err != nil {
+			return nil
+		}
+	}
+}
+
+// add marks remote as changed
+func (w *watcher) add(remote string) {
+	remote = path.Clean(remote)
+	if remote == "." || remote == "/" {
+		remote = ""
+	}
+	w.mu.Lock()
+	w.changed[remote] = struct{}{}
+	w.mu.Unlock()
+	w.signal()
+}
+
+// needFull asks for the next run to be a full run
+func (w *watcher) needFull() {
+	w.mu.Lock()
+	w.full = true
+	w.mu.Unlock()
+	w.signal()
+}
+
+// signal that something has changed without blocking
+func (w *watcher) signal() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the sorted changed paths and whether a full run is
+// needed, resetting them
+func (w *watcher) take() (paths []string, full bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for remote := range w.changed {
+		paths = append(paths, remote)
+	}
+	slices.Sort(paths)
+	full = w.full
+	clear(w.changed)
+	w.full = false
+	return paths, full
+}
+
+// pending returns true if anything has changed since the last take
+func (w *watcher) pending() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.changed) > 0 || w.full
+}
+
+// wait until something has changed and then been quiet for delay,
+// or until nextFull if doFull is set
+//
+// So that a steady stream of changes can't hold off syncing them
+// forever, it waits no more than 10 times delay after the first change.
+func (w *watcher) wait(ctx context.Context, nextFull time.Time, delay time.Duration, doFull bool) error {
+	var fullC <-chan time.Time
+	if doFull {
+		fullTimer := time.NewTimer(time.Until(nextFull))
+		defer fullTimer.Stop()
+		fullC = fullTimer.C
+	}
+	quietTimer := time.NewTimer(delay)
+	defer quietTimer.Stop()
+	var quietC <-chan time.Time
+	var first time.Time
+	changed := func() {
+		now := time.Now()
+		if first.IsZero() {
+			first = now
+		}
+		quietTimer.Reset(min(delay, first.Add(10*delay).Sub(now)))
+		quietC = quietTimer.C
+	}
+	if w.pending() {
+		changed()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-fullC:
+			w.needFull()
+			return nil
+		case <-w.notify:
+			changed()
+		case <-quietC:
+			return nil
+		}
+	}
+}
+
+// watch starts watching f for changes which are reported as path n
+func (w *watcher) watch(ctx context.Context, f fs.Fs, n int, pollInterval time.Duration) error {
+	if changeNotify := f.Features().ChangeNotify; changeNotify != nil {
+		fs.Debugf(f, "Watch: using change notifications for Path%d", n)
+		pollIntervalChan := make(chan time.Duration, 1)
+		pollIntervalChan <- pollInterval
+		changeNotify(ctx, func(remote string, _ fs.EntryType) {
+			fs.Debugf(f, "Watch: Path%d changed: %q", n, remote)
+			w.add(remote)
+		}, pollIntervalChan)
+		go func() {
+			<-ctx.Done()
+			close(pollIntervalChan)
+		}()
+		return nil
+	}
+	if f.Features().IsLocal {
+		fs.Debugf(f, "Watch: using filesystem notifications for Path%d", n)
+		return w.watchLocal(ctx, filepath.FromSlash(f.Root()), n)
+	}
+	fs.Logf(f, "Watch: Path%d doesn't support change notifications so its changes will only be found by full runs", n)
+	return nil
+}
+
+// watchLocal watches the local directory root and everything in it
+func (w *watcher) watchLocal(ctx context.Context, root string, n int) error {
+	notifier, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// fsnotify isn't recursive so add every directory
+	addDirs := func(dir string) {
+		_ = filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				err = notifier.Add(p)
+			}
+			if err != nil {
+				fs.Errorf(p, "Watch: failed to watch directory: %v", err)
+			}
+			return nil
+		})
+	}
+	addDirs(root)
+	go func() {
+		defer func() {
+			_ = notifier.Close()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-notifier.Events:
+				if !ok {
+					return
+				}
+				remote, err := filepath.Rel(root, event.Name)
+				if err != nil {
+					fs.Errorf(event.Name, "Watch: changed path outside Path%d: %v", n, err)
+					w.needFull()
+					continue
+				}
+				fs.Debugf(nil, "Watch: Path%d changed: %v", n, event)
+				if event.Has(fsnotify.Create) {
+					if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+						addDirs(event.Name)
+					}
+				}
+				w.add(filepath.ToSlash(remote))
+			case err, ok := <-notifier.Errors:
+				if !ok {
+					return
+				}
+				// for example the event queue overflowed
+				fs.Errorf(nil, "Watch: filesystem notification error for Path%d - the next run will be a full run: %v", n, err)
+				w.needFull()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,89 @@
+package bisync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileListRemoveTrees(t *testing.T) {
+	ls := newFileList()
+	for _, file := range []string{"a", "b", "b/c", "b/d/e", "bb", "f/g"} {
+		ls.put(file, 0, time.Time{}, "", "", "-")
+	}
+	ls.removeTrees([]string{"b", "f/g", "missing"})
+	assert.Equal(t, []string{"a", "bb"}, ls.list)
+	assert.Len(t, ls.info, 2)
+	ls.removeTrees([]string{""})
+	assert.True(t, ls.empty())
+	assert.Len(t, ls.info, 0)
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	base := t.TempDir()
+	dir1 := filepath.Join(base, "path1")
+	dir2 := filepath.Join(base, "path2")
+	require.NoError(t, os.MkdirAll(dir1, 0o777))
+	require.NoError(t, os.MkdirAll(dir2, 0o777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir1, "old.txt"), []byte("old"), 0o666))
+	fs1, err := cache.Get(ctx, dir1)
+	require.NoError(t, err)
+	fs2, err := cache.Get(ctx, dir2)
+	require.NoError(t, err)
+
+	opt := &Options{
+		Workdir:           filepath.Join(base, "workdir"),
+		Resync:            true,
+		MaxDelete:         DefaultMaxDelete,
+		CheckSync:         CheckSyncTrue,
+		Force:             true,
+		WatchDelay:        fs.Duration(100 * time.Millisecond),
+		WatchFullInterval: fs.Duration(time.Hour),
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- Watch(ctx, fs1, fs2, opt)
+	}()
+
+	contents := func(dir, name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+	waitFor := func(dir, name, want string) {
+		t.Helper()
+		assert.Eventually(t, func() bool { return contents(dir, name) == want }, 10*time.Second, 50*time.Millisecond, "%s in %s", name, dir)
+	}
+
+	waitFor(dir2, "old.txt", "old")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir1, "sub"), 0o777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir1, "sub", "new.txt"), []byte("new"), 0o666))
+	waitFor(dir2, "sub/new.txt", "new")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir2, "old.txt"), []byte("changed"), 0o666))
+	waitFor(dir1, "old.txt", "changed")
+
+	require.NoError(t, os.Remove(filepath.Join(dir1, "sub", "new.txt")))
+	waitFor(dir2, "sub/new.txt", "<missing>")
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Watch didn't return after cancel")
+	}
+}
@@ -499,7 +499,7 @@ func resolveExitCode(err error) {
 		os.Exit(exitcode.DirNotFound)
 	case errors.Is(err, fs.ErrorObjectNotFound):
 		os.Exit(exitcode.FileNotFound)
-	case errors.Is(err, accounting.ErrorMaxTransferLimitReached):
+	case errors.Is(err, accounting.ErrorMaxTransferLimitReached), errors.Is(err, accounting.ErrorQuotaExceeded):
 		os.Exit(exitcode.TransferExceeded)
 	case errors.Is(err, fssync.ErrorMaxDurationReached):
 		os.Exit(exitcode.DurationExceeded)
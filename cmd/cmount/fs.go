@@ -115,6 +115,20 @@ func (fsys *FS) lookupDir(path string) (dir *vfs.Dir, errc int) {
 	return dir, 0
 }
 
+// lookup a File given a path
+func (fsys *FS) lookupFile(path string) (file *vfs.File, errc int) {
+	node, errc := fsys.lookupNode(path)
+	if errc != 0 {
+		return nil, errc
+	}
+	file, ok := node.(*vfs.File)
+	if !ok {
+		// extended attributes are only supported on files
+		return nil, -fuse.ENOTSUP
+	}
+	return file, 0
+}
+
 // lookup a parent Dir given a path returning the dir and the leaf
 func (fsys *FS) lookupParentDir(filePath string) (leaf string, dir *vfs.Dir, errc int) {
 	parentDir, leaf := path.Split(filePath)
@@ -539,25 +553,51 @@ func (fsys *FS) Fsyncdir(path string, datasync bool, fh uint64) (errc int) {
 // Setxattr sets extended attributes.
 func (fsys *FS) Setxattr(path string, name string, value []byte, flags int) (errc int) {
 	defer log.Trace(path, "name=%q, value=%q, flags=%d", name, value, flags)("errc=%d", &errc)
-	return -fuse.ENOSYS
+	file, errc := fsys.lookupFile(path)
+	if errc != 0 {
+		return errc
+	}
+	return translateError(file.SetXattr(name, value, mountlib.XattrFlags(flags)))
 }
 
 // Getxattr gets extended attributes.
 func (fsys *FS) Getxattr(path string, name string) (errc int, value []byte) {
 	defer log.Trace(path, "name=%q", name)("errc=%d, value=%q", &errc, &value)
-	return -fuse.ENOSYS, nil
+	file, errc := fsys.lookupFile(path)
+	if errc != 0 {
+		return errc, nil
+	}
+	value, err := file.GetXattr(name)
+	return translateError(err), value
 }
 
 // Removexattr removes extended attributes.
 func (fsys *FS) Removexattr(path string, name string) (errc int) {
 	defer log.Trace(path, "name=%q", name)("errc=%d", &errc)
-	return -fuse.ENOSYS
+	file, errc := fsys.lookupFile(path)
+	if errc != 0 {
+		return errc
+	}
+	return translateError(file.RemoveXattr(name))
 }
 
 // Listxattr lists extended attributes.
 func (fsys *FS) Listxattr(path string, fill func(name string) bool) (errc int) {
 	defer log.Trace(path, "fill=%p", fill)("errc=%d", &errc)
-	return -fuse.ENOSYS
+	file, errc := fsys.lookupFile(path)
+	if errc != 0 {
+		return errc
+	}
+	names, err := file.ListXattr()
+	if err != nil {
+		return translateError(err)
+	}
+	for _, name := range names {
+		if !fill(name) {
+			return -fuse.ERANGE
+		}
+	}
+	return 0
 }
 
 // Getpath allows a case-insensitive file system to report the correct case of
@@ -606,6 +646,12 @@ func translateError(err error) (errc int) {
 		return -fuse.EINVAL
 	case vfs.ELOOP:
 		return -fuse.ELOOP
+	case vfs.ENOATTR:
+		return -fuse.ENOATTR
+	case vfs.ENOTSUP:
+		return -fuse.ENOTSUP
+	case vfs.ENOSPC:
+		return -fuse.ENOSPC
 	}
 	fs.Errorf(nil, "IO error: %v", err)
 	return -fuse.EIO
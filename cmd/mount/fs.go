@@ -102,6 +102,12 @@ func translateError(err error) error {
 		return fuse.Errno(syscall.EINVAL)
 	case vfs.ELOOP:
 		return fuse.Errno(syscall.ELOOP)
+	case vfs.ENOATTR:
+		return fuse.ErrNoXattr
+	case vfs.ENOTSUP:
+		return fuse.Errno(syscall.ENOTSUP)
+	case vfs.ENOSPC:
+		return fuse.Errno(syscall.ENOSPC)
 	}
 	fs.Errorf(nil, "IO error: %v", err)
 	return err
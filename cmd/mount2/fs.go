@@ -135,6 +135,12 @@ func translateError(err error) syscall.Errno {
 		return syscall.EINVAL
 	case vfs.ELOOP:
 		return syscall.ELOOP
+	case vfs.ENOATTR:
+		return syscall.Errno(fuse.ENOATTR)
+	case vfs.ENOTSUP:
+		return syscall.ENOTSUP
+	case vfs.ENOSPC:
+		return syscall.ENOSPC
 	}
 	fs.Errorf(nil, "IO error: %v", err)
 	return syscall.EIO
@@ -435,12 +435,44 @@ func (n *Node) Rename(ctx context.Context, oldName string, newParent fusefs.Inod
 
 var _ = (fusefs.NodeRenamer)((*Node)(nil))
 
+// xattrFile returns the file extended attributes are read from
+//
+// Extended attributes are only supported on files.
+func (n *Node) xattrFile() (*vfs.File, syscall.Errno) {
+	file, ok := n.node.(*vfs.File)
+	if !ok {
+		return nil, syscall.ENOTSUP
+	}
+	return file, 0
+}
+
+// copyXattr copies value into dest returning its size, or ERANGE if
+// dest isn't empty but is too small.
+func copyXattr(value []byte, dest []byte) (uint32, syscall.Errno) {
+	if len(dest) == 0 {
+		return uint32(len(value)), 0
+	}
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+	return uint32(copy(dest, value)), 0
+}
+
 // Getxattr should read data for the given attribute into
 // `dest` and return the number of bytes. If `dest` is too
 // small, it should return ERANGE and the size of the attribute.
 // If not defined, Getxattr will return ENOATTR.
-func (n *Node) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
-	return 0, syscall.ENOSYS // we never implement this
+func (n *Node) Getxattr(ctx context.Context, attr string, dest []byte) (size uint32, errno syscall.Errno) {
+	defer log.Trace(n, "attr=%q", attr)("size=%d, errno=%v", &size, &errno)
+	file, errno := n.xattrFile()
+	if errno != 0 {
+		return 0, errno
+	}
+	value, err := file.GetXattr(attr)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return copyXattr(value, dest)
 }
 
 var _ fusefs.NodeGetxattrer = (*Node)(nil)
@@ -448,16 +480,26 @@ var _ fusefs.NodeGetxattrer = (*Node)(nil)
 // Setxattr should store data for the given attribute.  See
 // setxattr(2) for information about flags.
 // If not defined, Setxattr will return ENOATTR.
-func (n *Node) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
-	return syscall.ENOSYS // we never implement this
+func (n *Node) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) (errno syscall.Errno) {
+	defer log.Trace(n, "attr=%q, data=%q, flags=%d", attr, data, flags)("errno=%v", &errno)
+	file, errno := n.xattrFile()
+	if errno != 0 {
+		return errno
+	}
+	return translateError(file.SetXattr(attr, data, mountlib.XattrFlags(int(flags))))
 }
 
 var _ fusefs.NodeSetxattrer = (*Node)(nil)
 
 // Removexattr should delete the given attribute.
 // If not defined, Removexattr will return ENOATTR.
-func (n *Node) Removexattr(ctx context.Context, attr string) syscall.Errno {
-	return syscall.ENOSYS // we never implement this
+func (n *Node) Removexattr(ctx context.Context, attr string) (errno syscall.Errno) {
+	defer log.Trace(n, "attr=%q", attr)("errno=%v", &errno)
+	file, errno := n.xattrFile()
+	if errno != 0 {
+		return errno
+	}
+	return translateError(file.RemoveXattr(attr))
 }
 
 var _ fusefs.NodeRemovexattrer = (*Node)(nil)
@@ -466,8 +508,22 @@ var _ fusefs.NodeRemovexattrer = (*Node)(nil)
 // `dest`. If the `dest` buffer is too small, it should return ERANGE
 // and the correct size.  If not defined, return an empty list and
 // success.
-func (n *Node) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
-	return 0, syscall.ENOSYS // we never implement this
+func (n *Node) Listxattr(ctx context.Context, dest []byte) (size uint32, errno syscall.Errno) {
+	defer log.Trace(n, "")("size=%d, errno=%v", &size, &errno)
+	file, errno := n.xattrFile()
+	if errno != 0 {
+		return 0, errno
+	}
+	names, err := file.ListXattr()
+	if err != nil {
+		return 0, translateError(err)
+	}
+	var list []byte
+	for _, name := range names {
+		list = append(list, name...)
+		list = append(list, 0)
+	}
+	return copyXattr(list, dest)
 }
 
 var _ fusefs.NodeListxattrer = (*Node)(nil)
@@ -0,0 +1,23 @@
+//go:build darwin
+
+package mountlib
+
+import "github.com/rclone/rclone/vfs"
+
+// Flags for setxattr(2) on macOS
+const (
+	xattrCreate  = 0x0002
+	xattrReplace = 0x0004
+)
+
+// XattrFlags converts the flags passed to setxattr into the flags for
+// vfs.File.SetXattr
+func XattrFlags(flags int) (vfsFlags int) {
+	if flags&xattrCreate != 0 {
+		vfsFlags |= vfs.XattrCreate
+	}
+	if flags&xattrReplace != 0 {
+		vfsFlags |= vfs.XattrReplace
+	}
+	return vfsFlags
+}
@@ -0,0 +1,13 @@
+//go:build !darwin
+
+package mountlib
+
+import "github.com/rclone/rclone/vfs"
+
+// XattrFlags converts the flags passed to setxattr into the flags for
+// vfs.File.SetXattr
+//
+// These are the same as the Linux flags, which WinFsp uses too.
+func XattrFlags(flags int) int {
+	return flags & (vfs.XattrCreate | vfs.XattrReplace)
+}
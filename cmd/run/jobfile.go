@@ -0,0 +1,222 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/filter"
+	"gopkg.in/yaml.v3"
+)
+
+// jobFile is the contents of a job file
+type jobFile struct {
+	Concurrency int            `yaml:"concurrency" toml:"concurrency"` // number of jobs to run at once
+	Config      map[string]any `yaml:"config" toml:"config"`           // config for all the jobs
+	Filter      map[string]any `yaml:"filter" toml:"filter"`           // filters for all the jobs
+	Jobs        []*job         `yaml:"jobs" toml:"jobs"`
+}
+
+// job is a single job in the job file
+type job struct {
+	Name               string         `yaml:"name" toml:"name"`
+	Command            string         `yaml:"command" toml:"command"` // copy, sync or move
+	Source             string         `yaml:"source" toml:"source"`
+	Destination        string         `yaml:"destination" toml:"destination"`
+	CreateEmptySrcDirs bool           `yaml:"create_empty_src_dirs" toml:"create_empty_src_dirs"`
+	DeleteEmptySrcDirs bool           `yaml:"delete_empty_src_dirs" toml:"delete_empty_src_dirs"`
+	Schedule           string         `yaml:"schedule" toml:"schedule"`
+	Config             map[string]any `yaml:"config" toml:"config"` // overrides the config of the job file
+	Filter             map[string]any `yaml:"filter" toml:"filter"` // overrides the filters of the job file
+
+	schedule *schedule // parsed Schedule or nil
+}
+
+// commands are the commands a job can run
+var commands = []string{"copy", "sync", "move"}
+
+// loadJobFile reads and checks the job file at path
+//
+// Files ending in .toml are read as TOML, anything else as YAML.
+func loadJobFile(path string) (*jobFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &jobFile{}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		dec := toml.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(file)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+	if err := file.check(); err != nil {
+		return nil, fmt.Errorf("%q: %w", path, err)
+	}
+	return file, nil
+}
+
+// check the job file is valid and parse the schedules
+func (file *jobFile) check() error {
+	if file.Concurrency == 0 {
+		file.Concurrency = 1
+	}
+	if file.Concurrency < 0 {
+		return errors.New("concurrency must be positive")
+	}
+	if len(file.Jobs) == 0 {
+		return errors.New("no jobs found")
+	}
+	names := map[string]bool{}
+	for i, j := range file.Jobs {
+		if j.Name == "" {
+			return fmt.Errorf("job %d: needs a name", i+1)
+		}
+		if names[j.Name] {
+			return fmt.Errorf("job %q: name used more than once", j.Name)
+		}
+		names[j.Name] = true
+		if j.Command == "" {
+			j.Command = "copy"
+		}
+		if !slices.Contains(commands, j.Command) {
+			return fmt.Errorf("job %q: unknown command %q - expecting one of %s", j.Name, j.Command, strings.Join(commands, ", "))
+		}
+		if j.Source == "" || j.Destination == "" {
+			return fmt.Errorf("job %q: needs a source and a destination", j.Name)
+		}
+		if j.Schedule != "" {
+			sched, err := parseSchedule(j.Schedule)
+			if err != nil {
+				return fmt.Errorf("job %q: %w", j.Name, err)
+			}
+			j.schedule = sched
+		}
+		// Check the options now rather than when the job runs
+		if _, err := j.context(context.Background(), file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// optionsMap merges the options in maps into a configmap, later maps
+// overriding earlier ones
+//
+// Option names may be written as the flag name or the config name,
+// so "--max-age", "max-age" and "max_age" are all the same.
+func optionsMap(maps ...map[string]any) (configmap.Simple, error) {
+	m := configmap.Simple{}
+	for _, opts := range maps {
+		for key, value := range opts {
+			key = strings.ReplaceAll(strings.TrimLeft(key, "-"), "-", "_")
+			var s string
+			switch x := value.(type) {
+			case []any:
+				list := make([]string, len(x))
+				for i, item := range x {
+					list[i] = fmt.Sprint(item)
+				}
+				var err error
+				s, err = configstruct.InterfaceToString(list)
+				if err != nil {
+					return nil, fmt.Errorf("option %q: %w", key, err)
+				}
+			case map[string]any:
+				return nil, fmt.Errorf("option %q: can't be a map", key)
+			default:
+				s = fmt.Sprint(x)
+			}
+			m[key] = s
+		}
+	}
+	return m, nil
+}
+
+// setOptions sets the options in maps into opt which should be a
+// pointer to an options struct, returning an error for any unknown
+// options
+func setOptions(opt any, maps ...map[string]any) error {
+	m, err := optionsMap(maps...)
+	if err != nil {
+		return err
+	}
+	items, err := configstruct.Items(opt)
+	if err != nil {
+		return err
+	}
+	for key := range m {
+		if !slices.ContainsFunc(items, func(item configstruct.Item) bool { return item.Name == key }) {
+			return fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return configstruct.Set(m, opt)
+}
+
+// globalOptions are config options which are read once when rclone
+// starts and apply to all the transfers rclone does, so setting them
+// for a job would have no effect.
+var globalOptions = []string{
+	// Limits shared by all the transfers
+	"bwlimit", "tpslimit", "tpslimit_burst", "quota",
+	// The HTTP transport shared by all the backends
+	"ca_cert", "client_cert", "client_key", "client_pass",
+	"disable_http2", "disable_http_keep_alives", "http_proxy", "use_cookies",
+	// Buffers, caches and stats shared by all the jobs
+	"use_mmap", "max_buffer_memory", "fs_cache_expire_duration",
+	"fs_cache_expire_interval", "max_stats_groups",
+	// Set up when rclone starts
+	"ask_password", "password_command", "no_console", "progress",
+	"progress_terminal_title",
+}
+
+// checkGlobalOptions returns an error if any of the globalOptions
+// are set in maps
+func checkGlobalOptions(maps ...map[string]any) error {
+	m, err := optionsMap(maps...)
+	if err != nil {
+		return err
+	}
+	for _, name := range globalOptions {
+		if _, found := m[name]; found {
+			return fmt.Errorf("option %q applies to all the jobs at once so can't be set in a job file - use the --%s flag instead", name, strings.ReplaceAll(name, "_", "-"))
+		}
+	}
+	return nil
+}
+
+// context returns a copy of ctx with the config and filters of the
+// job applied
+func (j *job) context(ctx context.Context, file *jobFile) (context.Context, error) {
+	ctx, ci := fs.AddConfig(ctx)
+	if err := checkGlobalOptions(file.Config, j.Config); err != nil {
+		return nil, fmt.Errorf("job %q: config: %w", j.Name, err)
+	}
+	if err := setOptions(ci, file.Config, j.Config); err != nil {
+		return nil, fmt.Errorf("job %q: config: %w", j.Name, err)
+	}
+	opt := filter.GetConfig(ctx).Opt
+	if err := setOptions(&opt, file.Filter, j.Filter); err != nil {
+		return nil, fmt.Errorf("job %q: filter: %w", j.Name, err)
+	}
+	fi, err := filter.NewFilter(&opt)
+	if err != nil {
+		return nil, fmt.Errorf("job %q: filter: %w", j.Name, err)
+	}
+	return filter.ReplaceConfig(ctx, fi), nil
+}
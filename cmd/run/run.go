@@ -0,0 +1,360 @@
+// Package run provides the run command.
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+	_ "github.com/rclone/rclone/fs/sync" // register the sync/* rc calls
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	once     = false
+	onlyJobs []string
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.BoolVarP(cmdFlags, &once, "once", "", once, "Run every job once ignoring the schedules", "")
+	flags.StringArrayVarP(cmdFlags, &onlyJobs, "job", "", onlyJobs, "Only run the job with this name (can be repeated)", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "run jobfile",
+	Short: `Run the copy, sync and move jobs described in a job file.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Run the jobs described in a YAML or TOML job file.
+
+Each job copies, syncs or moves a source to a destination with its own
+filters and config, and may have a schedule to run it repeatedly. This
+replaces a script or crontab full of rclone command lines with a single
+file. Files ending in |.toml| are read as TOML, anything else as YAML.
+
+|||yaml
+# Number of jobs to run at the same time (default 1)
+concurrency: 2
+# Config and filters for all the jobs
+config:
+  transfers: 8
+filter:
+  exclude:
+    - "*.tmp"
+jobs:
+  - name: photos
+    command: copy
+    source: /home/user/Pictures
+    destination: s3:bucket/pictures
+    schedule: "0 3 * * *"
+  - name: documents
+    command: sync
+    source: /home/user/Documents
+    destination: drive:Documents
+    schedule: "@every 1h"
+    config:
+      bwlimit_file: 1M
+      checksum: true
+    filter:
+      max_age: 1y
+|||
+
+Each job has these fields:
+
+- |name| - the name of the job, which must be unique
+- |command| - one of |copy| (the default), |sync| or |move|
+- |source| and |destination| - the paths to copy from and to
+- |create_empty_src_dirs| - create empty source directories in the destination
+- |delete_empty_src_dirs| - delete empty source directories after a move
+- |schedule| - when to run the job, see below
+- |config| - global flags for this job
+- |filter| - filter flags for this job
+
+The |config| section takes the global flags and the |filter| section
+takes the [filter flags](/filtering/). Options may be written as the
+flag name, e.g. |max-age|, or with underscores, e.g. |max_age|. Options in a job override those at the top level of
+the file, which override the command line flags. Options taking a list
+of values, like |exclude| or |header|, may be given as a list.
+
+Some flags are read once when rclone starts and are shared by all the
+jobs, so they can only be set on the command line and it is an error
+to set them in the job file. These are
+
+- the limits set by |--bwlimit|, |--tpslimit|, |--tpslimit-burst| and
+  |--quota|
+- the HTTP settings |--ca-cert|, |--client-cert|, |--client-key|,
+  |--client-pass|, |--disable-http2|, |--disable-http-keep-alives|,
+  |--http-proxy| and |--use-cookies|
+- |--use-mmap|, |--max-buffer-memory|, |--fs-cache-expire-duration|,
+  |--fs-cache-expire-interval| and |--max-stats-groups|
+- |--ask-password|, |--password-command|, |--no-console|, |--progress|
+  and |--progress-terminal-title|
+
+Use |bwlimit_file| to limit the bandwidth of each transfer in a job.
+
+The schedule is either a 5 field cron line (minute, hour, day of month,
+month and day of week in local time), one of |@hourly|, |@daily|,
+|@weekly|, |@monthly| and |@yearly|, or |@every| followed by a
+duration such as |@every 30m|.
+
+Each job runs as an rc job with its own stats group named after the
+job, so while |rclone run| is running with |--rc| the progress of each
+job can be seen with |rclone rc core/stats group=photos|. Each job is
+retried as set by |--retries| in its config.
+
+If none of the jobs have a schedule, or |--once| is used, each job is
+run once, a summary of the results is printed and rclone exits. If any
+of the jobs fail the exit code is non-zero.
+
+Otherwise the jobs without a schedule are run once at the start and
+the others are run on their schedules until rclone is stopped. The
+result of each run is logged when it finishes. A scheduled run is
+skipped if the previous run of the same job is still going.
+
+Use |--job| to run only some of the jobs in the file, e.g.
+
+|||sh
+rclone run jobs.yaml --once --job photos
+|||
+`, "|", "`"),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.75",
+		"groups":            "Copy,Filter,Listing,Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		file, err := loadJobFile(args[0])
+		if err != nil {
+			fs.Fatal(nil, err.Error())
+		}
+		if err := file.selectJobs(onlyJobs); err != nil {
+			fs.Fatal(nil, err.Error())
+		}
+		cmd.Run(false, false, command, func() error {
+			ctx := context.Background()
+			if once || !file.scheduled() {
+				return runAll(ctx, file, os.Stdout)
+			}
+			return runScheduled(ctx, file)
+		})
+	},
+}
+
+// selectJobs removes the jobs not named in names, if there are any
+func (file *jobFile) selectJobs(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(file.Jobs, func(j *job) bool { return j.Name == name }) {
+			return fmt.Errorf("job %q not found", name)
+		}
+	}
+	file.Jobs = slices.DeleteFunc(file.Jobs, func(j *job) bool { return !slices.Contains(names, j.Name) })
+	return nil
+}
+
+// scheduled returns true if any of the jobs have a schedule
+func (file *jobFile) scheduled() bool {
+	return slices.ContainsFunc(file.Jobs, func(j *job) bool { return j.schedule != nil })
+}
+
+// result is the outcome of running a job
+type result struct {
+	name      string
+	start     time.Time
+	duration  time.Duration
+	transfers int64
+	bytes     int64
+	errors    int64
+	err       error
+}
+
+// String returns a one line description of the result
+func (r *result) String() string {
+	if r.err != nil {
+		return fmt.Sprintf("job %q failed after %v with %d errors: %v", r.name, r.duration.Truncate(time.Millisecond), r.errors, r.err)
+	}
+	return fmt.Sprintf("job %q succeeded in %v transferring %d files (%v)", r.name, r.duration.Truncate(time.Millisecond), r.transfers, fs.SizeSuffix(r.bytes).ByteUnit())
+}
+
+// runJob runs the job j once, retrying as set by its config
+func runJob(ctx context.Context, file *jobFile, j *job) (r *result) {
+	r = &result{
+		name:  j.Name,
+		start: time.Now(),
+	}
+	stats := accounting.StatsGroup(ctx, j.Name)
+	defer func() {
+		r.duration = time.Since(r.start)
+		r.transfers = stats.GetTransfers()
+		r.bytes = stats.GetBytes()
+		r.errors = stats.GetErrors()
+		if r.err != nil && r.errors == 0 {
+			r.errors = 1
+		}
+	}()
+	ctx, err := j.context(ctx, file)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	ci := fs.GetConfig(ctx)
+	call := rc.Calls.Get("sync/" + j.Command)
+	if call == nil {
+		r.err = fmt.Errorf("job %q: rc call sync/%s not found", j.Name, j.Command)
+		return r
+	}
+	in := rc.Params{
+		"srcFs":              j.Source,
+		"dstFs":              j.Destination,
+		"createEmptySrcDirs": j.CreateEmptySrcDirs,
+		"_group":             j.Name,
+	}
+	if j.Command == "move" {
+		in["deleteEmptySrcDirs"] = j.DeleteEmptySrcDirs
+	}
+	stats.ResetCounters()
+	fs.Infof(nil, "Starting job %q: %s %s to %s", j.Name, j.Command, j.Source, j.Destination)
+	for try := 1; try <= max(ci.Retries, 1); try++ {
+		_, _, err = jobs.NewJob(ctx, call.Fn, in)
+		if err == nil {
+			err = stats.GetLastError()
+		}
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		if stats.HadFatalError() {
+			fs.Errorf(nil, "Job %q: fatal error received - not attempting retries", j.Name)
+			break
+		}
+		if !stats.HadRetryError() {
+			fs.Errorf(nil, "Job %q: can't retry any of the errors - not attempting retries", j.Name)
+			break
+		}
+		fs.Errorf(nil, "Job %q: attempt %d/%d failed with %d errors and: %v", j.Name, try, ci.Retries, stats.GetErrors(), err)
+		if try < ci.Retries {
+			stats.ResetErrors()
+			time.Sleep(time.Duration(ci.RetriesInterval))
+		}
+	}
+	r.err = err
+	return r
+}
+
+// runAll runs each job once, writing a summary of the results to out
+func runAll(ctx context.Context, file *jobFile, out io.Writer) error {
+	results := make([]*result, len(file.Jobs))
+	var g errgroup.Group
+	g.SetLimit(file.Concurrency)
+	for i, j := range file.Jobs {
+		g.Go(func() error {
+			results[i] = runJob(ctx, file, j)
+			fs.Infof(nil, "%v", results[i])
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return summarise(results, out)
+}
+
+// summarise writes a table of the results to out returning an error
+// if any of them failed
+func summarise(results []*result, out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "JOB\tRESULT\tTRANSFERS\tBYTES\tERRORS\tDURATION\t")
+	failed := 0
+	for _, r := range results {
+		status := "OK"
+		if r.err != nil {
+			status = "FAILED"
+			failed++
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%v\t%d\t%v\t\n", r.name, status, r.transfers, fs.SizeSuffix(r.bytes).ByteUnit(), r.errors, r.duration.Truncate(time.Millisecond))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.err != nil {
+			_, _ = fmt.Fprintf(out, "%s: %v\n", r.name, r.err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs failed", failed, len(results))
+	}
+	return nil
+}
+
+// runScheduled runs the unscheduled jobs once and the scheduled jobs
+// on their schedules until ctx is cancelled
+func runScheduled(ctx context.Context, file *jobFile) error {
+	sem := make(chan struct{}, file.Concurrency)
+	run := func(j *job) {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		r := runJob(ctx, file, j)
+		<-sem
+		if r.err != nil {
+			fs.Errorf(nil, "%v", r)
+		} else {
+			fs.Logf(nil, "%v", r)
+		}
+	}
+	var wg sync.WaitGroup
+	for _, j := range file.Jobs {
+		if j.schedule == nil {
+			wg.Go(func() { run(j) })
+			continue
+		}
+		wg.Go(func() {
+			var running sync.Mutex
+			for {
+				next := j.schedule.next(time.Now())
+				if next.IsZero() {
+					fs.Errorf(nil, "Job %q: schedule %q never runs", j.Name, j.Schedule)
+					return
+				}
+				fs.Debugf(nil, "Job %q: next run at %v", j.Name, next.Format(time.RFC3339))
+				timer := time.NewTimer(time.Until(next))
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+				if !running.TryLock() {
+					fs.Logf(nil, "Job %q: skipping scheduled run as the previous run is still going", j.Name)
+					continue
+				}
+				wg.Go(func() {
+					defer running.Unlock()
+					run(j)
+				})
+			}
+		})
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
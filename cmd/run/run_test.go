@@ -0,0 +1,273 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain drives the tests
+func TestMain(m *testing.M) {
+	fstest.TestMain(m)
+}
+
+func TestParseSchedule(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		err bool
+	}{
+		{in: "@every 1h"},
+		{in: "@every 10s"},
+		{in: "@daily"},
+		{in: "*/15 * * * *"},
+		{in: "0 3 * * 1-5"},
+		{in: "0,30 8-18/2 1 1,6 7"},
+		{in: "@every 1ms", err: true},
+		{in: "@every often", err: true},
+		{in: "@fortnightly", err: true},
+		{in: "* * * *", err: true},
+		{in: "60 * * * *", err: true},
+		{in: "* 24 * * *", err: true},
+		{in: "* * 0 * *", err: true},
+		{in: "* * * 13 *", err: true},
+		{in: "* * * * 8", err: true},
+		{in: "5-1 * * * *", err: true},
+		{in: "*/0 * * * *", err: true},
+		{in: "a * * * *", err: true},
+	} {
+		_, err := parseSchedule(test.in)
+		if test.err {
+			assert.Error(t, err, test.in)
+		} else {
+			assert.NoError(t, err, test.in)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		require.NoError(t, err)
+		return tm
+	}
+	// 2026-10-18 is a Sunday
+	now := at("2026-10-18 12:34").Add(17 * time.Second)
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"* * * * *", "2026-10-18 12:35"},
+		{"*/15 * * * *", "2026-10-18 12:45"},
+		{"0 3 * * *", "2026-10-19 03:00"},
+		{"@hourly", "2026-10-18 13:00"},
+		{"@monthly", "2026-11-01 00:00"},
+		{"@yearly", "2027-01-01 00:00"},
+		{"30 9 * * 1-5", "2026-10-19 09:30"},
+		{"0 0 * * 7", "2026-10-25 00:00"},
+		{"0 0 13 * 5", "2026-10-23 00:00"}, // the 13th or a Friday
+		{"0 0 29 2 *", "2028-02-29 00:00"},
+		{"0 0 31 2 *", ""},
+	} {
+		sched, err := parseSchedule(test.in)
+		require.NoError(t, err, test.in)
+		got := sched.next(now)
+		if test.want == "" {
+			assert.True(t, got.IsZero(), test.in)
+		} else {
+			assert.Equal(t, at(test.want), got, test.in)
+		}
+	}
+	sched, err := parseSchedule("@every 90m")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(90*time.Minute), sched.next(now))
+}
+
+// writeFile writes a file with contents in dir returning its path
+func writeFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o777))
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o666))
+	return path
+}
+
+func TestLoadJobFile(t *testing.T) {
+	dir := t.TempDir()
+
+	file, err := loadJobFile(writeFile(t, dir, "jobs.yaml", `
+config:
+  transfers: 8
+filter:
+  exclude:
+    - "*.tmp"
+jobs:
+  - name: one
+    source: /src
+    destination: /dst
+    schedule: "@daily"
+    config:
+      --checksum: true
+    filter:
+      max-age: 1d
+  - name: two
+    command: sync
+    source: /src2
+    destination: /dst2
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, file.Concurrency)
+	require.Len(t, file.Jobs, 2)
+	assert.Equal(t, "copy", file.Jobs[0].Command)
+	assert.NotNil(t, file.Jobs[0].schedule)
+	assert.Nil(t, file.Jobs[1].schedule)
+	assert.True(t, file.scheduled())
+
+	ctx, err := file.Jobs[0].context(context.Background(), file)
+	require.NoError(t, err)
+	ci := fs.GetConfig(ctx)
+	assert.Equal(t, 8, ci.Transfers)
+	assert.True(t, ci.CheckSum)
+	fi := filter.GetConfig(ctx)
+	assert.Equal(t, []string{"*.tmp"}, fi.Opt.ExcludeRule)
+	assert.Equal(t, fs.Duration(24*time.Hour), fi.Opt.MaxAge)
+	assert.False(t, fs.GetConfig(context.Background()).CheckSum)
+
+	ctx, err = file.Jobs[1].context(context.Background(), file)
+	require.NoError(t, err)
+	assert.False(t, fs.GetConfig(ctx).CheckSum)
+	assert.NotEqual(t, fs.Duration(24*time.Hour), filter.GetConfig(ctx).Opt.MaxAge)
+
+	require.NoError(t, file.selectJobs([]string{"two"}))
+	require.Len(t, file.Jobs, 1)
+	assert.False(t, file.scheduled())
+	assert.Error(t, file.selectJobs([]string{"three"}))
+
+	file, err = loadJobFile(writeFile(t, dir, "jobs.toml", `
+concurrency = 3
+
+[[jobs]]
+name = "one"
+command = "move"
+source = "/src"
+destination = "/dst"
+delete_empty_src_dirs = true
+
+[jobs.config]
+bwlimit_file = "1M"
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 3, file.Concurrency)
+	require.Len(t, file.Jobs, 1)
+	assert.Equal(t, "move", file.Jobs[0].Command)
+	assert.True(t, file.Jobs[0].DeleteEmptySrcDirs)
+
+	// The per transfer bandwidth limit is read from the job config
+	// when each transfer starts
+	ctx, err = file.Jobs[0].context(context.Background(), file)
+	require.NoError(t, err)
+	limit := fs.GetConfig(ctx).BwLimitFile.LimitAt(time.Now())
+	assert.Equal(t, fs.SizeSuffix(1024*1024), limit.Bandwidth.Tx)
+	limit = fs.GetConfig(context.Background()).BwLimitFile.LimitAt(time.Now())
+	assert.False(t, limit.Bandwidth.IsSet())
+
+	// The global limits can't be set per job
+	for _, contents := range []string{
+		"jobs:\n  - {name: a, source: /a, destination: /b, config: {bwlimit: 1M}}\n",
+		"config: {tpslimit: 10}\njobs:\n  - {name: a, source: /a, destination: /b}\n",
+		"jobs:\n  - {name: a, source: /a, destination: /b, config: {--tpslimit-burst: 10}}\n",
+		"jobs:\n  - {name: a, source: /a, destination: /b, config: {quota: [\"remote:egress=1G\"]}}\n",
+		"jobs:\n  - {name: a, source: /a, destination: /b, config: {http-proxy: \"http://proxy\"}}\n",
+	} {
+		_, err := loadJobFile(writeFile(t, dir, "global.yaml", contents))
+		assert.ErrorContains(t, err, "can't be set in a job file", contents)
+	}
+
+	for _, test := range []struct {
+		name     string
+		contents string
+	}{
+		{"empty.yaml", ``},
+		{"unknown.yaml", "jobs:\n  - name: a\n    source: /a\n    destination: /b\n    colour: red\n"},
+		{"unknown.toml", "[[jobs]]\nname = \"a\"\nsource = \"/a\"\ndestination = \"/b\"\ncolour = \"red\"\n"},
+		{"noname.yaml", "jobs:\n  - source: /a\n    destination: /b\n"},
+		{"dup.yaml", "jobs:\n  - {name: a, source: /a, destination: /b}\n  - {name: a, source: /a, destination: /b}\n"},
+		{"command.yaml", "jobs:\n  - {name: a, command: delete, source: /a, destination: /b}\n"},
+		{"nodst.yaml", "jobs:\n  - {name: a, source: /a}\n"},
+		{"schedule.yaml", "jobs:\n  - {name: a, source: /a, destination: /b, schedule: sometimes}\n"},
+		{"config.yaml", "jobs:\n  - {name: a, source: /a, destination: /b, config: {colour: red}}\n"},
+		{"value.yaml", "jobs:\n  - {name: a, source: /a, destination: /b, config: {transfers: lots}}\n"},
+		{"filter.yaml", "jobs:\n  - {name: a, source: /a, destination: /b, filter: {max_size: huge}}\n"},
+		{"concurrency.yaml", "concurrency: -1\njobs:\n  - {name: a, source: /a, destination: /b}\n"},
+	} {
+		_, err := loadJobFile(writeFile(t, dir, test.name, test.contents))
+		assert.Error(t, err, test.name)
+	}
+	_, err = loadJobFile(filepath.Join(dir, "notfound.yaml"))
+	assert.Error(t, err)
+}
+
+func TestRunAll(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, src, "file1.txt", "hello")
+	writeFile(t, src, "file2.tmp", "temporary")
+	writeFile(t, src, "sub/file3.txt", "world!")
+	dst1 := filepath.Join(dir, "dst1")
+	dst2 := filepath.Join(dir, "dst2")
+	writeFile(t, dst2, "extra.txt", "deleted by sync")
+
+	file, err := loadJobFile(writeFile(t, dir, "jobs.yaml", `
+concurrency: 2
+filter:
+  exclude:
+    - "*.tmp"
+jobs:
+  - name: copy
+    source: `+src+`
+    destination: `+dst1+`
+  - name: sync
+    command: sync
+    source: `+src+`
+    destination: `+dst2+`
+    filter:
+      exclude:
+        - "*.tmp"
+        - "sub/**"
+    config:
+      retries: 1
+  - name: broken
+    source: `+filepath.Join(dir, "notfound")+`
+    destination: `+dst1+`
+    config:
+      retries: 1
+`))
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	err = runAll(ctx, file, &out)
+	require.Error(t, err)
+	assert.Equal(t, "1 of 3 jobs failed", err.Error())
+	summary := out.String()
+	assert.Regexp(t, `(?m)^copy +OK +2 +11 B +0 `, summary)
+	assert.Regexp(t, `(?m)^sync +OK +1 +5 B +0 `, summary)
+	assert.Regexp(t, `(?m)^broken +FAILED +0 +0 B +1 `, summary)
+	assert.Regexp(t, `(?m)^broken: .*directory not found`, summary)
+
+	assert.FileExists(t, filepath.Join(dst1, "file1.txt"))
+	assert.FileExists(t, filepath.Join(dst1, "sub", "file3.txt"))
+	assert.NoFileExists(t, filepath.Join(dst1, "file2.tmp"))
+	assert.FileExists(t, filepath.Join(dst2, "file1.txt"))
+	assert.NoFileExists(t, filepath.Join(dst2, "file2.tmp"))
+	assert.NoFileExists(t, filepath.Join(dst2, "sub", "file3.txt"))
+	assert.NoFileExists(t, filepath.Join(dst2, "extra.txt"))
+}
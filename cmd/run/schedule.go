@@ -0,0 +1,183 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// schedule says when a job should run
+type schedule struct {
+	every time.Duration // run at this interval if set, otherwise use the fields
+
+	// bit sets of the allowed values of each field
+	minute, hour, dom, month, dow uint64
+
+	// set if the field is "*"
+	domStar, dowStar bool
+}
+
+// cronField describes a field of a cron line
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cronShortcuts are the @ names for common schedules
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseSchedule parses a schedule which may be a 5 field cron line,
+// one of the @ shortcuts or "@every duration".
+func parseSchedule(s string) (*schedule, error) {
+	s = strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(s, "@every "); ok {
+		every, err := fs.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", s, err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("schedule %q: interval must be at least 1s", s)
+		}
+		return &schedule{every: every}, nil
+	}
+	line := s
+	if strings.HasPrefix(s, "@") {
+		var ok bool
+		line, ok = cronShortcuts[s]
+		if !ok {
+			return nil, fmt.Errorf("schedule %q: unknown shortcut", s)
+		}
+	}
+	fields := strings.Fields(line)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("schedule %q: expecting %d fields but got %d", s, len(cronFields), len(fields))
+	}
+	sched := &schedule{}
+	bits := []*uint64{&sched.minute, &sched.hour, &sched.dom, &sched.month, &sched.dow}
+	for i, field := range fields {
+		var err error
+		*bits[i], err = parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %s: %w", s, cronFields[i].name, err)
+		}
+	}
+	// Sunday may be 0 or 7
+	if sched.dow&(1<<7) != 0 {
+		sched.dow |= 1
+	}
+	sched.domStar = fields[2] == "*"
+	sched.dowStar = fields[4] == "*"
+	return sched, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and
+// steps into a bit set
+func parseCronField(s string, field cronField) (bits uint64, err error) {
+	for part := range strings.SplitSeq(s, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step %q", stepPart)
+			}
+		}
+		lo, hi := field.min, field.max
+		if rangePart != "*" {
+			loPart, hiPart, isRange := strings.Cut(rangePart, "-")
+			lo, err = strconv.Atoi(loPart)
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", loPart)
+			}
+			hi = lo
+			if isRange {
+				hi, err = strconv.Atoi(hiPart)
+				if err != nil {
+					return 0, fmt.Errorf("bad value %q", hiPart)
+				}
+			} else if hasStep {
+				hi = field.max
+			}
+		}
+		if lo < field.min || hi > field.max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", rangePart, field.min, field.max)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	if bits == 0 {
+		return 0, errors.New("no values")
+	}
+	return bits, nil
+}
+
+// has returns true if bit n is set in bits
+func has(bits uint64, n int) bool {
+	return bits&(1<<uint(n)) != 0
+}
+
+// dayMatches returns true if the day of t is allowed
+//
+// As in cron, if both the day of month and day of week are
+// restricted then a day matching either is allowed.
+func (s *schedule) dayMatches(t time.Time) bool {
+	domOK := has(s.dom, t.Day())
+	dowOK := has(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// next returns the first time the job should run after t, or the
+// zero time if it never does
+func (s *schedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Give up after 5 years in case the schedule can't match,
+	// e.g. on the 31st of February
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -194,6 +194,10 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	if len(interfaces) == 0 {
 		interfaces = listInterfaces()
 	}
+	VFS, err := vfs.NewWithError(ctx, f, vfsOpt)
+	if err != nil {
+		return nil, err
+	}
 
 	s := &server{
 		AnnounceInterval: time.Duration(opt.AnnounceInterval),
@@ -203,7 +207,7 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		waitChan:         make(chan struct{}),
 		httpListenAddr:   opt.ListenAddr,
 		f:                f,
-		vfs:              vfs.New(ctx, f, vfsOpt),
+		vfs:              VFS,
 	}
 
 	s.services = map[string]UPnPService{
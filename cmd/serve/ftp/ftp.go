@@ -148,7 +148,7 @@ You can set a single username and password with the --user and --pass flags.
 	},
 	Run: func(command *cobra.Command, args []string) {
 		var f fs.Fs
-		if proxy.Opt.AuthProxy == "" {
+		if !proxy.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
@@ -199,11 +199,17 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		ctx: ctx,
 		opt: *opt,
 	}
-	if proxy.Opt.AuthProxy != "" {
-		d.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
+	if proxyOpt.Enabled() {
+		d.proxy, err = proxy.New(ctx, proxyOpt, vfsOpt)
+		if err != nil {
+			return nil, err
+		}
 		d.userPass = make(map[string]string, 16)
 	} else {
-		d.globalVFS = vfs.New(ctx, f, vfsOpt)
+		d.globalVFS, err = vfs.NewWithError(ctx, f, vfsOpt)
+		if err != nil {
+			return nil, err
+		}
 	}
 	d.useTLS = d.opt.TLSKey != ""
 
@@ -0,0 +1,256 @@
+// Web file manager for --writable
+
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/vfs"
+)
+
+// writable returns true if the user of VFS can change files
+func (s *HTTP) writable(VFS *vfs.VFS) bool {
+	return s.opt.Writable && !VFS.Opt.ReadOnly
+}
+
+// sameOrigin returns false if the request was made from a page on a
+// different site.
+//
+// Browsers send the credentials for basic auth with requests made
+// from any site, so changes are refused unless they come from our
+// own pages. Browsers send at least one of Origin and Sec-Fetch-Site
+// with a POST so requests with neither are refused too.
+func sameOrigin(r *http.Request) bool {
+	site := r.Header.Get("Sec-Fetch-Site")
+	origin := r.Header.Get("Origin")
+	if site == "" && origin == "" {
+		return false
+	}
+	if site != "" && site != "same-origin" && site != "none" {
+		return false
+	}
+	if origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return false
+		}
+	}
+	return true
+}
+
+// errInvalidName is returned for names which aren't a single path element
+var errInvalidName = errors.New("invalid name")
+
+// checkLeaf returns an error if name can't be used as the name of a
+// file or directory
+func checkLeaf(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w %q", errInvalidName, name)
+	}
+	return nil
+}
+
+// fileManagerError writes an error for a failed file manager request
+// with a status matching the VFS error
+func fileManagerError(w http.ResponseWriter, r *http.Request, remote string, text string, err error) {
+	var status int
+	switch {
+	case errors.Is(err, errInvalidName):
+		status = http.StatusBadRequest
+	case errors.Is(err, vfs.ENOENT):
+		status = http.StatusNotFound
+	case errors.Is(err, vfs.EEXIST), errors.Is(err, vfs.ENOTEMPTY):
+		status = http.StatusConflict
+	case errors.Is(err, vfs.EROFS), errors.Is(err, vfs.EPERM):
+		status = http.StatusForbidden
+	case errors.Is(err, vfs.ENOSPC):
+		status = http.StatusInsufficientStorage
+	default:
+		serve.Error(r.Context(), remote, w, text, err)
+		return
+	}
+	fs.Infof(remote, "%s: %s: %v", r.RemoteAddr, text, err)
+	http.Error(w, text+": "+err.Error(), status)
+}
+
+// handlePost changes the files in the directory at the URL
+//
+// The change is chosen with the action parameter and the names of the
+// entries to change are given in the form. On success it redirects
+// back to the directory listing.
+func (s *HTTP) handlePost(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "Can only change the files in a directory", http.StatusBadRequest)
+		return
+	}
+	dirRemote := strings.Trim(r.URL.Path, "/")
+	VFS, err := s.getVFS(r.Context())
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to change directory: %v", err)
+		return
+	}
+	if !s.writable(VFS) {
+		http.Error(w, "Read only", http.StatusForbidden)
+		return
+	}
+	if !sameOrigin(r) {
+		fs.Infof(dirRemote, "%s: Refusing change from another site", r.RemoteAddr)
+		http.Error(w, "Cross site request refused", http.StatusForbidden)
+		return
+	}
+	node, err := VFS.Stat(dirRemote)
+	if err != nil {
+		fileManagerError(w, r, dirRemote, "Failed to find directory", err)
+		return
+	}
+	if !node.IsDir() {
+		http.Error(w, "Not a directory", http.StatusNotFound)
+		return
+	}
+
+	action := r.URL.Query().Get("action")
+	if action == "upload" {
+		err = s.upload(VFS, r, dirRemote)
+	} else {
+		if err = r.ParseForm(); err != nil {
+			http.Error(w, "Bad form: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch action {
+		case "mkdir":
+			err = s.mkdir(VFS, r, dirRemote)
+		case "rename":
+			err = s.rename(VFS, r, dirRemote)
+		case "delete":
+			err = s.delete(VFS, r, dirRemote)
+		default:
+			http.Error(w, fmt.Sprintf("Unknown action %q", action), http.StatusBadRequest)
+			return
+		}
+	}
+	if err != nil {
+		fileManagerError(w, r, dirRemote, "Failed to "+action, err)
+		return
+	}
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
+
+// upload writes the files in the multipart form to dirRemote
+//
+// The files are streamed from the request so they can be any size.
+func (s *HTTP) upload(VFS *vfs.VFS, r *http.Request, dirRemote string) error {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		leaf := part.FileName()
+		if leaf == "" {
+			// not a file
+			continue
+		}
+		if err = checkLeaf(leaf); err != nil {
+			return err
+		}
+		remote := path.Join(dirRemote, leaf)
+		fs.Infof(remote, "%s: Uploading file", r.RemoteAddr)
+		err = uploadFile(VFS, remote, part)
+		if err != nil {
+			return fmt.Errorf("%q: %w", leaf, err)
+		}
+	}
+}
+
+// uploadFile writes in to the file at remote replacing it if it exists
+func uploadFile(VFS *vfs.VFS, remote string, in io.Reader) (err error) {
+	out, err := VFS.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(out, &err)
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// mkdir makes the directory given by the name parameter
+func (s *HTTP) mkdir(VFS *vfs.VFS, r *http.Request, dirRemote string) error {
+	leaf := r.PostForm.Get("name")
+	if err := checkLeaf(leaf); err != nil {
+		return err
+	}
+	remote := path.Join(dirRemote, leaf)
+	fs.Infof(remote, "%s: Making directory", r.RemoteAddr)
+	return VFS.Mkdir(remote, 0777)
+}
+
+// rename renames the entry given by the from parameter to the to parameter
+func (s *HTTP) rename(VFS *vfs.VFS, r *http.Request, dirRemote string) error {
+	from, to := r.PostForm.Get("from"), r.PostForm.Get("to")
+	if err := checkLeaf(from); err != nil {
+		return err
+	}
+	if err := checkLeaf(to); err != nil {
+		return err
+	}
+	oldRemote, newRemote := path.Join(dirRemote, from), path.Join(dirRemote, to)
+	if _, err := VFS.Stat(newRemote); err == nil {
+		return vfs.EEXIST
+	}
+	fs.Infof(oldRemote, "%s: Renaming to %q", r.RemoteAddr, to)
+	return VFS.Rename(oldRemote, newRemote)
+}
+
+// delete removes the entries given by the name parameters, including
+// the contents of directories
+func (s *HTTP) delete(VFS *vfs.VFS, r *http.Request, dirRemote string) error {
+	names := r.PostForm["name"]
+	for _, leaf := range names {
+		if err := checkLeaf(leaf); err != nil {
+			return err
+		}
+	}
+	for _, leaf := range names {
+		remote := path.Join(dirRemote, leaf)
+		node, err := VFS.Stat(remote)
+		if err != nil {
+			return err
+		}
+		fs.Infof(remote, "%s: Deleting", r.RemoteAddr)
+		if err = node.RemoveAll(); err != nil {
+			return fmt.Errorf("%q: %w", leaf, err)
+		}
+	}
+	return nil
+}
+
+// zipNodes returns the entries of dir named in the name parameters
+// to download as a zip
+func zipNodes(VFS *vfs.VFS, dirRemote string, names []string) (nodes vfs.Nodes, err error) {
+	for _, leaf := range names {
+		if err = checkLeaf(leaf); err != nil {
+			return nil, err
+		}
+		node, err := VFS.Stat(path.Join(dirRemote, leaf))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", leaf, err)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,243 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startWritable starts a server on a temporary directory returning
+// the directory and the URL
+func startWritable(t *testing.T, writable, readOnly bool) (dir string, testURL string) {
+	ctx := context.Background()
+	dir = t.TempDir()
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	opts := DefaultOpt
+	opts.Writable = writable
+	vfsOpt := vfscommon.Opt
+	vfsOpt.ReadOnly = readOnly
+	s, testURL := startOpt(ctx, t, f, &opts, &vfsOpt)
+	t.Cleanup(func() { assert.NoError(t, s.server.Shutdown()) })
+	return dir, testURL
+}
+
+// do makes a request returning the status and the body
+//
+// The request has an Origin of URL as a browser would send. Set it
+// to nil in header to leave it out.
+func do(t *testing.T, method, URL string, body io.Reader, contentType string, header http.Header) (int, string) {
+	req, err := http.NewRequest(method, URL, body)
+	require.NoError(t, err)
+	req.SetBasicAuth(testUser, testPass)
+	req.Header.Set("Origin", req.URL.Scheme+"://"+req.URL.Host)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(data)
+}
+
+// postForm posts the form to the action in the directory at URL
+func postForm(t *testing.T, URL, action string, form url.Values) (int, string) {
+	return do(t, "POST", URL+"?action="+action, strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", nil)
+}
+
+// upload posts the files to the directory at URL
+func upload(t *testing.T, URL string, files map[string]string) (int, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for name, contents := range files {
+		w, err := mw.CreateFormFile("files", name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	return do(t, "POST", URL+"?action=upload", &buf, mw.FormDataContentType(), nil)
+}
+
+// readDir returns the names in dir
+func readDir(t *testing.T, dir string) (names []string) {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestFileManager(t *testing.T) {
+	dir, testURL := startWritable(t, true, false)
+
+	t.Run("Listing", func(t *testing.T) {
+		status, body := do(t, "GET", testURL, nil, "", nil)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, body, `name="files"`)
+		assert.Contains(t, body, "deleteSelected()")
+	})
+
+	t.Run("Upload", func(t *testing.T) {
+		status, _ := upload(t, testURL, map[string]string{"one.txt": "one", "two.txt": "two"})
+		assert.Equal(t, http.StatusSeeOther, status)
+		data, err := os.ReadFile(filepath.Join(dir, "one.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "one", string(data))
+
+		// Uploading again replaces the file
+		status, _ = upload(t, testURL, map[string]string{"one.txt": "ONE!"})
+		assert.Equal(t, http.StatusSeeOther, status)
+		data, err = os.ReadFile(filepath.Join(dir, "one.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "ONE!", string(data))
+
+		status, _ = upload(t, testURL, map[string]string{"..": "potato"})
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		status, _ = upload(t, testURL, map[string]string{`..\potato.txt`: "potato"})
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("Mkdir", func(t *testing.T) {
+		status, _ := postForm(t, testURL, "mkdir", url.Values{"name": {"sub"}})
+		assert.Equal(t, http.StatusSeeOther, status)
+		info, err := os.Stat(filepath.Join(dir, "sub"))
+		require.NoError(t, err)
+		assert.True(t, info.IsDir())
+
+		status, _ = postForm(t, testURL, "mkdir", url.Values{"name": {"one.txt"}})
+		assert.Equal(t, http.StatusConflict, status)
+
+		// Upload into the new directory
+		status, _ = upload(t, testURL+"sub/", map[string]string{"three.txt": "three"})
+		assert.Equal(t, http.StatusSeeOther, status)
+		_, err = os.Stat(filepath.Join(dir, "sub", "three.txt"))
+		require.NoError(t, err)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		status, _ := postForm(t, testURL, "rename", url.Values{"from": {"two.txt"}, "to": {"2.txt"}})
+		assert.Equal(t, http.StatusSeeOther, status)
+		assert.Equal(t, []string{"2.txt", "one.txt", "sub"}, readDir(t, dir))
+
+		status, _ = postForm(t, testURL, "rename", url.Values{"from": {"2.txt"}, "to": {"one.txt"}})
+		assert.Equal(t, http.StatusConflict, status)
+
+		status, _ = postForm(t, testURL, "rename", url.Values{"from": {"missing.txt"}, "to": {"found.txt"}})
+		assert.Equal(t, http.StatusNotFound, status)
+
+		status, _ = postForm(t, testURL, "rename", url.Values{"from": {"2.txt"}, "to": {"sub/2.txt"}})
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		status, _ = postForm(t, testURL, "rename", url.Values{"from": {"2.txt"}, "to": {`sub\2.txt`}})
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("ZipSelected", func(t *testing.T) {
+		status, body := do(t, "GET", testURL+"?download=zip&name=one.txt&name=sub", nil, "", nil)
+		require.Equal(t, http.StatusOK, status)
+		zr, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+		var names []string
+		for _, file := range zr.File {
+			names = append(names, file.Name)
+		}
+		sort.Strings(names)
+		assert.Equal(t, []string{"one.txt", "sub/", "sub/three.txt"}, names)
+
+		status, _ = do(t, "GET", testURL+"?download=zip&name=missing", nil, "", nil)
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		status, _ := postForm(t, testURL, "delete", url.Values{"name": {"2.txt", "sub"}})
+		assert.Equal(t, http.StatusSeeOther, status)
+		assert.Equal(t, []string{"one.txt"}, readDir(t, dir))
+
+		status, _ = postForm(t, testURL, "delete", url.Values{"name": {"2.txt"}})
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("BadRequests", func(t *testing.T) {
+		status, _ := postForm(t, testURL, "potato", nil)
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		status, _ = postForm(t, testURL+"one.txt", "delete", url.Values{"name": {"one.txt"}})
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("CrossSite", func(t *testing.T) {
+		form := url.Values{"name": {"one.txt"}}.Encode()
+		for _, header := range []http.Header{
+			{"Origin": {"http://example.com"}},
+			{"Origin": nil, "Sec-Fetch-Site": {"cross-site"}},
+			{"Origin": nil},
+		} {
+			status, _ := do(t, "POST", testURL+"?action=delete", strings.NewReader(form), "application/x-www-form-urlencoded", header)
+			assert.Equal(t, http.StatusForbidden, status)
+		}
+		assert.Equal(t, []string{"one.txt"}, readDir(t, dir))
+
+		u, err := url.Parse(testURL)
+		require.NoError(t, err)
+		header := http.Header{"Origin": {"http://" + u.Host}, "Sec-Fetch-Site": {"same-origin"}}
+		status, _ := do(t, "POST", testURL+"?action=mkdir", strings.NewReader(url.Values{"name": {"sub"}}.Encode()), "application/x-www-form-urlencoded", header)
+		assert.Equal(t, http.StatusSeeOther, status)
+
+		// Either header on its own is enough
+		header = http.Header{"Origin": nil, "Sec-Fetch-Site": {"same-origin"}}
+		status, _ = do(t, "POST", testURL+"?action=delete", strings.NewReader(form), "application/x-www-form-urlencoded", header)
+		assert.Equal(t, http.StatusSeeOther, status)
+		assert.Equal(t, []string{"sub"}, readDir(t, dir))
+	})
+}
+
+func TestFileManagerDisabled(t *testing.T) {
+	t.Run("NotWritable", func(t *testing.T) {
+		dir, testURL := startWritable(t, false, false)
+		status, body := do(t, "GET", testURL, nil, "", nil)
+		assert.Equal(t, http.StatusOK, status)
+		assert.NotContains(t, body, `name="files"`)
+
+		status, _ = upload(t, testURL, map[string]string{"one.txt": "one"})
+		assert.Equal(t, http.StatusMethodNotAllowed, status)
+		assert.Nil(t, readDir(t, dir))
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		dir, testURL := startWritable(t, true, true)
+		status, body := do(t, "GET", testURL, nil, "", nil)
+		assert.Equal(t, http.StatusOK, status)
+		assert.NotContains(t, body, `name="files"`)
+
+		status, _ = upload(t, testURL, map[string]string{"one.txt": "one"})
+		assert.Equal(t, http.StatusForbidden, status)
+		assert.Nil(t, readDir(t, dir))
+	})
+}
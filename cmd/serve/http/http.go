@@ -46,6 +46,7 @@ type Options struct {
 	HTTP       libhttp.Config
 	Template   libhttp.TemplateConfig
 	DisableZip bool
+	Writable   bool
 }
 
 // DefaultOpt is the default values used for Options
@@ -75,6 +76,7 @@ func init() {
 	vfsflags.AddFlags(flagSet)
 	proxyflags.AddFlags(flagSet)
 	flagSet.BoolVar(&Opt.DisableZip, "disable-zip", false, "Disable zip download of directories")
+	flagSet.BoolVar(&Opt.Writable, "writable", false, "Allow files to be uploaded, renamed and deleted from the directory listings")
 	cmdserve.Command.AddCommand(Command)
 	cmdserve.AddRc("http", func(ctx context.Context, f fs.Fs, in rc.Params) (cmdserve.Handle, error) {
 		// Read VFS Opts
@@ -116,6 +118,21 @@ The server will log errors.  Use ` + "`-v`" + ` to see access logs.
 ` + "`--bwlimit`" + ` will be respected for file transfers.  Use ` + "`--stats`" + ` to
 control the stats printing.
 
+### Writable
+
+By default the server is read only. Use ` + "`--writable`" + ` to turn the
+directory listings into a simple file manager. This lets you upload
+files (with the upload button or by dragging and dropping them onto the
+page), make folders, rename and delete files and folders and download
+a selection of them as a zip.
+
+All changes are made through the VFS so the ` + "`--vfs-*`" + ` flags apply.
+Users which are read only, for example with ` + "`--read-only`" + ` or with
+` + "`read_only`" + ` in the ` + "`--user-file`" + `, get the normal read only
+listings. Changes are only accepted from pages served by rclone, so
+make sure you use ` + "`--user`/`--pass`" + ` or another form of
+authentication as anyone who can reach the server can change the files.
+
 ` + strings.TrimSpace(libhttp.Help(flagPrefix)+libhttp.TemplateHelp(flagPrefix)+libhttp.AuthHelp(flagPrefix)+vfs.Help()+proxy.Help),
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.39",
@@ -123,7 +140,7 @@ control the stats printing.
 	},
 	Run: func(command *cobra.Command, args []string) {
 		var f fs.Fs
-		if proxy.Opt.AuthProxy == "" {
+		if !proxy.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
@@ -183,12 +200,18 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		opt: *opt,
 	}
 
-	if proxyOpt.AuthProxy != "" {
-		s.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
+	if proxyOpt.Enabled() {
+		s.proxy, err = proxy.New(ctx, proxyOpt, vfsOpt)
+		if err != nil {
+			return nil, err
+		}
 		// override auth
 		s.opt.Auth.CustomAuthFn = s.auth
 	} else {
-		s._vfs = vfs.New(ctx, f, vfsOpt)
+		s._vfs, err = vfs.NewWithError(ctx, f, vfsOpt)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	s.server, err = libhttp.NewServer(ctx,
@@ -209,6 +232,9 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	router.Get("/favicon.ico", s.serveFavicon)
 	router.Get("/*", s.handler)
 	router.Head("/*", s.handler)
+	if s.opt.Writable {
+		router.Post("/*", s.handlePost)
+	}
 
 	return s, nil
 }
@@ -293,10 +319,24 @@ func (s *HTTP) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string
 		if dirRemote == "" {
 			zipName = "root"
 		}
+		// Only zip the selected entries if any are named
+		var nodes vfs.Nodes
+		names, selected := r.URL.Query()["name"]
+		if selected {
+			nodes, err = zipNodes(VFS, dirRemote, names)
+			if err != nil {
+				fileManagerError(w, r, dirRemote, "Failed to find entries to zip", err)
+				return
+			}
+		}
 		w.Header().Set("Content-Disposition", "attachment; filename=\""+zipName+".zip\"")
 		w.Header().Set("Content-Type", "application/zip")
 		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
-		err := vfs.CreateZip(ctx, dir, w)
+		if selected {
+			err = vfs.CreateZipNodes(ctx, nodes, w)
+		} else {
+			err = vfs.CreateZip(ctx, dir, w)
+		}
 		if err != nil {
 			serve.Error(ctx, dirRemote, w, "Failed to create zip", err)
 			return
@@ -328,6 +368,7 @@ func (s *HTTP) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string
 	w.Header().Set("Last-Modified", dir.ModTime().UTC().Format(http.TimeFormat))
 
 	directory.DisableZip = s.opt.DisableZip
+	directory.Writable = s.writable(VFS)
 
 	directory.Serve(w, r)
 }
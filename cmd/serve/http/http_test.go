@@ -43,13 +43,18 @@ func start(ctx context.Context, t *testing.T, f fs.Fs) (s *HTTP, testURL string)
 			Path: testTemplate,
 		},
 	}
+	return startOpt(ctx, t, f, &opts, &vfscommon.Opt)
+}
+
+// startOpt starts the server with the options passed in
+func startOpt(ctx context.Context, t *testing.T, f fs.Fs, opts *Options, vfsOpt *vfscommon.Options) (s *HTTP, testURL string) {
 	opts.HTTP.ListenAddr = []string{testBindAddress}
 	if proxy.Opt.AuthProxy == "" {
 		opts.Auth.BasicUser = testUser
 		opts.Auth.BasicPass = testPass
 	}
 
-	s, err := newServer(ctx, f, &opts, &vfscommon.Opt, &proxy.Opt)
+	s, err := newServer(ctx, f, opts, vfsOpt, &proxy.Opt)
 	require.NoError(t, err, "failed to start server")
 	go func() {
 		require.NoError(t, s.Serve())
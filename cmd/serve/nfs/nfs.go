@@ -94,7 +94,10 @@ func init() {
 		if err != nil {
 			return nil, err
 		}
-		VFS := vfs.New(ctx, f, &vfsOpt)
+		VFS, err := vfs.NewWithError(ctx, f, &vfsOpt)
+		if err != nil {
+			return nil, err
+		}
 		// Read opts
 		var opt = Opt // set default opts
 		err = configstruct.SetAny(in, &opt)
@@ -112,7 +115,11 @@ func Run(command *cobra.Command, args []string) {
 	cmd.CheckArgs(1, 1, command, args)
 	f = cmd.NewFsSrc(args)
 	cmd.Run(false, true, command, func() error {
-		s, err := NewServer(context.Background(), vfs.New(context.Background(), f, &vfscommon.Opt), &Opt)
+		VFS, err := vfs.NewWithError(context.Background(), f, &vfscommon.Opt)
+		if err != nil {
+			return err
+		}
+		s, err := NewServer(context.Background(), VFS, &Opt)
 		if err != nil {
 			return err
 		}
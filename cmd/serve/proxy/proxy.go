@@ -110,6 +110,58 @@ request rather than the cached one being reused.
 This can be used to build general purpose proxies to any kind of
 backend that rclone supports.
 
+### User file
+
+For simple multi-user setups, instead of writing an auth proxy
+program, you can supply |--user-file /path/to/users.yaml| with a list
+of users. Each user is served their own remote path, for example their
+home directory, and can optionally be made read only or given a quota.
+
+**PLEASE NOTE:** |--user-file| and |--auth-proxy| cannot be used
+together - the server will refuse to start if both are set.
+
+The file is in YAML or JSON format and looks like this
+
+|||yaml
+users:
+  alice:
+    pass: $2a$10$YCs4gaMAb0Ej.7H/6g4ICef7PB8stkqylWdMg0NJWULrwQBnZIXDC
+    remote: s3:bucket/home/alice
+    quota: 10G
+  bob:
+    pass: 7uM1zYfGLZzn71oydR8ZsEwM-PUR1pg
+    public_keys:
+      - ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAINLtO5CN1ksvQmQMfvryT648kXcdPYd5kyhweYi61lMs bob@laptop
+    remote: /srv/home/bob
+    read_only: true
+|||
+
+Each user has these fields
+
+- |pass| - the password, either a bcrypt hash as made by |htpasswd -nB user|
+  or the password obscured with |rclone obscure|
+- |public_keys| - list of public keys in |authorized_keys| format (sftp only)
+- |remote| - the |remote:path| to serve to the user
+- |read_only| - set to |true| to stop the user making changes
+- |quota| - the maximum size of the user's files, eg |10G|
+
+Each user's remote is served through its own VFS with the VFS flags
+given on the command line, but with |--read-only| set if |read_only|
+is set and |--vfs-quota| set to the |quota| if given. Clients which
+ask for the free space are shown how much of their quota is left.
+
+The space used against the quota is shared by all the logins of the
+user, but it is only counted within this rclone process and other
+changes to the user's remote are only noticed when it is listed again
+each |--dir-cache-time|.
+
+|serve s3| uses the user name as the access key and the password as
+the secret key, so the password must be obscured rather than hashed
+for users of |serve s3|.
+
+The file is read again if it changes, so users can be added and
+removed without restarting the server.
+
 `, "|", "`")
 
 // OptionsInfo descripts the Options in use
@@ -117,11 +169,22 @@ var OptionsInfo = fs.Options{{
 	Name:    "auth_proxy",
 	Default: "",
 	Help:    "A program to use to create the backend from the auth",
+}, {
+	Name:    "user_file",
+	Default: "",
+	Help:    "A YAML or JSON file of users with the remote to serve to each",
 }}
 
 // Options is options for creating the proxy
 type Options struct {
 	AuthProxy string `config:"auth_proxy"`
+	UserFile  string `config:"user_file"`
+}
+
+// Enabled returns true if the VFS should be made per user by the
+// proxy rather than served from the remote on the command line
+func (opt *Options) Enabled() bool {
+	return opt.AuthProxy != "" || opt.UserFile != ""
 }
 
 // Opt is the default options
@@ -138,25 +201,38 @@ type Proxy struct {
 	ctx      context.Context // for global config
 	Opt      Options
 	vfsOpt   vfscommon.Options
+	users    *users // users from the --user-file or nil if not in use
 }
 
 // cacheEntry is what is stored in the vfsCache
 type cacheEntry struct {
 	vfs    *vfs.VFS          // stored VFS
 	pwHash [sha256.Size]byte // sha256 hash of the password/publicKey
+	user   *fileUser         // user from the --user-file or nil if not in use
 }
 
 // New creates a new proxy with the Options passed in
 //
 // Any VFS are created with the vfsOpt passed in.
-func New(ctx context.Context, opt *Options, vfsOpt *vfscommon.Options) *Proxy {
-	return &Proxy{
+func New(ctx context.Context, opt *Options, vfsOpt *vfscommon.Options) (*Proxy, error) {
+	if opt.AuthProxy != "" && opt.UserFile != "" {
+		return nil, errors.New("can't use --auth-proxy and --user-file together")
+	}
+	p := &Proxy{
 		ctx:      ctx,
 		Opt:      *opt,
 		cmdLine:  strings.Fields(opt.AuthProxy),
 		vfsCache: libcache.New(),
 		vfsOpt:   *vfsOpt,
 	}
+	if opt.UserFile != "" {
+		p.users = newUsers(opt.UserFile)
+		// Read the file now so errors are shown at startup
+		if _, err := p.users.get(""); err != nil && !errors.Is(err, errUnknownUser) {
+			fs.Errorf(nil, "%v", err)
+		}
+	}
+	return p, nil
 }
 
 // run the proxy command returning a config map
@@ -284,8 +360,15 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 		// We hash the auth here so we don't copy the auth more than we
 		// need to in memory. An attacker would find it easier to go
 		// after the unencrypted password in memory most likely.
+		// Share the space used against --vfs-quota between all
+		// the VFS of the user
+		VFS, err := vfs.NewWithError(p.ctx, f, &p.vfsOpt)
+		if err != nil {
+			return nil, false, err
+		}
+		VFS.SetQuotaKey("proxy user " + user)
 		entry := cacheEntry{
-			vfs:    vfs.New(p.ctx, f, &p.vfsOpt),
+			vfs:    VFS,
 			pwHash: sha256.Sum256([]byte(auth)),
 		}
 		return entry, true, nil
@@ -296,6 +379,47 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 	return value, nil
 }
 
+// callUser checks the user against the --user-file and returns a
+// cacheEntry and an error
+func (p *Proxy) callUser(user, auth string, isPublicKey bool) (value any, err error) {
+	u, err := p.users.get(user)
+	if err != nil {
+		return nil, err
+	}
+	if err = u.checkAuth(auth, isPublicKey); err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+
+	cacheKey := generateCacheKey(user, auth)
+	value, err = p.vfsCache.Get(cacheKey, func(key string) (value any, ok bool, err error) {
+		f, err := cache.Get(p.ctx, u.Remote)
+		if err != nil {
+			return nil, false, err
+		}
+		vfsOpt := p.vfsOpt
+		if u.ReadOnly {
+			vfsOpt.ReadOnly = true
+		}
+		if u.quota >= 0 {
+			vfsOpt.Quota = u.quota
+		}
+		VFS, err := vfs.NewWithError(p.ctx, f, &vfsOpt)
+		if err != nil {
+			return nil, false, err
+		}
+		entry := cacheEntry{
+			vfs:    VFS,
+			pwHash: sha256.Sum256([]byte(auth)),
+			user:   u,
+		}
+		return entry, true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("proxy: failed to create backend for user %q: %w", user, err)
+	}
+	return value, nil
+}
+
 // Call runs the auth proxy with the username and password/public key provided
 // returning a *vfs.VFS and the key used in the VFS cache.
 func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey string, err error) {
@@ -305,9 +429,25 @@ func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey
 	// Look in the cache first with the credential-aware key
 	value, ok := p.vfsCache.GetMaybe(cacheKey)
 
+	// Make a fresh entry if the user has changed in the user file,
+	// releasing the old VFS
+	if ok && p.users != nil {
+		entry, _ := value.(cacheEntry)
+		if u, err := p.users.get(user); err != nil || !u.equal(entry.user) {
+			if p.vfsCache.Delete(cacheKey) {
+				entry.vfs.Shutdown()
+			}
+			ok = false
+		}
+	}
+
 	// If not found then call the proxy for a fresh answer
 	if !ok {
-		value, err = p.call(user, auth, isPublicKey)
+		if p.users != nil {
+			value, err = p.callUser(user, auth, isPublicKey)
+		} else {
+			value, err = p.call(user, auth, isPublicKey)
+		}
 		if err != nil {
 			return nil, "", err
 		}
@@ -335,6 +475,25 @@ func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey
 	return entry.vfs, cacheKey, nil
 }
 
+// UserSecret returns the password of user from the --user-file
+//
+// This is for protocols which need to know the password to check a
+// signature rather than being sent it, so the password must be
+// obscured rather than hashed.
+func (p *Proxy) UserSecret(user string) (secret string, err error) {
+	if p.users == nil {
+		return "", errors.New("proxy: no user file in use")
+	}
+	u, err := p.users.get(user)
+	if err != nil {
+		return "", err
+	}
+	if u.Pass == "" || isBcrypt(u.Pass) {
+		return "", fmt.Errorf("proxy: user %q: pass must be obscured rather than hashed to be used as a secret", user)
+	}
+	return obscure.Reveal(u.Pass)
+}
+
 // Get VFS from the cache using key - returns nil if not found
 func (p *Proxy) Get(key string) *vfs.VFS {
 	value, ok := p.vfsCache.GetMaybe(key)
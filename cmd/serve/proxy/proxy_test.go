@@ -23,7 +23,8 @@ func TestRun(t *testing.T) {
 	opt := Opt
 	cmd := "go run proxy_code.go"
 	opt.AuthProxy = cmd
-	p := New(context.Background(), &opt, &vfscommon.Opt)
+	p, err := New(context.Background(), &opt, &vfscommon.Opt)
+	require.NoError(t, err)
 
 	t.Run("Normal", func(t *testing.T) {
 		config, err := p.run(map[string]string{
@@ -0,0 +1,219 @@
+// Built in user database read from --user-file
+
+package proxy
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// errUnknownUser is returned if the user isn't in the user file
+var errUnknownUser = errors.New("unknown user")
+
+// userFile is the contents of the --user-file
+type userFile struct {
+	Users map[string]*fileUser `yaml:"users"`
+}
+
+// fileUser is a single user in the user file
+type fileUser struct {
+	Pass       string   `yaml:"pass"`        // bcrypt hash or obscured password
+	PublicKeys []string `yaml:"public_keys"` // in authorized_keys format
+	Remote     string   `yaml:"remote"`      // remote:path to serve to the user
+	ReadOnly   bool     `yaml:"read_only"`   // if set the user can't make changes
+	Quota      string   `yaml:"quota"`       // max size of the user's files if set
+
+	quota      fs.SizeSuffix // parsed Quota or -1 if not set
+	publicKeys [][]byte      // parsed PublicKeys in wire format
+}
+
+// equal returns true if u and o would give the same VFS to the same
+// credentials
+func (u *fileUser) equal(o *fileUser) bool {
+	return u.Pass == o.Pass &&
+		slices.Equal(u.PublicKeys, o.PublicKeys) &&
+		u.Remote == o.Remote &&
+		u.ReadOnly == o.ReadOnly &&
+		u.quota == o.quota
+}
+
+// isBcrypt returns true if the password is a bcrypt hash as made by
+// htpasswd -B
+func isBcrypt(pass string) bool {
+	return strings.HasPrefix(pass, "$2a$") || strings.HasPrefix(pass, "$2b$") || strings.HasPrefix(pass, "$2y$")
+}
+
+// check the user is valid and parse its fields
+func (u *fileUser) check() (err error) {
+	if u.Remote == "" {
+		return errors.New("remote not set")
+	}
+	if u.Pass == "" && len(u.PublicKeys) == 0 {
+		return errors.New("need pass or public_keys")
+	}
+	if u.Pass != "" && !isBcrypt(u.Pass) {
+		if _, err = obscure.Reveal(u.Pass); err != nil {
+			return fmt.Errorf("pass must be a bcrypt hash or obscured with \"rclone obscure\": %w", err)
+		}
+	}
+	for _, key := range u.PublicKeys {
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+		if err != nil {
+			return fmt.Errorf("bad public key %q: %w", key, err)
+		}
+		u.publicKeys = append(u.publicKeys, publicKey.Marshal())
+	}
+	u.quota = -1
+	if u.Quota != "" {
+		if err = u.quota.Set(u.Quota); err != nil {
+			return fmt.Errorf("bad quota: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkAuth checks the password or public key supplied by the client
+//
+// The public key should be base64 encoded in wire format.
+func (u *fileUser) checkAuth(auth string, isPublicKey bool) error {
+	if isPublicKey {
+		publicKey, err := base64.StdEncoding.DecodeString(auth)
+		if err != nil {
+			return fmt.Errorf("bad public key: %w", err)
+		}
+		for _, key := range u.publicKeys {
+			if bytes.Equal(key, publicKey) {
+				return nil
+			}
+		}
+		return errors.New("incorrect public key")
+	}
+	if u.Pass == "" {
+		return errors.New("incorrect password")
+	}
+	if isBcrypt(u.Pass) {
+		if bcrypt.CompareHashAndPassword([]byte(u.Pass), []byte(auth)) != nil {
+			return errors.New("incorrect password")
+		}
+		return nil
+	}
+	pass, err := obscure.Reveal(u.Pass)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(pass), []byte(auth)) != 1 {
+		return errors.New("incorrect password")
+	}
+	return nil
+}
+
+// users is the user database read from the --user-file
+//
+// The file is read again if it changes.
+type users struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time            // modification time of the file when read
+	size    int64                // size of the file when read
+	users   map[string]*fileUser // users or nil if not read yet
+	lastErr string               // last error reading the file so it is only logged once
+}
+
+// newUsers makes a user database from the file at path
+func newUsers(path string) *users {
+	return &users{path: path}
+}
+
+// load reads the user file if it has changed since it was last read
+//
+// If the file can't be read and it has been read before then the
+// users from last time are kept.
+//
+// Call with mu held
+func (us *users) load() error {
+	fi, err := os.Stat(us.path)
+	if err != nil {
+		return us.loadFailed(err)
+	}
+	if us.users != nil && fi.ModTime().Equal(us.modTime) && fi.Size() == us.size {
+		return nil
+	}
+	data, err := os.ReadFile(us.path)
+	if err != nil {
+		return us.loadFailed(err)
+	}
+	// YAML is a superset of JSON so this reads both
+	var file userFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err = dec.Decode(&file); err != nil && err != io.EOF {
+		return us.loadFailed(fmt.Errorf("failed to parse: %w", err))
+	}
+	for name, u := range file.Users {
+		if u == nil {
+			return us.loadFailed(fmt.Errorf("user %q: no config", name))
+		}
+		if err = u.check(); err != nil {
+			return us.loadFailed(fmt.Errorf("user %q: %w", name, err))
+		}
+	}
+	if file.Users == nil {
+		file.Users = map[string]*fileUser{}
+	}
+	if us.users != nil {
+		fs.Logf(nil, "proxy: reloaded %d users from %q", len(file.Users), us.path)
+	}
+	us.users = file.Users
+	us.lastErr = ""
+	us.modTime = fi.ModTime()
+	us.size = fi.Size()
+	return nil
+}
+
+// loadFailed returns the error if the file has never been read or
+// logs it if the users from last time are still in use
+//
+// Call with mu held
+func (us *users) loadFailed(err error) error {
+	err = fmt.Errorf("proxy: user file %q: %w", us.path, err)
+	if us.users == nil {
+		return err
+	}
+	if err.Error() != us.lastErr {
+		us.lastErr = err.Error()
+		fs.Errorf(nil, "%v - using users read previously", err)
+	}
+	return nil
+}
+
+// get returns the user called name
+//
+// The same *fileUser is returned until the user file changes.
+func (us *users) get(name string) (*fileUser, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if err := us.load(); err != nil {
+		return nil, err
+	}
+	u, ok := us.users[name]
+	if !ok {
+		return nil, fmt.Errorf("proxy: user %q: %w", name, errUnknownUser)
+	}
+	return u, nil
+}
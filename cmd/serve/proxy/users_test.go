@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/vfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+// writeUserFile writes the user file making sure its modification
+// time changes so it is read again
+func writeUserFile(t *testing.T, path, contents string) {
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	modTime := time.Now().Add(time.Duration(len(contents)) * time.Second)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestUserFile(t *testing.T) {
+	dir := t.TempDir()
+	aliceDir := filepath.Join(dir, "alice")
+	bobDir := filepath.Join(dir, "bob")
+	require.NoError(t, os.Mkdir(aliceDir, 0777))
+	require.NoError(t, os.Mkdir(bobDir, 0777))
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("alicepass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	publicKey, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	publicKeyString := base64.StdEncoding.EncodeToString(publicKey.Marshal())
+
+	userFile := filepath.Join(dir, "users.yaml")
+	writeUserFile(t, userFile, fmt.Sprintf(`users:
+  alice:
+    pass: %s
+    remote: %s
+    quota: 1M
+  bob:
+    pass: %s
+    public_keys:
+      - %s
+    remote: %s
+    read_only: true
+`, hash, aliceDir, obscure.MustObscure("bobpass"), ssh.MarshalAuthorizedKey(publicKey), bobDir))
+
+	opt := Opt
+	opt.UserFile = userFile
+	assert.True(t, opt.Enabled())
+	p, err := New(context.Background(), &opt, &vfscommon.Opt)
+	require.NoError(t, err)
+
+	t.Run("Password", func(t *testing.T) {
+		defer p.vfsCache.Clear()
+		vfs, vfsKey, err := p.Call("alice", "alicepass", false)
+		require.NoError(t, err)
+		assert.Equal(t, aliceDir, vfs.Fs().Root())
+		assert.False(t, vfs.Opt.ReadOnly)
+		assert.Equal(t, int64(1024*1024), int64(vfs.Opt.Quota))
+		assert.Equal(t, vfs, p.Get(vfsKey))
+
+		total, used, free := vfs.Statfs()
+		assert.Equal(t, int64(1024*1024), total)
+		assert.Equal(t, int64(0), used)
+		assert.Equal(t, int64(1024*1024), free)
+
+		// From the cache
+		vfs2, _, err := p.Call("alice", "alicepass", false)
+		require.NoError(t, err)
+		assert.Equal(t, vfs, vfs2)
+
+		_, _, err = p.Call("alice", "wrong", false)
+		assert.ErrorContains(t, err, "incorrect password")
+		_, _, err = p.Call("nobody", "alicepass", false)
+		assert.ErrorIs(t, err, errUnknownUser)
+	})
+
+	t.Run("Obscured", func(t *testing.T) {
+		defer p.vfsCache.Clear()
+		vfs, _, err := p.Call("bob", "bobpass", false)
+		require.NoError(t, err)
+		assert.Equal(t, bobDir, vfs.Fs().Root())
+		assert.True(t, vfs.Opt.ReadOnly)
+		assert.Equal(t, vfscommon.Opt.Quota, vfs.Opt.Quota)
+
+		_, _, err = p.Call("bob", "wrong", false)
+		assert.ErrorContains(t, err, "incorrect password")
+	})
+
+	t.Run("PublicKey", func(t *testing.T) {
+		defer p.vfsCache.Clear()
+		vfs, _, err := p.Call("bob", publicKeyString, true)
+		require.NoError(t, err)
+		assert.Equal(t, bobDir, vfs.Fs().Root())
+
+		_, _, err = p.Call("alice", publicKeyString, true)
+		assert.ErrorContains(t, err, "incorrect public key")
+	})
+
+	t.Run("UserSecret", func(t *testing.T) {
+		secret, err := p.UserSecret("bob")
+		require.NoError(t, err)
+		assert.Equal(t, "bobpass", secret)
+
+		_, err = p.UserSecret("alice")
+		assert.ErrorContains(t, err, "must be obscured")
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		defer p.vfsCache.Clear()
+		carolDir := filepath.Join(dir, "carol")
+		require.NoError(t, os.Mkdir(carolDir, 0777))
+		bobPass, carolPass := obscure.MustObscure("bobpass"), obscure.MustObscure("carolpass")
+		carol := func(readOnly bool) string {
+			return fmt.Sprintf(`{"users": {"bob": {"pass": %q, "remote": %q}, "carol": {"pass": %q, "remote": %q, "read_only": %v}}}`,
+				bobPass, bobDir, carolPass, carolDir, readOnly)
+		}
+		writeUserFile(t, userFile, carol(true))
+		oldVFS, _, err := p.Call("carol", "carolpass", false)
+		require.NoError(t, err)
+		assert.True(t, oldVFS.Opt.ReadOnly)
+
+		// Reloading the file without changing the user keeps the VFS
+		writeUserFile(t, userFile, carol(true)+"\n")
+		VFS, _, err := p.Call("carol", "carolpass", false)
+		require.NoError(t, err)
+		assert.Equal(t, oldVFS, VFS)
+
+		// Changing the user makes a new VFS and shuts down the old one
+		writeUserFile(t, userFile, carol(false))
+		VFS, _, err = p.Call("carol", "carolpass", false)
+		require.NoError(t, err)
+		assert.False(t, VFS.Opt.ReadOnly)
+		newVFS := vfs.New(context.Background(), oldVFS.Fs(), &oldVFS.Opt)
+		assert.NotEqual(t, oldVFS, newVFS, "old VFS still active")
+		newVFS.Shutdown()
+
+		// Removed users can't log in
+		_, _, err = p.Call("alice", "alicepass", false)
+		assert.ErrorIs(t, err, errUnknownUser)
+
+		// A broken file keeps the old users
+		writeUserFile(t, userFile, "users: [")
+		_, _, err = p.Call("bob", "bobpass", false)
+		require.NoError(t, err)
+	})
+}
+
+func TestUserFileCheck(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		user    fileUser
+		wantErr string
+	}{
+		{"NoRemote", fileUser{Pass: obscure.MustObscure("pass")}, "remote not set"},
+		{"NoAuth", fileUser{Remote: "/tmp"}, "need pass or public_keys"},
+		{"PlainPass", fileUser{Remote: "/tmp", Pass: "pass"}, "bcrypt hash or obscured"},
+		{"BadKey", fileUser{Remote: "/tmp", PublicKeys: []string{"potato"}}, "bad public key"},
+		{"BadQuota", fileUser{Remote: "/tmp", Pass: obscure.MustObscure("pass"), Quota: "potato"}, "bad quota"},
+		{"OK", fileUser{Remote: "/tmp", Pass: obscure.MustObscure("pass"), Quota: "1G"}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.user.check()
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserFileWithAuthProxy(t *testing.T) {
+	opt := Opt
+	opt.UserFile = "users.yaml"
+	opt.AuthProxy = "proxy"
+	_, err := New(context.Background(), &opt, &vfscommon.Opt)
+	assert.ErrorContains(t, err, "can't use --auth-proxy and --user-file together")
+}
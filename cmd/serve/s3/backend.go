@@ -20,6 +20,9 @@ import (
 
 var (
 	emptyPrefix = &gofakes3.Prefix{}
+
+	errVersionStoreKey = gofakes3.ErrorMessage(gofakes3.ErrInvalidArgument, "key is reserved for the version store")
+	errInvalidKey      = gofakes3.ErrorMessage(gofakes3.ErrInvalidArgument, `key must not contain "." or ".." path segments`)
 )
 
 // s3Backend implements the gofacess3.Backend interface to make an S3
@@ -57,8 +60,12 @@ func (b *s3Backend) ListBuckets(ctx context.Context) ([]gofakes3.BucketInfo, err
 	if err != nil {
 		return nil, err
 	}
+	rules, restricted := policyRules(ctx)
 	var response []gofakes3.BucketInfo
 	for _, entry := range dirEntries {
+		if restricted && !allowedBucket(rules, entry.Name()) {
+			continue
+		}
 		if entry.IsDir() {
 			response = append(response, gofakes3.BucketInfo{
 				Name:         entry.Name(),
@@ -95,6 +102,9 @@ func (b *s3Backend) ListBucket(ctx context.Context, bucket string, prefix *gofak
 
 	response := gofakes3.NewObjectList()
 	path, remaining := prefixParser(prefix)
+	if !validKey(path) {
+		return nil, errInvalidKey
+	}
 
 	err = b.entryListR(_vfs, bucket, path, remaining, prefix.HasDelimiter, response)
 	if err == gofakes3.ErrNoSuchKey {
@@ -126,43 +136,20 @@ func (b *s3Backend) HeadObject(ctx context.Context, bucketName, objectName strin
 	if err != nil {
 		return nil, gofakes3.BucketNotFound(bucketName)
 	}
-
-	fp := path.Join(bucketName, objectName)
-	node, err := _vfs.Stat(fp)
-	if err != nil {
-		return nil, gofakes3.KeyNotFound(objectName)
+	if !validKey(objectName) {
+		return nil, errInvalidKey
 	}
-
-	if !node.IsFile() {
+	if b.isVersionStore(objectName) {
 		return nil, gofakes3.KeyNotFound(objectName)
 	}
 
-	entry := node.DirEntry()
-	if entry == nil {
+	fp := path.Join(bucketName, objectName)
+	node, err := _vfs.Stat(fp)
+	if err != nil {
 		return nil, gofakes3.KeyNotFound(objectName)
 	}
 
-	fobj := entry.(fs.Object)
-	size := node.Size()
-	hash := getFileHashByte(fobj, b.s.etagHashType)
-
-	meta := map[string]string{
-		"Last-Modified": formatHeaderTime(node.ModTime()),
-		"Content-Type":  fs.MimeType(context.Background(), fobj),
-	}
-
-	if val, ok := b.meta.Load(fp); ok {
-		metaMap := val.(map[string]string)
-		maps.Copy(meta, metaMap)
-	}
-
-	return &gofakes3.Object{
-		Name:     objectName,
-		Hash:     hash,
-		Metadata: meta,
-		Size:     size,
-		Contents: noOpReadCloser{},
-	}, nil
+	return b.openNode(node, fp, objectName, nil, false)
 }
 
 // GetObject fetches the object from the filesystem.
@@ -175,6 +162,12 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 	if err != nil {
 		return nil, gofakes3.BucketNotFound(bucketName)
 	}
+	if !validKey(objectName) {
+		return nil, errInvalidKey
+	}
+	if b.isVersionStore(objectName) {
+		return nil, gofakes3.KeyNotFound(objectName)
+	}
 
 	fp := path.Join(bucketName, objectName)
 	node, err := _vfs.Stat(fp)
@@ -182,6 +175,12 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 		return nil, gofakes3.KeyNotFound(objectName)
 	}
 
+	return b.openNode(node, fp, objectName, rangeRequest, true)
+}
+
+// openNode makes a gofakes3.Object for objectName from the node at fp
+// opening it if open is set.
+func (b *s3Backend) openNode(node vfs.Node, fp, objectName string, rangeRequest *gofakes3.ObjectRangeRequest, open bool) (obj *gofakes3.Object, err error) {
 	if !node.IsFile() {
 		return nil, gofakes3.KeyNotFound(objectName)
 	}
@@ -192,11 +191,30 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 	}
 
 	fobj := entry.(fs.Object)
-	file := node.(*vfs.File)
-
 	size := node.Size()
 	hash := getFileHashByte(fobj, b.s.etagHashType)
 
+	meta := map[string]string{
+		"Last-Modified": formatHeaderTime(node.ModTime()),
+		"Content-Type":  fs.MimeType(context.Background(), fobj),
+	}
+
+	if val, ok := b.meta.Load(fp); ok {
+		metaMap := val.(map[string]string)
+		maps.Copy(meta, metaMap)
+	}
+
+	if !open {
+		return &gofakes3.Object{
+			Name:     objectName,
+			Hash:     hash,
+			Metadata: meta,
+			Size:     size,
+			Contents: noOpReadCloser{},
+		}, nil
+	}
+
+	file := node.(*vfs.File)
 	in, err := file.Open(os.O_RDONLY)
 	if err != nil {
 		return nil, gofakes3.ErrInternal
@@ -221,16 +239,6 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 		rdr = limitReadCloser(rdr, in.Close, rnge.Length)
 	}
 
-	meta := map[string]string{
-		"Last-Modified": formatHeaderTime(node.ModTime()),
-		"Content-Type":  fs.MimeType(context.Background(), fobj),
-	}
-
-	if val, ok := b.meta.Load(fp); ok {
-		metaMap := val.(map[string]string)
-		maps.Copy(meta, metaMap)
-	}
-
 	return &gofakes3.Object{
 		Name:     objectName,
 		Hash:     hash,
@@ -311,6 +319,13 @@ func (b *s3Backend) PutObject(
 		return result, gofakes3.BucketNotFound(bucketName)
 	}
 
+	if !validKey(objectName) {
+		return result, errInvalidKey
+	}
+	if b.isVersionStore(objectName) {
+		return result, errVersionStoreKey
+	}
+
 	fp := path.Join(bucketName, objectName)
 	objectDir := path.Dir(fp)
 	// _, err = db.fs.Stat(objectDir)
@@ -325,6 +340,10 @@ func (b *s3Backend) PutObject(
 		}
 	}
 
+	if _, err := b.archiveVersion(_vfs, bucketName, objectName, false); err != nil {
+		return result, err
+	}
+
 	f, err := _vfs.Create(fp)
 	if err != nil {
 		return result, err
@@ -371,7 +390,7 @@ func (b *s3Backend) PutObject(
 // DeleteMulti deletes multiple objects in a single request.
 func (b *s3Backend) DeleteMulti(ctx context.Context, bucketName string, objects ...string) (result gofakes3.MultiDeleteResult, rerr error) {
 	for _, object := range objects {
-		if err := b.deleteObject(ctx, bucketName, object); err != nil {
+		if _, err := b.deleteObject(ctx, bucketName, object); err != nil {
 			fs.Errorf("serve s3", "delete object failed: %v", err)
 			result.Error = append(result.Error, gofakes3.ErrorResult{
 				Code:    gofakes3.ErrInternal,
@@ -390,30 +409,46 @@ func (b *s3Backend) DeleteMulti(ctx context.Context, bucketName string, objects
 
 // DeleteObject deletes the object with the given name.
 func (b *s3Backend) DeleteObject(ctx context.Context, bucketName, objectName string) (result gofakes3.ObjectDeleteResult, rerr error) {
-	return result, b.deleteObject(ctx, bucketName, objectName)
+	return b.deleteObject(ctx, bucketName, objectName)
 }
 
 // deleteObject deletes the object from the filesystem.
-func (b *s3Backend) deleteObject(ctx context.Context, bucketName, objectName string) error {
+//
+// If versioning is enabled on the bucket then this leaves a delete
+// marker instead.
+func (b *s3Backend) deleteObject(ctx context.Context, bucketName, objectName string) (result gofakes3.ObjectDeleteResult, err error) {
 	_vfs, err := b.s.getVFS(ctx)
 	if err != nil {
-		return err
+		return result, err
 	}
 	_, err = _vfs.Stat(bucketName)
 	if err != nil {
-		return gofakes3.BucketNotFound(bucketName)
+		return result, gofakes3.BucketNotFound(bucketName)
+	}
+	if !validKey(objectName) {
+		return result, errInvalidKey
+	}
+	if b.isVersionStore(objectName) {
+		return result, errVersionStoreKey
 	}
 
 	fp := path.Join(bucketName, objectName)
-	// S3 does not report an error when attempting to delete a key that does not exist, so
-	// we need to skip IsNotExist errors.
-	if err := _vfs.Remove(fp); err != nil && !os.IsNotExist(err) {
-		return err
+	markerID, err := b.archiveVersion(_vfs, bucketName, objectName, true)
+	if err != nil {
+		return result, err
+	}
+	if markerID != "" {
+		result.IsDeleteMarker = true
+		result.VersionID = markerID
+	} else if err := _vfs.Remove(fp); err != nil && !os.IsNotExist(err) {
+		// S3 does not report an error when attempting to delete a key that does not exist, so
+		// we need to skip IsNotExist errors.
+		return result, err
 	}
 
 	// FIXME: unsafe operation
 	rmdirRecursive(fp, _vfs)
-	return nil
+	return result, nil
 }
 
 // CreateBucket creates a new bucket.
@@ -448,6 +483,7 @@ func (b *s3Backend) DeleteBucket(ctx context.Context, name string) error {
 		return gofakes3.BucketNotFound(name)
 	}
 
+	b.removeVersionStore(_vfs, name)
 	if err := _vfs.Remove(name); err != nil {
 		return gofakes3.ErrBucketNotEmpty
 	}
@@ -475,6 +511,9 @@ func (b *s3Backend) CopyObject(ctx context.Context, srcBucket, srcKey, dstBucket
 	if err != nil {
 		return result, err
 	}
+	if !validKey(srcKey) || !validKey(dstKey) {
+		return result, errInvalidKey
+	}
 	fp := path.Join(srcBucket, srcKey)
 	if srcBucket == dstBucket && srcKey == dstKey {
 		b.meta.Store(fp, meta)
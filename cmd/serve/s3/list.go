@@ -22,7 +22,7 @@ func (b *s3Backend) entryListR(_vfs *vfs.VFS, bucket, fdPath, name string, addPr
 		// workaround for control-chars detect
 		objectPath := path.Join(fdPath, object)
 
-		if !strings.HasPrefix(object, name) {
+		if !strings.HasPrefix(object, name) || b.isVersionStore(objectPath) {
 			continue
 		}
 
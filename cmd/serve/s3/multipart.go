@@ -5,9 +5,10 @@
 // never buffered in memory. This implements the gofakes3.MultipartBackend
 // interface on s3Backend.
 //
-// When streaming is disabled (--disable-multipart-streaming) or the Fs has no
-// PutStream, ErrMultipartUploadNotSupported is returned so that gofakes3 falls
-// back to buffering the parts in memory.
+// When streaming is disabled (--disable-multipart-streaming), the Fs has no
+// PutStream or the bucket keeps its versions in the version store,
+// ErrMultipartUploadNotSupported is returned so that gofakes3 falls back to
+// buffering the parts in memory.
 
 package s3
 
@@ -93,14 +94,22 @@ func (b *s3Backend) CreateMultipartUpload(ctx context.Context, bucketName, objec
 	if _, err := _vfs.Stat(bucketName); err != nil {
 		return "", gofakes3.BucketNotFound(bucketName)
 	}
+	if !validKey(objectName) {
+		return "", errInvalidKey
+	}
 
 	f := _vfs.Fs()
 	features := f.Features()
-	if b.s.opt.DisableMultipartStreaming || features.PutStream == nil {
+	// Streamed uploads overwrite the object directly so can't keep
+	// the old version in the version store
+	archive := !b.nativeVersions() && b.versioningStatus(_vfs, bucketName) == gofakes3.VersioningEnabled
+	if b.s.opt.DisableMultipartStreaming || features.PutStream == nil || archive {
 		b.warnInMemoryOnce.Do(func() {
 			reason := "this backend doesn't support streaming uploads"
 			if b.s.opt.DisableMultipartStreaming {
 				reason = "--disable-multipart-streaming is set"
+			} else if archive {
+				reason = "versioning is enabled on the bucket"
 			}
 			fs.Logf(nil, "serve s3: buffering multipart uploads in memory because %s - this may use a lot of memory", reason)
 		})
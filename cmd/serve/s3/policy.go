@@ -0,0 +1,282 @@
+// Access policies for serve s3.
+//
+// A policy file restricts what the requests signed with each access
+// key may do. Keys which aren't in the policy file have full access
+// and anonymous requests are refused.
+
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/gofakes3/signature"
+	"github.com/rclone/rclone/fs"
+)
+
+// Access levels for a policyRule
+const (
+	accessRead      = "read"
+	accessReadWrite = "read-write"
+)
+
+// maxPresignedExpires is the longest a presigned URL may be valid for
+// in seconds, as S3 allows.
+const maxPresignedExpires = 7 * 24 * 60 * 60
+
+// maxDeleteBody is the largest DeleteObjects request body which will
+// be read to check the keys against the policy.
+const maxDeleteBody = 4 * 1024 * 1024
+
+// policyRule gives an access key access to part of a bucket
+type policyRule struct {
+	Bucket string `json:"bucket"` // bucket name or "*" for all buckets
+	Prefix string `json:"prefix"` // only keys starting with this - blank for all
+	Access string `json:"access"` // accessRead or accessReadWrite
+}
+
+// policy is the parsed policy file
+type policy struct {
+	Keys map[string][]policyRule `json:"keys"` // rules for each access key
+}
+
+// loadPolicy reads and checks the policy file
+func loadPolicy(path string) (*policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	p := new(policy)
+	err = json.Unmarshal(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %q: %w", path, err)
+	}
+	for key, rules := range p.Keys {
+		for i, rule := range rules {
+			if rule.Bucket == "" {
+				return nil, fmt.Errorf("policy file %q: rule %d for key %q has no bucket", path, i+1, key)
+			}
+			if rule.Access != accessRead && rule.Access != accessReadWrite {
+				return nil, fmt.Errorf("policy file %q: rule %d for key %q has access %q - must be %q or %q", path, i+1, key, rule.Access, accessRead, accessReadWrite)
+			}
+		}
+	}
+	return p, nil
+}
+
+// rules returns the rules for accessKey and whether it is restricted
+// by the policy at all
+func (p *policy) rules(accessKey string) (rules []policyRule, restricted bool) {
+	if p == nil || accessKey == "" {
+		return nil, false
+	}
+	rules, restricted = p.Keys[accessKey]
+	return rules, restricted
+}
+
+// matchBucket returns true if the rule applies to bucket
+func (rule *policyRule) matchBucket(bucket string) bool {
+	return rule.Bucket == "*" || rule.Bucket == bucket
+}
+
+// allowedBucket returns true if the rules give any access to bucket
+func allowedBucket(rules []policyRule, bucket string) bool {
+	for i := range rules {
+		if rules[i].matchBucket(bucket) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedKey returns true if the rules allow reading, or writing if
+// write is set, key in bucket
+func allowedKey(rules []policyRule, bucket, key string, write bool) bool {
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.matchBucket(bucket) || !strings.HasPrefix(key, rule.Prefix) {
+			continue
+		}
+		if !write || rule.Access == accessReadWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// requestBucketKey returns the bucket and key the request is for
+func (w *Server) requestBucketKey(r *http.Request) (bucket, key string) {
+	p := strings.Trim(r.URL.Path, "/")
+	if !w.opt.ForcePathStyle {
+		bucket, _, _ = strings.Cut(r.Host, ".")
+		return bucket, p
+	}
+	bucket, key, _ = strings.Cut(p, "/")
+	return bucket, key
+}
+
+// validRequest returns false if the bucket, key, copy source or
+// listing prefix of the request have "." or ".." path segments.
+//
+// These are resolved when the key is turned into a path so would let
+// the request reach keys which the policy doesn't allow.
+func (w *Server) validRequest(r *http.Request) bool {
+	bucket, key := w.requestBucketKey(r)
+	if !validKey(bucket) || !validKey(key) {
+		return false
+	}
+	if copySource := r.Header.Get("X-Amz-Copy-Source"); copySource != "" {
+		srcBucket, srcKey, ok := parseCopySource(copySource)
+		if !ok || !validKey(srcBucket) || !validKey(srcKey) {
+			return false
+		}
+	}
+	// Only the directory part of the prefix is a path - the rest
+	// matches the start of the names in it
+	prefix := r.URL.Query().Get("prefix")
+	if i := strings.LastIndexByte(prefix, '/'); i >= 0 && !validKey(prefix[:i]) {
+		return false
+	}
+	return true
+}
+
+// policyAllows returns true if the rules allow the request
+func (w *Server) policyAllows(r *http.Request, rules []policyRule) bool {
+	bucket, key := w.requestBucketKey(r)
+	query := r.URL.Query()
+	write := r.Method != http.MethodGet && r.Method != http.MethodHead
+	switch {
+	case bucket == "":
+		// ListBuckets only shows the allowed buckets
+		return !write
+	case key != "":
+		if !allowedKey(rules, bucket, key, write) {
+			return false
+		}
+		if copySource := r.Header.Get("X-Amz-Copy-Source"); copySource != "" {
+			srcBucket, srcKey, ok := parseCopySource(copySource)
+			return ok && allowedKey(rules, srcBucket, srcKey, false)
+		}
+		return true
+	case r.Method == http.MethodPost && query.Has("delete"):
+		return deleteAllowed(r, rules, bucket)
+	case write:
+		// Bucket operations such as CreateBucket need the whole bucket
+		return allowedKey(rules, bucket, "", true)
+	case r.Method == http.MethodHead || query.Has("location") || query.Has("versioning"):
+		return allowedBucket(rules, bucket)
+	default:
+		// Listings must be within an allowed prefix
+		return allowedKey(rules, bucket, query.Get("prefix"), false)
+	}
+}
+
+// parseCopySource returns the bucket and key from an X-Amz-Copy-Source header
+func parseCopySource(copySource string) (bucket, key string, ok bool) {
+	copySource, _, _ = strings.Cut(copySource, "?")
+	copySource, err := url.PathUnescape(copySource)
+	if err != nil {
+		return "", "", false
+	}
+	bucket, key, ok = strings.Cut(strings.TrimPrefix(copySource, "/"), "/")
+	return bucket, key, ok
+}
+
+// deleteAllowed returns true if the rules allow all the deletions in
+// a DeleteObjects request.
+//
+// It reads the body and replaces it so it can be read again.
+func deleteAllowed(r *http.Request, rules []policyRule, bucket string) bool {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxDeleteBody+1))
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil || len(data) > maxDeleteBody {
+		return false
+	}
+	var req gofakes3.DeleteRequest
+	if err := xml.Unmarshal(data, &req); err != nil {
+		return false
+	}
+	for _, object := range req.Objects {
+		if !allowedKey(rules, bucket, object.Key, true) {
+			return false
+		}
+	}
+	return true
+}
+
+// errExpiresTooLong is returned for presigned URLs valid for too long
+var errExpiresTooLong = errors.New("X-Amz-Expires must be less than a week (in seconds) that is 604800")
+
+// checkPresignedExpiry checks the expiry of a presigned URL is
+// within the limit S3 allows
+func checkPresignedExpiry(r *http.Request) error {
+	expires := r.URL.Query().Get("X-Amz-Expires")
+	if expires == "" {
+		return nil
+	}
+	seconds, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || seconds < 0 {
+		return errors.New("X-Amz-Expires should be a number of seconds")
+	}
+	if seconds > maxPresignedExpires {
+		return errExpiresTooLong
+	}
+	return nil
+}
+
+// writeAuthError writes an S3 error response
+func writeAuthError(w http.ResponseWriter, code string, status int, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write(signature.EncodeAPIErrorToResponse(signature.APIError{
+		Code:        code,
+		Description: message,
+	}))
+}
+
+// accessMiddleware checks the expiry of presigned URLs, that the keys
+// in the request are valid and that the access key is allowed to make
+// the request by the policy.
+//
+// The rules for the key are stored in the context so ListBuckets can
+// show only the allowed buckets.
+func accessMiddleware(next http.Handler, ws *Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkPresignedExpiry(r); err != nil {
+			writeAuthError(w, "AuthorizationQueryParametersError", http.StatusBadRequest, err.Error())
+			return
+		}
+		if !ws.validRequest(r) {
+			fs.Infof(r.URL.Path, "%s: Refusing request with invalid key", r.RemoteAddr)
+			writeAuthError(w, "InvalidArgument", http.StatusBadRequest, `Key must not contain "." or ".." path segments`)
+			return
+		}
+		accessKey, _ := parseAccessKeyID(r)
+		if ws.policy != nil && accessKey == "" {
+			fs.Infof(r.URL.Path, "%s: Refusing anonymous request as a policy is in use", r.RemoteAddr)
+			writeAuthError(w, "AccessDenied", http.StatusForbidden, "Access Denied")
+			return
+		}
+		rules, restricted := ws.policy.rules(accessKey)
+		if restricted {
+			if !ws.policyAllows(r, rules) {
+				fs.Infof(r.URL.Path, "%s: Access denied by policy for key %q", r.RemoteAddr, accessKey)
+				writeAuthError(w, "AccessDenied", http.StatusForbidden, "Access Denied")
+				return
+			}
+			r = r.WithContext(withPolicyRules(r.Context(), rules))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,367 @@
+// Access policy and presigned URL tests for serve s3.
+
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `{
+	"keys": {
+		"restricted": [
+			{"bucket": "data", "prefix": "ci/", "access": "read-write"},
+			{"bucket": "data", "prefix": "releases/", "access": "read"},
+			{"bucket": "public", "access": "read"}
+		]
+	}
+}`
+
+// writePolicy writes policy to a file returning its path
+func writePolicy(t *testing.T, policy string) string {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(policy), 0600))
+	return path
+}
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := loadPolicy(writePolicy(t, testPolicy))
+	require.NoError(t, err)
+	rules, restricted := p.rules("restricted")
+	assert.True(t, restricted)
+	assert.Len(t, rules, 3)
+	_, restricted = p.rules("admin")
+	assert.False(t, restricted)
+	_, restricted = p.rules("")
+	assert.False(t, restricted)
+
+	for _, bad := range []string{
+		`potato`,
+		`{"keys": {"k": [{"prefix": "a/", "access": "read"}]}}`,
+		`{"keys": {"k": [{"bucket": "a", "access": "write"}]}}`,
+	} {
+		_, err := loadPolicy(writePolicy(t, bad))
+		assert.Error(t, err, bad)
+	}
+	_, err = loadPolicy(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestPolicyAllows(t *testing.T) {
+	p, err := loadPolicy(writePolicy(t, testPolicy))
+	require.NoError(t, err)
+	rules, _ := p.rules("restricted")
+	w := &Server{opt: Options{ForcePathStyle: true}}
+	for _, test := range []struct {
+		method string
+		url    string
+		header string // X-Amz-Copy-Source
+		body   string
+		want   bool
+	}{
+		{"GET", "/", "", "", true},
+		{"PUT", "/data/ci/file", "", "", true},
+		{"GET", "/data/ci/file", "", "", true},
+		{"DELETE", "/data/ci/file", "", "", true},
+		{"PUT", "/data/other/file", "", "", false},
+		{"GET", "/data/other/file", "", "", false},
+		{"GET", "/data/releases/file", "", "", true},
+		{"PUT", "/data/releases/file", "", "", false},
+		{"HEAD", "/public/file", "", "", true},
+		{"PUT", "/public/file", "", "", false},
+		{"GET", "/private/file", "", "", false},
+		{"POST", "/data/ci/file?uploads", "", "", true},
+		{"PUT", "/data/ci/copy", "/data/releases/file", "", true},
+		{"PUT", "/data/ci/copy", "data/other/file?versionId=x", "", false},
+		{"GET", "/data?location", "", "", true},
+		{"HEAD", "/data", "", "", true},
+		{"GET", "/private?location", "", "", false},
+		{"GET", "/data?list-type=2&prefix=ci/", "", "", true},
+		{"GET", "/data?list-type=2&prefix=", "", "", false},
+		{"GET", "/public?list-type=2", "", "", true},
+		{"PUT", "/data", "", "", false},
+		{"DELETE", "/public", "", "", false},
+		{"POST", "/data?delete", "", "<Delete><Object><Key>ci/a</Key></Object><Object><Key>ci/b</Key></Object></Delete>", true},
+		{"POST", "/data?delete", "", "<Delete><Object><Key>ci/a</Key></Object><Object><Key>releases/b</Key></Object></Delete>", false},
+	} {
+		what := fmt.Sprintf("%s %s %s", test.method, test.url, test.header)
+		r := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		if test.header != "" {
+			r.Header.Set("X-Amz-Copy-Source", test.header)
+		}
+		assert.Equal(t, test.want, w.policyAllows(r, rules), what)
+		// The body must still be readable
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, test.body, string(body), what)
+	}
+
+	// Virtual host style requests have the bucket in the host
+	w.opt.ForcePathStyle = false
+	r := httptest.NewRequest("PUT", "http://data.example.com/ci/file", nil)
+	assert.True(t, w.policyAllows(r, rules))
+	r = httptest.NewRequest("PUT", "http://public.example.com/ci/file", nil)
+	assert.False(t, w.policyAllows(r, rules))
+}
+
+func TestValidRequest(t *testing.T) {
+	w := &Server{opt: Options{ForcePathStyle: true}}
+	for _, test := range []struct {
+		url    string
+		header string // X-Amz-Copy-Source
+		want   bool
+	}{
+		{"/data/ci/file", "", true},
+		{"/data/ci/.hidden", "", true},
+		{"/data/ci/..file", "", true},
+		{"/data/ci/../releases/file", "", false},
+		{"/data/ci/%2e%2e/releases/file", "", false},
+		{"/data/ci/./file", "", false},
+		{"/data/ci/..", "", false},
+		{"/data/ci/a/../../.versions/file", "", false},
+		{"/../private/file", "", false},
+		{"/data/ci/copy", "/data/releases/file", true},
+		{"/data/ci/copy", "/data/ci/../other/file", false},
+		{"/data/ci/copy", "/data/ci/%2e%2e/other/file", false},
+		{"/data?list-type=2&prefix=ci/..", "", true},
+		{"/data?list-type=2&prefix=ci/../", "", false},
+		{"/data?list-type=2&prefix=ci/../other/", "", false},
+	} {
+		what := fmt.Sprintf("%s %s", test.url, test.header)
+		r := httptest.NewRequest("GET", test.url, nil)
+		if test.header != "" {
+			r.Header.Set("X-Amz-Copy-Source", test.header)
+		}
+		assert.Equal(t, test.want, w.validRequest(r), what)
+	}
+}
+
+func TestCheckPresignedExpiry(t *testing.T) {
+	for _, test := range []struct {
+		expires string
+		ok      bool
+	}{
+		{"", true},
+		{"3600", true},
+		{"604800", true},
+		{"604801", false},
+		{"-1", false},
+		{"potato", false},
+	} {
+		r := httptest.NewRequest("GET", "/bucket/key?X-Amz-Expires="+url.QueryEscape(test.expires), nil)
+		err := checkPresignedExpiry(r)
+		assert.Equal(t, test.ok, err == nil, test.expires)
+	}
+}
+
+func TestParseAccessKeyIDPresigned(t *testing.T) {
+	r := httptest.NewRequest("GET", "/bucket/key?X-Amz-Credential="+url.QueryEscape("AKID/20240101/us-east-1/s3/aws4_request"), nil)
+	accessKey, _ := parseAccessKeyID(r)
+	assert.Equal(t, "AKID", accessKey)
+}
+
+// newPolicyTestServer starts a server with an admin key and a key
+// restricted by testPolicy returning clients for both
+func newPolicyTestServer(t *testing.T) (admin, restricted *minio.Client, f fs.Fs) {
+	fstest.Initialise()
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	for _, bucket := range []string{"data", "public", "private"} {
+		require.NoError(t, f.Mkdir(ctx, bucket))
+	}
+
+	opt := Opt
+	opt.AuthKey = []string{"admin,adminsecret", "restricted,restrictedsecret"}
+	opt.PolicyFile = writePolicy(t, testPolicy)
+	opt.HTTP.ListenAddr = []string{endpoint}
+	w, err := newServer(ctx, f, &opt, &vfscommon.Opt, &proxy.Opt)
+	require.NoError(t, err)
+	go func() { _ = w.Serve() }()
+	t.Cleanup(func() { _ = w.Shutdown() })
+
+	u, err := url.Parse(w.server.URLs()[0])
+	require.NoError(t, err)
+	newClient := func(keyid, keysec string) *minio.Client {
+		client, err := minio.New(u.Host, &minio.Options{
+			Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+			Secure: false,
+			Region: "us-east-1",
+		})
+		require.NoError(t, err)
+		return client
+	}
+	return newClient("admin", "adminsecret"), newClient("restricted", "restrictedsecret"), f
+}
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	admin, restricted, _ := newPolicyTestServer(t)
+
+	put := func(client *minio.Client, bucket, key string) error {
+		_, err := client.PutObject(ctx, bucket, key, strings.NewReader("hello"), 5, minio.PutObjectOptions{})
+		return err
+	}
+
+	// The admin key isn't in the policy so can do anything
+	require.NoError(t, put(admin, "private", "secret"))
+	require.NoError(t, put(admin, "data", "releases/file"))
+	require.NoError(t, put(admin, "public", "file"))
+
+	// The restricted key can only write its prefix
+	assert.NoError(t, put(restricted, "data", "ci/file"))
+	assert.Error(t, put(restricted, "data", "releases/file"))
+	assert.Error(t, put(restricted, "private", "file"))
+
+	// And read what it is allowed to
+	_, err := restricted.StatObject(ctx, "data", "releases/file", minio.StatObjectOptions{})
+	assert.NoError(t, err)
+	_, err = restricted.StatObject(ctx, "private", "secret", minio.StatObjectOptions{})
+	assert.Error(t, err)
+
+	// ListBuckets only shows the allowed buckets
+	buckets, err := restricted.ListBuckets(ctx)
+	require.NoError(t, err)
+	var names []string
+	for _, bucket := range buckets {
+		names = append(names, bucket.Name)
+	}
+	assert.Equal(t, []string{"data", "public"}, names)
+	buckets, err = admin.ListBuckets(ctx)
+	require.NoError(t, err)
+	assert.Len(t, buckets, 3)
+}
+
+func TestPolicyAnonymous(t *testing.T) {
+	ctx := context.Background()
+	admin, _, _ := newPolicyTestServer(t)
+	_, err := admin.PutObject(ctx, "public", "file", strings.NewReader("hello"), 5, minio.PutObjectOptions{})
+	require.NoError(t, err)
+
+	// Unsigned requests are refused when there is a policy
+	for _, path := range []string{"/", "/public", "/public/file"} {
+		resp, err := http.Get(admin.EndpointURL().String() + path)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, path)
+		assert.Contains(t, string(body), "AccessDenied", path)
+	}
+
+	// A policy can't be used without auth as all requests would
+	// be anonymous
+	f, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	opt := Opt
+	opt.PolicyFile = writePolicy(t, testPolicy)
+	opt.HTTP.ListenAddr = []string{endpoint}
+	_, err = newServer(ctx, f, &opt, &vfscommon.Opt, &proxy.Opt)
+	assert.ErrorContains(t, err, "--policy-file needs")
+}
+
+func TestPolicyTraversal(t *testing.T) {
+	ctx := context.Background()
+	admin, restricted, f := newPolicyTestServer(t)
+	_, err := admin.PutObject(ctx, "data", "releases/file", strings.NewReader("release"), 7, minio.PutObjectOptions{})
+	require.NoError(t, err)
+
+	// Keys with ".." can't be used to escape the allowed prefix
+	_, err = restricted.PutObject(ctx, "data", "ci/../releases/file", strings.NewReader("hacked"), 6, minio.PutObjectOptions{})
+	assert.Error(t, err)
+	_, err = restricted.StatObject(ctx, "data", "ci/../../private/secret", minio.StatObjectOptions{})
+	assert.Error(t, err)
+	_, err = restricted.CopyObject(ctx, minio.CopyDestOptions{Bucket: "data", Object: "ci/copy"}, minio.CopySrcOptions{Bucket: "data", Object: "ci/../other/file"})
+	assert.Error(t, err)
+	assert.Equal(t, "release", string(readObject(t, f, "data", "releases/file")))
+
+	// Even for keys which aren't restricted by the policy
+	_, err = admin.PutObject(ctx, "data", "ci/../.versions/file", strings.NewReader("hacked"), 6, minio.PutObjectOptions{})
+	assert.Error(t, err)
+}
+
+func TestPresigned(t *testing.T) {
+	ctx := context.Background()
+	admin, restricted, f := newPolicyTestServer(t)
+
+	// Upload with a presigned PUT
+	putURL, err := restricted.PresignedPutObject(ctx, "data", "ci/artifact.txt", time.Hour)
+	require.NoError(t, err)
+	req, err := http.NewRequest("PUT", putURL.String(), strings.NewReader("artifact"))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "artifact", string(readObject(t, f, "data", "ci/artifact.txt")))
+
+	get := func(client *minio.Client, bucket, key string, expires time.Duration) (int, string) {
+		getURL, err := client.PresignedGetObject(ctx, bucket, key, expires, nil)
+		require.NoError(t, err)
+		resp, err := http.Get(getURL.String())
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode, string(body)
+	}
+
+	// Download with a presigned GET
+	status, body := get(restricted, "data", "ci/artifact.txt", time.Hour)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "artifact", body)
+
+	// The policy applies to presigned URLs too
+	_, err = admin.PutObject(ctx, "private", "secret", strings.NewReader("secret"), 6, minio.PutObjectOptions{})
+	require.NoError(t, err)
+	status, body = get(restricted, "private", "secret", time.Hour)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Contains(t, body, "AccessDenied")
+	status, body = get(admin, "private", "secret", time.Hour)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "secret", body)
+
+	// Presigned URLs can't be valid for more than a week
+	getURL, err := admin.PresignedGetObject(ctx, "private", "secret", time.Hour, nil)
+	require.NoError(t, err)
+	query := getURL.Query()
+	query.Set("X-Amz-Expires", "604801")
+	getURL.RawQuery = query.Encode()
+	resp, err = http.Get(getURL.String())
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, string(data), "AuthorizationQueryParametersError")
+
+	// Presigned URLs expire
+	getURL, err = admin.PresignedGetObject(ctx, "private", "secret", time.Second, nil)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Second)
+	resp, err = http.Get(getURL.String())
+	require.NoError(t, err)
+	data, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(data), "AccessDenied")
+}
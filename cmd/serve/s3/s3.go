@@ -41,6 +41,10 @@ var OptionsInfo = fs.Options{{
 	Name:    "disable_multipart_streaming",
 	Default: false,
 	Help:    "Buffer multipart uploads in memory instead of streaming them to the backend (see the Multipart uploads docs section)",
+}, {
+	Name:    "policy_file",
+	Default: "",
+	Help:    "Path to a JSON file of access policies for the auth keys (see the Access policies docs section)",
 }}.
 	Add(httplib.ConfigInfo).
 	Add(httplib.AuthConfigInfo)
@@ -53,6 +57,7 @@ type Options struct {
 	AuthKey                   []string `config:"auth_key"`
 	NoCleanup                 bool     `config:"no_cleanup"`
 	DisableMultipartStreaming bool     `config:"disable_multipart_streaming"`
+	PolicyFile                string   `config:"policy_file"`
 	Auth                      httplib.AuthConfig
 	HTTP                      httplib.Config
 }
@@ -110,10 +115,10 @@ var Command = &cobra.Command{
 	},
 	Use:   "s3 remote:path",
 	Short: `Serve remote:path over s3.`,
-	Long:  help() + strings.TrimSpace(httplib.AuthHelp(flagPrefix)+httplib.Help(flagPrefix)+vfs.Help()),
+	Long:  help() + strings.TrimSpace(httplib.AuthHelp(flagPrefix)+httplib.Help(flagPrefix)+vfs.Help()+proxy.Help),
 	RunE: func(command *cobra.Command, args []string) error {
 		var f fs.Fs
-		if proxy.Opt.AuthProxy == "" {
+		if !proxy.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
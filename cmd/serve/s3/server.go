@@ -27,6 +27,7 @@ type ctxKey int
 
 const (
 	ctxKeyID ctxKey = iota
+	ctxKeyPolicy
 )
 
 // Server is a s3.FileSystem interface
@@ -34,6 +35,7 @@ type Server struct {
 	server       *httplib.Server
 	opt          Options
 	f            fs.Fs
+	versionsFs   fs.Fs    // f listing old versions if the backend has them
 	_vfs         *vfs.VFS // don't use directly, use getVFS
 	faker        *gofakes3.GoFakeS3
 	handler      http.Handler
@@ -41,6 +43,7 @@ type Server struct {
 	ctx          context.Context // for global config
 	s3Secret     string
 	etagHashType hash.Type
+	policy       *policy // access policies or nil
 }
 
 // Make a new S3 Server to serve the remote
@@ -64,12 +67,33 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		fs.Debugf(f, "Using hash %v for ETag", w.etagHashType)
 	}
 
-	if len(opt.AuthKey) == 0 {
+	if f != nil {
+		w.versionsFs, err = newVersionsFs(ctx, f)
+		if err != nil {
+			fs.Debugf(f, "Keeping object versions in the %s directory of each bucket as can't list the remote's versions: %v", versionsDir, err)
+		} else if w.versionsFs != nil {
+			fs.Debugf(f, "Using the remote's object versions")
+		}
+	}
+
+	if len(opt.AuthKey) == 0 && proxyOpt.UserFile == "" {
 		fs.Logf("serve s3", "No auth provided so allowing anonymous access")
 	} else {
 		w.s3Secret = getAuthSecret(opt.AuthKey)
 	}
 
+	if opt.PolicyFile != "" {
+		// Without auth every request is anonymous so the
+		// policy would never apply
+		if len(opt.AuthKey) == 0 && !proxyOpt.Enabled() {
+			return nil, errors.New("--policy-file needs --auth-key, --auth-proxy or --user-file")
+		}
+		w.policy, err = loadPolicy(opt.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	authList, err := authlistResolver(opt.AuthKey)
 	if err != nil {
 		return nil, fmt.Errorf("parsing auth list failed: %q", err)
@@ -81,20 +105,25 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		gofakes3.WithHostBucket(!opt.ForcePathStyle),
 		gofakes3.WithLogger(newLogger),
 		gofakes3.WithRequestID(rand.Uint64()),
-		gofakes3.WithoutVersioning(),
 		gofakes3.WithV4Auth(authList),
 		gofakes3.WithIntegrityCheck(true), // Check Content-MD5 if supplied
 	)
 
-	w.handler = w.faker.Server()
+	w.handler = accessMiddleware(w.faker.Server(), w)
 
-	if proxy.Opt.AuthProxy != "" {
-		w.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
+	if proxyOpt.Enabled() {
+		w.proxy, err = proxy.New(ctx, proxyOpt, vfsOpt)
+		if err != nil {
+			return nil, err
+		}
 		// proxy auth middleware
 		w.handler = proxyAuthMiddleware(w.handler, w)
 		w.handler = authPairMiddleware(w.handler, w)
 	} else {
-		w._vfs = vfs.New(ctx, f, vfsOpt)
+		w._vfs, err = vfs.NewWithError(ctx, f, vfsOpt)
+		if err != nil {
+			return nil, err
+		}
 
 		if len(opt.AuthKey) > 0 {
 			w.faker.AddAuthKeys(authList)
@@ -133,7 +162,22 @@ func (w *Server) getVFS(ctx context.Context) (VFS *vfs.VFS, err error) {
 }
 
 // auth does proxy authorization
+//
+// With --user-file the access key is the user name and the secret key
+// is their password. The signature of the request is checked with the
+// secret key after this.
 func (w *Server) auth(accessKeyID string) (value any, err error) {
+	if w.proxy.Opt.UserFile != "" {
+		secret, err := w.proxy.UserSecret(accessKeyID)
+		if err != nil {
+			return nil, err
+		}
+		VFS, _, err := w.proxy.Call(accessKeyID, secret, false)
+		if err != nil {
+			return nil, err
+		}
+		return VFS, nil
+	}
 	VFS, _, err := w.proxy.Call(stringToMd5Hash(accessKeyID), accessKeyID, false)
 	if err != nil {
 		return nil, err
@@ -167,9 +211,19 @@ func (w *Server) Shutdown() error {
 func authPairMiddleware(next http.Handler, ws *Server) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		accessKey, _ := parseAccessKeyID(r)
+		secret := ws.s3Secret
+		if ws.proxy.Opt.UserFile != "" {
+			var err error
+			secret, err = ws.proxy.UserSecret(accessKey)
+			if err != nil {
+				// no VFS was found for the request so it will fail
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
 		// set the auth pair
 		authPair := map[string]string{
-			accessKey: ws.s3Secret,
+			accessKey: secret,
 		}
 		ws.faker.AddAuthKeys(authPair)
 		next.ServeHTTP(w, r)
@@ -191,8 +245,24 @@ func proxyAuthMiddleware(next http.Handler, ws *Server) http.Handler {
 	})
 }
 
+// withPolicyRules returns a context holding the policy rules for the request
+func withPolicyRules(ctx context.Context, rules []policyRule) context.Context {
+	return context.WithValue(ctx, ctxKeyPolicy, rules)
+}
+
+// policyRules returns the policy rules for the request and whether it is restricted
+func policyRules(ctx context.Context) (rules []policyRule, restricted bool) {
+	rules, restricted = ctx.Value(ctxKeyPolicy).([]policyRule)
+	return rules, restricted
+}
+
 func parseAccessKeyID(r *http.Request) (accessKey string, error signature.ErrorCode) {
 	v4Auth := r.Header.Get("Authorization")
+	// Presigned URLs have the credential in the query string
+	if credential := r.URL.Query().Get("X-Amz-Credential"); v4Auth == "" && credential != "" {
+		accessKey, _, _ = strings.Cut(credential, "/")
+		return accessKey, signature.ErrNone
+	}
 	req, err := signature.ParseSignV4(v4Auth)
 	if err != signature.ErrNone {
 		return "", err
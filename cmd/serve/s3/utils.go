@@ -94,6 +94,20 @@ func prefixParser(p *gofakes3.Prefix) (path, remaining string) {
 	return p.Prefix[:idx], p.Prefix[idx+1:]
 }
 
+// validKey returns false if key has "." or ".." path segments.
+//
+// Keys are joined onto the bucket with path.Join which would resolve
+// these, letting a key refer to a file outside the prefix it appears
+// to be in or to the version store.
+func validKey(key string) bool {
+	for segment := range strings.SplitSeq(key, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
 // FIXME this could be implemented by VFS.MkdirAll()
 func mkdirRecursive(path string, VFS *vfs.VFS) error {
 	path = strings.Trim(path, "/")
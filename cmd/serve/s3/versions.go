@@ -0,0 +1,714 @@
+// Object versioning support for serve s3.
+//
+// Backends which can list the old versions of objects themselves
+// (those with a "versions" option such as s3 and b2) are used
+// directly. The remote is opened a second time with versions set and
+// the old versions it lists, named by lib/version, are the object
+// versions.
+//
+// On other backends old versions are kept in a hidden version store,
+// the versionsDir directory at the top of each bucket. When versioning
+// is enabled on the bucket, overwriting or deleting an object moves
+// the current version into the store named by lib/version, and
+// deleting an object leaves a delete marker there too.
+//
+// The current version of an object always has the version ID "null"
+// and the old versions have IDs made from the time of the version.
+//
+// This implements the gofakes3.VersionedBackend interface on
+// s3Backend.
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/version"
+	"github.com/rclone/rclone/vfs"
+)
+
+const (
+	// versionsOption is the backend option used to list old versions
+	versionsOption = "versions"
+
+	// versionsDir is the hidden directory in each bucket holding
+	// the old versions on backends without native versions
+	versionsDir = ".rclone-versions"
+
+	// versioningFile is the file in versionsDir holding the
+	// versioning status of the bucket
+	versioningFile = ".versioning"
+
+	// deleteMarkerSuffix is added to the names of delete markers
+	// in versionsDir
+	deleteMarkerSuffix = ".delete-marker"
+
+	// versionIDFormat is the time format of the version IDs
+	versionIDFormat = "2006-01-02T15:04:05.000Z"
+
+	// nullVersionID is the version ID of the current version
+	nullVersionID = "null"
+)
+
+// newVersionsFs returns a copy of f which lists the old versions of
+// objects or nil if the backend doesn't support that.
+func newVersionsFs(ctx context.Context, f fs.Fs) (fs.Fs, error) {
+	configString := fs.ConfigStringFull(f)
+	fsInfo, _, _, _, err := fs.ConfigFs(configString)
+	if err != nil {
+		return nil, err
+	}
+	if fsInfo.Options.Get(versionsOption) == nil {
+		return nil, nil
+	}
+	parsed, err := fspath.Parse(configString)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Config == nil {
+		parsed.Config = make(configmap.Simple)
+	}
+	parsed.Config[versionsOption] = "true"
+	fsString := parsed.Name + "," + parsed.Config.String() + ":" + parsed.Path
+	versionsFs, err := cache.Get(ctx, fsString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make versions remote: %w", err)
+	}
+	return versionsFs, nil
+}
+
+// objectVersion describes one version of an object
+type objectVersion struct {
+	key          string    // key of the object in the bucket
+	t            time.Time // time of the version - zero for the current version
+	deleteMarker bool      // set if this is a delete marker
+	modTime      time.Time // modification time of the object
+	size         int64     // size of the object
+	etag         string    // hash of the object
+}
+
+// versionID returns the version ID for the version at t
+func versionID(t time.Time) gofakes3.VersionID {
+	if t.IsZero() {
+		return ""
+	}
+	return gofakes3.VersionID(t.UTC().Format(versionIDFormat))
+}
+
+// parseVersionID returns the time of the version with id or the zero
+// time for the current version
+func parseVersionID(id gofakes3.VersionID) (time.Time, error) {
+	if id == "" || id == nullVersionID {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(versionIDFormat, string(id))
+	if err != nil {
+		return t, gofakes3.ErrNoSuchVersion
+	}
+	return t, nil
+}
+
+// versionName returns the path of the version of key at t relative to dir
+func versionName(dir, key string, t time.Time, deleteMarker bool) string {
+	name := path.Join(dir, path.Dir(key), version.Add(path.Base(key), t))
+	if deleteMarker {
+		name += deleteMarkerSuffix
+	}
+	return name
+}
+
+// parseVersionName returns the key and the time of the version from
+// name as made by versionName. t is zero if name isn't a version.
+func parseVersionName(name string) (key string, t time.Time, deleteMarker bool) {
+	name, deleteMarker = strings.CutSuffix(name, deleteMarkerSuffix)
+	t, leaf := version.Remove(path.Base(name))
+	return path.Join(path.Dir(name), leaf), t, deleteMarker
+}
+
+// nativeVersions returns true if the remote keeps the object versions itself
+func (b *s3Backend) nativeVersions() bool {
+	return b.s.versionsFs != nil
+}
+
+// versionsVFS returns the VFS to use for the versioning calls which
+// gofakes3 makes without a context so can't use the auth proxy.
+func (b *s3Backend) versionsVFS() (*vfs.VFS, error) {
+	if b.s._vfs == nil {
+		return nil, gofakes3.ErrNotImplemented
+	}
+	return b.s._vfs, nil
+}
+
+// isVersionStore returns true if key is in the version store so
+// shouldn't be used as an object
+func (b *s3Backend) isVersionStore(key string) bool {
+	return !b.nativeVersions() && (key == versionsDir || strings.HasPrefix(key, versionsDir+"/"))
+}
+
+// versioningStatus returns the versioning status of the bucket
+func (b *s3Backend) versioningStatus(_vfs *vfs.VFS, bucket string) gofakes3.VersioningStatus {
+	if b.nativeVersions() {
+		return gofakes3.VersioningEnabled
+	}
+	data, err := _vfs.ReadFile(path.Join(bucket, versionsDir, versioningFile))
+	if err != nil {
+		return gofakes3.VersioningNone
+	}
+	return gofakes3.VersioningStatus(strings.TrimSpace(string(data)))
+}
+
+// newVersionTime returns an unused time for a new version of key
+func newVersionTime(_vfs *vfs.VFS, bucket, key string) time.Time {
+	dir := path.Join(bucket, versionsDir)
+	t := time.Now().UTC().Truncate(time.Millisecond)
+	for {
+		_, errVersion := _vfs.Stat(versionName(dir, key, t, false))
+		_, errMarker := _vfs.Stat(versionName(dir, key, t, true))
+		if errVersion == vfs.ENOENT && errMarker == vfs.ENOENT {
+			return t
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// archiveVersion moves the current version of key into the version
+// store if versioning is enabled on the bucket and the remote doesn't
+// keep versions itself.
+//
+// If deleteMarker is set it also makes a delete marker and returns
+// its version ID.
+func (b *s3Backend) archiveVersion(_vfs *vfs.VFS, bucket, key string, deleteMarker bool) (markerID gofakes3.VersionID, err error) {
+	if b.nativeVersions() || b.versioningStatus(_vfs, bucket) != gofakes3.VersioningEnabled {
+		return "", nil
+	}
+	dir := path.Join(bucket, versionsDir)
+	fp := path.Join(bucket, key)
+	node, err := _vfs.Stat(fp)
+	exists := err == nil && node.IsFile()
+	if !exists && !deleteMarker {
+		return "", nil
+	}
+	err = _vfs.MkdirAll(path.Join(dir, path.Dir(key)), 0777)
+	if err != nil {
+		return "", fmt.Errorf("failed to make version store: %w", err)
+	}
+	if exists {
+		name := versionName(dir, key, newVersionTime(_vfs, bucket, key), false)
+		err = _vfs.Rename(fp, name)
+		if err != nil {
+			return "", fmt.Errorf("failed to store old version: %w", err)
+		}
+		if meta, ok := b.meta.LoadAndDelete(fp); ok {
+			b.meta.Store(name, meta)
+		}
+	}
+	if !deleteMarker {
+		return "", nil
+	}
+	t := newVersionTime(_vfs, bucket, key)
+	err = _vfs.WriteFile(versionName(dir, key, t, true), nil, 0666)
+	if err != nil {
+		return "", fmt.Errorf("failed to make delete marker: %w", err)
+	}
+	return versionID(t), nil
+}
+
+// removeVersionStore removes the version store of the bucket if it
+// holds no versions so an empty bucket can be deleted
+func (b *s3Backend) removeVersionStore(_vfs *vfs.VFS, bucket string) {
+	if b.nativeVersions() {
+		return
+	}
+	dir := path.Join(bucket, versionsDir)
+	entries, err := getDirEntries(dir, _vfs)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Name() != versioningFile {
+			return
+		}
+	}
+	_ = _vfs.Remove(path.Join(dir, versioningFile))
+	_ = _vfs.Remove(dir)
+}
+
+// removeEmptyStoreDirs removes the directories holding name in the
+// version store of the bucket if they are empty
+func removeEmptyStoreDirs(_vfs *vfs.VFS, bucket, name string) {
+	store := path.Join(bucket, versionsDir)
+	for dir := path.Dir(name); strings.HasPrefix(dir, store+"/"); dir = path.Dir(dir) {
+		entries, err := getDirEntries(dir, _vfs)
+		if err != nil || len(entries) > 0 || _vfs.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// listNodes calls fn with each file below dir in root with its key
+// relative to root
+func listNodes(_vfs *vfs.VFS, root, dir string, fn func(key string, node vfs.Node) error) error {
+	entries, err := getDirEntries(path.Join(root, dir), _vfs)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		key := path.Join(dir, entry.Name())
+		if entry.IsDir() {
+			err = listNodes(_vfs, root, key, fn)
+		} else {
+			err = fn(key, entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeVersions returns the versions of the objects below dir in the
+// bucket on a backend without native versions
+func (b *s3Backend) storeVersions(_vfs *vfs.VFS, bucket, dir string) (versions []objectVersion, err error) {
+	err = listNodes(_vfs, bucket, dir, func(key string, node vfs.Node) error {
+		if b.isVersionStore(key) {
+			return nil
+		}
+		versions = append(versions, objectVersion{
+			key:     key,
+			modTime: node.ModTime(),
+			size:    node.Size(),
+			etag:    getFileHash(node, b.s.etagHashType),
+		})
+		return nil
+	})
+	if err != nil && err != gofakes3.ErrNoSuchKey {
+		return nil, err
+	}
+	err = listNodes(_vfs, path.Join(bucket, versionsDir), dir, func(name string, node vfs.Node) error {
+		key, t, deleteMarker := parseVersionName(name)
+		if t.IsZero() {
+			return nil
+		}
+		v := objectVersion{
+			key:          key,
+			t:            t,
+			deleteMarker: deleteMarker,
+			modTime:      t,
+		}
+		if !deleteMarker {
+			v.modTime = node.ModTime()
+			v.size = node.Size()
+			v.etag = getFileHash(node, b.s.etagHashType)
+		}
+		versions = append(versions, v)
+		return nil
+	})
+	if err != nil && err != gofakes3.ErrNoSuchKey {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// nativeObjectVersions returns the versions of the objects below dir
+// in the bucket from the remote
+func (b *s3Backend) nativeObjectVersions(ctx context.Context, bucket, dir string) (versions []objectVersion, err error) {
+	err = walk.ListR(ctx, b.s.versionsFs, path.Join(bucket, dir), true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			key, t, _ := parseVersionName(strings.TrimPrefix(o.Remote(), bucket+"/"))
+			versions = append(versions, objectVersion{
+				key:     key,
+				t:       t,
+				modTime: o.ModTime(ctx),
+				size:    o.Size(),
+				etag:    getFileHash(o, b.s.etagHashType),
+			})
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, nil
+	}
+	return versions, err
+}
+
+// sortVersions sorts versions by key with the current version then
+// the newest version of each key first
+func sortVersions(versions []objectVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, b := versions[i], versions[j]
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		if a.t.IsZero() || b.t.IsZero() {
+			return a.t.IsZero() && !b.t.IsZero()
+		}
+		return a.t.After(b.t)
+	})
+}
+
+// keyVersions returns the versions of key newest first
+func (b *s3Backend) keyVersions(ctx context.Context, _vfs *vfs.VFS, bucket, key string) (versions []objectVersion, err error) {
+	if b.nativeVersions() {
+		versions, err = b.nativeObjectVersions(ctx, bucket, path.Dir(key))
+	} else {
+		versions, err = b.storeVersions(_vfs, bucket, path.Dir(key))
+	}
+	if err != nil {
+		return nil, err
+	}
+	sortVersions(versions)
+	n := 0
+	for _, v := range versions {
+		if v.key == key {
+			versions[n] = v
+			n++
+		}
+	}
+	return versions[:n], nil
+}
+
+// VersioningConfiguration returns the versioning status of the bucket.
+func (b *s3Backend) VersioningConfiguration(bucket string) (config gofakes3.VersioningConfiguration, err error) {
+	_vfs, err := b.versionsVFS()
+	if err != nil {
+		return config, err
+	}
+	config.Status = b.versioningStatus(_vfs, bucket)
+	return config, nil
+}
+
+// SetVersioningConfiguration enables or suspends versioning on the bucket.
+//
+// If the remote keeps versions itself then versioning is set up on the
+// remote and can't be changed.
+func (b *s3Backend) SetVersioningConfiguration(bucket string, config gofakes3.VersioningConfiguration) error {
+	_vfs, err := b.versionsVFS()
+	if err != nil {
+		return err
+	}
+	if config.MFADelete == gofakes3.MFADeleteEnabled {
+		return gofakes3.ErrNotImplemented
+	}
+	if b.nativeVersions() {
+		if config.Status == gofakes3.VersioningEnabled {
+			return nil
+		}
+		return gofakes3.ErrNotImplemented
+	}
+	if config.Status == gofakes3.VersioningNone {
+		return nil
+	}
+	dir := path.Join(bucket, versionsDir)
+	err = _vfs.MkdirAll(dir, 0777)
+	if err != nil {
+		return err
+	}
+	return _vfs.WriteFile(path.Join(dir, versioningFile), []byte(config.Status), 0666)
+}
+
+// getObjectVersion finds the version of the object and opens it if open is set.
+func (b *s3Backend) getObjectVersion(bucketName, objectName string, id gofakes3.VersionID, rangeRequest *gofakes3.ObjectRangeRequest, open bool) (obj *gofakes3.Object, err error) {
+	if !validKey(objectName) {
+		return nil, errInvalidKey
+	}
+	ctx := context.Background()
+	_vfs, err := b.versionsVFS()
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseVersionID(id)
+	if err != nil {
+		return nil, err
+	}
+	if t.IsZero() {
+		if open {
+			obj, err = b.GetObject(ctx, bucketName, objectName, rangeRequest)
+		} else {
+			obj, err = b.HeadObject(ctx, bucketName, objectName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		obj.VersionID = id
+		return obj, nil
+	}
+
+	if b.nativeVersions() {
+		o, err := b.s.versionsFs.NewObject(ctx, versionName(bucketName, objectName, t, false))
+		if err != nil {
+			return nil, gofakes3.ErrNoSuchVersion
+		}
+		obj, err = b.openObject(ctx, o, objectName, rangeRequest, open)
+	} else {
+		dir := path.Join(bucketName, versionsDir)
+		if _, err := _vfs.Stat(versionName(dir, objectName, t, true)); err == nil {
+			return &gofakes3.Object{
+				Name:           objectName,
+				VersionID:      id,
+				IsDeleteMarker: true,
+				Contents:       noOpReadCloser{},
+			}, nil
+		}
+		fp := versionName(dir, objectName, t, false)
+		node, err := _vfs.Stat(fp)
+		if err != nil || !node.IsFile() {
+			return nil, gofakes3.ErrNoSuchVersion
+		}
+		obj, err = b.openNode(node, fp, objectName, rangeRequest, open)
+	}
+	if err != nil {
+		return nil, err
+	}
+	obj.VersionID = id
+	return obj, nil
+}
+
+// openObject makes a gofakes3.Object from the remote object o opening
+// it if open is set.
+func (b *s3Backend) openObject(ctx context.Context, o fs.Object, objectName string, rangeRequest *gofakes3.ObjectRangeRequest, open bool) (*gofakes3.Object, error) {
+	obj := &gofakes3.Object{
+		Name: objectName,
+		Hash: getFileHashByte(o, b.s.etagHashType),
+		Metadata: map[string]string{
+			"Last-Modified": formatHeaderTime(o.ModTime(ctx)),
+			"Content-Type":  fs.MimeType(ctx, o),
+		},
+		Size:     o.Size(),
+		Contents: noOpReadCloser{},
+	}
+	if !open {
+		return obj, nil
+	}
+	rnge, err := rangeRequest.Range(obj.Size)
+	if err != nil {
+		return nil, err
+	}
+	var options []fs.OpenOption
+	if rnge != nil {
+		options = append(options, &fs.RangeOption{Start: rnge.Start, End: rnge.Start + rnge.Length - 1})
+	}
+	in, err := o.Open(ctx, options...)
+	if err != nil {
+		return nil, gofakes3.ErrInternal
+	}
+	obj.Range = rnge
+	obj.Contents = in
+	return obj, nil
+}
+
+// GetObjectVersion fetches the given version of the object.
+func (b *s3Backend) GetObjectVersion(bucketName, objectName string, id gofakes3.VersionID, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
+	return b.getObjectVersion(bucketName, objectName, id, rangeRequest, true)
+}
+
+// HeadObjectVersion returns the fileinfo for the given version of the object.
+func (b *s3Backend) HeadObjectVersion(bucketName, objectName string, id gofakes3.VersionID) (*gofakes3.Object, error) {
+	return b.getObjectVersion(bucketName, objectName, id, nil, false)
+}
+
+// DeleteObjectVersion permanently deletes the given version of the object.
+//
+// If a delete marker which hid the object is deleted then the newest
+// old version becomes the current version again.
+func (b *s3Backend) DeleteObjectVersion(bucketName, objectName string, id gofakes3.VersionID) (result gofakes3.ObjectDeleteResult, err error) {
+	if !validKey(objectName) {
+		return result, errInvalidKey
+	}
+	ctx := context.Background()
+	_vfs, err := b.versionsVFS()
+	if err != nil {
+		return result, err
+	}
+	t, err := parseVersionID(id)
+	if err != nil {
+		return result, err
+	}
+	result.VersionID = id
+	fp := path.Join(bucketName, objectName)
+	if t.IsZero() {
+		if err := _vfs.Remove(fp); err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+		b.meta.Delete(fp)
+		rmdirRecursive(fp, _vfs)
+		return result, nil
+	}
+
+	if b.nativeVersions() {
+		o, err := b.s.versionsFs.NewObject(ctx, versionName(bucketName, objectName, t, false))
+		if err != nil {
+			// S3 doesn't report an error for versions which don't exist
+			return result, nil
+		}
+		return result, o.Remove(ctx)
+	}
+
+	dir := path.Join(bucketName, versionsDir)
+	name := versionName(dir, objectName, t, true)
+	if _, err := _vfs.Stat(name); err == nil {
+		result.IsDeleteMarker = true
+	} else {
+		name = versionName(dir, objectName, t, false)
+	}
+	if err := _vfs.Remove(name); err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	b.meta.Delete(name)
+	removeEmptyStoreDirs(_vfs, bucketName, name)
+	if result.IsDeleteMarker {
+		err = b.restoreVersion(ctx, _vfs, bucketName, objectName)
+	}
+	return result, err
+}
+
+// restoreVersion makes the newest old version of the object current
+// again if there is no current version and it isn't a delete marker
+func (b *s3Backend) restoreVersion(ctx context.Context, _vfs *vfs.VFS, bucketName, objectName string) error {
+	versions, err := b.keyVersions(ctx, _vfs, bucketName, objectName)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 || versions[0].t.IsZero() || versions[0].deleteMarker {
+		return nil
+	}
+	fp := path.Join(bucketName, objectName)
+	if objectDir := path.Dir(fp); objectDir != "." {
+		if err := mkdirRecursive(objectDir, _vfs); err != nil {
+			return err
+		}
+	}
+	name := versionName(path.Join(bucketName, versionsDir), objectName, versions[0].t, false)
+	err = _vfs.Rename(name, fp)
+	if err != nil {
+		return fmt.Errorf("failed to restore old version: %w", err)
+	}
+	if meta, ok := b.meta.LoadAndDelete(name); ok {
+		b.meta.Store(fp, meta)
+	}
+	removeEmptyStoreDirs(_vfs, bucketName, name)
+	return nil
+}
+
+// ListBucketVersions lists all the versions of the objects in the bucket.
+func (b *s3Backend) ListBucketVersions(bucketName string, prefix *gofakes3.Prefix, page *gofakes3.ListBucketVersionsPage) (*gofakes3.ListBucketVersionsResult, error) {
+	ctx := context.Background()
+	_vfs, err := b.versionsVFS()
+	if err != nil {
+		return nil, err
+	}
+	if prefix == nil {
+		prefix = emptyPrefix
+	}
+
+	// workaround as in ListBucket
+	if strings.TrimSpace(prefix.Prefix) == "" {
+		prefix.HasPrefix = false
+	}
+	if strings.TrimSpace(prefix.Delimiter) == "" {
+		prefix.HasDelimiter = false
+	}
+
+	dir := ""
+	if prefix.HasPrefix {
+		dir, _ = prefixParser(prefix)
+	}
+	var versions []objectVersion
+	if b.nativeVersions() {
+		versions, err = b.nativeObjectVersions(ctx, bucketName, dir)
+	} else {
+		versions, err = b.storeVersions(_vfs, bucketName, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sortVersions(versions)
+
+	result := gofakes3.NewListBucketVersionsResult(bucketName, prefix, page)
+	maxKeys := page.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	skipping := page.HasKeyMarker
+	var (
+		count   int64
+		lastKey string
+		match   gofakes3.PrefixMatch
+	)
+	for _, v := range versions {
+		isLatest := v.key != lastKey
+		lastKey = v.key
+		id := versionID(v.t)
+		if skipping {
+			if v.key < page.KeyMarker {
+				continue
+			}
+			if v.key == page.KeyMarker {
+				if page.HasVersionIDMarker && (id == page.VersionIDMarker || (id == "" && page.VersionIDMarker == nullVersionID)) {
+					skipping = false
+				}
+				continue
+			}
+			skipping = false
+		}
+		if !prefix.Match(v.key, &match) {
+			continue
+		}
+		if match.CommonPrefix {
+			result.AddPrefix(match.MatchedPart)
+			continue
+		}
+		if count >= maxKeys {
+			last := result.Versions[len(result.Versions)-1]
+			result.IsTruncated = true
+			result.NextVersionIDMarker = last.GetVersionID()
+			if result.NextVersionIDMarker == "" {
+				result.NextVersionIDMarker = nullVersionID
+			}
+			break
+		}
+		if v.deleteMarker {
+			result.Versions = append(result.Versions, &gofakes3.DeleteMarker{
+				Key:          v.key,
+				VersionID:    id,
+				IsLatest:     isLatest,
+				LastModified: gofakes3.NewContentTime(v.modTime),
+			})
+		} else {
+			result.Versions = append(result.Versions, &gofakes3.Version{
+				Key:          v.key,
+				VersionID:    id,
+				IsLatest:     isLatest,
+				LastModified: gofakes3.NewContentTime(v.modTime),
+				Size:         v.size,
+				StorageClass: gofakes3.StorageStandard,
+				ETag:         `"` + v.etag + `"`,
+			})
+		}
+		result.NextKeyMarker = v.key
+		count++
+	}
+	if !result.IsTruncated {
+		result.NextKeyMarker = ""
+	}
+	return result, nil
+}
+
+// Check the interfaces are satisfied
+var _ gofakes3.VersionedBackend = (*s3Backend)(nil)
@@ -0,0 +1,148 @@
+// Object versioning tests for serve s3.
+
+package s3
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionName(t *testing.T) {
+	tm := time.Date(2024, 3, 4, 5, 6, 7, 890000000, time.UTC)
+	for _, test := range []struct {
+		key          string
+		deleteMarker bool
+		want         string
+	}{
+		{"file.txt", false, "bucket/.rclone-versions/file-v2024-03-04-050607-890.txt"},
+		{"dir/file", false, "bucket/.rclone-versions/dir/file-v2024-03-04-050607-890"},
+		{"dir/file.txt", true, "bucket/.rclone-versions/dir/file-v2024-03-04-050607-890.txt.delete-marker"},
+	} {
+		got := versionName("bucket/"+versionsDir, test.key, tm, test.deleteMarker)
+		assert.Equal(t, test.want, got)
+		key, gotT, deleteMarker := parseVersionName(strings.TrimPrefix(got, "bucket/"+versionsDir+"/"))
+		assert.Equal(t, test.key, key)
+		assert.True(t, tm.Equal(gotT))
+		assert.Equal(t, test.deleteMarker, deleteMarker)
+	}
+
+	key, gotT, _ := parseVersionName("dir/file.txt")
+	assert.Equal(t, "dir/file.txt", key)
+	assert.True(t, gotT.IsZero())
+
+	id := versionID(tm)
+	assert.Equal(t, "2024-03-04T05:06:07.890Z", string(id))
+	gotT, err := parseVersionID(id)
+	require.NoError(t, err)
+	assert.True(t, tm.Equal(gotT))
+	gotT, err = parseVersionID(nullVersionID)
+	require.NoError(t, err)
+	assert.True(t, gotT.IsZero())
+	_, err = parseVersionID("potato")
+	assert.Error(t, err)
+}
+
+// listVersions returns the versions of the objects in the bucket
+func listVersions(t *testing.T, client *minio.Client, bucket string) (versions []minio.ObjectInfo) {
+	for info := range client.ListObjects(context.Background(), bucket, minio.ListObjectsOptions{
+		Recursive:    true,
+		WithVersions: true,
+	}) {
+		require.NoError(t, info.Err)
+		versions = append(versions, info)
+	}
+	return versions
+}
+
+// getVersion reads the version of object from the bucket
+func getVersion(t *testing.T, client *minio.Client, bucket, object, versionID string) string {
+	ctx := context.Background()
+	in, err := client.GetObject(ctx, bucket, object, minio.GetObjectOptions{VersionID: versionID})
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func TestVersioning(t *testing.T) {
+	ctx := context.Background()
+	core, f, bucket := newMultipartTestServer(t, false)
+	client := core.Client
+	const object = "dir/file.txt"
+
+	put := func(contents string) {
+		_, err := client.PutObject(ctx, bucket, object, strings.NewReader(contents), int64(len(contents)), minio.PutObjectOptions{})
+		require.NoError(t, err)
+	}
+
+	// Versioning is off to start with
+	config, err := client.GetBucketVersioning(ctx, bucket)
+	require.NoError(t, err)
+	assert.False(t, config.Enabled())
+
+	// Turning versioning on keeps the object there already
+	put("zero")
+	require.NoError(t, client.EnableVersioning(ctx, bucket))
+	config, err = client.GetBucketVersioning(ctx, bucket)
+	require.NoError(t, err)
+	assert.True(t, config.Enabled())
+
+	put("one")
+	put("two")
+	require.NoError(t, client.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{}))
+
+	// The object has gone from the normal listing and the version
+	// store isn't visible
+	for info := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+		require.NoError(t, info.Err)
+		t.Errorf("unexpected object %q", info.Key)
+	}
+	_, err = client.StatObject(ctx, bucket, object, minio.StatObjectOptions{})
+	assert.Error(t, err)
+
+	// The delete marker is the latest version then the old versions newest first
+	versions := listVersions(t, client, bucket)
+	require.Len(t, versions, 4)
+	for _, v := range versions {
+		assert.Equal(t, object, v.Key)
+		assert.NotEqual(t, "", v.VersionID)
+		assert.NotEqual(t, nullVersionID, v.VersionID)
+	}
+	assert.True(t, versions[0].IsDeleteMarker)
+	assert.True(t, versions[0].IsLatest)
+	assert.False(t, versions[1].IsDeleteMarker)
+	assert.False(t, versions[1].IsLatest)
+	assert.Equal(t, int64(3), versions[1].Size)
+	marker, two, one, zero := versions[0].VersionID, versions[1].VersionID, versions[2].VersionID, versions[3].VersionID
+
+	// Old versions can be read
+	assert.Equal(t, "zero", getVersion(t, client, bucket, object, zero))
+	assert.Equal(t, "one", getVersion(t, client, bucket, object, one))
+	assert.Equal(t, "two", getVersion(t, client, bucket, object, two))
+
+	// Removing the delete marker brings back the newest version
+	require.NoError(t, client.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{VersionID: marker}))
+	assert.Equal(t, "two", getVersion(t, client, bucket, object, ""))
+	assert.Equal(t, "two", string(readObject(t, f, bucket, object)))
+	versions = listVersions(t, client, bucket)
+	require.Len(t, versions, 3)
+	assert.Equal(t, nullVersionID, versions[0].VersionID)
+	assert.True(t, versions[0].IsLatest)
+	assert.Equal(t, one, versions[1].VersionID)
+	assert.Equal(t, zero, versions[2].VersionID)
+
+	// Removing old versions deletes them permanently
+	require.NoError(t, client.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{VersionID: one}))
+	require.NoError(t, client.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{VersionID: zero}))
+	versions = listVersions(t, client, bucket)
+	require.Len(t, versions, 1)
+	assert.Equal(t, nullVersionID, versions[0].VersionID)
+}
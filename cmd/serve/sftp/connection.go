@@ -54,6 +54,21 @@ type conn struct {
 	what     string
 }
 
+// writeDf writes the output of the df command with the sizes in KiB
+func writeDf(out io.Writer, total, used, free int64) error {
+	perc := int64(0)
+	if total > 0 && used >= 0 {
+		perc = (100 * used) / total
+	}
+	_, err := fmt.Fprintf(out, `		Filesystem                   1K-blocks      Used Available Use%% Mounted on
+/dev/root %d %d  %d  %d%% /
+`, total, used, free, perc)
+	if err != nil {
+		return fmt.Errorf("send output failed: %w", err)
+	}
+	return nil
+}
+
 // execCommand implements an extremely limited number of commands to
 // interoperate with the rclone sftp backend
 func (c *conn) execCommand(ctx context.Context, out io.Writer, command string) (err error) {
@@ -67,6 +82,10 @@ func (c *conn) execCommand(ctx context.Context, out io.Writer, command string) (
 	fs.Debugf(c.what, "exec command: binary = %q, args = %q", binary, args)
 	switch binary {
 	case "df":
+		if c.vfs.Opt.Quota >= 0 {
+			total, used, free := c.vfs.Statfs()
+			return writeDf(out, total/1024, used/1024, free/1024)
+		}
 		about := c.vfs.Fs().Features().About
 		if about == nil {
 			return errors.New("df not supported")
@@ -85,16 +104,7 @@ func (c *conn) execCommand(ctx context.Context, out io.Writer, command string) (
 		if usage.Free != nil {
 			free = *usage.Free / 1024
 		}
-		perc := int64(0)
-		if total > 0 && used >= 0 {
-			perc = (100 * used) / total
-		}
-		_, err = fmt.Fprintf(out, `		Filesystem                   1K-blocks      Used Available Use%% Mounted on
-/dev/root %d %d  %d  %d%% /
-`, total, used, free, perc)
-		if err != nil {
-			return fmt.Errorf("send output failed: %w", err)
-		}
+		return writeDf(out, total, used, free)
 	case "md5sum":
 		return c.handleHashsumCommand(ctx, out, hash.MD5, args)
 	case "sha1sum":
@@ -358,7 +368,11 @@ func serveStdio(f fs.Fs) error {
 		stdin:  os.Stdin,
 		stdout: os.Stdout,
 	}
-	handlers := newVFSHandler(vfs.New(context.Background(), f, &vfscommon.Opt))
+	VFS, err := vfs.NewWithError(context.Background(), f, &vfscommon.Opt)
+	if err != nil {
+		return err
+	}
+	handlers := newVFSHandler(VFS)
 	return serveChannel(sshChannel, handlers, "stdio")
 }
 
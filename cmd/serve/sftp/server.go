@@ -52,10 +52,18 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		opt:     *opt,
 		stopped: make(chan struct{}),
 	}
-	if proxy.Opt.AuthProxy != "" {
-		s.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
+	if proxyOpt.Enabled() {
+		var err error
+		s.proxy, err = proxy.New(ctx, proxyOpt, vfsOpt)
+		if err != nil {
+			return nil, err
+		}
 	} else {
-		s.vfs = vfs.New(ctx, f, vfsOpt)
+		var err error
+		s.vfs, err = vfs.NewWithError(ctx, f, vfsOpt)
+		if err != nil {
+			return nil, err
+		}
 	}
 	err := s.configure()
 	if err != nil {
@@ -140,12 +148,12 @@ func (s *server) configure() (err error) {
 	var authorizedKeysMap map[string]struct{}
 
 	// ensure the user isn't trying to use conflicting flags
-	if proxy.Opt.AuthProxy != "" && s.opt.AuthorizedKeys != "" && s.opt.AuthorizedKeys != Opt.AuthorizedKeys {
-		return errors.New("--auth-proxy and --authorized-keys cannot be used at the same time")
+	if s.proxy != nil && s.opt.AuthorizedKeys != "" && s.opt.AuthorizedKeys != Opt.AuthorizedKeys {
+		return errors.New("--auth-proxy or --user-file and --authorized-keys cannot be used at the same time")
 	}
 
 	// Load the authorized keys
-	if s.opt.AuthorizedKeys != "" && proxy.Opt.AuthProxy == "" {
+	if s.opt.AuthorizedKeys != "" && s.proxy == nil {
 		authKeysFile := env.ShellExpand(s.opt.AuthorizedKeys)
 		authorizedKeysMap, err = loadAuthorizedKeys(authKeysFile)
 		// If user set the flag away from the default then report an error
@@ -161,7 +169,7 @@ func (s *server) configure() (err error) {
 	}
 
 	if !s.opt.NoAuth && len(authorizedKeysMap) == 0 && s.opt.User == "" && s.opt.Pass == "" && s.proxy == nil {
-		return errors.New("no authorization found, use --user/--pass or --authorized-keys or --no-auth or --auth-proxy")
+		return errors.New("no authorization found, use --user/--pass or --authorized-keys or --no-auth or --auth-proxy or --user-file")
 	}
 
 	// An SSH server is represented by a ServerConfig, which holds
@@ -0,0 +1,457 @@
+// Persistent WebDAV locks
+
+package webdav
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/rclone/rclone/lib/random"
+	"golang.org/x/net/webdav"
+)
+
+// lockFacility is the name of the kv database the locks are kept in
+const lockFacility = "webdav-locks"
+
+// lockTokenPrefix makes lock tokens into URIs as RFC 4918 requires
+const lockTokenPrefix = "opaquelocktoken:"
+
+// lockRecord is a lock as stored in the database
+type lockRecord struct {
+	Root      string        // path of the locked resource
+	OwnerXML  string        // verbatim <owner> from the LOCK request
+	ZeroDepth bool          // set if only Root is locked, not its children
+	Duration  time.Duration // timeout - negative for infinite
+	Expiry    time.Time     // when the lock expires - zero for never
+}
+
+// newLockRecord makes a lockRecord from the details at time now
+func newLockRecord(now time.Time, details webdav.LockDetails) *lockRecord {
+	rec := &lockRecord{
+		Root:      slashClean(details.Root),
+		OwnerXML:  details.OwnerXML,
+		ZeroDepth: details.ZeroDepth,
+	}
+	rec.refresh(now, details.Duration)
+	return rec
+}
+
+// refresh sets the timeout of the lock to duration from now
+func (rec *lockRecord) refresh(now time.Time, duration time.Duration) {
+	rec.Duration = duration
+	rec.Expiry = time.Time{}
+	if duration >= 0 {
+		rec.Expiry = now.Add(duration)
+	}
+}
+
+// expired returns true if the lock has expired at time now
+func (rec *lockRecord) expired(now time.Time) bool {
+	return !rec.Expiry.IsZero() && !now.Before(rec.Expiry)
+}
+
+// details returns the lock as webdav.LockDetails
+func (rec *lockRecord) details() webdav.LockDetails {
+	return webdav.LockDetails{
+		Root:      rec.Root,
+		Duration:  rec.Duration,
+		OwnerXML:  rec.OwnerXML,
+		ZeroDepth: rec.ZeroDepth,
+	}
+}
+
+// covers returns true if the lock applies to the resource at name
+func (rec *lockRecord) covers(name string) bool {
+	if name == rec.Root {
+		return true
+	}
+	return !rec.ZeroDepth && isDescendant(name, rec.Root)
+}
+
+// slashClean makes name into a clean absolute path
+func slashClean(name string) string {
+	return path.Clean("/" + name)
+}
+
+// isDescendant returns true if name is inside the directory dir
+func isDescendant(name, dir string) bool {
+	return name != dir && (dir == "/" || strings.HasPrefix(name, dir+"/"))
+}
+
+// lockMap is the locks indexed by token
+type lockMap map[string]*lockRecord
+
+// canCreate returns true if a new lock on name doesn't conflict with
+// any of the locks
+func (locks lockMap) canCreate(name string, zeroDepth bool) bool {
+	for _, rec := range locks {
+		if rec.covers(name) {
+			return false
+		}
+		// An infinite depth lock can't contain any other locks
+		if !zeroDepth && isDescendant(rec.Root, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// opLocks calls fn with the unexpired locks under prefix in the
+// database.
+//
+// If write is set then expired locks are removed and any changes fn
+// makes to the locks are saved.
+type opLocks struct {
+	prefix string
+	now    time.Time
+	write  bool
+	fn     func(locks lockMap) error
+}
+
+func (op *opLocks) Do(ctx context.Context, b kv.Bucket) error {
+	locks := make(lockMap)
+	stored := make(map[string]string)
+	var expired []string
+	err := b.ForEach(func(bkey, data []byte) error {
+		key, found := strings.CutPrefix(string(bkey), op.prefix)
+		if !found {
+			return nil
+		}
+		rec := new(lockRecord)
+		if err := json.Unmarshal(data, rec); err != nil {
+			fs.Errorf(nil, "Ignoring corrupted WebDAV lock %q: %v", bkey, err)
+			expired = append(expired, string(key))
+			return nil
+		}
+		if rec.expired(op.now) {
+			expired = append(expired, string(key))
+			return nil
+		}
+		locks[string(key)] = rec
+		stored[string(key)] = string(data)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err = op.fn(locks); err != nil || !op.write {
+		return err
+	}
+	for _, token := range expired {
+		if err = b.Delete([]byte(op.prefix + token)); err != nil {
+			return err
+		}
+	}
+	for token := range stored {
+		if _, found := locks[token]; !found {
+			if err = b.Delete([]byte(op.prefix + token)); err != nil {
+				return err
+			}
+		}
+	}
+	for token, rec := range locks {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if stored[token] != string(data) {
+			if err = b.Put([]byte(op.prefix+token), data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lockSystem is a webdav.LockSystem which keeps its locks in a kv
+// database so they survive restarts and are shared with the other
+// servers serving the same remote on this machine.
+//
+// The webdav handler takes a temporary lock on the resources of each
+// write request made without a lock token. Those locks are made
+// through a tempLockSystem and only kept in memory so they can't
+// outlive the request if the server stops.
+//
+// A request using a lock claims it in held until it finishes so other
+// requests can't use it at the same time. These claims are only kept
+// in memory too, so requests to different servers presenting the same
+// token aren't stopped from running at once.
+type lockSystem struct {
+	db     *kv.DB
+	prefix string // the locks for this remote are stored under here
+	mu     sync.Mutex
+	temp   lockMap             // temporary locks
+	held   map[string]struct{} // tokens of the locks in use by a request
+}
+
+// check interface
+var _ webdav.LockSystem = (*lockSystem)(nil)
+
+// tempLockSystem is the webdav.LockSystem used for requests other than
+// LOCK.
+//
+// The webdav handler only creates locks for those requests to guard
+// their resources until they finish, so the locks it creates are
+// temporary.
+type tempLockSystem struct {
+	*lockSystem
+}
+
+// Create creates a temporary lock. See webdav.LockSystem.
+func (ls tempLockSystem) Create(now time.Time, details webdav.LockDetails) (token string, err error) {
+	return ls.create(now, details, true)
+}
+
+// forRequest returns the lock system to use for the request r
+func forRequest(ls webdav.LockSystem, r *http.Request) webdav.LockSystem {
+	if persistent, ok := ls.(*lockSystem); ok && r.Method != "LOCK" {
+		return tempLockSystem{persistent}
+	}
+	return ls
+}
+
+// newLockSystem returns a lock system which persists the locks for f
+// in a kv database, or an in memory one if that isn't possible
+func newLockSystem(ctx context.Context, f fs.Fs) (webdav.LockSystem, *kv.DB) {
+	db, err := kv.Start(ctx, lockFacility, f)
+	if err != nil {
+		fs.Errorf(f, "WebDAV locks won't be saved between runs: %v", err)
+		return webdav.NewMemLS(), nil
+	}
+	// The database is shared by all the remotes with the same name
+	// so keep the locks for each root separately.
+	var prefix string
+	if f != nil {
+		id := md5.Sum([]byte(fs.ConfigString(f)))
+		prefix = hex.EncodeToString(id[:8]) + "/"
+	}
+	fs.Debugf(f, "Using WebDAV lock database %s", db.Path())
+	return &lockSystem{
+		db:     db,
+		prefix: prefix,
+		temp:   make(lockMap),
+		held:   make(map[string]struct{}),
+	}, db
+}
+
+// lockSystems keeps a lock system for each VFS served.
+//
+// When serving with the auth proxy or --user-file each user has their
+// own VFS so they each get their own locks rather than sharing one set
+// of paths between them all.
+type lockSystems struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	systems map[string]webdav.LockSystem // lock system for each remote
+	dbs     []*kv.DB                     // databases to close on stop
+}
+
+// newLockSystems makes a new lockSystems
+func newLockSystems(ctx context.Context) *lockSystems {
+	return &lockSystems{
+		ctx:     ctx,
+		systems: make(map[string]webdav.LockSystem),
+	}
+}
+
+// get returns the lock system for f, making it if necessary
+func (lss *lockSystems) get(f fs.Fs) webdav.LockSystem {
+	key := fs.ConfigString(f)
+	lss.mu.Lock()
+	defer lss.mu.Unlock()
+	ls := lss.systems[key]
+	if ls == nil {
+		var db *kv.DB
+		ls, db = newLockSystem(lss.ctx, f)
+		if db != nil {
+			lss.dbs = append(lss.dbs, db)
+		}
+		lss.systems[key] = ls
+	}
+	return ls
+}
+
+// stop closes the lock databases
+func (lss *lockSystems) stop() {
+	lss.mu.Lock()
+	defer lss.mu.Unlock()
+	for _, db := range lss.dbs {
+		_ = db.Stop(false)
+	}
+	lss.dbs = nil
+	lss.systems = make(map[string]webdav.LockSystem)
+}
+
+// do runs fn on the locks in the database and the temporary locks
+//
+// Call with ls.mu held
+func (ls *lockSystem) do(now time.Time, write bool, fn func(locks lockMap) error) error {
+	for token, rec := range ls.temp {
+		if rec.expired(now) {
+			delete(ls.temp, token)
+		}
+	}
+	err := ls.db.Do(write, &opLocks{prefix: ls.prefix, now: now, write: write, fn: fn})
+	if errors.Is(err, kv.ErrEmpty) {
+		// There are no locks in the database yet
+		err = fn(make(lockMap))
+	}
+	return err
+}
+
+// withTemp returns locks with the temporary locks added
+//
+// Call with ls.mu held
+func (ls *lockSystem) withTemp(locks lockMap) lockMap {
+	all := make(lockMap, len(locks)+len(ls.temp))
+	for token, rec := range locks {
+		all[token] = rec
+	}
+	for token, rec := range ls.temp {
+		all[token] = rec
+	}
+	return all
+}
+
+// lookup returns the token of a lock which covers name, matches one of
+// the conditions and isn't held by another request, or "" if none
+//
+// Call with ls.mu held
+func (ls *lockSystem) lookup(locks lockMap, name string, conditions []webdav.Condition) string {
+	for _, c := range conditions {
+		rec := locks[c.Token]
+		if rec == nil {
+			continue
+		}
+		if _, held := ls.held[c.Token]; held {
+			continue
+		}
+		if rec.covers(name) {
+			return c.Token
+		}
+	}
+	return ""
+}
+
+// Confirm confirms that the caller can claim all of the locks
+// specified by the given conditions. See webdav.LockSystem.
+func (ls *lockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (release func(), err error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	var token0, token1 string
+	err = ls.do(now, false, func(locks lockMap) error {
+		locks = ls.withTemp(locks)
+		if name0 != "" {
+			if token0 = ls.lookup(locks, slashClean(name0), conditions); token0 == "" {
+				return webdav.ErrConfirmationFailed
+			}
+		}
+		if name1 != "" {
+			if token1 = ls.lookup(locks, slashClean(name1), conditions); token1 == "" {
+				return webdav.ErrConfirmationFailed
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Don't hold the same lock twice
+	if token1 == token0 {
+		token1 = ""
+	}
+	for _, token := range []string{token0, token1} {
+		if token != "" {
+			ls.held[token] = struct{}{}
+		}
+	}
+	return func() {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		delete(ls.held, token0)
+		delete(ls.held, token1)
+	}, nil
+}
+
+// Create creates a lock which is saved in the database. See
+// webdav.LockSystem.
+func (ls *lockSystem) Create(now time.Time, details webdav.LockDetails) (token string, err error) {
+	return ls.create(now, details, false)
+}
+
+// create creates a lock, keeping it in memory only if temporary is set
+func (ls *lockSystem) create(now time.Time, details webdav.LockDetails, temporary bool) (token string, err error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	rec := newLockRecord(now, details)
+	token = lockTokenPrefix + random.String(32)
+	err = ls.do(now, !temporary, func(locks lockMap) error {
+		if !ls.withTemp(locks).canCreate(rec.Root, rec.ZeroDepth) {
+			return webdav.ErrLocked
+		}
+		if !temporary {
+			locks[token] = rec
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if temporary {
+		ls.temp[token] = rec
+	}
+	return token, nil
+}
+
+// Refresh refreshes the lock with the given token. See webdav.LockSystem.
+func (ls *lockSystem) Refresh(now time.Time, token string, duration time.Duration) (details webdav.LockDetails, err error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if _, held := ls.held[token]; held {
+		return details, webdav.ErrLocked
+	}
+	if rec := ls.temp[token]; rec != nil && !rec.expired(now) {
+		rec.refresh(now, duration)
+		return rec.details(), nil
+	}
+	err = ls.do(now, true, func(locks lockMap) error {
+		rec := locks[token]
+		if rec == nil {
+			return webdav.ErrNoSuchLock
+		}
+		rec.refresh(now, duration)
+		details = rec.details()
+		return nil
+	})
+	return details, err
+}
+
+// Unlock unlocks the lock with the given token. See webdav.LockSystem.
+func (ls *lockSystem) Unlock(now time.Time, token string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if _, held := ls.held[token]; held {
+		return webdav.ErrLocked
+	}
+	if _, found := ls.temp[token]; found {
+		delete(ls.temp, token)
+		return nil
+	}
+	return ls.do(now, true, func(locks lockMap) error {
+		if locks[token] == nil {
+			return webdav.ErrNoSuchLock
+		}
+		delete(locks, token)
+		return nil
+	})
+}
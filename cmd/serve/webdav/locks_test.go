@@ -0,0 +1,291 @@
+//go:build !windows && !darwin
+
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/cmd/serve/proxy"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+// newTestLockSystem makes a persistent lock system for f
+func newTestLockSystem(t *testing.T, f fs.Fs) *lockSystem {
+	ls, db := newLockSystem(context.Background(), f)
+	require.NotNil(t, db)
+	t.Cleanup(func() { _ = db.Stop(false) })
+	return ls.(*lockSystem)
+}
+
+func TestLockSystem(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	ls := newTestLockSystem(t, f)
+	now := time.Now()
+
+	// Lock a directory and its contents
+	dirToken, err := ls.Create(now, webdav.LockDetails{Root: "/dir", Duration: time.Minute, OwnerXML: "<owner/>"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(dirToken, lockTokenPrefix))
+
+	// Conflicting locks can't be made
+	for _, details := range []webdav.LockDetails{
+		{Root: "/dir", Duration: time.Minute, ZeroDepth: true},
+		{Root: "/dir/file", Duration: time.Minute, ZeroDepth: true},
+		{Root: "/", Duration: time.Minute},
+	} {
+		_, err = ls.Create(now, details)
+		assert.Equal(t, webdav.ErrLocked, err, details.Root)
+	}
+	_, err = tempLockSystem{ls}.Create(now, webdav.LockDetails{Root: "/dir/file", Duration: -1, ZeroDepth: true})
+	assert.Equal(t, webdav.ErrLocked, err)
+
+	// But ones elsewhere can
+	fileToken, err := ls.Create(now, webdav.LockDetails{Root: "/file", Duration: time.Minute, ZeroDepth: true})
+	require.NoError(t, err)
+	tempToken, err := tempLockSystem{ls}.Create(now, webdav.LockDetails{Root: "/other", Duration: -1, ZeroDepth: true})
+	require.NoError(t, err)
+	assert.Contains(t, ls.temp, tempToken)
+	_, err = ls.Create(now, webdav.LockDetails{Root: "/other", Duration: time.Minute})
+	assert.Equal(t, webdav.ErrLocked, err)
+	require.NoError(t, ls.Unlock(now, tempToken))
+	assert.NotContains(t, ls.temp, tempToken)
+
+	// Confirm needs the right token
+	_, err = ls.Confirm(now, "/dir/file", "", webdav.Condition{Token: fileToken})
+	assert.Equal(t, webdav.ErrConfirmationFailed, err)
+	release, err := ls.Confirm(now, "/dir/file", "/file", webdav.Condition{Token: dirToken}, webdav.Condition{Token: fileToken})
+	require.NoError(t, err)
+
+	// Held locks can't be confirmed again, refreshed or unlocked
+	_, err = ls.Confirm(now, "/dir/file", "", webdav.Condition{Token: dirToken})
+	assert.Equal(t, webdav.ErrConfirmationFailed, err)
+	_, err = ls.Refresh(now, dirToken, time.Hour)
+	assert.Equal(t, webdav.ErrLocked, err)
+	assert.Equal(t, webdav.ErrLocked, ls.Unlock(now, fileToken))
+	release()
+
+	// The locks are shared with other servers using the database
+	ls2 := newTestLockSystem(t, f)
+	details, err := ls2.Refresh(now, dirToken, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "/dir", details.Root)
+	assert.Equal(t, "<owner/>", details.OwnerXML)
+	assert.Equal(t, time.Hour, details.Duration)
+
+	// But not with other remotes
+	f2, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	ls3 := newTestLockSystem(t, f2)
+	_, err = ls3.Refresh(now, dirToken, time.Hour)
+	assert.Equal(t, webdav.ErrNoSuchLock, err)
+
+	// Locks expire
+	later := now.Add(2 * time.Minute)
+	_, err = ls.Refresh(later, fileToken, time.Minute)
+	assert.Equal(t, webdav.ErrNoSuchLock, err)
+	release, err = ls.Confirm(later, "/dir", "", webdav.Condition{Token: dirToken})
+	require.NoError(t, err)
+	release()
+
+	// Unlocking removes the lock
+	require.NoError(t, ls2.Unlock(later, dirToken))
+	assert.Equal(t, webdav.ErrNoSuchLock, ls.Unlock(later, dirToken))
+	_, err = ls.Create(later, webdav.LockDetails{Root: "/", Duration: time.Minute})
+	require.NoError(t, err)
+}
+
+// startLockServer starts a webdav server on f
+func startLockServer(t *testing.T, f fs.Fs) string {
+	opt := Opt
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	opt.DeadProps = true
+	w, err := newWebDAV(context.Background(), f, &opt, &vfscommon.Opt, &proxy.Opt)
+	require.NoError(t, err)
+	go func() {
+		require.NoError(t, w.Serve())
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, w.Shutdown())
+	})
+	return w.server.URLs()[0]
+}
+
+// doRequest makes a webdav request returning the status and body
+func doRequest(t *testing.T, method, url, body string, headers ...string) (status int, header http.Header, respBody string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp.StatusCode, resp.Header, string(data)
+}
+
+// lockBody is the body of a LOCK request
+const lockBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:">
+  <D:lockscope><D:exclusive/></D:lockscope>
+  <D:locktype><D:write/></D:locktype>
+  <D:owner>tester</D:owner>
+</D:lockinfo>`
+
+func TestLockHTTP(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	url1 := startLockServer(t, f)
+	url2 := startLockServer(t, f)
+
+	status, _, _ := doRequest(t, "PUT", url1+"file.txt", "one")
+	require.Equal(t, http.StatusCreated, status)
+
+	status, header, _ := doRequest(t, "LOCK", url1+"file.txt", lockBody, "Timeout", "Second-600")
+	require.Equal(t, http.StatusOK, status)
+	token := header.Get("Lock-Token")
+	require.NotEqual(t, "", token)
+
+	// Both servers refuse writes without the token
+	for _, url := range []string{url1, url2} {
+		status, _, _ = doRequest(t, "PUT", url+"file.txt", "two")
+		assert.Equal(t, http.StatusLocked, status)
+		status, _, _ = doRequest(t, "DELETE", url+"file.txt", "")
+		assert.Equal(t, http.StatusLocked, status)
+	}
+
+	// But allow them with it
+	status, _, _ = doRequest(t, "PUT", url2+"file.txt", "two", "If", "("+token+")")
+	assert.Equal(t, http.StatusCreated, status)
+
+	// A client lock which looks like the handler's temporary locks
+	// is saved too
+	noOwner := strings.Replace(lockBody, "<D:owner>tester</D:owner>", "", 1)
+	status, header, _ = doRequest(t, "LOCK", url1+"other.txt", noOwner, "Timeout", "Infinite", "Depth", "0")
+	require.Equal(t, http.StatusCreated, status)
+	otherToken := header.Get("Lock-Token")
+	status, _, _ = doRequest(t, "PUT", url2+"other.txt", "two")
+	assert.Equal(t, http.StatusLocked, status)
+	status, _, _ = doRequest(t, "UNLOCK", url2+"other.txt", "", "Lock-Token", otherToken)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// Unlock on the other server
+	status, _, _ = doRequest(t, "UNLOCK", url2+"file.txt", "", "Lock-Token", token)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _, _ = doRequest(t, "PUT", url1+"file.txt", "three")
+	assert.Equal(t, http.StatusCreated, status)
+}
+
+func TestLockUsers(t *testing.T) {
+	dir := t.TempDir()
+	userFile := filepath.Join(dir, "users.json")
+	users := fmt.Sprintf(`{"users": {
+		"alice": {"pass": %q, "remote": %q},
+		"bob": {"pass": %q, "remote": %q}
+	}}`, obscure.MustObscure("alicepass"), t.TempDir(), obscure.MustObscure("bobpass"), t.TempDir())
+	require.NoError(t, os.WriteFile(userFile, []byte(users), 0600))
+
+	opt := Opt
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	proxyOpt := proxy.Opt
+	proxyOpt.UserFile = userFile
+	w, err := newWebDAV(context.Background(), nil, &opt, &vfscommon.Opt, &proxyOpt)
+	require.NoError(t, err)
+	go func() {
+		require.NoError(t, w.Serve())
+	}()
+	t.Cleanup(func() {
+		assert.NoError(t, w.Shutdown())
+	})
+	u, err := url.Parse(w.server.URLs()[0])
+	require.NoError(t, err)
+	userURL := func(user, pass string) string {
+		u := *u
+		u.User = url.UserPassword(user, pass)
+		return u.String()
+	}
+	alice, bob := userURL("alice", "alicepass"), userURL("bob", "bobpass")
+
+	// Alice's lock doesn't stop Bob writing the same path on his remote
+	status, header, _ := doRequest(t, "LOCK", alice+"file.txt", lockBody, "Timeout", "Second-600")
+	require.Equal(t, http.StatusCreated, status)
+	require.NotEqual(t, "", header.Get("Lock-Token"))
+	status, _, _ = doRequest(t, "PUT", alice+"file.txt", "alice")
+	assert.Equal(t, http.StatusLocked, status)
+	status, _, _ = doRequest(t, "PUT", bob+"file.txt", "bob")
+	assert.Equal(t, http.StatusCreated, status)
+}
+
+func TestDeadProps(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	if !f.Features().UserMetadata {
+		t.Skip("backend doesn't support user metadata")
+	}
+	url1 := startLockServer(t, f)
+	url2 := startLockServer(t, f)
+
+	status, _, _ := doRequest(t, "PUT", url1+"file.txt", "hello")
+	require.Equal(t, http.StatusCreated, status)
+	status, _, _ = doRequest(t, "MKCOL", url1+"dir", "")
+	require.Equal(t, http.StatusCreated, status)
+
+	const setBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:rclone-test">
+  <D:set><D:prop><Z:Author>Jo &amp; Sam</Z:Author><Z:colour>blue</Z:colour></D:prop></D:set>
+</D:propertyupdate>`
+	status, _, body := doRequest(t, "PROPPATCH", url1+"file.txt", setBody)
+	require.Equal(t, http.StatusMultiStatus, status)
+	if strings.Contains(body, "403") {
+		t.Skip("file system doesn't support extended attributes")
+	}
+	assert.Contains(t, body, "200 OK")
+
+	const findBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:Z="urn:rclone-test">
+  <D:prop><Z:Author/><Z:colour/></D:prop>
+</D:propfind>`
+	status, _, body = doRequest(t, "PROPFIND", url2+"file.txt", findBody, "Depth", "0")
+	require.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, "Jo &amp; Sam</Author>")
+	assert.Contains(t, body, "blue</colour>")
+
+	// Remove one of them
+	const removeBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:rclone-test">
+  <D:remove><D:prop><Z:colour/></D:prop></D:remove>
+</D:propertyupdate>`
+	status, _, _ = doRequest(t, "PROPPATCH", url2+"file.txt", removeBody)
+	require.Equal(t, http.StatusMultiStatus, status)
+	status, _, body = doRequest(t, "PROPFIND", url1+"file.txt", findBody, "Depth", "0")
+	require.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, "Jo &amp; Sam</Author>")
+	assert.NotContains(t, body, "blue")
+
+	// The contents are unchanged
+	status, _, body = doRequest(t, "GET", url1+"file.txt", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "hello", body)
+
+	// Directories can't store them
+	status, _, body = doRequest(t, "PROPPATCH", url1+"dir", setBody)
+	require.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, "403 Forbidden")
+	assert.NotContains(t, body, "200 OK")
+}
@@ -0,0 +1,87 @@
+// Dead properties stored in the object metadata
+
+package webdav
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/rclone/rclone/vfs"
+	"golang.org/x/net/webdav"
+)
+
+// deadPropsXattr is the extended attribute the dead properties of a
+// file are stored in. The VFS maps it to the "webdav-props" key in the
+// user metadata of the object.
+const deadPropsXattr = "user.webdav-props"
+
+// deadProp is a dead property as stored in the metadata
+type deadProp struct {
+	Space    string `json:"space,omitempty"`
+	Local    string `json:"local"`
+	Lang     string `json:"lang,omitempty"`
+	InnerXML string `json:"xml,omitempty"`
+}
+
+// readDeadProps returns the dead properties stored on the file
+//
+// It returns an empty map if there aren't any.
+func readDeadProps(file *vfs.File) (map[xml.Name]webdav.Property, error) {
+	props := make(map[xml.Name]webdav.Property)
+	value, err := file.GetXattr(deadPropsXattr)
+	if errors.Is(err, vfs.ENOATTR) || (err == nil && len(value) == 0) {
+		return props, nil
+	} else if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(string(value))
+	if err != nil {
+		return nil, err
+	}
+	var stored []deadProp
+	if err = json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	for _, p := range stored {
+		name := xml.Name{Space: p.Space, Local: p.Local}
+		props[name] = webdav.Property{
+			XMLName:  name,
+			Lang:     p.Lang,
+			InnerXML: []byte(p.InnerXML),
+		}
+	}
+	return props, nil
+}
+
+// writeDeadProps replaces the dead properties stored on the file
+//
+// The metadata key can't be removed on most backends so it is set to
+// blank if there are no properties left.
+func writeDeadProps(file *vfs.File, props map[xml.Name]webdav.Property) error {
+	var value []byte
+	if len(props) > 0 {
+		stored := make([]deadProp, 0, len(props))
+		for name, p := range props {
+			stored = append(stored, deadProp{
+				Space:    name.Space,
+				Local:    name.Local,
+				Lang:     p.Lang,
+				InnerXML: string(p.InnerXML),
+			})
+		}
+		slices.SortFunc(stored, func(a, b deadProp) int {
+			return cmp.Or(strings.Compare(a.Space, b.Space), strings.Compare(a.Local, b.Local))
+		})
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		value = []byte(base64.StdEncoding.EncodeToString(data))
+	}
+	return file.SetXattr(deadPropsXattr, value, 0)
+}
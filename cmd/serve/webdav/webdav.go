@@ -49,6 +49,10 @@ var OptionsInfo = fs.Options{{
 	Name:    "disable_zip",
 	Default: false,
 	Help:    "Disable zip download of directories",
+}, {
+	Name:    "dead_props",
+	Default: false,
+	Help:    "Store properties set with PROPPATCH in the metadata of files",
 }}.
 	Add(libhttp.ConfigInfo).
 	Add(libhttp.AuthConfigInfo).
@@ -62,6 +66,7 @@ type Options struct {
 	EtagHash       string `config:"etag_hash"`
 	DisableDirList bool   `config:"disable_dir_list"`
 	DisableZip     bool   `config:"disable_zip"`
+	DeadProps      bool   `config:"dead_props"`
 }
 
 // Opt is options set by command line flags
@@ -122,6 +127,40 @@ supported hash on the backend or you can use a named hash such as
 "MD5" or "SHA-1". Use the [hashsum](/commands/rclone_hashsum/) command
 to see the full list.
 
+#### --dead-props
+
+If this flag is set then properties which clients set with PROPPATCH
+are stored in the metadata of the file, so they are returned by
+PROPFIND later, even after a restart. This needs a backend which
+supports user metadata (see the [overview](/overview/#metadata)) and
+adds a metadata read to each file in a PROPFIND so it may be slow on
+some backends. Properties can't be stored on directories.
+
+Without this flag properties set with PROPPATCH are accepted but not
+stored.
+
+### Locking
+
+Locks taken with the LOCK method are kept in a database in the rclone
+cache directory so they survive a restart of the server. They are
+shared by all the ` + "`rclone serve webdav`" + ` instances on the machine
+serving the same remote. Writes through any of those servers which
+don't present the lock token fail with ` + "`423 Locked`" + `.
+
+When using ` + "`--auth-proxy`" + ` or ` + "`--user-file`" + ` the locks are kept
+separately for the remote each user is given, so users can only see
+and conflict with the locks taken on their own remote.
+
+While a request is using a lock the lock is reserved for it, but only
+within the server handling the request. Requests using the same lock
+token sent to different servers at once are not kept apart.
+
+Locks are checked by the WebDAV handler, so they are honoured by every
+write made with a WebDAV request to ` + "`rclone serve webdav`" + `. They
+aren't checked by the VFS itself, so writes to the same remote through
+` + "`rclone mount`" + `, the other ` + "`rclone serve`" + ` protocols or directly
+on the remote ignore them.
+
 ### Gzip compression
 
 The server will compress certain response bodies (text and XML, including
@@ -202,7 +241,7 @@ the local backend only.
 	},
 	RunE: func(command *cobra.Command, args []string) error {
 		var f fs.Fs
-		if proxy.Opt.AuthProxy == "" {
+		if !proxy.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
@@ -241,6 +280,7 @@ type WebDAV struct {
 	proxy         *proxy.Proxy
 	ctx           context.Context // for global config
 	etagHashType  hash.Type
+	locks         *lockSystems // the locks for each VFS
 }
 
 func webDAVCompressMiddleware() func(http.Handler) http.Handler {
@@ -279,12 +319,18 @@ func newWebDAV(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	if w.etagHashType != hash.None {
 		fs.Debugf(f, "Using hash %v for ETag", w.etagHashType)
 	}
-	if proxyOpt.AuthProxy != "" {
-		w.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
+	if proxyOpt.Enabled() {
+		w.proxy, err = proxy.New(ctx, proxyOpt, vfsOpt)
+		if err != nil {
+			return nil, err
+		}
 		// override auth
 		w.opt.Auth.CustomAuthFn = w.auth
 	} else {
-		w._vfs = vfs.New(ctx, f, vfsOpt)
+		w._vfs, err = vfs.NewWithError(ctx, f, vfsOpt)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	w.server, err = libhttp.NewServer(ctx,
@@ -299,10 +345,12 @@ func newWebDAV(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	// Make sure BaseURL starts with a / and doesn't end with one
 	w.opt.HTTP.BaseURL = "/" + strings.Trim(w.opt.HTTP.BaseURL, "/")
 
+	w.locks = newLockSystems(ctx)
+
+	// The LockSystem is set for each request from its VFS
 	webdavHandler := &webdav.Handler{
 		Prefix:     w.opt.HTTP.BaseURL,
 		FileSystem: w,
-		LockSystem: webdav.NewMemLS(),
 		Logger:     w.logRequest, // FIXME
 	}
 	w.webdavhandler = webdavHandler
@@ -413,11 +461,20 @@ func (w *WebDAV) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		w.serveDir(rw, r, remote)
 		return
 	}
+	VFS, err := w.getVFS(r.Context())
+	if err != nil {
+		http.Error(rw, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to serve WebDAV: %v", err)
+		return
+	}
+	// Use the locks of this VFS
+	handler := *w.webdavhandler
+	handler.LockSystem = forRequest(w.locks.get(VFS.Fs()), r)
 	// Add URL Prefix back to path since webdavhandler needs to
 	// return absolute references.
 	r.URL.Path = w.opt.HTTP.BaseURL + r.URL.Path
 	wrw := &webdavRW{ResponseWriter: rw}
-	w.webdavhandler.ServeHTTP(wrw, r)
+	handler.ServeHTTP(wrw, r)
 
 	if wrw.isSuccessfull() {
 		w.postprocess(r, remote)
@@ -508,7 +565,9 @@ func (w *WebDAV) Addr() net.Addr {
 
 // Shutdown the server
 func (w *WebDAV) Shutdown() error {
-	return w.server.Shutdown()
+	err := w.server.Shutdown()
+	w.locks.stop()
+	return err
 }
 
 // logRequest is called by the webdav module on every request
@@ -538,6 +597,13 @@ func (w *WebDAV) OpenFile(ctx context.Context, name string, flags int, perm os.F
 	if err != nil {
 		return nil, err
 	}
+	// PROPPATCH opens the resource read-write but directories can
+	// only be opened read only
+	if flags == os.O_RDWR {
+		if node, err := VFS.Stat(name); err == nil && node.IsDir() {
+			flags = os.O_RDONLY
+		}
+	}
 	f, err := VFS.OpenFile(name, flags, perm)
 	if err != nil {
 		return nil, err
@@ -649,29 +715,102 @@ func (h Handle) DeadProps() (map[xml.Name]webdav.Property, error) {
 	property.InnerXML = strconv.AppendInt(nil, h.Handle.Node().ModTime().Unix(), 10)
 	properties[xmlName] = property
 
+	// Report the quota of directories as in RFC 4331
+	if dir, ok := h.Handle.Node().(*vfs.Dir); ok && dir.VFS().Opt.Quota >= 0 {
+		_, used, free := dir.VFS().Statfs()
+		for local, value := range map[string]int64{"quota-available-bytes": free, "quota-used-bytes": used} {
+			xmlName = xml.Name{Space: "DAV:", Local: local}
+			properties[xmlName] = webdav.Property{
+				XMLName:  xmlName,
+				InnerXML: strconv.AppendInt(nil, value, 10),
+			}
+		}
+	}
+
+	if file, ok := h.Handle.Node().(*vfs.File); ok && h.w.opt.DeadProps {
+		deadProps, err := readDeadProps(file)
+		if err == nil {
+			for name, property := range deadProps {
+				if _, found := properties[name]; !found {
+					properties[name] = property
+				}
+			}
+		} else if !errors.Is(err, vfs.ENOTSUP) {
+			fs.Errorf(file, "failed to read dead properties: %v", err)
+		}
+	}
+
 	return properties, nil
 }
 
 // Patch changes modtime of the underlying resources, it returns ok for all properties, the error is from setModtime if any
-// FIXME does not check for invalid property and SetModTime error
+//
+// With --dead-props the other properties are stored in the metadata
+// of files. If they can't be stored then none of the patches are
+// applied.
 func (h Handle) Patch(proppatches []webdav.Proppatch) ([]webdav.Propstat, error) {
 	var (
-		stat webdav.Propstat
-		err  error
+		stat      webdav.Propstat
+		err       error
+		deadProps map[xml.Name]webdav.Property // nil if not stored
+		changed   bool
 	)
+	isLastModified := func(name xml.Name) bool {
+		return name.Space == "DAV:" && name.Local == "lastmodified"
+	}
+	file, isFile := h.Handle.Node().(*vfs.File)
+	if h.w.opt.DeadProps {
+		if isFile {
+			deadProps, err = readDeadProps(file)
+			if errors.Is(err, vfs.ENOTSUP) {
+				deadProps, err = nil, nil
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if deadProps == nil {
+			forbidden := webdav.Propstat{Status: http.StatusForbidden}
+			failed := webdav.Propstat{Status: http.StatusFailedDependency}
+			for _, patch := range proppatches {
+				for _, prop := range patch.Props {
+					if isLastModified(prop.XMLName) {
+						failed.Props = append(failed.Props, webdav.Property{XMLName: prop.XMLName})
+					} else {
+						forbidden.Props = append(forbidden.Props, webdav.Property{XMLName: prop.XMLName})
+					}
+				}
+			}
+			if len(forbidden.Props) > 0 {
+				return []webdav.Propstat{forbidden, failed}, nil
+			}
+		}
+	}
 	stat.Status = http.StatusOK
 	for _, patch := range proppatches {
 		for _, prop := range patch.Props {
 			stat.Props = append(stat.Props, webdav.Property{XMLName: prop.XMLName})
-			if prop.XMLName.Space == "DAV:" && prop.XMLName.Local == "lastmodified" {
+			switch {
+			case isLastModified(prop.XMLName):
 				var modtimeUnix int64
 				modtimeUnix, err = strconv.ParseInt(string(prop.InnerXML), 10, 64)
 				if err == nil {
 					err = h.Handle.Node().SetModTime(time.Unix(modtimeUnix, 0))
 				}
+			case deadProps != nil:
+				if patch.Remove {
+					delete(deadProps, prop.XMLName)
+				} else {
+					deadProps[prop.XMLName] = prop
+				}
+				changed = true
 			}
 		}
 	}
+	if changed {
+		if writeErr := writeDeadProps(file, deadProps); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
 	return []webdav.Propstat{stat}, err
 }
 
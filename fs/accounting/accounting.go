@@ -41,6 +41,11 @@ func Start(ctx context.Context) {
 	// Start the transactions per second limiter
 	StartLimitTPS(ctx)
 
+	// Start the quotas
+	if err := StartQuotas(ctx); err != nil {
+		fs.Fatalf(nil, "Failed to start quotas: %v", err)
+	}
+
 	// Set the error count function pointer up in fs
 	//
 	// We can't do this in an init() method as it uses fs.Config
@@ -71,7 +76,8 @@ type Account struct {
 	withBuf  bool          // is using a buffered in
 	checking bool          // set if attached transfer is checking
 
-	tokenBucket buckets // per file bandwidth limiter (may be nil)
+	tokenBucket buckets  // per file bandwidth limiter (may be nil)
+	quotas      []*quota // quotas to charge the bytes read to (may be nil)
 
 	values accountValues
 }
@@ -250,6 +256,13 @@ func (acc *Account) checkReadBefore() (bytesUntilLimit int64, err error) {
 	if err = acc.ctx.Err(); err != nil {
 		return 0, err
 	}
+	for _, q := range acc.quotas {
+		if err = q.err(); err != nil {
+			// Only stop this transfer as others may not be using
+			// this quota
+			return 0, fserrors.NoRetryError(err)
+		}
+	}
 	acc.values.mu.Lock()
 	if acc.values.max >= 0 {
 		bytesUntilLimit = acc.values.max - acc.stats.GetBytes()
@@ -363,6 +376,9 @@ func (acc *Account) accountReadN(n int64) {
 	acc.values.mu.Unlock()
 
 	acc.stats.Bytes(n)
+	for _, q := range acc.quotas {
+		q.charge(n)
+	}
 }
 
 // Account the read and limit bandwidth
@@ -565,6 +581,18 @@ func (acc *Account) AccountReadN(n int64) {
 	acc.accountReadN(n)
 }
 
+// AccountReadNoNetwork account having read n bytes which weren't
+// transferred over the network, such as the holes in a sparse file
+// or the chunks of a resumed upload which were already uploaded
+//
+// These count towards the progress of the transfer but aren't charged
+// to the bandwidth limits or the quotas.
+func (acc *Account) AccountReadNoNetwork(n int64) {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	acc.accountReadNoNetwork(n)
+}
+
 // Close the object
 func (acc *Account) Close() error {
 	acc.mu.Lock()
@@ -8,6 +8,9 @@ import (
 
 var namespace = "rclone_"
 
+// quotaLabels are the labels of the quota metrics
+var quotaLabels = []string{"remote", "type", "period"}
+
 // RcloneCollector is a Prometheus collector for Rclone
 type RcloneCollector struct {
 	ctx              context.Context
@@ -22,6 +25,9 @@ type RcloneCollector struct {
 	listed           *prometheus.Desc
 	fatalError       *prometheus.Desc
 	retryError       *prometheus.Desc
+	quotaLimit       *prometheus.Desc
+	quotaUsed        *prometheus.Desc
+	quotaRemaining   *prometheus.Desc
 }
 
 // NewRcloneCollector make a new RcloneCollector
@@ -72,6 +78,18 @@ func NewRcloneCollector(ctx context.Context) *RcloneCollector {
 			"Whether there has been an error that will be retried",
 			nil, nil,
 		),
+		quotaLimit: prometheus.NewDesc(namespace+"quota_limit",
+			"Limit of each quota set with --quota per period",
+			quotaLabels, nil,
+		),
+		quotaUsed: prometheus.NewDesc(namespace+"quota_used",
+			"Usage of each quota set with --quota in the current period",
+			quotaLabels, nil,
+		),
+		quotaRemaining: prometheus.NewDesc(namespace+"quota_remaining",
+			"Usage left of each quota set with --quota in the current period",
+			quotaLabels, nil,
+		),
 	}
 }
 
@@ -88,6 +106,9 @@ func (c *RcloneCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.listed
 	ch <- c.fatalError
 	ch <- c.retryError
+	ch <- c.quotaLimit
+	ch <- c.quotaUsed
+	ch <- c.quotaRemaining
 }
 
 // Collect is part of the Collector interface: https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
@@ -108,6 +129,13 @@ func (c *RcloneCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(c.retryError, prometheus.GaugeValue, bool2Float(s.retryError))
 
 	s.mu.RUnlock()
+
+	for _, q := range Quotas() {
+		labels := []string{q.Remote, q.Type, q.Period}
+		ch <- prometheus.MustNewConstMetric(c.quotaLimit, prometheus.GaugeValue, float64(q.Limit), labels...)
+		ch <- prometheus.MustNewConstMetric(c.quotaUsed, prometheus.GaugeValue, float64(q.Used), labels...)
+		ch <- prometheus.MustNewConstMetric(c.quotaRemaining, prometheus.GaugeValue, float64(q.Remaining), labels...)
+	}
 }
 
 // bool2Float is a small function to convert a boolean into a float64 value that can be used for Prometheus
@@ -0,0 +1,436 @@
+package accounting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// ErrorQuotaExceeded is returned when a quota set with --quota is used up.
+// Used for checking on exit and matching to correct exit code.
+var ErrorQuotaExceeded = errors.New("quota exceeded as set by --quota")
+
+// The things a quota can limit
+const (
+	quotaEgress       = "egress"       // bytes downloaded from the remote
+	quotaIngress      = "ingress"      // bytes uploaded to the remote
+	quotaTransactions = "transactions" // files transferred to or from the remote
+)
+
+// The periods a quota can apply to
+const (
+	quotaDay   = "day"
+	quotaMonth = "month"
+	quotaTotal = "total"
+)
+
+// quotaFacility is the name of the kv database the usage is kept in
+const quotaFacility = "quota"
+
+// quotaSaveInterval is how often the usage is written to the database
+const quotaSaveInterval = 10 * time.Second
+
+// quota is the limit on one type of usage of a remote and the usage
+// so far in the current period
+type quota struct {
+	remote string // name of the remote
+	what   string // one of the quota* types
+	period string // one of the quota* periods
+	limit  int64  // max usage per period
+
+	mu         sync.Mutex
+	key        string           // database key for the current period
+	ends       time.Time        // when the current period ends or zero if never
+	used       int64            // usage in the current period including unsaved
+	unsaved    int64            // usage not yet written to the database
+	unsavedOld map[string]int64 // unsaved usage of previous periods by key
+}
+
+// parseQuota parses a quota in the form remote:what=limit[/period]
+func parseQuota(s string) (*quota, error) {
+	remote, rest, ok := strings.Cut(s, ":")
+	if !ok || remote == "" {
+		return nil, fmt.Errorf("quota %q: expecting remote:type=limit[/period]", s)
+	}
+	what, limit, ok := strings.Cut(rest, "=")
+	if !ok {
+		return nil, fmt.Errorf("quota %q: expecting remote:type=limit[/period]", s)
+	}
+	q := &quota{
+		remote: remote,
+		what:   what,
+		period: quotaTotal,
+	}
+	if i := strings.IndexRune(limit, '/'); i >= 0 {
+		limit, q.period = limit[:i], limit[i+1:]
+	}
+	switch q.period {
+	case quotaDay, quotaMonth, quotaTotal:
+	default:
+		return nil, fmt.Errorf("quota %q: unknown period %q - expecting %s, %s or %s", s, q.period, quotaDay, quotaMonth, quotaTotal)
+	}
+	switch q.what {
+	case quotaEgress, quotaIngress:
+		var size fs.SizeSuffix
+		if err := size.Set(limit); err != nil {
+			return nil, fmt.Errorf("quota %q: bad size: %w", s, err)
+		}
+		q.limit = int64(size)
+	case quotaTransactions:
+		// Plain numbers are counts rather than thousands here
+		if n, err := strconv.ParseInt(limit, 10, 64); err == nil {
+			q.limit = n
+			break
+		}
+		var count fs.CountSuffix
+		if err := count.Set(limit); err != nil {
+			return nil, fmt.Errorf("quota %q: bad count: %w", s, err)
+		}
+		q.limit = int64(count)
+	default:
+		return nil, fmt.Errorf("quota %q: unknown type %q - expecting %s, %s or %s", s, q.what, quotaEgress, quotaIngress, quotaTransactions)
+	}
+	if q.limit < 0 {
+		return nil, fmt.Errorf("quota %q: limit must be positive", s)
+	}
+	return q, nil
+}
+
+// String returns a description of the quota
+func (q *quota) String() string {
+	var limit string
+	if q.what == quotaTransactions {
+		limit = fs.CountSuffix(q.limit).String()
+	} else {
+		limit = fs.SizeSuffix(q.limit).ByteUnit()
+	}
+	if q.period == quotaTotal {
+		return fmt.Sprintf("%s quota of %s for %q", q.what, limit, q.remote)
+	}
+	return fmt.Sprintf("%s quota of %s per %s for %q", q.what, limit, q.period, q.remote)
+}
+
+// periodKey returns the database key for the period containing t
+func (q *quota) periodKey(t time.Time) string {
+	t = t.UTC()
+	var period string
+	switch q.period {
+	case quotaDay:
+		period = t.Format("2006-01-02")
+	case quotaMonth:
+		period = t.Format("2006-01")
+	default:
+		period = quotaTotal
+	}
+	return q.remote + "/" + q.what + "/" + period
+}
+
+// resetsAt returns the time the period containing t ends or the zero
+// time if it never does
+func (q *quota) resetsAt(t time.Time) time.Time {
+	t = t.UTC()
+	switch q.period {
+	case quotaDay:
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+	case quotaMonth:
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// _rollover starts a new period if the one containing now is
+// different from the current one. Unsaved usage of the old period is
+// kept to be saved under its own key.
+//
+// Call with mu held
+func (q *quota) _rollover(now time.Time) {
+	key := q.periodKey(now)
+	if key == q.key {
+		return
+	}
+	if q.key != "" {
+		if q.unsaved != 0 {
+			if q.unsavedOld == nil {
+				q.unsavedOld = make(map[string]int64)
+			}
+			q.unsavedOld[q.key] += q.unsaved
+		}
+		q.used = 0
+	}
+	q.key = key
+	q.ends = q.resetsAt(now)
+	q.unsaved = 0
+}
+
+// charge adds n to the usage
+func (q *quota) charge(n int64) {
+	q.mu.Lock()
+	if now := time.Now(); q.key == "" || (!q.ends.IsZero() && !now.Before(q.ends)) {
+		q._rollover(now)
+	}
+	q.used += n
+	q.unsaved += n
+	q.mu.Unlock()
+}
+
+// remaining returns how much of the quota is left
+func (q *quota) remaining() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return max(q.limit-q.used, 0)
+}
+
+// err returns an error if the quota is used up
+func (q *quota) err() error {
+	if q.remaining() > 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrorQuotaExceeded, q)
+}
+
+// QuotaSnapshot is the state of a quota at a point in time
+type QuotaSnapshot struct {
+	Remote    string     `json:"remote"`
+	Type      string     `json:"type"`
+	Period    string     `json:"period"`
+	Limit     int64      `json:"limit"`
+	Used      int64      `json:"used"`
+	Remaining int64      `json:"remaining"`
+	ResetsAt  *time.Time `json:"resetsAt,omitempty"`
+}
+
+// snapshot returns the state of the quota
+func (q *quota) snapshot() QuotaSnapshot {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := QuotaSnapshot{
+		Remote:    q.remote,
+		Type:      q.what,
+		Period:    q.period,
+		Limit:     q.limit,
+		Used:      q.used,
+		Remaining: max(q.limit-q.used, 0),
+	}
+	if resetsAt := q.resetsAt(time.Now()); !resetsAt.IsZero() {
+		s.ResetsAt = &resetsAt
+	}
+	return s
+}
+
+// quotaSet is all the quotas in use
+type quotaSet struct {
+	mu       sync.Mutex // held while saving
+	db       *kv.DB     // may be nil if the usage isn't saved
+	quotas   []*quota
+	byRemote map[string][]*quota
+}
+
+// quotas is the global set of quotas or nil if there are none
+var quotas *quotaSet
+
+// StartQuotas sets up the quotas from the --quota flag, reading the
+// usage so far from the database.
+func StartQuotas(ctx context.Context) error {
+	ci := fs.GetConfig(ctx)
+	if len(ci.Quota) == 0 {
+		return nil
+	}
+	qs, err := newQuotaSet(ctx, ci.Quota)
+	if err != nil {
+		return err
+	}
+	quotas = qs
+	go func() {
+		ticker := time.NewTicker(quotaSaveInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			qs.save()
+		}
+	}()
+	atexit.Register(qs.save)
+	return nil
+}
+
+// newQuotaSet parses the quotas and loads their usage
+func newQuotaSet(ctx context.Context, specs []string) (*quotaSet, error) {
+	qs := &quotaSet{
+		byRemote: make(map[string][]*quota),
+	}
+	for _, spec := range specs {
+		q, err := parseQuota(spec)
+		if err != nil {
+			return nil, err
+		}
+		qs.quotas = append(qs.quotas, q)
+		qs.byRemote[q.remote] = append(qs.byRemote[q.remote], q)
+		fs.Infof(nil, "Enforcing %v", q)
+	}
+	db, err := kv.Start(ctx, quotaFacility, nil)
+	if err != nil {
+		fs.Errorf(nil, "Quota usage won't be saved between runs: %v", err)
+	} else {
+		qs.db = db
+	}
+	qs.save()
+	return qs, nil
+}
+
+// opSaveQuotas adds the unsaved usage of each quota to the database
+// and reads back the total usage including that of other processes
+type opSaveQuotas struct {
+	quotas []*quota
+}
+
+func (op *opSaveQuotas) Do(ctx context.Context, b kv.Bucket) error {
+	now := time.Now()
+	for _, q := range op.quotas {
+		q.mu.Lock()
+		err := op.save(b, q, now)
+		q.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add adds n to the usage stored under key returning the new total
+func (op *opSaveQuotas) add(b kv.Bucket, key string, n int64) (stored int64, err error) {
+	stored, _ = strconv.ParseInt(string(b.Get([]byte(key))), 10, 64)
+	if n == 0 {
+		return stored, nil
+	}
+	stored += n
+	return stored, b.Put([]byte(key), []byte(strconv.FormatInt(stored, 10)))
+}
+
+// save the unsaved usage of q, rolling over to the period containing now
+//
+// Call with q.mu held
+func (op *opSaveQuotas) save(b kv.Bucket, q *quota, now time.Time) error {
+	q._rollover(now)
+	for key, n := range q.unsavedOld {
+		if _, err := op.add(b, key, n); err != nil {
+			return err
+		}
+		delete(q.unsavedOld, key)
+	}
+	stored, err := op.add(b, q.key, q.unsaved)
+	if err != nil {
+		return err
+	}
+	q.unsaved = 0
+	q.used = stored
+	return nil
+}
+
+// save writes the unsaved usage to the database
+func (qs *quotaSet) save() {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	if qs.db == nil {
+		// Just roll over the periods
+		now := time.Now()
+		for _, q := range qs.quotas {
+			q.mu.Lock()
+			q._rollover(now)
+			q.unsaved = 0
+			q.unsavedOld = nil
+			q.mu.Unlock()
+		}
+		return
+	}
+	err := qs.db.Do(true, &opSaveQuotas{quotas: qs.quotas})
+	if err != nil {
+		fs.Errorf(nil, "Failed to save quota usage: %v", err)
+	}
+}
+
+// quotaRemoteName returns the name of the remote f is configured
+// as without any config overrides
+func quotaRemoteName(f fs.Info) string {
+	name := f.Name()
+	if i := strings.IndexRune(name, '{'); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// forFs returns the quotas of type what which apply to f, including
+// those of any remotes it wraps
+func (qs *quotaSet) forFs(f fs.Info, what string) (out []*quota) {
+	if qs == nil {
+		return nil
+	}
+	for f != nil {
+		for _, q := range qs.byRemote[quotaRemoteName(f)] {
+			if q.what == what {
+				out = append(out, q)
+			}
+		}
+		ff, ok := f.(fs.Fs)
+		if !ok {
+			break
+		}
+		unWrap := ff.Features().UnWrap
+		if unWrap == nil {
+			break
+		}
+		f = unWrap()
+	}
+	return out
+}
+
+// transferQuotas returns the quotas which apply to a transfer from
+// srcFs to dstFs, either of which may be nil.
+func transferQuotas(srcFs, dstFs fs.Info) (bytes, transactions []*quota) {
+	qs := quotas
+	if qs == nil {
+		return nil, nil
+	}
+	if srcFs != nil {
+		bytes = append(bytes, qs.forFs(srcFs, quotaEgress)...)
+		transactions = append(transactions, qs.forFs(srcFs, quotaTransactions)...)
+	}
+	if dstFs != nil {
+		bytes = append(bytes, qs.forFs(dstFs, quotaIngress)...)
+		transactions = append(transactions, qs.forFs(dstFs, quotaTransactions)...)
+	}
+	return bytes, transactions
+}
+
+// CheckQuota returns an error if any of the quotas which apply to a
+// transfer from srcFs to dstFs are used up. Either may be nil.
+//
+// The error is a NoRetry error so the transfer stops gracefully.
+func CheckQuota(srcFs, dstFs fs.Info) error {
+	bytes, transactions := transferQuotas(srcFs, dstFs)
+	for _, q := range append(bytes, transactions...) {
+		if err := q.err(); err != nil {
+			return fserrors.NoRetryError(err)
+		}
+	}
+	return nil
+}
+
+// Quotas returns the state of all the quotas
+func Quotas() []QuotaSnapshot {
+	qs := quotas
+	if qs == nil {
+		return nil
+	}
+	out := make([]QuotaSnapshot, len(qs.quotas))
+	for i, q := range qs.quotas {
+		out[i] = q.snapshot()
+	}
+	return out
+}
@@ -0,0 +1,229 @@
+package accounting
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuota(t *testing.T) {
+	for _, test := range []struct {
+		in     string
+		remote string
+		what   string
+		period string
+		limit  int64
+		err    bool
+	}{
+		{in: "s3:egress=500Gi/month", remote: "s3", what: "egress", period: "month", limit: 500 << 30},
+		{in: "drive:ingress=1M/day", remote: "drive", what: "ingress", period: "day", limit: 1 << 20},
+		{in: "drive:ingress=100", remote: "drive", what: "ingress", period: "total", limit: 100 << 10},
+		{in: "b2:transactions=10k", remote: "b2", what: "transactions", period: "total", limit: 10000},
+		{in: "b2:transactions=5/total", remote: "b2", what: "transactions", period: "total", limit: 5},
+		{in: "egress=1G", err: true},
+		{in: ":egress=1G", err: true},
+		{in: "s3:egress", err: true},
+		{in: "s3:bandwidth=1G", err: true},
+		{in: "s3:egress=1G/week", err: true},
+		{in: "s3:egress=lots", err: true},
+		{in: "s3:egress=-1", err: true},
+		{in: "s3:egress=off", err: true},
+	} {
+		q, err := parseQuota(test.in)
+		if test.err {
+			assert.Error(t, err, test.in)
+			continue
+		}
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.remote, q.remote, test.in)
+		assert.Equal(t, test.what, q.what, test.in)
+		assert.Equal(t, test.period, q.period, test.in)
+		assert.Equal(t, test.limit, q.limit, test.in)
+	}
+}
+
+func TestQuotaPeriod(t *testing.T) {
+	now := time.Date(2026, 12, 31, 23, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		period   string
+		key      string
+		resetsAt time.Time
+	}{
+		{quotaDay, "s3/egress/2026-12-31", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{quotaMonth, "s3/egress/2026-12", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{quotaTotal, "s3/egress/total", time.Time{}},
+	} {
+		q := &quota{remote: "s3", what: quotaEgress, period: test.period}
+		assert.Equal(t, test.key, q.periodKey(now), test.period)
+		assert.Equal(t, test.resetsAt, q.resetsAt(now), test.period)
+	}
+}
+
+// opAddUsage adds usage to a key as another process would
+type opAddUsage struct {
+	key string
+	n   int64
+}
+
+func (op *opAddUsage) Do(ctx context.Context, b kv.Bucket) error {
+	stored, _ := strconv.ParseInt(string(b.Get([]byte(op.key))), 10, 64)
+	return b.Put([]byte(op.key), []byte(strconv.FormatInt(stored+op.n, 10)))
+}
+
+// setQuotas sets the global quotas for the duration of the test
+func setQuotas(t *testing.T, specs ...string) *quotaSet {
+	qs, err := newQuotaSet(context.Background(), specs)
+	require.NoError(t, err)
+	quotas = qs
+	t.Cleanup(func() {
+		quotas = nil
+		if qs.db != nil {
+			_ = qs.db.Stop(true)
+		}
+	})
+	return qs
+}
+
+func TestQuotaTransfer(t *testing.T) {
+	ctx := context.Background()
+	qs := setQuotas(t, "src:egress=100B", "dst:ingress=1Ki/month", "dst:transactions=2/day")
+	srcFs, err := mockfs.NewFs(ctx, "src", "path", nil)
+	require.NoError(t, err)
+	dstFs, err := mockfs.NewFs(ctx, "dst", "path", nil)
+	require.NoError(t, err)
+	otherFs, err := mockfs.NewFs(ctx, "other", "path", nil)
+	require.NoError(t, err)
+	s := NewStats(ctx)
+
+	transfer := func(f fs.Fs, size int) error {
+		tr := newTransfer(s, mockobject.Object("obj"), f, dstFs)
+		acc := tr.Account(ctx, io.NopCloser(bytes.NewReader(make([]byte, size))))
+		_, err := io.Copy(io.Discard, acc)
+		tr.Done(ctx, err)
+		return err
+	}
+
+	// The first transfer uses up the egress quota, overshooting by a read
+	require.NoError(t, CheckQuota(srcFs, dstFs))
+	require.NoError(t, transfer(srcFs, 150))
+	err = CheckQuota(srcFs, dstFs)
+	assert.True(t, errors.Is(err, ErrorQuotaExceeded))
+	assert.True(t, fserrors.IsNoRetryError(err))
+	// Running out part way through a transfer only fails that transfer
+	err = transfer(srcFs, 10)
+	assert.True(t, errors.Is(err, ErrorQuotaExceeded))
+	assert.True(t, fserrors.IsNoRetryError(err))
+	assert.False(t, fserrors.IsFatalError(err))
+
+	// Other remotes aren't affected by the egress quota, but the
+	// destination has run out of transactions
+	require.NoError(t, CheckQuota(otherFs, nil))
+	err = CheckQuota(otherFs, dstFs)
+	assert.True(t, errors.Is(err, ErrorQuotaExceeded))
+
+	snapshots := Quotas()
+	require.Len(t, snapshots, 3)
+	assert.Equal(t, int64(150), snapshots[0].Used)
+	assert.Equal(t, int64(0), snapshots[0].Remaining)
+	assert.Nil(t, snapshots[0].ResetsAt)
+	assert.Equal(t, int64(150), snapshots[1].Used)
+	assert.Equal(t, int64(1024-150), snapshots[1].Remaining)
+	assert.NotNil(t, snapshots[1].ResetsAt)
+	assert.Equal(t, int64(2), snapshots[2].Used)
+
+	out, err := s.RemoteStats(true)
+	require.NoError(t, err)
+	assert.Equal(t, snapshots, out["quotas"])
+
+	// Saving adds the usage of other processes
+	if qs.db == nil {
+		t.Skip("kv not supported")
+	}
+	key := qs.quotas[1].periodKey(time.Now())
+	require.NoError(t, qs.db.Do(true, &opAddUsage{key: key, n: 1000}))
+	qs.save()
+	assert.Equal(t, int64(1150), qs.quotas[1].snapshot().Used)
+	assert.True(t, errors.Is(CheckQuota(nil, dstFs), ErrorQuotaExceeded))
+	qs.save()
+	assert.Equal(t, int64(1150), qs.quotas[1].snapshot().Used)
+}
+
+func TestQuotaSparse(t *testing.T) {
+	ctx := context.Background()
+	qs := setQuotas(t, "src:egress=1Ki", "dst:ingress=1Ki", "dst:transactions=10")
+	srcFs, err := mockfs.NewFs(ctx, "src", "path", nil)
+	require.NoError(t, err)
+	dstFs, err := mockfs.NewFs(ctx, "dst", "path", nil)
+	require.NoError(t, err)
+	s := NewStats(ctx)
+
+	// Bytes which aren't sent, like holes in sparse files, count
+	// towards the transfer but aren't charged to the byte quotas
+	tr := newTransfer(s, mockobject.Object("sparse"), srcFs, dstFs)
+	acc := tr.Account(ctx, nil)
+	acc.AccountReadNoNetwork(1000)
+	assert.Equal(t, int64(1000), s.GetBytes())
+	assert.Equal(t, int64(0), qs.quotas[0].snapshot().Used)
+	assert.Equal(t, int64(0), qs.quotas[1].snapshot().Used)
+	tr.Done(ctx, nil)
+
+	// The transfer is still charged as a transaction
+	assert.Equal(t, int64(1), qs.quotas[2].snapshot().Used)
+	require.NoError(t, CheckQuota(srcFs, dstFs))
+}
+
+func TestQuotaRollover(t *testing.T) {
+	qs := setQuotas(t, "dst:ingress=1Ki/day")
+	if qs.db == nil {
+		t.Skip("kv not supported")
+	}
+	q := qs.quotas[0]
+	now := time.Now()
+	yesterday := q.periodKey(now.Add(-24 * time.Hour))
+	today := q.periodKey(now)
+
+	// Pretend usage from yesterday hasn't been saved yet
+	q.mu.Lock()
+	q.key = yesterday
+	q.ends = q.resetsAt(now.Add(-24 * time.Hour))
+	q.used = 100
+	q.unsaved = 100
+	q.mu.Unlock()
+
+	// Usage after the end of the period starts a new one
+	q.charge(10)
+	assert.Equal(t, int64(10), q.snapshot().Used)
+
+	// Each period's usage is saved under its own key
+	qs.save()
+	assert.Equal(t, int64(10), q.snapshot().Used)
+	stored := func(key string) (n int64) {
+		require.NoError(t, qs.db.Do(false, &opGetUsage{key: key, n: &n}))
+		return n
+	}
+	assert.Equal(t, int64(100), stored(yesterday))
+	assert.Equal(t, int64(10), stored(today))
+}
+
+// opGetUsage reads the usage stored under a key
+type opGetUsage struct {
+	key string
+	n   *int64
+}
+
+func (op *opGetUsage) Do(ctx context.Context, b kv.Bucket) error {
+	*op.n, _ = strconv.ParseInt(string(b.Get([]byte(op.key))), 10, 64)
+	return nil
+}
@@ -154,6 +154,9 @@ func (s *StatsInfo) RemoteStats(short bool) (out rc.Params, err error) {
 	if s.errors > 0 {
 		out["lastError"] = s.lastError.Error()
 	}
+	if quotas := Quotas(); quotas != nil {
+		out["quotas"] = quotas
+	}
 
 	return out, nil
 }
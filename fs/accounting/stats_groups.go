@@ -124,10 +124,23 @@ Returns the following values:
 			}
 		],
 	"checking": an array of names of currently active file checks
-		[]
+		[],
+	"quotas": an array of the quotas set with --quota
+		[
+			{
+				"remote": name of the remote,
+				"type": what is limited - egress, ingress or transactions,
+				"period": day, month or total,
+				"limit": the limit per period in bytes or transactions,
+				"used": usage in the current period,
+				"remaining": usage left in the current period,
+				"resetsAt": time the current period ends (if it does)
+			}
+		]
 }
 ` + "```" + `
-Values for "transferring", "checking" and "lastError" are only assigned if data is available.
+Values for "transferring", "checking", "lastError" and "quotas" are only assigned if data is available.
+The "quotas" are the same for all groups.
 The value for "eta" is null if an eta cannot be determined.
 `,
 	})
@@ -53,9 +53,11 @@ type Transfer struct {
 	size      int64
 	startedAt time.Time
 	checking  bool
-	what      string // what kind of transfer this is
-	srcFs     fs.Fs  // source Fs - may be nil
-	dstFs     fs.Fs  // destination Fs - may be nil
+	what      string   // what kind of transfer this is
+	srcFs     fs.Fs    // source Fs - may be nil
+	dstFs     fs.Fs    // destination Fs - may be nil
+	quotas    []*quota // quotas charged with the bytes transferred
+	txQuotas  []*quota // quotas charged with the transfer itself
 
 	// Protects all below
 	//
@@ -89,6 +91,9 @@ func newTransferRemoteSize(stats *StatsInfo, remote string, size int64, checking
 		srcFs:     srcFs,
 		dstFs:     dstFs,
 	}
+	if !checking {
+		tr.quotas, tr.txQuotas = transferQuotas(srcFs, dstFs)
+	}
 	stats.AddTransfer(tr)
 	return tr
 }
@@ -120,6 +125,12 @@ func (tr *Transfer) Done(ctx context.Context, err error) {
 		acc = nil
 	}
 
+	if !ci.DryRun {
+		for _, q := range tr.txQuotas {
+			q.charge(1)
+		}
+	}
+
 	tr.mu.Lock()
 	tr.completedAt = time.Now()
 	tr.mu.Unlock()
@@ -153,6 +164,7 @@ func (tr *Transfer) Account(ctx context.Context, in io.ReadCloser) *Account {
 	tr.mu.Lock()
 	if tr.acc == nil {
 		tr.acc = newAccountSizeName(ctx, tr.stats, in, tr.size, tr.remote)
+		tr.acc.quotas = tr.quotas
 	} else {
 		tr.acc.UpdateReader(ctx, in)
 	}
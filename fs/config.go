@@ -257,6 +257,16 @@ var ConfigOptionsInfo = Options{{
 	Default: []string{},
 	Help:    "Implies --compare-dest but also copies files from paths into destination",
 	Groups:  "Copy",
+}, {
+	Name:    "link_dest",
+	Default: []string{},
+	Help:    "Implies --compare-dest but also hard links or copies files from paths into destination",
+	Groups:  "Copy",
+}, {
+	Name:    "transfer_journal",
+	Default: false,
+	Help:    "Keep a journal of transfers so an interrupted run can be resumed",
+	Groups:  "Copy",
 }, {
 	Name:    "backup_dir",
 	Default: "",
@@ -367,6 +377,11 @@ var ConfigOptionsInfo = Options{{
 	Default: CutoffMode(0),
 	Help:    "Mode to stop transfers when reaching the max transfer limit HARD|SOFT|CAUTIOUS",
 	Groups:  "Copy",
+}, {
+	Name:    "quota",
+	Default: []string{},
+	Help:    "Persistent usage quota for a remote, e.g. remote:egress=500Gi/month",
+	Groups:  "Copy",
 }, {
 	Name:    "max_backlog",
 	Default: 10000,
@@ -550,6 +565,16 @@ var ConfigOptionsInfo = Options{{
 	Default: ".partial",
 	Help:    "Add partial-suffix to temporary file name when --inplace is not used",
 	Groups:  "Copy",
+}, {
+	Name:    "delta",
+	Default: false,
+	Help:    "Only write the changed blocks of existing files on backends which can update them in place",
+	Groups:  "Copy",
+}, {
+	Name:    "delta_block_size",
+	Default: SizeSuffix(128 * 1024),
+	Help:    "Block size to compare files in for --delta",
+	Groups:  "Copy",
 }, {
 	Name:     "max_connections",
 	Help:     "Maximum number of simultaneous backend API connections, 0 for unlimited.",
@@ -613,6 +638,8 @@ type ConfigInfo struct {
 	DataRateUnit               string            `config:"stats_unit"`
 	CompareDest                []string          `config:"compare_dest"`
 	CopyDest                   []string          `config:"copy_dest"`
+	LinkDest                   []string          `config:"link_dest"`
+	TransferJournal            bool              `config:"transfer_journal"`
 	BackupDir                  string            `config:"backup_dir"`
 	Suffix                     string            `config:"suffix"`
 	SuffixKeepExtension        bool              `config:"suffix_keep_extension"`
@@ -636,6 +663,7 @@ type ConfigInfo struct {
 	MaxTransfer                SizeSuffix        `config:"max_transfer"`
 	MaxDuration                Duration          `config:"max_duration"`
 	CutoffMode                 CutoffMode        `config:"cutoff_mode"`
+	Quota                      []string          `config:"quota"`
 	MaxBacklog                 int               `config:"max_backlog"`
 	MaxStatsGroups             int               `config:"max_stats_groups"`
 	StatsOneLine               bool              `config:"stats_one_line"`
@@ -676,6 +704,8 @@ type ConfigInfo struct {
 	DefaultTime                Time              `config:"default_time"` // time that directories with no time should display
 	Inplace                    bool              `config:"inplace"`      // Download directly to destination file instead of atomic download to temp/rename
 	PartialSuffix              string            `config:"partial_suffix"`
+	Delta                      bool              `config:"delta"`
+	DeltaBlockSize             SizeSuffix        `config:"delta_block_size"`
 	MetadataMapper             SpaceSepList      `config:"metadata_mapper"`
 	MaxConnections             int               `config:"max_connections"`
 	NameTransform              []string          `config:"name_transform"`
@@ -710,10 +740,13 @@ func (ci *ConfigInfo) Reload(ctx context.Context) error {
 		ci.StatsLogLevel = LogLevelNotice
 	}
 
-	// Check --compare-dest and --copy-dest
+	// Check --compare-dest, --copy-dest and --link-dest
 	if len(ci.CompareDest) > 0 && len(ci.CopyDest) > 0 {
 		return fmt.Errorf("can't use --compare-dest with --copy-dest")
 	}
+	if len(ci.LinkDest) > 0 && (len(ci.CompareDest) > 0 || len(ci.CopyDest) > 0) {
+		return fmt.Errorf("can't use --link-dest with --compare-dest or --copy-dest")
+	}
 
 	// Check --stats-one-line and dependent flags
 	switch {
@@ -71,6 +71,18 @@ type Features struct {
 	// If it isn't possible then return fs.ErrorCantMove
 	Move func(ctx context.Context, src Object, remote string) (Object, error)
 
+	// HardLink src to this remote so that both names share the same
+	// underlying data.
+	//
+	// This is stored with the remote path given
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if src.Fs().Name() == f.Name()
+	//
+	// If it isn't possible then return fs.ErrorCantHardLink
+	HardLink func(ctx context.Context, src Object, remote string) (Object, error)
+
 	// DirMove moves src, srcRemote to this remote at dstRemote
 	// using server-side move operations.
 	//
@@ -301,6 +313,9 @@ func (ft *Features) Fill(ctx context.Context, f Fs) *Features {
 	if do, ok := f.(Mover); ok {
 		ft.Move = do.Move
 	}
+	if do, ok := f.(HardLinker); ok {
+		ft.HardLink = do.HardLink
+	}
 	if do, ok := f.(DirMover); ok {
 		ft.DirMove = do.DirMove
 	}
@@ -414,6 +429,9 @@ func (ft *Features) Mask(ctx context.Context, f Fs) *Features {
 	if mask.Move == nil {
 		ft.Move = nil
 	}
+	if mask.HardLink == nil {
+		ft.HardLink = nil
+	}
 	if mask.DirMove == nil {
 		ft.DirMove = nil
 	}
@@ -541,6 +559,21 @@ type Mover interface {
 	Move(ctx context.Context, src Object, remote string) (Object, error)
 }
 
+// HardLinker is an optional interface for Fs
+type HardLinker interface {
+	// HardLink src to this remote so that both names share the
+	// same underlying data.
+	//
+	// This is stored with the remote path given
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if src.Fs().Name() == f.Name()
+	//
+	// If it isn't possible then return fs.ErrorCantHardLink
+	HardLink(ctx context.Context, src Object, remote string) (Object, error)
+}
+
 // DirMover is an optional interface for Fs
 type DirMover interface {
 	// DirMove moves src, srcRemote to this remote at dstRemote
@@ -767,6 +800,22 @@ type ChunkWriter interface {
 	Abort(ctx context.Context) error
 }
 
+// ChunkWriterResumer is an optional interface for ChunkWriter
+//
+// It is implemented by chunk writers whose uploads can be carried on
+// by a later process if this one is interrupted.
+type ChunkWriterResumer interface {
+	// ResumeToken returns an opaque token describing the upload
+	// which can be passed to OpenChunkWriter in a
+	// ChunkWriterResumeOption to carry on with it.
+	ResumeToken() string
+
+	// ResumedChunks returns the chunk numbers which were already
+	// uploaded if OpenChunkWriter carried on with a previous
+	// upload. These don't need to be written again.
+	ResumedChunks() []int
+}
+
 // UserInfoer is an optional interface for Fs
 type UserInfoer interface {
 	// UserInfo returns info about the connected user
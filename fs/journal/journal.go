@@ -0,0 +1,338 @@
+// Package journal keeps a persistent record of the progress of a
+// sync, copy or move so that an interrupted run can carry on where it
+// left off.
+package journal
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// facility is the name of the kv database the journal is kept in
+const facility = "journal"
+
+// Key prefixes for the different types of record
+const (
+	doneKey   = "done/"
+	uploadKey = "upload/"
+)
+
+// UploadMaxAge is how long an upload in progress is kept in the
+// journal without being carried on with. Older uploads are aborted
+// the next time the journal is used so their parts aren't left on the
+// remote.
+const UploadMaxAge = 24 * time.Hour
+
+// Journal records completed transfers and chunked uploads which are
+// in progress for a single source and destination pair.
+type Journal struct {
+	db     *kv.DB
+	prefix string // all keys for this pair are stored under here
+}
+
+// Done describes a transfer which completed successfully
+type Done struct {
+	Src string // fingerprint of the source
+	Dst string // fingerprint of the destination
+}
+
+// Upload describes a chunked upload which is in progress
+type Upload struct {
+	Src       string    // fingerprint of the source being uploaded
+	Size      int64     // size of the source
+	ChunkSize int64     // chunk size the upload was started with
+	Token     string    // backend specific token to resume the upload
+	Updated   time.Time // when the upload was last started or resumed
+}
+
+// stale returns true if the upload hasn't been carried on with for
+// longer than UploadMaxAge
+func (rec *Upload) stale() bool {
+	return time.Since(rec.Updated) > UploadMaxAge
+}
+
+// journalContextKey is the key used to store the journal in the context
+type journalContextKey struct{}
+
+var journalKey = journalContextKey{}
+
+// WithContext returns a new context with the journal attached
+func WithContext(ctx context.Context, j *Journal) context.Context {
+	return context.WithValue(ctx, journalKey, j)
+}
+
+// FromContext returns the journal attached to the context or nil if
+// there isn't one. A nil journal may be used safely.
+func FromContext(ctx context.Context) *Journal {
+	j, _ := ctx.Value(journalKey).(*Journal)
+	return j
+}
+
+// Open the journal for transfers from fsrc to fdst
+//
+// The journal is keyed on the configuration of both remotes so
+// running the same command again will find the same journal.
+func Open(ctx context.Context, fsrc, fdst fs.Fs) (*Journal, error) {
+	if !kv.Supported() {
+		return nil, errors.New("transfer journal is not supported on this OS")
+	}
+	db, err := kv.Start(ctx, facility, fdst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transfer journal: %w", err)
+	}
+	id := md5.Sum([]byte(fs.ConfigString(fsrc) + "\x00" + fs.ConfigString(fdst)))
+	j := &Journal{
+		db:     db,
+		prefix: hex.EncodeToString(id[:8]) + "/",
+	}
+	fs.Debugf(nil, "Using transfer journal %q in %s", j.prefix, db.Path())
+	j.abortStale(ctx, fdst)
+	return j, nil
+}
+
+// Close the journal
+//
+// If clear is set then all the records for this source and
+// destination are removed as they are no longer needed.
+func (j *Journal) Close(clear bool) error {
+	if j == nil {
+		return nil
+	}
+	if clear {
+		err := j.db.Do(true, &opPurge{prefix: j.prefix})
+		if err != nil && !errors.Is(err, kv.ErrEmpty) {
+			fs.Errorf(nil, "Failed to clear transfer journal: %v", err)
+		}
+	}
+	return j.db.Stop(false)
+}
+
+// SetDone records that src was transferred successfully to dst
+func (j *Journal) SetDone(ctx context.Context, src, dst fs.ObjectInfo) {
+	if j == nil || src == nil || dst == nil {
+		return
+	}
+	rec := Done{
+		Src: fs.Fingerprint(ctx, src, true),
+		Dst: fs.Fingerprint(ctx, dst, true),
+	}
+	j.put(doneKey+dst.Remote(), &rec)
+}
+
+// IsDone returns true if the journal has a record of src being
+// transferred to dst and neither has changed since.
+func (j *Journal) IsDone(ctx context.Context, src, dst fs.ObjectInfo) bool {
+	if j == nil || src == nil || dst == nil {
+		return false
+	}
+	var rec Done
+	if !j.get(doneKey+dst.Remote(), &rec) {
+		return false
+	}
+	return rec.Src == fs.Fingerprint(ctx, src, true) && rec.Dst == fs.Fingerprint(ctx, dst, true)
+}
+
+// GetUpload returns the in progress upload of src to remote on f if
+// there is one and src hasn't changed since it was started.
+//
+// If the upload can't be used it is aborted and removed from the
+// journal.
+func (j *Journal) GetUpload(ctx context.Context, f fs.Fs, remote string, src fs.ObjectInfo) (rec Upload, found bool) {
+	if j == nil {
+		return rec, false
+	}
+	if !j.get(uploadKey+remote, &rec) {
+		return rec, false
+	}
+	if rec.Size != src.Size() || rec.Src != fs.Fingerprint(ctx, src, true) {
+		fs.Debugf(src, "Aborting in progress upload in transfer journal as source has changed")
+		j.AbortUpload(ctx, f, remote, rec)
+		return rec, false
+	}
+	if rec.stale() {
+		fs.Debugf(src, "Aborting in progress upload in transfer journal as it is older than %v", UploadMaxAge)
+		j.AbortUpload(ctx, f, remote, rec)
+		return rec, false
+	}
+	return rec, true
+}
+
+// SetUpload records an in progress upload of src to remote
+func (j *Journal) SetUpload(ctx context.Context, remote string, src fs.ObjectInfo, chunkSize int64, token string) {
+	if j == nil {
+		return
+	}
+	rec := Upload{
+		Src:       fs.Fingerprint(ctx, src, true),
+		Size:      src.Size(),
+		ChunkSize: chunkSize,
+		Token:     token,
+		Updated:   time.Now(),
+	}
+	j.put(uploadKey+remote, &rec)
+}
+
+// AbortUpload aborts the upload rec to remote on f and removes it
+// from the journal so its parts aren't left on the remote.
+func (j *Journal) AbortUpload(ctx context.Context, f fs.Fs, remote string, rec Upload) {
+	if j == nil {
+		return
+	}
+	defer j.DeleteUpload(remote)
+	openChunkWriter := f.Features().OpenChunkWriter
+	if openChunkWriter == nil || rec.Token == "" {
+		return
+	}
+	// Carry on with the upload then abort it. If the upload has gone
+	// the backend starts a new one which is aborted instead.
+	src := object.NewStaticObjectInfo(remote, time.Now(), rec.Size, true, nil, f)
+	_, chunkWriter, err := openChunkWriter(ctx, remote, src, &fs.ChunkWriterResumeOption{Token: rec.Token})
+	if err == nil {
+		err = chunkWriter.Abort(ctx)
+	}
+	if err != nil {
+		fs.Errorf(remote, "Failed to abort upload from transfer journal: %v", err)
+		return
+	}
+	fs.Infof(remote, "Aborted upload from transfer journal")
+}
+
+// abortStale aborts the uploads in the journal which are older than
+// UploadMaxAge. These are uploads of files which haven't been
+// transferred since, so would otherwise be left on the remote.
+func (j *Journal) abortStale(ctx context.Context, f fs.Fs) {
+	op := &opList{prefix: j.prefix + uploadKey}
+	err := j.db.Do(false, op)
+	if err != nil && !errors.Is(err, kv.ErrEmpty) {
+		fs.Debugf(nil, "Failed to list uploads in transfer journal: %v", err)
+		return
+	}
+	for key, data := range op.records {
+		var rec Upload
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&rec); err != nil || !rec.stale() {
+			continue
+		}
+		remote := strings.TrimPrefix(key, op.prefix)
+		fs.Debugf(remote, "Aborting upload in transfer journal as it is older than %v", UploadMaxAge)
+		j.AbortUpload(ctx, f, remote, rec)
+	}
+}
+
+// DeleteUpload removes the record of an upload to remote
+func (j *Journal) DeleteUpload(remote string) {
+	if j == nil {
+		return
+	}
+	err := j.db.Do(true, &opDelete{key: j.prefix + uploadKey + remote})
+	if err != nil && !errors.Is(err, kv.ErrEmpty) {
+		fs.Debugf(remote, "Failed to remove upload from transfer journal: %v", err)
+	}
+}
+
+// put encodes rec and stores it under key
+func (j *Journal) put(key string, rec any) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(rec)
+	if err == nil {
+		err = j.db.Do(true, &opPut{key: j.prefix + key, data: buf.Bytes()})
+	}
+	if err != nil {
+		fs.Debugf(key, "Failed to write transfer journal: %v", err)
+	}
+}
+
+// get reads the record stored under key into rec returning true if
+// it was found
+func (j *Journal) get(key string, rec any) bool {
+	op := &opGet{key: j.prefix + key}
+	err := j.db.Do(false, op)
+	if err != nil || op.data == nil {
+		if err != nil && !errors.Is(err, kv.ErrEmpty) {
+			fs.Debugf(key, "Failed to read transfer journal: %v", err)
+		}
+		return false
+	}
+	err = gob.NewDecoder(bytes.NewReader(op.data)).Decode(rec)
+	if err != nil {
+		fs.Debugf(key, "Failed to decode transfer journal: %v", err)
+		return false
+	}
+	return true
+}
+
+// opGet: read a single record
+type opGet struct {
+	key  string
+	data []byte
+}
+
+func (op *opGet) Do(ctx context.Context, b kv.Bucket) error {
+	if data := b.Get([]byte(op.key)); data != nil {
+		op.data = bytes.Clone(data)
+	}
+	return nil
+}
+
+// opList: read all records under prefix
+type opList struct {
+	prefix  string
+	records map[string][]byte
+}
+
+func (op *opList) Do(ctx context.Context, b kv.Bucket) error {
+	op.records = make(map[string][]byte)
+	cur := b.Cursor()
+	for bkey, data := cur.Seek([]byte(op.prefix)); bkey != nil && strings.HasPrefix(string(bkey), op.prefix); bkey, data = cur.Next() {
+		op.records[string(bkey)] = bytes.Clone(data)
+	}
+	return nil
+}
+
+// opPut: write a single record
+type opPut struct {
+	key  string
+	data []byte
+}
+
+func (op *opPut) Do(ctx context.Context, b kv.Bucket) error {
+	return b.Put([]byte(op.key), op.data)
+}
+
+// opDelete: remove a single record
+type opDelete struct {
+	key string
+}
+
+func (op *opDelete) Do(ctx context.Context, b kv.Bucket) error {
+	return b.Delete([]byte(op.key))
+}
+
+// opPurge: remove all records under prefix
+type opPurge struct {
+	prefix string
+}
+
+func (op *opPurge) Do(ctx context.Context, b kv.Bucket) error {
+	var keys [][]byte
+	cur := b.Cursor()
+	for bkey, _ := cur.Seek([]byte(op.prefix)); bkey != nil && strings.HasPrefix(string(bkey), op.prefix); bkey, _ = cur.Next() {
+		keys = append(keys, bytes.Clone(bkey))
+	}
+	for _, key := range keys {
+		if err := b.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
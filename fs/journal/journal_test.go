@@ -0,0 +1,121 @@
+package journal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain drives the tests
+func TestMain(m *testing.M) {
+	fstest.TestMain(m)
+}
+
+func TestJournal(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("kv not supported on this OS")
+	}
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	t1 := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	t2 := fstest.Time("2011-12-25T12:59:59.123456789Z")
+
+	r.WriteFile("one", "one", t1)
+	r.WriteObject(ctx, "one", "one", t1)
+	src, err := r.Flocal.NewObject(ctx, "one")
+	require.NoError(t, err)
+	dst, err := r.Fremote.NewObject(ctx, "one")
+	require.NoError(t, err)
+
+	j, err := Open(ctx, r.Flocal, r.Fremote)
+	require.NoError(t, err)
+
+	// Nothing recorded yet
+	assert.False(t, j.IsDone(ctx, src, dst))
+	_, found := j.GetUpload(ctx, r.Fremote, "big", src)
+	assert.False(t, found)
+
+	// Completed transfers
+	j.SetDone(ctx, src, dst)
+	assert.True(t, j.IsDone(ctx, src, dst))
+	assert.False(t, j.IsDone(ctx, src, nil))
+
+	// In progress uploads
+	j.SetUpload(ctx, "big", src, 1024, "token")
+	rec, found := j.GetUpload(ctx, r.Fremote, "big", src)
+	require.True(t, found)
+	assert.Equal(t, "token", rec.Token)
+	assert.Equal(t, int64(1024), rec.ChunkSize)
+	assert.Equal(t, src.Size(), rec.Size)
+
+	// Stale uploads are aborted and removed
+	j.SetUpload(ctx, "stale", src, 1024, "token")
+	rec, found = j.GetUpload(ctx, r.Fremote, "stale", src)
+	require.True(t, found)
+	rec.Updated = time.Now().Add(-UploadMaxAge - time.Minute)
+	j.put(uploadKey+"stale", &rec)
+	_, found = j.GetUpload(ctx, r.Fremote, "stale", src)
+	assert.False(t, found)
+	assert.False(t, j.get(uploadKey+"stale", &rec))
+
+	// Stale uploads are aborted when the journal is opened
+	j.put(uploadKey+"stale", &rec)
+	j4, err := Open(ctx, r.Flocal, r.Fremote)
+	require.NoError(t, err)
+	assert.False(t, j4.get(uploadKey+"stale", &rec))
+	assert.True(t, j4.get(uploadKey+"big", &rec))
+	require.NoError(t, j4.Close(false))
+
+	// A journal for a different pair doesn't see the records
+	j2, err := Open(ctx, r.Fremote, r.Flocal)
+	require.NoError(t, err)
+	assert.False(t, j2.IsDone(ctx, src, dst))
+	require.NoError(t, j2.Close(false))
+
+	// Records are ignored when the source changes
+	r.WriteFile("one", "onetwo", t2)
+	src2, err := r.Flocal.NewObject(ctx, "one")
+	require.NoError(t, err)
+	assert.False(t, j.IsDone(ctx, src2, dst))
+	_, found = j.GetUpload(ctx, r.Fremote, "big", src2)
+	assert.False(t, found)
+
+	// Deleting uploads
+	j.DeleteUpload("big")
+	_, found = j.GetUpload(ctx, r.Fremote, "big", src)
+	assert.False(t, found)
+
+	// Records are shared with other users of the journal and
+	// closing with clear removes them
+	j.SetDone(ctx, src, dst)
+	j3, err := Open(ctx, r.Flocal, r.Fremote)
+	require.NoError(t, err)
+	assert.True(t, j3.IsDone(ctx, src, dst))
+	require.NoError(t, j.Close(true))
+	assert.False(t, j3.IsDone(ctx, src, dst))
+	require.NoError(t, j3.Close(false))
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, FromContext(ctx))
+	j := &Journal{}
+	ctx = WithContext(ctx, j)
+	assert.Equal(t, j, FromContext(ctx))
+
+	// A nil journal is safe to use
+	var nilJournal *Journal
+	assert.False(t, nilJournal.IsDone(ctx, nil, nil))
+	nilJournal.SetDone(ctx, nil, nil)
+	nilJournal.DeleteUpload("potato")
+	assert.NoError(t, nilJournal.Close(true))
+	_, found := nilJournal.GetUpload(ctx, nil, "potato", object.NewStaticObjectInfo("potato", time.Time{}, 0, true, nil, nil))
+	assert.False(t, found)
+}
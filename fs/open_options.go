@@ -332,6 +332,31 @@ func (o *ChunkOption) String() string {
 	return fmt.Sprintf("ChunkOption(%v)", o.ChunkSize)
 }
 
+// ChunkWriterResumeOption defines an Option which asks OpenChunkWriter
+// to carry on with a previously started upload rather than starting
+// a new one.
+//
+// Token should be the value returned by ChunkWriterResumer.ResumeToken
+// for the upload. Backends which can't resume uploads ignore it.
+type ChunkWriterResumeOption struct {
+	Token string
+}
+
+// Header formats the option as an http header
+func (o *ChunkWriterResumeOption) Header() (key string, value string) {
+	return "", ""
+}
+
+// Mandatory returns whether the option must be parsed or can be ignored
+func (o *ChunkWriterResumeOption) Mandatory() bool {
+	return false
+}
+
+// String formats the option into human-readable form
+func (o *ChunkWriterResumeOption) String() string {
+	return fmt.Sprintf("ChunkWriterResumeOption(%q)", o.Token)
+}
+
 // OpenOptionAddHeaders adds each header found in options to the
 // headers map provided the key was non empty.
 func OpenOptionAddHeaders(options []OpenOption, headers map[string]string) {
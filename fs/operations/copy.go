@@ -39,6 +39,7 @@ type copy struct {
 	tr            *accounting.Transfer // accounting for the transfer
 	inplace       bool                 // set if we are updating inplace and not using a partial name
 	remoteForCopy string               // the name used for the transfer, either remote or remote+".partial"
+	patcher       fs.Patcher           // set if updating dst in place with --delta
 }
 
 // Used to remove a failed copy
@@ -117,6 +118,9 @@ func (c *copy) checkPartial(ctx context.Context) (remoteForCopy string, inplace
 
 // Check to see if we have hit max transfer limits
 func (c *copy) checkLimits(ctx context.Context) (err error) {
+	if err = accounting.CheckQuota(c.src.Fs(), c.f); err != nil {
+		return err
+	}
 	if c.ci.MaxTransfer < 0 {
 		return nil
 	}
@@ -265,6 +269,15 @@ func (c *copy) manualCopy(ctx context.Context) (actionTaken string, newDst fs.Ob
 		downloadOptions = append(downloadOptions, option)
 	}
 
+	if c.patcher != nil {
+		actionTaken, newDst, err = c.deltaCopy(ctx, downloadOptions)
+		if !errors.Is(err, fs.ErrorCantCopy) {
+			return actionTaken, newDst, err
+		}
+		fs.Debugf(c.src, "delta: transferring the whole file: %v", err)
+		c.patcher = nil
+	}
+
 	if doMultiThreadCopy(ctx, c.f, c.src) {
 		return c.multiThreadCopy(ctx, uploadOptions)
 	}
@@ -420,6 +433,8 @@ func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Obj
 	if err != nil {
 		return nil, err
 	}
+	// Are we updating dst with --delta?
+	c.patcher = c.deltaPatcher()
 	// Do the copy now everything is set up
 	return c.copy(ctx)
 }
@@ -5,12 +5,14 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"runtime"
 	"sort"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
@@ -395,6 +397,88 @@ func TestCopyInplace(t *testing.T) {
 	r.CheckRemoteItems(t, file2)
 }
 
+func TestCopyDelta(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	ci.Delta = true
+	ci.DeltaBlockSize = 16
+
+	old := strings.Repeat("0123456789abcdefghijklmnopqrstuvwxyz", 10)
+	for _, inplace := range []bool{false, true} {
+		ci.Inplace = inplace
+		for _, test := range []struct {
+			name     string
+			contents string
+		}{
+			{"changed", old[:100] + "CHANGED" + old[107:]},
+			{"longer", old + "extra data on the end"},
+			{"shorter", old[:200]},
+			{"moved", old[32:]},
+			{"different", strings.Repeat("potato", 20)},
+		} {
+			t.Run(fmt.Sprintf("%s,inplace=%v", test.name, inplace), func(t *testing.T) {
+				r.WriteObject(ctx, "file1", old, t1)
+				dst, err := r.Fremote.NewObject(ctx, "file1")
+				require.NoError(t, err)
+				if _, ok := dst.(fs.Patcher); !ok {
+					t.Skip("remote can't be updated in place")
+				}
+				localFile := r.WriteFile("file1", test.contents, t2)
+
+				err = operations.CopyFile(ctx, r.Fremote, r.Flocal, "file1", "file1")
+				require.NoError(t, err)
+				r.CheckRemoteItems(t, localFile)
+			})
+		}
+	}
+}
+
+// failingObject is an object whose contents fail to read after n bytes
+type failingObject struct {
+	fs.Object
+	n int64
+}
+
+// Open the object returning an error after n bytes
+func (o failingObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	in, err := o.Object.Open(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(io.LimitReader(in, o.n), iotest.ErrReader(errors.New("BOOM"))), in}, nil
+}
+
+func TestCopyDeltaInterrupted(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	ci.Delta = true
+	ci.DeltaBlockSize = 16
+	ci.LowLevelRetries = 1
+
+	old := strings.Repeat("0123456789abcdefghijklmnopqrstuvwxyz", 10)
+	oldFile := r.WriteObject(ctx, "file1", old, t1)
+	dst, err := r.Fremote.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	if _, ok := dst.(fs.PatchCopier); !ok {
+		t.Skip("remote can't copy files to patch")
+	}
+	r.WriteFile("file1", strings.ToUpper(old), t2)
+	src, err := r.Flocal.NewObject(ctx, "file1")
+	require.NoError(t, err)
+
+	// The destination is untouched if the transfer fails part way
+	_, err = operations.Copy(ctx, r.Fremote, dst, "file1", failingObject{Object: src, n: 100})
+	require.Error(t, err)
+	r.CheckRemoteItems(t, oldFile)
+}
+
 func TestCopyLongFileName(t *testing.T) {
 	ctx := context.Background()
 	ctx, ci := fs.AddConfig(ctx)
@@ -0,0 +1,175 @@
+// Delta transfers
+
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/delta"
+)
+
+// deltaPatcher returns the Patcher for c.dst if --delta can be used
+// to update it from c.src or nil if not.
+func (c *copy) deltaPatcher() fs.Patcher {
+	if !c.ci.Delta || c.dst == nil || c.src.Size() < 0 || c.dst.Size() <= 0 || c.ci.DeltaBlockSize <= 0 {
+		return nil
+	}
+	patcher, ok := c.dst.(fs.Patcher)
+	if !ok {
+		return nil
+	}
+	return patcher
+}
+
+// deltaSignature works out the signature of the blocks of dst
+//
+// If the remote can calculate the block hashes it uses those,
+// otherwise it reads dst.
+func deltaSignature(ctx context.Context, dst fs.Object, blockSize int64) (sig *delta.Signature, err error) {
+	if do, ok := dst.(fs.BlockHasher); ok {
+		hashes, err := do.BlockHashes(ctx, blockSize)
+		if err == nil {
+			return delta.NewStrongSignature(dst.Size(), blockSize, hashes)
+		}
+		if !errors.Is(err, fs.ErrorNotImplemented) {
+			fs.Debugf(dst, "delta: failed to read block hashes so reading the file instead: %v", err)
+		}
+	}
+	in, err := Open(ctx, dst)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	return delta.NewSignature(in, dst.Size(), blockSize)
+}
+
+// deltaPartial copies c.dst to the partial file c.remoteForCopy on the
+// remote so that can be patched instead of c.dst, which is only
+// replaced once the transfer is complete.
+//
+// It returns fs.ErrorCantCopy if the remote can't copy c.dst without
+// transferring it.
+func (c *copy) deltaPartial(ctx context.Context) (patcher fs.Patcher, err error) {
+	do, ok := c.dst.(fs.PatchCopier)
+	if !ok {
+		return nil, fmt.Errorf("can't copy the destination to a partial file on %v: %w", c.f, fs.ErrorCantCopy)
+	}
+	partial, err := do.PatchCopy(ctx, c.remoteForCopy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy the destination to a partial file: %w", err)
+	}
+	patcher, ok = partial.(fs.Patcher)
+	if !ok {
+		return nil, fmt.Errorf("can't update the partial file in place: %w", fs.ErrorCantCopy)
+	}
+	return patcher, nil
+}
+
+// Copy c.src over c.dst writing only the blocks which have changed
+//
+// Unless --inplace is in use the blocks are written to a copy of
+// c.dst with a partial name which is renamed over c.dst afterwards.
+func (c *copy) deltaCopy(ctx context.Context, downloadOptions []fs.OpenOption) (actionTaken string, newDst fs.Object, err error) {
+	patcher := c.patcher
+	if !c.inplace {
+		patcher, err = c.deltaPartial(ctx)
+		if err != nil {
+			return actionTaken, nil, err
+		}
+	}
+	blockSize := int64(c.ci.DeltaBlockSize)
+	sig, err := deltaSignature(ctx, c.dst, blockSize)
+	if err != nil {
+		return actionTaken, nil, fmt.Errorf("delta: failed to read destination signature: %w", err)
+	}
+
+	in, err := Open(ctx, c.src, downloadOptions...)
+	if err != nil {
+		return actionTaken, nil, fmt.Errorf("failed to open source object: %w", err)
+	}
+	inAcc := c.tr.Account(ctx, in).WithBuffer()
+	defer fs.CheckClose(inAcc, &err)
+
+	out, err := patcher.Patch(ctx, c.src.Size())
+	if err != nil {
+		return actionTaken, nil, fmt.Errorf("delta: failed to open destination: %w", err)
+	}
+
+	// Blocks which have moved have to be read back from the
+	// destination so only use them if it can do that
+	readerAt, moved := out.(io.ReaderAt)
+	var buf []byte
+	var written, reused int64
+	err = delta.Diff(inAcc, sig, moved, func(op delta.Op) error {
+		if op.Block < 0 {
+			written += op.Size
+			_, err := out.WriteAt(op.Data, op.Pos)
+			return err
+		}
+		reused += op.Size
+		blockPos := int64(op.Block) * blockSize
+		if blockPos == op.Pos {
+			return nil
+		}
+		if cap(buf) < int(op.Size) {
+			buf = make([]byte, op.Size)
+		}
+		buf = buf[:op.Size]
+		_, err := readerAt.ReadAt(buf, blockPos)
+		if err != nil {
+			return fmt.Errorf("failed to read block %d: %w", op.Block, err)
+		}
+		_, err = out.WriteAt(buf, op.Pos)
+		return err
+	})
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return actionTaken, nil, fmt.Errorf("delta: %w", err)
+	}
+	fs.Debugf(c.src, "delta: wrote %v and reused %v of the destination", fs.SizeSuffix(written), fs.SizeSuffix(reused))
+
+	newDst, err = c.f.NewObject(ctx, c.remoteForCopy)
+	if err != nil {
+		return actionTaken, nil, fmt.Errorf("delta: failed to find object after copy: %w", err)
+	}
+	err = c.deltaSetMetadata(ctx, newDst)
+	if err != nil {
+		return actionTaken, nil, err
+	}
+	return "Copied (delta, replaced existing)", newDst, nil
+}
+
+// Patch doesn't set metadata so set it on newDst from c.src
+func (c *copy) deltaSetMetadata(ctx context.Context, newDst fs.Object) error {
+	if c.ci.Metadata {
+		if do, ok := newDst.(fs.SetMetadataer); ok {
+			meta, err := fs.GetMetadataOptions(ctx, c.f, c.src, fs.MetadataAsOpenOptions(ctx))
+			if err != nil {
+				return fmt.Errorf("delta: failed to read metadata from source object: %w", err)
+			}
+			if _, foundMeta := meta["mtime"]; !foundMeta {
+				meta.Set("mtime", c.src.ModTime(ctx).Format(time.RFC3339Nano))
+			}
+			err = do.SetMetadata(ctx, meta)
+			if err != nil {
+				return fmt.Errorf("delta: failed to set metadata: %w", err)
+			}
+			return nil
+		}
+		fs.Errorf(newDst, "delta: can't set metadata as SetMetadata isn't implemented in: %v", c.f)
+	}
+	err := newDst.SetModTime(ctx, c.src.ModTime(ctx))
+	switch err {
+	case nil, fs.ErrorCantSetModTime, fs.ErrorCantSetModTimeWithoutDelete:
+		return nil
+	}
+	return fmt.Errorf("delta: failed to set modification time: %w", err)
+}
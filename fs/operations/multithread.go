@@ -6,13 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/journal"
 	"github.com/rclone/rclone/lib/atexit"
 	"github.com/rclone/rclone/lib/multipart"
 	"github.com/rclone/rclone/lib/pool"
+	"github.com/rclone/rclone/lib/ranges"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -60,7 +63,42 @@ type multiThreadCopyState struct {
 	src         fs.Object
 	acc         *accounting.Account
 	numChunks   int
-	noBuffering bool // set to read the input without buffering
+	noBuffering bool            // set to read the input without buffering
+	data        ranges.Ranges   // parts of the source with data if holeWriter is set
+	holeWriter  fs.HoleWriterAt // set if holes in the source can be skipped
+}
+
+// findHoles sets up mc to skip the holes in the source if both the
+// source and the destination support it
+func (mc *multiThreadCopyState) findHoles(ctx context.Context, chunkWriter fs.ChunkWriter) {
+	w, ok := chunkWriter.(*writerAtChunkWriter)
+	if !ok {
+		return
+	}
+	holeWriter, ok := w.writerAt.(fs.HoleWriterAt)
+	if !ok {
+		return
+	}
+	do, ok := mc.src.(fs.DataRanger)
+	if !ok {
+		return
+	}
+	data, err := do.DataRanges(ctx)
+	if err != nil {
+		fs.Debugf(mc.src, "multi-thread copy: failed to find holes: %v", err)
+		return
+	}
+	if data.Size() >= mc.size {
+		return
+	}
+	fs.Debugf(mc.src, "multi-thread copy: source has %v of holes", fs.SizeSuffix(mc.size-data.Size()))
+	mc.data, mc.holeWriter = data, holeWriter
+}
+
+// isHole returns true if the chunk from start to end is a hole which
+// doesn't need copying
+func (mc *multiThreadCopyState) isHole(start, end int64) bool {
+	return mc.holeWriter != nil && len(mc.data.Intersection(ranges.Range{Pos: start, Size: end - start})) == 0
 }
 
 // Copy a single chunk into place
@@ -154,17 +192,50 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		return nil, fmt.Errorf("multi-thread copy: can't copy zero sized file")
 	}
 
-	info, chunkWriter, err := openChunkWriter(ctx, remote, src, options...)
+	// If there is an upload in progress in the journal ask the
+	// backend to carry on with it
+	j := journal.FromContext(ctx)
+	resume, resumeFound := j.GetUpload(ctx, f, remote, src)
+	openOptions := options
+	if resumeFound {
+		fs.Debugf(src, "multi-thread copy: found upload in transfer journal - attempting to resume")
+		openOptions = append(slices.Clip(options), &fs.ChunkWriterResumeOption{Token: resume.Token})
+	}
+
+	info, chunkWriter, err := openChunkWriter(ctx, remote, src, openOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("multi-thread copy: failed to open chunk writer: %w", err)
 	}
 
+	// If journalling a resumable upload, leave the parts on error
+	// so the next run can carry on with them
+	resumer, resumable := chunkWriter.(fs.ChunkWriterResumer)
+	journalling := j != nil && resumable
+
+	// Parts uploaded with a different chunk size can't be used, so
+	// abort the old upload and start a new one
+	if journalling && resumeFound && min(info.ChunkSize, src.Size()) != resume.ChunkSize {
+		fs.Debugf(src, "multi-thread copy: chunk size changed from %v - aborting upload in transfer journal", fs.SizeSuffix(resume.ChunkSize))
+		abortErr := chunkWriter.Abort(ctx)
+		if abortErr != nil {
+			fs.Debugf(src, "multi-thread copy: abort failed: %v", abortErr)
+		}
+		j.DeleteUpload(remote)
+		resumeFound = false
+		info, chunkWriter, err = openChunkWriter(ctx, remote, src, options...)
+		if err != nil {
+			return nil, fmt.Errorf("multi-thread copy: failed to open chunk writer: %w", err)
+		}
+		resumer, resumable = chunkWriter.(fs.ChunkWriterResumer)
+		journalling = resumable
+	}
+
 	uploadCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	uploadedOK := false
 	defer atexit.OnError(&err, func() {
 		cancel()
-		if info.LeavePartsOnError || uploadedOK {
+		if info.LeavePartsOnError || journalling || uploadedOK {
 			return
 		}
 		fs.Debugf(src, "multi-thread copy: cancelling transfer on exit")
@@ -195,6 +266,21 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		concurrency = 1
 	}
 
+	// Find the chunks which don't need uploading again and record
+	// the upload in the journal
+	var skipChunks map[int]struct{}
+	if journalling {
+		if resumeFound {
+			resumed := resumer.ResumedChunks()
+			skipChunks = make(map[int]struct{}, len(resumed))
+			for _, chunk := range resumed {
+				skipChunks[chunk] = struct{}{}
+			}
+			fs.Infof(src, "multi-thread copy: resuming upload with %d/%d chunks already uploaded", len(skipChunks), numChunks)
+		}
+		j.SetUpload(ctx, remote, src, info.ChunkSize, resumer.ResumeToken())
+	}
+
 	g, gCtx := errgroup.WithContext(uploadCtx)
 	g.SetLimit(concurrency)
 
@@ -209,6 +295,7 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 
 	// Make accounting
 	mc.acc = tr.Account(gCtx, nil)
+	mc.findHoles(gCtx, chunkWriter)
 
 	fs.Debugf(src, "Starting multi-thread copy with %d chunks of size %v with %v parallel streams", mc.numChunks, fs.SizeSuffix(mc.partSize), concurrency)
 	for chunk := range mc.numChunks {
@@ -225,6 +312,24 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		end := min(start+mc.partSize, mc.size)
 		size := end - start
 
+		// Skip chunks uploaded by a previous run
+		if _, found := skipChunks[chunk]; found {
+			fs.Debugf(src, "multi-thread copy: chunk %d/%d already uploaded", chunk+1, mc.numChunks)
+			mc.acc.AccountReadNoNetwork(size)
+			continue
+		}
+
+		// Skip chunks which are holes in the source
+		if mc.isHole(start, end) {
+			fs.Debugf(src, "multi-thread copy: chunk %d/%d is a hole", chunk+1, mc.numChunks)
+			err = mc.holeWriter.WriteHole(start, size)
+			if err != nil {
+				return nil, fmt.Errorf("multi-thread copy: failed to write hole: %w", err)
+			}
+			mc.acc.AccountReadNoNetwork(size)
+			continue
+		}
+
 		// Reserve the memory first so we don't open the source and wait for memory buffers for ages
 		// This also avoids creating an excess of goroutines all waiting on memory.
 		var rw *pool.RW
@@ -246,6 +351,9 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		return nil, fmt.Errorf("multi-thread copy: failed to close object after copy: %w", err)
 	}
 	uploadedOK = true // file is definitely uploaded OK so no need to abort
+	if journalling {
+		j.DeleteUpload(remote)
+	}
 
 	obj, err := f.NewObject(ctx, remote)
 	if err != nil {
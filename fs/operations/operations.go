@@ -518,6 +518,38 @@ func move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.
 	return newDst, DeleteFile(ctx, src)
 }
 
+// HardLink hard links src into fdst at remote, replacing dst if it is
+// not nil.
+//
+// If fdst can't hard link src then it falls back to Copy which will
+// use a server-side copy if available.
+func HardLink(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Object, err error) {
+	doHardLink := fdst.Features().HardLink
+	if doHardLink == nil || !SameConfig(src.Fs(), fdst) {
+		return Copy(ctx, fdst, dst, remote, src)
+	}
+	tr := accounting.Stats(ctx).NewCheckingTransfer(src, "hard linking")
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	if SkipDestructive(ctx, src, "hard link") {
+		return dst, nil
+	}
+	newDst, err = doHardLink(ctx, src, transform.Path(ctx, remote, false))
+	switch {
+	case err == nil:
+		fs.Infof(newDst, "Hard linked from %s", src.String())
+		return newDst, nil
+	case errors.Is(err, fs.ErrorCantHardLink):
+		fs.Debugf(src, "Can't hard link, switching to copy")
+	default:
+		err = fs.CountError(ctx, err)
+		fs.Errorf(src, "Couldn't hard link: %v", err)
+		return nil, err
+	}
+	return Copy(ctx, fdst, dst, remote, src)
+}
+
 // CanServerSideMove returns true if fdst support server-side moves or
 // server-side copies
 //
@@ -1654,11 +1686,34 @@ func GetCopyDest(ctx context.Context, fdst fs.Fs) (CopyDest []fs.Fs, err error)
 	return CopyDest, nil
 }
 
-// copyDest checks --copy-dest to see if src needs to
-// be copied
+// GetLinkDest sets up --link-dest
+func GetLinkDest(ctx context.Context, fdst fs.Fs) (LinkDest []fs.Fs, err error) {
+	ci := fs.GetConfig(ctx)
+	LinkDest, err = cache.GetArr(ctx, ci.LinkDest)
+	if err != nil {
+		return nil, fserrors.FatalError(fmt.Errorf("failed to make fs for --link-dest %q: %w", ci.LinkDest, err))
+	}
+	if !SameConfigArr(fdst, LinkDest) {
+		return nil, fserrors.FatalError(errors.New("parameter to --link-dest has to be on the same remote as destination"))
+	}
+	for _, lf := range LinkDest {
+		if lf.Features().HardLink == nil && lf.Features().Copy == nil {
+			return nil, fserrors.FatalError(errors.New("can't use --link-dest on a remote which doesn't support hard links or server side copy"))
+		}
+	}
+
+	return LinkDest, nil
+}
+
+// copyDest checks --copy-dest (or --link-dest if link is set) to see
+// if src needs to be copied
 //
 // Returns True if src was copied from --copy-dest
-func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CopyDest, backupDir fs.Fs) (NoNeedTransfer bool, err error) {
+func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CopyDest, backupDir fs.Fs, link bool) (NoNeedTransfer bool, err error) {
+	flag := "--copy-dest"
+	if link {
+		flag = "--link-dest"
+	}
 	var remote string
 	if dst == nil {
 		remote = src.Remote()
@@ -1686,23 +1741,31 @@ func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CopyDest, bac
 				// If successful zero out the dstObj as it is no longer there
 				dst = nil
 			}
-			_, err := Copy(ctx, fdst, dst, remote, CopyDestFile)
+			if link {
+				_, err = HardLink(ctx, fdst, dst, remote, CopyDestFile)
+			} else {
+				_, err = Copy(ctx, fdst, dst, remote, CopyDestFile)
+			}
 			if err != nil {
-				fs.Errorf(src, "Destination found in --copy-dest, error copying")
+				fs.Errorf(src, "Destination found in %s, error copying", flag)
 				return false, nil
 			}
-			fs.Debugf(src, "Destination found in --copy-dest, using server-side copy")
+			if link {
+				fs.Debugf(src, "Destination found in %s, using hard link or server-side copy", flag)
+			} else {
+				fs.Debugf(src, "Destination found in %s, using server-side copy", flag)
+			}
 			return true, nil
 		}
 		fs.Debugf(src, "Unchanged skipping")
 		return true, nil
 	}
-	fs.Debugf(src, "Destination not found in --copy-dest")
+	fs.Debugf(src, "Destination not found in %s", flag)
 	return false, nil
 }
 
-// CompareOrCopyDest checks --compare-dest and --copy-dest to see if src
-// does not need to be copied
+// CompareOrCopyDest checks --compare-dest, --copy-dest and
+// --link-dest to see if src does not need to be copied
 //
 // Returns True if src does not need to be copied
 func CompareOrCopyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CompareOrCopyDest []fs.Fs, backupDir fs.Fs) (NoNeedTransfer bool, err error) {
@@ -1716,7 +1779,14 @@ func CompareOrCopyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, Comp
 		}
 	} else if len(ci.CopyDest) > 0 {
 		for _, copyF := range CompareOrCopyDest {
-			NoNeedTransfer, err := copyDest(ctx, fdst, dst, src, copyF, backupDir)
+			NoNeedTransfer, err := copyDest(ctx, fdst, dst, src, copyF, backupDir, false)
+			if NoNeedTransfer || err != nil {
+				return NoNeedTransfer, err
+			}
+		}
+	} else if len(ci.LinkDest) > 0 {
+		for _, linkF := range CompareOrCopyDest {
+			NoNeedTransfer, err := copyDest(ctx, fdst, dst, src, linkF, backupDir, true)
 			if NoNeedTransfer || err != nil {
 				return NoNeedTransfer, err
 			}
@@ -2083,6 +2153,11 @@ func moveOrCopyFile(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, dstFileName str
 		if err != nil {
 			return err
 		}
+	} else if len(ci.LinkDest) > 0 {
+		copyDestDir, err = GetLinkDest(ctx, fdst)
+		if err != nil {
+			return err
+		}
 	}
 	needTransfer := NeedTransfer(ctx, dstObj, srcObj)
 	if needTransfer {
@@ -1,6 +1,10 @@
 package fs
 
-import "context"
+import (
+	"context"
+
+	"github.com/rclone/rclone/lib/ranges"
+)
 
 // OverrideRemote is a wrapper to override the Remote for an
 // ObjectInfo
@@ -78,3 +82,13 @@ func (o *OverrideRemote) Metadata(ctx context.Context) (Metadata, error) {
 	}
 	return nil, nil
 }
+
+// DataRanges returns the parts of the object which contain data
+//
+// It returns the whole object if the holes can't be found
+func (o *OverrideRemote) DataRanges(ctx context.Context) (ranges.Ranges, error) {
+	if do, ok := o.ObjectInfo.(DataRanger); ok {
+		return do.DataRanges(ctx)
+	}
+	return ranges.Ranges{{Pos: 0, Size: o.Size()}}, nil
+}
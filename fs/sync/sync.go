@@ -17,6 +17,7 @@ import (
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/journal"
 	"github.com/rclone/rclone/fs/march"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/lib/errcount"
@@ -83,7 +84,7 @@ type syncCopyMove struct {
 	trackRenamesWg         sync.WaitGroup         // wg for background track renames
 	trackRenamesCh         chan fs.Object         // objects are pumped in here
 	renameCheck            []fs.Object            // accumulate files to check for rename here
-	compareCopyDest        []fs.Fs                // place to check for files to server side copy
+	compareCopyDest        []fs.Fs                // place to check for files to server side copy or hard link
 	backupDir              fs.Fs                  // place to store overwrites/deletes
 	checkFirst             bool                   // if set run all the checkers before starting transfers
 	maxDurationEndTime     time.Time              // end time if --max-duration is set
@@ -97,6 +98,7 @@ type syncCopyMove struct {
 	setDirModTimesMaxLevel int                    // max level of the directories to set
 	modifiedDirs           map[string]struct{}    // dirs with changed contents (if s.setDirModTimeAfter)
 	allowOverlap           bool                   // whether we allow src and dst to overlap (i.e. for convmv)
+	journal                *journal.Journal       // journal of completed transfers if --transfer-journal
 }
 
 // For keeping track of delayed modtime sets
@@ -288,6 +290,22 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 		if err != nil {
 			return nil, err
 		}
+	} else if len(ci.LinkDest) > 0 {
+		var err error
+		s.compareCopyDest, err = operations.GetLinkDest(ctx, fdst)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Open the journal if required and make it available to the transfers
+	if ci.TransferJournal && deleteMode != fs.DeleteModeOnly {
+		var err error
+		s.journal, err = journal.Open(ctx, fsrc, fdst)
+		if err != nil {
+			return nil, err
+		}
+		s.ctx = journal.WithContext(s.ctx, s.journal)
+		s.inCtx = journal.WithContext(s.inCtx, s.journal)
 	}
 	return s, nil
 }
@@ -380,7 +398,12 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 		tr := accounting.Stats(s.ctx).NewCheckingTransfer(src, "checking")
 		// Check to see if can store this
 		if src.Storable() {
-			needTransfer := operations.NeedTransfer(s.ctx, pair.Dst, pair.Src)
+			var needTransfer bool
+			if s.journal.IsDone(s.ctx, pair.Src, pair.Dst) {
+				fs.Debugf(src, "Unchanged since transferred by a previous run - skipping")
+			} else {
+				needTransfer = operations.NeedTransfer(s.ctx, pair.Dst, pair.Src)
+			}
 			if needTransfer {
 				NoNeedTransfer, err := operations.CompareOrCopyDest(s.ctx, s.fdst, pair.Dst, pair.Src, s.compareCopyDest, s.backupDir)
 				if err != nil {
@@ -515,7 +538,11 @@ func (s *syncCopyMove) pairCopyOrMove(ctx context.Context, in *pipe, fdst fs.Fs,
 				err = operations.DeleteFile(ctx, src)
 			}
 		} else {
-			_, err = operations.Copy(ctx, fdst, dst, src.Remote(), src)
+			var newDst fs.Object
+			newDst, err = operations.Copy(ctx, fdst, dst, src.Remote(), src)
+			if err == nil {
+				s.journal.SetDone(ctx, src, newDst)
+			}
 		}
 		s.processError(err)
 		if err != nil {
@@ -934,6 +961,14 @@ func (s *syncCopyMove) tryRename(src fs.Object) bool {
 //
 // dir is the start directory, "" for root
 func (s *syncCopyMove) run() error {
+	// Close the journal at the end, clearing it if everything worked
+	defer func() {
+		err := s.journal.Close(s.currentError() == nil)
+		if err != nil {
+			fs.Debugf(s.fdst, "Failed to close transfer journal: %v", err)
+		}
+	}()
+
 	if operations.Same(s.fdst, s.fsrc) && !s.allowOverlap {
 		fs.Errorf(s.fdst, "Nothing to do as source and destination are the same")
 		return nil
@@ -1250,7 +1285,7 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 			case s.trackRenamesCh <- x:
 			}
 		} else {
-			// Check CompareDest && CopyDest
+			// Check CompareDest, CopyDest && LinkDest
 			NoNeedTransfer, err := operations.CompareOrCopyDest(s.ctx, s.fdst, nil, x, s.compareCopyDest, s.backupDir)
 			if err != nil {
 				s.processError(err)
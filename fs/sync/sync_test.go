@@ -2369,6 +2369,76 @@ func TestSyncCopyDest(t *testing.T) {
 	r.CheckRemoteItems(t, file2, file2dst, file3, file4, file4dst, file6, file7dst)
 }
 
+// Test with LinkDest set
+func TestSyncLinkDest(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	if r.Fremote.Features().HardLink == nil && r.Fremote.Features().Copy == nil {
+		t.Skip("Skipping test as remote does not support hard links or server-side copy")
+	}
+
+	ci.LinkDest = []string{r.FremoteName + "/LinkDest"}
+
+	fdst, err := fs.NewFs(ctx, r.FremoteName+"/dst")
+	require.NoError(t, err)
+
+	// previous snapshot has one unchanged file and one changed file
+	file1 := r.WriteObject(ctx, "LinkDest/one", "one", t1)
+	file2 := r.WriteObject(ctx, "LinkDest/two", "two", t1)
+	file3 := r.WriteFile("one", "one", t1)
+	file4 := r.WriteFile("two", "twot2", t2)
+	r.CheckRemoteItems(t, file1, file2)
+	r.CheckLocalItems(t, file3, file4)
+
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, fdst, r.Flocal, false)
+	require.NoError(t, err)
+
+	file3dst := file3
+	file3dst.Path = "dst/one"
+	file4dst := file4
+	file4dst.Path = "dst/two"
+
+	r.CheckRemoteItems(t, file1, file2, file3dst, file4dst)
+
+	// the unchanged file should be hard linked on the local backend
+	if r.Fremote.Features().IsLocal && r.Fremote.Features().HardLink != nil {
+		fiLink, err := os.Stat(r.FremoteName + "/LinkDest/one")
+		require.NoError(t, err)
+		fiDst, err := os.Stat(r.FremoteName + "/dst/one")
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(fiLink, fiDst), "expecting dst/one to be a hard link")
+	}
+}
+
+// Test with TransferJournal set
+func TestCopyTransferJournal(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	ci.TransferJournal = true
+
+	file1 := r.WriteFile("one", "one", t1)
+	file2 := r.WriteFile("sub dir/two", "two", t2)
+	r.CheckLocalItems(t, file1, file2)
+
+	accounting.GlobalStats().ResetCounters()
+	err := CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	r.CheckRemoteItems(t, file1, file2)
+
+	// Check a run with the journal still notices changes
+	file1b := r.WriteFile("one", "onechanged", t3)
+	accounting.GlobalStats().ResetCounters()
+	err = CopyDir(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	r.CheckRemoteItems(t, file1b, file2)
+	assert.Equal(t, int64(1), accounting.GlobalStats().GetTransfers())
+}
+
 // Test with BackupDir set
 func testSyncBackupDir(t *testing.T, backupDir string, suffix string, suffixKeepExtension bool) {
 	ctx := context.Background()
@@ -5,12 +5,14 @@ package fs
 
 import (
 	"context"
+	"crypto/md5"
 	"encoding/json"
 	"io"
 	"math"
 	"time"
 
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/ranges"
 )
 
 // Fs is the interface a cloud storage system must provide
@@ -211,6 +213,47 @@ type SetMetadataer interface {
 	SetMetadata(ctx context.Context, metadata Metadata) error
 }
 
+// DataRanger is an optional interface for Object
+type DataRanger interface {
+	// DataRanges returns the parts of the object which contain data
+	// in order. The rest of the object is holes which read as zeros.
+	//
+	// It may return the whole object if it can't find the holes.
+	DataRanges(ctx context.Context) (ranges.Ranges, error)
+}
+
+// Patcher is an optional interface for Object
+type Patcher interface {
+	// Patch opens the object for changing in place with WriteAt
+	// without truncating it first. When the returned writer is
+	// closed the object is truncated or extended to size.
+	//
+	// The object info isn't updated - use NewObject to read it
+	// again afterwards.
+	Patch(ctx context.Context, size int64) (WriterAtCloser, error)
+}
+
+// PatchCopier is an optional interface for Object
+type PatchCopier interface {
+	// PatchCopy copies the object to remote on the same Fs
+	// without transferring its data. The copy must be a separate
+	// file, not a link to the object, as it will be changed with
+	// Patch.
+	//
+	// It should return ErrorCantCopy if the remote can't do this.
+	PatchCopy(ctx context.Context, remote string) (Object, error)
+}
+
+// BlockHasher is an optional interface for Object
+type BlockHasher interface {
+	// BlockHashes returns the MD5 hash of each blockSize block of
+	// the object in order, calculated by the remote.
+	//
+	// It should return ErrorNotImplemented if the remote can't
+	// calculate them.
+	BlockHashes(ctx context.Context, blockSize int64) ([][md5.Size]byte, error)
+}
+
 // SetModTimer is an optional interface for Directory.
 //
 // Object implements this as part of its requires set of interfaces.
@@ -366,6 +409,16 @@ type WriterAtCloser interface {
 	io.Closer
 }
 
+// HoleWriterAt is an optional interface for WriterAtCloser
+type HoleWriterAt interface {
+	// WriteHole records that size bytes at off are a hole which
+	// reads as zeros instead of writing them.
+	//
+	// It should only be used on parts of the file which haven't
+	// been written yet.
+	WriteHole(off, size int64) error
+}
+
 type unknownFs struct{}
 
 // Name of the remote (as passed into NewFs)
@@ -0,0 +1,342 @@
+// Package delta implements the rsync algorithm for finding the
+// differences between an old and a new version of a file.
+//
+// The old file is summarised as a Signature holding a weak rolling
+// checksum and a strong MD5 hash of each block. The new file is then
+// read and compared against the Signature making a list of Ops which
+// say which blocks of the old file can be reused and which data has
+// to be sent.
+package delta
+
+import (
+	"bufio"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Block is the signature of one block of the old file
+type Block struct {
+	Weak   uint32         // rolling checksum of the block if Signature.Weak is set
+	Strong [md5.Size]byte // MD5 hash of the block
+}
+
+// Signature describes the blocks of the old file
+type Signature struct {
+	BlockSize int64   // size of each block - the last may be shorter
+	Size      int64   // size of the old file
+	Weak      bool    // set if the weak checksums in Blocks are valid
+	Blocks    []Block // the blocks of the old file in order
+}
+
+// numBlocks returns the number of blockSize blocks in size bytes
+func numBlocks(size, blockSize int64) int {
+	return int((size + blockSize - 1) / blockSize)
+}
+
+// NewSignature reads the old file of size bytes from in and makes
+// its Signature with both weak and strong checksums.
+func NewSignature(in io.Reader, size, blockSize int64) (*Signature, error) {
+	if blockSize <= 0 {
+		return nil, errors.New("block size must be positive")
+	}
+	sig := &Signature{
+		BlockSize: blockSize,
+		Size:      size,
+		Weak:      true,
+		Blocks:    make([]Block, 0, numBlocks(size, blockSize)),
+	}
+	buf := make([]byte, blockSize)
+	for pos := int64(0); pos < size; pos += blockSize {
+		p := buf[:min(blockSize, size-pos)]
+		_, err := io.ReadFull(in, p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read block at %d: %w", pos, err)
+		}
+		a, b := weakSum(p)
+		sig.Blocks = append(sig.Blocks, Block{
+			Weak:   weak(a, b),
+			Strong: md5.Sum(p),
+		})
+	}
+	return sig, nil
+}
+
+// NewStrongSignature makes the Signature of an old file of size
+// bytes from the MD5 hashes of its blocks only.
+//
+// Without the weak checksums blocks can only be found in the new
+// file at multiples of blockSize.
+func NewStrongSignature(size, blockSize int64, hashes [][md5.Size]byte) (*Signature, error) {
+	if blockSize <= 0 {
+		return nil, errors.New("block size must be positive")
+	}
+	if n := numBlocks(size, blockSize); len(hashes) != n {
+		return nil, fmt.Errorf("expecting %d block hashes but got %d", n, len(hashes))
+	}
+	sig := &Signature{
+		BlockSize: blockSize,
+		Size:      size,
+		Blocks:    make([]Block, len(hashes)),
+	}
+	for i, hash := range hashes {
+		sig.Blocks[i].Strong = hash
+	}
+	return sig, nil
+}
+
+// blockLen returns the size of block i
+func (sig *Signature) blockLen(i int) int64 {
+	return min(sig.BlockSize, sig.Size-int64(i)*sig.BlockSize)
+}
+
+// weakSum returns the two halves of the rsync rolling checksum of p
+func weakSum(p []byte) (a, b uint32) {
+	n := uint32(len(p))
+	for i, c := range p {
+		a += uint32(c)
+		b += (n - uint32(i)) * uint32(c)
+	}
+	return a & 0xffff, b & 0xffff
+}
+
+// roll the checksum of an n byte window along by one byte removing
+// out and adding in
+func roll(a, b uint32, n int, out, in byte) (uint32, uint32) {
+	a = (a - uint32(out) + uint32(in)) & 0xffff
+	b = (b - uint32(n)*uint32(out) + a) & 0xffff
+	return a, b
+}
+
+// weak returns the rolling checksum from its two halves
+func weak(a, b uint32) uint32 {
+	return a | b<<16
+}
+
+// Op is an instruction for making the new file
+type Op struct {
+	Pos   int64  // position in the new file
+	Size  int64  // number of bytes
+	Block int    // index of the block of the old file to use or -1 to use Data
+	Data  []byte // data from the new file if Block < 0 - only valid until the callback returns
+}
+
+// differ holds the state while comparing the new file with the old
+type differ struct {
+	sig    *Signature
+	moved  bool                     // set if blocks can be used at other positions
+	fn     func(Op) error           // called with each Op
+	blocks map[uint32][]int         // weak checksum to blocks if sig.Weak
+	hashes map[[md5.Size]byte][]int // strong hash to blocks if !sig.Weak
+	pos    int64                    // position in the new file of lit
+	lit    []byte                   // pending data from the new file
+}
+
+// Diff reads the new file from in and calls fn with the Ops needed
+// to make it from the old file described by sig in order of Pos.
+//
+// The Ops can be applied to the old file in place as a block is only
+// used at or before its position in the old file, so it is read
+// before anything is written over it. If moved is false blocks are
+// only used at their own position.
+func Diff(in io.Reader, sig *Signature, moved bool, fn func(Op) error) error {
+	d := &differ{
+		sig:   sig,
+		moved: moved,
+		fn:    fn,
+		lit:   make([]byte, 0, sig.BlockSize),
+	}
+	if sig.Weak {
+		d.blocks = make(map[uint32][]int, len(sig.Blocks))
+		for i, block := range sig.Blocks {
+			d.blocks[block.Weak] = append(d.blocks[block.Weak], i)
+		}
+		return d.rolling(bufio.NewReaderSize(in, 64*1024))
+	}
+	d.hashes = make(map[[md5.Size]byte][]int, len(sig.Blocks))
+	for i, block := range sig.Blocks {
+		d.hashes[block.Strong] = append(d.hashes[block.Strong], i)
+	}
+	return d.aligned(in)
+}
+
+// flush sends any pending data from the new file
+func (d *differ) flush() error {
+	if len(d.lit) == 0 {
+		return nil
+	}
+	err := d.fn(Op{
+		Pos:   d.pos,
+		Size:  int64(len(d.lit)),
+		Block: -1,
+		Data:  d.lit,
+	})
+	d.pos += int64(len(d.lit))
+	d.lit = d.lit[:0]
+	return err
+}
+
+// literal adds p to the pending data from the new file sending it
+// if there is a block's worth
+func (d *differ) literal(p ...byte) error {
+	for len(p) > 0 {
+		n := min(len(p), cap(d.lit)-len(d.lit))
+		d.lit = append(d.lit, p[:n]...)
+		p = p[n:]
+		if len(d.lit) == cap(d.lit) {
+			err := d.flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// use sends block i of the old file for the next part of the new file
+func (d *differ) use(i int) error {
+	err := d.flush()
+	if err != nil {
+		return err
+	}
+	size := d.sig.blockLen(i)
+	err = d.fn(Op{
+		Pos:   d.pos,
+		Size:  size,
+		Block: i,
+	})
+	d.pos += size
+	return err
+}
+
+// allowed returns true if block i of the old file may be used at pos
+func (d *differ) allowed(i int, pos int64) bool {
+	blockPos := int64(i) * d.sig.BlockSize
+	return blockPos == pos || (d.moved && blockPos > pos)
+}
+
+// match returns the block out of candidates which matches p at the
+// end of the pending data or -1 if none do
+//
+// sum is the MD5 hash of p if known.
+func (d *differ) match(candidates []int, p []byte, sum *[md5.Size]byte) int {
+	pos := d.pos + int64(len(d.lit))
+	found := -1
+	for _, i := range candidates {
+		if !d.allowed(i, pos) || d.sig.blockLen(i) != int64(len(p)) {
+			continue
+		}
+		if sum == nil {
+			hash := md5.Sum(p)
+			sum = &hash
+		}
+		if d.sig.Blocks[i].Strong != *sum {
+			continue
+		}
+		// Prefer the block at the same position as it doesn't need writing
+		if int64(i)*d.sig.BlockSize == pos {
+			return i
+		}
+		if found < 0 {
+			found = i
+		}
+	}
+	return found
+}
+
+// tail deals with the last part of the new file which is shorter
+// than a block and sends any pending data
+func (d *differ) tail(p []byte) error {
+	if len(p) > 0 {
+		last := len(d.sig.Blocks) - 1
+		if last >= 0 && d.match([]int{last}, p, nil) >= 0 {
+			err := d.use(last)
+			if err != nil {
+				return err
+			}
+		} else {
+			err := d.literal(p...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return d.flush()
+}
+
+// rolling compares the new file with the old using the rolling
+// checksum to find blocks at any position
+func (d *differ) rolling(in *bufio.Reader) error {
+	bs := int(d.sig.BlockSize)
+	buf := make([]byte, 2*bs)
+	for {
+		// Fill the window with a whole block
+		n, err := io.ReadFull(in, buf[:bs])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return d.tail(buf[:n])
+		} else if err != nil {
+			return err
+		}
+		start, end := 0, bs
+		a, b := weakSum(buf[start:end])
+		for {
+			window := buf[start:end]
+			if i := d.match(d.blocks[weak(a, b)], window, nil); i >= 0 {
+				err = d.use(i)
+				if err != nil {
+					return err
+				}
+				break
+			}
+			// Slide the window along by a byte
+			c, err := in.ReadByte()
+			if err == io.EOF {
+				err = d.literal(window...)
+				if err != nil {
+					return err
+				}
+				return d.flush()
+			} else if err != nil {
+				return err
+			}
+			out := buf[start]
+			err = d.literal(out)
+			if err != nil {
+				return err
+			}
+			start++
+			if end == len(buf) {
+				copy(buf, buf[start:end])
+				end -= start
+				start = 0
+			}
+			buf[end] = c
+			end++
+			a, b = roll(a, b, bs, out, c)
+		}
+	}
+}
+
+// aligned compares the new file with the old a block at a time using
+// only the strong hashes
+func (d *differ) aligned(in io.Reader) error {
+	buf := make([]byte, d.sig.BlockSize)
+	for {
+		n, err := io.ReadFull(in, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return d.tail(buf[:n])
+		} else if err != nil {
+			return err
+		}
+		sum := md5.Sum(buf)
+		if i := d.match(d.hashes[sum], buf, &sum); i >= 0 {
+			err = d.use(i)
+		} else {
+			err = d.literal(buf...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
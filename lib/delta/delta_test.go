@@ -0,0 +1,169 @@
+package delta
+
+import (
+	"bytes"
+	"crypto/md5"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBlockSize = 16
+
+// randomData returns n bytes of random data from a fixed seed
+func randomData(seed int64, n int) []byte {
+	p := make([]byte, n)
+	_, _ = rand.New(rand.NewSource(seed)).Read(p)
+	return p
+}
+
+// patch applies the delta from oldData to newData in place on a copy
+// of oldData returning the result and the number of bytes sent
+func patch(t *testing.T, sig *Signature, oldData, newData []byte, moved bool) (result []byte, sent int64) {
+	result = bytes.Clone(oldData)
+	var pos int64
+	err := Diff(bytes.NewReader(newData), sig, moved, func(op Op) error {
+		assert.Equal(t, pos, op.Pos, "ops out of order")
+		pos += op.Size
+		if end := int(op.Pos + op.Size); end > len(result) {
+			result = append(result, make([]byte, end-len(result))...)
+		}
+		if op.Block < 0 {
+			assert.Equal(t, int64(len(op.Data)), op.Size)
+			sent += op.Size
+			copy(result[op.Pos:], op.Data)
+			return nil
+		}
+		blockPos := int64(op.Block) * sig.BlockSize
+		if !moved {
+			assert.Equal(t, op.Pos, blockPos, "block moved")
+		}
+		assert.GreaterOrEqual(t, blockPos, op.Pos, "block used after it was overwritten")
+		copy(result[op.Pos:], bytes.Clone(result[blockPos:blockPos+op.Size]))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(newData)), pos)
+	return result[:len(newData)], sent
+}
+
+func TestWeakRoll(t *testing.T) {
+	p := randomData(1, 100)
+	a, b := weakSum(p[:testBlockSize])
+	for i := 1; i+testBlockSize <= len(p); i++ {
+		a, b = roll(a, b, testBlockSize, p[i-1], p[i+testBlockSize-1])
+		wantA, wantB := weakSum(p[i : i+testBlockSize])
+		require.Equal(t, wantA, a, i)
+		require.Equal(t, wantB, b, i)
+	}
+}
+
+func TestNewSignature(t *testing.T) {
+	old := randomData(1, 40)
+	sig, err := NewSignature(bytes.NewReader(old), int64(len(old)), testBlockSize)
+	require.NoError(t, err)
+	assert.True(t, sig.Weak)
+	require.Len(t, sig.Blocks, 3)
+	assert.Equal(t, md5.Sum(old[32:]), sig.Blocks[2].Strong)
+	assert.Equal(t, int64(8), sig.blockLen(2))
+
+	_, err = NewSignature(bytes.NewReader(old[:30]), int64(len(old)), testBlockSize)
+	assert.Error(t, err)
+
+	_, err = NewStrongSignature(40, testBlockSize, make([][md5.Size]byte, 2))
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	old := randomData(1, 200)
+	insert := randomData(2, 5)
+	for _, test := range []struct {
+		name      string
+		new       []byte
+		sent      int64 // bytes sent with moved blocks
+		sentFixed int64 // bytes sent without moved blocks
+	}{{
+		name: "same",
+		new:  old,
+	}, {
+		name:      "empty",
+		new:       []byte{},
+		sent:      0,
+		sentFixed: 0,
+	}, {
+		name:      "changed byte",
+		new:       append(append(bytes.Clone(old[:50]), 'x'), old[51:]...),
+		sent:      testBlockSize,
+		sentFixed: testBlockSize,
+	}, {
+		name:      "appended",
+		new:       append(bytes.Clone(old), insert...),
+		sent:      8 + 5,
+		sentFixed: 8 + 5,
+	}, {
+		name:      "truncated",
+		new:       old[:100],
+		sent:      4,
+		sentFixed: 4,
+	}, {
+		name:      "cut from start",
+		new:       old[testBlockSize*2:],
+		sent:      0,
+		sentFixed: 200 - testBlockSize*2,
+	}, {
+		name:      "inserted at start",
+		new:       append(bytes.Clone(insert), old...),
+		sent:      200 + 5,
+		sentFixed: 200 + 5,
+	}, {
+		name:      "random",
+		new:       randomData(3, 150),
+		sent:      150,
+		sentFixed: 150,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			sig, err := NewSignature(bytes.NewReader(old), int64(len(old)), testBlockSize)
+			require.NoError(t, err)
+
+			got, sent := patch(t, sig, old, test.new, true)
+			assert.Equal(t, test.new, got)
+			assert.Equal(t, test.sent, sent)
+
+			got, sent = patch(t, sig, old, test.new, false)
+			assert.Equal(t, test.new, got)
+			assert.Equal(t, test.sentFixed, sent)
+		})
+	}
+}
+
+func TestDiffStrong(t *testing.T) {
+	old := randomData(1, 200)
+	var hashes [][md5.Size]byte
+	for pos := 0; pos < len(old); pos += testBlockSize {
+		hashes = append(hashes, md5.Sum(old[pos:min(pos+testBlockSize, len(old))]))
+	}
+	sig, err := NewStrongSignature(int64(len(old)), testBlockSize, hashes)
+	require.NoError(t, err)
+	assert.False(t, sig.Weak)
+
+	// Changed blocks are found at their own positions
+	changed := bytes.Clone(old)
+	changed[100] ^= 0xff
+	got, sent := patch(t, sig, old, changed, false)
+	assert.Equal(t, changed, got)
+	assert.Equal(t, int64(testBlockSize), sent)
+
+	// Blocks which have moved by a whole block are found
+	cut := old[testBlockSize:]
+	got, sent = patch(t, sig, old, cut, true)
+	assert.Equal(t, cut, got)
+	assert.Equal(t, int64(0), sent)
+
+	// But blocks which have moved by part of a block aren't
+	inserted := append([]byte{1}, old...)
+	got, sent = patch(t, sig, old, inserted, true)
+	assert.Equal(t, inserted, got)
+	assert.Equal(t, int64(len(inserted)), sent)
+}
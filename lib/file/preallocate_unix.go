@@ -70,3 +70,21 @@ const SetSparseImplemented = false
 func SetSparse(out *os.File) error {
 	return nil
 }
+
+// PunchHoleImplemented is a constant indicating whether the
+// implementation of PunchHole actually does anything.
+const PunchHoleImplemented = true
+
+// PunchHole frees the space used by size bytes at off leaving a hole
+// which reads as zeros. The size of the file isn't changed.
+func PunchHole(out *os.File, off, size int64) (err error) {
+	if size <= 0 {
+		return nil
+	}
+	for {
+		err = unix.Fallocate(int(out.Fd()), unix.FALLOC_FL_KEEP_SIZE|unix.FALLOC_FL_PUNCH_HOLE, off, size)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
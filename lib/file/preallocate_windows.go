@@ -103,3 +103,13 @@ func SetSparse(out *os.File) error {
 	}
 	return nil
 }
+
+// PunchHoleImplemented is a constant indicating whether the
+// implementation of PunchHole actually does anything.
+const PunchHoleImplemented = false
+
+// PunchHole frees the space used by size bytes at off leaving a hole
+// which reads as zeros. The size of the file isn't changed.
+func PunchHole(out *os.File, off, size int64) error {
+	return nil
+}
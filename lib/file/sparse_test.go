@@ -0,0 +1,85 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/lib/ranges"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeSparseFile makes a file of size with "data" written at each of
+// offsets and holes everywhere else
+func makeSparseFile(t *testing.T, size int64, offsets ...int64) *os.File {
+	f, err := os.Create(filepath.Join(t.TempDir(), "sparse"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = f.Close()
+	})
+	require.NoError(t, f.Truncate(size))
+	for _, off := range offsets {
+		_, err = f.WriteAt([]byte("data"), off)
+		require.NoError(t, err)
+	}
+	return f
+}
+
+func TestDataRanges(t *testing.T) {
+	const size = 4 << 20
+	f := makeSparseFile(t, size, 0, 3<<20)
+
+	rs, err := DataRanges(f, size)
+	require.NoError(t, err)
+	// The data must be covered whether or not holes are found
+	assert.True(t, rs.Present(ranges.Range{Pos: 0, Size: 4}))
+	assert.True(t, rs.Present(ranges.Range{Pos: 3 << 20, Size: 4}))
+	if !DataRangesImplemented {
+		assert.Equal(t, ranges.Ranges{{Pos: 0, Size: size}}, rs)
+		return
+	}
+	if rs.Size() == size {
+		t.Skip("filesystem doesn't report holes")
+	}
+	assert.False(t, rs.Present(ranges.Range{Pos: 1 << 20, Size: 1 << 20}))
+	assert.LessOrEqual(t, rs[len(rs)-1].End(), int64(size))
+
+	// Empty files have no data
+	rs, err = DataRanges(makeSparseFile(t, 0), 0)
+	require.NoError(t, err)
+	assert.Empty(t, rs)
+
+	// Files which are all hole have no data
+	rs, err = DataRanges(makeSparseFile(t, size), size)
+	require.NoError(t, err)
+	assert.Empty(t, rs)
+}
+
+func TestPunchHole(t *testing.T) {
+	const size = 4 << 20
+	f := makeSparseFile(t, size)
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = 1
+	}
+	_, err := f.WriteAt(data, 0)
+	require.NoError(t, err)
+
+	err = PunchHole(f, 1<<20, 1<<20)
+	if !PunchHoleImplemented {
+		require.NoError(t, err)
+		return
+	}
+	if err != nil {
+		t.Skipf("filesystem doesn't support punching holes: %v", err)
+	}
+	got := make([]byte, size)
+	_, err = f.ReadAt(got, 0)
+	require.NoError(t, err)
+	clear(data[1<<20 : 2<<20])
+	assert.Equal(t, data, got)
+	fi, err := f.Stat()
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), fi.Size())
+}
@@ -0,0 +1,48 @@
+//go:build linux || darwin || freebsd
+
+package file
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	"github.com/rclone/rclone/lib/ranges"
+	"golang.org/x/sys/unix"
+)
+
+// DataRangesImplemented is a constant indicating whether the
+// implementation of DataRanges actually finds holes.
+const DataRangesImplemented = true
+
+// DataRanges returns the parts of the first size bytes of the file
+// which contain data in order. The rest of the file is holes which
+// read as zeros.
+//
+// This uses the file offset so the file shouldn't be in use.
+func DataRanges(f *os.File, size int64) (rs ranges.Ranges, err error) {
+	var pos int64
+	for pos < size {
+		start, err := f.Seek(pos, unix.SEEK_DATA)
+		if errors.Is(err, syscall.ENXIO) {
+			// no more data
+			break
+		} else if errors.Is(err, syscall.EINVAL) && pos == 0 {
+			// filesystem doesn't support finding holes
+			return ranges.Ranges{{Pos: 0, Size: size}}, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if start >= size {
+			break
+		}
+		end, err := f.Seek(start, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, err
+		}
+		end = min(end, size)
+		rs = append(rs, ranges.Range{Pos: start, Size: end - start})
+		pos = end
+	}
+	return rs, nil
+}
@@ -21,6 +21,9 @@ const (
 	EROFS
 	ENOSYS
 	ELOOP
+	ENOATTR
+	ENOTSUP
+	ENOSPC
 )
 
 // Errors which have exact counterparts in os
@@ -40,6 +43,9 @@ var errorNames = []string{
 	EROFS:     "Read only file system",
 	ENOSYS:    "Function not implemented",
 	ELOOP:     "Too many symbolic links",
+	ENOATTR:   "Attribute not found",
+	ENOTSUP:   "Operation not supported",
+	ENOSPC:    "No space left on device",
 }
 
 // Error renders the error as a string
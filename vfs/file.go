@@ -54,6 +54,7 @@ type File struct {
 	writers          []Handle                        // writers for this file
 	virtualModTime   *time.Time                      // modtime for backends with Precision == fs.ModTimeNotSupported
 	pendingModTime   time.Time                       // will be applied once o becomes available, i.e. after file was written
+	pendingMetadata  fs.Metadata                     // extended attributes to apply once o becomes available
 	pendingRenameFun func(ctx context.Context) error // will be run/renamed after all writers close
 	sys              atomic.Value                    // user defined info to be attached here
 	nwriters         atomic.Int32                    // len(writers)
@@ -546,6 +547,7 @@ func (f *File) setObject(o fs.Object) {
 	f.o = o
 	f._setIsLink()
 	_ = f._applyPendingModTime()
+	_ = f._applyPendingMetadata()
 	d := f.d
 	f.mu.Unlock()
 
@@ -674,6 +676,7 @@ func (f *File) Remove() (err error) {
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
+	size := f.Size()
 
 	// Remove the object from the cache
 	wasWriting := false
@@ -702,6 +705,7 @@ func (f *File) Remove() (err error) {
 	// called with File.mu released when there is no error removing the underlying file
 	if err == nil {
 		d.delObject(f.Name())
+		d.vfs.quotaFree(size)
 	}
 	return err
 }
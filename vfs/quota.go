@@ -0,0 +1,222 @@
+// Enforce --vfs-quota
+
+package vfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// quotaState is the space used against a quota
+//
+// It is shared by all the VFS with the same quota key, so a user
+// served through several VFS has their files counted once rather
+// than getting a whole quota for each VFS.
+type quotaState struct {
+	listMu  sync.Mutex // held while listing the remote
+	mu      sync.Mutex // protects the fields below
+	time    time.Time  // time the used space was last listed
+	listed  int64      // used space found in the last listing
+	pending int64      // change in used space since the last listing
+	refs    int        // number of VFS using this - protected by quotaStatesMu
+}
+
+// Quota states in use keyed on the quota key
+var (
+	quotaStatesMu sync.Mutex
+	quotaStates   = map[string]*quotaState{}
+)
+
+// getQuotaState returns the quota state for key making it if necessary
+//
+// Call putQuotaState when finished with it.
+func getQuotaState(key string) *quotaState {
+	quotaStatesMu.Lock()
+	defer quotaStatesMu.Unlock()
+	q := quotaStates[key]
+	if q == nil {
+		q = new(quotaState)
+		quotaStates[key] = q
+	}
+	q.refs++
+	return q
+}
+
+// putQuotaState releases the quota state for key, removing it when it
+// is no longer in use so the remote is listed again if it is needed.
+func putQuotaState(key string) {
+	quotaStatesMu.Lock()
+	defer quotaStatesMu.Unlock()
+	q := quotaStates[key]
+	if q == nil {
+		return
+	}
+	q.refs--
+	if q.refs <= 0 {
+		delete(quotaStates, key)
+	}
+}
+
+// quotaEnabled returns true if the VFS has a quota set
+func (vfs *VFS) quotaEnabled() bool {
+	return vfs.Opt.Quota >= 0
+}
+
+// SetQuotaKey sets the key the space used against --vfs-quota is
+// shared under.
+//
+// All the VFS with the same key share the space used, so this should
+// be set to something identifying the owner of the files, such as the
+// user name, when several VFS serve the files of the same user. By
+// default the key is the remote, so only VFS serving the same remote
+// share the space used.
+//
+// This should be called before the VFS is used.
+func (vfs *VFS) SetQuotaKey(key string) {
+	vfs.quotaMu.Lock()
+	defer vfs.quotaMu.Unlock()
+	vfs._releaseQuota()
+	vfs.quotaKey = key
+}
+
+// _quotaKey returns the key the quota is shared under
+//
+// Call with quotaMu held
+func (vfs *VFS) _quotaKey() string {
+	if vfs.quotaKey == "" {
+		return fs.ConfigString(vfs.f)
+	}
+	return vfs.quotaKey
+}
+
+// quotaState returns the state of the quota of this VFS
+func (vfs *VFS) quotaState() *quotaState {
+	vfs.quotaMu.Lock()
+	defer vfs.quotaMu.Unlock()
+	if vfs.quota == nil {
+		vfs.quota = getQuotaState(vfs._quotaKey())
+	}
+	return vfs.quota
+}
+
+// _releaseQuota stops using the quota state
+//
+// Call with quotaMu held
+func (vfs *VFS) _releaseQuota() {
+	if vfs.quota != nil {
+		putQuotaState(vfs._quotaKey())
+		vfs.quota = nil
+	}
+}
+
+// releaseQuota stops using the quota state
+func (vfs *VFS) releaseQuota() {
+	vfs.quotaMu.Lock()
+	defer vfs.quotaMu.Unlock()
+	vfs._releaseQuota()
+}
+
+// _stale returns true if the used space needs listing again
+//
+// Call with q.mu held
+func (q *quotaState) _stale(maxAge time.Duration) bool {
+	return q.time.IsZero() || time.Since(q.time) >= maxAge
+}
+
+// refresh lists the remote to find the used space if the last
+// listing is older than the directory cache time.
+//
+// The listing is done without q.mu held so it doesn't hold up
+// changes to the space used. Any changes made while listing are kept
+// as they may not have been included in the listing.
+func (q *quotaState) refresh(vfs *VFS) {
+	maxAge := time.Duration(vfs.Opt.DirCacheTime)
+	q.mu.Lock()
+	stale := q._stale(maxAge)
+	q.mu.Unlock()
+	if !stale {
+		return
+	}
+
+	// Only one listing at a time
+	q.listMu.Lock()
+	defer q.listMu.Unlock()
+	q.mu.Lock()
+	stale = q._stale(maxAge)
+	pending := q.pending
+	q.mu.Unlock()
+	if !stale {
+		return
+	}
+
+	var used int64
+	err := walk.ListR(vfs.ctx, vfs.f, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(o fs.Object) {
+			used += o.Size()
+		})
+		return nil
+	})
+	if err != nil {
+		// Keep the old value and try again next time
+		fs.Errorf(vfs.f, "Failed to read used space for quota: %v", err)
+		return
+	}
+	q.mu.Lock()
+	q.listed = used
+	q.pending -= pending
+	q.time = time.Now()
+	q.mu.Unlock()
+}
+
+// _used returns the space used
+//
+// Call with q.mu held
+func (q *quotaState) _used() int64 {
+	return max(q.listed+q.pending, 0)
+}
+
+// quotaUsage returns the quota and the space used against it
+func (vfs *VFS) quotaUsage() (total, used int64) {
+	q := vfs.quotaState()
+	q.refresh(vfs)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(vfs.Opt.Quota), q._used()
+}
+
+// quotaGrow is called when a file being written grows to newSize
+//
+// charged is the size of the file which has been accounted for
+// already. If newSize is bigger the difference is taken from the
+// quota and charged is updated. It returns ENOSPC if there isn't
+// enough quota left.
+func (vfs *VFS) quotaGrow(charged *int64, newSize int64) error {
+	if !vfs.quotaEnabled() || newSize <= *charged {
+		return nil
+	}
+	q := vfs.quotaState()
+	q.refresh(vfs)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	extra := newSize - *charged
+	if q._used()+extra > int64(vfs.Opt.Quota) {
+		return ENOSPC
+	}
+	q.pending += extra
+	*charged = newSize
+	return nil
+}
+
+// quotaFree returns size bytes to the quota when a file is removed
+func (vfs *VFS) quotaFree(size int64) {
+	if !vfs.quotaEnabled() || size <= 0 {
+		return
+	}
+	q := vfs.quotaState()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending -= size
+}
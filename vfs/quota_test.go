@@ -0,0 +1,90 @@
+package vfs
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVFSQuota(t *testing.T) {
+	for _, cacheMode := range []vfscommon.CacheMode{vfscommon.CacheModeOff, vfscommon.CacheModeWrites} {
+		t.Run(cacheMode.String(), func(t *testing.T) {
+			opt := vfscommon.Opt
+			opt.CacheMode = cacheMode
+			opt.WriteBack = 0
+			opt.Quota = 100
+			_, vfs := newTestVFSOpt(t, &opt)
+
+			checkUsed := func(wantUsed int64) {
+				total, used, free := vfs.Statfs()
+				assert.Equal(t, int64(100), total)
+				assert.Equal(t, wantUsed, used)
+				assert.Equal(t, 100-wantUsed, free)
+			}
+			checkUsed(0)
+
+			require.NoError(t, vfs.WriteFile("a", []byte(strings.Repeat("a", 60)), 0666))
+			checkUsed(60)
+
+			// Going over the quota fails
+			err := vfs.WriteFile("b", []byte(strings.Repeat("b", 50)), 0666)
+			assert.Equal(t, ENOSPC, err)
+
+			// Overwriting only charges the growth of the file
+			require.NoError(t, vfs.WriteFile("a", []byte(strings.Repeat("a", 90)), 0666))
+			checkUsed(90)
+
+			// Removing a file gives the space back
+			require.NoError(t, vfs.Remove("a"))
+			checkUsed(0)
+			require.NoError(t, vfs.WriteFile("b", []byte(strings.Repeat("b", 50)), 0666))
+			checkUsed(50)
+		})
+	}
+}
+
+func TestVFSQuotaTruncate(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.CacheMode = vfscommon.CacheModeWrites
+	opt.Quota = 100
+	_, vfs := newTestVFSOpt(t, &opt)
+
+	fd, err := vfs.OpenFile("file", os.O_CREATE|os.O_RDWR, 0666)
+	require.NoError(t, err)
+	assert.Equal(t, ENOSPC, fd.Truncate(101))
+	require.NoError(t, fd.Truncate(100))
+	require.NoError(t, fd.Close())
+}
+
+func TestVFSQuotaShared(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.CacheMode = vfscommon.CacheModeOff
+	opt.Quota = 100
+	r, vfs := newTestVFSOpt(t, &opt)
+
+	// Another VFS of the same remote shares the space used
+	opt2 := opt
+	opt2.ReadOnly = true
+	vfs2 := New(context.Background(), r.Fremote, &opt2)
+	defer cleanupVFS(t, vfs2)
+	require.NotEqual(t, vfs, vfs2)
+	require.NoError(t, vfs.WriteFile("a", []byte(strings.Repeat("a", 60)), 0666))
+	_, used, _ := vfs2.Statfs()
+	assert.Equal(t, int64(60), used)
+
+	// As does a VFS of another remote with the same quota key
+	vfs.SetQuotaKey(t.Name())
+	_, used, _ = vfs.Statfs()
+	assert.Equal(t, int64(60), used)
+	other := New(context.Background(), r.Flocal, &opt)
+	defer cleanupVFS(t, other)
+	other.SetQuotaKey(t.Name())
+	require.NoError(t, other.WriteFile("b", []byte(strings.Repeat("b", 30)), 0666))
+	err := vfs.WriteFile("c", []byte(strings.Repeat("c", 20)), 0666)
+	assert.Equal(t, ENOSPC, err)
+}
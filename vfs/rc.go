@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -405,11 +406,19 @@ This returns stats for the selected VFS.
         "diskCache": {
             "bytesUsed": 0,
             "erroredFiles": 0,
+            "evictedBytes": 0,     // bytes freed by evicting files
+            "evictionPolicy": "lru",
+            "evictions": 0,        // number of files evicted
             "files": 0,
             "hashType": 1,
+            "hitBytes": 0,         // bytes read from the cache
+            "hits": 0,             // reads served from the cache
+            "missBytes": 0,        // bytes read which needed a download
+            "misses": 0,           // reads which needed a download
             "outOfSpace": false,
             "path": "/home/user/.cache/rclone/vfs/local/mnt/a",
             "pathMeta": "/home/user/.cache/rclone/vfsMeta/local/mnt/a",
+            "pinned": 0,           // number of pinned directories
             "uploadsInProgress": 0,
             "uploadsQueued": 0
         },
@@ -557,3 +566,160 @@ func rcQueueSetExpiry(ctx context.Context, in rc.Params) (out rc.Params, err err
 	err = vfs.cache.QueueSetExpiry(writeback.Handle(id), refTime, time.Duration(float64(time.Second)*expiry))
 	return nil, err
 }
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vfs/pin",
+		Title: "Pin directories so they are kept in the VFS cache.",
+		Help: strings.ReplaceAll(`
+This marks directories as pinned. Everything in a pinned directory is
+downloaded into the VFS cache in the background, refreshed when it
+changes on the remote and never evicted from the cache.
+
+This needs |--vfs-cache-mode full|. The pinned directories are
+remembered across restarts.
+
+Pass directories in as dir=path. Any parameter key starting with dir
+will pin that directory, e.g.
+
+    rclone rc vfs/pin dir=home/junk dir2=data/misc
+
+Pass dir="" to pin everything.
+
+This returns the directories pinned
+
+    {
+        "pinned": [ "data/misc", "home/junk" ]
+    }
+`, "|", "`") + getVFSHelp,
+		Fn: rcPin,
+	})
+}
+
+// getPinDirs returns the directories passed in as dir=path
+func getPinDirs(in rc.Params) (dirs []string, err error) {
+	for k, v := range in {
+		dir, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("value must be string %q=%v", k, v)
+		}
+		if !strings.HasPrefix(k, "dir") {
+			return nil, fmt.Errorf("unknown key %q", k)
+		}
+		dirs = append(dirs, strings.Trim(dir, "/"))
+	}
+	if len(dirs) == 0 {
+		return nil, rc.NewErrParamInvalid(errors.New("need at least one dir parameter"))
+	}
+	slices.Sort(dirs)
+	return dirs, nil
+}
+
+func rcPin(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	vfs, err := getVFS(in)
+	if err != nil {
+		return nil, err
+	}
+	if vfs.cache == nil {
+		return nil, rc.NewErrParamInvalid(errors.New("can't call this unless using the VFS cache"))
+	}
+	dirs, err := getPinDirs(in)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if err = vfs.cache.Pin(dir); err != nil {
+			return nil, err
+		}
+	}
+	return rc.Params{
+		"pinned": dirs,
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vfs/unpin",
+		Title: "Unpin directories from the VFS cache.",
+		Help: strings.ReplaceAll(`
+This removes the pin from directories pinned with |vfs/pin|. The files
+stay in the VFS cache but may be evicted from it in the normal way.
+
+Pass directories in as dir=path. Any parameter key starting with dir
+will unpin that directory, e.g.
+
+    rclone rc vfs/unpin dir=home/junk dir2=data/misc
+
+It is an error to unpin a directory which isn't pinned.
+
+This returns the directories unpinned
+
+    {
+        "unpinned": [ "data/misc", "home/junk" ]
+    }
+`, "|", "`") + getVFSHelp,
+		Fn: rcUnpin,
+	})
+}
+
+func rcUnpin(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	vfs, err := getVFS(in)
+	if err != nil {
+		return nil, err
+	}
+	if vfs.cache == nil {
+		return nil, rc.NewErrParamInvalid(errors.New("can't call this unless using the VFS cache"))
+	}
+	dirs, err := getPinDirs(in)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if err = vfs.cache.Unpin(dir); err != nil {
+			return nil, err
+		}
+	}
+	return rc.Params{
+		"unpinned": dirs,
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vfs/pins",
+		Title: "List the pinned directories in the VFS cache.",
+		Help: strings.ReplaceAll(`
+This lists the directories pinned with |vfs/pin| along with the
+status of the last time they were synced into the cache.
+
+    {
+        "pins": [
+            {
+                "dir":    "home/junk",            // string: the pinned directory
+                "files":  12,                     // integer: number of files found at the last sync
+                "size":   123456,                 // integer: total size of those files in bytes
+                "synced": "2024-01-02T15:04:05Z", // time: when the last sync finished - zero if never
+                "error":  "",                     // string: error from the last sync if any
+                "active": false                   // boolean: true if a sync is in progress
+            }
+        ]
+    }
+
+If called with |--vfs-cache-mode| off it will return an empty result.
+`, "|", "`") + getVFSHelp,
+		Fn: rcPins,
+	})
+}
+
+func rcPins(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	vfs, err := getVFS(in)
+	if err != nil {
+		return nil, err
+	}
+	if vfs.cache == nil {
+		return nil, nil
+	}
+	return rc.Params{
+		"pins": vfs.cache.Pins(),
+	}, nil
+}
@@ -3,10 +3,12 @@ package vfs
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/vfs/vfscache"
 	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -125,3 +127,43 @@ func TestRcStats(t *testing.T) {
 	assert.Equal(t, 1, out["metadataCache"].(rc.Params)["dirs"])
 	assert.Equal(t, vfs.Opt, out["opt"].(vfscommon.Options))
 }
+
+func TestRcPin(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping test on non local remote")
+	}
+	opt := vfscommon.Opt
+	opt.CacheMode = vfscommon.CacheModeFull
+	r, vfs := newTestVFSOpt(t, &opt)
+	r.WriteObject(context.Background(), "dir/file", "hello", time.Now())
+	fsString := fs.ConfigString(r.Fremote)
+
+	pin := rc.Calls.Get("vfs/pin")
+	unpin := rc.Calls.Get("vfs/unpin")
+	pins := rc.Calls.Get("vfs/pins")
+
+	_, err := pin.Fn(context.Background(), rc.Params{"fs": fsString})
+	require.Error(t, err)
+	_, err = pin.Fn(context.Background(), rc.Params{"fs": fsString, "potato": "dir"})
+	require.Error(t, err)
+
+	out, err := pin.Fn(context.Background(), rc.Params{"fs": fsString, "dir": "/dir/"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"pinned": []string{"dir"}}, out)
+	assert.Eventually(t, func() bool {
+		return vfs.cache.Exists("dir/file") && !vfs.cache.Pins()[0].Synced.IsZero()
+	}, 10*time.Second, 10*time.Millisecond)
+
+	out, err = pins.Fn(context.Background(), rc.Params{"fs": fsString})
+	require.NoError(t, err)
+	got := out["pins"].([]vfscache.PinStatus)
+	require.Len(t, got, 1)
+	assert.Equal(t, "dir", got[0].Dir)
+	assert.Equal(t, 1, got[0].Files)
+
+	out, err = unpin.Fn(context.Background(), rc.Params{"fs": fsString, "dir": "dir"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"unpinned": []string{"dir"}}, out)
+	_, err = unpin.Fn(context.Background(), rc.Params{"fs": fsString, "dir": "dir"})
+	require.Error(t, err)
+}
@@ -27,7 +27,8 @@ type RWFileHandle struct {
 	offset      int64 // file pointer offset
 	closed      bool  // set if handle has been closed
 	opened      bool
-	writeCalled bool // if any Write() methods have been called
+	writeCalled bool  // if any Write() methods have been called
+	quotaSize   int64 // size of the file charged to the quota
 }
 
 // Lock performs Unix locking, not supported
@@ -58,6 +59,9 @@ func newRWFileHandle(d *Dir, f *File, flags int) (fh *RWFileHandle, err error) {
 		flags: flags,
 		item:  item,
 	}
+	if exists {
+		fh.quotaSize = f.Size() // the old contents are replaced if truncated
+	}
 
 	// truncate immediately if O_TRUNC is set or O_CREATE is set and file doesn't exist
 	if !fh.readOnly() && (fh.flags&os.O_TRUNC != 0 || (fh.flags&os.O_CREATE != 0 && !exists)) {
@@ -105,6 +109,7 @@ func (fh *RWFileHandle) openPending() (err error) {
 	}
 
 	size := fh._size() // update size in file and read size
+	fh.quotaSize = max(fh.quotaSize, size)
 	if fh.flags&os.O_APPEND != 0 {
 		fh.offset = size
 		fs.Debugf(fh.logPrefix(), "open at offset %d", fh.offset)
@@ -168,8 +173,9 @@ func (fh *RWFileHandle) close() (err error) {
 		err = fh.item.Close(fh.file.setObject)
 		fh.opened = false
 	} else {
-		// apply any pending mod times if any
+		// apply any pending mod times and metadata if any
 		_ = fh.file.applyPendingModTime()
+		_ = fh.file.applyPendingMetadata()
 	}
 
 	if !fh.readOnly() {
@@ -344,6 +350,9 @@ func (fh *RWFileHandle) _writeAt(b []byte, off int64, release bool) (n int, err
 		fh.offset = size
 		off = fh.offset
 	}
+	if err = fh.d.vfs.quotaGrow(&fh.quotaSize, off+int64(len(b))); err != nil {
+		return n, err
+	}
 	fh.writeCalled = true
 	if release {
 		// Do the writing with fh.mu unlocked
@@ -393,6 +402,9 @@ func (fh *RWFileHandle) _truncate(size int64) (err error) {
 	if size == fh._size() {
 		return nil
 	}
+	if err = fh.d.vfs.quotaGrow(&fh.quotaSize, size); err != nil {
+		return err
+	}
 	fh.file.setSize(size)
 	return fh.item.Truncate(size)
 }
@@ -0,0 +1,65 @@
+package vfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/fspath"
+)
+
+// snapshotOption is the backend option used to list a remote as it
+// was at a point in time
+const snapshotOption = "version_at"
+
+// errNoSnapshot is returned if the backend can't show old versions
+var errNoSnapshot = errors.New("remote doesn't support --vfs-snapshot-time")
+
+// noSnapshotBackends keep old versions of files but can't list the
+// remote as it was at a point in time, so the reason they aren't
+// supported is given explicitly.
+//
+// They keep revisions of each file's contents but not the history of
+// the directory tree - deleted files are in the trash or gone and
+// renamed or moved files only have their current name and parent.
+var noSnapshotBackends = map[string]bool{
+	"drive":    true,
+	"onedrive": true,
+}
+
+// snapshotFs returns a copy of f which shows the remote as it was at
+// time t
+//
+// The remote is re-created with the backend's version_at option set
+// so this only works on backends which support it.
+func snapshotFs(ctx context.Context, f fs.Fs, t time.Time) (fs.Fs, error) {
+	configString := fs.ConfigStringFull(f)
+	fsInfo, _, _, _, err := fs.ConfigFs(configString)
+	if err != nil {
+		return nil, err
+	}
+	if noSnapshotBackends[fsInfo.Name] {
+		return nil, fmt.Errorf("%w: the %s backend keeps old versions of files but can't list the remote as it was at a point in time", errNoSnapshot, fsInfo.Name)
+	}
+	if fsInfo.Options.Get(snapshotOption) == nil {
+		return nil, fmt.Errorf("%w: the %s backend has no %s option", errNoSnapshot, fsInfo.Name, snapshotOption)
+	}
+	parsed, err := fspath.Parse(configString)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Config == nil {
+		parsed.Config = make(configmap.Simple)
+	}
+	parsed.Config[snapshotOption] = t.UTC().Format(time.RFC3339Nano)
+	fsString := parsed.Name + "," + parsed.Config.String() + ":" + parsed.Path
+	snapshot, err := cache.Get(ctx, fsString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make snapshot of remote: %w", err)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,80 @@
+package vfs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotFs(t *testing.T) {
+	ctx := context.Background()
+
+	// Register a backend with a version_at option temporarily
+	oldRegistry := fs.Registry
+	var versionAt string
+	fs.Register(&fs.RegInfo{
+		Name: "snapshottest",
+		NewFs: func(ctx context.Context, name string, root string, m configmap.Mapper) (fs.Fs, error) {
+			versionAt, _ = m.Get(snapshotOption)
+			return mockfs.NewFs(ctx, name, root, m)
+		},
+		Options: []fs.Option{{
+			Name:    snapshotOption,
+			Default: fs.Time{},
+		}},
+	})
+	defer func() {
+		fs.Registry = oldRegistry
+	}()
+
+	when := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	f, err := fs.NewFs(ctx, ":snapshottest:dir")
+	require.NoError(t, err)
+	assert.Equal(t, "off", versionAt)
+
+	snapshot, err := snapshotFs(ctx, f, when)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-09-01T00:00:00Z", versionAt)
+	assert.Equal(t, "dir", snapshot.Root())
+	assert.Equal(t, ":snapshottest,version_at='2026-09-01T00:00:00Z':dir", fs.ConfigStringFull(snapshot))
+
+	// The VFS uses the snapshot and is read only
+	opt := vfscommon.Opt
+	opt.SnapshotTime = fs.Time(when)
+	vfs := New(ctx, f, &opt)
+	defer cleanupVFS(t, vfs)
+	assert.Equal(t, fs.ConfigStringFull(snapshot), fs.ConfigStringFull(vfs.Fs()))
+	assert.True(t, vfs.Opt.ReadOnly)
+}
+
+func TestSnapshotFsNotSupported(t *testing.T) {
+	ctx := context.Background()
+	r, _ := newTestVFS(t)
+	_, err := snapshotFs(ctx, r.Fremote, time.Now())
+	if r.Fremote.Features().IsLocal {
+		assert.ErrorIs(t, err, errNoSnapshot)
+		assert.ErrorContains(t, err, "no version_at option")
+	}
+
+	// Backends which keep versions but can't list the past are
+	// rejected with a clear error
+	f, err := mockfs.NewFs(ctx, ":onedrive", "dir", nil)
+	require.NoError(t, err)
+	_, err = snapshotFs(ctx, f, time.Now())
+	assert.ErrorIs(t, err, errNoSnapshot)
+	assert.ErrorContains(t, err, "the onedrive backend keeps old versions")
+
+	// Making a VFS returns the error rather than exiting
+	opt := vfscommon.Opt
+	opt.SnapshotTime = fs.Time(time.Now())
+	vfs, err := NewWithError(ctx, f, &opt)
+	assert.ErrorIs(t, err, errNoSnapshot)
+	assert.Nil(t, vfs)
+}
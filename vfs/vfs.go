@@ -186,6 +186,9 @@ type VFS struct {
 	usageMu     sync.Mutex
 	usageTime   time.Time
 	usage       *fs.Usage
+	quotaMu     sync.Mutex
+	quotaKey    string      // key the quota is shared under - blank for the remote
+	quota       *quotaState // space used against the quota - use quotaState()
 	pollChan    chan time.Duration
 	inUse       atomic.Int32 // count of number of opens
 }
@@ -202,7 +205,21 @@ var (
 // The ctx passed in is not used for cancellation but is used to find
 // the config in the context (if any) and filter config in the context
 // (if any).
+//
+// This exits with a fatal error if the VFS can't be created, which
+// only happens if --vfs-snapshot-time can't be honoured. Use
+// NewWithError in servers and mounts which must keep running.
 func New(ctx context.Context, f fs.Fs, opt *vfscommon.Options) *VFS {
+	vfs, err := NewWithError(ctx, f, opt)
+	if err != nil {
+		fs.Fatalf(f, "%v", err)
+	}
+	return vfs
+}
+
+// NewWithError creates a new VFS and root directory as New does but
+// returns an error if it can't be created.
+func NewWithError(ctx context.Context, f fs.Fs, opt *vfscommon.Options) (*VFS, error) {
 	fsDir := fs.NewDir("", time.Now())
 	// Strip the ctx of any cancellation but copy the config across
 	newCtx := context.Background()
@@ -226,6 +243,20 @@ func New(ctx context.Context, f fs.Fs, opt *vfscommon.Options) *VFS {
 	// Fill out anything else
 	vfs.Opt.Init(ctx)
 
+	// Show the remote as it was in the past if required. Showing
+	// the current contents instead would be misleading so this is
+	// an error.
+	if vfs.Opt.SnapshotTime.IsSet() {
+		snapshot, err := snapshotFs(ctx, f, time.Time(vfs.Opt.SnapshotTime))
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to show remote as it was at %v: %w", vfs.Opt.SnapshotTime, err)
+		}
+		fs.Infof(snapshot, "Showing remote read only as it was at %v", vfs.Opt.SnapshotTime)
+		f = snapshot
+		vfs.f = f
+	}
+
 	// Find a VFS with the same name and options and return it if possible
 	activeMu.Lock()
 	defer activeMu.Unlock()
@@ -235,7 +266,7 @@ func New(ctx context.Context, f fs.Fs, opt *vfscommon.Options) *VFS {
 			fs.Debugf(f, "Reusing VFS from active cache")
 			activeVFS.inUse.Add(1)
 			cancel()
-			return activeVFS
+			return activeVFS, nil
 		}
 	}
 	// Put the VFS into the active cache
@@ -246,9 +277,11 @@ func New(ctx context.Context, f fs.Fs, opt *vfscommon.Options) *VFS {
 
 	// Start polling function
 	features := vfs.f.Features()
-	if do := features.ChangeNotify; do != nil {
+	if vfs.Opt.SnapshotTime.IsSet() {
+		fs.Debugf(f, "Not polling for changes as showing a snapshot")
+	} else if do := features.ChangeNotify; do != nil {
 		vfs.pollChan = make(chan time.Duration)
-		do(vfs.ctx, vfs.root.changeNotify, vfs.pollChan)
+		do(vfs.ctx, vfs.changeNotify, vfs.pollChan)
 		vfs.pollChan <- time.Duration(vfs.Opt.PollInterval)
 	} else if vfs.Opt.PollInterval > 0 {
 		fs.Infof(f, "poll-interval is not supported by this remote")
@@ -280,7 +313,15 @@ func New(ctx context.Context, f fs.Fs, opt *vfscommon.Options) *VFS {
 	// This can take some time so do it after the Pin
 	vfs.SetCacheMode(vfs.Opt.CacheMode)
 
-	return vfs
+	return vfs, nil
+}
+
+// changeNotify is called by the remote when relativePath changes
+func (vfs *VFS) changeNotify(relativePath string, entryType fs.EntryType) {
+	vfs.root.changeNotify(relativePath, entryType)
+	if vfs.cache != nil {
+		vfs.cache.PinNotify(relativePath)
+	}
 }
 
 // refresh the directory cache for all directories
@@ -406,6 +447,7 @@ func (vfs *VFS) Shutdown() {
 	activeMu.Unlock()
 
 	vfs.shutdownCache()
+	vfs.releaseQuota()
 
 	if vfs.pollChan != nil {
 		close(vfs.pollChan)
@@ -655,12 +697,19 @@ const unknownFreeBytes = 1 << 50
 //
 // The values will be -1 if they aren't known
 //
-// This information is cached for the DirCacheTime interval
+// This information is cached for the DirCacheTime interval.
+//
+// If --vfs-quota is set then the quota is returned as the total and
+// the used space is the size of the files in the VFS.
 func (vfs *VFS) Statfs() (total, used, free int64) {
 	// defer log.Trace("/", "")("total=%d, used=%d, free=%d", &total, &used, &free)
 	vfs.usageMu.Lock()
 	defer vfs.usageMu.Unlock()
 	total, used, free = -1, -1, -1
+	if vfs.quotaEnabled() {
+		total, used = vfs.quotaUsage()
+		return total, used, max(total-used, 0)
+	}
 	doAbout := vfs.f.Features().About
 	if (doAbout != nil || vfs.Opt.UsedIsSize) && (vfs.usageTime.IsZero() || time.Since(vfs.usageTime) >= time.Duration(vfs.Opt.DirCacheTime)) {
 		var err error
@@ -9,7 +9,6 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
-	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -52,6 +51,10 @@ type Cache struct {
 	hashOption *fs.HashesOption     // corresponding OpenOption
 	writeback  *writeback.WriteBack // holds Items for writeback
 	avFn       AddVirtualFn         // if set, can be called to add dir entries
+	pinPath    string               // file holding the pinned directories
+	priorities []priorityRule       // rules from --vfs-cache-priority-file
+	stats      cacheStats           // hit, miss and eviction counters
+	shared     *shared              // set if sharing the cache with other processes
 
 	mu            sync.Mutex       // protects the following variables
 	cond          sync.Cond        // cond lock for synchronous cache cleaning
@@ -63,6 +66,9 @@ type Cache struct {
 	kickerMu      sync.Mutex       // mutex for cleanerKicked
 	kick          chan struct{}    // channel for kicking clear to start
 
+	pinMu   sync.Mutex            // protects pins - may be taken with mu held but not the reverse
+	pins    map[string]*PinStatus // pinned directories
+	pinKick chan struct{}         // channel for kicking the pinner
 }
 
 // AddVirtualFn if registered by the WithAddVirtual method, can be
@@ -130,6 +136,17 @@ func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVir
 		hashOption: hashOption,
 		writeback:  writeback.New(ctx, opt),
 		avFn:       avFn,
+		pinPath:    file.UNCPath(filepath.Join(parentOSPath, "vfsPin", relativeDirOSPath+".json")),
+		pins:       make(map[string]*PinStatus),
+		pinKick:    make(chan struct{}, 1),
+	}
+
+	// coordinate with other processes using the cache
+	if opt.CacheShared {
+		c.shared, err = newShared(ctx, file.UNCPath(filepath.Join(parentOSPath, "vfsShared", relativeDirOSPath)))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// load in the cache and metadata off disk
@@ -138,14 +155,30 @@ func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVir
 		return nil, fmt.Errorf("failed to load cache: %w", err)
 	}
 
-	// Remove any empty directories
-	c.purgeEmptyDirs("", true)
+	// load in the eviction priorities
+	c.priorities, err = loadPriorities(opt.CachePriorityFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load --vfs-cache-priority-file: %w", err)
+	}
+
+	// load in the pinned directories
+	err = c.loadPins()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pinned directories: %w", err)
+	}
+
+	// Remove any empty directories unless other processes may be
+	// creating items in them
+	if c.shared == nil {
+		c.purgeEmptyDirs("", true)
+	}
 
 	// Create a channel for cleaner to be kicked upon out of space con
 	c.kick = make(chan struct{}, 1)
 	c.cond = sync.Cond{L: &c.mu}
 
 	go c.cleaner(ctx)
+	go c.pinner(ctx)
 
 	return c, nil
 }
@@ -169,6 +202,18 @@ func (c *Cache) Stats() (out rc.Params) {
 	out["erroredFiles"] = len(c.errItems)
 	out["bytesUsed"] = c.used
 	out["outOfSpace"] = c.outOfSpace
+	out["shared"] = c.shared != nil
+	out["evictionPolicy"] = c.opt.CacheEviction.String()
+	out["hits"] = c.stats.hits.Load()
+	out["misses"] = c.stats.misses.Load()
+	out["hitBytes"] = c.stats.hitBytes.Load()
+	out["missBytes"] = c.stats.missBytes.Load()
+	out["evictions"] = c.stats.evictions.Load()
+	out["evictedBytes"] = c.stats.evictedBytes.Load()
+
+	c.pinMu.Lock()
+	out["pinned"] = len(c.pins)
+	c.pinMu.Unlock()
 
 	return out
 }
@@ -592,11 +637,15 @@ func (c *Cache) KickCleaner() {
 // removeNotInUse removes items not in use with a possible maxAge cutoff
 // called with cache mutex locked and up-to-date c.used (as we update it directly here)
 func (c *Cache) removeNotInUse(item *Item, maxAge time.Duration, emptyOnly bool) {
+	if c.isPinned(item.name) {
+		return
+	}
 	removed, spaceFreed := item.RemoveNotInUse(maxAge, emptyOnly)
 	// The item space might be freed even if we get an error after the cache file is removed
 	// The item will not be removed or reset the cache data is dirty (DataDirty)
 	c.used -= spaceFreed
 	if removed {
+		c.stats.evicted(spaceFreed)
 		fs.Infof(c.fremote, "vfs cache RemoveNotInUse (maxAge=%d, emptyOnly=%v): item %s was removed, freed %d bytes", maxAge, emptyOnly, item.GetName(), spaceFreed)
 		// Remove the entry
 		delete(c.item, item.name)
@@ -640,14 +689,14 @@ func (c *Cache) purgeClean() {
 
 	var items Items
 
-	// Make a slice of clean cache files
+	// Make a slice of clean cache files which aren't pinned
 	for _, item := range c.item {
-		if !item.IsDirty() {
+		if !item.IsDirty() && !c.isPinned(item.name) {
 			items = append(items, item)
 		}
 	}
 
-	sort.Sort(items)
+	c.sortForEviction(items)
 
 	// Reset items until the quota is OK
 	for _, item := range items {
@@ -662,6 +711,9 @@ func (c *Cache) purgeClean() {
 		if resetResult == RemovedNotInUse {
 			delete(c.item, item.name)
 		}
+		if resetResult == RemovedNotInUse || (resetResult == ResetComplete && spaceFreed > 0) {
+			c.stats.evicted(spaceFreed)
+		}
 		if err != nil {
 			fs.Errorf(c.fremote, "vfs cache purgeClean item.Reset %s reset failed, err = %v, freed %d bytes", item.GetName(), err, spaceFreed)
 			c.errItems[item.name] = err
@@ -704,6 +756,9 @@ func (c *Cache) purgeEmptyDirs(dir string, leaveRoot bool) {
 }
 
 // updateUsed updates c.used so it is accurate
+//
+// If the cache is shared this includes the items used by other
+// processes.
 func (c *Cache) updateUsed() (used int64) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -712,6 +767,7 @@ func (c *Cache) updateUsed() (used int64) {
 	for _, item := range c.item {
 		newUsed += item.getDiskSize()
 	}
+	newUsed += c._sharedUsed()
 	c.used = newUsed
 	return newUsed
 }
@@ -768,14 +824,14 @@ func (c *Cache) purgeOverQuota() {
 
 	var items Items
 
-	// Make a slice of unused files
+	// Make a slice of unused files which aren't pinned
 	for _, item := range c.item {
-		if !item.inUse() {
+		if !item.inUse() && !c.isPinned(item.name) {
 			items = append(items, item)
 		}
 	}
 
-	sort.Sort(items)
+	c.sortForEviction(items)
 
 	// Remove items until the quota is OK
 	for _, item := range items {
@@ -0,0 +1,180 @@
+package vfscache
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// cacheStats counts how well the cache is doing
+type cacheStats struct {
+	hits         atomic.Int64 // reads satisfied from the cache
+	misses       atomic.Int64 // reads which needed a download
+	hitBytes     atomic.Int64 // bytes read from the cache
+	missBytes    atomic.Int64 // bytes read which needed a download
+	evictions    atomic.Int64 // items evicted from the cache
+	evictedBytes atomic.Int64 // bytes freed by evicting items
+}
+
+// read records a read of size bytes
+func (s *cacheStats) read(hit bool, size int64) {
+	if hit {
+		s.hits.Add(1)
+		s.hitBytes.Add(size)
+	} else {
+		s.misses.Add(1)
+		s.missBytes.Add(size)
+	}
+}
+
+// evicted records an item being evicted freeing size bytes
+func (s *cacheStats) evicted(size int64) {
+	s.evictions.Add(1)
+	s.evictedBytes.Add(size)
+}
+
+// priorityRule gives the eviction priority of paths matching re
+type priorityRule struct {
+	re       *regexp.Regexp
+	priority int
+}
+
+// loadPriorities reads the --vfs-cache-priority-file
+//
+// Each line is a priority followed by a glob in the same format as
+// the filter rules. Blank lines and lines starting with # or ; are
+// ignored. The first matching rule gives the priority of a path.
+func loadPriorities(name string) (rules []priorityRule, err error) {
+	if name == "" {
+		return nil, nil
+	}
+	in, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	scanner := bufio.NewScanner(in)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: need priority and pattern", name, lineNumber)
+		}
+		priorityString, glob := line[:i], strings.TrimSpace(line[i:])
+		priority, err := strconv.Atoi(priorityString)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: bad priority: %w", name, lineNumber, err)
+		}
+		re, err := filter.GlobPathToRegexp(glob, false)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: bad pattern: %w", name, lineNumber, err)
+		}
+		rules = append(rules, priorityRule{re: re, priority: priority})
+	}
+	return rules, scanner.Err()
+}
+
+// priority returns the eviction priority of name - items with the
+// lowest priority are evicted first
+func (c *Cache) priority(name string) int {
+	for _, rule := range c.priorities {
+		if rule.re.MatchString(name) {
+			return rule.priority
+		}
+	}
+	return 0
+}
+
+// evictionKey is a snapshot of the things an item is sorted on
+type evictionKey struct {
+	item     *Item
+	priority int
+	aTime    time.Time
+	hits     int64
+	size     int64
+}
+
+// sortForEviction sorts items so the ones which should be evicted
+// first come first according to the --vfs-cache-eviction policy and
+// the --vfs-cache-priority-file rules.
+func (c *Cache) sortForEviction(items []*Item) {
+	now := time.Now()
+	keys := make([]evictionKey, len(items))
+	for i, item := range items {
+		item.mu.Lock()
+		keys[i] = evictionKey{
+			item:     item,
+			priority: c.priority(item.name),
+			aTime:    item.info.ATime,
+			hits:     item.info.Hits,
+			size:     item.info.Rs.Size(),
+		}
+		item.mu.Unlock()
+	}
+	byATime := func(a, b evictionKey) int {
+		return a.aTime.Compare(b.aTime)
+	}
+	var policy func(a, b evictionKey) int
+	switch c.opt.CacheEviction {
+	case vfscommon.CacheEvictionLFU:
+		policy = func(a, b evictionKey) int {
+			if a.hits != b.hits {
+				return cmp.Compare(a.hits, b.hits)
+			}
+			return byATime(a, b)
+		}
+	case vfscommon.CacheEvictionARC:
+		// Files used once are evicted before files used repeatedly
+		// so a single scan can't flush out the frequently used ones.
+		policy = func(a, b evictionKey) int {
+			aOnce, bOnce := a.hits <= 1, b.hits <= 1
+			if aOnce != bOnce {
+				if aOnce {
+					return -1
+				}
+				return 1
+			}
+			return byATime(a, b)
+		}
+	case vfscommon.CacheEvictionSize:
+		// Weight the time since last access by the space used so
+		// large files are evicted before small ones of similar age.
+		score := func(k evictionKey) float64 {
+			age := max(now.Sub(k.aTime).Seconds(), 1)
+			return age * float64(max(k.size, 1))
+		}
+		policy = func(a, b evictionKey) int {
+			if n := cmp.Compare(score(b), score(a)); n != 0 {
+				return n
+			}
+			return byATime(a, b)
+		}
+	default:
+		policy = byATime
+	}
+	slices.SortStableFunc(keys, func(a, b evictionKey) int {
+		if a.priority != b.priority {
+			return cmp.Compare(a.priority, b.priority)
+		}
+		return policy(a, b)
+	})
+	for i := range keys {
+		items[i] = keys[i].item
+	}
+}
@@ -0,0 +1,123 @@
+package vfscache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/lib/ranges"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// write contents to a temporary file returning its name
+func writeTempFile(t *testing.T, contents string) string {
+	name := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(name, []byte(contents), 0600))
+	return name
+}
+
+func TestLoadPriorities(t *testing.T) {
+	rules, err := loadPriorities("")
+	require.NoError(t, err)
+	assert.Nil(t, rules)
+
+	c := &Cache{}
+	c.priorities, err = loadPriorities(writeTempFile(t, `
+# comment
+; comment
+100	*.srt
+-10 /media/**
+5 /media/keep/**
+`))
+	require.NoError(t, err)
+	require.Len(t, c.priorities, 3)
+	assert.Equal(t, 100, c.priority("film.srt"))
+	assert.Equal(t, 100, c.priority("media/film.srt"))
+	assert.Equal(t, -10, c.priority("media/film.mkv"))
+	assert.Equal(t, -10, c.priority("media/keep/film.mkv")) // first match wins
+	assert.Equal(t, 0, c.priority("other/film.mkv"))
+
+	_, err = loadPriorities(writeTempFile(t, "100"))
+	assert.ErrorContains(t, err, ":1: need priority and pattern")
+	_, err = loadPriorities(writeTempFile(t, "\npotato *.srt"))
+	assert.ErrorContains(t, err, ":2: bad priority")
+	_, err = loadPriorities(filepath.Join(t.TempDir(), "notfound"))
+	assert.Error(t, err)
+}
+
+func TestSortForEviction(t *testing.T) {
+	_, c := newTestCache(t)
+	now := time.Now()
+	newItem := func(name string, age time.Duration, hits int64, size int64) *Item {
+		item, _ := c.get(name)
+		item.info.ATime = now.Add(-age)
+		item.info.Hits = hits
+		item.info.Rs = ranges.Ranges{{Pos: 0, Size: size}}
+		return item
+	}
+	items := []*Item{
+		newItem("big", 1*time.Minute, 1, 1<<30),
+		newItem("hot", 3*time.Minute, 10, 1<<10),
+		newItem("old", 10*time.Minute, 2, 1<<10),
+		newItem("scan", 2*time.Minute, 1, 1<<10),
+	}
+	names := func(items []*Item) (out []string) {
+		for _, item := range items {
+			out = append(out, item.name)
+		}
+		return out
+	}
+
+	for _, test := range []struct {
+		policy vfscommon.CacheEviction
+		want   []string
+	}{
+		{vfscommon.CacheEvictionLRU, []string{"old", "hot", "scan", "big"}},
+		{vfscommon.CacheEvictionLFU, []string{"scan", "big", "old", "hot"}},
+		{vfscommon.CacheEvictionARC, []string{"scan", "big", "old", "hot"}},
+		{vfscommon.CacheEvictionSize, []string{"big", "old", "hot", "scan"}},
+	} {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			c.opt.CacheEviction = test.policy
+			got := append([]*Item(nil), items...)
+			c.sortForEviction(got)
+			assert.Equal(t, test.want, names(got))
+		})
+	}
+
+	// Priorities take precedence over the policy
+	c.opt.CacheEviction = vfscommon.CacheEvictionSize
+	var err error
+	c.priorities, err = loadPriorities(writeTempFile(t, "10 big\n-1 hot\n"))
+	require.NoError(t, err)
+	got := append([]*Item(nil), items...)
+	c.sortForEviction(got)
+	assert.Equal(t, []string{"hot", "old", "scan", "big"}, names(got))
+}
+
+func TestCacheHitMissStats(t *testing.T) {
+	r, c := newItemTestCache(t)
+	contents, obj, item := newFile(t, r, c, "existing")
+	require.NoError(t, item.Open(obj))
+	defer func() {
+		require.NoError(t, item.Close(nil))
+	}()
+
+	buf := make([]byte, 10)
+	_, err := item.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, contents[:10], string(buf))
+	_, err = item.ReadAt(buf, 0)
+	require.NoError(t, err)
+
+	out := c.Stats()
+	assert.Equal(t, int64(1), out["misses"])
+	assert.Equal(t, int64(10), out["missBytes"])
+	assert.Equal(t, int64(1), out["hits"])
+	assert.Equal(t, int64(10), out["hitBytes"])
+	assert.Equal(t, "lru", out["evictionPolicy"])
+	assert.Equal(t, int64(1), item.info.Hits)
+}
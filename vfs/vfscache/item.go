@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gofrs/flock"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/operations"
@@ -69,6 +70,7 @@ type Item struct {
 	modified        bool                     // set if the file has been modified since the last Open
 	beingReset      bool                     // cache cleaner is resetting the cache file, access not allowed
 	graceTimer      *time.Timer              // timer for delayed close after grace period
+	sharedLocks     []*flock.Flock           // locks held while open if the cache is shared
 }
 
 // Info is persisted to backing store
@@ -79,6 +81,8 @@ type Info struct {
 	Rs          ranges.Ranges // which parts of the file are present
 	Fingerprint string        // fingerprint of remote object
 	Dirty       bool          // set if the backing file has been modified
+	Hits        int64         // number of times the file has been opened
+	Owner       string        // process which modified the file if the cache is shared
 }
 
 // Items are a slice of *Item ordered by ATime
@@ -96,11 +100,13 @@ const (
 	RemovedNotInUse                         // Item not used. Remove instead of reset
 	ResetFailed                             // Reset failed with an error
 	ResetComplete                           // Reset completed successfully
+	SkippedShared                           // Item may be in use by another process
 )
 
 func (rr ResetResult) String() string {
 	return [...]string{"Dirty item skipped", "In-access item skipped", "Empty item skipped",
-		"Grace period item skipped", "Not-in-use item removed", "Item reset failed", "Item reset completed"}[rr]
+		"Grace period item skipped", "Not-in-use item removed", "Item reset failed", "Item reset completed",
+		"Shared item skipped"}[rr]
 }
 
 func (v Items) Len() int      { return len(v) }
@@ -188,6 +194,7 @@ func (item *Item) getDiskSize() int64 {
 func (item *Item) load() (exists bool, err error) {
 	item.mu.Lock()
 	defer item.mu.Unlock()
+	defer item.c.shared.lockMeta()()
 	osPathMeta := item.c.toOSPathMeta(item.name) // No locking in Cache
 	in, err := os.Open(osPathMeta)
 	if err != nil {
@@ -209,6 +216,10 @@ func (item *Item) load() (exists bool, err error) {
 //
 // call with the lock held
 func (item *Item) _save() (err error) {
+	defer item.c.shared.lockMeta()()
+	if item.c.shared != nil && !item._mergeShared() {
+		return nil
+	}
 	osPathMeta := item.c.toOSPathMeta(item.name) // No locking in Cache
 	out, err := os.Create(osPathMeta)
 	if err != nil {
@@ -437,8 +448,9 @@ func (item *Item) _dirty() {
 		item.c.writeback.Remove(item.writeBackID)
 		item.mu.Lock()
 	}
-	if !item.info.Dirty {
+	if !item.info.Dirty || item.info.Owner != item.c.shared.getID() {
 		item.info.Dirty = true
+		item.info.Owner = item.c.shared.getID()
 		err := item._save()
 		if err != nil {
 			fs.Errorf(item.name, "vfs cache: failed to save item info: %v", err)
@@ -496,6 +508,17 @@ func (item *Item) _createFile(osPath string) (err error) {
 // Open the local file from the object passed in.  Wraps open()
 // to provide recovery from out of space error.
 func (item *Item) Open(o fs.Object) (err error) {
+	err = item.lockOpen()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			item.mu.Lock()
+			item._unlockOpen(item.opens)
+			item.mu.Unlock()
+		}
+	}()
 	for range fs.GetConfig(item.c.ctx).LowLevelRetries {
 		item.preAccess()
 		err = item.open(o)
@@ -521,12 +544,18 @@ func (item *Item) open(o fs.Object) (err error) {
 	defer item.mu.Unlock()
 
 	item.info.ATime = time.Now()
+	item.info.Hits++
 
 	osPath, err := item.c.createItemDir(item.name) // No locking in Cache
 	if err != nil {
 		return fmt.Errorf("vfs cache item: createItemDir failed: %w", err)
 	}
 
+	// Pick up changes from other processes sharing the cache
+	if item.opens == 0 && item.graceTimer == nil {
+		item._loadShared()
+	}
+
 	err = item._checkObject(o)
 	if err != nil {
 		return fmt.Errorf("vfs cache item: check object failed: %w", err)
@@ -654,6 +683,7 @@ func (item *Item) _store(ctx context.Context, storeFn StoreFn) (err error) {
 
 	// Show item is clean and is eligible for cache removal
 	item.info.Dirty = false
+	item.info.Owner = ""
 	err = item._save()
 	if err != nil {
 		fs.Errorf(item.name, "vfs cache: failed to write metadata file: %v", err)
@@ -685,6 +715,7 @@ func (item *Item) Close(storeFn StoreFn) (err error) {
 	if item.opens < 0 {
 		return os.ErrClosed
 	} else if item.opens > 0 {
+		item._unlockOpen(item.opens)
 		return nil
 	}
 
@@ -693,6 +724,7 @@ func (item *Item) Close(storeFn StoreFn) (err error) {
 	gracePeriod := time.Duration(item.c.opt.HandleCaching)
 	if gracePeriod > 0 && !item.info.Dirty {
 		item.graceTimer = time.AfterFunc(gracePeriod, item.closeAfterGrace)
+		item._unlockOpen(1)
 		return nil
 	}
 
@@ -789,8 +821,9 @@ func (item *Item) _actualClose(storeFn StoreFn, syncWriteBack bool) (err error)
 		}
 	}
 
-	// upload the file to backing store if changed
-	if item.info.Dirty {
+	// upload the file to backing store if changed unless another
+	// process sharing the cache changed it
+	if item.info.Dirty && !item._ownedElsewhere() {
 		fs.Infof(item.name, "vfs cache: queuing for upload in %v", item.c.opt.WriteBack)
 		if syncWriteBack {
 			// do synchronous writeback
@@ -810,6 +843,9 @@ func (item *Item) _actualClose(storeFn StoreFn, syncWriteBack bool) (err error)
 	// mark as not modified now we have uploaded or queued for upload
 	item.modified = false
 
+	// let other processes sharing the cache evict it
+	item._unlockOpen(0)
+
 	return err
 }
 
@@ -821,7 +857,7 @@ func (item *Item) _actualClose(storeFn StoreFn, syncWriteBack bool) (err error)
 // metaDirty will be false.
 func (item *Item) reload(ctx context.Context) error {
 	item.mu.Lock()
-	dirty := item.info.Dirty
+	dirty := item.info.Dirty && !item._ownedElsewhere()
 	item.mu.Unlock()
 	if !dirty {
 		return nil
@@ -996,6 +1032,11 @@ func (item *Item) RemoveNotInUse(maxAge time.Duration, emptyOnly bool) (removed
 	if removeIt {
 		spaceUsed := item.info.Rs.Size()
 		if !emptyOnly || spaceUsed == 0 {
+			unlock := item._lockEvict()
+			if unlock == nil {
+				return
+			}
+			defer unlock()
 			spaceFreed = spaceUsed
 			removed = true
 			if item._remove("Removing old cache file not in use") {
@@ -1016,6 +1057,11 @@ func (item *Item) Reset() (rr ResetResult, spaceFreed int64, err error) {
 	// Items in their grace period are treated as in-use; the cache
 	// cleaner will pick them up on the next pass.
 	if item.opens == 0 && !item.info.Dirty && item.graceTimer == nil {
+		unlock := item._lockEvict()
+		if unlock == nil {
+			return SkippedShared, 0, nil
+		}
+		defer unlock()
 		spaceFreed = item.info.Rs.Size()
 		if item._remove("Removing old cache file not in use") {
 			fs.Errorf(item.name, "item removed when it was writing/uploaded")
@@ -1028,6 +1074,11 @@ func (item *Item) Reset() (rr ResetResult, spaceFreed int64, err error) {
 		return SkippedDirty, 0, nil
 	}
 
+	// do not reset a file other processes sharing the cache may be reading
+	if item.c.shared != nil {
+		return SkippedShared, 0, nil
+	}
+
 	// Items in their grace period are treated as in-use; the cache
 	// cleaner will pick them up on the next pass.
 	if item.graceTimer != nil {
@@ -1181,6 +1232,21 @@ func (item *Item) present() bool {
 	return item._present()
 }
 
+// fetch makes sure the whole file is present in the cache, downloading
+// any parts which are missing
+//
+// The item must be open.
+func (item *Item) fetch() (err error) {
+	item.preAccess()
+	defer item.postAccess()
+	item.mu.Lock()
+	defer item.mu.Unlock()
+	if item._present() {
+		return nil
+	}
+	return item._ensure(0, item.info.Size)
+}
+
 // HasRange returns true if the current ranges entirely include range
 func (item *Item) HasRange(r ranges.Range) bool {
 	item.mu.Lock()
@@ -1354,6 +1420,10 @@ func (item *Item) readAt(b []byte, off int64) (n int, err error) {
 	}
 	defer item.mu.Unlock()
 
+	if size := min(int64(len(b)), item.info.Size-off); size > 0 {
+		hit := item.info.Rs.Present(ranges.Range{Pos: off, Size: size})
+		item.c.stats.read(hit, size)
+	}
 	err = item._ensure(off, int64(len(b)))
 	if err != nil {
 		return 0, err
@@ -1378,11 +1448,13 @@ func (item *Item) readAt(b []byte, off int64) (n int, err error) {
 func (item *Item) WriteAt(b []byte, off int64) (n int, err error) {
 	item.preAccess()
 	defer item.postAccess()
+	defer item.lockWrite()()
 	item.mu.Lock()
 	if item.fd == nil {
 		item.mu.Unlock()
 		return 0, errors.New("vfs cache item WriteAt: internal error: didn't Open file")
 	}
+	item._loadSharedRanges()
 	item.mu.Unlock()
 	// Do the writing with Item.mu unlocked
 	n, err = item.fd.WriteAt(b, off)
@@ -1406,6 +1478,9 @@ func (item *Item) WriteAt(b []byte, off int64) (n int, err error) {
 	if end > item.info.Size {
 		item.info.Size = end
 	}
+	if n > 0 {
+		item._saveShared()
+	}
 	item.mu.Unlock()
 	return n, err
 }
@@ -1418,7 +1493,9 @@ func (item *Item) WriteAt(b []byte, off int64) (n int, err error) {
 // It returns n the total bytes processed and skipped the number of
 // bytes which were processed but not actually written to the file.
 func (item *Item) WriteAtNoOverwrite(b []byte, off int64) (n int, skipped int, err error) {
+	defer item.lockWrite()()
 	item.mu.Lock()
+	item._loadSharedRanges()
 
 	var (
 		// Range we wish to write
@@ -1460,6 +1537,9 @@ func (item *Item) WriteAtNoOverwrite(b []byte, off int64) (n int, skipped int, e
 			break
 		}
 	}
+	if n > skipped {
+		item._saveShared()
+	}
 	item.mu.Unlock()
 	return n, skipped, err
 }
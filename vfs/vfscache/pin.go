@@ -0,0 +1,324 @@
+package vfscache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"golang.org/x/sync/errgroup"
+)
+
+// Pinned directories are downloaded completely into the cache in the
+// background, refreshed when the remote changes and never evicted.
+//
+// The list of pinned directories is persisted in a JSON file outside
+// the cache data and metadata trees so it survives restarts and
+// CleanUp.
+
+// PinStatus describes a pinned directory
+type PinStatus struct {
+	Dir    string    `json:"dir"`              // pinned directory relative to the VFS root
+	Files  int       `json:"files"`            // number of files found at the last sync
+	Size   int64     `json:"size"`             // total size of the files found at the last sync
+	Synced time.Time `json:"synced"`           // when the last sync completed - zero if never
+	Error  string    `json:"error,omitempty"`  // error from the last sync if any
+	Active bool      `json:"active,omitempty"` // set if a sync is in progress
+}
+
+// pinsFile is the format of the persisted pins
+type pinsFile struct {
+	Dirs []string `json:"dirs"`
+}
+
+// cleanPinDir returns dir in the canonical form used for pins
+func cleanPinDir(dir string) string {
+	dir = clean(dir)
+	if dir == "/" || dir == "." {
+		dir = ""
+	}
+	return dir
+}
+
+// pinCovers returns true if name is dir or inside dir
+func pinCovers(dir, name string) bool {
+	return dir == "" || name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+// isPinned returns true if name is inside a pinned directory
+//
+// This may be called with c.mu held
+func (c *Cache) isPinned(name string) bool {
+	c.pinMu.Lock()
+	defer c.pinMu.Unlock()
+	for dir := range c.pins {
+		if pinCovers(dir, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadPins reads the pinned directories from disk
+func (c *Cache) loadPins() error {
+	data, err := os.ReadFile(c.pinPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var pf pinsFile
+	if err = json.Unmarshal(data, &pf); err != nil {
+		return fmt.Errorf("failed to parse %q: %w", c.pinPath, err)
+	}
+	c.pinMu.Lock()
+	defer c.pinMu.Unlock()
+	for _, dir := range pf.Dirs {
+		dir = cleanPinDir(dir)
+		c.pins[dir] = &PinStatus{Dir: dir}
+	}
+	return nil
+}
+
+// _savePins writes the pinned directories to disk
+//
+// call with pinMu held
+func (c *Cache) _savePins() error {
+	pf := pinsFile{Dirs: []string{}}
+	for dir := range c.pins {
+		pf.Dirs = append(pf.Dirs, dir)
+	}
+	slices.Sort(pf.Dirs)
+	data, err := json.MarshalIndent(&pf, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = createDir(filepath.Dir(c.pinPath)); err != nil {
+		return err
+	}
+	// Write to a temporary file and rename so the pins are never lost
+	tmp := c.pinPath + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.pinPath)
+}
+
+// Pin marks dir so that everything in it is downloaded into the cache
+// and kept there.
+//
+// dir should be a remote path not an osPath
+func (c *Cache) Pin(dir string) error {
+	if c.opt.CacheMode < vfscommon.CacheModeFull {
+		return errors.New("pinning needs --vfs-cache-mode full")
+	}
+	dir = cleanPinDir(dir)
+	c.pinMu.Lock()
+	if _, found := c.pins[dir]; found {
+		c.pinMu.Unlock()
+		return nil
+	}
+	c.pins[dir] = &PinStatus{Dir: dir}
+	err := c._savePins()
+	if err != nil {
+		delete(c.pins, dir)
+	}
+	c.pinMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to save pins: %w", err)
+	}
+	fs.Infof(c.fremote, "vfs cache: pinned %q", dir)
+	c.kickPinner()
+	return nil
+}
+
+// Unpin stops dir being pinned. The files stay in the cache but may be
+// evicted in the normal way.
+//
+// dir should be a remote path not an osPath
+func (c *Cache) Unpin(dir string) error {
+	dir = cleanPinDir(dir)
+	c.pinMu.Lock()
+	defer c.pinMu.Unlock()
+	pin, found := c.pins[dir]
+	if !found {
+		return fmt.Errorf("%q is not pinned", dir)
+	}
+	delete(c.pins, dir)
+	if err := c._savePins(); err != nil {
+		c.pins[dir] = pin
+		return fmt.Errorf("failed to save pins: %w", err)
+	}
+	fs.Infof(c.fremote, "vfs cache: unpinned %q", dir)
+	return nil
+}
+
+// Pins returns the status of the pinned directories sorted by name
+func (c *Cache) Pins() (pins []PinStatus) {
+	c.pinMu.Lock()
+	defer c.pinMu.Unlock()
+	pins = []PinStatus{}
+	for _, pin := range c.pins {
+		pins = append(pins, *pin)
+	}
+	slices.SortFunc(pins, func(a, b PinStatus) int {
+		return strings.Compare(a.Dir, b.Dir)
+	})
+	return pins
+}
+
+// PinNotify should be called when remote has changed on the remote so
+// any pinned directories it affects can be refreshed.
+//
+// remote should be a remote path not an osPath
+func (c *Cache) PinNotify(remote string) {
+	remote = cleanPinDir(remote)
+	c.pinMu.Lock()
+	affected := false
+	for dir := range c.pins {
+		if pinCovers(dir, remote) || pinCovers(remote, dir) {
+			affected = true
+			break
+		}
+	}
+	c.pinMu.Unlock()
+	if affected {
+		c.kickPinner()
+	}
+}
+
+// kickPinner asks the pinner to sync the pins without blocking
+func (c *Cache) kickPinner() {
+	select {
+	case c.pinKick <- struct{}{}:
+	default:
+	}
+}
+
+// pinner syncs the pinned directories on startup, when kicked and
+// every --vfs-pin-refresh-interval
+//
+// doesn't return until context is cancelled
+func (c *Cache) pinner(ctx context.Context) {
+	var tickerC <-chan time.Time
+	if c.opt.PinRefreshInterval > 0 {
+		ticker := time.NewTicker(time.Duration(c.opt.PinRefreshInterval))
+		defer ticker.Stop()
+		tickerC = ticker.C
+	}
+	for {
+		c.syncPins(ctx)
+		select {
+		case <-c.pinKick:
+		case <-tickerC:
+		case <-ctx.Done():
+			fs.Debugf(c.fremote, "vfs cache: pinner exiting")
+			return
+		}
+	}
+}
+
+// syncPins syncs all the pinned directories
+func (c *Cache) syncPins(ctx context.Context) {
+	c.pinMu.Lock()
+	dirs := make([]string, 0, len(c.pins))
+	for dir := range c.pins {
+		dirs = append(dirs, dir)
+	}
+	c.pinMu.Unlock()
+	slices.Sort(dirs)
+	for _, dir := range dirs {
+		if ctx.Err() != nil {
+			return
+		}
+		c.syncPin(ctx, dir)
+	}
+}
+
+// setPinStatus updates the status of the pin for dir if it still exists
+func (c *Cache) setPinStatus(dir string, fn func(pin *PinStatus)) {
+	c.pinMu.Lock()
+	defer c.pinMu.Unlock()
+	if pin := c.pins[dir]; pin != nil {
+		fn(pin)
+	}
+}
+
+// syncPin makes sure everything in the pinned directory dir is in the
+// cache and up to date
+func (c *Cache) syncPin(ctx context.Context, dir string) {
+	fs.Debugf(c.fremote, "vfs cache: syncing pinned directory %q", dir)
+	c.setPinStatus(dir, func(pin *PinStatus) { pin.Active = true })
+	var (
+		files int
+		size  int64
+	)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Transfers)
+	err := walk.ListR(gCtx, c.fremote, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			files++
+			size += o.Size()
+			g.Go(func() error {
+				return c.fetch(gCtx, o)
+			})
+		}
+		return nil
+	})
+	if gErr := g.Wait(); err == nil {
+		err = gErr
+	}
+	c.setPinStatus(dir, func(pin *PinStatus) {
+		pin.Active = false
+		pin.Files = files
+		pin.Size = size
+		pin.Error = ""
+		if err != nil {
+			pin.Error = err.Error()
+		} else {
+			pin.Synced = time.Now()
+		}
+	})
+	if err != nil {
+		fs.Errorf(c.fremote, "vfs cache: failed to sync pinned directory %q: %v", dir, err)
+		return
+	}
+	fs.Infof(c.fremote, "vfs cache: synced pinned directory %q: %d files, %v", dir, files, fs.SizeSuffix(size))
+}
+
+// fetch makes sure all of o is in the cache
+//
+// Items with local modifications are left alone.
+func (c *Cache) fetch(ctx context.Context, o fs.Object) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	name := o.Remote()
+	if c.DirtyItem(name) != nil {
+		return nil
+	}
+	item := c.Item(name)
+	if err := item.Open(o); err != nil {
+		return fmt.Errorf("failed to open %q: %w", name, err)
+	}
+	err := item.fetch()
+	if closeErr := item.Close(nil); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %q: %w", name, err)
+	}
+	return nil
+}
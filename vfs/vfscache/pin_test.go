@@ -0,0 +1,130 @@
+package vfscache
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPinTestCache(t *testing.T) (c *Cache, write func(remote, contents string), cached func(remote string) string) {
+	opt := vfscommon.Opt
+	opt.CacheMode = vfscommon.CacheModeFull
+	opt.CachePollInterval = 0
+	opt.WriteBack = 0
+	opt.HandleCaching = 0
+	r, c := newTestCacheOpt(t, opt)
+	t.Cleanup(func() {
+		_ = os.Remove(c.pinPath)
+	})
+	write = func(remote, contents string) {
+		r.WriteObject(context.Background(), remote, contents, time.Now())
+	}
+	cached = func(remote string) string {
+		c.mu.Lock()
+		item := c.item[remote]
+		c.mu.Unlock()
+		if item == nil || !item.present() {
+			return "<not cached>"
+		}
+		data, err := os.ReadFile(c.toOSPath(remote))
+		if err != nil {
+			return "<not cached>"
+		}
+		return string(data)
+	}
+	return c, write, cached
+}
+
+func TestCleanPinDir(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"/", ""},
+		{".", ""},
+		{"dir", "dir"},
+		{"/dir/sub/", "dir/sub"},
+		{"dir//sub", "dir/sub"},
+	} {
+		assert.Equal(t, test.want, cleanPinDir(test.in), test.in)
+	}
+	assert.True(t, pinCovers("", "a"))
+	assert.True(t, pinCovers("a", "a"))
+	assert.True(t, pinCovers("a", "a/b"))
+	assert.False(t, pinCovers("a", "ab"))
+	assert.False(t, pinCovers("a/b", "a"))
+}
+
+func TestCachePin(t *testing.T) {
+	c, write, cached := newPinTestCache(t)
+	write("dir/one", "one")
+	write("dir/sub/two", "two")
+	write("other/three", "three")
+
+	waitSynced := func(after time.Time) {
+		t.Helper()
+		assert.Eventually(t, func() bool {
+			pins := c.Pins()
+			return len(pins) == 1 && !pins[0].Active && pins[0].Synced.After(after)
+		}, 10*time.Second, 10*time.Millisecond)
+	}
+
+	start := time.Now()
+	require.NoError(t, c.Pin("/dir/"))
+	waitSynced(start)
+	pins := c.Pins()
+	assert.Equal(t, "dir", pins[0].Dir)
+	assert.Equal(t, 2, pins[0].Files)
+	assert.Equal(t, int64(6), pins[0].Size)
+	assert.Equal(t, "", pins[0].Error)
+	assert.Equal(t, "one", cached("dir/one"))
+	assert.Equal(t, "two", cached("dir/sub/two"))
+	assert.Equal(t, "<not cached>", cached("other/three"))
+	assert.Equal(t, 1, c.Stats()["pinned"])
+
+	// Pinned items aren't evicted
+	c.purgeOld(-10 * time.Second)
+	assert.Equal(t, "one", cached("dir/one"))
+
+	// Changes are fetched when notified
+	start = time.Now()
+	write("dir/one", "ONE")
+	c.PinNotify("dir/one")
+	waitSynced(start)
+	assert.Equal(t, "ONE", cached("dir/one"))
+
+	// Unrelated changes don't kick the pinner
+	c.PinNotify("other/three")
+	assert.Len(t, c.pinKick, 0)
+
+	// The pins are persisted
+	c2 := &Cache{pinPath: c.pinPath, pins: make(map[string]*PinStatus)}
+	require.NoError(t, c2.loadPins())
+	assert.Equal(t, []PinStatus{{Dir: "dir"}}, c2.Pins())
+
+	// Unpinned items are evicted in the normal way
+	require.Error(t, c.Unpin("other"))
+	require.NoError(t, c.Unpin("dir"))
+	assert.Equal(t, []PinStatus{}, c.Pins())
+	c.purgeOld(-10 * time.Second)
+	assert.Equal(t, "<not cached>", cached("dir/one"))
+
+	c2 = &Cache{pinPath: c.pinPath, pins: make(map[string]*PinStatus)}
+	require.NoError(t, c2.loadPins())
+	assert.Equal(t, []PinStatus{}, c2.Pins())
+}
+
+func TestCachePinNeedsFullMode(t *testing.T) {
+	_, c := newTestCache(t)
+	c.opt.CacheMode = vfscommon.CacheModeWrites
+	err := c.Pin("dir")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--vfs-cache-mode full")
+	assert.Equal(t, []PinStatus{}, c.Pins())
+}
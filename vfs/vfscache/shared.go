@@ -0,0 +1,419 @@
+package vfscache
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gofrs/flock"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/random"
+)
+
+// When --vfs-cache-shared is set more than one rclone process may use
+// the same cache directory. They coordinate using file locks in a
+// directory alongside the cache.
+//
+//   - Each process holds an exclusive lock on its own lock file while
+//     it is running so the others can tell if it is still alive.
+//   - An item which is open holds a shared lock on a lock file chosen
+//     by hashing its name. An item is only evicted if an exclusive lock
+//     can be taken on it, so items open in any process are never
+//     evicted. Hashing into a fixed number of lock files bounds the
+//     number of files at the cost of sometimes not evicting an item
+//     because a different item with the same hash is open.
+//   - Reading and writing metadata is serialised with a lock so each
+//     process sees complete metadata and can merge in the parts of the
+//     file downloaded by the others.
+//   - Writing to an item, whether downloading or writing through the
+//     VFS, holds an exclusive lock on a second lock file chosen by
+//     hashing its name. While it is held the ranges present are
+//     reloaded from the metadata and saved again after the write, so
+//     a download never overwrites data another process has written.
+//   - The cache cleaner counts the items of all the processes so
+//     --vfs-cache-max-size limits the total size of the shared cache.
+//     Each process only evicts the items it knows about.
+//   - Dirty items record the process which modified them. Only that
+//     process uploads them unless it has died, in which case the next
+//     process to open or reload the item takes over.
+//
+// File locks are always taken last, after any Cache or Item mutexes,
+// and nothing else is locked while they are held. The exceptions are
+// the shared item lock taken in Item.Open and the write lock, which
+// are taken before Item.mu. The write lock may be held while the
+// metadata is locked.
+
+// sharedItemLocks is the number of lock files items are hashed into
+const sharedItemLocks = 1024
+
+// shared coordinates the use of the cache with other processes
+type shared struct {
+	dir  string       // directory for the lock files
+	id   string       // unique id of this process
+	self *flock.Flock // held while this process is running
+	mu   sync.Mutex   // serialises use of meta within this process
+	meta *flock.Flock // serialises metadata access between processes
+}
+
+// newShared sets up the lock files in dir, releasing them when ctx is
+// cancelled
+func newShared(ctx context.Context, dir string) (s *shared, err error) {
+	for _, lockDir := range []string{"items", "writes"} {
+		if err = createDir(filepath.Join(dir, lockDir)); err != nil {
+			return nil, fmt.Errorf("failed to create shared cache lock directory: %w", err)
+		}
+	}
+	s = &shared{
+		dir:  dir,
+		id:   random.String(16),
+		meta: flock.New(filepath.Join(dir, "meta.lock")),
+	}
+	s.removeDead()
+	s.self = flock.New(s.procPath(s.id))
+	if err = s.self.Lock(); err != nil {
+		return nil, fmt.Errorf("failed to lock shared cache: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		s.close()
+	}()
+	fs.Debugf(nil, "vfs cache: sharing cache with other processes using %q as %q", dir, s.id)
+	return s, nil
+}
+
+// close releases the process lock
+func (s *shared) close() {
+	if err := s.self.Unlock(); err != nil {
+		fs.Errorf(nil, "vfs cache: failed to unlock shared cache: %v", err)
+	}
+	_ = os.Remove(s.self.Path())
+}
+
+// procPath returns the path of the lock file for process id
+func (s *shared) procPath(id string) string {
+	return filepath.Join(s.dir, "proc-"+id+".lock")
+}
+
+// removeDead removes the lock files of processes which have exited
+func (s *shared) removeDead() {
+	matches, _ := filepath.Glob(s.procPath("*"))
+	for _, match := range matches {
+		_ = s.alive(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), "proc-"), ".lock"))
+	}
+}
+
+// getID returns the id of this process or "" if not sharing
+func (s *shared) getID() string {
+	if s == nil {
+		return ""
+	}
+	return s.id
+}
+
+// alive returns true if the process with id is still running
+func (s *shared) alive(id string) bool {
+	if id == s.id {
+		return true
+	}
+	lock := flock.New(s.procPath(id))
+	locked, err := lock.TryLock()
+	if err != nil {
+		// assume it is alive if we can't tell
+		fs.Debugf(nil, "vfs cache: failed to check shared cache process %q: %v", id, err)
+		return true
+	}
+	if locked {
+		_ = lock.Unlock()
+		_ = os.Remove(lock.Path())
+		return false
+	}
+	return true
+}
+
+// lockMeta locks the metadata for reading or writing, returning a
+// function to unlock it. It does nothing if s is nil.
+func (s *shared) lockMeta() (unlock func()) {
+	if s == nil {
+		return func() {}
+	}
+	s.mu.Lock()
+	if err := s.meta.Lock(); err != nil {
+		fs.Errorf(nil, "vfs cache: failed to lock shared cache metadata: %v", err)
+	}
+	return func() {
+		if err := s.meta.Unlock(); err != nil {
+			fs.Errorf(nil, "vfs cache: failed to unlock shared cache metadata: %v", err)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// hashLock returns the lock in lockDir for the item called name
+func (s *shared) hashLock(lockDir, name string) *flock.Flock {
+	sum := md5.Sum([]byte(name))
+	n := binary.BigEndian.Uint32(sum[:]) % sharedItemLocks
+	return flock.New(filepath.Join(s.dir, lockDir, fmt.Sprintf("%04d.lock", n)))
+}
+
+// itemLock returns the lock held while the item called name is open
+func (s *shared) itemLock(name string) *flock.Flock {
+	return s.hashLock("items", name)
+}
+
+// writeLock returns the lock held while writing the item called name
+func (s *shared) writeLock(name string) *flock.Flock {
+	return s.hashLock("writes", name)
+}
+
+// _sharedUsed returns the space used by the items in the cache
+// directory which aren't in c.item, so have only been used by other
+// processes. It returns 0 if the cache isn't shared.
+//
+// must be called with mu held
+func (c *Cache) _sharedUsed() (used int64) {
+	if c.shared == nil {
+		return 0
+	}
+	defer c.shared.lockMeta()()
+	err := filepath.Walk(c.metaRoot, func(osPath string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			// evicted by another process while walking
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(c.metaRoot, osPath)
+		if err != nil {
+			return err
+		}
+		if _, found := c.item[filepath.ToSlash(name)]; found {
+			return nil
+		}
+		data, err := os.ReadFile(osPath)
+		if err != nil {
+			return nil
+		}
+		var info Info
+		if json.Unmarshal(data, &info) == nil {
+			used += info.Rs.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		fs.Errorf(nil, "vfs cache: failed to count space used by other processes: %v", err)
+	}
+	return used
+}
+
+// _readSharedInfo reads the metadata for the item from disk
+//
+// call with item.mu and the metadata lock held
+func (item *Item) _readSharedInfo() (info Info, exists bool, err error) {
+	data, err := os.ReadFile(item.c.toOSPathMeta(item.name))
+	if os.IsNotExist(err) {
+		return info, false, nil
+	} else if err != nil {
+		return info, true, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, true, err
+}
+
+// _ownedElsewhere returns true if the item is dirty because it has
+// been modified by another process which is still running
+//
+// call with item.mu held
+func (item *Item) _ownedElsewhere() bool {
+	s := item.c.shared
+	return s != nil && item.info.Dirty && item.info.Owner != "" && item.info.Owner != s.id && s.alive(item.info.Owner)
+}
+
+// _loadShared refreshes the item metadata from disk so it includes
+// any changes made by other processes
+//
+// call with item.mu held
+func (item *Item) _loadShared() {
+	s := item.c.shared
+	if s == nil || (item.info.Dirty && item.info.Owner == s.id) {
+		return
+	}
+	unlock := s.lockMeta()
+	info, exists, err := item._readSharedInfo()
+	unlock()
+	if err != nil {
+		fs.Errorf(item.name, "vfs cache: failed to read shared metadata: %v", err)
+		return
+	}
+	aTime, hits := item.info.ATime, item.info.Hits
+	if exists {
+		item.info = info
+	} else {
+		// evicted by another process
+		item.info.clean()
+	}
+	if aTime.After(item.info.ATime) {
+		item.info.ATime = aTime
+	}
+	item.info.Hits = max(item.info.Hits, hits)
+	if item.info.Dirty && !item._ownedElsewhere() && item.info.Owner != s.id {
+		fs.Infof(item.name, "vfs cache: taking over upload from exited process %q", item.info.Owner)
+		item.info.Owner = s.id
+	}
+}
+
+// _mergeShared merges the metadata on disk into the item before it is
+// saved, returning false if it shouldn't be saved
+//
+// call with item.mu and the metadata lock held
+func (item *Item) _mergeShared() bool {
+	if item.info.Dirty {
+		return true
+	}
+	info, exists, err := item._readSharedInfo()
+	if err != nil || !exists {
+		return true
+	}
+	if info.Dirty && info.Owner != item.c.shared.id && item.c.shared.alive(info.Owner) {
+		// another process has modified the file so its
+		// metadata is newer than ours
+		return false
+	}
+	if !info.Dirty && info.Fingerprint == item.info.Fingerprint && info.Size == item.info.Size {
+		item._mergeRanges(info)
+	}
+	return true
+}
+
+// _mergeRanges adds the ranges present in info to the item
+//
+// call with item.mu held
+func (item *Item) _mergeRanges(info Info) {
+	for _, r := range info.Rs {
+		item.info.Rs.Insert(r)
+	}
+}
+
+// lockWrite takes an exclusive lock on the item so other processes
+// can't write to it, returning a function to release the lock. It
+// does nothing if the cache isn't shared.
+//
+// Don't call with item.mu held as it waits for other processes to
+// finish writing.
+func (item *Item) lockWrite() (unlock func()) {
+	s := item.c.shared
+	if s == nil {
+		return func() {}
+	}
+	lock := s.writeLock(item.name)
+	if err := lock.Lock(); err != nil {
+		fs.Errorf(item.name, "vfs cache: failed to lock shared item for writing: %v", err)
+	}
+	return func() {
+		if err := lock.Unlock(); err != nil {
+			fs.Errorf(item.name, "vfs cache: failed to unlock shared item for writing: %v", err)
+		}
+	}
+}
+
+// _loadSharedRanges adds the ranges other processes have written to
+// the item so they aren't written again
+//
+// call with item.mu and the write lock held
+func (item *Item) _loadSharedRanges() {
+	s := item.c.shared
+	if s == nil {
+		return
+	}
+	unlock := s.lockMeta()
+	info, exists, err := item._readSharedInfo()
+	unlock()
+	if err != nil {
+		fs.Errorf(item.name, "vfs cache: failed to read shared metadata: %v", err)
+		return
+	}
+	// a dirty item has been written so the ranges hold its
+	// contents rather than the object's
+	if exists && (info.Dirty || (info.Fingerprint == item.info.Fingerprint && info.Size == item.info.Size)) {
+		item._mergeRanges(info)
+	}
+}
+
+// _saveShared saves the item so other processes see the ranges
+// written. It does nothing if the cache isn't shared.
+//
+// call with item.mu and the write lock held
+func (item *Item) _saveShared() {
+	if item.c.shared == nil {
+		return
+	}
+	if err := item._save(); err != nil {
+		fs.Errorf(item.name, "vfs cache: failed to save item info: %v", err)
+	}
+}
+
+// lockOpen takes a shared lock on the item so other processes won't
+// evict it while it is open
+//
+// Don't call with item.mu held as it may wait for another process to
+// finish evicting the item.
+func (item *Item) lockOpen() error {
+	s := item.c.shared
+	if s == nil {
+		return nil
+	}
+	lock := s.itemLock(item.name)
+	if err := lock.RLock(); err != nil {
+		return fmt.Errorf("vfs cache item: failed to lock shared item: %w", err)
+	}
+	item.mu.Lock()
+	item.sharedLocks = append(item.sharedLocks, lock)
+	item.mu.Unlock()
+	return nil
+}
+
+// _unlockOpen releases the shared locks until keep are left
+//
+// call with item.mu held
+func (item *Item) _unlockOpen(keep int) {
+	for len(item.sharedLocks) > max(keep, 0) {
+		n := len(item.sharedLocks) - 1
+		if err := item.sharedLocks[n].Unlock(); err != nil {
+			fs.Errorf(item.name, "vfs cache: failed to unlock shared item: %v", err)
+		}
+		item.sharedLocks = item.sharedLocks[:n]
+	}
+}
+
+// _lockEvict tries to take an exclusive lock on the item so it can be
+// evicted. It returns nil if the item may be in use by another
+// process, otherwise a function to release the lock.
+//
+// call with item.mu held
+func (item *Item) _lockEvict() (unlock func()) {
+	s := item.c.shared
+	if s == nil {
+		return func() {}
+	}
+	lock := s.itemLock(item.name)
+	locked, err := lock.TryLock()
+	if err != nil {
+		fs.Errorf(item.name, "vfs cache: failed to lock shared item: %v", err)
+		return nil
+	}
+	if !locked {
+		fs.Debugf(item.name, "vfs cache: not evicting as it may be in use by another process")
+		return nil
+	}
+	return func() {
+		_ = lock.Unlock()
+	}
+}
@@ -0,0 +1,174 @@
+package vfscache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/ranges"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSharedTestCaches makes two caches sharing the same directory as
+// if they were in different processes
+func newSharedTestCaches(t *testing.T) (r *fstest.Run, c1, c2 *Cache, cancel2 context.CancelFunc) {
+	opt := vfscommon.Opt
+	opt.CacheMode = vfscommon.CacheModeFull
+	opt.CacheShared = true
+	opt.CachePollInterval = 0
+	opt.WriteBack = 0
+	opt.HandleCaching = 0
+	r, c1 = newTestCacheOpt(t, opt)
+
+	ctx, cancel2 := context.WithCancel(context.Background())
+	t.Cleanup(cancel2)
+	opt2 := opt
+	c2, err := New(ctx, r.Fremote, &opt2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, c1.root, c2.root)
+	assert.NotEqual(t, c1.shared.id, c2.shared.id)
+	return r, c1, c2, cancel2
+}
+
+func TestSharedAlive(t *testing.T) {
+	_, c1, c2, cancel2 := newSharedTestCaches(t)
+	assert.True(t, c1.shared.alive(c1.shared.id))
+	assert.True(t, c1.shared.alive(c2.shared.id))
+	assert.False(t, c1.shared.alive("potato"))
+	assert.Equal(t, true, c1.Stats()["shared"])
+
+	cancel2()
+	assert.Eventually(t, func() bool {
+		return !c1.shared.alive(c2.shared.id)
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestSharedEviction(t *testing.T) {
+	r, c1, c2, _ := newSharedTestCaches(t)
+	contents, obj, item1 := newFile(t, r, c1, "existing")
+
+	// read some of the file in c1
+	require.NoError(t, item1.Open(obj))
+	buf := make([]byte, 10)
+	_, err := item1.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, contents[:10], string(buf))
+
+	// c2 can't evict it while c1 has it open
+	item2 := c2.Item("existing")
+	c2.purgeOld(-10)
+	assert.True(t, c2.Exists("existing"))
+	rr, _, err := item2.Reset()
+	require.NoError(t, err)
+	assert.Equal(t, SkippedShared, rr)
+
+	// when c2 opens the file it sees what c1 downloaded
+	require.NoError(t, item1.Close(nil))
+	item2 = c2.Item("existing")
+	require.NoError(t, item2.Open(obj))
+	assert.True(t, item2.HasRange(ranges.Range{Pos: 0, Size: 10}))
+	_, err = item2.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, contents[:10], string(buf))
+	assert.Equal(t, int64(1), c2.Stats()["hits"])
+	assert.Equal(t, int64(0), c2.Stats()["misses"])
+
+	// and c1 can't evict it while c2 has it open
+	c1.purgeOld(-10)
+	assert.True(t, c1.Exists("existing"))
+
+	// until c2 closes it
+	require.NoError(t, item2.Close(nil))
+	c1.purgeOld(-10)
+	assert.False(t, c1.Exists("existing"))
+}
+
+func TestSharedDirtyOwner(t *testing.T) {
+	_, c1, c2, cancel2 := newSharedTestCaches(t)
+
+	// modify a file in c2 without closing it
+	item2 := c2.Item("dirty")
+	itemWrite(t, item2, "hello")
+	assert.True(t, item2.IsDirty())
+
+	// c1 sees the file is dirty but owned by c2 so won't upload it
+	item1 := c1.Item("dirty")
+	item1.mu.Lock()
+	assert.Equal(t, c2.shared.id, item1.info.Owner)
+	assert.True(t, item1.info.Dirty)
+	assert.True(t, item1._ownedElsewhere())
+	item1.mu.Unlock()
+
+	// if c2 exits c1 takes over the upload when it opens it
+	cancel2()
+	assert.Eventually(t, func() bool {
+		return !c1.shared.alive(c2.shared.id)
+	}, 10*time.Second, 10*time.Millisecond)
+	require.NoError(t, item1.Open(nil))
+	item1.mu.Lock()
+	assert.Equal(t, c1.shared.id, item1.info.Owner)
+	assert.False(t, item1._ownedElsewhere())
+	item1.mu.Unlock()
+	require.NoError(t, item1.Close(nil))
+}
+
+func TestSharedWriteRanges(t *testing.T) {
+	r, c1, c2, _ := newSharedTestCaches(t)
+	contents, obj, item1 := newFile(t, r, c1, "existing")
+
+	// open the file in both caches before anything is downloaded
+	item2 := c2.Item("existing")
+	require.NoError(t, item1.Open(obj))
+	require.NoError(t, item2.Open(obj))
+	assert.False(t, item2.HasRange(ranges.Range{Pos: 0, Size: 10}))
+
+	// c1 downloads the file and writes over part of it
+	buf := make([]byte, 10)
+	_, err := item1.ReadAt(buf, 0)
+	require.NoError(t, err)
+	_, err = item1.WriteAt([]byte("HELLO"), 10)
+	require.NoError(t, err)
+
+	// a download in c2 doesn't write over either of them
+	n, skipped, err := item2.WriteAtNoOverwrite([]byte("potatopotatopotato"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 18, n)
+	assert.Equal(t, 18, skipped)
+	buf = make([]byte, 18)
+	_, err = item1.fd.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, contents[:10]+"HELLO"+contents[15:18], string(buf))
+
+	require.NoError(t, item2.Close(nil))
+	require.NoError(t, item1.Close(nil))
+}
+
+func TestSharedUsed(t *testing.T) {
+	r, c1, c2, _ := newSharedTestCaches(t)
+
+	// download a file in each cache
+	for i, c := range []*Cache{c1, c2} {
+		name := fmt.Sprintf("file%d", i)
+		_, obj, item := newFile(t, r, c, name)
+		require.NoError(t, item.Open(obj))
+		buf := make([]byte, 100)
+		_, err := item.ReadAt(buf, 0)
+		require.NoError(t, err)
+		require.NoError(t, item.Close(nil))
+	}
+
+	// each cache counts the other's file
+	assert.Equal(t, int64(200), c1.updateUsed())
+	assert.Equal(t, int64(200), c2.updateUsed())
+
+	// so the total is kept under the quota
+	c2.opt.CacheMaxSize = 150
+	c2.purgeOverQuota()
+	assert.True(t, c1.Exists("file0"))
+	assert.False(t, c2.Exists("file1"))
+	assert.Equal(t, int64(100), c1.updateUsed())
+}
@@ -0,0 +1,33 @@
+package vfscommon
+
+import (
+	"github.com/rclone/rclone/fs"
+)
+
+type cacheEvictionChoices struct{}
+
+func (cacheEvictionChoices) Choices() []string {
+	return []string{
+		CacheEvictionLRU:  "lru",
+		CacheEvictionLFU:  "lfu",
+		CacheEvictionARC:  "arc",
+		CacheEvictionSize: "size",
+	}
+}
+
+// CacheEviction controls the order files are evicted from the cache
+// when it is over quota
+type CacheEviction = fs.Enum[cacheEvictionChoices]
+
+// CacheEviction options
+const (
+	CacheEvictionLRU  CacheEviction = iota // least recently used first
+	CacheEvictionLFU                       // least frequently used first
+	CacheEvictionARC                       // files used once before files used repeatedly, least recently used first
+	CacheEvictionSize                      // largest and least recently used first
+)
+
+// Type of the value
+func (cacheEvictionChoices) Type() string {
+	return "CacheEviction"
+}
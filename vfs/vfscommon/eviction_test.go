@@ -0,0 +1,37 @@
+package vfscommon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// Check CacheEviction it satisfies the pflag interface
+var _ pflag.Value = (*CacheEviction)(nil)
+
+// Check CacheEviction it satisfies the json.Unmarshaller interface
+var _ json.Unmarshaler = (*CacheEviction)(nil)
+
+func TestCacheEvictionString(t *testing.T) {
+	assert.Equal(t, "lru", CacheEvictionLRU.String())
+	assert.Equal(t, "size", CacheEvictionSize.String())
+	assert.Equal(t, "Unknown(17)", CacheEviction(17).String())
+}
+
+func TestCacheEvictionSet(t *testing.T) {
+	var m CacheEviction
+
+	err := m.Set("arc")
+	assert.NoError(t, err)
+	assert.Equal(t, CacheEvictionARC, m)
+
+	err = m.Set("potato")
+	assert.Error(t, err)
+}
+
+func TestCacheEvictionType(t *testing.T) {
+	var m CacheEviction
+	assert.Equal(t, "CacheEviction", m.Type())
+}
@@ -45,6 +45,11 @@ var OptionsInfo = fs.Options{{
 	Default: false,
 	Help:    "Only allow read-only access",
 	Groups:  "VFS",
+}, {
+	Name:    "vfs_snapshot_time",
+	Default: fs.Time{},
+	Help:    "Show the remote read only as it was at this time (needs a remote which keeps old versions)",
+	Groups:  "VFS",
 }, {
 	Name:    "vfs_links",
 	Default: false,
@@ -65,6 +70,26 @@ var OptionsInfo = fs.Options{{
 	Default: fs.Duration(3600 * time.Second),
 	Help:    "Max time since last access of objects in the cache",
 	Groups:  "VFS",
+}, {
+	Name:    "vfs_cache_shared",
+	Default: false,
+	Help:    "Share the cache with other rclone processes using the same remote",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_cache_eviction",
+	Default: CacheEvictionLRU,
+	Help:    "Order to evict files from the cache when over quota",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_cache_priority_file",
+	Default: "",
+	Help:    "File of path patterns and priorities for evicting files from the cache",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_pin_refresh_interval",
+	Default: fs.Duration(time.Hour),
+	Help:    "Interval to check pinned directories for changes (0 to disable)",
+	Groups:  "VFS",
 }, {
 	Name:    "vfs_cache_max_size",
 	Default: fs.SizeSuffix(-1),
@@ -150,6 +175,11 @@ var OptionsInfo = fs.Options{{
 	Default: fs.SizeSuffix(-1),
 	Help:    "Specify the total space of disk",
 	Groups:  "VFS",
+}, {
+	Name:    "vfs_quota",
+	Default: fs.SizeSuffix(-1),
+	Help:    "Max total size of the files in the VFS - writes which would go over this fail",
+	Groups:  "VFS",
 }, {
 	Name:    "umask",
 	Default: FileMode(getUmask()),
@@ -183,13 +213,14 @@ func init() {
 
 // Options is options for creating the vfs
 type Options struct {
-	NoSeek             bool          `config:"no_seek"`        // don't allow seeking if set
-	NoChecksum         bool          `config:"no_checksum"`    // don't check checksums if set
-	ReadOnly           bool          `config:"read_only"`      // if set VFS is read only
-	Links              bool          `config:"vfs_links"`      // if set interpret link files
-	NoModTime          bool          `config:"no_modtime"`     // don't read mod times for files
-	DirCacheTime       fs.Duration   `config:"dir_cache_time"` // how long to consider directory listing cache valid
-	Refresh            bool          `config:"vfs_refresh"`    // refreshes the directory listing recursively on start
+	NoSeek             bool          `config:"no_seek"`           // don't allow seeking if set
+	NoChecksum         bool          `config:"no_checksum"`       // don't check checksums if set
+	ReadOnly           bool          `config:"read_only"`         // if set VFS is read only
+	SnapshotTime       fs.Time       `config:"vfs_snapshot_time"` // if set show the remote as it was at this time
+	Links              bool          `config:"vfs_links"`         // if set interpret link files
+	NoModTime          bool          `config:"no_modtime"`        // don't read mod times for files
+	DirCacheTime       fs.Duration   `config:"dir_cache_time"`    // how long to consider directory listing cache valid
+	Refresh            bool          `config:"vfs_refresh"`       // refreshes the directory listing recursively on start
 	PollInterval       fs.Duration   `config:"poll_interval"`
 	Umask              FileMode      `config:"umask"`
 	UID                uint32        `config:"uid"`
@@ -205,6 +236,10 @@ type Options struct {
 	CacheMaxSize       fs.SizeSuffix `config:"vfs_cache_max_size"`
 	CacheMinFreeSpace  fs.SizeSuffix `config:"vfs_cache_min_free_space"`
 	CachePollInterval  fs.Duration   `config:"vfs_cache_poll_interval"`
+	CacheShared        bool          `config:"vfs_cache_shared"`
+	CacheEviction      CacheEviction `config:"vfs_cache_eviction"`
+	CachePriorityFile  string        `config:"vfs_cache_priority_file"`
+	PinRefreshInterval fs.Duration   `config:"vfs_pin_refresh_interval"`
 	CaseInsensitive    bool          `config:"vfs_case_insensitive"`
 	BlockNormDupes     bool          `config:"vfs_block_norm_dupes"`
 	WriteWait          fs.Duration   `config:"vfs_write_wait"`       // time to wait for in-sequence write
@@ -214,6 +249,7 @@ type Options struct {
 	UsedIsSize         bool          `config:"vfs_used_is_size"`     // if true, use the `rclone size` algorithm for Used size
 	FastFingerprint    bool          `config:"vfs_fast_fingerprint"` // if set use fast fingerprints
 	DiskSpaceTotalSize fs.SizeSuffix `config:"vfs_disk_space_total_size"`
+	Quota              fs.SizeSuffix `config:"vfs_quota"`              // if >= 0 refuse writes which would make the VFS bigger than this
 	HandleCaching      fs.Duration   `config:"vfs_handle_caching"`     // time to keep handle alive after last close
 	MetadataExtension  string        `config:"vfs_metadata_extension"` // if set respond to files with this extension with metadata
 }
@@ -230,6 +266,11 @@ func (opt *Options) Init(ctx context.Context) {
 		opt.Links = true
 	}
 
+	// Snapshots of the past can't be modified
+	if opt.SnapshotTime.IsSet() {
+		opt.ReadOnly = true
+	}
+
 	// Mask the permissions with the umask
 	opt.DirPerms &= ^opt.Umask
 	opt.FilePerms &= ^opt.Umask
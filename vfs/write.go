@@ -26,6 +26,7 @@ type WriteFileHandle struct {
 	writeCalled bool // set the first time Write() is called
 	opened      bool
 	truncated   bool
+	quotaSize   int64 // size of the file charged to the quota
 }
 
 // Check interfaces
@@ -79,6 +80,7 @@ func (fh *WriteFileHandle) openPending() (err error) {
 		fh.o = o
 		fh.result <- err
 	}()
+	fh.quotaSize = fh.file.Size() // the old contents are replaced
 	fh.file.setSize(0)
 	fh.truncated = true
 	fh.file.Dir().addObject(fh.file) // make sure the directory has this object in it now
@@ -141,6 +143,9 @@ func (fh *WriteFileHandle) writeAt(p []byte, off int64) (n int, err error) {
 	if err = fh.openPending(); err != nil {
 		return 0, err
 	}
+	if err = fh.file.VFS().quotaGrow(&fh.quotaSize, off+int64(len(p))); err != nil {
+		return 0, err
+	}
 	fh.writeCalled = true
 	n, err = fh.pipeWriter.Write(p)
 	fh.offset += int64(n)
@@ -195,6 +200,9 @@ func (fh *WriteFileHandle) close() (err error) {
 	}()
 	// If file not opened and not safe to truncate then leave file intact
 	if !fh.opened && !fh.safeToTruncate() {
+		// Nothing will be uploaded so apply anything set while open now
+		_ = fh.file.applyPendingModTime()
+		_ = fh.file.applyPendingMetadata()
 		return nil
 	}
 	if err = fh.openPending(); err != nil {
@@ -0,0 +1,331 @@
+// Extended attributes
+
+package vfs
+
+import (
+	"encoding/base64"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Extended attributes are mapped onto the user metadata of the
+// object.
+//
+// Attributes in the "user." namespace are stored with the prefix
+// removed so "user.comment" is stored in the metadata key "comment".
+// Metadata keys are lower case on most backends so upper case letters
+// in the names are stored as "^" followed by the lower case letter,
+// and "^" as "^^", so "user.MimeType" is stored as "^mime^type".
+//
+// POSIX ACLs are passed through by storing them base64 encoded in the
+// metadata keys in xattrACLs. They aren't enforced by rclone.
+//
+// Attributes in any other namespace aren't supported.
+
+// xattrUserPrefix is the namespace of attributes stored in metadata
+const xattrUserPrefix = "user."
+
+// Flags for SetXattr. These have the same values as the flags for
+// setxattr(2) on Linux.
+const (
+	XattrCreate  = 1 // fail with EEXIST if the attribute exists
+	XattrReplace = 2 // fail with ENOATTR if the attribute doesn't exist
+)
+
+// xattrCaseEscape marks an upper case letter in a metadata key
+const xattrCaseEscape = '^'
+
+// encodeXattrCase encodes the upper case letters in name so it
+// survives being lower cased
+func encodeXattrCase(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r == xattrCaseEscape:
+			b.WriteRune(xattrCaseEscape)
+		case unicode.IsUpper(r):
+			b.WriteRune(xattrCaseEscape)
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// decodeXattrCase undoes encodeXattrCase
+func decodeXattrCase(key string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range key {
+		switch {
+		case escaped:
+			if r != xattrCaseEscape {
+				r = unicode.ToUpper(r)
+			}
+			escaped = false
+		case r == xattrCaseEscape:
+			escaped = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// xattrACLs maps the POSIX ACL attributes to their metadata keys
+var xattrACLs = map[string]string{
+	"system.posix_acl_access":  "posix-acl-access",
+	"system.posix_acl_default": "posix-acl-default",
+}
+
+// xattrToKey returns the metadata key for the attribute called name,
+// whether the value is binary and whether it is supported at all.
+func xattrToKey(name string) (key string, binary bool, ok bool) {
+	if key, ok = xattrACLs[name]; ok {
+		return key, true, true
+	}
+	if !strings.HasPrefix(name, xattrUserPrefix) || len(name) == len(xattrUserPrefix) {
+		return "", false, false
+	}
+	key = encodeXattrCase(name[len(xattrUserPrefix):])
+	for _, aclKey := range xattrACLs {
+		if key == aclKey {
+			return "", false, false
+		}
+	}
+	return key, false, true
+}
+
+// keyToXattr returns the attribute name for the metadata key
+func keyToXattr(key string) (name string) {
+	for name, aclKey := range xattrACLs {
+		if key == aclKey {
+			return name
+		}
+	}
+	return xattrUserPrefix + decodeXattrCase(key)
+}
+
+// xattrSupported returns true if extended attributes can be used on
+// this VFS
+func (vfs *VFS) xattrSupported() bool {
+	return vfs.f.Features().UserMetadata
+}
+
+// lookupXattr returns the value of key in metadata. Keys set by other
+// tools on backends which don't lower case keys may have upper case
+// letters which aren't escaped, so these are looked for too.
+func lookupXattr(metadata fs.Metadata, name, key string) (value string, found bool) {
+	if value, found = metadata[key]; found {
+		return value, true
+	}
+	if strings.HasPrefix(name, xattrUserPrefix) {
+		value, found = metadata[name[len(xattrUserPrefix):]]
+	}
+	return value, found
+}
+
+// isSystemMetadata returns true if key is system metadata managed by
+// the backend rather than user metadata
+func (vfs *VFS) isSystemMetadata(key string) bool {
+	fsInfo := fs.FindFromFs(vfs.f)
+	if fsInfo == nil || fsInfo.MetadataInfo == nil {
+		return false
+	}
+	_, found := fsInfo.MetadataInfo.System[key]
+	return found
+}
+
+// xattrMetadata returns the user metadata of the file including any
+// which is waiting to be applied
+func (f *File) xattrMetadata() (metadata fs.Metadata, err error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f._xattrMetadata()
+}
+
+// _xattrMetadata returns the user metadata of the file including any
+// which is waiting to be applied
+//
+// Call with f.mu held for read or write
+func (f *File) _xattrMetadata() (metadata fs.Metadata, err error) {
+	if f.o != nil {
+		objectMetadata, err := fs.GetMetadata(f.ctx, f.o)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range objectMetadata {
+			if !f.d.vfs.isSystemMetadata(k) {
+				metadata.Set(k, v)
+			}
+		}
+	}
+	for k, v := range f.pendingMetadata {
+		metadata.Set(k, v)
+	}
+	return metadata, nil
+}
+
+// ListXattr returns the names of the extended attributes of the file
+func (f *File) ListXattr() (names []string, err error) {
+	if !f.VFS().xattrSupported() {
+		return nil, ENOTSUP
+	}
+	metadata, err := f.xattrMetadata()
+	if err != nil {
+		return nil, err
+	}
+	for k := range metadata {
+		names = append(names, keyToXattr(k))
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// GetXattr returns the value of the extended attribute called name
+//
+// It returns ENOATTR if it isn't set.
+func (f *File) GetXattr(name string) (value []byte, err error) {
+	if !f.VFS().xattrSupported() {
+		return nil, ENOTSUP
+	}
+	key, binary, ok := xattrToKey(name)
+	if !ok {
+		return nil, ENOATTR
+	}
+	metadata, err := f.xattrMetadata()
+	if err != nil {
+		return nil, err
+	}
+	v, found := lookupXattr(metadata, name, key)
+	if !found {
+		return nil, ENOATTR
+	}
+	if binary {
+		return base64.StdEncoding.DecodeString(v)
+	}
+	return []byte(v), nil
+}
+
+// SetXattr sets the extended attribute called name to value
+//
+// flags may contain XattrCreate to fail with EEXIST if the attribute
+// is already set or XattrReplace to fail with ENOATTR if it isn't.
+//
+// If the file is being written the attribute is set once it has been
+// uploaded.
+func (f *File) SetXattr(name string, value []byte, flags int) error {
+	if !f.VFS().xattrSupported() {
+		return ENOTSUP
+	}
+	if f.VFS().Opt.ReadOnly {
+		return EROFS
+	}
+	key, binary, ok := xattrToKey(name)
+	if !ok {
+		return ENOTSUP
+	}
+	v := string(value)
+	if binary {
+		v = base64.StdEncoding.EncodeToString(value)
+	}
+	// Check and set under the same lock so a concurrent set can't
+	// slip in between
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if flags&(XattrCreate|XattrReplace) != 0 {
+		metadata, err := f._xattrMetadata()
+		if err != nil {
+			return err
+		}
+		_, found := lookupXattr(metadata, name, key)
+		if found && flags&XattrCreate != 0 {
+			return EEXIST
+		}
+		if !found && flags&XattrReplace != 0 {
+			return ENOATTR
+		}
+	}
+	f.pendingMetadata.Set(key, v)
+
+	// Only update the metadata when there are no writers, setObject will do it
+	if !f._writingInProgress() {
+		return f._applyPendingMetadata()
+	}
+
+	// queue up for later, hoping f.o becomes available
+	return nil
+}
+
+// RemoveXattr removes the extended attribute called name
+//
+// Backends can't remove individual metadata keys so this only removes
+// attributes which haven't been applied yet. It returns ENOTSUP for
+// attributes which are set on the object and ENOATTR for attributes
+// which aren't set at all.
+func (f *File) RemoveXattr(name string) error {
+	if !f.VFS().xattrSupported() {
+		return ENOTSUP
+	}
+	if f.VFS().Opt.ReadOnly {
+		return EROFS
+	}
+	key, _, ok := xattrToKey(name)
+	if !ok {
+		return ENOATTR
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, found := f.pendingMetadata[key]; found {
+		delete(f.pendingMetadata, key)
+		return nil
+	}
+	metadata, err := f._xattrMetadata()
+	if err != nil {
+		return err
+	}
+	if _, found := lookupXattr(metadata, name, key); !found {
+		return ENOATTR
+	}
+	fs.Debugf(f, "Can't remove extended attribute %q as the backend can't remove metadata", name)
+	return ENOTSUP
+}
+
+// Apply pending metadata
+// Call with the mutex held
+func (f *File) _applyPendingMetadata() error {
+	if len(f.pendingMetadata) == 0 {
+		return nil
+	}
+	defer func() { f.pendingMetadata = nil }()
+
+	if f.o == nil {
+		return ENOENT
+	}
+	do, ok := f.o.(fs.SetMetadataer)
+	if !ok {
+		fs.Errorf(f.o, "Can't apply pending metadata %v as the backend doesn't support setting it", f.pendingMetadata)
+		return ENOTSUP
+	}
+	err := do.SetMetadata(f.ctx, f.pendingMetadata)
+	switch err {
+	case nil:
+		fs.Debugf(f.o, "Applied pending metadata %v OK", f.pendingMetadata)
+	case fs.ErrorNotImplemented:
+		return ENOTSUP
+	default:
+		fs.Errorf(f.o, "Failed to apply pending metadata %v: %v", f.pendingMetadata, err)
+		return err
+	}
+	return nil
+}
+
+// Apply pending metadata
+func (f *File) applyPendingMetadata() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f._applyPendingMetadata()
+}
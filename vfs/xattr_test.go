@@ -0,0 +1,173 @@
+package vfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXattrToKey(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		key    string
+		binary bool
+		ok     bool
+	}{
+		{"user.comment", "comment", false, true},
+		{"user.Mime_Type", "^mime_^type", false, true},
+		{"user.a^b", "a^^b", false, true},
+		{"user.", "", false, false},
+		{"user.posix-acl-access", "", false, false},
+		{"system.posix_acl_access", "posix-acl-access", true, true},
+		{"system.posix_acl_default", "posix-acl-default", true, true},
+		{"security.selinux", "", false, false},
+		{"trusted.potato", "", false, false},
+	} {
+		key, binary, ok := xattrToKey(test.name)
+		assert.Equal(t, test.key, key, test.name)
+		assert.Equal(t, test.binary, binary, test.name)
+		assert.Equal(t, test.ok, ok, test.name)
+		if ok {
+			assert.Equal(t, test.name, keyToXattr(key), test.name)
+		}
+	}
+}
+
+// fileXattrCreate makes a file to test xattrs on, skipping the test if
+// the remote doesn't support setting them
+func fileXattrCreate(t *testing.T, mode vfscommon.CacheMode) (vfs *VFS, file *File) {
+	r, vfs, file, _ := fileCreate(t, mode)
+	if !r.Fremote.Features().UserMetadata {
+		t.Skip("remote doesn't support user metadata")
+	}
+	require.NoError(t, file.SetXattr("user.probe", []byte("probe"), 0))
+	if _, err := file.GetXattr("user.probe"); err == ENOATTR {
+		t.Skip("remote filesystem doesn't support setting metadata")
+	}
+	return vfs, file
+}
+
+func TestFileXattr(t *testing.T) {
+	_, file := fileXattrCreate(t, vfscommon.CacheModeOff)
+
+	// Set and get user attributes
+	require.NoError(t, file.SetXattr("user.Comment", []byte("hello"), 0))
+	value, err := file.GetXattr("user.Comment")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(value))
+	_, err = file.GetXattr("user.comment")
+	assert.Equal(t, ENOATTR, err)
+	_, err = file.GetXattr("user.missing")
+	assert.Equal(t, ENOATTR, err)
+
+	// ACLs are stored as binary
+	acl := []byte{2, 0, 0, 0, 1, 0, 6, 0, 0xff, 0xff, 0xff, 0xff}
+	require.NoError(t, file.SetXattr("system.posix_acl_access", acl, 0))
+	value, err = file.GetXattr("system.posix_acl_access")
+	require.NoError(t, err)
+	assert.Equal(t, acl, value)
+
+	names, err := file.ListXattr()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"system.posix_acl_access", "user.Comment", "user.probe"}, names)
+
+	// Other namespaces aren't supported
+	_, err = file.GetXattr("security.selinux")
+	assert.Equal(t, ENOATTR, err)
+	assert.Equal(t, ENOTSUP, file.SetXattr("security.selinux", []byte("x"), 0))
+
+	// Applied attributes can't be removed
+	assert.Equal(t, ENOTSUP, file.RemoveXattr("user.Comment"))
+	assert.Equal(t, ENOATTR, file.RemoveXattr("user.missing"))
+}
+
+func TestFileXattrFlags(t *testing.T) {
+	_, file := fileXattrCreate(t, vfscommon.CacheModeOff)
+
+	assert.Equal(t, ENOATTR, file.SetXattr("user.new", []byte("x"), XattrReplace))
+	require.NoError(t, file.SetXattr("user.new", []byte("one"), XattrCreate))
+	assert.Equal(t, EEXIST, file.SetXattr("user.new", []byte("two"), XattrCreate))
+	require.NoError(t, file.SetXattr("user.new", []byte("three"), XattrReplace))
+	value, err := file.GetXattr("user.new")
+	require.NoError(t, err)
+	assert.Equal(t, "three", string(value))
+
+	// Only one of several concurrent creates succeeds
+	const n = 8
+	errs := make(chan error, n)
+	for i := range n {
+		go func() {
+			errs <- file.SetXattr("user.race", []byte(fmt.Sprint(i)), XattrCreate)
+		}()
+	}
+	created := 0
+	for range n {
+		err := <-errs
+		if err == nil {
+			created++
+		} else {
+			assert.Equal(t, EEXIST, err)
+		}
+	}
+	assert.Equal(t, 1, created)
+}
+
+func TestFileXattrNotSupported(t *testing.T) {
+	r, _, file, _ := fileCreate(t, vfscommon.CacheModeOff)
+	if r.Fremote.Features().UserMetadata {
+		t.Skip("remote supports user metadata")
+	}
+	_, err := file.ListXattr()
+	assert.Equal(t, ENOTSUP, err)
+	_, err = file.GetXattr("user.comment")
+	assert.Equal(t, ENOTSUP, err)
+	assert.Equal(t, ENOTSUP, file.SetXattr("user.comment", []byte("hello"), 0))
+	assert.Equal(t, ENOTSUP, file.RemoveXattr("user.comment"))
+}
+
+func TestFileXattrPending(t *testing.T) {
+	vfs, file := fileXattrCreate(t, vfscommon.CacheModeWrites)
+
+	// Attributes set while writing are applied when the file is closed
+	fd, err := file.Open(os.O_WRONLY | os.O_TRUNC)
+	require.NoError(t, err)
+	_, err = fd.Write([]byte("new contents"))
+	require.NoError(t, err)
+	require.NoError(t, file.SetXattr("user.pending", []byte("later"), 0))
+	require.NoError(t, file.SetXattr("user.removed", []byte("never"), 0))
+	require.NoError(t, file.RemoveXattr("user.removed"))
+	value, err := file.GetXattr("user.pending")
+	require.NoError(t, err)
+	assert.Equal(t, "later", string(value))
+	require.NoError(t, fd.Close())
+
+	vfs.WaitForWriters(waitForWritersDelay)
+	file.mu.RLock()
+	assert.Nil(t, file.pendingMetadata)
+	file.mu.RUnlock()
+	value, err = file.GetXattr("user.pending")
+	require.NoError(t, err)
+	assert.Equal(t, "later", string(value))
+	_, err = file.GetXattr("user.removed")
+	assert.Equal(t, ENOATTR, err)
+}
+
+func TestFileXattrReadOnly(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.ReadOnly = true
+	r, vfs := newTestVFSOpt(t, &opt)
+	if !r.Fremote.Features().UserMetadata {
+		t.Skip("remote doesn't support user metadata")
+	}
+	r.WriteObject(context.Background(), "file1", "file1 contents", t1)
+	node, err := vfs.Stat("file1")
+	require.NoError(t, err)
+	file := node.(*File)
+	assert.Equal(t, EROFS, file.SetXattr("user.comment", []byte("hello"), 0))
+	assert.Equal(t, EROFS, file.RemoveXattr("user.comment"))
+}
@@ -12,14 +12,28 @@ import (
 
 // CreateZip creates a zip file from a vfs.Dir writing it to w
 func CreateZip(ctx context.Context, dir *Dir, w io.Writer) (err error) {
+	nodes, err := dir.ReadDirAll()
+	if err != nil {
+		return fmt.Errorf("create zip directory read: %w", err)
+	}
+	return CreateZipNodes(ctx, nodes, w)
+}
+
+// CreateZipNodes creates a zip file from the nodes passed in writing
+// it to w. Directories are added with all their contents.
+func CreateZipNodes(ctx context.Context, nodes Nodes, w io.Writer) (err error) {
 	zipWriter := zip.NewWriter(w)
 	defer fs.CheckClose(zipWriter, &err)
 	var walk func(dir *Dir, root string) error
+	var add func(nodes Nodes, root string) error
 	walk = func(dir *Dir, root string) error {
 		nodes, err := dir.ReadDirAll()
 		if err != nil {
 			return fmt.Errorf("create zip directory read: %w", err)
 		}
+		return add(nodes, root)
+	}
+	add = func(nodes Nodes, root string) error {
 		for _, node := range nodes {
 			switch e := node.(type) {
 			case *File:
@@ -65,7 +79,7 @@ func CreateZip(ctx context.Context, dir *Dir, w io.Writer) (err error) {
 		}
 		return nil
 	}
-	err = walk(dir, "")
+	err = add(nodes, "")
 	if err != nil {
 		return err
 	}
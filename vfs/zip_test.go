@@ -158,3 +158,30 @@ func TestZipDirsInRoot(t *testing.T) {
 	gz, _ := zipReadFile(t, zr, func(n string) bool { return strings.HasSuffix(n, "/c.txt") })
 	require.Equal(t, "z", string(gz))
 }
+
+func TestZipNodes(t *testing.T) {
+	r, vfs := newTestVFS(t)
+
+	r.WriteObject(context.Background(), "sel/one.txt", "one", t1)
+	r.WriteObject(context.Background(), "sel/two.txt", "two", t1)
+	r.WriteObject(context.Background(), "sel/sub/three.txt", "three", t1)
+
+	var nodes Nodes
+	for _, name := range []string{"sel/one.txt", "sel/sub"} {
+		node, err := vfs.Stat(name)
+		require.NoError(t, err)
+		nodes = append(nodes, node)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, CreateZipNodes(context.Background(), nodes, &buf))
+	zr := readZip(t, &buf)
+
+	got, _ := zipReadFile(t, zr, func(n string) bool { return n == "one.txt" })
+	require.Equal(t, "one", string(got))
+	got, _ = zipReadFile(t, zr, func(n string) bool { return strings.HasSuffix(n, "three.txt") })
+	require.Equal(t, "three", string(got))
+	for _, f := range zr.File {
+		require.NotContains(t, f.Name, "two.txt")
+	}
+}